@@ -0,0 +1,78 @@
+package git
+
+import (
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/archive"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Archive writes to w an archive of a tree, in the same way as the
+// git-archive command. If the tree is given by a commit or a tag, the commit
+// ID is recorded in the archive and the files with the export-subst
+// attribute are expanded.
+func (r *Repository) Archive(w io.Writer, o *ArchiveOptions) error {
+	if err := o.Validate(r); err != nil {
+		return err
+	}
+
+	tree, commit, err := archive.ResolveTree(r.Storer, o.Tree)
+	if err != nil {
+		return err
+	}
+
+	ao := &archive.Options{
+		Format: o.Format,
+		Prefix: o.Prefix,
+		Paths:  o.Paths,
+		Commit: commit,
+	}
+
+	if o.Submodules {
+		wt, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		ao.Submodules = submoduleResolver(wt)
+	}
+
+	return archive.NewEncoder(w, ao).Encode(tree)
+}
+
+// submoduleResolver returns the commits of the submodules of the worktree,
+// from their repositories.
+func submoduleResolver(w *Worktree) archive.SubmoduleResolver {
+	return func(path string, h plumbing.Hash) (*object.Commit, archive.SubmoduleResolver, error) {
+		subs, err := w.Submodules()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, s := range subs {
+			if s.Config().Path != path {
+				continue
+			}
+
+			r, err := s.Repository()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			c, err := r.CommitObject(h)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			sw, err := r.Worktree()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return c, submoduleResolver(sw), nil
+		}
+
+		return nil, nil, ErrSubmoduleNotFound
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type CmdAdd struct {
+	cmd
+
+	Args struct {
+		Paths []string `positional-arg-name:"pathspec" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func (CmdAdd) Usage() string {
+	return fmt.Sprintf("usage: %s add <pathspec>...", os.Args[0])
+}
+
+func (c *CmdAdd) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range c.Args.Paths {
+		p, err := worktreePath(w, p)
+		if err != nil {
+			return err
+		}
+
+		if strings.ContainsAny(p, "*?[") {
+			err = w.AddGlob(p)
+		} else {
+			_, err = w.Add(p)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %s", p, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+type CmdBlame struct {
+	cmd
+
+	Args struct {
+		File     string `positional-arg-name:"file" required:"true"`
+		Revision string `positional-arg-name:"revision"`
+	} `positional-args:"yes"`
+}
+
+func (CmdBlame) Usage() string {
+	return fmt.Sprintf("usage: %s blame <file> [<revision>]", os.Args[0])
+}
+
+func (c *CmdBlame) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	p, err := worktreePath(w, c.Args.File)
+	if err != nil {
+		return err
+	}
+
+	rev := c.Args.Revision
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	commit, err := resolveCommit(r, rev)
+	if err != nil {
+		return err
+	}
+
+	res, err := git.Blame(commit, p)
+	if err != nil {
+		return err
+	}
+
+	var width int
+	for _, l := range res.Lines {
+		if len(l.Author) > width {
+			width = len(l.Author)
+		}
+	}
+
+	for i, l := range res.Lines {
+		fmt.Fprintf(stdout, "%s (%-*s %s %*d) %s\n",
+			l.Hash.String()[:8], width, l.Author,
+			l.Date.Format("2006-01-02 15:04:05 -0700"),
+			len(fmt.Sprint(len(res.Lines))), i+1, l.Text,
+		)
+	}
+
+	return nil
+}
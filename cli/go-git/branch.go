@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CmdBranch struct {
+	cmd
+
+	Delete bool `short:"d" long:"delete" description:"Delete the given branch"`
+
+	Args struct {
+		Name       string `positional-arg-name:"branch"`
+		StartPoint string `positional-arg-name:"start-point"`
+	} `positional-args:"yes"`
+}
+
+func (CmdBranch) Usage() string {
+	return fmt.Sprintf("usage: %s branch [--delete] [<branch> [<start-point>]]", os.Args[0])
+}
+
+func (c *CmdBranch) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	current, err := currentBranch(r)
+	if err != nil {
+		return err
+	}
+
+	if c.Args.Name == "" {
+		if c.Delete {
+			return fmt.Errorf("branch name required")
+		}
+
+		branches, err := r.Branches()
+		if err != nil {
+			return err
+		}
+
+		return branches.ForEach(func(ref *plumbing.Reference) error {
+			prefix := " "
+			if ref.Name().Short() == current {
+				prefix = "*"
+			}
+
+			fmt.Fprintf(stdout, "%s %s\n", prefix, ref.Name().Short())
+			return nil
+		})
+	}
+
+	name := plumbing.NewBranchReferenceName(c.Args.Name)
+	if c.Delete {
+		if c.Args.Name == current {
+			return fmt.Errorf("cannot delete branch '%s' checked out", c.Args.Name)
+		}
+
+		if _, err := r.Reference(name, false); err != nil {
+			return fmt.Errorf("branch '%s' not found", c.Args.Name)
+		}
+
+		return r.Storer.RemoveReference(name)
+	}
+
+	if _, err := r.Reference(name, false); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", c.Args.Name)
+	}
+
+	start := c.Args.StartPoint
+	if start == "" {
+		start = "HEAD"
+	}
+
+	commit, err := resolveCommit(r, start)
+	if err != nil {
+		return err
+	}
+
+	return r.Storer.SetReference(plumbing.NewHashReference(name, commit.Hash))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CmdCheckout struct {
+	cmd
+
+	Branch string `short:"b" value-name:"new-branch" description:"Create a new branch starting at the given commit and switch to it"`
+	Force  bool   `short:"f" long:"force" description:"Throw away the local changes"`
+
+	Args struct {
+		Target string `positional-arg-name:"branch|commit"`
+	} `positional-args:"yes"`
+}
+
+func (CmdCheckout) Usage() string {
+	return fmt.Sprintf("usage: %s checkout [--force] [-b <new-branch>] [<branch>|<commit>]", os.Args[0])
+}
+
+func (c *CmdCheckout) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	o := &git.CheckoutOptions{Force: c.Force}
+	switch {
+	case c.Branch != "":
+		o.Create = true
+		o.Branch = plumbing.NewBranchReferenceName(c.Branch)
+		if c.Args.Target != "" {
+			commit, err := resolveCommit(r, c.Args.Target)
+			if err != nil {
+				return err
+			}
+
+			o.Hash = commit.Hash
+		}
+	case c.Args.Target == "":
+		return fmt.Errorf("a branch or a commit is required")
+	default:
+		name := plumbing.NewBranchReferenceName(c.Args.Target)
+		if _, err := r.Reference(name, false); err == nil {
+			o.Branch = name
+			break
+		}
+
+		commit, err := resolveCommit(r, c.Args.Target)
+		if err != nil {
+			return err
+		}
+
+		o.Hash = commit.Hash
+	}
+
+	if err := w.Checkout(o); err != nil {
+		return err
+	}
+
+	if o.Branch != "" {
+		fmt.Fprintf(stderr, "Switched to branch '%s'\n", o.Branch.Short())
+	} else {
+		fmt.Fprintf(stderr, "HEAD is now at %s\n", shortHash(o.Hash))
+	}
+
+	return nil
+}
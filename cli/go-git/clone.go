@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CmdClone struct {
+	cmd
+
+	Bare         bool   `long:"bare" description:"Make a bare repository"`
+	Branch       string `short:"b" long:"branch" value-name:"name" description:"Checkout the given branch instead of the remote HEAD"`
+	Depth        int    `long:"depth" value-name:"n" description:"Create a shallow clone with a history truncated to the given number of commits"`
+	SingleBranch bool   `long:"single-branch" description:"Clone only the history leading to the tip of a single branch"`
+	NoCheckout   bool   `short:"n" long:"no-checkout" description:"No checkout of HEAD is performed after the clone is complete"`
+	Origin       string `short:"o" long:"origin" value-name:"name" description:"Use the given name instead of origin to track the upstream repository"`
+	Quiet        bool   `short:"q" long:"quiet" description:"Do not report progress"`
+
+	Args struct {
+		Repository string `positional-arg-name:"repository" required:"true"`
+		Directory  string `positional-arg-name:"directory"`
+	} `positional-args:"yes"`
+}
+
+func (CmdClone) Usage() string {
+	return fmt.Sprintf("usage: %s clone [--bare] [--branch=<name>] [--depth=<n>] "+
+		"[--single-branch] [--no-checkout] [--origin=<name>] [--quiet] "+
+		"<repository> [<directory>]", os.Args[0])
+}
+
+func (c *CmdClone) Execute(args []string) error {
+	url := c.Args.Repository
+	if _, err := os.Stat(workingPath(url)); err == nil {
+		abs, err := filepath.Abs(workingPath(url))
+		if err != nil {
+			return err
+		}
+
+		url = abs
+	}
+
+	dir := c.Args.Directory
+	if dir == "" {
+		dir = humanishName(c.Args.Repository, c.Bare)
+	}
+
+	o := &git.CloneOptions{
+		URL:              url,
+		RemoteName:       c.Origin,
+		SingleBranch:     c.SingleBranch,
+		NoCheckout:       c.NoCheckout,
+		Depth:            c.Depth,
+		Progress:         progress(c.Quiet),
+		LoadGlobalConfig: true,
+	}
+
+	if c.Branch != "" {
+		o.ReferenceName = plumbing.NewBranchReferenceName(c.Branch)
+	}
+
+	if !c.Quiet {
+		fmt.Fprintf(stderr, "Cloning into '%s'...\n", dir)
+	}
+
+	_, err := git.PlainClone(workingPath(dir), c.Bare, o)
+	return err
+}
+
+// humanishName returns the directory name of a clone of the given repository,
+// as git does: the last component of the path without the .git suffix.
+func humanishName(repository string, bare bool) string {
+	name := strings.TrimRight(repository, "/")
+	name = strings.TrimSuffix(name, "/.git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.TrimSuffix(name, ".git")
+	if bare {
+		name += ".git"
+	}
+
+	return name
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+type CmdCommit struct {
+	cmd
+
+	Message string `short:"m" long:"message" value-name:"msg" required:"true" description:"Use the given message as the commit message"`
+	All     bool   `short:"a" long:"all" description:"Stage the modified and deleted files before committing"`
+	Author  string `long:"author" value-name:"author" description:"Override the commit author, in the \"Name <email>\" form"`
+}
+
+func (CmdCommit) Usage() string {
+	return fmt.Sprintf("usage: %s commit [--all] [--author=<author>] --message=<msg>", os.Args[0])
+}
+
+func (c *CmdCommit) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	committer, err := signature(r, "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL")
+	if err != nil {
+		return err
+	}
+
+	o := &git.CommitOptions{All: c.All, Committer: committer}
+	if c.Author != "" {
+		o.Author, err = parseIdentity(c.Author)
+	} else {
+		o.Author, err = signature(r, "GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	msg := c.Message
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	h, err := w.Commit(msg, o)
+	if err != nil {
+		return err
+	}
+
+	branch, err := currentBranch(r)
+	if err != nil {
+		return err
+	}
+
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+
+	subject := strings.SplitN(c.Message, "\n", 2)[0]
+	fmt.Fprintf(stdout, "[%s %s] %s\n", branch, shortHash(h), subject)
+	return nil
+}
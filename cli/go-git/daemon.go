@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/git"
+	gitdaemon "gopkg.in/src-d/go-git.v4/plumbing/transport/git/server"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+type CmdDaemon struct {
+	cmd
+
+	BasePath       string   `long:"base-path" description:"Remap all the path requests as relative to the given path"`
+	ExportAll      bool     `long:"export-all" description:"Allow pulling from all repositories, without a git-daemon-export-ok file"`
+	Enable         []string `long:"enable" value-name:"service" description:"Enable the given service, only receive-pack is supported"`
+	Listen         string   `long:"listen" value-name:"host" description:"Listen on the given address"`
+	Port           int      `long:"port" value-name:"n" description:"Listen on the given port"`
+	Timeout        int      `long:"timeout" value-name:"n" description:"Timeout in seconds for every read or write of a request"`
+	InitTimeout    int      `long:"init-timeout" value-name:"n" description:"Timeout in seconds between the connection and the request of the client"`
+	MaxConnections int      `long:"max-connections" value-name:"n" default:"32" description:"Maximum number of concurrent clients, zero for no limit"`
+
+	Args struct {
+		Directories []string `positional-arg-name:"directory" description:"Only serve the repositories below the given paths, as requested by the clients"`
+	} `positional-args:"yes"`
+}
+
+func (CmdDaemon) Usage() string {
+	return fmt.Sprintf("usage: %s daemon [--base-path=<path>] [--export-all] "+
+		"[--enable=receive-pack] [--listen=<host>] [--port=<n>] [--timeout=<n>] "+
+		"[--init-timeout=<n>] [--max-connections=<n>] [<directory>...]", os.Args[0])
+}
+
+func (c *CmdDaemon) Execute(args []string) error {
+	d := gitdaemon.NewServer(server.NewFilesystemLoader(osfs.New(c.BasePath)))
+	d.Whitelist = c.Args.Directories
+	d.ExportAll = c.ExportAll
+	d.MaxConnections = c.MaxConnections
+	d.Timeout = time.Duration(c.Timeout) * time.Second
+	d.InitTimeout = time.Duration(c.InitTimeout) * time.Second
+	d.ErrorLog = log.New(os.Stderr, "", log.LstdFlags)
+
+	for _, s := range c.Enable {
+		if s != "receive-pack" {
+			return fmt.Errorf("unsupported service: %s", s)
+		}
+
+		d.ReceivePack = true
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = git.DefaultPort
+	}
+
+	return d.ListenAndServe(net.JoinHostPort(c.Listen, strconv.Itoa(port)))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type CmdDiff struct {
+	cmd
+
+	Args struct {
+		From string `positional-arg-name:"commit" required:"true"`
+		To   string `positional-arg-name:"commit"`
+	} `positional-args:"yes"`
+}
+
+func (CmdDiff) Usage() string {
+	return fmt.Sprintf("usage: %s diff <commit> <commit> | <commit>..<commit> | <commit>", os.Args[0])
+}
+
+// Execute shows the changes between two commits, given as two arguments or
+// in the <from>..<to> form. A single commit is compared with its first
+// parent.
+func (c *CmdDiff) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	from, to := c.Args.From, c.Args.To
+	if i := strings.Index(from, ".."); to == "" && i >= 0 {
+		from, to = from[:i], from[i+2:]
+		if from == "" {
+			from = "HEAD"
+		}
+
+		if to == "" {
+			to = "HEAD"
+		}
+	}
+
+	if to == "" {
+		to, from = from, from+"^"
+	}
+
+	fromCommit, err := resolveCommit(r, from)
+	if err != nil {
+		return err
+	}
+
+	toCommit, err := resolveCommit(r, to)
+	if err != nil {
+		return err
+	}
+
+	patch, err := fromCommit.Patch(toCommit)
+	if err != nil {
+		return err
+	}
+
+	return patch.Encode(stdout)
+}
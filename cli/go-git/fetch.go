@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CmdFetch struct {
+	cmd
+
+	Depth     int  `long:"depth" value-name:"n" description:"Limit fetching to the given number of commits from the tip of each remote branch"`
+	Force     bool `short:"f" long:"force" description:"Allow non-fast-forward updates of the local references"`
+	Tags      bool `short:"t" long:"tags" description:"Fetch all the tags of the remote"`
+	NoTags    bool `long:"no-tags" description:"Do not fetch any tag"`
+	Prune     bool `short:"p" long:"prune" description:"Remove the remote-tracking references that no longer exist on the remote"`
+	NoPrune   bool `long:"no-prune" description:"Do not prune, overriding the prune configuration"`
+	PruneTags bool `short:"P" long:"prune-tags" description:"Remove the local tags that no longer exist on the remote, when pruning"`
+	Quiet     bool `short:"q" long:"quiet" description:"Do not report progress"`
+
+	Args struct {
+		Remote   string   `positional-arg-name:"remote"`
+		RefSpecs []string `positional-arg-name:"refspec"`
+	} `positional-args:"yes"`
+}
+
+func (CmdFetch) Usage() string {
+	return fmt.Sprintf("usage: %s fetch [--depth=<n>] [--force] [--tags | --no-tags] "+
+		"[--prune [--prune-tags] | --no-prune] [--quiet] [<remote> [<refspec>...]]", os.Args[0])
+}
+
+func (c *CmdFetch) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	o := &git.FetchOptions{
+		RemoteName: c.Args.Remote,
+		Depth:      c.Depth,
+		Force:      c.Force,
+		Progress:   progress(c.Quiet),
+	}
+
+	switch {
+	case c.Prune && c.NoPrune:
+		return fmt.Errorf("--prune and --no-prune are mutually exclusive")
+	case c.Prune:
+		o.Prune = config.OptBoolTrue
+	case c.NoPrune:
+		o.Prune = config.OptBoolFalse
+	}
+
+	if c.PruneTags {
+		o.PruneTags = config.OptBoolTrue
+	}
+
+	switch {
+	case c.Tags && c.NoTags:
+		return fmt.Errorf("--tags and --no-tags are mutually exclusive")
+	case c.Tags:
+		o.Tags = git.AllTags
+	case c.NoTags:
+		o.Tags = git.NoTags
+	}
+
+	remote := c.Args.Remote
+	if remote == "" {
+		remote = git.DefaultRemoteName
+	}
+
+	for _, rs := range c.Args.RefSpecs {
+		o.RefSpecs = append(o.RefSpecs, fetchRefSpec(remote, rs))
+	}
+
+	res, err := r.FetchWithResult(context.Background(), o)
+	if res != nil {
+		for _, name := range res.Pruned {
+			fmt.Fprintf(stdout, "-\t%s\t[deleted]\n", name)
+		}
+	}
+
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+
+	return err
+}
+
+// fetchRefSpec expands a refspec of the command line: a branch without
+// destination is fetched to its remote-tracking reference, a tag to the same
+// tag, and the names not starting with refs/ are branches.
+func fetchRefSpec(remote, rs string) config.RefSpec {
+	var force string
+	if strings.HasPrefix(rs, "+") {
+		force, rs = "+", rs[1:]
+	}
+
+	src, dst := rs, ""
+	if i := strings.Index(rs, ":"); i != -1 {
+		src, dst = rs[:i], rs[i+1:]
+	}
+
+	if !strings.HasPrefix(src, "refs/") {
+		src = plumbing.NewBranchReferenceName(src).String()
+	}
+
+	switch {
+	case dst == "" && strings.HasPrefix(src, "refs/heads/"):
+		dst = plumbing.NewRemoteReferenceName(remote, strings.TrimPrefix(src, "refs/heads/")).String()
+	case dst == "":
+		dst = src
+	case !strings.HasPrefix(dst, "refs/"):
+		dst = plumbing.NewBranchReferenceName(dst).String()
+	}
+
+	return config.RefSpec(force + src + ":" + dst)
+}
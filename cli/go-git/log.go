@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+type CmdLog struct {
+	cmd
+
+	MaxCount int  `short:"n" long:"max-count" value-name:"n" description:"Limit the number of commits to output"`
+	Oneline  bool `long:"oneline" description:"Show every commit in a single line"`
+
+	Args struct {
+		Revision string `positional-arg-name:"revision"`
+		Path     string `positional-arg-name:"path"`
+	} `positional-args:"yes"`
+}
+
+func (CmdLog) Usage() string {
+	return fmt.Sprintf("usage: %s log [--max-count=<n>] [--oneline] [<revision> [<path>]]", os.Args[0])
+}
+
+func (c *CmdLog) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	rev := c.Args.Revision
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	from, err := resolveCommit(r, rev)
+	if err != nil {
+		return err
+	}
+
+	o := &git.LogOptions{From: from.Hash}
+	if c.Args.Path != "" {
+		o.FileName = &c.Args.Path
+	}
+
+	iter, err := r.Log(o)
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+
+	var n int
+	return iter.ForEach(func(commit *object.Commit) error {
+		if c.MaxCount > 0 && n == c.MaxCount {
+			return storer.ErrStop
+		}
+
+		if c.Oneline {
+			subject := strings.SplitN(commit.Message, "\n", 2)[0]
+			fmt.Fprintf(stdout, "%s %s\n", shortHash(commit.Hash), subject)
+		} else {
+			if n > 0 {
+				fmt.Fprintln(stdout)
+			}
+
+			printCommit(commit)
+		}
+
+		n++
+		return nil
+	})
+}
+
+// printCommit prints the given commit in the medium format of git log.
+func printCommit(c *object.Commit) {
+	fmt.Fprintf(stdout, "commit %s\nAuthor: %s <%s>\nDate:   %s\n\n",
+		c.Hash, c.Author.Name, c.Author.Email, c.Author.When.Format(object.DateFormat),
+	)
+
+	for _, line := range strings.Split(strings.TrimRight(c.Message, "\n"), "\n") {
+		if line != "" {
+			line = "    " + line
+		}
+
+		fmt.Fprintln(stdout, line)
+	}
+}
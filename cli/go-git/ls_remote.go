@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type CmdLsRemote struct {
+	cmd
+
+	Heads bool `long:"heads" description:"Limit to the branches"`
+	Tags  bool `short:"t" long:"tags" description:"Limit to the tags"`
+
+	Args struct {
+		Repository string `positional-arg-name:"repository"`
+	} `positional-args:"yes"`
+}
+
+func (CmdLsRemote) Usage() string {
+	return fmt.Sprintf("usage: %s ls-remote [--heads] [--tags] [<repository>]", os.Args[0])
+}
+
+func (c *CmdLsRemote) Execute(args []string) error {
+	remote, err := c.remote()
+	if err != nil {
+		return err
+	}
+
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name()] = ref.Hash()
+		}
+	}
+
+	// as git does, HEAD goes first, followed by the rest of the references
+	// sorted by name.
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Name() == plumbing.HEAD || refs[j].Name() == plumbing.HEAD {
+			return refs[i].Name() == plumbing.HEAD
+		}
+
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	for _, ref := range refs {
+		name := ref.Name()
+		if (c.Heads || c.Tags) && !(c.Heads && name.IsBranch() || c.Tags && name.IsTag()) {
+			continue
+		}
+
+		h, ok := hashes[name]
+		if ref.Type() == plumbing.SymbolicReference {
+			h, ok = hashes[ref.Target()]
+		}
+
+		if ok {
+			fmt.Fprintf(stdout, "%s\t%s\n", h, name)
+		}
+	}
+
+	return nil
+}
+
+// remote returns the remote of the repository with the given name, or an
+// anonymous remote if it is an URL or a path. The remote is origin by default.
+func (c *CmdLsRemote) remote() (*git.Remote, error) {
+	name := c.Args.Repository
+	if name == "" {
+		name = git.DefaultRemoteName
+	}
+
+	if r, err := openRepository(); err == nil {
+		remote, err := r.Remote(name)
+		if err != git.ErrRemoteNotFound {
+			return remote, err
+		}
+	}
+
+	url := name
+	if _, err := os.Stat(workingPath(url)); err == nil {
+		url = workingPath(url)
+	}
+
+	r, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.LoadGlobalConfig(); err != nil {
+		return nil, err
+	}
+
+	return r.CreateRemote(&config.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{url},
+	})
+}
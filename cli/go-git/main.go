@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 
@@ -8,9 +9,14 @@ import (
 )
 
 const (
-	bin            = "go-git"
-	receivePackBin = "git-receive-pack"
-	uploadPackBin  = "git-upload-pack"
+	bin              = "go-git"
+	receivePackBin   = "git-receive-pack"
+	uploadPackBin    = "git-upload-pack"
+	uploadArchiveBin = "git-upload-archive"
+
+	// exitCodeUsage is the exit status of git-upload-pack and
+	// git-receive-pack when the arguments are invalid.
+	exitCodeUsage = 129
 )
 
 func main() {
@@ -19,23 +25,71 @@ func main() {
 		os.Args = append([]string{"git", "receive-pack"}, os.Args[1:]...)
 	case uploadPackBin:
 		os.Args = append([]string{"git", "upload-pack"}, os.Args[1:]...)
+	case uploadArchiveBin:
+		os.Args = append([]string{"git", "upload-archive"}, os.Args[1:]...)
 	}
 
-	parser := flags.NewNamedParser(bin, flags.Default)
-	parser.AddCommand("receive-pack", "", "", &CmdReceivePack{})
-	parser.AddCommand("upload-pack", "", "", &CmdUploadPack{})
-	parser.AddCommand("version", "Show the version information.", "", &CmdVersion{})
-
+	parser := newParser()
 	_, err := parser.Parse()
 	if err != nil {
-		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrCommandRequired {
+		e, ok := err.(*flags.Error)
+		if ok && e.Type == flags.ErrCommandRequired {
 			parser.WriteHelp(os.Stdout)
 		}
 
+		if ok && e.Type != flags.ErrHelp && isPackCommand(parser.Active) {
+			os.Exit(exitCodeUsage)
+		}
+
 		os.Exit(1)
 	}
 }
 
+func isPackCommand(c *flags.Command) bool {
+	return c != nil && (c.Name == "upload-pack" || c.Name == "receive-pack")
+}
+
+// stdout and stderr are the outputs of the commands, replaced by the tests.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// globalOptions are the options shared by all the commands.
+type globalOptions struct {
+	Directory string `short:"C" value-name:"path" description:"Run as if started in the given path"`
+}
+
+var options globalOptions
+
+func newParser() *flags.Parser {
+	options = globalOptions{}
+
+	parser := flags.NewNamedParser(bin, flags.Default)
+	parser.AddGroup("Global Options", "", &options)
+	parser.AddCommand("add", "Add file contents to the index.", "", &CmdAdd{})
+	parser.AddCommand("blame", "Show what revision and author last modified each line of a file.", "", &CmdBlame{})
+	parser.AddCommand("branch", "List, create, or delete branches.", "", &CmdBranch{})
+	parser.AddCommand("checkout", "Switch branches or restore the worktree to a commit.", "", &CmdCheckout{})
+	parser.AddCommand("clone", "Clone a repository into a new directory.", "", &CmdClone{})
+	parser.AddCommand("commit", "Record changes to the repository.", "", &CmdCommit{})
+	parser.AddCommand("daemon", "Serve repositories through the git protocol.", "", &CmdDaemon{})
+	parser.AddCommand("diff", "Show changes between commits.", "", &CmdDiff{})
+	parser.AddCommand("fetch", "Download objects and refs from another repository.", "", &CmdFetch{})
+	parser.AddCommand("log", "Show commit logs.", "", &CmdLog{})
+	parser.AddCommand("ls-remote", "List references in a remote repository.", "", &CmdLsRemote{})
+	parser.AddCommand("push", "Update remote refs along with associated objects.", "", &CmdPush{})
+	parser.AddCommand("receive-pack", "", "", &CmdReceivePack{})
+	parser.AddCommand("rev-parse", "Resolve revisions to object names.", "", &CmdRevParse{})
+	parser.AddCommand("status", "Show the working tree status.", "", &CmdStatus{})
+	parser.AddCommand("tag", "List, create, or delete tags.", "", &CmdTag{})
+	parser.AddCommand("upload-archive", "", "", &CmdUploadArchive{})
+	parser.AddCommand("upload-pack", "", "", &CmdUploadPack{})
+	parser.AddCommand("version", "Show the version information.", "", &CmdVersion{})
+
+	return parser
+}
+
 type cmd struct {
 	Verbose bool `short:"v" description:"Activates the verbose mode"`
 }
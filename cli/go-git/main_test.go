@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/file"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+
+	"github.com/jessevdk/go-flags"
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CommandSuite struct {
+	fixtures.Suite
+
+	url string
+	dir string
+}
+
+var _ = Suite(&CommandSuite{})
+
+func (s *CommandSuite) SetUpSuite(c *C) {
+	s.Suite.SetUpSuite(c)
+
+	// the file transport runs the git binary, the commands are tested
+	// against the server of go-git instead.
+	client.InstallProtocol("file", server.DefaultServer)
+}
+
+func (s *CommandSuite) TearDownSuite(c *C) {
+	client.InstallProtocol("file", file.DefaultClient)
+	s.Suite.TearDownSuite(c)
+}
+
+func (s *CommandSuite) SetUpTest(c *C) {
+	s.url = fixtures.Basic().One().DotGit().Root()
+	s.dir = filepath.Join(c.MkDir(), "basic")
+
+	stderr = ioutil.Discard
+	s.run(c, "clone", "--quiet", s.url, s.dir)
+
+	r, err := git.PlainOpen(s.dir)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+
+	cfg.Raw.Section("user").SetOption("name", "Foo").SetOption("email", "foo@example.com")
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+}
+
+// run runs the given command in the cloned repository, returning its output.
+func (s *CommandSuite) run(c *C, args ...string) string {
+	out, err := s.exec(args...)
+	c.Assert(err, IsNil, Commentf("%s", args))
+	return out
+}
+
+func (s *CommandSuite) exec(args ...string) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	stdout = buf
+
+	p := newParser()
+	p.Options &^= flags.PrintErrors
+	_, err := p.ParseArgs(append([]string{"-C", s.dir}, args...))
+	return buf.String(), err
+}
+
+func (s *CommandSuite) writeFile(c *C, name, content string) {
+	err := ioutil.WriteFile(filepath.Join(s.dir, name), []byte(content), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *CommandSuite) TestClone(c *C) {
+	c.Assert(s.run(c, "rev-parse", "HEAD"), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n")
+	c.Assert(s.run(c, "rev-parse", "--abbrev-ref", "HEAD"), Equals, "master\n")
+	c.Assert(s.run(c, "status"), Equals, "On branch master\nnothing to commit, working tree clean\n")
+}
+
+func (s *CommandSuite) TestCloneDefaultDirectory(c *C) {
+	c.Assert(humanishName("https://github.com/src-d/go-git.git", false), Equals, "go-git")
+	c.Assert(humanishName("git@github.com:src-d/go-git", false), Equals, "go-git")
+	c.Assert(humanishName("/srv/repos/foo/.git/", false), Equals, "foo")
+	c.Assert(humanishName("/srv/repos/foo", true), Equals, "foo.git")
+}
+
+func (s *CommandSuite) TestLog(c *C) {
+	out := s.run(c, "log", "--oneline", "-n", "2")
+	c.Assert(out, Equals, "6ecf0ef vendor stuff\n918c48b some code\n")
+
+	out = s.run(c, "log", "-n", "1")
+	c.Assert(strings.HasPrefix(out, "commit 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"), Equals, true)
+	c.Assert(strings.HasSuffix(out, "\n    vendor stuff\n"), Equals, true)
+
+	out = s.run(c, "log", "--oneline", "HEAD", "vendor/foo.go")
+	c.Assert(out, Equals, "6ecf0ef vendor stuff\n")
+}
+
+func (s *CommandSuite) TestAddCommit(c *C) {
+	s.writeFile(c, "foo", "foo\n")
+	s.writeFile(c, "LICENSE", "bar\n")
+	c.Assert(s.run(c, "status", "--short"), Equals, " M LICENSE\n?? foo\n")
+
+	s.run(c, "add", "foo")
+	c.Assert(s.run(c, "status", "--short"), Equals, " M LICENSE\nA  foo\n")
+	c.Assert(s.run(c, "status"), Equals, "On branch master\n"+
+		"Changes to be committed:\n\tnew file:   foo\n\n"+
+		"Changes not staged for commit:\n\tmodified:   LICENSE\n\n")
+
+	out := s.run(c, "commit", "-a", "-m", "foo")
+	c.Assert(out, Matches, `\[master [0-9a-f]{7}\] foo\n`)
+	c.Assert(s.run(c, "status", "--short"), Equals, "")
+
+	out = s.run(c, "log", "-n", "1")
+	c.Assert(strings.Contains(out, "Author: Foo <foo@example.com>\n"), Equals, true)
+
+	s.writeFile(c, "bar", "bar\n")
+	s.run(c, "add", "*")
+	s.run(c, "commit", "--author", "Bar <bar@example.com>", "-m", "bar")
+
+	out = s.run(c, "log", "-n", "1")
+	c.Assert(strings.Contains(out, "Author: Bar <bar@example.com>\n"), Equals, true)
+	c.Assert(s.run(c, "status", "--short"), Equals, "")
+}
+
+func (s *CommandSuite) TestBranchCheckout(c *C) {
+	s.run(c, "branch", "foo", "HEAD~1")
+	c.Assert(s.run(c, "branch"), Equals, "  foo\n* master\n")
+
+	s.run(c, "checkout", "foo")
+	c.Assert(s.run(c, "rev-parse", "--abbrev-ref", "HEAD"), Equals, "foo\n")
+	c.Assert(s.run(c, "rev-parse", "HEAD"), Equals, "918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+
+	_, err := s.exec("branch", "-d", "foo")
+	c.Assert(err, NotNil)
+
+	s.run(c, "checkout", "-b", "bar", "master")
+	c.Assert(s.run(c, "branch"), Equals, "* bar\n  foo\n  master\n")
+
+	s.run(c, "branch", "-d", "foo")
+	c.Assert(s.run(c, "branch"), Equals, "* bar\n  master\n")
+
+	s.run(c, "checkout", "HEAD~1")
+	c.Assert(s.run(c, "rev-parse", "--abbrev-ref", "HEAD"), Equals, "HEAD\n")
+	c.Assert(s.run(c, "status"), Equals, "HEAD detached\nnothing to commit, working tree clean\n")
+}
+
+func (s *CommandSuite) TestTag(c *C) {
+	s.run(c, "tag", "foo", "HEAD~1")
+	s.run(c, "tag", "-m", "second release", "bar")
+	c.Assert(s.run(c, "tag"), Equals, "bar\nfoo\nv1.0.0\n")
+
+	c.Assert(s.run(c, "rev-parse", "foo"), Equals, "918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+
+	r, err := git.PlainOpen(s.dir)
+	c.Assert(err, IsNil)
+
+	ref, err := r.Tag("bar")
+	c.Assert(err, IsNil)
+
+	tag, err := r.TagObject(ref.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(tag.Message, Equals, "second release\n")
+	c.Assert(tag.Tagger.Email, Equals, "foo@example.com")
+
+	s.run(c, "tag", "-d", "foo")
+	c.Assert(s.run(c, "tag"), Equals, "bar\nv1.0.0\n")
+}
+
+func (s *CommandSuite) TestDiff(c *C) {
+	out := s.run(c, "diff", "HEAD")
+	c.Assert(strings.HasPrefix(out, "diff --git a/vendor/foo.go b/vendor/foo.go\n"), Equals, true)
+
+	c.Assert(s.run(c, "diff", "HEAD~1", "HEAD"), Equals, out)
+	c.Assert(s.run(c, "diff", "HEAD~1..HEAD"), Equals, out)
+	c.Assert(s.run(c, "diff", "HEAD", "HEAD"), Equals, "")
+}
+
+func (s *CommandSuite) TestBlame(c *C) {
+	out := s.run(c, "blame", "CHANGELOG")
+	c.Assert(out, Equals, "b8e471f5 (daniel@lordran.local 2015-03-31 13:44:52 +0200 1) Initial changelog\n")
+}
+
+func (s *CommandSuite) TestPushFetch(c *C) {
+	remote := filepath.Join(c.MkDir(), "remote.git")
+	_, err := git.PlainInit(remote, true)
+	c.Assert(err, IsNil)
+
+	r, err := git.PlainOpen(s.dir)
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name:  "other",
+		URLs:  []string{remote},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/other/*"},
+	})
+	c.Assert(err, IsNil)
+
+	out := s.run(c, "push", "other")
+	c.Assert(out, Equals, "*\trefs/heads/master\t[new reference]\n")
+	c.Assert(s.run(c, "push", "other"), Equals, "=\trefs/heads/master\t[up to date]\n"+
+		"Everything up-to-date\n")
+
+	out = s.run(c, "ls-remote", remote)
+	c.Assert(out, Equals, ""+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5\tHEAD\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5\trefs/heads/master\n")
+
+	s.run(c, "branch", "foo", "HEAD~1")
+	s.run(c, "branch", "bar", "HEAD~2")
+	s.run(c, "push", "other", "refs/heads/foo:refs/heads/foo")
+	s.run(c, "fetch", "-q", "other")
+
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName("other", "foo"), false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "918c48b83bd081e863dbe1b80f8998f058cd8294")
+
+	out, err = s.exec("push", "other", "refs/heads/bar:refs/heads/master")
+	c.Assert(err, NotNil)
+	c.Assert(out, Equals, "!\trefs/heads/master\t[rejected] (non-fast-forward)\n")
+
+	out = s.run(c, "push", "--force", "other", "refs/heads/bar:refs/heads/master")
+	c.Assert(out, Equals, " \trefs/heads/master\t6ecf0ef..af2d6a6\n")
+
+	err = r.Storer.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/remotes/other/stale", "af2d6a6954d532f8ffb47615169c8fdf9d383a1a"))
+	c.Assert(err, IsNil)
+
+	out = s.run(c, "fetch", "-q", "--prune", "other")
+	c.Assert(out, Equals, "-\trefs/remotes/other/stale\t[deleted]\n")
+}
+
+func (s *CommandSuite) TestPushFetchShortRefSpecs(c *C) {
+	remote := filepath.Join(c.MkDir(), "remote.git")
+	_, err := git.PlainInit(remote, true)
+	c.Assert(err, IsNil)
+
+	r, err := git.PlainOpen(s.dir)
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "other", URLs: []string{remote}})
+	c.Assert(err, IsNil)
+
+	out := s.run(c, "push", "other", "master")
+	c.Assert(out, Equals, "*\trefs/heads/master\t[new reference]\n")
+
+	s.run(c, "branch", "foo", "HEAD~1")
+	out = s.run(c, "push", "other", "foo:bar", "v1.0.0")
+	c.Assert(out, Equals, ""+
+		"*\trefs/heads/bar\t[new reference]\n"+
+		"*\trefs/tags/v1.0.0\t[new reference]\n")
+
+	out = s.run(c, "push", "--force", "other", ":bar")
+	c.Assert(out, Equals, "-\trefs/heads/bar\t[deleted]\n")
+
+	_, err = s.exec("push", "other", "missing")
+	c.Assert(err, ErrorMatches, "src refspec missing does not match any")
+
+	s.run(c, "fetch", "-q", "other", "master")
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName("other", "master"), false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = r.Reference(plumbing.NewRemoteReferenceName("other", "bar"), false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *CommandSuite) TestLsRemote(c *C) {
+	out := s.run(c, "ls-remote", "--heads")
+	c.Assert(out, Equals, ""+
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881\trefs/heads/branch\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5\trefs/heads/master\n")
+
+	out = s.run(c, "ls-remote")
+	c.Assert(strings.HasPrefix(out, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5\tHEAD\n"), Equals, true)
+}
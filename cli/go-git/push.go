@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var errPushFailed = errors.New("failed to push some refs")
+
+type CmdPush struct {
+	cmd
+
+	Force       bool     `short:"f" long:"force" description:"Allow non-fast-forward updates of the remote references"`
+	Atomic      bool     `long:"atomic" description:"Update all the remote references or none of them"`
+	PushOptions []string `short:"o" long:"push-option" value-name:"option" description:"Transmit the given option to the server"`
+	Quiet       bool     `short:"q" long:"quiet" description:"Do not report progress"`
+
+	Args struct {
+		Remote   string   `positional-arg-name:"remote"`
+		RefSpecs []string `positional-arg-name:"refspec"`
+	} `positional-args:"yes"`
+}
+
+func (CmdPush) Usage() string {
+	return fmt.Sprintf("usage: %s push [--force] [--atomic] [--push-option=<option>] "+
+		"[--quiet] [<remote> [<refspec>...]]", os.Args[0])
+}
+
+func (c *CmdPush) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	refspecs := c.Args.RefSpecs
+	if len(refspecs) == 0 {
+		// as git does by default, only the current branch is pushed.
+		refspecs = []string{plumbing.HEAD.String()}
+	}
+
+	o := &git.PushOptions{
+		RemoteName: c.Args.Remote,
+		Atomic:     c.Atomic,
+		Options:    c.PushOptions,
+		Progress:   progress(c.Quiet),
+	}
+
+	for _, rs := range refspecs {
+		spec, err := pushRefSpec(r, rs, c.Force)
+		if err != nil {
+			return err
+		}
+
+		o.RefSpecs = append(o.RefSpecs, spec)
+	}
+
+	res, err := r.PushWithResult(context.Background(), o)
+	if res == nil {
+		return err
+	}
+
+	for _, ref := range res.Refs {
+		printPushRefResult(ref)
+	}
+
+	if err == git.NoErrAlreadyUpToDate {
+		fmt.Fprintln(stdout, "Everything up-to-date")
+		return nil
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return errPushFailed
+	}
+
+	return nil
+}
+
+// pushRefSpec expands a refspec of the command line, as git push does: a
+// <src> without destination pushes to the same reference, and the names not
+// starting with refs/ are the local branches or tags, HEAD being the current
+// branch. Force adds a + to the refspecs not deleting a reference.
+func pushRefSpec(r *git.Repository, rs string, force bool) (config.RefSpec, error) {
+	force = force || strings.HasPrefix(rs, "+")
+	rs = strings.TrimPrefix(rs, "+")
+
+	src, dst := rs, ""
+	if i := strings.Index(rs, ":"); i != -1 {
+		src, dst = rs[:i], rs[i+1:]
+	}
+
+	if src == "" {
+		if !strings.HasPrefix(dst, "refs/") {
+			dst = plumbing.NewBranchReferenceName(dst).String()
+		}
+
+		return config.RefSpec(":" + dst), nil
+	}
+
+	src, err := localRefName(r, src)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case dst == "":
+		dst = src
+	case !strings.HasPrefix(dst, "refs/"):
+		prefix := "refs/heads/"
+		if strings.HasPrefix(src, "refs/tags/") {
+			prefix = "refs/tags/"
+		}
+
+		dst = prefix + dst
+	}
+
+	spec := src + ":" + dst
+	if force {
+		spec = "+" + spec
+	}
+
+	return config.RefSpec(spec), nil
+}
+
+// localRefName returns the full name of a local reference, HEAD being the
+// current branch, and the names not starting with refs/ the branches or tags.
+func localRefName(r *git.Repository, name string) (string, error) {
+	if name == plumbing.HEAD.String() {
+		branch, err := currentBranch(r)
+		if err != nil {
+			return "", err
+		}
+
+		if branch == "" {
+			return "", errors.New("you are not currently on a branch")
+		}
+
+		return plumbing.NewBranchReferenceName(branch).String(), nil
+	}
+
+	if strings.HasPrefix(name, "refs/") {
+		return name, nil
+	}
+
+	for _, n := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(name),
+		plumbing.NewTagReferenceName(name),
+	} {
+		if _, err := r.Reference(n, false); err == nil {
+			return n.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("src refspec %s does not match any", name)
+}
+
+// printPushRefResult prints the result of the push of a reference, with the
+// flag and summary used by git push --porcelain.
+func printPushRefResult(ref *git.PushRefResult) {
+	flag, summary := " ", fmt.Sprintf("%s..%s", shortHash(ref.Old), shortHash(ref.New))
+	switch {
+	case ref.Status == git.PushUpToDate:
+		flag, summary = "=", "[up to date]"
+	case ref.Status != git.PushOK:
+		flag, summary = "!", fmt.Sprintf("[rejected] (%s)", ref.Status)
+		if ref.Message != "" {
+			summary = fmt.Sprintf("[rejected] (%s)", ref.Message)
+		}
+	case ref.Old.IsZero():
+		flag, summary = "*", "[new reference]"
+	case ref.New.IsZero():
+		flag, summary = "-", "[deleted]"
+	}
+
+	fmt.Fprintf(stdout, "%s\t%s\t%s\n", flag, ref.Name, summary)
+}
+
+func shortHash(h plumbing.Hash) string {
+	return h.String()[:7]
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/file"
 )
@@ -11,14 +12,19 @@ import (
 type CmdReceivePack struct {
 	cmd
 
+	Strict        bool `long:"strict" description:"Do not try <git-dir>/.git/ if <git-dir> is not a git directory"`
+	Timeout       int  `long:"timeout" value-name:"n" description:"Interrupt the transfer after the given seconds of inactivity"`
+	StatelessRPC  bool `long:"stateless-rpc" description:"Serve a single request and response exchange, as the smart HTTP protocol does"`
+	AdvertiseRefs bool `long:"advertise-refs" description:"Only output the initial reference advertisement"`
+
 	Args struct {
 		GitDir string `positional-arg-name:"git-dir" required:"true"`
 	} `positional-args:"yes"`
 }
 
 func (CmdReceivePack) Usage() string {
-	//TODO: git-receive-pack returns error code 129 if arguments are invalid.
-	return fmt.Sprintf("usage: %s <git-dir>", os.Args[0])
+	return fmt.Sprintf("usage: %s [--strict] [--timeout=<n>] [--stateless-rpc] "+
+		"[--advertise-refs] <git-dir>", os.Args[0])
 }
 
 func (c *CmdReceivePack) Execute(args []string) error {
@@ -27,7 +33,14 @@ func (c *CmdReceivePack) Execute(args []string) error {
 		return err
 	}
 
-	if err := file.ServeReceivePack(gitDir); err != nil {
+	err = file.ServeReceivePackWithOptions(gitDir, &file.ServerOptions{
+		Strict:        c.Strict,
+		Timeout:       time.Duration(c.Timeout) * time.Second,
+		StatelessRPC:  c.StatelessRPC,
+		AdvertiseRefs: c.AdvertiseRefs,
+	})
+
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERR:", err)
 		os.Exit(128)
 	}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+)
+
+var errMissingIdentity = errors.New("unable to auto-detect the identity, " +
+	"set user.name and user.email in the git config")
+
+// workingPath returns the given path relative to the directory given with the
+// -C option, if any.
+func workingPath(p string) string {
+	if options.Directory == "" || filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(options.Directory, p)
+}
+
+// openRepository opens the repository containing the working directory, with
+// the system and global config loaded as git does.
+func openRepository() (*git.Repository, error) {
+	r, err := git.PlainOpenWithOptions(workingPath("."), &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.LoadGlobalConfig(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// worktreePath returns the path of the given file relative to the root of the
+// worktree, as the worktree functions expect it.
+func worktreePath(w *git.Worktree, p string) (string, error) {
+	abs, err := filepath.Abs(workingPath(p))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(w.Filesystem.Root(), abs)
+	if err != nil {
+		return "", err
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: outside repository", p)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// resolveCommit returns the commit the given revision points to.
+func resolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", rev, err)
+	}
+
+	return r.CommitObject(*h)
+}
+
+// signature returns the identity of the user, read from the given environment
+// variables, as GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL, or from the user section
+// of the merged config of the repository.
+func signature(r *git.Repository, nameEnv, emailEnv string) (*object.Signature, error) {
+	cfg, err := r.MergedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &object.Signature{
+		Name:  os.Getenv(nameEnv),
+		Email: os.Getenv(emailEnv),
+		When:  time.Now(),
+	}
+
+	if s.Name == "" {
+		s.Name = cfg.User.Name
+	}
+
+	if s.Email == "" {
+		s.Email = cfg.User.Email
+	}
+
+	if s.Name == "" || s.Email == "" {
+		return nil, errMissingIdentity
+	}
+
+	return s, nil
+}
+
+// parseIdentity parses an identity in the "Name <email>" form.
+func parseIdentity(id string) (*object.Signature, error) {
+	open := strings.LastIndex(id, "<")
+	if open < 0 || !strings.HasSuffix(id, ">") {
+		return nil, fmt.Errorf("invalid identity, expected \"Name <email>\": %s", id)
+	}
+
+	return &object.Signature{
+		Name:  strings.TrimSpace(id[:open]),
+		Email: id[open+1 : len(id)-1],
+		When:  time.Now(),
+	}, nil
+}
+
+// progress returns the output of the progress of the remote operations, nil
+// if quiet.
+func progress(quiet bool) sideband.Progress {
+	if quiet {
+		return nil
+	}
+
+	return stderr
+}
+
+// currentBranch returns the short name of the branch HEAD points to, empty if
+// HEAD is detached.
+func currentBranch(r *git.Repository) (string, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", nil
+	}
+
+	return head.Target().Short(), nil
+}
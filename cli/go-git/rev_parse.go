@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+type CmdRevParse struct {
+	cmd
+
+	AbbrevRef bool `long:"abbrev-ref" description:"Output the short name of the references instead of the object names"`
+
+	Args struct {
+		Revisions []string `positional-arg-name:"revision" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func (CmdRevParse) Usage() string {
+	return fmt.Sprintf("usage: %s rev-parse [--abbrev-ref] <revision>...", os.Args[0])
+}
+
+func (c *CmdRevParse) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	for _, rev := range c.Args.Revisions {
+		if !c.AbbrevRef {
+			h, err := r.ResolveRevision(plumbing.Revision(rev))
+			if err != nil {
+				return fmt.Errorf("%s: %s", rev, err)
+			}
+
+			fmt.Fprintln(stdout, h)
+			continue
+		}
+
+		name, err := abbrevRef(r.Storer, rev)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdout, name)
+	}
+
+	return nil
+}
+
+// abbrevRef returns the short name of the reference the given name refers
+// to, following the symbolic references, as HEAD, or HEAD if it is detached.
+func abbrevRef(s storer.ReferenceStorer, name string) (string, error) {
+	rules := append([]string{"%s"}, plumbing.RefRevParseRules...)
+	for _, rule := range rules {
+		ref, err := s.Reference(plumbing.ReferenceName(fmt.Sprintf(rule, name)))
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		for ref.Type() == plumbing.SymbolicReference {
+			target := ref.Target()
+			if ref, err = s.Reference(target); err == plumbing.ErrReferenceNotFound {
+				// an unborn branch.
+				return target.Short(), nil
+			}
+
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if ref.Name() == plumbing.HEAD {
+			return "HEAD", nil
+		}
+
+		return ref.Name().Short(), nil
+	}
+
+	return "", fmt.Errorf("%s: %s", name, plumbing.ErrReferenceNotFound)
+}
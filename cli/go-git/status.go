@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+var statusNames = map[git.StatusCode]string{
+	git.Modified:           "modified",
+	git.Added:              "new file",
+	git.Deleted:            "deleted",
+	git.Renamed:            "renamed",
+	git.Copied:             "copied",
+	git.UpdatedButUnmerged: "unmerged",
+}
+
+type CmdStatus struct {
+	cmd
+
+	Short bool `short:"s" long:"short" description:"Give the output in the short format"`
+}
+
+func (CmdStatus) Usage() string {
+	return fmt.Sprintf("usage: %s status [--short]", os.Args[0])
+}
+
+func (c *CmdStatus) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	s, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for p, fs := range s {
+		if fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified {
+			paths = append(paths, p)
+		}
+	}
+
+	sort.Strings(paths)
+
+	if c.Short {
+		for _, p := range paths {
+			fmt.Fprintf(stdout, "%c%c %s\n", s[p].Staging, s[p].Worktree, statusPath(p, s[p]))
+		}
+
+		return nil
+	}
+
+	branch, err := currentBranch(r)
+	if err != nil {
+		return err
+	}
+
+	if branch != "" {
+		fmt.Fprintf(stdout, "On branch %s\n", branch)
+	} else {
+		fmt.Fprintln(stdout, "HEAD detached")
+	}
+
+	if len(paths) == 0 {
+		fmt.Fprintln(stdout, "nothing to commit, working tree clean")
+		return nil
+	}
+
+	printStatusSection("Changes to be committed:", paths, func(p string) string {
+		if code := s[p].Staging; code != git.Unmodified && code != git.Untracked {
+			return fmt.Sprintf("%-12s%s", statusNames[code]+":", statusPath(p, s[p]))
+		}
+
+		return ""
+	})
+
+	printStatusSection("Changes not staged for commit:", paths, func(p string) string {
+		if code := s[p].Worktree; code != git.Unmodified && code != git.Untracked {
+			return fmt.Sprintf("%-12s%s", statusNames[code]+":", p)
+		}
+
+		return ""
+	})
+
+	printStatusSection("Untracked files:", paths, func(p string) string {
+		if s[p].Worktree == git.Untracked {
+			return p
+		}
+
+		return ""
+	})
+
+	return nil
+}
+
+// printStatusSection prints the given title followed by the lines returned by
+// line for every path, if any is not empty.
+func printStatusSection(title string, paths []string, line func(string) string) {
+	var lines []string
+	for _, p := range paths {
+		if l := line(p); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintln(stdout, title)
+	for _, l := range lines {
+		fmt.Fprintf(stdout, "\t%s\n", l)
+	}
+
+	fmt.Fprintln(stdout)
+}
+
+func statusPath(p string, fs *git.FileStatus) string {
+	if fs.Staging == git.Renamed || fs.Staging == git.Copied {
+		return fmt.Sprintf("%s -> %s", fs.Extra, p)
+	}
+
+	return p
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+type CmdTag struct {
+	cmd
+
+	Delete   bool   `short:"d" long:"delete" description:"Delete the given tag"`
+	Annotate bool   `short:"a" long:"annotate" description:"Make an annotated tag object"`
+	Message  string `short:"m" long:"message" value-name:"msg" description:"Use the given message as the annotation, implies --annotate"`
+
+	Args struct {
+		Name   string `positional-arg-name:"tagname"`
+		Commit string `positional-arg-name:"commit"`
+	} `positional-args:"yes"`
+}
+
+func (CmdTag) Usage() string {
+	return fmt.Sprintf("usage: %s tag [--delete] [--annotate] [--message=<msg>] "+
+		"[<tagname> [<commit>]]", os.Args[0])
+}
+
+func (c *CmdTag) Execute(args []string) error {
+	r, err := openRepository()
+	if err != nil {
+		return err
+	}
+
+	if c.Args.Name == "" {
+		if c.Delete {
+			return fmt.Errorf("tag name required")
+		}
+
+		tags, err := r.Tags()
+		if err != nil {
+			return err
+		}
+
+		return tags.ForEach(func(ref *plumbing.Reference) error {
+			fmt.Fprintln(stdout, ref.Name().Short())
+			return nil
+		})
+	}
+
+	if c.Delete {
+		return r.DeleteTag(c.Args.Name)
+	}
+
+	rev := c.Args.Commit
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	commit, err := resolveCommit(r, rev)
+	if err != nil {
+		return err
+	}
+
+	var o *git.CreateTagOptions
+	if c.Annotate || c.Message != "" {
+		if c.Message == "" {
+			return fmt.Errorf("a message is required to annotate a tag")
+		}
+
+		tagger, err := signature(r, "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL")
+		if err != nil {
+			return err
+		}
+
+		o = &git.CreateTagOptions{Tagger: tagger, Message: c.Message}
+	}
+
+	_, err = r.CreateTag(c.Args.Name, commit.Hash, o)
+	return err
+}
@@ -1,6 +1,8 @@
 package git
 
 import (
+	"os"
+	"sync"
 	"testing"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
@@ -168,3 +170,56 @@ func AssertReferences(c *C, r *Repository, expected map[string]string) {
 		c.Assert(obtained, DeepEquals, expected)
 	}
 }
+
+// IsolateConfig makes the system and global config scopes empty, pointing
+// them to a temporary directory, until the returned function is called.
+func IsolateConfig(c *C) func() {
+	home := c.MkDir()
+	env := map[string]string{
+		"HOME":                home,
+		"XDG_CONFIG_HOME":     "",
+		"GIT_CONFIG_GLOBAL":   "",
+		"GIT_CONFIG_SYSTEM":   "",
+		"GIT_CONFIG_NOSYSTEM": "1",
+	}
+
+	old := make(map[string]string)
+	for k, v := range env {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+// progressRecorder is a plumbing.ProgressHandler recording the events.
+type progressRecorder struct {
+	sync.Mutex
+	events []plumbing.ProgressEvent
+}
+
+func (r *progressRecorder) OnProgress(e plumbing.ProgressEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+// done returns the last event of the phase, if it ended.
+func (r *progressRecorder) done(phase plumbing.ProgressPhase, remote bool) (plumbing.ProgressEvent, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	for i := len(r.events) - 1; i >= 0; i-- {
+		e := r.events[i]
+		if e.Phase == phase && e.Remote == remote {
+			return e, e.Done
+		}
+	}
+
+	return plumbing.ProgressEvent{}, false
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 )
@@ -16,8 +17,77 @@ const (
 	DefaultFetchRefSpec = "+refs/heads/*:refs/remotes/%s/*"
 	// DefaultPushRefSpec is the default refspec used for push.
 	DefaultPushRefSpec = "refs/heads/*:refs/heads/*"
+	// MirrorPushRefSpec is the refspec used to push to a mirror remote.
+	MirrorPushRefSpec = "+refs/*:refs/*"
 )
 
+const (
+	// TagOptAllTags is the RemoteConfig.TagOpt value fetching all the tags of
+	// the remote.
+	TagOptAllTags = "--tags"
+	// TagOptNoTags is the RemoteConfig.TagOpt value fetching no tags from
+	// the remote.
+	TagOptNoTags = "--no-tags"
+)
+
+// OptBool is a boolean option that may be unset, in which case the value of
+// another option, or the default, applies.
+type OptBool int
+
+const (
+	// OptBoolUnset means the option is not set.
+	OptBoolUnset OptBool = iota
+	// OptBoolFalse means the option is set to false.
+	OptBoolFalse
+	// OptBoolTrue means the option is set to true.
+	OptBoolTrue
+)
+
+// NewOptBool returns the OptBool set to the given value.
+func NewOptBool(b bool) OptBool {
+	if b {
+		return OptBoolTrue
+	}
+
+	return OptBoolFalse
+}
+
+// IsSet returns true if the option is set.
+func (b OptBool) IsSet() bool {
+	return b != OptBoolUnset
+}
+
+// IsTrue returns true if the option is set to true.
+func (b OptBool) IsTrue() bool {
+	return b == OptBoolTrue
+}
+
+// parseOptBool returns the OptBool of the given config value, accepting the
+// boolean values of git. Empty and invalid values are unset.
+func parseOptBool(value string) OptBool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return OptBoolTrue
+	case "false", "no", "off", "0":
+		return OptBoolFalse
+	}
+
+	return OptBoolUnset
+}
+
+// optBoolString returns the config value of the given OptBool, empty if it
+// is unset.
+func optBoolString(b OptBool) string {
+	switch b {
+	case OptBoolTrue:
+		return "true"
+	case OptBoolFalse:
+		return "false"
+	}
+
+	return ""
+}
+
 // ConfigStorer generic storage of Config object
 type ConfigStorer interface {
 	Config() (*Config, error)
@@ -45,6 +115,25 @@ type Config struct {
 		CommentChar string
 	}
 
+	User struct {
+		// Name is the name of the user, used as the default author and
+		// committer name.
+		Name string
+		// Email is the email of the user, used as the default author and
+		// committer email.
+		Email string
+	}
+
+	Fetch struct {
+		// Prune removes on fetch the remote-tracking references whose remote
+		// reference no longer exists, for the remotes with no prune option.
+		Prune OptBool
+		// PruneTags removes on fetch, when pruning, the local tags which no
+		// longer exist in the remote, for the remotes with no pruneTags
+		// option.
+		PruneTags OptBool
+	}
+
 	Pack struct {
 		// Window controls the size of the sliding window for delta
 		// compression.  The default is 10.  A value of 0 turns off
@@ -61,6 +150,9 @@ type Config struct {
 	// Branches list of branches, the key is the branch name and should
 	// equal Branch.Name
 	Branches map[string]*Branch
+	// URLs list of URL rewrite rules, the key is the base of the rules and
+	// should equal URL.Name.
+	URLs map[string]*URL
 	// Raw contains the raw information of a config file. The main goal is
 	// preserve the parsed information from the original format, to avoid
 	// dropping unsupported fields.
@@ -73,6 +165,7 @@ func NewConfig() *Config {
 		Remotes:    make(map[string]*RemoteConfig),
 		Submodules: make(map[string]*Submodule),
 		Branches:   make(map[string]*Branch),
+		URLs:       make(map[string]*URL),
 		Raw:        format.New(),
 	}
 
@@ -103,6 +196,16 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for name, u := range c.URLs {
+		if u.Name != name {
+			return ErrInvalid
+		}
+
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -111,14 +214,32 @@ const (
 	submoduleSection = "submodule"
 	branchSection    = "branch"
 	coreSection      = "core"
+	userSection      = "user"
+	fetchSection     = "fetch"
 	packSection      = "pack"
+	urlSection       = "url"
 	fetchKey         = "fetch"
 	urlKey           = "url"
+	pushURLKey       = "pushurl"
+	pushKey          = "push"
+	tagOptKey        = "tagOpt"
+	pruneKey         = "prune"
+	pruneTagsKey     = "pruneTags"
+	mirrorKey        = "mirror"
+	skipUpdateKey    = "skipDefaultUpdate"
+	uploadPackKey    = "uploadpack"
+	receivePackKey   = "receivepack"
 	bareKey          = "bare"
 	worktreeKey      = "worktree"
 	commentCharKey   = "commentChar"
 	windowKey        = "window"
+	nameKey          = "name"
+	emailKey         = "email"
 	mergeKey         = "merge"
+	promisorKey      = "promisor"
+	partialCloneKey  = "partialclonefilter"
+	insteadOfKey     = "insteadOf"
+	pushInsteadOfKey = "pushInsteadOf"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
@@ -136,6 +257,8 @@ func (c *Config) Unmarshal(b []byte) error {
 	}
 
 	c.unmarshalCore()
+	c.unmarshalUser()
+	c.unmarshalFetch()
 	if err := c.unmarshalPack(); err != nil {
 		return err
 	}
@@ -145,6 +268,10 @@ func (c *Config) Unmarshal(b []byte) error {
 		return err
 	}
 
+	if err := c.unmarshalURLs(); err != nil {
+		return err
+	}
+
 	return c.unmarshalRemotes()
 }
 
@@ -158,6 +285,18 @@ func (c *Config) unmarshalCore() {
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
 }
 
+func (c *Config) unmarshalUser() {
+	s := c.Raw.Section(userSection)
+	c.User.Name = s.Options.Get(nameKey)
+	c.User.Email = s.Options.Get(emailKey)
+}
+
+func (c *Config) unmarshalFetch() {
+	s := c.Raw.Section(fetchSection)
+	c.Fetch.Prune = parseOptBool(s.Options.Get(pruneKey))
+	c.Fetch.PruneTags = parseOptBool(s.Options.Get(pruneTagsKey))
+}
+
 func (c *Config) unmarshalPack() error {
 	s := c.Raw.Section(packSection)
 	window := s.Options.Get(windowKey)
@@ -215,13 +354,30 @@ func (c *Config) unmarshalBranches() error {
 	return nil
 }
 
+func (c *Config) unmarshalURLs() error {
+	s := c.Raw.Section(urlSection)
+	for _, sub := range s.Subsections {
+		u := &URL{}
+		if err := u.unmarshal(sub); err != nil {
+			return err
+		}
+
+		c.URLs[u.Name] = u
+	}
+
+	return nil
+}
+
 // Marshal returns Config encoded as a git-config file.
 func (c *Config) Marshal() ([]byte, error) {
 	c.marshalCore()
+	c.marshalUser()
+	c.marshalFetch()
 	c.marshalPack()
 	c.marshalRemotes()
 	c.marshalSubmodules()
 	c.marshalBranches()
+	c.marshalURLs()
 
 	buf := bytes.NewBuffer(nil)
 	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
@@ -240,6 +396,32 @@ func (c *Config) marshalCore() {
 	}
 }
 
+func (c *Config) marshalUser() {
+	s := c.Raw.Section(userSection)
+	if c.User.Name != "" {
+		s.SetOption(nameKey, c.User.Name)
+	}
+
+	if c.User.Email != "" {
+		s.SetOption(emailKey, c.User.Email)
+	}
+}
+
+func (c *Config) marshalFetch() {
+	s := c.Raw.Section(fetchSection)
+	if c.Fetch.Prune.IsSet() {
+		s.SetOption(pruneKey, optBoolString(c.Fetch.Prune))
+	} else {
+		s.RemoveOption(pruneKey)
+	}
+
+	if c.Fetch.PruneTags.IsSet() {
+		s.SetOption(pruneTagsKey, optBoolString(c.Fetch.PruneTags))
+	} else {
+		s.RemoveOption(pruneTagsKey)
+	}
+}
+
 func (c *Config) marshalPack() {
 	s := c.Raw.Section(packSection)
 	if c.Pack.Window != DefaultPackWindow {
@@ -316,6 +498,33 @@ func (c *Config) marshalBranches() {
 	s.Subsections = newSubsections
 }
 
+func (c *Config) marshalURLs() {
+	s := c.Raw.Section(urlSection)
+	newSubsections := make(format.Subsections, 0, len(c.URLs))
+	added := make(map[string]bool)
+	for _, subsection := range s.Subsections {
+		if u, ok := c.URLs[subsection.Name]; ok {
+			newSubsections = append(newSubsections, u.marshal())
+			added[subsection.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(c.URLs))
+	for name := range c.URLs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !added[name] {
+			newSubsections = append(newSubsections, c.URLs[name].marshal())
+		}
+	}
+
+	s.Subsections = newSubsections
+}
+
 // RemoteConfig contains the configuration for a given remote repository.
 type RemoteConfig struct {
 	// Name of the remote
@@ -323,8 +532,42 @@ type RemoteConfig struct {
 	// URLs the URLs of a remote repository. It must be non-empty. Fetch will
 	// always use the first URL, while push will use all of them.
 	URLs []string
+	// PushURLs the URLs used to push instead of URLs, all of them are used.
+	PushURLs []string
 	// Fetch the default set of "refspec" for fetch operation
 	Fetch []RefSpec
+	// Push the default set of "refspec" for push operation, if empty
+	// DefaultPushRefSpec is used. A refspec without destination, as HEAD or
+	// refs/heads/master, pushes to the same reference.
+	Push []RefSpec
+	// TagOpt is the default tag mode of the fetch operation, TagOptAllTags
+	// or TagOptNoTags. If empty the tags pointing into the fetched histories
+	// are fetched.
+	TagOpt string
+	// Prune removes on fetch the remote-tracking references whose remote
+	// reference no longer exists. If unset, fetch.prune applies.
+	Prune OptBool
+	// PruneTags removes on fetch, when pruning, the local tags which no
+	// longer exist in the remote. If unset, fetch.pruneTags applies.
+	PruneTags OptBool
+	// Mirror pushes all the references by default, overwriting and deleting
+	// the remote ones to mirror the local repository.
+	Mirror bool
+	// SkipDefaultUpdate excludes the remote from the updates of all the
+	// remotes.
+	SkipDefaultUpdate bool
+	// UploadPack is the command run on the remote side instead of
+	// git-upload-pack when fetching, with the ssh and file transports.
+	UploadPack string
+	// ReceivePack is the command run on the remote side instead of
+	// git-receive-pack when pushing, with the ssh and file transports.
+	ReceivePack string
+	// Promisor is true if the remote is a promisor remote, the objects
+	// missing from a partial clone are fetched lazily from it.
+	Promisor bool
+	// PartialCloneFilter is the object filter used by default when fetching
+	// from this remote, see packp.Filter.
+	PartialCloneFilter string
 
 	// raw representation of the subsection, filled by marshal or unmarshal are
 	// called
@@ -347,6 +590,12 @@ func (c *RemoteConfig) Validate() error {
 		}
 	}
 
+	for _, r := range c.Push {
+		if err := validatePushRefSpec(r); err != nil {
+			return err
+		}
+	}
+
 	if len(c.Fetch) == 0 {
 		c.Fetch = []RefSpec{RefSpec(fmt.Sprintf(DefaultFetchRefSpec, c.Name))}
 	}
@@ -367,13 +616,45 @@ func (c *RemoteConfig) unmarshal(s *format.Subsection) error {
 		fetch = append(fetch, rs)
 	}
 
+	var push []RefSpec
+	for _, p := range c.raw.Options.GetAll(pushKey) {
+		rs := RefSpec(p)
+		if err := validatePushRefSpec(rs); err != nil {
+			return err
+		}
+
+		push = append(push, rs)
+	}
+
 	c.Name = c.raw.Name
 	c.URLs = append([]string(nil), c.raw.Options.GetAll(urlKey)...)
+	c.PushURLs = append([]string(nil), c.raw.Options.GetAll(pushURLKey)...)
 	c.Fetch = fetch
+	c.Push = push
+	c.TagOpt = c.raw.Options.Get(tagOptKey)
+	c.Prune = parseOptBool(c.raw.Options.Get(pruneKey))
+	c.PruneTags = parseOptBool(c.raw.Options.Get(pruneTagsKey))
+	c.Mirror = parseOptBool(c.raw.Options.Get(mirrorKey)).IsTrue()
+	c.SkipDefaultUpdate = parseOptBool(c.raw.Options.Get(skipUpdateKey)).IsTrue()
+	c.UploadPack = c.raw.Options.Get(uploadPackKey)
+	c.ReceivePack = c.raw.Options.Get(receivePackKey)
+	c.Promisor = parseOptBool(c.raw.Options.Get(promisorKey)).IsTrue()
+	c.PartialCloneFilter = c.raw.Options.Get(partialCloneKey)
 
 	return nil
 }
 
+// validatePushRefSpec validates a push refspec, a refspec without destination,
+// as <src>, is valid too, it pushes to the same reference.
+func validatePushRefSpec(rs RefSpec) error {
+	spec := string(rs)
+	if spec != "" && !strings.Contains(spec, refSpecSeparator) {
+		rs = RefSpec(spec + refSpecSeparator + strings.TrimPrefix(spec, refSpecForce))
+	}
+
+	return rs.Validate()
+}
+
 func (c *RemoteConfig) marshal() *format.Subsection {
 	if c.raw == nil {
 		c.raw = &format.Subsection{}
@@ -397,5 +678,53 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 		c.raw.SetOption(fetchKey, values...)
 	}
 
+	if len(c.PushURLs) == 0 {
+		c.raw.RemoveOption(pushURLKey)
+	} else {
+		c.raw.SetOption(pushURLKey, c.PushURLs...)
+	}
+
+	if len(c.Push) == 0 {
+		c.raw.RemoveOption(pushKey)
+	} else {
+		var values []string
+		for _, rs := range c.Push {
+			values = append(values, rs.String())
+		}
+
+		c.raw.SetOption(pushKey, values...)
+	}
+
+	c.marshalString(tagOptKey, c.TagOpt)
+	c.marshalString(pruneKey, optBoolString(c.Prune))
+	c.marshalString(pruneTagsKey, optBoolString(c.PruneTags))
+	c.marshalBool(mirrorKey, c.Mirror)
+	c.marshalBool(skipUpdateKey, c.SkipDefaultUpdate)
+	c.marshalString(uploadPackKey, c.UploadPack)
+	c.marshalString(receivePackKey, c.ReceivePack)
+
+	c.marshalBool(promisorKey, c.Promisor)
+	c.marshalString(partialCloneKey, c.PartialCloneFilter)
+
 	return c.raw
 }
+
+// marshalBool sets the boolean option, keeping its current value if it is
+// already the same boolean, as yes or on.
+func (c *RemoteConfig) marshalBool(key string, value bool) {
+	current := parseOptBool(c.raw.Options.Get(key)).IsTrue()
+	switch {
+	case value && !current:
+		c.raw.SetOption(key, "true")
+	case !value && current:
+		c.raw.RemoveOption(key)
+	}
+}
+
+func (c *RemoteConfig) marshalString(key, value string) {
+	if value == "" {
+		c.raw.RemoveOption(key)
+	} else {
+		c.raw.SetOption(key, value)
+	}
+}
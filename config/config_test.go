@@ -14,6 +14,12 @@ func (s *ConfigSuite) TestUnmarshall(c *C) {
         bare = true
 		worktree = foo
 		commentchar = bar
+[user]
+		name = foo
+		email = foo@foo.com
+[fetch]
+		prune = true
+		pruneTags = true
 [pack]
 		window = 20
 [remote "origin"]
@@ -42,6 +48,10 @@ func (s *ConfigSuite) TestUnmarshall(c *C) {
 	c.Assert(cfg.Core.IsBare, Equals, true)
 	c.Assert(cfg.Core.Worktree, Equals, "foo")
 	c.Assert(cfg.Core.CommentChar, Equals, "bar")
+	c.Assert(cfg.User.Name, Equals, "foo")
+	c.Assert(cfg.User.Email, Equals, "foo@foo.com")
+	c.Assert(cfg.Fetch.Prune, Equals, OptBoolTrue)
+	c.Assert(cfg.Fetch.PruneTags, Equals, OptBoolTrue)
 	c.Assert(cfg.Pack.Window, Equals, uint(20))
 	c.Assert(cfg.Remotes, HasLen, 3)
 	c.Assert(cfg.Remotes["origin"].Name, Equals, "origin")
@@ -64,6 +74,11 @@ func (s *ConfigSuite) TestMarshall(c *C) {
 	output := []byte(`[core]
 	bare = true
 	worktree = bar
+[user]
+	name = foo
+	email = foo@foo.com
+[fetch]
+	prune = true
 [pack]
 	window = 20
 [remote "alt"]
@@ -85,6 +100,9 @@ func (s *ConfigSuite) TestMarshall(c *C) {
 	cfg := NewConfig()
 	cfg.Core.IsBare = true
 	cfg.Core.Worktree = "bar"
+	cfg.User.Name = "foo"
+	cfg.User.Email = "foo@foo.com"
+	cfg.Fetch.Prune = OptBoolTrue
 	cfg.Pack.Window = 20
 	cfg.Remotes["origin"] = &RemoteConfig{
 		Name: "origin",
@@ -250,3 +268,155 @@ func (s *ConfigSuite) TestRemoteConfigDefaultValues(c *C) {
 	c.Assert(config.Raw, NotNil)
 	c.Assert(config.Pack.Window, Equals, DefaultPackWindow)
 }
+
+func (s *ConfigSuite) TestRemoteConfigPromisor(c *C) {
+	input := []byte(`[core]
+	bare = false
+[remote "origin"]
+	url = git@github.com:mcuadros/go-git.git
+	promisor = true
+	partialclonefilter = blob:none
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Remotes["origin"].Promisor, Equals, true)
+	c.Assert(cfg.Remotes["origin"].PartialCloneFilter, Equals, "blob:none")
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(input))
+
+	cfg.Remotes["origin"].Promisor = false
+	cfg.Remotes["origin"].PartialCloneFilter = ""
+	output, err = cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = git@github.com:mcuadros/go-git.git\n")
+}
+
+func (s *ConfigSuite) TestRemoteConfigPushWithoutDst(c *C) {
+	input := []byte(`[core]
+	bare = false
+[remote "origin"]
+	url = git@github.com:mcuadros/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	push = HEAD
+	push = +refs/heads/main
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Validate(), IsNil)
+
+	r := cfg.Remotes["origin"]
+	c.Assert(r.Push, DeepEquals, []RefSpec{"HEAD", "+refs/heads/main"})
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(input))
+
+	cfg = NewConfig()
+	err = cfg.Unmarshal([]byte("[remote \"origin\"]\n\turl = foo\n\tpush = refs/*/*\n"))
+	c.Assert(err, Equals, ErrRefSpecMalformedWildcard)
+}
+
+func (s *ConfigSuite) TestRemoteConfigBooleans(c *C) {
+	input := []byte(`[core]
+	bare = false
+[remote "origin"]
+	url = git@github.com:mcuadros/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	mirror = yes
+	skipDefaultUpdate = On
+	promisor = 1
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+
+	r := cfg.Remotes["origin"]
+	c.Assert(r.Mirror, Equals, true)
+	c.Assert(r.SkipDefaultUpdate, Equals, true)
+	c.Assert(r.Promisor, Equals, true)
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(input))
+
+	r.Mirror = false
+	output, err = cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Not(Matches), "(?s).*mirror.*")
+}
+
+func (s *ConfigSuite) TestRemoteConfigPushOptions(c *C) {
+	input := []byte(`[core]
+	bare = false
+[remote "origin"]
+	url = git@github.com:mcuadros/go-git.git
+	pushurl = git@github.com:src-d/go-git.git
+	pushurl = git@gitlab.com:src-d/go-git.git
+	push = refs/heads/master:refs/heads/master
+	tagOpt = --no-tags
+	prune = true
+	pruneTags = true
+	mirror = true
+	skipDefaultUpdate = true
+	uploadpack = /usr/bin/git-upload-pack
+	receivepack = /usr/bin/git-receive-pack
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+
+	r := cfg.Remotes["origin"]
+	c.Assert(r.PushURLs, DeepEquals, []string{"git@github.com:src-d/go-git.git", "git@gitlab.com:src-d/go-git.git"})
+	c.Assert(r.Push, DeepEquals, []RefSpec{"refs/heads/master:refs/heads/master"})
+	c.Assert(r.TagOpt, Equals, TagOptNoTags)
+	c.Assert(r.Prune, Equals, OptBoolTrue)
+	c.Assert(r.PruneTags, Equals, OptBoolTrue)
+	c.Assert(r.Mirror, Equals, true)
+	c.Assert(r.SkipDefaultUpdate, Equals, true)
+	c.Assert(r.UploadPack, Equals, "/usr/bin/git-upload-pack")
+	c.Assert(r.ReceivePack, Equals, "/usr/bin/git-receive-pack")
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(input))
+
+	*r = RemoteConfig{Name: r.Name, URLs: r.URLs, raw: r.raw}
+	output, err = cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = git@github.com:mcuadros/go-git.git\n")
+}
+
+func (s *ConfigSuite) TestPruneFalse(c *C) {
+	input := []byte(`[core]
+	bare = false
+[fetch]
+	prune = true
+[remote "origin"]
+	url = git@github.com:mcuadros/go-git.git
+	prune = false
+`)
+
+	cfg := NewConfig()
+	c.Assert(cfg.Unmarshal(input), IsNil)
+	c.Assert(cfg.Fetch.Prune, Equals, OptBoolTrue)
+	c.Assert(cfg.Fetch.PruneTags, Equals, OptBoolUnset)
+	c.Assert(cfg.Remotes["origin"].Prune, Equals, OptBoolFalse)
+
+	output, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(output), Equals, string(input))
+}
+
+func (s *ConfigSuite) TestRemoteConfigValidateInvalidPush(c *C) {
+	config := &RemoteConfig{
+		Name: "foo",
+		URLs: []string{"http://foo/bar"},
+		Push: []RefSpec{"refs/heads/master:foo:bar"},
+	}
+
+	c.Assert(config.Validate(), Equals, ErrRefSpecMalformedSeparator)
+}
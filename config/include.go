@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+const (
+	includeSection   = "include"
+	includeIfSection = "includeIf"
+
+	// maxIncludeDepth is the maximum depth of nested includes, as in git.
+	maxIncludeDepth = 10
+)
+
+// ErrIncludeDepth is returned when the includes of a config are nested too
+// deeply, usually because of an include loop.
+var ErrIncludeDepth = errors.New("exceeded maximum include depth")
+
+// IncludeContext is the context used to evaluate the conditions of the
+// includeIf sections.
+type IncludeContext struct {
+	// GitDir is the git directory of the repository, used by the "gitdir:"
+	// and "gitdir/i:" conditions.
+	GitDir string
+	// Branch is the short name of the branch checked out, used by the
+	// "onbranch:" condition.
+	Branch string
+}
+
+// ExpandIncludes returns a copy of the given config with the files of its
+// include.path options and the ones of the includeIf.<condition>.path options
+// matching ctx merged in, recursively, as git does. Relative paths are
+// resolved against dir, the directory of the config file, and the missing
+// files are ignored.
+func ExpandIncludes(raw *format.Config, dir string, ctx *IncludeContext) (*format.Config, error) {
+	if ctx == nil {
+		ctx = &IncludeContext{}
+	}
+
+	dst := format.New()
+	if err := expandIncludes(dst, raw, dir, ctx, 0); err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+func expandIncludes(dst, raw *format.Config, dir string, ctx *IncludeContext, depth int) error {
+	for _, s := range raw.Sections {
+		Merge(dst, &format.Config{Sections: format.Sections{s}})
+
+		var paths []string
+		switch {
+		case s.IsName(includeSection):
+			paths = s.Options.GetAll(pathKey)
+		case s.IsName(includeIfSection):
+			for _, ss := range s.Subsections {
+				ok, err := matchCondition(ss.Name, dir, ctx)
+				if err != nil {
+					return err
+				}
+
+				if ok {
+					paths = append(paths, ss.Options.GetAll(pathKey)...)
+				}
+			}
+		}
+
+		for _, p := range paths {
+			if err := includeFile(dst, p, dir, ctx, depth); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func includeFile(dst *format.Config, p, dir string, ctx *IncludeContext, depth int) error {
+	if depth >= maxIncludeDepth {
+		return ErrIncludeDepth
+	}
+
+	p, err := expandPath(p, dir)
+	if err != nil {
+		return err
+	}
+
+	raw, err := readFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return expandIncludes(dst, raw, filepath.Dir(p), ctx, depth+1)
+}
+
+// matchCondition reports whether the condition of an includeIf section
+// matches the given context. Unknown conditions never match.
+func matchCondition(cond, dir string, ctx *IncludeContext) (bool, error) {
+	i := strings.Index(cond, ":")
+	if i < 0 {
+		return false, nil
+	}
+
+	kind, pattern := cond[:i], cond[i+1:]
+	switch kind {
+	case "gitdir", "gitdir/i":
+		if ctx.GitDir == "" {
+			return false, nil
+		}
+
+		return matchGitDir(pattern, dir, ctx.GitDir, kind == "gitdir/i")
+	case "onbranch":
+		if ctx.Branch == "" {
+			return false, nil
+		}
+
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+
+		return matchGlob(pattern, ctx.Branch, false)
+	}
+
+	return false, nil
+}
+
+func matchGitDir(pattern, dir, gitDir string, fold bool) (bool, error) {
+	switch {
+	case strings.HasPrefix(pattern, "~/"):
+		home, err := homeDir()
+		if err != nil {
+			return false, err
+		}
+
+		pattern = filepath.ToSlash(home) + pattern[1:]
+	case strings.HasPrefix(pattern, "./"):
+		pattern = filepath.ToSlash(dir) + pattern[1:]
+	case !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "/"):
+		pattern = "**/" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	return matchGlob(pattern, filepath.ToSlash(filepath.Clean(gitDir)), fold)
+}
+
+// matchGlob matches the given path against a wildmatch pattern, where "*"
+// and "?" do not match "/" and "**" matches any number of directories. A
+// trailing "/**" matches the directory itself too.
+func matchGlob(pattern, path string, fold bool) (bool, error) {
+	var expr string
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case pattern[i:] == "/**":
+			expr += "(/.*)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr += ".*"
+			i++
+		case c == '*':
+			expr += "[^/]*"
+		case c == '?':
+			expr += "[^/]"
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+
+	if fold {
+		expr = "(?i)" + expr
+	}
+
+	return regexp.MatchString("^"+expr+"$", path)
+}
+
+// expandPath expands a leading "~/" to the home directory and resolves the
+// relative paths against dir.
+func expandPath(p, dir string) (string, error) {
+	if strings.HasPrefix(p, "~/") {
+		home, err := homeDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(home, p[2:]), nil
+	}
+
+	if !filepath.IsAbs(p) {
+		return filepath.Join(dir, p), nil
+	}
+
+	return p, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+type IncludeSuite struct{}
+
+var _ = Suite(&IncludeSuite{})
+
+func (s *IncludeSuite) TestExpandIncludes(c *C) {
+	dir := c.MkDir()
+	s.writeFile(c, filepath.Join(dir, "foo"), "[user]\n\tname = foo\n[include]\n\tpath = bar\n")
+	s.writeFile(c, filepath.Join(dir, "bar"), "[user]\n\temail = bar@bar.com\n")
+	s.writeFile(c, filepath.Join(dir, "work"), "[user]\n\temail = work@work.com\n")
+
+	raw := format.New()
+	raw.Section("include").AddOption("path", "foo")
+	raw.Section("include").AddOption("path", "missing")
+	raw.Section("includeIf").Subsection("gitdir:/work/").AddOption("path", "work")
+	raw.Section("includeIf").Subsection("onbranch:qux").AddOption("path", "work")
+
+	cfg, err := ExpandIncludes(raw, dir, &IncludeContext{GitDir: "/home/.git"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Section("user").Option("name"), Equals, "foo")
+	c.Assert(cfg.Section("user").Option("email"), Equals, "bar@bar.com")
+
+	cfg, err = ExpandIncludes(raw, dir, &IncludeContext{GitDir: "/work/foo/.git"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Section("user").Option("email"), Equals, "work@work.com")
+
+	cfg, err = ExpandIncludes(raw, dir, &IncludeContext{Branch: "qux"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Section("user").Option("email"), Equals, "work@work.com")
+}
+
+func (s *IncludeSuite) TestExpandIncludesLoop(c *C) {
+	dir := c.MkDir()
+	s.writeFile(c, filepath.Join(dir, "foo"), "[include]\n\tpath = foo\n")
+
+	raw := format.New()
+	raw.Section("include").AddOption("path", "foo")
+
+	_, err := ExpandIncludes(raw, dir, nil)
+	c.Assert(err, Equals, ErrIncludeDepth)
+}
+
+func (s *IncludeSuite) TestMatchCondition(c *C) {
+	ctx := &IncludeContext{GitDir: "/home/foo/work/repo/.git", Branch: "feature/foo"}
+	for _, t := range []struct {
+		cond string
+		ok   bool
+	}{
+		{"gitdir:/home/foo/work/", true},
+		{"gitdir:/home/foo/work/repo/.git", true},
+		{"gitdir:/home/foo/work/repo/.git/", true},
+		{"gitdir:/home/foo/other/", false},
+		{"gitdir:work/", true},
+		{"gitdir:repo/.git", true},
+		{"gitdir:/home/*/work/**", true},
+		{"gitdir:/HOME/foo/", false},
+		{"gitdir/i:/HOME/foo/", true},
+		{"gitdir:./work/", true},
+		{"onbranch:feature/", true},
+		{"onbranch:feature/*", true},
+		{"onbranch:feature", false},
+		{"onbranch:master", false},
+		{"unknown:foo", false},
+		{"foo", false},
+	} {
+		ok, err := matchCondition(t.cond, "/home/foo", ctx)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, t.ok, Commentf("condition %q", t.cond))
+	}
+}
+
+func (s *IncludeSuite) writeFile(c *C, path, content string) {
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+}
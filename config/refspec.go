@@ -127,6 +127,20 @@ func (s RefSpec) Dst(n plumbing.ReferenceName) plumbing.ReferenceName {
 	return plumbing.ReferenceName(dst[0:wd] + match + dst[wd+1:])
 }
 
+// Reverse returns the refspec with the source and the destination swapped,
+// it matches the destinations of s.
+func (s RefSpec) Reverse() RefSpec {
+	spec := string(s)
+	var force string
+	if s.IsForceUpdate() {
+		force = refSpecForce
+		spec = spec[1:]
+	}
+
+	sep := strings.Index(spec, refSpecSeparator)
+	return RefSpec(force + spec[sep+1:] + refSpecSeparator + spec[:sep])
+}
+
 func (s RefSpec) String() string {
 	return string(s)
 }
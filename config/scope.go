@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+// Scope is the scope of a config file. The options of a scope override the
+// ones of the scopes with a lower value.
+type Scope int
+
+const (
+	// SystemScope is the config of the system, /etc/gitconfig.
+	SystemScope Scope = iota
+	// GlobalScope is the config of the user, $XDG_CONFIG_HOME/git/config and
+	// ~/.gitconfig.
+	GlobalScope
+	// LocalScope is the config of the repository, .git/config.
+	LocalScope
+	// WorktreeScope is the config of the worktree, .git/config.worktree. It
+	// is only used if extensions.worktreeConfig is enabled in the repository,
+	// otherwise it is the same as LocalScope.
+	WorktreeScope
+)
+
+// ErrUnsupportedScope is returned when a scope of a repository is used
+// without one.
+var ErrUnsupportedScope = errors.New("unsupported scope, only the system " +
+	"and global scopes are available without a repository")
+
+func (s Scope) String() string {
+	switch s {
+	case SystemScope:
+		return "system"
+	case GlobalScope:
+		return "global"
+	case LocalScope:
+		return "local"
+	case WorktreeScope:
+		return "worktree"
+	}
+
+	return "unknown"
+}
+
+// Paths returns the paths of the config files of the given system or global
+// scope, in increasing order of precedence, as git does: the system config
+// can be replaced by GIT_CONFIG_SYSTEM or disabled by GIT_CONFIG_NOSYSTEM, and
+// the global config can be replaced by GIT_CONFIG_GLOBAL. The files may not
+// exist.
+func Paths(scope Scope) ([]string, error) {
+	switch scope {
+	case SystemScope:
+		if os.Getenv("GIT_CONFIG_NOSYSTEM") != "" {
+			return nil, nil
+		}
+
+		if p := os.Getenv("GIT_CONFIG_SYSTEM"); p != "" {
+			return []string{p}, nil
+		}
+
+		return []string{"/etc/gitconfig"}, nil
+	case GlobalScope:
+		if p := os.Getenv("GIT_CONFIG_GLOBAL"); p != "" {
+			return []string{p}, nil
+		}
+
+		home, err := homeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			xdg = filepath.Join(home, ".config")
+		}
+
+		return []string{
+			filepath.Join(xdg, "git", "config"),
+			filepath.Join(home, ".gitconfig"),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedScope
+}
+
+// LoadConfig loads the config of the given system or global scope from the
+// files returned by Paths, to be edited and saved with SaveConfig. The include
+// directives are not expanded, see LoadRaw.
+func LoadConfig(scope Scope) (*Config, error) {
+	raw, err := loadRaw(scope, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromRaw(raw)
+}
+
+// LoadRaw returns the raw config of the given system or global scope, with
+// the include directives expanded using the given context.
+func LoadRaw(scope Scope, ctx *IncludeContext) (*format.Config, error) {
+	if ctx == nil {
+		ctx = &IncludeContext{}
+	}
+
+	return loadRaw(scope, ctx)
+}
+
+func loadRaw(scope Scope, ctx *IncludeContext) (*format.Config, error) {
+	paths, err := Paths(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := format.New()
+	for _, p := range paths {
+		file, err := readFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ctx != nil {
+			file, err = ExpandIncludes(file, filepath.Dir(p), ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		Merge(raw, file)
+	}
+
+	return raw, nil
+}
+
+// SaveConfig writes the given config to the file of the given system or
+// global scope: the last existing file returned by Paths, as git does, or
+// the last one if none exists.
+func SaveConfig(scope Scope, c *Config) error {
+	paths, err := Paths(scope)
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		return ErrUnsupportedScope
+	}
+
+	p := paths[len(paths)-1]
+	for i := len(paths) - 1; i >= 0; i-- {
+		if _, err := os.Stat(paths[i]); err == nil {
+			p = paths[i]
+			break
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p, b, 0644)
+}
+
+// Merge appends the options of src to the ones of dst, so the options of src
+// override the ones of dst.
+func Merge(dst, src *format.Config) {
+	for _, s := range src.Sections {
+		ds := dst.Section(s.Name)
+		for _, o := range s.Options {
+			ds.AddOption(o.Key, o.Value)
+		}
+
+		for _, ss := range s.Subsections {
+			dss := ds.Subsection(ss.Name)
+			for _, o := range ss.Options {
+				dss.AddOption(o.Key, o.Value)
+			}
+		}
+	}
+}
+
+// FromRaw returns the Config of the given raw config.
+func FromRaw(raw *format.Config) (*Config, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(raw); err != nil {
+		return nil, err
+	}
+
+	c := NewConfig()
+	if err := c.Unmarshal(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func readFile(p string) (*format.Config, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	raw := format.New()
+	if err := format.NewDecoder(f).Decode(raw); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return u.HomeDir, nil
+}
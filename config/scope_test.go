@@ -0,0 +1,121 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type ScopeSuite struct {
+	env map[string]string
+}
+
+var _ = Suite(&ScopeSuite{})
+
+func (s *ScopeSuite) SetUpTest(c *C) {
+	s.env = make(map[string]string)
+	for _, k := range []string{
+		"HOME", "XDG_CONFIG_HOME", "GIT_CONFIG_GLOBAL",
+		"GIT_CONFIG_SYSTEM", "GIT_CONFIG_NOSYSTEM",
+	} {
+		s.env[k] = os.Getenv(k)
+		os.Setenv(k, "")
+	}
+
+	os.Setenv("HOME", c.MkDir())
+}
+
+func (s *ScopeSuite) TearDownTest(c *C) {
+	for k, v := range s.env {
+		os.Setenv(k, v)
+	}
+}
+
+func (s *ScopeSuite) TestPaths(c *C) {
+	home := os.Getenv("HOME")
+
+	paths, err := Paths(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{
+		filepath.Join(home, ".config", "git", "config"),
+		filepath.Join(home, ".gitconfig"),
+	})
+
+	os.Setenv("XDG_CONFIG_HOME", "/foo")
+	paths, err = Paths(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths[0], Equals, filepath.Join("/foo", "git", "config"))
+
+	os.Setenv("GIT_CONFIG_GLOBAL", "/bar")
+	paths, err = Paths(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"/bar"})
+
+	paths, err = Paths(SystemScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"/etc/gitconfig"})
+
+	os.Setenv("GIT_CONFIG_SYSTEM", "/qux")
+	paths, err = Paths(SystemScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"/qux"})
+
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	paths, err = Paths(SystemScope)
+	c.Assert(err, IsNil)
+	c.Assert(paths, HasLen, 0)
+
+	_, err = Paths(LocalScope)
+	c.Assert(err, Equals, ErrUnsupportedScope)
+}
+
+func (s *ScopeSuite) TestLoadConfig(c *C) {
+	home := os.Getenv("HOME")
+	xdg := filepath.Join(home, ".config", "git", "config")
+	c.Assert(os.MkdirAll(filepath.Dir(xdg), 0755), IsNil)
+
+	err := ioutil.WriteFile(xdg, []byte("[user]\n\tname = foo\n\temail = foo@foo.com\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n\tname = bar\n"), 0644)
+	c.Assert(err, IsNil)
+
+	cfg, err := LoadConfig(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.User.Name, Equals, "bar")
+	c.Assert(cfg.User.Email, Equals, "foo@foo.com")
+}
+
+func (s *ScopeSuite) TestLoadConfigNotFound(c *C) {
+	cfg, err := LoadConfig(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.User.Name, Equals, "")
+}
+
+func (s *ScopeSuite) TestSaveConfig(c *C) {
+	home := os.Getenv("HOME")
+
+	cfg := NewConfig()
+	cfg.User.Name = "foo"
+	c.Assert(SaveConfig(GlobalScope, cfg), IsNil)
+
+	_, err := os.Stat(filepath.Join(home, ".gitconfig"))
+	c.Assert(err, IsNil)
+
+	xdg := filepath.Join(home, ".config", "git", "config")
+	c.Assert(os.MkdirAll(filepath.Dir(xdg), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(xdg, nil, 0644), IsNil)
+	c.Assert(os.Remove(filepath.Join(home, ".gitconfig")), IsNil)
+
+	cfg.User.Name = "bar"
+	c.Assert(SaveConfig(GlobalScope, cfg), IsNil)
+
+	loaded, err := LoadConfig(GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.User.Name, Equals, "bar")
+
+	_, err = os.Stat(filepath.Join(home, ".gitconfig"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+var errURLEmptyName = errors.New("url config: empty name")
+
+// URL contains the rewrite rules of the URLs, the url.<base>.insteadOf and
+// url.<base>.pushInsteadOf options. A URL starting with one of the prefixes
+// has the prefix replaced with the base.
+type URL struct {
+	// Name is the base, the prefix used instead of the matched ones.
+	Name string
+	// InsteadOf are the prefixes replaced with Name, in fetch and push URLs.
+	InsteadOf []string
+	// PushInsteadOf are the prefixes replaced with Name in push URLs only.
+	PushInsteadOf []string
+
+	raw *format.Subsection
+}
+
+// Validate validates the fields of the URL.
+func (u *URL) Validate() error {
+	if u.Name == "" {
+		return errURLEmptyName
+	}
+
+	return nil
+}
+
+func (u *URL) unmarshal(s *format.Subsection) error {
+	u.raw = s
+
+	u.Name = u.raw.Name
+	u.InsteadOf = append([]string(nil), u.raw.Options.GetAll(insteadOfKey)...)
+	u.PushInsteadOf = append([]string(nil), u.raw.Options.GetAll(pushInsteadOfKey)...)
+
+	return u.Validate()
+}
+
+func (u *URL) marshal() *format.Subsection {
+	if u.raw == nil {
+		u.raw = &format.Subsection{}
+	}
+
+	u.raw.Name = u.Name
+	if len(u.InsteadOf) == 0 {
+		u.raw.RemoveOption(insteadOfKey)
+	} else {
+		u.raw.SetOption(insteadOfKey, u.InsteadOf...)
+	}
+
+	if len(u.PushInsteadOf) == 0 {
+		u.raw.RemoveOption(pushInsteadOfKey)
+	} else {
+		u.raw.SetOption(pushInsteadOfKey, u.PushInsteadOf...)
+	}
+
+	return u.raw
+}
+
+// RewriteURL returns the given URL rewritten with the insteadOf rules, as git
+// does for the URLs of the remotes. The longest matching prefix wins, and the
+// URL is returned unchanged if none matches.
+func (c *Config) RewriteURL(url string) string {
+	u, _ := c.rewrite(url, false)
+	return u
+}
+
+// RewritePushURL returns the given URL rewritten for pushing: with the
+// pushInsteadOf rules if any matches, otherwise with the insteadOf ones, see
+// RewriteURL.
+func (c *Config) RewritePushURL(url string) string {
+	if u, ok := c.rewrite(url, true); ok {
+		return u
+	}
+
+	return c.RewriteURL(url)
+}
+
+// rewrite replaces the longest prefix of url matching the insteadOf rules,
+// or the pushInsteadOf ones if push is true, and reports whether one matched.
+func (c *Config) rewrite(url string, push bool) (string, bool) {
+	names := make([]string, 0, len(c.URLs))
+	for name := range c.URLs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var base, prefix string
+	var found bool
+	for _, name := range names {
+		prefixes := c.URLs[name].InsteadOf
+		if push {
+			prefixes = c.URLs[name].PushInsteadOf
+		}
+
+		for _, p := range prefixes {
+			if strings.HasPrefix(url, p) && (!found || len(p) > len(prefix)) {
+				base, prefix, found = name, p, true
+			}
+		}
+	}
+
+	if !found {
+		return url, false
+	}
+
+	return base + url[len(prefix):], true
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type URLSuite struct{}
+
+var _ = Suite(&URLSuite{})
+
+func (s *URLSuite) TestValidateName(c *C) {
+	c.Assert((&URL{Name: "git@github.com:"}).Validate(), IsNil)
+	c.Assert((&URL{}).Validate(), NotNil)
+}
+
+func (s *URLSuite) TestUnmarshal(c *C) {
+	input := []byte(`[url "git@github.com:"]
+	insteadOf = https://github.com/
+	insteadOf = gh:
+	pushInsteadOf = git://github.com/
+`)
+
+	cfg := NewConfig()
+	err := cfg.Unmarshal(input)
+	c.Assert(err, IsNil)
+
+	c.Assert(cfg.URLs, HasLen, 1)
+	u := cfg.URLs["git@github.com:"]
+	c.Assert(u.Name, Equals, "git@github.com:")
+	c.Assert(u.InsteadOf, DeepEquals, []string{"https://github.com/", "gh:"})
+	c.Assert(u.PushInsteadOf, DeepEquals, []string{"git://github.com/"})
+}
+
+func (s *URLSuite) TestMarshal(c *C) {
+	expected := []byte(`[core]
+	bare = false
+[url "git@github.com:"]
+	insteadOf = https://github.com/
+	pushInsteadOf = git://github.com/
+`)
+
+	cfg := NewConfig()
+	cfg.URLs["git@github.com:"] = &URL{
+		Name:          "git@github.com:",
+		InsteadOf:     []string{"https://github.com/"},
+		PushInsteadOf: []string{"git://github.com/"},
+	}
+
+	b, err := cfg.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, string(expected))
+}
+
+func (s *URLSuite) TestRewriteURL(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["git@github.com:"] = &URL{
+		Name:      "git@github.com:",
+		InsteadOf: []string{"https://github.com/"},
+	}
+	cfg.URLs["git@github.com:src-d/"] = &URL{
+		Name:      "git@github.com:src-d/",
+		InsteadOf: []string{"https://github.com/src-d/"},
+	}
+
+	c.Assert(cfg.RewriteURL("https://github.com/foo/bar"), Equals, "git@github.com:foo/bar")
+	c.Assert(cfg.RewriteURL("https://github.com/src-d/go-git"), Equals, "git@github.com:src-d/go-git")
+	c.Assert(cfg.RewriteURL("https://gitlab.com/foo/bar"), Equals, "https://gitlab.com/foo/bar")
+}
+
+func (s *URLSuite) TestRewritePushURL(c *C) {
+	cfg := NewConfig()
+	cfg.URLs["https://github.com/"] = &URL{
+		Name:      "https://github.com/",
+		InsteadOf: []string{"gh:"},
+	}
+	cfg.URLs["git@github.com:"] = &URL{
+		Name:          "git@github.com:",
+		PushInsteadOf: []string{"https://github.com/"},
+	}
+
+	c.Assert(cfg.RewriteURL("gh:foo/bar"), Equals, "https://github.com/foo/bar")
+	c.Assert(cfg.RewritePushURL("gh:foo/bar"), Equals, "https://github.com/foo/bar")
+	c.Assert(cfg.RewriteURL("https://github.com/foo/bar"), Equals, "https://github.com/foo/bar")
+	c.Assert(cfg.RewritePushURL("https://github.com/foo/bar"), Equals, "git@github.com:foo/bar")
+}
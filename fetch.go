@@ -0,0 +1,12 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// FetchResult is the result of a fetch.
+type FetchResult struct {
+	// Pruned are the local references removed because their remote
+	// reference no longer exists, see FetchOptions.Prune.
+	Pruned []plumbing.ReferenceName
+}
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/openpgp"
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/archive"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 )
@@ -28,7 +31,8 @@ const (
 )
 
 var (
-	ErrMissingURL = errors.New("URL field is required")
+	ErrMissingURL             = errors.New("URL field is required")
+	ErrShallowOptionsConflict = errors.New("only one of Depth, Deepen, ShallowSince, ShallowExclude and Unshallow can be set")
 )
 
 // CloneOptions describes how a clone should be performed.
@@ -47,6 +51,17 @@ type CloneOptions struct {
 	NoCheckout bool
 	// Limit fetching to the specified number of commits.
 	Depth int
+	// ShallowSince limits fetching to the commits more recent than the given
+	// time.
+	ShallowSince time.Time
+	// ShallowExclude limits fetching to the commits not reachable from any of
+	// the given remote branches or tags.
+	ShallowExclude []string
+	// Filter omits from the clone the objects not matching the given filter,
+	// creating a partial clone. The omitted objects are fetched from the
+	// remote when they are needed, with Auth. Once the repository is opened
+	// again, the credentials are set with Repository.SetPromisorAuth.
+	Filter packp.Filter
 	// RecurseSubmodules after the clone is created, initialize all submodules
 	// within, using their default settings. This option is ignored if the
 	// cloned repository does not have a worktree.
@@ -55,9 +70,15 @@ type CloneOptions struct {
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
 	Progress sideband.Progress
+	// ProgressHandler receives the progress events of the operation, the
+	// ones reported by the server and the ones of the local work.
+	ProgressHandler plumbing.ProgressHandler
 	// Tags describe how the tags will be fetched from the remote repository,
 	// by default is AllTags.
 	Tags TagMode
+	// LoadGlobalConfig uses the system and global config scopes to clone and
+	// in the returned repository, see Repository.LoadGlobalConfig.
+	LoadGlobalConfig bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -78,7 +99,7 @@ func (o *CloneOptions) Validate() error {
 		o.Tags = AllTags
 	}
 
-	return nil
+	return validateShallowOptions(o.Depth, 0, o.ShallowSince, o.ShallowExclude, false)
 }
 
 // PullOptions describes how a pull should be performed.
@@ -100,6 +121,9 @@ type PullOptions struct {
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
 	Progress sideband.Progress
+	// ProgressHandler receives the progress events of the operation, the
+	// ones reported by the server and the ones of the local work.
+	ProgressHandler plumbing.ProgressHandler
 	// Force allows the pull to update a local branch even when the remote
 	// branch does not descend from it.
 	Force bool
@@ -141,18 +165,45 @@ type FetchOptions struct {
 	// Depth limit fetching to the specified number of commits from the tip of
 	// each remote branch history.
 	Depth int
+	// Deepen the history of a shallow repository by the specified number of
+	// commits, counted from its current shallow boundary.
+	Deepen int
+	// ShallowSince limits fetching to the commits more recent than the given
+	// time.
+	ShallowSince time.Time
+	// ShallowExclude limits fetching to the commits not reachable from any of
+	// the given remote branches or tags.
+	ShallowExclude []string
+	// Unshallow fetches the whole history of a shallow repository.
+	Unshallow bool
+	// Filter omits the objects not matching the given filter. If empty, the
+	// partial clone filter of the remote is used.
+	Filter packp.Filter
 	// Auth credentials, if required, to use with the remote repository.
 	Auth transport.AuthMethod
 	// Progress is where the human readable information sent by the server is
 	// stored, if nil nothing is stored and the capability (if supported)
 	// no-progress, is sent to the server to avoid send this information.
 	Progress sideband.Progress
+	// ProgressHandler receives the progress events of the operation, the
+	// ones reported by the server and the ones of the local work.
+	ProgressHandler plumbing.ProgressHandler
 	// Tags describe how the tags will be fetched from the remote repository,
-	// by default is TagFollowing.
+	// by default is TagFollowing, or the tagOpt of the remote if set.
 	Tags TagMode
 	// Force allows the fetch to update a local branch even when the remote
 	// branch does not descend from it.
 	Force bool
+	// Prune removes the local references matching the destinations of the
+	// refspecs whose remote reference no longer exists. If unset, the prune
+	// option of the remote or, if unset too, fetch.prune of the config is
+	// used.
+	Prune config.OptBool
+	// PruneTags removes, when pruning, the local tags which no longer exist
+	// in the remote, fetching all the remote tags as the
+	// refs/tags/*:refs/tags/* refspec does. If unset, the pruneTags option of
+	// the remote or, if unset too, fetch.pruneTags of the config is used.
+	PruneTags config.OptBool
 }
 
 // Validate validates the fields and sets the default values.
@@ -171,6 +222,30 @@ func (o *FetchOptions) Validate() error {
 		}
 	}
 
+	return validateShallowOptions(o.Depth, o.Deepen, o.ShallowSince, o.ShallowExclude, o.Unshallow)
+}
+
+// isShallow returns true if any of the options limiting the history to fetch
+// is set.
+func (o *FetchOptions) isShallow() bool {
+	return o.Depth != 0 || o.Deepen != 0 || !o.ShallowSince.IsZero() ||
+		len(o.ShallowExclude) != 0 || o.Unshallow
+}
+
+func validateShallowOptions(depth, deepen int, since time.Time, exclude []string, unshallow bool) error {
+	var n int
+	for _, set := range []bool{
+		depth != 0, deepen != 0, !since.IsZero(), len(exclude) != 0, unshallow,
+	} {
+		if set {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return ErrShallowOptionsConflict
+	}
+
 	return nil
 }
 
@@ -180,12 +255,36 @@ type PushOptions struct {
 	RemoteName string
 	// RefSpecs specify what destination ref to update with what source
 	// object. A refspec with empty src can be used to delete a reference.
+	// If empty, all the references are pushed to a mirror remote, otherwise
+	// the push refspecs of the remote are used, or DefaultPushRefSpec.
 	RefSpecs []config.RefSpec
 	// Auth credentials, if required, to use with the remote repository.
 	Auth transport.AuthMethod
 	// Progress is where the human readable information sent by the server is
 	// stored, if nil nothing is stored.
 	Progress sideband.Progress
+	// ProgressHandler receives the progress events of the push, the ones
+	// reported by the server and the ones of the packfile written.
+	ProgressHandler plumbing.ProgressHandler
+	// Atomic requests the server to update all the references or none of
+	// them, the server must support the atomic capability.
+	Atomic bool
+	// Options are the push options transmitted to the server, they are
+	// available to its hooks. The server must support the push-options
+	// capability.
+	Options []string
+	// ForceWithLease allows to overwrite the remote references, even if the
+	// update is not a fast-forward, as long as they have the expected value.
+	ForceWithLease *ForceWithLease
+}
+
+// ForceWithLease sets the values the remote references are expected to have
+// when they are overwritten by a push.
+type ForceWithLease struct {
+	// Expected maps remote reference names to their expected values, a zero
+	// hash means the reference must not exist. The references not present
+	// are expected to have the value of their remote-tracking reference.
+	Expected map[plumbing.ReferenceName]plumbing.Hash
 }
 
 // Validate validates the fields and sets the default values.
@@ -194,12 +293,6 @@ func (o *PushOptions) Validate() error {
 		o.RemoteName = DefaultRemoteName
 	}
 
-	if len(o.RefSpecs) == 0 {
-		o.RefSpecs = []config.RefSpec{
-			config.RefSpec(config.DefaultPushRefSpec),
-		}
-	}
-
 	for _, r := range o.RefSpecs {
 		if err := r.Validate(); err != nil {
 			return err
@@ -242,6 +335,8 @@ type CheckoutOptions struct {
 	// Force, if true when switching branches, proceed even if the index or the
 	// working tree differs from HEAD. This is used to throw away local changes
 	Force bool
+	// ProgressHandler receives the progress events of the files updated.
+	ProgressHandler plumbing.ProgressHandler
 }
 
 // Validate validates the fields and sets the default values.
@@ -346,7 +441,9 @@ type CommitOptions struct {
 	// All automatically stage files that have been modified and deleted, but
 	// new files you have not told Git about are not affected.
 	All bool
-	// Author is the author's signature of the commit.
+	// Author is the author's signature of the commit. If Author is nil the
+	// user.name and user.email of the merged config of the repository are
+	// used, see Repository.MergedConfig.
 	Author *object.Signature
 	// Committer is the committer's signature of the commit. If Committer is
 	// nil the Author signature is used.
@@ -363,7 +460,9 @@ type CommitOptions struct {
 // Validate validates the fields and sets the default values.
 func (o *CommitOptions) Validate(r *Repository) error {
 	if o.Author == nil {
-		return ErrMissingAuthor
+		if err := o.loadConfigAuthor(r); err != nil {
+			return err
+		}
 	}
 
 	if o.Committer == nil {
@@ -384,6 +483,25 @@ func (o *CommitOptions) Validate(r *Repository) error {
 	return nil
 }
 
+func (o *CommitOptions) loadConfigAuthor(r *Repository) error {
+	cfg, err := r.MergedConfig()
+	if err != nil {
+		return err
+	}
+
+	if cfg.User.Name == "" || cfg.User.Email == "" {
+		return ErrMissingAuthor
+	}
+
+	o.Author = &object.Signature{
+		Name:  cfg.User.Name,
+		Email: cfg.User.Email,
+		When:  time.Now(),
+	}
+
+	return nil
+}
+
 var (
 	ErrMissingName    = errors.New("name field is required")
 	ErrMissingTagger  = errors.New("tagger field is required")
@@ -467,6 +585,106 @@ func (o *GrepOptions) Validate(w *Worktree) error {
 	return nil
 }
 
+// StatusOptions describes how a status should be computed.
+type StatusOptions struct {
+	// DiffTree are the options of the comparison of HEAD with the staging
+	// area, the staged renames and copies detected are reported as Renamed
+	// and Copied files. If nil, object.DefaultDiffTreeOptions are used.
+	DiffTree *object.DiffTreeOptions
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StatusOptions) Validate() error {
+	if o.DiffTree == nil {
+		o.DiffTree = object.DefaultDiffTreeOptions
+	}
+
+	return nil
+}
+
+// ArchiveOptions describes how an archive should be created.
+type ArchiveOptions struct {
+	// Tree is the hash of the tree to archive, or of a commit or an
+	// annotated tag pointing to it. If empty, the commit pointed by HEAD is
+	// used.
+	Tree plumbing.Hash
+	// Format is the format of the archive, tar if empty.
+	Format archive.Format
+	// Prefix is prepended to the path of every file in the archive.
+	Prefix string
+	// Paths restricts the archive to the given files and directories.
+	Paths []string
+	// Submodules includes the content of the initialized submodules of the
+	// worktree, at the commits recorded in the tree.
+	Submodules bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ArchiveOptions) Validate(r *Repository) error {
+	if o.Tree.IsZero() {
+		ref, err := r.Head()
+		if err != nil {
+			return err
+		}
+
+		o.Tree = ref.Hash()
+	}
+
+	if o.Format == "" {
+		o.Format = archive.Tar
+	}
+
+	return nil
+}
+
+// ApplyOptions describes how a patch should be applied.
+type ApplyOptions struct {
+	// Check only checks that the patch applies, the worktree and the index
+	// are not changed, as the --check option of git apply.
+	Check bool
+	// Index applies the patch to the worktree and to the index, the patched
+	// files must be the same in both, as the --index option of git apply.
+	Index bool
+	// Cached applies the patch to the index only, the worktree is not
+	// changed, as the --cached option of git apply.
+	Cached bool
+	// ThreeWay merges the changes of the patch with the ones of the files
+	// when the blobs of its index lines are in the repository, as the --3way
+	// option of git apply. The conflicts are left between conflict markers
+	// in the worktree and at their stages in the index. It implies Index,
+	// unless Cached is set.
+	ThreeWay bool
+	// Fuzz is the number of context lines that can be ignored at the start
+	// and at the end of a hunk that does not apply with all of them.
+	Fuzz int
+	// Reject applies the hunks that apply even if others do not, these ones
+	// being written to <file>.rej files, as the --reject option of git
+	// apply. Without it, nothing is applied if a hunk does not apply.
+	Reject bool
+}
+
+var (
+	ErrApplyThreeWayReject = errors.New("reject and three-way options can not be used together")
+	ErrApplyNegativeFuzz   = errors.New("fuzz can not be negative")
+)
+
+// Validate validates the fields and sets the default values.
+func (o *ApplyOptions) Validate() error {
+	if o.ThreeWay && o.Reject {
+		return ErrApplyThreeWayReject
+	}
+
+	if o.Fuzz < 0 {
+		return ErrApplyNegativeFuzz
+	}
+
+	if o.ThreeWay && !o.Cached {
+		o.Index = true
+	}
+
+	return nil
+}
+
 // PlainOpenOptions describes how opening a plain repository should be
 // performed.
 type PlainOpenOptions struct {
@@ -3,6 +3,7 @@ package git
 import (
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
 type OptionsSuite struct {
@@ -19,11 +20,34 @@ func (s *OptionsSuite) TestCommitOptionsParentsFromHEAD(c *C) {
 }
 
 func (s *OptionsSuite) TestCommitOptionsMissingAuthor(c *C) {
+	defer IsolateConfig(c)()
+
 	o := CommitOptions{}
 	err := o.Validate(s.Repository)
 	c.Assert(err, Equals, ErrMissingAuthor)
 }
 
+func (s *OptionsSuite) TestCommitOptionsAuthorFromConfig(c *C) {
+	defer IsolateConfig(c)()
+
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+
+	cfg.User.Name = "foo"
+	cfg.User.Email = "foo@foo.com"
+	c.Assert(r.Storer.SetConfig(cfg), IsNil)
+
+	o := CommitOptions{}
+	err = o.Validate(r)
+	c.Assert(err, IsNil)
+	c.Assert(o.Author.Name, Equals, "foo")
+	c.Assert(o.Author.Email, Equals, "foo@foo.com")
+	c.Assert(o.Committer, Equals, o.Author)
+}
+
 func (s *OptionsSuite) TestCommitOptionsCommitter(c *C) {
 	sig := &object.Signature{}
 
@@ -0,0 +1,356 @@
+// Package archive implements writing the content of a tree as a tar, gzipped
+// tar or zip archive, in the same way as the git-archive command.
+//
+// The gitattributes files of the tree are honored: the paths with the
+// export-ignore attribute are not written, and the $Format:...$ placeholders
+// of the files with the export-subst attribute are expanded with the
+// information of the archived commit.
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitattributes"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Format is the format of an archive.
+type Format string
+
+const (
+	// Tar is the tar format, with a pax global header recording the
+	// commit ID.
+	Tar Format = "tar"
+	// TarGzip is the tar format compressed with gzip.
+	TarGzip Format = "tar.gz"
+	// Zip is the zip format, with the commit ID as the archive comment.
+	Zip Format = "zip"
+)
+
+const (
+	exportIgnoreAttribute = "export-ignore"
+	exportSubstAttribute  = "export-subst"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when the format of an archive is
+	// unknown.
+	ErrUnsupportedFormat = errors.New("archive: unsupported format")
+	// ErrPathNotFound is returned when a path of the Options is not found in
+	// the tree.
+	ErrPathNotFound = errors.New("archive: path not found")
+)
+
+// FormatFromName returns the format matching the extension of the given file
+// name: .tar, .tar.gz, .tgz or .zip.
+func FormatFromName(name string) (Format, bool) {
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGzip, true
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, true
+	default:
+		return "", false
+	}
+}
+
+// SubmoduleResolver returns the commit a submodule at the given path points
+// to, and the resolver of the submodules of the submodule. The path is
+// relative to the root of the repository containing the submodule.
+type SubmoduleResolver func(path string, h plumbing.Hash) (*object.Commit, SubmoduleResolver, error)
+
+// Options are the options of an archive.
+type Options struct {
+	// Format is the format of the archive, Tar if empty.
+	Format Format
+	// Prefix is prepended to the path of every file in the archive, usually
+	// a directory name ending with a slash.
+	Prefix string
+	// Paths restricts the archive to the given paths of the tree, files or
+	// directories.
+	Paths []string
+	// Commit is the commit of the tree, if any. Its ID is recorded in the
+	// archive, its committer time is used as the modification time of the
+	// files and its information is used to expand the export-subst files.
+	Commit *object.Commit
+	// ModTime is the modification time of the files if there is no Commit,
+	// the current time if zero.
+	ModTime time.Time
+	// Submodules resolves the submodules to include their content in the
+	// archive. If nil, the submodules are written as empty directories.
+	Submodules SubmoduleResolver
+}
+
+// An Encoder writes archives to an output stream.
+type Encoder struct {
+	w io.Writer
+	o *Options
+}
+
+// NewEncoder returns a new encoder writing to w with the given options.
+func NewEncoder(w io.Writer, o *Options) *Encoder {
+	if o == nil {
+		o = &Options{}
+	}
+
+	return &Encoder{w: w, o: o}
+}
+
+// Encode writes an archive of the tree t.
+func (e *Encoder) Encode(t *object.Tree) error {
+	w, err := newWriter(e.w, e.o)
+	if err != nil {
+		return err
+	}
+
+	if err := e.encode(w, t); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+func (e *Encoder) encode(w writer, t *object.Tree) error {
+	mtime := e.o.ModTime
+	if e.o.Commit != nil {
+		mtime = e.o.Commit.Committer.When
+	} else if mtime.IsZero() {
+		mtime = time.Now()
+	}
+
+	wk := &walker{
+		w:       w,
+		prefix:  e.o.Prefix,
+		mtime:   mtime,
+		matched: make([]bool, len(e.o.Paths)),
+	}
+
+	for _, p := range e.o.Paths {
+		wk.paths = append(wk.paths, strings.Trim(path.Clean(p), "/"))
+	}
+
+	if strings.HasSuffix(e.o.Prefix, "/") {
+		if err := w.writeDir(e.o.Prefix, mtime); err != nil {
+			return err
+		}
+	}
+
+	if err := wk.walk(t, e.o.Commit, e.o.Submodules, nil, nil, nil); err != nil {
+		return err
+	}
+
+	for i, matched := range wk.matched {
+		if !matched {
+			return fmt.Errorf("%s: %s", ErrPathNotFound, e.o.Paths[i])
+		}
+	}
+
+	return nil
+}
+
+// ResolveTree returns the tree with the given hash, or the one of the given
+// commit or annotated tag along with the commit.
+func ResolveTree(s storer.EncodedObjectStorer, h plumbing.Hash) (*object.Tree, *object.Commit, error) {
+	obj, err := object.GetObject(s, h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		switch o := obj.(type) {
+		case *object.Tag:
+			if obj, err = o.Object(); err != nil {
+				return nil, nil, err
+			}
+		case *object.Commit:
+			tree, err := o.Tree()
+			return tree, o, err
+		case *object.Tree:
+			return o, nil, nil
+		default:
+			return nil, nil, plumbing.ErrInvalidType
+		}
+	}
+}
+
+type walker struct {
+	w       writer
+	prefix  string
+	mtime   time.Time
+	paths   []string
+	matched []bool
+}
+
+// walk writes the entries of the tree t, at the given path of the archive.
+// The path relative to the root of the repository of the tree, rel, differs
+// from it in submodules.
+func (wk *walker) walk(t *object.Tree, c *object.Commit, submodules SubmoduleResolver,
+	dir, rel []string, stack []gitattributes.MatchAttribute) error {
+	attrs, err := readAttributes(t, rel)
+	if err != nil {
+		return err
+	}
+
+	stack = append(stack[:len(stack):len(stack)], attrs...)
+	m := gitattributes.NewMatcher(stack)
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		path := append(dir[:len(dir):len(dir)], e.Name)
+		relPath := append(rel[:len(rel):len(rel)], e.Name)
+		name := strings.Join(path, "/")
+
+		isDir := e.Mode == filemode.Dir || e.Mode == filemode.Submodule
+		include, descend := wk.filter(name, isDir)
+		if !include && !descend {
+			continue
+		}
+
+		a := m.Match(relPath, []string{exportIgnoreAttribute, exportSubstAttribute})
+		if a[exportIgnoreAttribute].IsSet() {
+			continue
+		}
+
+		if err := wk.write(t, e, c, submodules, path, relPath, stack,
+			a[exportSubstAttribute].IsSet()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (wk *walker) write(t *object.Tree, e *object.TreeEntry, c *object.Commit,
+	submodules SubmoduleResolver, path, rel []string,
+	stack []gitattributes.MatchAttribute, subst bool) error {
+	name := wk.prefix + strings.Join(path, "/")
+	switch e.Mode {
+	case filemode.Dir:
+		if err := wk.w.writeDir(name+"/", wk.mtime); err != nil {
+			return err
+		}
+
+		sub, err := t.Tree(e.Name)
+		if err != nil {
+			return err
+		}
+
+		return wk.walk(sub, c, submodules, path, rel, stack)
+	case filemode.Submodule:
+		if err := wk.w.writeDir(name+"/", wk.mtime); err != nil {
+			return err
+		}
+
+		if submodules == nil {
+			return nil
+		}
+
+		sc, next, err := submodules(strings.Join(rel, "/"), e.Hash)
+		if err != nil {
+			return err
+		}
+
+		sub, err := sc.Tree()
+		if err != nil {
+			return err
+		}
+
+		return wk.walk(sub, sc, next, path, nil, nil)
+	}
+
+	f, err := t.TreeEntryFile(e)
+	if err != nil {
+		return err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if e.Mode == filemode.Symlink {
+		target, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		return wk.w.writeSymlink(name, string(target), wk.mtime)
+	}
+
+	size := f.Size
+	var content io.Reader = r
+	if subst && c != nil {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		b = expandPlaceholders(b, c)
+		size, content = int64(len(b)), bytes.NewReader(b)
+	}
+
+	return wk.w.writeFile(name, e.Mode, size, content, wk.mtime)
+}
+
+// filter returns whether the given path is included in the archive, or is
+// a directory containing included paths.
+func (wk *walker) filter(name string, isDir bool) (include, descend bool) {
+	if len(wk.paths) == 0 {
+		return true, false
+	}
+
+	for i, p := range wk.paths {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			wk.matched[i] = true
+			include = true
+		}
+
+		if isDir && strings.HasPrefix(p, name+"/") {
+			descend = true
+		}
+	}
+
+	return include, descend
+}
+
+func readAttributes(t *object.Tree, domain []string) ([]gitattributes.MatchAttribute, error) {
+	e, err := t.FindEntry(gitattributes.File)
+	if err == object.ErrEntryNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.Mode.IsFile() || e.Mode == filemode.Symlink {
+		return nil, nil
+	}
+
+	f, err := t.TreeEntryFile(e)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return gitattributes.ReadAttributes(r, domain)
+}
@@ -0,0 +1,356 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ArchiveSuite struct {
+	fixtures.Suite
+}
+
+var _ = Suite(&ArchiveSuite{})
+
+type entry struct {
+	name    string
+	mode    int64
+	content string
+	link    string
+}
+
+func (s *ArchiveSuite) basicCommit(c *C) *object.Commit {
+	sto := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	commit, err := object.GetCommit(sto,
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	return commit
+}
+
+func readTar(c *C, r io.Reader) ([]entry, map[string]string) {
+	var entries []entry
+	var global map[string]string
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			global = h.PAXRecords
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		c.Assert(err, IsNil)
+		entries = append(entries, entry{h.Name, h.Mode, string(content), h.Linkname})
+	}
+
+	return entries, global
+}
+
+func names(entries []entry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.name)
+	}
+
+	return result
+}
+
+func (s *ArchiveSuite) TestEncodeTar(c *C) {
+	commit := s.basicCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf, &Options{Prefix: "basic/", Commit: commit}).Encode(tree)
+	c.Assert(err, IsNil)
+
+	entries, global := readTar(c, buf)
+	c.Assert(global, DeepEquals, map[string]string{
+		"comment": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+
+	c.Assert(names(entries), DeepEquals, []string{
+		"basic/",
+		"basic/.gitignore",
+		"basic/CHANGELOG",
+		"basic/LICENSE",
+		"basic/binary.jpg",
+		"basic/go/",
+		"basic/go/example.go",
+		"basic/json/",
+		"basic/json/long.json",
+		"basic/json/short.json",
+		"basic/php/",
+		"basic/php/crappy.php",
+		"basic/vendor/",
+		"basic/vendor/foo.go",
+	})
+
+	c.Assert(entries[0].mode, Equals, int64(0775))
+	c.Assert(entries[2].mode, Equals, int64(0664))
+	c.Assert(entries[2].content, Equals, "Initial changelog\n")
+}
+
+func (s *ArchiveSuite) TestEncodeTarGzip(c *C) {
+	commit := s.basicCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf, &Options{Format: TarGzip}).Encode(tree)
+	c.Assert(err, IsNil)
+
+	gz, err := gzip.NewReader(buf)
+	c.Assert(err, IsNil)
+
+	entries, global := readTar(c, gz)
+	c.Assert(global, IsNil)
+	c.Assert(entries, HasLen, 13)
+}
+
+func (s *ArchiveSuite) TestEncodeZip(c *C) {
+	commit := s.basicCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf, &Options{Format: Zip, Commit: commit}).Encode(tree)
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(zr.File, HasLen, 13)
+
+	f := zr.File[1]
+	c.Assert(f.Name, Equals, "CHANGELOG")
+	c.Assert(f.Mode().Perm(), Equals, os.FileMode(0644))
+	c.Assert(f.Modified.Unix(), Equals, commit.Committer.When.Unix())
+
+	r, err := f.Open()
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "Initial changelog\n")
+	c.Assert(zr.File[4].Mode().IsDir(), Equals, true)
+}
+
+func (s *ArchiveSuite) TestEncodeUnsupportedFormat(c *C) {
+	commit := s.basicCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	err = NewEncoder(ioutil.Discard, &Options{Format: "rar"}).Encode(tree)
+	c.Assert(err, Equals, ErrUnsupportedFormat)
+}
+
+func (s *ArchiveSuite) TestEncodePaths(c *C) {
+	commit := s.basicCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf, &Options{
+		Paths: []string{"go/", "json/long.json"},
+	}).Encode(tree)
+	c.Assert(err, IsNil)
+
+	entries, _ := readTar(c, buf)
+	c.Assert(names(entries), DeepEquals, []string{
+		"go/",
+		"go/example.go",
+		"json/",
+		"json/long.json",
+	})
+
+	err = NewEncoder(ioutil.Discard, &Options{
+		Paths: []string{"go", "missing"},
+	}).Encode(tree)
+	c.Assert(err, ErrorMatches, ".*path not found: missing")
+}
+
+func (s *ArchiveSuite) TestFormatFromName(c *C) {
+	for name, format := range map[string]Format{
+		"v1.0.tar":    Tar,
+		"v1.0.tar.gz": TarGzip,
+		"v1.0.tgz":    TarGzip,
+		"v1.0.zip":    Zip,
+	} {
+		f, ok := FormatFromName(name)
+		c.Assert(ok, Equals, true)
+		c.Assert(f, Equals, format)
+	}
+
+	_, ok := FormatFromName("v1.0.rar")
+	c.Assert(ok, Equals, false)
+}
+
+// memoryRepository builds trees and commits in a memory storage.
+type memoryRepository struct {
+	c *C
+	s *memory.Storage
+}
+
+func (r *memoryRepository) blob(content string) plumbing.Hash {
+	o := r.s.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	r.c.Assert(err, IsNil)
+	_, err = io.WriteString(w, content)
+	r.c.Assert(err, IsNil)
+	r.c.Assert(w.Close(), IsNil)
+	return r.store(o)
+}
+
+func (r *memoryRepository) tree(entries ...object.TreeEntry) plumbing.Hash {
+	o := r.s.NewEncodedObject()
+	r.c.Assert((&object.Tree{Entries: entries}).Encode(o), IsNil)
+	return r.store(o)
+}
+
+func (r *memoryRepository) commit(tree plumbing.Hash, msg string) *object.Commit {
+	sig := object.Signature{
+		Name:  "John Doe",
+		Email: "john@doe.org",
+		When:  time.Unix(1500000000, 0).UTC(),
+	}
+
+	o := r.s.NewEncodedObject()
+	c := &object.Commit{Author: sig, Committer: sig, Message: msg, TreeHash: tree}
+	r.c.Assert(c.Encode(o), IsNil)
+
+	commit, err := object.GetCommit(r.s, r.store(o))
+	r.c.Assert(err, IsNil)
+	return commit
+}
+
+func (r *memoryRepository) store(o plumbing.EncodedObject) plumbing.Hash {
+	h, err := r.s.SetEncodedObject(o)
+	r.c.Assert(err, IsNil)
+	return h
+}
+
+func (s *ArchiveSuite) TestEncodeAttributes(c *C) {
+	r := &memoryRepository{c, memory.NewStorage()}
+	docs := r.tree(
+		object.TreeEntry{Name: "index.md", Mode: filemode.Regular, Hash: r.blob("docs\n")},
+	)
+	sub := r.tree(
+		object.TreeEntry{Name: ".gitattributes", Mode: filemode.Regular,
+			Hash: r.blob("*.txt export-ignore\n")},
+		object.TreeEntry{Name: "keep.md", Mode: filemode.Regular, Hash: r.blob("keep\n")},
+		object.TreeEntry{Name: "notes.txt", Mode: filemode.Regular, Hash: r.blob("notes\n")},
+	)
+	tree := r.tree(
+		object.TreeEntry{Name: ".gitattributes", Mode: filemode.Regular,
+			Hash: r.blob("docs export-ignore\nVERSION export-subst\n")},
+		object.TreeEntry{Name: "VERSION", Mode: filemode.Regular,
+			Hash: r.blob("$Format:%h %an <%ae>$ $Format:%s$ $Unknown$\n")},
+		object.TreeEntry{Name: "docs", Mode: filemode.Dir, Hash: docs},
+		object.TreeEntry{Name: "link", Mode: filemode.Symlink, Hash: r.blob("run.sh")},
+		object.TreeEntry{Name: "run.sh", Mode: filemode.Executable, Hash: r.blob("#!/bin/sh\n")},
+		object.TreeEntry{Name: "sub", Mode: filemode.Dir, Hash: sub},
+	)
+
+	commit := r.commit(tree, "release\nv1.0\n\nbody\n")
+	t, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf, &Options{Commit: commit}).Encode(t), IsNil)
+
+	entries, _ := readTar(c, buf)
+	c.Assert(names(entries), DeepEquals, []string{
+		".gitattributes",
+		"VERSION",
+		"link",
+		"run.sh",
+		"sub/",
+		"sub/.gitattributes",
+		"sub/keep.md",
+	})
+
+	c.Assert(entries[1].content, Equals,
+		commit.Hash.String()[:7]+" John Doe <john@doe.org> release v1.0 $Unknown$\n")
+	c.Assert(entries[2].link, Equals, "run.sh")
+	c.Assert(entries[2].mode, Equals, int64(0777))
+	c.Assert(entries[3].mode, Equals, int64(0775))
+}
+
+func (s *ArchiveSuite) TestEncodeSubmodules(c *C) {
+	sr := &memoryRepository{c, memory.NewStorage()}
+	subCommit := sr.commit(sr.tree(
+		object.TreeEntry{Name: "lib.go", Mode: filemode.Regular, Hash: sr.blob("package lib\n")},
+	), "lib\n")
+
+	r := &memoryRepository{c, memory.NewStorage()}
+	tree := r.tree(
+		object.TreeEntry{Name: "README", Mode: filemode.Regular, Hash: r.blob("readme\n")},
+		object.TreeEntry{Name: "lib", Mode: filemode.Submodule, Hash: subCommit.Hash},
+	)
+
+	commit := r.commit(tree, "main\n")
+	t, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf, &Options{Commit: commit}).Encode(t), IsNil)
+
+	entries, _ := readTar(c, buf)
+	c.Assert(names(entries), DeepEquals, []string{"README", "lib/"})
+
+	var resolved []string
+	buf.Reset()
+	err = NewEncoder(buf, &Options{
+		Commit: commit,
+		Submodules: func(path string, h plumbing.Hash) (*object.Commit, SubmoduleResolver, error) {
+			resolved = append(resolved, path)
+			c.Assert(h, Equals, subCommit.Hash)
+			return subCommit, nil, nil
+		},
+	}).Encode(t)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, DeepEquals, []string{"lib"})
+
+	entries, _ = readTar(c, buf)
+	c.Assert(names(entries), DeepEquals, []string{"README", "lib/", "lib/lib.go"})
+	c.Assert(entries[2].content, Equals, "package lib\n")
+}
+
+func (s *ArchiveSuite) TestFormatCommit(c *C) {
+	r := &memoryRepository{c, memory.NewStorage()}
+	commit := r.commit(r.tree(), "subject\n\nbody\n")
+
+	c.Assert(formatCommit("%H", commit), Equals, commit.Hash.String())
+	c.Assert(formatCommit("%T", commit), Equals, commit.TreeHash.String())
+	c.Assert(formatCommit("%an|%ae|%at", commit), Equals, "John Doe|john@doe.org|1500000000")
+	c.Assert(formatCommit("%cd", commit), Equals, "Fri Jul 14 02:40:00 2017 +0000")
+	c.Assert(formatCommit("%cI", commit), Equals, "2017-07-14T02:40:00Z")
+	c.Assert(formatCommit("%s%n%b", commit), Equals, "subject\nbody\n")
+	c.Assert(formatCommit("100%% %x %", commit), Equals, "100% %x %")
+	c.Assert(strings.Count(formatCommit("%P", commit), " "), Equals, 0)
+}
@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	placeholderStart = []byte("$Format:")
+	placeholderEnd   = []byte("$")
+)
+
+const (
+	abbrevLength = 7
+
+	defaultDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+	rfc2822DateFormat = "Mon, 2 Jan 2006 15:04:05 -0700"
+	isoDateFormat     = "2006-01-02 15:04:05 -0700"
+)
+
+// expandPlaceholders replaces the $Format:...$ placeholders of b with the
+// information of the commit c, as git-log --pretty=format does.
+func expandPlaceholders(b []byte, c *object.Commit) []byte {
+	var buf bytes.Buffer
+	for {
+		i := bytes.Index(b, placeholderStart)
+		if i < 0 {
+			break
+		}
+
+		j := bytes.Index(b[i+len(placeholderStart):], placeholderEnd)
+		if j < 0 {
+			break
+		}
+
+		format := string(b[i+len(placeholderStart) : i+len(placeholderStart)+j])
+		buf.Write(b[:i])
+		buf.WriteString(formatCommit(format, c))
+		b = b[i+len(placeholderStart)+j+len(placeholderEnd):]
+	}
+
+	buf.Write(b)
+	return buf.Bytes()
+}
+
+// formatCommit expands the placeholders of the git-log pretty formats
+// supported: hashes, names, emails, dates, subject and body. The unknown
+// placeholders are kept as they are.
+func formatCommit(format string, c *object.Commit) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		n, ok := formatPlaceholder(&b, format[i+1:], c)
+		if !ok {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i += n
+	}
+
+	return b.String()
+}
+
+func formatPlaceholder(b *strings.Builder, p string, c *object.Commit) (int, bool) {
+	switch p[0] {
+	case '%':
+		b.WriteByte('%')
+	case 'n':
+		b.WriteByte('\n')
+	case 'H':
+		b.WriteString(c.Hash.String())
+	case 'h':
+		b.WriteString(c.Hash.String()[:abbrevLength])
+	case 'T':
+		b.WriteString(c.TreeHash.String())
+	case 't':
+		b.WriteString(c.TreeHash.String()[:abbrevLength])
+	case 'P', 'p':
+		for i, h := range c.ParentHashes {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+
+			if p[0] == 'p' {
+				b.WriteString(h.String()[:abbrevLength])
+			} else {
+				b.WriteString(h.String())
+			}
+		}
+	case 's':
+		b.WriteString(subject(c.Message))
+	case 'b':
+		b.WriteString(body(c.Message))
+	case 'B':
+		b.WriteString(c.Message)
+	case 'a', 'c':
+		if len(p) < 2 {
+			return 0, false
+		}
+
+		sig := c.Author
+		if p[0] == 'c' {
+			sig = c.Committer
+		}
+
+		if !formatSignature(b, p[1], sig) {
+			return 0, false
+		}
+
+		return 2, true
+	default:
+		return 0, false
+	}
+
+	return 1, true
+}
+
+func formatSignature(b *strings.Builder, p byte, sig object.Signature) bool {
+	switch p {
+	case 'n':
+		b.WriteString(sig.Name)
+	case 'e':
+		b.WriteString(sig.Email)
+	case 'd':
+		b.WriteString(sig.When.Format(defaultDateFormat))
+	case 'D':
+		b.WriteString(sig.When.Format(rfc2822DateFormat))
+	case 'i':
+		b.WriteString(sig.When.Format(isoDateFormat))
+	case 'I':
+		b.WriteString(sig.When.Format(time.RFC3339))
+	case 't':
+		b.WriteString(strconv.FormatInt(sig.When.Unix(), 10))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// subject returns the first paragraph of msg, joined in a single line.
+func subject(msg string) string {
+	s := strings.SplitN(strings.TrimLeft(msg, "\n"), "\n\n", 2)[0]
+	return strings.Replace(strings.TrimRight(s, "\n"), "\n", " ", -1)
+}
+
+func body(msg string) string {
+	parts := strings.SplitN(strings.TrimLeft(msg, "\n"), "\n\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[1]
+}
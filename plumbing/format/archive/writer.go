@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+// writer writes the entries of an archive of a given format.
+type writer interface {
+	writeDir(name string, mtime time.Time) error
+	writeFile(name string, mode filemode.FileMode, size int64, r io.Reader, mtime time.Time) error
+	writeSymlink(name, target string, mtime time.Time) error
+	Close() error
+}
+
+func newWriter(w io.Writer, o *Options) (writer, error) {
+	var comment string
+	if o.Commit != nil {
+		comment = o.Commit.Hash.String()
+	}
+
+	switch o.Format {
+	case Tar, "":
+		return newTarWriter(w, nil, comment)
+	case TarGzip:
+		gz := gzip.NewWriter(w)
+		return newTarWriter(gz, gz, comment)
+	case Zip:
+		return newZipWriter(w, comment)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// The permissions of the entries are the ones of git-archive with the
+// default tar.umask of 0002.
+const (
+	tarDirMode        = 0775
+	tarFileMode       = 0664
+	tarExecutableMode = 0775
+	tarSymlinkMode    = 0777
+)
+
+type tarWriter struct {
+	w *tar.Writer
+	c io.Closer
+}
+
+func newTarWriter(w io.Writer, c io.Closer, comment string) (*tarWriter, error) {
+	tw := &tarWriter{w: tar.NewWriter(w), c: c}
+	if comment == "" {
+		return tw, nil
+	}
+
+	err := tw.w.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": comment},
+	})
+
+	return tw, err
+}
+
+func (w *tarWriter) writeDir(name string, mtime time.Time) error {
+	return w.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     tarDirMode,
+		ModTime:  mtime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (w *tarWriter) writeFile(name string, mode filemode.FileMode, size int64,
+	r io.Reader, mtime time.Time) error {
+	perm := int64(tarFileMode)
+	if mode == filemode.Executable {
+		perm = tarExecutableMode
+	}
+
+	err := w.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     perm,
+		Size:     size,
+		ModTime:  mtime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w.w, r)
+	return err
+}
+
+func (w *tarWriter) writeSymlink(name, target string, mtime time.Time) error {
+	return w.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     tarSymlinkMode,
+		ModTime:  mtime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (w *tarWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		return err
+	}
+
+	if w.c != nil {
+		return w.c.Close()
+	}
+
+	return nil
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func newZipWriter(w io.Writer, comment string) (*zipWriter, error) {
+	zw := zip.NewWriter(w)
+	if comment != "" {
+		if err := zw.SetComment(comment); err != nil {
+			return nil, err
+		}
+	}
+
+	return &zipWriter{zw}, nil
+}
+
+func (w *zipWriter) writeDir(name string, mtime time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: mtime}
+	h.SetMode(os.ModeDir | 0755)
+	_, err := w.w.CreateHeader(h)
+	return err
+}
+
+func (w *zipWriter) writeFile(name string, mode filemode.FileMode, size int64,
+	r io.Reader, mtime time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+	if mode == filemode.Executable {
+		h.SetMode(0755)
+	} else {
+		h.SetMode(0644)
+	}
+
+	fw, err := w.w.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipWriter) writeSymlink(name, target string, mtime time.Time) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: mtime}
+	h.SetMode(os.ModeSymlink | 0777)
+	fw, err := w.w.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(fw, target)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,72 @@
+// Package bundle implements encoding and decoding of git bundle files: a
+// header listing the references and the prerequisite commits of the bundle,
+// followed by a packfile.
+//
+// See https://git-scm.com/docs/gitformat-bundle
+package bundle
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+const (
+	// V2Signature is the first line of a bundle of version 2.
+	V2Signature = "# v2 git bundle"
+	// V3Signature is the first line of a bundle of version 3.
+	V3Signature = "# v3 git bundle"
+
+	// ObjectFormatCapability is the capability giving the hash algorithm of
+	// the objects of a bundle of version 3, only sha1 is supported.
+	ObjectFormatCapability = "object-format"
+	// FilterCapability is the capability giving the object filter of the
+	// packfile of a bundle of version 3.
+	FilterCapability = "filter"
+
+	sha1ObjectFormat = "sha1"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the bundle is not of version
+	// 2 or 3.
+	ErrUnsupportedVersion = errors.New("bundle: unsupported version")
+	// ErrMalformedHeader is returned when a line of the header is invalid,
+	// or the header does not end with an empty line.
+	ErrMalformedHeader = errors.New("bundle: malformed header")
+	// ErrUnknownCapability is returned when a capability of the bundle is
+	// not supported.
+	ErrUnknownCapability = errors.New("bundle: unknown capability")
+	// ErrUnsupportedObjectFormat is returned when the objects of the bundle
+	// do not use sha1.
+	ErrUnsupportedObjectFormat = errors.New("bundle: unsupported object format")
+	// ErrCapabilitiesNotSupported is returned when encoding a header of
+	// version 2 with capabilities.
+	ErrCapabilitiesNotSupported = errors.New("bundle: capabilities require version 3")
+)
+
+// Prerequisite is a commit not contained in the bundle, required to be
+// present in the repository the bundle is unbundled into.
+type Prerequisite struct {
+	Hash plumbing.Hash
+	// Comment is usually the subject of the commit.
+	Comment string
+}
+
+// Header is the header of a bundle.
+type Header struct {
+	// Version is the version of the bundle, 2 or 3. If 0, 3 is used if
+	// there are capabilities, 2 otherwise.
+	Version int
+	// Capabilities are the capabilities of a bundle of version 3.
+	Capabilities map[string]string
+	// Prerequisites are the commits the packfile depends on.
+	Prerequisites []Prerequisite
+	// References are the references contained in the bundle, in order.
+	References []*plumbing.Reference
+}
+
+// NewHeader returns an empty Header.
+func NewHeader() *Header {
+	return &Header{Capabilities: make(map[string]string)}
+}
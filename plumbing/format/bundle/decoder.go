@@ -0,0 +1,165 @@
+package bundle
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// A Decoder reads and decodes the header of a bundle from an input stream,
+// the packfile following it is read from Packfile.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode reads the header of the bundle from its input and stores it in the
+// value pointed to by h.
+func (d *Decoder) Decode(h *Header) error {
+	signature, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	switch signature {
+	case V2Signature:
+		h.Version = 2
+	case V3Signature:
+		h.Version = 3
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	if h.Capabilities == nil {
+		h.Capabilities = make(map[string]string)
+	}
+
+	capabilities := h.Version == 3
+	for {
+		line, err := d.readLine()
+		if err == io.EOF {
+			return ErrMalformedHeader
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if line == "" {
+			return nil
+		}
+
+		if capabilities && line[0] == '@' {
+			if err := decodeCapability(h, line[1:]); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// the capabilities precede the other lines
+		capabilities = false
+		if line[0] == '-' {
+			p, err := decodePrerequisite(line[1:])
+			if err != nil {
+				return err
+			}
+
+			h.Prerequisites = append(h.Prerequisites, p)
+			continue
+		}
+
+		ref, err := decodeReference(line)
+		if err != nil {
+			return err
+		}
+
+		h.References = append(h.References, ref)
+	}
+}
+
+// Packfile returns the reader of the packfile following the header, once it
+// is decoded.
+func (d *Decoder) Packfile() io.Reader {
+	return d.r
+}
+
+func (d *Decoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return "", ErrMalformedHeader
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func decodeCapability(h *Header, line string) error {
+	key, value := line, ""
+	if i := strings.IndexByte(line, '='); i >= 0 {
+		key, value = line[:i], line[i+1:]
+	}
+
+	switch key {
+	case ObjectFormatCapability:
+		if value != sha1ObjectFormat {
+			return ErrUnsupportedObjectFormat
+		}
+	case FilterCapability:
+	default:
+		return ErrUnknownCapability
+	}
+
+	h.Capabilities[key] = value
+	return nil
+}
+
+func decodePrerequisite(line string) (Prerequisite, error) {
+	hash, comment := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		hash, comment = line[:i], line[i+1:]
+	}
+
+	h, err := decodeHash(hash)
+	if err != nil {
+		return Prerequisite{}, err
+	}
+
+	return Prerequisite{Hash: h, Comment: comment}, nil
+}
+
+func decodeReference(line string) (*plumbing.Reference, error) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 || i == len(line)-1 {
+		return nil, ErrMalformedHeader
+	}
+
+	h, err := decodeHash(line[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewHashReference(plumbing.ReferenceName(line[i+1:]), h), nil
+}
+
+func decodeHash(s string) (plumbing.Hash, error) {
+	if len(s) != 40 {
+		return plumbing.ZeroHash, ErrMalformedHeader
+	}
+
+	if _, err := hex.DecodeString(s); err != nil {
+		return plumbing.ZeroHash, ErrMalformedHeader
+	}
+
+	return plumbing.NewHash(s), nil
+}
@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+const (
+	commitA = "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+	commitB = "e8d3ffab552895c19b9fcf7aa264d277cde33881"
+	commitC = "918c48b83bd081e863dbe1b80f8998f058cd8294"
+)
+
+func (s *DecoderSuite) TestDecodeV2(c *C) {
+	input := "# v2 git bundle\n" +
+		"-" + commitC + " some commit\n" +
+		commitA + " refs/heads/master\n" +
+		commitB + " refs/heads/branch\n" +
+		commitA + " HEAD\n" +
+		"\n" +
+		"PACK..."
+
+	d := NewDecoder(strings.NewReader(input))
+	h := NewHeader()
+	c.Assert(d.Decode(h), IsNil)
+
+	c.Assert(h.Version, Equals, 2)
+	c.Assert(h.Capabilities, HasLen, 0)
+	c.Assert(h.Prerequisites, DeepEquals, []Prerequisite{
+		{Hash: plumbing.NewHash(commitC), Comment: "some commit"},
+	})
+	c.Assert(h.References, DeepEquals, []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", plumbing.NewHash(commitA)),
+		plumbing.NewHashReference("refs/heads/branch", plumbing.NewHash(commitB)),
+		plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(commitA)),
+	})
+
+	pack, err := ioutil.ReadAll(d.Packfile())
+	c.Assert(err, IsNil)
+	c.Assert(string(pack), Equals, "PACK...")
+}
+
+func (s *DecoderSuite) TestDecodeV3(c *C) {
+	input := "# v3 git bundle\n" +
+		"@object-format=sha1\n" +
+		"@filter=blob:none\n" +
+		"-" + commitC + "\n" +
+		commitA + " refs/heads/master\n" +
+		"\n"
+
+	h := &Header{}
+	c.Assert(NewDecoder(strings.NewReader(input)).Decode(h), IsNil)
+
+	c.Assert(h.Version, Equals, 3)
+	c.Assert(h.Capabilities, DeepEquals, map[string]string{
+		"object-format": "sha1",
+		"filter":        "blob:none",
+	})
+	c.Assert(h.Prerequisites, DeepEquals, []Prerequisite{
+		{Hash: plumbing.NewHash(commitC)},
+	})
+	c.Assert(h.References, HasLen, 1)
+}
+
+func (s *DecoderSuite) TestDecodeErrors(c *C) {
+	for input, expected := range map[string]error{
+		"# v4 git bundle\n\n":                        ErrUnsupportedVersion,
+		"# v2 git bundle\n":                          ErrMalformedHeader,
+		"# v2 git bundle\n" + commitA:                ErrMalformedHeader,
+		"# v2 git bundle\n" + commitA + "\n\n":       ErrMalformedHeader,
+		"# v2 git bundle\nfoo refs/heads/a\n\n":      ErrMalformedHeader,
+		"# v2 git bundle\n-foo\n\n":                  ErrMalformedHeader,
+		"# v2 git bundle\n@filter=blob:none\n\n":     ErrMalformedHeader,
+		"# v3 git bundle\n@foo\n\n":                  ErrUnknownCapability,
+		"# v3 git bundle\n@object-format=sha256\n\n": ErrUnsupportedObjectFormat,
+	} {
+		err := NewDecoder(strings.NewReader(input)).Decode(NewHeader())
+		c.Assert(err, Equals, expected, Commentf("input: %q", input))
+	}
+
+	err := NewDecoder(strings.NewReader("")).Decode(NewHeader())
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *DecoderSuite) TestEncodeDecode(c *C) {
+	h := NewHeader()
+	h.Capabilities[FilterCapability] = "blob:none"
+	h.Prerequisites = []Prerequisite{{Hash: plumbing.NewHash(commitC), Comment: "foo"}}
+	h.References = []*plumbing.Reference{
+		plumbing.NewHashReference("refs/tags/v1.0", plumbing.NewHash(commitB)),
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf).Encode(h), IsNil)
+
+	decoded := NewHeader()
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+
+	h.Version = 3
+	c.Assert(decoded, DeepEquals, h)
+}
@@ -0,0 +1,82 @@
+package bundle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// An Encoder writes the header of a bundle to an output stream, the packfile
+// is then written to the stream after it.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the header h, ending with the empty line preceding the
+// packfile.
+func (e *Encoder) Encode(h *Header) error {
+	version := h.Version
+	if version == 0 {
+		version = 2
+		if len(h.Capabilities) != 0 {
+			version = 3
+		}
+	}
+
+	var b strings.Builder
+	switch version {
+	case 2:
+		if len(h.Capabilities) != 0 {
+			return ErrCapabilitiesNotSupported
+		}
+
+		b.WriteString(V2Signature)
+	case 3:
+		b.WriteString(V3Signature)
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	b.WriteByte('\n')
+
+	keys := make([]string, 0, len(h.Capabilities))
+	for k := range h.Capabilities {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := h.Capabilities[k]; v != "" {
+			fmt.Fprintf(&b, "@%s=%s\n", k, v)
+		} else {
+			fmt.Fprintf(&b, "@%s\n", k)
+		}
+	}
+
+	for _, p := range h.Prerequisites {
+		if strings.ContainsAny(p.Comment, "\n") {
+			return ErrMalformedHeader
+		}
+
+		if p.Comment != "" {
+			fmt.Fprintf(&b, "-%s %s\n", p.Hash, p.Comment)
+		} else {
+			fmt.Fprintf(&b, "-%s\n", p.Hash)
+		}
+	}
+
+	for _, r := range h.References {
+		fmt.Fprintf(&b, "%s %s\n", r.Hash(), r.Name())
+	}
+
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
@@ -0,0 +1,70 @@
+package bundle
+
+import (
+	"bytes"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+func (s *EncoderSuite) TestEncodeV2(c *C) {
+	h := NewHeader()
+	h.Prerequisites = []Prerequisite{
+		{Hash: plumbing.NewHash(commitC), Comment: "some commit"},
+		{Hash: plumbing.NewHash(commitB)},
+	}
+	h.References = []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", plumbing.NewHash(commitA)),
+		plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(commitA)),
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf).Encode(h), IsNil)
+	c.Assert(buf.String(), Equals, "# v2 git bundle\n"+
+		"-"+commitC+" some commit\n"+
+		"-"+commitB+"\n"+
+		commitA+" refs/heads/master\n"+
+		commitA+" HEAD\n"+
+		"\n")
+}
+
+func (s *EncoderSuite) TestEncodeV3(c *C) {
+	h := &Header{
+		Version: 3,
+		Capabilities: map[string]string{
+			ObjectFormatCapability: "sha1",
+			FilterCapability:       "blob:none",
+		},
+		References: []*plumbing.Reference{
+			plumbing.NewHashReference("refs/heads/master", plumbing.NewHash(commitA)),
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(NewEncoder(buf).Encode(h), IsNil)
+	c.Assert(buf.String(), Equals, "# v3 git bundle\n"+
+		"@filter=blob:none\n"+
+		"@object-format=sha1\n"+
+		commitA+" refs/heads/master\n"+
+		"\n")
+}
+
+func (s *EncoderSuite) TestEncodeErrors(c *C) {
+	buf := bytes.NewBuffer(nil)
+
+	h := &Header{Version: 2, Capabilities: map[string]string{FilterCapability: "blob:none"}}
+	c.Assert(NewEncoder(buf).Encode(h), Equals, ErrCapabilitiesNotSupported)
+
+	h = &Header{Version: 4}
+	c.Assert(NewEncoder(buf).Encode(h), Equals, ErrUnsupportedVersion)
+
+	h = &Header{Prerequisites: []Prerequisite{{Comment: "foo\nbar"}}}
+	c.Assert(NewEncoder(buf).Encode(h), Equals, ErrMalformedHeader)
+
+	c.Assert(buf.Len(), Equals, 0)
+}
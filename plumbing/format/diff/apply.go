@@ -0,0 +1,252 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ErrPatchRejected is returned when some hunks of a file patch can not be
+// applied.
+var ErrPatchRejected = errors.New("patch does not apply")
+
+// HunkResult is the result of the application of a hunk.
+type HunkResult struct {
+	// Line is the line, from 1, where the hunk was applied, zero if it was
+	// rejected.
+	Line int
+	// Offset is the number of lines from the position of the hunk in its
+	// header, after the previous hunks, to the one where it was applied.
+	Offset int
+	// Fuzz is the number of context lines ignored to apply the hunk.
+	Fuzz int
+	// Rejected is set if the hunk could not be applied.
+	Rejected bool
+}
+
+// Apply returns the content src once patched, and the results of the hunks
+// of a text file patch. A hunk is applied at the closest position to the
+// one in its header where its context and removed lines are found, and
+// which does not overlap the previous hunks. If there is none, up to fuzz
+// context lines are ignored at its beginning and at its end, as git apply
+// does with -C. The hunks that can not be applied are skipped, and
+// ErrPatchRejected returned along with the result of the other ones.
+//
+// The binary patches are applied with their Forward hunk, the content must
+// be the one of the full index line of the patch.
+func (p *UnifiedFilePatch) Apply(src []byte, fuzz int) ([]byte, []HunkResult, error) {
+	if p.Binary {
+		dst, err := p.applyBinary(src)
+		return dst, nil, err
+	}
+
+	img := newImage(src)
+	results := make([]HunkResult, len(p.Hunks))
+	var err error
+	for i, h := range p.Hunks {
+		results[i] = img.apply(h, fuzz)
+		if results[i].Rejected {
+			err = ErrPatchRejected
+		}
+	}
+
+	return img.bytes(), results, err
+}
+
+func (p *UnifiedFilePatch) applyBinary(src []byte) ([]byte, error) {
+	if p.Forward == nil {
+		return nil, ErrBinaryPatchData
+	}
+
+	from, to, ok := p.FullIndex()
+	if !ok {
+		return nil, ErrBinaryPatchFullIndex
+	}
+
+	if !isBlob(src, from) {
+		return nil, ErrBinaryPatchMismatch
+	}
+
+	dst, err := p.Forward.Apply(src)
+	if err != nil || !isBlob(dst, to) {
+		return nil, ErrBinaryPatchResult
+	}
+
+	return dst, nil
+}
+
+// isBlob returns true if content is the blob with the hash h, empty for a
+// zero hash.
+func isBlob(content []byte, h plumbing.Hash) bool {
+	if h.IsZero() {
+		return len(content) == 0
+	}
+
+	return plumbing.ComputeHash(plumbing.BlobObject, content) == h
+}
+
+// image is the content of a text file being patched, line by line.
+type image struct {
+	lines []imageLine
+}
+
+type imageLine struct {
+	text string
+	// patched is set for the lines written by the previous hunks, which can
+	// not be matched by the next ones.
+	patched bool
+}
+
+func newImage(src []byte) *image {
+	img := &image{}
+	for _, l := range splitLinesKeepEnds(string(src)) {
+		img.lines = append(img.lines, imageLine{text: l})
+	}
+
+	return img
+}
+
+func (img *image) bytes() []byte {
+	var buf bytes.Buffer
+	for _, l := range img.lines {
+		buf.WriteString(l.text)
+	}
+
+	return buf.Bytes()
+}
+
+// apply applies the hunk h to the image, ignoring up to fuzz context lines
+// at each of its ends if needed.
+func (img *image) apply(h *UnifiedHunk, fuzz int) HunkResult {
+	var pre, post []string
+	leading, trailing := 0, 0
+	changed := false
+	for _, l := range h.Lines {
+		if l.Type != Add {
+			pre = append(pre, l.Text)
+		}
+
+		if l.Type != Delete {
+			post = append(post, l.Text)
+		}
+
+		switch {
+		case l.Type != Equal:
+			changed, trailing = true, 0
+		case changed:
+			trailing++
+		default:
+			leading++
+		}
+	}
+
+	minLeading, minTrailing := leading-fuzz, trailing-fuzz
+	pos := h.ToLine - 1
+	if h.ToCount == 0 {
+		pos = h.ToLine
+	}
+
+	if pos < 0 {
+		pos = 0
+	}
+
+	// the hunks without context, as written by git diff -U0, are applied
+	// as the --unidiff-zero option of git apply does, anywhere but at the
+	// start of the file if they insert lines there.
+	zero := leading == 0 && trailing == 0
+	matchBeginning := h.FromLine == 0 || h.FromLine == 1 && !zero
+	matchEnd := trailing == 0 && !zero
+	var ignored int
+	for {
+		if found := img.find(pre, pos, matchBeginning, matchEnd); found >= 0 {
+			img.replace(found, len(pre), post)
+			return HunkResult{Line: found + 1, Offset: found - pos, Fuzz: ignored}
+		}
+
+		if leading <= minLeading && trailing <= minTrailing {
+			return HunkResult{Rejected: true}
+		}
+
+		if matchBeginning || matchEnd {
+			matchBeginning, matchEnd = false, false
+			continue
+		}
+
+		if leading > minLeading && (leading >= trailing || trailing <= minTrailing) {
+			pre, post = pre[1:], post[1:]
+			pos++
+			leading--
+		} else {
+			pre, post = pre[:len(pre)-1], post[:len(post)-1]
+			trailing--
+		}
+
+		ignored++
+	}
+}
+
+// find returns the position of the lines pre in the image, the closest to
+// line, and -1 if they are not found. They must be found at the start of the
+// image if matchBeginning is set, and at its end if matchEnd is set.
+func (img *image) find(pre []string, line int, matchBeginning, matchEnd bool) int {
+	if len(pre) > len(img.lines) {
+		return -1
+	}
+
+	switch {
+	case matchBeginning:
+		line = 0
+	case matchEnd:
+		line = len(img.lines) - len(pre)
+	case line > len(img.lines):
+		line = len(img.lines)
+	}
+
+	backward, forward := line, line
+	for i := 0; ; i++ {
+		if img.match(pre, line, matchBeginning, matchEnd) {
+			return line
+		}
+
+		switch {
+		case backward == 0 && forward == len(img.lines):
+			return -1
+		case i%2 == 0 && forward < len(img.lines) || backward == 0:
+			forward++
+			line = forward
+		default:
+			backward--
+			line = backward
+		}
+	}
+}
+
+func (img *image) match(pre []string, line int, matchBeginning, matchEnd bool) bool {
+	if line+len(pre) > len(img.lines) ||
+		matchBeginning && line != 0 ||
+		matchEnd && line+len(pre) != len(img.lines) {
+		return false
+	}
+
+	for i, text := range pre {
+		l := img.lines[line+i]
+		if l.patched || l.text != text {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replace replaces the n lines at the position line of the image with the
+// lines post, marked as patched.
+func (img *image) replace(line, n int, post []string) {
+	lines := make([]imageLine, 0, len(img.lines)-n+len(post))
+	lines = append(lines, img.lines[:line]...)
+	for _, text := range post {
+		lines = append(lines, imageLine{text: text, patched: true})
+	}
+
+	img.lines = append(lines, img.lines[line+n:]...)
+}
@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ApplySuite struct{}
+
+var _ = Suite(&ApplySuite{})
+
+const applySource = `1
+2
+3
+4
+5
+6
+7
+8
+9
+10
+`
+
+func (s *ApplySuite) filePatch(c *C, patch string) *UnifiedFilePatch {
+	p := &UnifiedPatch{}
+	err := NewDecoder(strings.NewReader(patch)).Decode(p)
+	c.Assert(err, IsNil)
+	return p.UnifiedFilePatches()[0]
+}
+
+func (s *ApplySuite) TestApply(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+@@ -8,3 +8,4 @@
+ 8
+ 9
+ 10
++11
+`)
+
+	dst, results, err := fp.Apply([]byte(applySource), 0)
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []HunkResult{{Line: 1}, {Line: 8}})
+	c.Assert(string(dst), Equals, strings.Replace(applySource, "1\n", "one\n", 1)+"11\n")
+}
+
+func (s *ApplySuite) TestApplyOffset(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -2,3 +2,3 @@
+ 6
+-7
++seven
+ 8
+`)
+
+	dst, results, err := fp.Apply([]byte(applySource), 0)
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []HunkResult{{Line: 6, Offset: 4}})
+	c.Assert(string(dst), Equals, strings.Replace(applySource, "7\n", "seven\n", 1))
+}
+
+func (s *ApplySuite) TestApplyFuzz(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -4,5 +4,5 @@
+ four
+ 5
+-6
++six
+ 7
+ eight
+`)
+
+	_, results, err := fp.Apply([]byte(applySource), 0)
+	c.Assert(err, Equals, ErrPatchRejected)
+	c.Assert(results, DeepEquals, []HunkResult{{Rejected: true}})
+
+	dst, results, err := fp.Apply([]byte(applySource), 1)
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []HunkResult{{Line: 5, Fuzz: 2}})
+	c.Assert(string(dst), Equals, strings.Replace(applySource, "6\n", "six\n", 1))
+}
+
+func (s *ApplySuite) TestApplyReject(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-1
++one
+ 2
+@@ -5,3 +5,3 @@
+ 5
+-x
++y
+ 7
+`)
+
+	dst, results, err := fp.Apply([]byte(applySource), 0)
+	c.Assert(err, Equals, ErrPatchRejected)
+	c.Assert(results, DeepEquals, []HunkResult{{Line: 1}, {Rejected: true}})
+	c.Assert(string(dst), Equals, strings.Replace(applySource, "1\n", "one\n", 1))
+}
+
+func (s *ApplySuite) TestApplyNoNewline(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`)
+
+	dst, _, err := fp.Apply([]byte("a\nb"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(dst), Equals, "a\nb\n")
+
+	_, _, err = fp.Apply([]byte("a\nb\n"), 0)
+	c.Assert(err, Equals, ErrPatchRejected)
+}
+
+func (s *ApplySuite) TestApplyZeroContext(c *C) {
+	fp := s.filePatch(c, `--- a/f
++++ b/f
+@@ -0,0 +1 @@
++0
+@@ -3 +4 @@
+-3
++three
+@@ -6,2 +6,0 @@
+-6
+-7
+@@ -10,0 +10 @@
++11
+`)
+
+	dst, _, err := fp.Apply([]byte(applySource), 0)
+	c.Assert(err, IsNil)
+	c.Assert(string(dst), Equals, "0\n1\n2\nthree\n4\n5\n8\n9\n10\n11\n")
+}
@@ -0,0 +1,241 @@
+package diff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+)
+
+const (
+	binaryPatch     = "GIT binary patch\n"
+	binaryLiteral   = "literal %d\n"
+	binaryDelta     = "delta %d\n"
+	binaryLineBytes = 52
+)
+
+var (
+	// ErrBinaryPatchData is returned when a binary patch without its data,
+	// written as "Binary files differ", is applied.
+	ErrBinaryPatchData = errors.New("binary patch without data")
+	// ErrBinaryPatchFullIndex is returned when a binary patch without the
+	// full hashes of the files in its index line is applied.
+	ErrBinaryPatchFullIndex = errors.New("binary patch without full index line")
+	// ErrBinaryPatchMismatch is returned when a binary patch is applied to
+	// a content other than the one it was generated from.
+	ErrBinaryPatchMismatch = errors.New("binary patch does not apply")
+	// ErrBinaryPatchResult is returned when the result of the application
+	// of a binary patch is not the content it was generated for.
+	ErrBinaryPatchResult = errors.New("binary patch creates incorrect result")
+)
+
+// BinaryHunk is a hunk of a git binary patch, the data transforming a
+// binary content to another.
+type BinaryHunk struct {
+	// Delta is set if Data is a delta of the content, in the format of the
+	// packfiles, and not the whole new content.
+	Delta bool
+	// Data is the new content or the delta, inflated.
+	Data []byte
+}
+
+// Apply returns the result of the application of the hunk to src.
+func (h *BinaryHunk) Apply(src []byte) ([]byte, error) {
+	if !h.Delta {
+		return h.Data, nil
+	}
+
+	return packfile.PatchDelta(src, h.Data)
+}
+
+// writeBinaryHunk writes the hunk transforming from in to, as git does: a
+// delta if it is smaller than the deflated content once deflated too, the
+// content otherwise.
+func writeBinaryHunk(buf *bytes.Buffer, from, to []byte) error {
+	data, err := deflate(to)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf(binaryLiteral, len(to))
+	if len(from) != 0 && len(to) != 0 {
+		delta := append([]byte(nil), packfile.DiffDelta(from, to)...)
+		deflated, err := deflate(delta)
+		if err != nil {
+			return err
+		}
+
+		if len(deflated) < len(data) {
+			header, data = fmt.Sprintf(binaryDelta, len(delta)), deflated
+		}
+	}
+
+	buf.WriteString(header)
+	for len(data) != 0 {
+		n := binaryLineBytes
+		if len(data) < n {
+			n = len(data)
+		}
+
+		if n <= 26 {
+			buf.WriteByte(byte('A' + n - 1))
+		} else {
+			buf.WriteByte(byte('a' + n - 27))
+		}
+
+		buf.Write(encode85(data[:n]))
+		buf.WriteByte('\n')
+		data = data[n:]
+	}
+
+	buf.WriteByte('\n')
+	return nil
+}
+
+// decodeBinaryHunk returns the hunk with the given header, literal or
+// delta, made of the given lines of base85 data.
+func decodeBinaryHunk(header string, lines []string) (*BinaryHunk, error) {
+	h := &BinaryHunk{}
+	var size int
+	if _, err := fmt.Sscanf(header, binaryDelta, &size); err == nil {
+		h.Delta = true
+	} else if _, err := fmt.Sscanf(header, binaryLiteral, &size); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for _, l := range lines {
+		l = trimNewline(l)
+		if l == "" {
+			return nil, errors.New("empty line in binary hunk")
+		}
+
+		var n int
+		switch c := l[0]; {
+		case 'A' <= c && c <= 'Z':
+			n = int(c-'A') + 1
+		case 'a' <= c && c <= 'z':
+			n = int(c-'a') + 27
+		default:
+			return nil, fmt.Errorf("invalid length in binary hunk: %q", c)
+		}
+
+		if len(l)-1 != (n+3)/4*5 {
+			return nil, errors.New("invalid line length in binary hunk")
+		}
+
+		b, err := decode85(l[1:], n)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, b...)
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	h.Data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.Data) != size {
+		return nil, fmt.Errorf("binary hunk of %d bytes instead of %d", len(h.Data), size)
+	}
+
+	return h, nil
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+const base85Alphabet = "0123456789" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"abcdefghijklmnopqrstuvwxyz" +
+	"!#$%&()*+-;<=>?@^_`{|}~"
+
+var base85Values [256]byte
+
+func init() {
+	for i := range base85Values {
+		base85Values[i] = 0xff
+	}
+
+	for i := 0; i < len(base85Alphabet); i++ {
+		base85Values[base85Alphabet[i]] = byte(i)
+	}
+}
+
+// encode85 encodes data in the base85 flavor of git, every group of four
+// bytes, padded with zeros, as five characters.
+func encode85(data []byte) []byte {
+	out := make([]byte, 0, (len(data)+3)/4*5)
+	for i := 0; i < len(data); i += 4 {
+		var acc uint32
+		for j := 0; j < 4; j++ {
+			acc <<= 8
+			if i+j < len(data) {
+				acc |= uint32(data[i+j])
+			}
+		}
+
+		var group [5]byte
+		for j := 4; j >= 0; j-- {
+			group[j] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+
+		out = append(out, group[:]...)
+	}
+
+	return out
+}
+
+// decode85 decodes the n bytes encoded in s by encode85.
+func decode85(s string, n int) ([]byte, error) {
+	out := make([]byte, 0, len(s)/5*4)
+	for i := 0; i+5 <= len(s); i += 5 {
+		var acc uint64
+		for j := 0; j < 5; j++ {
+			v := base85Values[s[i+j]]
+			if v == 0xff {
+				return nil, fmt.Errorf("invalid base85 character: %q", s[i+j])
+			}
+
+			acc = acc*85 + uint64(v)
+		}
+
+		if acc > 0xffffffff {
+			return nil, errors.New("invalid base85 group")
+		}
+
+		out = append(out, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+
+	if n > len(out) {
+		return nil, errors.New("truncated base85 data")
+	}
+
+	return out[:n], nil
+}
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+
+	. "gopkg.in/check.v1"
+)
+
+type BinarySuite struct{}
+
+var _ = Suite(&BinarySuite{})
+
+func (s *BinarySuite) TestBase85(c *C) {
+	for _, data := range []string{"", "a", "abcd", "abcde", "\x00\x00\x00\x00\xff\xff\xff\xff"} {
+		encoded := encode85([]byte(data))
+		c.Assert(len(encoded), Equals, (len(data)+3)/4*5)
+
+		decoded, err := decode85(string(encoded), len(data))
+		c.Assert(err, IsNil)
+		c.Assert(string(decoded), Equals, data)
+	}
+
+	_, err := decode85("00.00", 4)
+	c.Assert(err, NotNil)
+	_, err = decode85("0000", 4)
+	c.Assert(err, NotNil)
+}
+
+func (s *BinarySuite) TestDecodeBinaryHunk(c *C) {
+	h, err := decodeBinaryHunk("literal 4\n", []string{"Lcmc~xEoT4#1K9yf\n"})
+	c.Assert(err, IsNil)
+	c.Assert(h.Delta, Equals, false)
+	c.Assert(string(h.Data), Equals, "new\x00")
+
+	h, err = decodeBinaryHunk("literal 0\n", []string{"HcmV?d00001\n"})
+	c.Assert(err, IsNil)
+	c.Assert(h.Data, HasLen, 0)
+
+	_, err = decodeBinaryHunk("literal 5\n", []string{"Lcmc~xEoT4#1K9yf\n"})
+	c.Assert(err, NotNil)
+	_, err = decodeBinaryHunk("literal 4\n", []string{"Mcmc~xEoT4#1K9yf\n"})
+	c.Assert(err, NotNil)
+}
+
+func (s *BinarySuite) TestEncodeBinary(c *C) {
+	big := bytes.Repeat([]byte("binary\x00content\n"), 100)
+	for _, t := range []struct {
+		from, to string
+		delta    bool
+	}{
+		{"", "new\x00", false},
+		{"new\x00", "", false},
+		{"new\x00", "newer\x00x", false},
+		{string(big), string(big) + "tail\x00", true},
+	} {
+		fp := testBinaryFilePatch{
+			from: []byte(t.from),
+			to:   []byte(t.to),
+		}
+
+		if t.from != "" {
+			fp.testFilePatch.from = &testFile{path: "bin", mode: filemode.Regular, seed: t.from}
+		}
+
+		if t.to != "" {
+			fp.testFilePatch.to = &testFile{path: "bin", mode: filemode.Regular, seed: t.to}
+		}
+
+		var buf bytes.Buffer
+		e := NewUnifiedEncoderWithOptions(&buf, 3, &UnifiedEncoderOptions{Binary: true})
+		err := e.Encode(testPatch{binary: []testBinaryFilePatch{fp}})
+		c.Assert(err, IsNil)
+		c.Assert(strings.Contains(buf.String(), "GIT binary patch\n"), Equals, true)
+		c.Assert(strings.Contains(buf.String(), "\ndelta "), Equals, t.delta)
+
+		p := &UnifiedPatch{}
+		c.Assert(NewDecoder(&buf).Decode(p), IsNil)
+		ufp := p.UnifiedFilePatches()[0]
+
+		to, _, err := ufp.Apply([]byte(t.from), 0)
+		c.Assert(err, IsNil)
+		c.Assert(string(to), Equals, t.to)
+
+		from, err := ufp.Reverse.Apply([]byte(t.to))
+		c.Assert(err, IsNil)
+		c.Assert(string(from), Equals, t.from)
+
+		_, _, err = ufp.Apply([]byte("other"), 0)
+		c.Assert(err, Equals, ErrBinaryPatchMismatch)
+	}
+}
+
+func (s *BinarySuite) TestEncodeBinaryWithoutOption(c *C) {
+	fp := testBinaryFilePatch{
+		testFilePatch: testFilePatch{
+			from: &testFile{path: "bin", mode: filemode.Regular, seed: "a"},
+			to:   &testFile{path: "bin", mode: filemode.Regular, seed: "b"},
+		},
+		from: []byte("a"),
+		to:   []byte("b"),
+	}
+
+	var buf bytes.Buffer
+	err := NewUnifiedEncoder(&buf, 3).Encode(testPatch{binary: []testBinaryFilePatch{fp}})
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, `diff --git a/bin b/bin
+index 2e65efe2a145dda7ee51d1741299f848e5bf752e..63d8dbd40c23542e740659a7168a0ce3138ea748 100644
+Binary files a/bin and b/bin differ
+`)
+}
+
+type testBinaryFilePatch struct {
+	testFilePatch
+	from, to []byte
+}
+
+func (t testBinaryFilePatch) BinaryContents() ([]byte, []byte, error) {
+	return t.from, t.to, nil
+}
@@ -0,0 +1,258 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColorKey is a slot of the palette of a colored diff, named as the keys of
+// the color.diff section of the git config.
+type ColorKey string
+
+const (
+	// Context is the color of the context lines.
+	Context ColorKey = "context"
+	// Meta is the color of the header lines of the file patches.
+	Meta ColorKey = "meta"
+	// Frag is the color of the line ranges of the hunk headers.
+	Frag ColorKey = "frag"
+	// Func is the color of the function names of the hunk headers.
+	Func ColorKey = "func"
+	// Old is the color of the removed lines and words.
+	Old ColorKey = "old"
+	// New is the color of the added lines and words.
+	New ColorKey = "new"
+	// Whitespace is the color of the whitespace errors of the added lines.
+	Whitespace ColorKey = "whitespace"
+)
+
+// colorReset is the escape sequence ending any color.
+const colorReset = "\x1b[m"
+
+// ErrInvalidColor is returned when a color can not be parsed.
+var ErrInvalidColor = errors.New("invalid color")
+
+// ColorConfig is the palette of a colored diff, the ANSI escape sequence of
+// every slot. The slots with an empty sequence are not colored, a nil
+// ColorConfig disables the colors.
+type ColorConfig map[ColorKey]string
+
+// NewColorConfig returns the default palette of git.
+func NewColorConfig() ColorConfig {
+	return ColorConfig{
+		Context:    "",
+		Meta:       "\x1b[1m",
+		Frag:       "\x1b[36m",
+		Func:       "",
+		Old:        "\x1b[31m",
+		New:        "\x1b[32m",
+		Whitespace: "\x1b[41m",
+	}
+}
+
+// Set sets the color of the given slot, from its git config value such as
+// "bold red" or "#ff0000 ul".
+func (c ColorConfig) Set(key ColorKey, value string) error {
+	seq, err := ParseColor(value)
+	if err != nil {
+		return err
+	}
+
+	c[key] = seq
+	return nil
+}
+
+// wrap returns s surrounded by the color of the given slot and a reset, s
+// itself if the colors are disabled. The reset is written even if the slot
+// is not colored, as git does.
+func (c ColorConfig) wrap(key ColorKey, s string) string {
+	if c == nil {
+		return s
+	}
+
+	return c[key] + s + colorReset
+}
+
+// Paint returns s surrounded by the color of the given slot and a reset, s
+// itself if the slot is not colored.
+func (c ColorConfig) Paint(key ColorKey, s string) string {
+	if c[key] == "" {
+		return s
+	}
+
+	return c[key] + s + colorReset
+}
+
+// paintLine returns the line s surrounded by the color of the given slot and
+// a reset, the reset being written if the slot is not colored but not for
+// an empty line, as git does.
+func (c ColorConfig) paintLine(key ColorKey, s string) string {
+	if s == "" {
+		return s
+	}
+
+	return c.wrap(key, s)
+}
+
+var colorNames = []string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+}
+
+var colorAttributes = []struct {
+	name       string
+	set, unset int
+}{
+	{"bold", 1, 22},
+	{"dim", 2, 22},
+	{"italic", 3, 23},
+	{"ul", 4, 24},
+	{"blink", 5, 25},
+	{"reverse", 7, 27},
+	{"strike", 9, 29},
+}
+
+// ParseColor returns the ANSI escape sequence of a color as written in the
+// git config: up to two colors, the foreground and the background, and any
+// number of attributes, separated by spaces. The colors are either a name,
+// optionally prefixed with "bright", "normal", "default", a number from 0 to
+// 255 or a #RRGGBB value. The attributes are bold, dim, italic, ul, blink,
+// reverse and strike, optionally prefixed with "no" or "no-" to turn them
+// off, and reset.
+func ParseColor(value string) (string, error) {
+	set := make([]bool, len(colorAttributes))
+	unset := make([]bool, len(colorAttributes))
+	var colors []string
+	var reset bool
+	var count int
+	for _, word := range strings.Fields(strings.ToLower(value)) {
+		if word == "reset" {
+			reset = true
+			continue
+		}
+
+		if i, negate, ok := parseColorAttribute(word); ok {
+			if negate {
+				unset[i] = true
+			} else {
+				set[i] = true
+			}
+
+			continue
+		}
+
+		if count == 2 {
+			return "", fmt.Errorf("%s: %q", ErrInvalidColor, value)
+		}
+
+		code, ok := parseColorValue(word, count == 1)
+		if !ok {
+			return "", fmt.Errorf("%s: %q", ErrInvalidColor, value)
+		}
+
+		count++
+		if code != "" {
+			colors = append(colors, code)
+		}
+	}
+
+	var codes []string
+	if reset {
+		codes = append(codes, "")
+	}
+
+	for i, a := range colorAttributes {
+		if set[i] {
+			codes = append(codes, strconv.Itoa(a.set))
+		}
+	}
+
+	for i, a := range colorAttributes {
+		if unset[i] {
+			codes = append(codes, strconv.Itoa(a.unset))
+		}
+	}
+
+	codes = append(codes, colors...)
+	if len(codes) == 0 {
+		return "", nil
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
+}
+
+// parseColorAttribute returns the index in colorAttributes of the given
+// attribute, and whether it is turned off.
+func parseColorAttribute(word string) (int, bool, bool) {
+	name, negate := word, false
+	if strings.HasPrefix(word, "no") {
+		name, negate = strings.TrimPrefix(strings.TrimPrefix(word, "no"), "-"), true
+	}
+
+	if name == "underline" {
+		name = "ul"
+	}
+
+	for i, a := range colorAttributes {
+		if a.name == name {
+			return i, negate, true
+		}
+	}
+
+	return 0, false, false
+}
+
+// parseColorValue returns the ANSI code of a foreground or background color,
+// empty for the normal one.
+func parseColorValue(word string, background bool) (string, bool) {
+	base, bright, extended := 30, 90, "38"
+	if background {
+		base, bright, extended = 40, 100, "48"
+	}
+
+	switch {
+	case word == "normal" || word == "":
+		return "", true
+	case word == "default":
+		return strconv.Itoa(base + 9), true
+	case strings.HasPrefix(word, "#"):
+		if len(word) != 7 {
+			return "", false
+		}
+
+		rgb, err := strconv.ParseUint(word[1:], 16, 32)
+		if err != nil {
+			return "", false
+		}
+
+		return fmt.Sprintf("%s;2;%d;%d;%d", extended,
+			rgb>>16, (rgb>>8)&0xff, rgb&0xff), true
+	}
+
+	if n, err := strconv.Atoi(word); err == nil {
+		switch {
+		case n == -1:
+			return "", true
+		case n < 0 || n > 255:
+			return "", false
+		case n < 8:
+			return strconv.Itoa(base + n), true
+		default:
+			return fmt.Sprintf("%s;5;%d", extended, n), true
+		}
+	}
+
+	name, offset := word, base
+	if strings.HasPrefix(word, "bright") {
+		name, offset = strings.TrimPrefix(word, "bright"), bright
+	}
+
+	for i, c := range colorNames {
+		if c == name {
+			return strconv.Itoa(offset + i), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,46 @@
+package diff
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ColorSuite struct{}
+
+var _ = Suite(&ColorSuite{})
+
+func (s *ColorSuite) TestParseColor(c *C) {
+	for value, expected := range map[string]string{
+		"bold red":                "\x1b[1;31m",
+		"red bold":                "\x1b[1;31m",
+		"red blue":                "\x1b[31;44m",
+		"brightgreen":             "\x1b[92m",
+		"#ff0080 ul":              "\x1b[4;38;2;255;0;128m",
+		"196 17":                  "\x1b[38;5;196;48;5;17m",
+		"nobold":                  "\x1b[22m",
+		"no-ul reverse":           "\x1b[7;24m",
+		"normal":                  "",
+		"reset":                   "\x1b[m",
+		"reset red":               "\x1b[;31m",
+		"default default":         "\x1b[39;49m",
+		"dim italic strike blink": "\x1b[2;3;5;9m",
+	} {
+		seq, err := ParseColor(value)
+		c.Assert(err, IsNil)
+		c.Assert(seq, Equals, expected, Commentf("color %q", value))
+	}
+}
+
+func (s *ColorSuite) TestParseColorInvalid(c *C) {
+	for _, value := range []string{"red blue green", "pink", "256", "#fff"} {
+		_, err := ParseColor(value)
+		c.Assert(err, NotNil, Commentf("color %q", value))
+	}
+}
+
+func (s *ColorSuite) TestColorConfigSet(c *C) {
+	cc := NewColorConfig()
+	c.Assert(cc.Set(Old, "bold magenta"), IsNil)
+	c.Assert(cc[Old], Equals, "\x1b[1;35m")
+	c.Assert(cc.Set(New, "pink"), NotNil)
+	c.Assert(cc[New], Equals, "\x1b[32m")
+}
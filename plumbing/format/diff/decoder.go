@@ -0,0 +1,684 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+const (
+	gitDiffPrefix   = "diff --git "
+	fromPathPrefix  = "--- "
+	toPathPrefix    = "+++ "
+	hunkPrefix      = "@@ -"
+	binaryPrefix    = "Binary files "
+	noNewlinePrefix = "\\"
+	noNewline       = "\\ No newline at end of file\n"
+	rangeSeparator  = ".."
+)
+
+var (
+	// ErrMalformedPatch is returned when a patch can not be decoded.
+	ErrMalformedPatch = errors.New("malformed patch")
+	// ErrEmptyPatch is returned when there is no file patch in the decoded
+	// input.
+	ErrEmptyPatch = errors.New("no valid patches in input")
+)
+
+// UnifiedPatch is a Patch decoded from the unified diff format, with the
+// extended headers of git or without them.
+type UnifiedPatch struct {
+	message string
+	files   []*UnifiedFilePatch
+}
+
+// FilePatches returns the patches of the files.
+func (p *UnifiedPatch) FilePatches() []FilePatch {
+	fps := make([]FilePatch, len(p.files))
+	for i, f := range p.files {
+		fps[i] = f
+	}
+
+	return fps
+}
+
+// UnifiedFilePatches returns the patches of the files, with their hunks.
+func (p *UnifiedPatch) UnifiedFilePatches() []*UnifiedFilePatch {
+	return p.files
+}
+
+// Message returns the text before the first file patch, such as the
+// message of a patch written by git format-patch.
+func (p *UnifiedPatch) Message() string {
+	return p.message
+}
+
+// UnifiedFilePatch is the patch of a file decoded from the unified diff
+// format. It implements SimilarityFilePatch, the lines of the file out of
+// its hunks being unknown they are not part of its Chunks.
+type UnifiedFilePatch struct {
+	// FromPath and ToPath are the paths of the file before and after the
+	// patch, FromPath is empty if the file is created and ToPath if it is
+	// deleted.
+	FromPath, ToPath string
+	// FromMode and ToMode are the modes of the file before and after the
+	// patch, filemode.Empty if the patch does not record them.
+	FromMode, ToMode filemode.FileMode
+	// FromIndex and ToIndex are the hashes, maybe abbreviated, of the file
+	// before and after the patch in its index line, empty if it has none.
+	FromIndex, ToIndex string
+	// Rename and Copy are set if the file is renamed or copied from FromPath
+	// to ToPath, with the given similarity index.
+	Rename, Copy    bool
+	SimilarityIndex int
+	// Binary is set if the file is binary, its changes are in the Forward
+	// and Reverse hunks of a git binary patch, or unknown if nil.
+	Binary           bool
+	Forward, Reverse *BinaryHunk
+	// Hunks are the changes of a text file.
+	Hunks []*UnifiedHunk
+}
+
+// IsBinary returns true if the patch is the one of a binary file.
+func (p *UnifiedFilePatch) IsBinary() bool {
+	return p.Binary
+}
+
+// Files returns the "from" and "to" Files, from is nil if the file is
+// created and to if it is deleted.
+func (p *UnifiedFilePatch) Files() (from, to File) {
+	if p.FromPath != "" {
+		from = &unifiedFile{p.FromIndex, p.FromMode, p.FromPath}
+	}
+
+	if p.ToPath != "" {
+		to = &unifiedFile{p.ToIndex, p.ToMode, p.ToPath}
+	}
+
+	return
+}
+
+// Chunks returns the lines of the hunks, grouped by operation.
+func (p *UnifiedFilePatch) Chunks() []Chunk {
+	var chunks []Chunk
+	var current *unifiedChunk
+	for _, h := range p.Hunks {
+		for _, l := range h.Lines {
+			if current == nil || current.op != l.Type {
+				current = &unifiedChunk{op: l.Type}
+				chunks = append(chunks, current)
+			}
+
+			current.content += l.Text
+		}
+	}
+
+	return chunks
+}
+
+// Similarity returns the similarity index of a rename or a copy.
+func (p *UnifiedFilePatch) Similarity() int {
+	return p.SimilarityIndex
+}
+
+// IsCopy returns true if the file is copied.
+func (p *UnifiedFilePatch) IsCopy() bool {
+	return p.Copy
+}
+
+// FullIndex returns the hashes of the index line, and false if there is
+// none or they are abbreviated. The hash of a missing file is zero.
+func (p *UnifiedFilePatch) FullIndex() (from, to plumbing.Hash, ok bool) {
+	if len(p.FromIndex) != 2*len(from) || len(p.ToIndex) != 2*len(to) {
+		return from, to, false
+	}
+
+	return plumbing.NewHash(p.FromIndex), plumbing.NewHash(p.ToIndex), true
+}
+
+// unifiedFile is an implementation of the File interface for the decoded
+// patches, the hashes being the ones of the index line, maybe abbreviated.
+type unifiedFile struct {
+	index string
+	mode  filemode.FileMode
+	path  string
+}
+
+func (f *unifiedFile) Hash() plumbing.Hash {
+	return plumbing.NewHash(f.index)
+}
+
+func (f *unifiedFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+func (f *unifiedFile) Path() string {
+	return f.path
+}
+
+// unifiedChunk is an implementation of the Chunk interface for the decoded
+// patches.
+type unifiedChunk struct {
+	content string
+	op      Operation
+}
+
+func (c *unifiedChunk) Content() string {
+	return c.content
+}
+
+func (c *unifiedChunk) Type() Operation {
+	return c.op
+}
+
+// UnifiedHunk is a hunk of a text file patch.
+type UnifiedHunk struct {
+	// FromLine and FromCount are the first line, from 1, and the number of
+	// lines of the hunk in the file before the patch, FromLine is the line
+	// before the hunk if it is empty. ToLine and ToCount are the ones after
+	// the patch.
+	FromLine, FromCount int
+	ToLine, ToCount     int
+	// FuncName is the text after the line ranges of the header.
+	FuncName string
+	// Lines are the context, removed and added lines.
+	Lines []HunkLine
+}
+
+// HunkLine is a line of a hunk.
+type HunkLine struct {
+	// Type is Equal for the context lines, Delete for the removed ones and
+	// Add for the added ones.
+	Type Operation
+	// Text is the line, without its prefix and with its newline unless it
+	// is the last line of a file without one.
+	Text string
+}
+
+// String returns the hunk in the unified diff format.
+func (h *UnifiedHunk) String() string {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "%s%s%s%s%s", chunkStart, hunkRange(h.FromLine, h.FromCount),
+		chunkMiddle, hunkRange(h.ToLine, h.ToCount), chunkEnd)
+	if h.FuncName != "" {
+		buf.WriteString(" " + h.FuncName)
+	}
+
+	buf.WriteByte('\n')
+	for _, l := range h.Lines {
+		switch l.Type {
+		case Equal:
+			buf.WriteByte(' ')
+		case Delete:
+			buf.WriteByte('-')
+		case Add:
+			buf.WriteByte('+')
+		}
+
+		buf.WriteString(l.Text)
+		if !strings.HasSuffix(l.Text, "\n") {
+			buf.WriteString("\n" + noNewline)
+		}
+	}
+
+	return buf.String()
+}
+
+// hunkRange returns a line range of the header of a hunk, without its
+// count if it is one.
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return strconv.Itoa(line)
+	}
+
+	return fmt.Sprintf(chunkCount, line, count)
+}
+
+// Decoder reads and decodes patches in the unified diff format, as written
+// by git diff or git format-patch, or by diff -u.
+type Decoder struct {
+	r     io.Reader
+	lines []string
+	n     int
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the whole input and stores the patches of its files in p.
+// The text before the first file patch is the message of the patch, the
+// text between the file patches is ignored.
+func (d *Decoder) Decode(p *UnifiedPatch) error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	d.lines = splitLinesKeepEnds(string(data))
+	d.n = 0
+
+	var message bytes.Buffer
+	for d.n < len(d.lines) {
+		var fp *UnifiedFilePatch
+		switch {
+		case strings.HasPrefix(d.lines[d.n], gitDiffPrefix):
+			fp, err = d.gitFilePatch()
+		case d.isTraditionalPatch():
+			fp, err = d.traditionalFilePatch()
+		default:
+			if len(p.files) == 0 {
+				message.WriteString(d.lines[d.n])
+			}
+
+			d.n++
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		p.files = append(p.files, fp)
+	}
+
+	if len(p.files) == 0 {
+		return ErrEmptyPatch
+	}
+
+	p.message = message.String()
+	return nil
+}
+
+// isTraditionalPatch returns true if the current line starts the patch of
+// a file without the git headers.
+func (d *Decoder) isTraditionalPatch() bool {
+	return d.n+2 < len(d.lines) &&
+		strings.HasPrefix(d.lines[d.n], fromPathPrefix) &&
+		strings.HasPrefix(d.lines[d.n+1], toPathPrefix) &&
+		strings.HasPrefix(d.lines[d.n+2], hunkPrefix)
+}
+
+func (d *Decoder) traditionalFilePatch() (*UnifiedFilePatch, error) {
+	fp := &UnifiedFilePatch{
+		FromPath: patchPath(d.lines[d.n][len(fromPathPrefix):]),
+		ToPath:   patchPath(d.lines[d.n+1][len(toPathPrefix):]),
+	}
+
+	d.n += 2
+	return fp, d.hunks(fp)
+}
+
+func (d *Decoder) gitFilePatch() (*UnifiedFilePatch, error) {
+	fp := &UnifiedFilePatch{}
+	fp.FromPath, fp.ToPath = gitHeaderPaths(trimNewline(d.lines[d.n][len(gitDiffPrefix):]))
+	d.n++
+
+	var created, deleted bool
+	var err error
+header:
+	for ; d.n < len(d.lines) && err == nil; d.n++ {
+		l := trimNewline(d.lines[d.n])
+		switch {
+		case strings.HasPrefix(l, "old mode "):
+			fp.FromMode, err = parseMode(l[len("old mode "):])
+		case strings.HasPrefix(l, "new mode "):
+			fp.ToMode, err = parseMode(l[len("new mode "):])
+		case strings.HasPrefix(l, "deleted file mode "):
+			fp.FromMode, err = parseMode(l[len("deleted file mode "):])
+			deleted = true
+		case strings.HasPrefix(l, "new file mode "):
+			fp.ToMode, err = parseMode(l[len("new file mode "):])
+			created = true
+		case strings.HasPrefix(l, "copy from "):
+			fp.FromPath, fp.Copy = unquote(l[len("copy from "):]), true
+		case strings.HasPrefix(l, "copy to "):
+			fp.ToPath, fp.Copy = unquote(l[len("copy to "):]), true
+		case strings.HasPrefix(l, "rename from "):
+			fp.FromPath, fp.Rename = unquote(l[len("rename from "):]), true
+		case strings.HasPrefix(l, "rename to "):
+			fp.ToPath, fp.Rename = unquote(l[len("rename to "):]), true
+		case strings.HasPrefix(l, "rename old "):
+			fp.FromPath, fp.Rename = unquote(l[len("rename old "):]), true
+		case strings.HasPrefix(l, "rename new "):
+			fp.ToPath, fp.Rename = unquote(l[len("rename new "):]), true
+		case strings.HasPrefix(l, "similarity index "):
+			fp.SimilarityIndex, err = strconv.Atoi(strings.TrimSuffix(l[len("similarity index "):], "%"))
+		case strings.HasPrefix(l, "dissimilarity index "):
+		case strings.HasPrefix(l, "index "):
+			err = parseIndex(fp, l[len("index "):])
+		case strings.HasPrefix(l, fromPathPrefix):
+			if p := patchPath(l[len(fromPathPrefix):]); p != "" {
+				fp.FromPath = p
+			}
+		case strings.HasPrefix(l, toPathPrefix):
+			if p := patchPath(l[len(toPathPrefix):]); p != "" {
+				fp.ToPath = p
+			}
+		default:
+			break header
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s at line %d: %s", ErrMalformedPatch, d.n, err)
+	}
+
+	if fp.FromPath == "" && !created || fp.ToPath == "" && !deleted {
+		return nil, fmt.Errorf("%s at line %d: missing file name", ErrMalformedPatch, d.n)
+	}
+
+	switch {
+	case created:
+		fp.FromPath = ""
+	case deleted:
+		fp.ToPath = ""
+	case fp.FromMode == filemode.Empty:
+		fp.FromMode = fp.ToMode
+	case fp.ToMode == filemode.Empty:
+		fp.ToMode = fp.FromMode
+	}
+
+	if d.n == len(d.lines) {
+		return fp, nil
+	}
+
+	switch l := d.lines[d.n]; {
+	case trimNewline(l) == strings.TrimSuffix(binaryPatch, "\n"):
+		d.n++
+		fp.Binary = true
+		return fp, d.binaryHunks(fp)
+	case strings.HasPrefix(l, binaryPrefix):
+		d.n++
+		fp.Binary = true
+		return fp, nil
+	}
+
+	return fp, d.hunks(fp)
+}
+
+func (d *Decoder) binaryHunks(fp *UnifiedFilePatch) error {
+	var err error
+	if fp.Forward, err = d.binaryHunk(); err != nil {
+		return err
+	}
+
+	if fp.Forward == nil {
+		return fmt.Errorf("%s at line %d: missing binary hunk", ErrMalformedPatch, d.n+1)
+	}
+
+	fp.Reverse, err = d.binaryHunk()
+	return err
+}
+
+// binaryHunk decodes a hunk of a git binary patch, ended by an empty line,
+// and returns nil if there is none.
+func (d *Decoder) binaryHunk() (*BinaryHunk, error) {
+	if d.n == len(d.lines) ||
+		!strings.HasPrefix(d.lines[d.n], "literal ") && !strings.HasPrefix(d.lines[d.n], "delta ") {
+		return nil, nil
+	}
+
+	start := d.n
+	header := d.lines[d.n]
+	d.n++
+
+	var lines []string
+	for ; d.n < len(d.lines) && trimNewline(d.lines[d.n]) != ""; d.n++ {
+		lines = append(lines, d.lines[d.n])
+	}
+
+	if d.n < len(d.lines) {
+		d.n++
+	}
+
+	h, err := decodeBinaryHunk(trimNewline(header)+"\n", lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s at line %d: %s", ErrMalformedPatch, start+1, err)
+	}
+
+	return h, nil
+}
+
+func (d *Decoder) hunks(fp *UnifiedFilePatch) error {
+	for d.n < len(d.lines) && strings.HasPrefix(d.lines[d.n], hunkPrefix) {
+		h, err := d.hunk()
+		if err != nil {
+			return err
+		}
+
+		fp.Hunks = append(fp.Hunks, h)
+	}
+
+	return nil
+}
+
+func (d *Decoder) hunk() (*UnifiedHunk, error) {
+	h := &UnifiedHunk{}
+	header := trimNewline(d.lines[d.n])
+	if err := parseHunkHeader(h, header); err != nil {
+		return nil, fmt.Errorf("%s at line %d: %s", ErrMalformedPatch, d.n+1, err)
+	}
+
+	d.n++
+	from, to := h.FromCount, h.ToCount
+	for from > 0 || to > 0 {
+		if d.n == len(d.lines) {
+			return nil, fmt.Errorf("%s at line %d: truncated hunk", ErrMalformedPatch, d.n)
+		}
+
+		l := d.lines[d.n]
+		var line HunkLine
+		switch l[0] {
+		case '\n', ' ':
+			line.Type, line.Text = Equal, strings.TrimPrefix(l, " ")
+			from, to = from-1, to-1
+		case '-':
+			line.Type, line.Text = Delete, l[1:]
+			from--
+		case '+':
+			line.Type, line.Text = Add, l[1:]
+			to--
+		default:
+			from = -1
+		}
+
+		if from < 0 || to < 0 {
+			return nil, fmt.Errorf("%s at line %d", ErrMalformedPatch, d.n+1)
+		}
+
+		d.n++
+		if !strings.HasSuffix(line.Text, "\n") {
+			line.Text += "\n"
+		}
+
+		if d.n < len(d.lines) && strings.HasPrefix(d.lines[d.n], noNewlinePrefix) {
+			line.Text = strings.TrimSuffix(line.Text, "\n")
+			d.n++
+		}
+
+		h.Lines = append(h.Lines, line)
+	}
+
+	return h, nil
+}
+
+// parseHunkHeader parses the line ranges and the function name of a hunk
+// header.
+func parseHunkHeader(h *UnifiedHunk, header string) error {
+	s := strings.TrimPrefix(header, hunkPrefix)
+	end := strings.Index(s, chunkEnd)
+	if end < 0 {
+		return errors.New("invalid hunk header")
+	}
+
+	ranges := strings.SplitN(s[:end], chunkMiddle, 2)
+	if len(ranges) != 2 {
+		return errors.New("invalid hunk header")
+	}
+
+	var err error
+	if h.FromLine, h.FromCount, err = parseRange(ranges[0]); err != nil {
+		return err
+	}
+
+	if h.ToLine, h.ToCount, err = parseRange(ranges[1]); err != nil {
+		return err
+	}
+
+	h.FuncName = strings.TrimPrefix(s[end+len(chunkEnd):], " ")
+	return nil
+}
+
+// parseRange parses a line range of a hunk header, the count being one if
+// it is missing.
+func parseRange(s string) (line, count int, err error) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if count, err = strconv.Atoi(s[i+1:]); err != nil {
+			return
+		}
+
+		s = s[:i]
+	}
+
+	line, err = strconv.Atoi(s)
+	return
+}
+
+// parseIndex parses the hashes and the optional mode of an index line.
+func parseIndex(fp *UnifiedFilePatch, s string) error {
+	hashes := s
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		m, err := parseMode(s[i+1:])
+		if err != nil {
+			return err
+		}
+
+		hashes, fp.FromMode, fp.ToMode = s[:i], m, m
+	}
+
+	i := strings.Index(hashes, rangeSeparator)
+	if i < 0 {
+		return fmt.Errorf("invalid index line: %q", s)
+	}
+
+	fp.FromIndex, fp.ToIndex = hashes[:i], hashes[i+len(rangeSeparator):]
+	return nil
+}
+
+func parseMode(s string) (filemode.FileMode, error) {
+	return filemode.New(strings.TrimSpace(s))
+}
+
+// gitHeaderPaths returns the paths of the "diff --git" line, without their
+// a/ and b/ prefixes. The paths with spaces are found only if they are the
+// same, the renames and copies have their paths in other header lines.
+func gitHeaderPaths(s string) (from, to string) {
+	if strings.HasPrefix(s, `"`) {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", ""
+		}
+
+		return unquotePath(q), unquotePath(strings.TrimPrefix(s[len(q):], " "))
+	}
+
+	if strings.HasSuffix(s, `"`) {
+		if i := strings.LastIndex(s, ` "`); i >= 0 {
+			return stripComponent(s[:i]), unquotePath(s[i+1:])
+		}
+	}
+
+	var spaces []int
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			continue
+		}
+
+		spaces = append(spaces, i)
+		if stripComponent(s[:i]) == stripComponent(s[i+1:]) {
+			return stripComponent(s[:i]), stripComponent(s[i+1:])
+		}
+	}
+
+	if len(spaces) == 1 {
+		return stripComponent(s[:spaces[0]]), stripComponent(s[spaces[0]+1:])
+	}
+
+	return "", ""
+}
+
+// patchPath returns the path of a "---" or "+++" line, empty for
+// /dev/null.
+func patchPath(s string) string {
+	s = trimNewline(s)
+	if !strings.HasPrefix(s, `"`) {
+		if i := strings.IndexByte(s, '\t'); i >= 0 {
+			s = s[:i]
+		}
+	}
+
+	if s == noFilePath {
+		return ""
+	}
+
+	return unquotePath(s)
+}
+
+// unquotePath returns a path, quoted by git if it has special characters,
+// without its first component.
+func unquotePath(s string) string {
+	return stripComponent(unquote(s))
+}
+
+// unquote returns a path quoted by git if it has special characters, the
+// escape sequences of C being the ones of Go.
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+
+	return s
+}
+
+// stripComponent returns path without its first component, the a/ or b/
+// prefix of the paths of git.
+func stripComponent(path string) string {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[i+1:]
+	}
+
+	return path
+}
+
+// splitLinesKeepEnds splits s in lines, keeping their newlines.
+func splitLinesKeepEnds(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+
+	return lines
+}
+
+func trimNewline(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
@@ -0,0 +1,239 @@
+package diff
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+
+	. "gopkg.in/check.v1"
+)
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+func (s *DecoderSuite) decode(c *C, patch string) *UnifiedPatch {
+	p := &UnifiedPatch{}
+	err := NewDecoder(strings.NewReader(patch)).Decode(p)
+	c.Assert(err, IsNil)
+	return p
+}
+
+func (s *DecoderSuite) TestDecode(c *C) {
+	p := s.decode(c, `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] change
+
+---
+ README | 3 ++-
+ 1 file changed, 2 insertions(+), 1 deletion(-)
+
+diff --git a/README b/README
+index 3e42e1d..0f2c5cd 100644
+--- a/README
++++ b/README
+@@ -1,3 +1,4 @@ func main() {
+ a
+-b
++B
++C
+ c
+@@ -10 +11 @@
+-j
+\ No newline at end of file
++J
+`)
+
+	c.Assert(p.Message(), Equals, `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] change
+
+---
+ README | 3 ++-
+ 1 file changed, 2 insertions(+), 1 deletion(-)
+
+`)
+
+	fps := p.UnifiedFilePatches()
+	c.Assert(fps, HasLen, 1)
+	fp := fps[0]
+	c.Assert(fp.FromPath, Equals, "README")
+	c.Assert(fp.ToPath, Equals, "README")
+	c.Assert(fp.FromMode, Equals, filemode.Regular)
+	c.Assert(fp.ToMode, Equals, filemode.Regular)
+	c.Assert(fp.FromIndex, Equals, "3e42e1d")
+	c.Assert(fp.ToIndex, Equals, "0f2c5cd")
+	c.Assert(fp.IsBinary(), Equals, false)
+
+	c.Assert(fp.Hunks, HasLen, 2)
+	c.Assert(fp.Hunks[0].FromLine, Equals, 1)
+	c.Assert(fp.Hunks[0].FromCount, Equals, 3)
+	c.Assert(fp.Hunks[0].ToLine, Equals, 1)
+	c.Assert(fp.Hunks[0].ToCount, Equals, 4)
+	c.Assert(fp.Hunks[0].FuncName, Equals, "func main() {")
+	c.Assert(fp.Hunks[0].Lines, DeepEquals, []HunkLine{
+		{Equal, "a\n"}, {Delete, "b\n"}, {Add, "B\n"}, {Add, "C\n"}, {Equal, "c\n"},
+	})
+
+	c.Assert(fp.Hunks[1].FromLine, Equals, 10)
+	c.Assert(fp.Hunks[1].FromCount, Equals, 1)
+	c.Assert(fp.Hunks[1].Lines, DeepEquals, []HunkLine{{Delete, "j"}, {Add, "J\n"}})
+	c.Assert(fp.Hunks[1].String(), Equals, "@@ -10 +11 @@\n-j\n\\ No newline at end of file\n+J\n")
+
+	from, to := fp.Files()
+	c.Assert(from.Path(), Equals, "README")
+	c.Assert(to.Path(), Equals, "README")
+
+	chunks := fp.Chunks()
+	c.Assert(chunks, HasLen, 6)
+	c.Assert(chunks[0].Type(), Equals, Equal)
+	c.Assert(chunks[1].Content(), Equals, "b\n")
+	c.Assert(chunks[2].Content(), Equals, "B\nC\n")
+}
+
+func (s *DecoderSuite) TestDecodeCreateDelete(c *C) {
+	p := s.decode(c, `diff --git a/new b/new
+new file mode 100755
+index 0000000..d00491f
+--- /dev/null
++++ b/new
+@@ -0,0 +1 @@
++1
+diff --git a/old b/old
+deleted file mode 100644
+index d00491f..0000000
+--- a/old
++++ /dev/null
+@@ -1 +0,0 @@
+-1
+diff --git a/empty b/empty
+new file mode 100644
+index 0000000..e69de29
+`)
+
+	fps := p.UnifiedFilePatches()
+	c.Assert(fps, HasLen, 3)
+	c.Assert(fps[0].FromPath, Equals, "")
+	c.Assert(fps[0].ToPath, Equals, "new")
+	c.Assert(fps[0].ToMode, Equals, filemode.Executable)
+	c.Assert(fps[0].Hunks, HasLen, 1)
+
+	c.Assert(fps[1].FromPath, Equals, "old")
+	c.Assert(fps[1].ToPath, Equals, "")
+	c.Assert(fps[1].FromMode, Equals, filemode.Regular)
+
+	c.Assert(fps[2].FromPath, Equals, "")
+	c.Assert(fps[2].ToPath, Equals, "empty")
+	c.Assert(fps[2].Hunks, HasLen, 0)
+
+	from, to := fps[1].Files()
+	c.Assert(from, NotNil)
+	c.Assert(to, IsNil)
+}
+
+func (s *DecoderSuite) TestDecodeRenameMode(c *C) {
+	p := s.decode(c, `diff --git a/foo b/bar
+similarity index 90%
+rename from foo
+rename to bar
+index 3e42e1d..0f2c5cd
+--- a/foo
++++ b/bar
+@@ -1 +1 @@
+-a
++b
+diff --git a/"quoted\tname" b/copy
+similarity index 100%
+copy from "quoted\tname"
+copy to copy
+diff --git a/script b/script
+old mode 100644
+new mode 100755
+`)
+
+	fps := p.UnifiedFilePatches()
+	c.Assert(fps, HasLen, 3)
+	c.Assert(fps[0].Rename, Equals, true)
+	c.Assert(fps[0].FromPath, Equals, "foo")
+	c.Assert(fps[0].ToPath, Equals, "bar")
+	c.Assert(fps[0].Similarity(), Equals, 90)
+	c.Assert(fps[0].Hunks, HasLen, 1)
+
+	c.Assert(fps[1].Copy, Equals, true)
+	c.Assert(fps[1].IsCopy(), Equals, true)
+	c.Assert(fps[1].FromPath, Equals, "quoted\tname")
+	c.Assert(fps[1].ToPath, Equals, "copy")
+	c.Assert(fps[1].Similarity(), Equals, 100)
+
+	c.Assert(fps[2].FromPath, Equals, "script")
+	c.Assert(fps[2].FromMode, Equals, filemode.Regular)
+	c.Assert(fps[2].ToMode, Equals, filemode.Executable)
+	c.Assert(fps[2].Hunks, HasLen, 0)
+}
+
+func (s *DecoderSuite) TestDecodeTraditional(c *C) {
+	p := s.decode(c, `--- a/dir/file.txt	2019-01-01 00:00:00
++++ b/dir/file.txt	2019-01-02 00:00:00
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+`)
+
+	fps := p.UnifiedFilePatches()
+	c.Assert(fps, HasLen, 1)
+	c.Assert(fps[0].FromPath, Equals, "dir/file.txt")
+	c.Assert(fps[0].ToPath, Equals, "dir/file.txt")
+	c.Assert(fps[0].FromMode, Equals, filemode.Empty)
+	c.Assert(fps[0].Hunks, HasLen, 1)
+}
+
+func (s *DecoderSuite) TestDecodeBinary(c *C) {
+	p := s.decode(c, `diff --git a/bin b/bin
+index c984a0442d5fba744241e9c2dd75d27f612d6cb2..d540b1497a48a6d289089d8cfa4a0675618a1fe5 100644
+GIT binary patch
+literal 7
+Ocmc~xEl(|Cr~m*990HmE
+
+literal 4
+Lcmc~xEoT4#1K9yf
+
+diff --git a/image.png b/image.png
+index 3e42e1d..0f2c5cd 100644
+Binary files a/image.png and b/image.png differ
+`)
+
+	fps := p.UnifiedFilePatches()
+	c.Assert(fps, HasLen, 2)
+	c.Assert(fps[0].IsBinary(), Equals, true)
+	c.Assert(fps[0].Forward, DeepEquals, &BinaryHunk{Data: []byte("newer\x00x")})
+	c.Assert(fps[0].Reverse, DeepEquals, &BinaryHunk{Data: []byte("new\x00")})
+
+	from, to, ok := fps[0].FullIndex()
+	c.Assert(ok, Equals, true)
+	c.Assert(from, Equals, plumbing.NewHash("c984a0442d5fba744241e9c2dd75d27f612d6cb2"))
+	c.Assert(to, Equals, plumbing.NewHash("d540b1497a48a6d289089d8cfa4a0675618a1fe5"))
+
+	c.Assert(fps[1].IsBinary(), Equals, true)
+	c.Assert(fps[1].Forward, IsNil)
+	_, _, ok = fps[1].FullIndex()
+	c.Assert(ok, Equals, false)
+}
+
+func (s *DecoderSuite) TestDecodeErrors(c *C) {
+	for _, patch := range []string{
+		"",
+		"some text\n",
+	} {
+		err := NewDecoder(strings.NewReader(patch)).Decode(&UnifiedPatch{})
+		c.Assert(err, Equals, ErrEmptyPatch)
+	}
+
+	for _, patch := range []string{
+		"diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n a\n",
+		"diff --git a/a b/a\n--- a/a\n+++ b/a\n@@ -x +1 @@\n-a\n+b\n",
+		"diff --git a/a b/a\nindex 3e42e1d..0f2c5cd 100644\nGIT binary patch\nliteral 4\n!!!\n\n",
+	} {
+		err := NewDecoder(strings.NewReader(patch)).Decode(&UnifiedPatch{})
+		c.Assert(err, NotNil, Commentf("%q", patch))
+	}
+}
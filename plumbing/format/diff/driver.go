@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitattributes"
+)
+
+const (
+	diffSection     = "diff"
+	diffAttribute   = "diff"
+	xfuncnameKey    = "xfuncname"
+	funcnameKey     = "funcname"
+	wordRegexKey    = "wordRegex"
+	funcNameMaxSize = 80
+)
+
+// Driver is a diff driver, selected for a path with the diff attribute. It
+// finds the function names written in the hunk headers and splits the lines
+// in words for the word diffs.
+type Driver struct {
+	funcName  []funcNamePattern
+	wordRegex *regexp.Regexp
+}
+
+type funcNamePattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// NewDriver returns a driver with the given patterns, as the xfuncname and
+// wordRegex options of a diff driver in the git config. The function name
+// patterns are separated by newlines, a line matching a pattern starting with
+// ! is not a function name. The function name is the first group of the
+// matching pattern, or the whole match if it has none. The default rules of
+// git are used for the empty patterns. The patterns are POSIX extended
+// regular expressions.
+func NewDriver(funcName, wordRegex string) (*Driver, error) {
+	d := &Driver{}
+	if funcName != "" {
+		for _, p := range strings.Split(funcName, "\n") {
+			var negate bool
+			if strings.HasPrefix(p, "!") {
+				p, negate = p[1:], true
+			}
+
+			re, err := regexp.CompilePOSIX(p)
+			if err != nil {
+				return nil, err
+			}
+
+			d.funcName = append(d.funcName, funcNamePattern{re, negate})
+		}
+	}
+
+	if wordRegex != "" {
+		re, err := regexp.CompilePOSIX(wordRegex)
+		if err != nil {
+			return nil, err
+		}
+
+		d.wordRegex = re
+	}
+
+	return d, nil
+}
+
+// FuncName returns the function name found in the given line, without the
+// trailing whitespace, and false if the line is not a function name.
+func (d *Driver) FuncName(line string) (string, bool) {
+	if d == nil || len(d.funcName) == 0 {
+		return defaultFuncName(line)
+	}
+
+	line = strings.TrimSuffix(line, "\r")
+	for _, p := range d.funcName {
+		m := p.re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+
+		if p.negate {
+			return "", false
+		}
+
+		start, end := m[0], m[1]
+		if len(m) > 3 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+
+		return funcNameText(line[start:end]), true
+	}
+
+	return "", false
+}
+
+// defaultFuncName matches the lines starting with a letter, an underscore
+// or a dollar sign, as git does without a diff driver.
+func defaultFuncName(line string) (string, bool) {
+	if line == "" {
+		return "", false
+	}
+
+	c := line[0]
+	if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$') {
+		return "", false
+	}
+
+	return funcNameText(line), true
+}
+
+// funcNameText truncates a function name as git does, and trims its
+// trailing whitespace.
+func funcNameText(s string) string {
+	if len(s) > funcNameMaxSize {
+		s = s[:funcNameMaxSize]
+	}
+
+	return strings.TrimRight(s, " \t\n\v\f\r")
+}
+
+// words returns the bounds of the words of s, the runs of non whitespace
+// characters or the matches of the word regex of the driver, which can not
+// span several lines.
+func (d *Driver) words(s string) [][2]int {
+	var ws [][2]int
+	for i := 0; i < len(s); {
+		var start, end int
+		if d != nil && d.wordRegex != nil {
+			m := d.wordRegex.FindStringIndex(s[i:])
+			if m == nil {
+				break
+			}
+
+			start, end = i+m[0], i+m[1]
+			if nl := strings.IndexByte(s[start:end], '\n'); nl >= 0 {
+				end = start + nl
+			}
+
+			if start >= end {
+				break
+			}
+		} else {
+			for start = i; start < len(s) && isSpace(s[start]); start++ {
+			}
+
+			if start == len(s) {
+				break
+			}
+
+			for end = start + 1; end < len(s) && !isSpace(s[end]); end++ {
+			}
+		}
+
+		ws = append(ws, [2]int{start, end})
+		i = end
+	}
+
+	return ws
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+
+	return false
+}
+
+// builtinWordRegexSuffix is appended to the word regexes of the built-in
+// drivers, to make words of the other non whitespace characters.
+const builtinWordRegexSuffix = `|[^[:space:]]`
+
+// builtinDrivers are the patterns of the diff drivers built in git, usable
+// without defining them in the config.
+var builtinDrivers = map[string]struct {
+	funcName, wordRegex string
+}{
+	"bash": {
+		funcName: `^[ \t]*((([a-zA-Z_][a-zA-Z0-9_]*[ \t]*\([ \t]*\))|` +
+			`(function[ \t]+[a-zA-Z_][a-zA-Z0-9_]*(([ \t]*\([ \t]*\))|([ \t]+))))` +
+			`[ \t]*(\{|\(\(?|\[\[))`,
+		wordRegex: `[^ \t]+`,
+	},
+	"golang": {
+		funcName: "^[ \t]*(func[ \t]*.*(\\{[ \t]*)?)\n" +
+			"^[ \t]*(type[ \t].*(struct|interface)[ \t]*(\\{[ \t]*)?)",
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.eE]+i?|0[xX]?[0-9a-fA-F]+i?` +
+			`|[-+*/<>%&^|=!:]=|--|\+\+|<<=?|>>=?|&\^=?|&&|\|\||<-|\.{3}`,
+	},
+	"java": {
+		funcName: "!^[ \t]*(catch|do|for|if|instanceof|new|return|switch|throw|while)\n" +
+			"^[ \t]*(([a-z-]+[ \t]+)*(class|enum|interface|record)[ \t]+.*)$\n" +
+			"^[ \t]*(([A-Za-z_<>&][][?&<>.,A-Za-z_0-9]*[ \t]+)+[A-Za-z_][A-Za-z_0-9]*[ \t]*\\([^;]*)$",
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.e]+[fFlL]?|0[xXbB]?[0-9a-fA-F]+[lL]?` +
+			`|[-+*/<>%&^|=!]=|--|\+\+|<<=?|>>>?=?|&&|\|\|`,
+	},
+	"python": {
+		funcName: `^[ \t]*((class|(async[ \t]+)?def)[ \t].*)$`,
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[-+0-9.e]+[jJlL]?|0[xX]?[0-9a-fA-F]+[lL]?` +
+			`|[-+*/<>%&^|=!]=|//=?|<<=?|>>=?|\*\*=?`,
+	},
+	"rust": {
+		funcName: `^[\t ]*((pub(\([^\)]+\))?[\t ]+)?((async|const|unsafe|extern([\t ]+"[^"]+"))[\t ]+)?` +
+			`(struct|enum|union|mod|trait|fn|impl|macro_rules!)[< \t]+[^;]*)$`,
+		wordRegex: `[a-zA-Z_][a-zA-Z0-9_]*` +
+			`|[0-9][0-9_a-fA-Fiosuxz]*(\.([0-9]*[eE][+-]?)?[0-9_fF]*)?` +
+			`|[-+*\/<>%&^|=!:]=|<<=?|>>=?|&&|\|\||->|=>|\.{2}=|\.{3}|::`,
+	},
+}
+
+// BuiltinDriver returns the driver with the given name built in git, such
+// as golang or python, and false if there is none.
+func BuiltinDriver(name string) (*Driver, bool) {
+	b, ok := builtinDrivers[name]
+	if !ok {
+		return nil, false
+	}
+
+	d, err := NewDriver(b.funcName, b.wordRegex+builtinWordRegexSuffix)
+	if err != nil {
+		return nil, false
+	}
+
+	return d, true
+}
+
+// DriverResolver returns the driver of the file at the given path, nil for
+// the default one.
+type DriverResolver func(path string) *Driver
+
+// NewAttributesDriverResolver returns a resolver selecting the driver of a
+// path with its diff attribute. The drivers are the ones built in git, with
+// their patterns replaced by the xfuncname, or funcname, and wordRegex
+// options of the diff.<driver> sections of the given config, if any. The
+// unknown drivers, and the ones with invalid patterns, are replaced by the
+// default one.
+func NewAttributesDriverResolver(m gitattributes.Matcher, cfg *config.Config) DriverResolver {
+	drivers := make(map[string]*Driver)
+	return func(path string) *Driver {
+		attrs := m.Match(strings.Split(path, "/"), []string{diffAttribute})
+		a, ok := attrs[diffAttribute]
+		if !ok || a.Value == "" {
+			return nil
+		}
+
+		d, ok := drivers[a.Value]
+		if !ok {
+			d = configDriver(cfg, a.Value)
+			drivers[a.Value] = d
+		}
+
+		return d
+	}
+}
+
+func configDriver(cfg *config.Config, name string) *Driver {
+	b, ok := builtinDrivers[name]
+	if ok {
+		b.wordRegex += builtinWordRegexSuffix
+	}
+
+	if cfg != nil {
+		for _, s := range cfg.Sections {
+			if !s.IsName(diffSection) || !s.HasSubsection(name) {
+				continue
+			}
+
+			ss := s.Subsection(name)
+			if v := ss.Option(funcnameKey); v != "" {
+				b.funcName, ok = v, true
+			}
+
+			if v := ss.Option(xfuncnameKey); v != "" {
+				b.funcName, ok = v, true
+			}
+
+			if v := ss.Option(wordRegexKey); v != "" {
+				b.wordRegex, ok = v, true
+			}
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	d, err := NewDriver(b.funcName, b.wordRegex)
+	if err != nil {
+		return nil
+	}
+
+	return d
+}
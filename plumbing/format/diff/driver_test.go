@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitattributes"
+)
+
+type DriverSuite struct{}
+
+var _ = Suite(&DriverSuite{})
+
+func (s *DriverSuite) TestDefaultFuncName(c *C) {
+	var d *Driver
+	name, ok := d.FuncName("func main() {  ")
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "func main() {")
+
+	_, ok = d.FuncName("\tindented")
+	c.Assert(ok, Equals, false)
+
+	_, ok = d.FuncName("")
+	c.Assert(ok, Equals, false)
+
+	name, ok = d.FuncName(strings.Repeat("a", 100))
+	c.Assert(ok, Equals, true)
+	c.Assert(name, HasLen, 80)
+}
+
+func (s *DriverSuite) TestNewDriver(c *C) {
+	d, err := NewDriver("!^SECTION skipped\n^SECTION (.*)$\n^== .* ==$", "")
+	c.Assert(err, IsNil)
+
+	name, ok := d.FuncName("SECTION one\r")
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "one")
+
+	name, ok = d.FuncName("== title ==")
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "== title ==")
+
+	_, ok = d.FuncName("SECTION skipped")
+	c.Assert(ok, Equals, false)
+
+	_, ok = d.FuncName("other")
+	c.Assert(ok, Equals, false)
+
+	_, err = NewDriver("(", "")
+	c.Assert(err, NotNil)
+}
+
+func (s *DriverSuite) TestBuiltinDriver(c *C) {
+	for name := range builtinDrivers {
+		_, ok := BuiltinDriver(name)
+		c.Assert(ok, Equals, true, Commentf("driver %s", name))
+	}
+
+	d, ok := BuiltinDriver("golang")
+	c.Assert(ok, Equals, true)
+
+	name, ok := d.FuncName("func (e *Encoder) Encode(p Patch) error {")
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "func (e *Encoder) Encode(p Patch) error {")
+
+	_, ok = d.FuncName("var x = 1")
+	c.Assert(ok, Equals, false)
+
+	_, ok = BuiltinDriver("unknown")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *DriverSuite) TestWords(c *C) {
+	var d *Driver
+	c.Assert(d.words(" a bc\n\td "), DeepEquals, [][2]int{{1, 2}, {3, 5}, {7, 8}})
+
+	d, _ = BuiltinDriver("golang")
+	c.Assert(d.words("x:=y+1"), DeepEquals, [][2]int{{0, 1}, {1, 3}, {3, 4}, {4, 6}})
+}
+
+func (s *DriverSuite) TestNewAttributesDriverResolver(c *C) {
+	attrs, err := gitattributes.ReadAttributes(strings.NewReader(
+		"*.go diff=golang\n*.txt diff=custom\n*.md diff=unknown\n*.bin -diff\n",
+	), nil)
+	c.Assert(err, IsNil)
+
+	cfg := config.New()
+	cfg.Section("diff").Subsection("custom").SetOption("xfuncname", "^# (.*)$")
+
+	r := NewAttributesDriverResolver(gitattributes.NewMatcher(attrs), cfg)
+	c.Assert(r("README.md"), IsNil)
+	c.Assert(r("data.bin"), IsNil)
+	c.Assert(r("other"), IsNil)
+
+	d := r("dir/main.go")
+	c.Assert(d, NotNil)
+	_, ok := d.FuncName("type T struct {")
+	c.Assert(ok, Equals, true)
+
+	d = r("notes.txt")
+	c.Assert(d, NotNil)
+	name, ok := d.FuncName("# Title")
+	c.Assert(ok, Equals, true)
+	c.Assert(name, Equals, "Title")
+}
@@ -39,6 +39,27 @@ type FilePatch interface {
 	Chunks() []Chunk
 }
 
+// SimilarityFilePatch is a FilePatch that can transform a file to another
+// one with a different path, in a rename or a copy.
+type SimilarityFilePatch interface {
+	FilePatch
+	// Similarity returns the similarity index, in percent, of the "from"
+	// and "to" Files of a rename or a copy.
+	Similarity() int
+	// IsCopy returns true if the "to" File is a copy of the "from" File,
+	// that is kept, and false if it is a rename.
+	IsCopy() bool
+}
+
+// BinaryFilePatch is a FilePatch of binary files whose contents can be
+// read, to write them in a git binary patch.
+type BinaryFilePatch interface {
+	FilePatch
+	// BinaryContents returns the contents of the "from" and "to" Files, nil
+	// for a missing File.
+	BinaryContents() (from, to []byte, err error)
+}
+
 // File contains all the file metadata necessary to print some patch formats.
 type File interface {
 	// Hash returns the File Hash.
@@ -56,3 +77,12 @@ type Chunk interface {
 	// Type contains the Operation to do with this Chunk.
 	Type() Operation
 }
+
+// IgnorableChunk is a Chunk that can be left out of a patch, as the changes
+// of blank lines ignored by git diff --ignore-blank-lines.
+type IgnorableChunk interface {
+	Chunk
+	// Ignorable returns true if the Chunk is left out of the patches when
+	// it is not close to the other changes.
+	Ignorable() bool
+}
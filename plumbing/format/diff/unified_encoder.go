@@ -14,7 +14,7 @@ const (
 
 	chunkStart  = "@@ -"
 	chunkMiddle = " +"
-	chunkEnd    = " @@%s\n"
+	chunkEnd    = " @@"
 	chunkCount  = "%d,%d"
 
 	noFilePath = "/dev/null"
@@ -37,6 +37,9 @@ const (
 	renameFrom     = "from"
 	renameTo       = "to"
 	renameFileMode = "rename %s %s\n"
+	copyFileMode   = "copy %s %s\n"
+
+	similarityIndex = "similarity index %d%%\n"
 
 	indexAndMode = "index %s..%s %o\n"
 	indexNoMode  = "index %s..%s\n"
@@ -46,7 +49,6 @@ const (
 
 // UnifiedEncoder encodes an unified diff into the provided Writer.
 // There are some unsupported features:
-//     - Similarity index for renames
 //     - Sort hash representation
 type UnifiedEncoder struct {
 	io.Writer
@@ -54,12 +56,49 @@ type UnifiedEncoder struct {
 	// ctxLines is the count of unchanged lines that will appear
 	// surrounding a change.
 	ctxLines int
+	opts     UnifiedEncoderOptions
 
 	buf bytes.Buffer
 }
 
+// UnifiedEncoderOptions are the options of a UnifiedEncoder.
+type UnifiedEncoderOptions struct {
+	// WordDiff is the format of the changed lines, written as whole lines
+	// if NoWordDiff.
+	WordDiff WordDiffMode
+	// Color is the palette of the colored output, the output is not colored
+	// if nil. The default palette of git is used by ColorWordDiff if nil.
+	Color ColorConfig
+	// Drivers returns the diff drivers of the files, used to find the
+	// function names of the hunk headers and the words of the word diffs.
+	// The default driver is used for every file if nil.
+	Drivers DriverResolver
+	// Binary writes the changes of the binary files, whose file patches
+	// implement BinaryFilePatch, as git binary patches that can be applied,
+	// instead of a "Binary files differ" line.
+	Binary bool
+}
+
 func NewUnifiedEncoder(w io.Writer, ctxLines int) *UnifiedEncoder {
-	return &UnifiedEncoder{ctxLines: ctxLines, Writer: w}
+	return NewUnifiedEncoderWithOptions(w, ctxLines, nil)
+}
+
+// NewUnifiedEncoderWithOptions returns a UnifiedEncoder writing to w with the
+// given options.
+func NewUnifiedEncoderWithOptions(w io.Writer, ctxLines int, opts *UnifiedEncoderOptions) *UnifiedEncoder {
+	e := &UnifiedEncoder{ctxLines: ctxLines, Writer: w}
+	if opts != nil {
+		e.opts = *opts
+	}
+
+	switch {
+	case e.opts.WordDiff == PorcelainWordDiff:
+		e.opts.Color = nil
+	case e.opts.WordDiff == ColorWordDiff && e.opts.Color == nil:
+		e.opts.Color = NewColorConfig()
+	}
+
+	return e
 }
 
 func (e *UnifiedEncoder) Encode(patch Patch) error {
@@ -76,20 +115,42 @@ func (e *UnifiedEncoder) Encode(patch Patch) error {
 
 func (e *UnifiedEncoder) encodeFilePatch(filePatches []FilePatch) error {
 	for _, p := range filePatches {
-		f, t := p.Files()
-		if err := e.header(f, t, p.IsBinary()); err != nil {
+		d := e.driver(p)
+		g := newHunksGenerator(p.Chunks(), e.ctxLines, d)
+		hunks := g.Generate()
+		if len(hunks) == 0 && len(p.Chunks()) != 0 && !mustShowHeader(p) {
+			continue
+		}
+
+		if err := e.header(p); err != nil {
 			return err
 		}
 
-		g := newHunksGenerator(p.Chunks(), e.ctxLines)
-		for _, c := range g.Generate() {
-			c.WriteTo(&e.buf)
+		for _, h := range hunks {
+			e.writeHunk(h, d)
 		}
 	}
 
 	return nil
 }
 
+// driver returns the diff driver of the file patch p.
+func (e *UnifiedEncoder) driver(p FilePatch) *Driver {
+	if e.opts.Drivers == nil {
+		return nil
+	}
+
+	from, to := p.Files()
+	switch {
+	case to != nil:
+		return e.opts.Drivers(to.Path())
+	case from != nil:
+		return e.opts.Drivers(from.Path())
+	default:
+		return nil
+	}
+}
+
 func (e *UnifiedEncoder) printMessage(message string) {
 	isEmpty := message == ""
 	hasSuffix := strings.HasSuffix(message, "\n")
@@ -100,183 +161,295 @@ func (e *UnifiedEncoder) printMessage(message string) {
 	e.buf.WriteString(message)
 }
 
-func (e *UnifiedEncoder) header(from, to File, isBinary bool) error {
+func (e *UnifiedEncoder) header(p FilePatch) error {
+	from, to := p.Files()
 	switch {
 	case from == nil && to == nil:
 		return nil
 	case from != nil && to != nil:
 		hashEquals := from.Hash() == to.Hash()
 
-		fmt.Fprintf(&e.buf, diffInit, from.Path(), to.Path())
+		e.meta(diffInit, from.Path(), to.Path())
 
 		if from.Mode() != to.Mode() {
-			fmt.Fprintf(&e.buf, oldMode+newMode, from.Mode(), to.Mode())
+			e.meta(oldMode+newMode, from.Mode(), to.Mode())
 		}
 
 		if from.Path() != to.Path() {
-			fmt.Fprintf(&e.buf,
-				renameFileMode+renameFileMode,
-				renameFrom, from.Path(), renameTo, to.Path())
+			e.similarityLines(p, from.Path(), to.Path())
 		}
 
 		if from.Mode() != to.Mode() && !hashEquals {
-			fmt.Fprintf(&e.buf, indexNoMode, from.Hash(), to.Hash())
+			e.meta(indexNoMode, from.Hash(), to.Hash())
 		} else if !hashEquals {
-			fmt.Fprintf(&e.buf, indexAndMode, from.Hash(), to.Hash(), from.Mode())
+			e.meta(indexAndMode, from.Hash(), to.Hash(), from.Mode())
 		}
 
 		if !hashEquals {
-			e.pathLines(isBinary, aDir+from.Path(), bDir+to.Path())
+			return e.pathLines(p, aDir+from.Path(), bDir+to.Path())
 		}
 	case from == nil:
-		fmt.Fprintf(&e.buf, diffInit, to.Path(), to.Path())
-		fmt.Fprintf(&e.buf, newFileMode, to.Mode())
-		fmt.Fprintf(&e.buf, indexNoMode, plumbing.ZeroHash, to.Hash())
-		e.pathLines(isBinary, noFilePath, bDir+to.Path())
+		e.meta(diffInit, to.Path(), to.Path())
+		e.meta(newFileMode, to.Mode())
+		e.meta(indexNoMode, plumbing.ZeroHash, to.Hash())
+		return e.pathLines(p, noFilePath, bDir+to.Path())
 	case to == nil:
-		fmt.Fprintf(&e.buf, diffInit, from.Path(), from.Path())
-		fmt.Fprintf(&e.buf, deletedFileMode, from.Mode())
-		fmt.Fprintf(&e.buf, indexNoMode, from.Hash(), plumbing.ZeroHash)
-		e.pathLines(isBinary, aDir+from.Path(), noFilePath)
+		e.meta(diffInit, from.Path(), from.Path())
+		e.meta(deletedFileMode, from.Mode())
+		e.meta(indexNoMode, from.Hash(), plumbing.ZeroHash)
+		return e.pathLines(p, aDir+from.Path(), noFilePath)
 	}
 
 	return nil
 }
 
-func (e *UnifiedEncoder) pathLines(isBinary bool, fromPath, toPath string) {
-	format := fPath + tPath
-	if isBinary {
-		format = binary
+// mustShowHeader returns true if the header of the patch is written even
+// without hunks, when all the changes of the contents are ignored.
+func mustShowHeader(p FilePatch) bool {
+	from, to := p.Files()
+	return from == nil || to == nil ||
+		from.Path() != to.Path() || from.Mode() != to.Mode()
+}
+
+// similarityLines writes the similarity index and the paths of a renamed or
+// copied file.
+func (e *UnifiedEncoder) similarityLines(p FilePatch, fromPath, toPath string) {
+	format := renameFileMode + renameFileMode
+	if sp, ok := p.(SimilarityFilePatch); ok {
+		if sp.Similarity() > 0 {
+			e.meta(similarityIndex, sp.Similarity())
+		}
+
+		if sp.IsCopy() {
+			format = copyFileMode + copyFileMode
+		}
 	}
 
-	fmt.Fprintf(&e.buf, format, fromPath, toPath)
+	e.meta(format, renameFrom, fromPath, renameTo, toPath)
 }
 
-type hunksGenerator struct {
-	fromLine, toLine            int
-	ctxLines                    int
-	chunks                      []Chunk
-	current                     *hunk
-	hunks                       []*hunk
-	beforeContext, afterContext []string
+func (e *UnifiedEncoder) pathLines(p FilePatch, fromPath, toPath string) error {
+	if !p.IsBinary() {
+		e.meta(fPath+tPath, fromPath, toPath)
+		return nil
+	}
+
+	bp, ok := p.(BinaryFilePatch)
+	if !e.opts.Binary || !ok {
+		fmt.Fprintf(&e.buf, binary, fromPath, toPath)
+		return nil
+	}
+
+	from, to, err := bp.BinaryContents()
+	if err != nil {
+		return err
+	}
+
+	e.buf.WriteString(binaryPatch)
+	if err := writeBinaryHunk(&e.buf, from, to); err != nil {
+		return err
+	}
+
+	return writeBinaryHunk(&e.buf, to, from)
 }
 
-func newHunksGenerator(chunks []Chunk, ctxLines int) *hunksGenerator {
-	return &hunksGenerator{
-		chunks:   chunks,
-		ctxLines: ctxLines,
+// meta writes the formatted header lines, in the meta color.
+func (e *UnifiedEncoder) meta(format string, a ...interface{}) {
+	for _, l := range splitLines(fmt.Sprintf(format, a...)) {
+		e.buf.WriteString(e.opts.Color.wrap(Meta, l))
+		e.buf.WriteByte('\n')
 	}
 }
 
-func (c *hunksGenerator) Generate() []*hunk {
-	for i, chunk := range c.chunks {
+// change is a run of deleted and added lines, at the line i1 of the "from"
+// file and i2 of the "to" file.
+type change struct {
+	i1, chg1 int
+	i2, chg2 int
+	// ignore is set if all the chunks of the change are ignorable.
+	ignore bool
+}
+
+// hunksGenerator groups the changes of a file patch in hunks as git does,
+// the ignorable changes being left out when they are not close enough to
+// other changes.
+type hunksGenerator struct {
+	ctxLines int
+	from, to []string
+	changes  []*change
+
+	// driver finds the function names of the hunk headers, funcLine is the
+	// line from which the last one was searched and funcName the last one
+	// found.
+	driver   *Driver
+	funcLine int
+	funcName string
+}
+
+func newHunksGenerator(chunks []Chunk, ctxLines int, driver *Driver) *hunksGenerator {
+	g := &hunksGenerator{ctxLines: ctxLines, driver: driver, funcLine: -1}
+
+	var current *change
+	for _, chunk := range chunks {
 		ls := splitLines(chunk.Content())
-		lsLen := len(ls)
+		if chunk.Type() == Equal {
+			g.from = append(g.from, ls...)
+			g.to = append(g.to, ls...)
+			current = nil
+			continue
+		}
+
+		if len(ls) == 0 {
+			continue
+		}
+
+		if current == nil {
+			current = &change{i1: len(g.from), i2: len(g.to), ignore: true}
+			g.changes = append(g.changes, current)
+		}
+
+		ic, ok := chunk.(IgnorableChunk)
+		current.ignore = current.ignore && ok && ic.Ignorable()
 
 		switch chunk.Type() {
-		case Equal:
-			c.fromLine += lsLen
-			c.toLine += lsLen
-			c.processEqualsLines(ls, i)
 		case Delete:
-			if lsLen != 0 {
-				c.fromLine++
-			}
-
-			c.processHunk(i, chunk.Type())
-			c.fromLine += lsLen - 1
-			c.current.AddOp(chunk.Type(), ls...)
+			g.from = append(g.from, ls...)
+			current.chg1 += len(ls)
 		case Add:
-			if lsLen != 0 {
-				c.toLine++
-			}
-			c.processHunk(i, chunk.Type())
-			c.toLine += lsLen - 1
-			c.current.AddOp(chunk.Type(), ls...)
+			g.to = append(g.to, ls...)
+			current.chg2 += len(ls)
 		}
+	}
 
-		if i == len(c.chunks)-1 && c.current != nil {
-			c.hunks = append(c.hunks, c.current)
+	return g
+}
+
+func (g *hunksGenerator) Generate() []*hunk {
+	var hunks []*hunk
+	for i := 0; i < len(g.changes); {
+		first, last, ok := g.bounds(i)
+		if !ok {
+			break
 		}
+
+		hunks = append(hunks, g.hunk(first, last))
+		i = last + 1
 	}
 
-	return c.hunks
+	return hunks
 }
 
-func (c *hunksGenerator) processHunk(i int, op Operation) {
-	if c.current != nil {
-		return
+// bounds returns the first and last changes of the hunk starting at the
+// change i. It skips the ignorable changes too far from the next ones, and
+// returns false if there are only ignorable changes left.
+func (g *hunksGenerator) bounds(i int) (first, last int, ok bool) {
+	cs := g.changes
+	maxCommon := 2 * g.ctxLines
+	maxIgnorable := g.ctxLines
+
+	first = i
+	for j := i; j < len(cs) && cs[j].ignore; j++ {
+		if j+1 == len(cs) || cs[j+1].i1-(cs[j].i1+cs[j].chg1) >= maxIgnorable {
+			first = j + 1
+		}
 	}
 
-	var ctxPrefix string
-	linesBefore := len(c.beforeContext)
-	if linesBefore > c.ctxLines {
-		ctxPrefix = " " + c.beforeContext[linesBefore-c.ctxLines-1]
-		c.beforeContext = c.beforeContext[linesBefore-c.ctxLines:]
-		linesBefore = c.ctxLines
+	if first == len(cs) {
+		return 0, 0, false
 	}
 
-	c.current = &hunk{ctxPrefix: ctxPrefix}
-	c.current.AddOp(Equal, c.beforeContext...)
-
-	switch op {
-	case Delete:
-		c.current.fromLine, c.current.toLine =
-			c.addLineNumbers(c.fromLine, c.toLine, linesBefore, i, Add)
-	case Add:
-		c.current.toLine, c.current.fromLine =
-			c.addLineNumbers(c.toLine, c.fromLine, linesBefore, i, Delete)
+	// ignored is the number of lines added by the ignorable changes
+	// following the last change of the hunk.
+	var ignored int
+	last = first
+loop:
+	for p, x := first, first+1; x < len(cs); p, x = x, x+1 {
+		distance := cs[x].i1 - (cs[p].i1 + cs[p].chg1)
+		switch {
+		case distance > maxCommon:
+			break loop
+		case distance < maxIgnorable && (!cs[x].ignore || last == p):
+			last, ignored = x, 0
+		case distance < maxIgnorable:
+			ignored += cs[x].chg2
+		case last != p && cs[x].i1+ignored-(cs[last].i1+cs[last].chg1) > maxCommon:
+			break loop
+		case !cs[x].ignore:
+			last, ignored = x, 0
+		default:
+			ignored += cs[x].chg2
+		}
 	}
 
-	c.beforeContext = nil
+	return first, last, true
 }
 
-// addLineNumbers obtains the line numbers in a new chunk
-func (c *hunksGenerator) addLineNumbers(la, lb int, linesBefore int, i int, op Operation) (cla, clb int) {
-	cla = la - linesBefore
-	// we need to search for a reference for the next diff
-	switch {
-	case linesBefore != 0 && c.ctxLines != 0:
-		if lb > c.ctxLines {
-			clb = lb - c.ctxLines + 1
-		} else {
-			clb = 1
-		}
-	case c.ctxLines == 0:
-		clb = lb
-	case i != len(c.chunks)-1:
-		next := c.chunks[i+1]
-		if next.Type() == op || next.Type() == Equal {
-			// this diff will be into this chunk
-			clb = lb + 1
-		}
+// hunk returns the hunk of the changes from first to last, with their
+// context lines.
+func (g *hunksGenerator) hunk(first, last int) *hunk {
+	fc, lc := g.changes[first], g.changes[last]
+	s1, s2 := fc.i1-g.ctxLines, fc.i2-g.ctxLines
+	if s1 < 0 {
+		s1 = 0
 	}
 
-	return
-}
+	if s2 < 0 {
+		s2 = 0
+	}
 
-func (c *hunksGenerator) processEqualsLines(ls []string, i int) {
-	if c.current == nil {
-		c.beforeContext = append(c.beforeContext, ls...)
-		return
+	after := g.ctxLines
+	if n := len(g.from) - (lc.i1 + lc.chg1); n < after {
+		after = n
+	}
+
+	if n := len(g.to) - (lc.i2 + lc.chg2); n < after {
+		after = n
+	}
+
+	e1, e2 := lc.i1+lc.chg1+after, lc.i2+lc.chg2+after
+
+	h := &hunk{funcName: g.findFuncName(s1)}
+
+	h.AddOp(Equal, g.to[s2:fc.i2]...)
+	i2 := fc.i2
+	for _, c := range g.changes[first : last+1] {
+		h.AddOp(Equal, g.to[i2:c.i2]...)
+		h.AddOp(Delete, g.from[c.i1:c.i1+c.chg1]...)
+		h.AddOp(Add, g.to[c.i2:c.i2+c.chg2]...)
+		i2 = c.i2 + c.chg2
 	}
 
-	c.afterContext = append(c.afterContext, ls...)
-	if len(c.afterContext) <= c.ctxLines*2 && i != len(c.chunks)-1 {
-		c.current.AddOp(Equal, c.afterContext...)
-		c.afterContext = nil
-	} else {
-		ctxLines := c.ctxLines
-		if ctxLines > len(c.afterContext) {
-			ctxLines = len(c.afterContext)
+	h.AddOp(Equal, g.to[i2:e2]...)
+
+	h.fromLine, h.fromCount = hunkLine(s1, e1-s1), e1-s1
+	h.toLine, h.toCount = hunkLine(s2, e2-s2), e2-s2
+	return h
+}
+
+// findFuncName returns the function name of the hunk starting at the line s1
+// of the "from" file, the closest line before it matched by the driver. The
+// search stops at the start of the previous hunk, whose function name is
+// kept if none is found.
+func (g *hunksGenerator) findFuncName(s1 int) string {
+	for l := s1 - 1; l > g.funcLine; l-- {
+		if name, ok := g.driver.FuncName(g.from[l]); ok {
+			g.funcName = name
+			break
 		}
-		c.current.AddOp(Equal, c.afterContext[:ctxLines]...)
-		c.hunks = append(c.hunks, c.current)
+	}
 
-		c.current = nil
-		c.beforeContext = c.afterContext[ctxLines:]
-		c.afterContext = nil
+	g.funcLine = s1 - 1
+	return g.funcName
+}
+
+// hunkLine returns the line number of the header of a hunk starting at the
+// index start, the line before the hunk if it is empty.
+func hunkLine(start, count int) int {
+	if count == 0 {
+		return start
 	}
+
+	return start + 1
 }
 
 func splitLines(s string) []string {
@@ -295,34 +468,66 @@ type hunk struct {
 	fromCount int
 	toCount   int
 
-	ctxPrefix string
-	ops       []*op
+	funcName string
+	ops      []*op
 }
 
-func (c *hunk) WriteTo(buf *bytes.Buffer) {
-	buf.WriteString(chunkStart)
-
-	if c.fromCount == 1 {
-		fmt.Fprintf(buf, "%d", c.fromLine)
-	} else {
-		fmt.Fprintf(buf, chunkCount, c.fromLine, c.fromCount)
+// writeHunk writes the hunk h of a file with the given driver.
+func (e *UnifiedEncoder) writeHunk(h *hunk, d *Driver) {
+	c := e.opts.Color
+	e.buf.WriteString(c.wrap(Frag, h.header()))
+	if h.funcName != "" {
+		e.buf.WriteString(c.wrap(Context, " "))
+		e.buf.WriteString(c.wrap(Func, h.funcName))
 	}
 
-	buf.WriteString(chunkMiddle)
+	e.buf.WriteByte('\n')
 
-	if c.toCount == 1 {
-		fmt.Fprintf(buf, "%d", c.toLine)
-	} else {
-		fmt.Fprintf(buf, chunkCount, c.toLine, c.toCount)
+	style, ok := wordDiffStyles[e.opts.WordDiff]
+	if !ok {
+		for _, o := range h.ops {
+			e.buf.WriteString(o.format(c))
+		}
+
+		return
 	}
 
-	fmt.Fprintf(buf, chunkEnd, c.ctxPrefix)
+	w := &wordDiff{buf: &e.buf, style: style, color: c, driver: d}
+	var minus, plus bytes.Buffer
+	for _, o := range h.ops {
+		switch o.t {
+		case Delete:
+			minus.WriteString(o.text + "\n")
+			continue
+		case Add:
+			plus.WriteString(o.text + "\n")
+			continue
+		}
+
+		if minus.Len() != 0 || plus.Len() != 0 {
+			w.Write(minus.String(), plus.String())
+			minus.Reset()
+			plus.Reset()
+		}
+
+		if e.opts.WordDiff == PorcelainWordDiff {
+			e.buf.WriteString(" " + o.text + "\n" + style.newline)
+		} else {
+			e.buf.WriteString(c.paintLine(Context, o.text) + "\n")
+		}
+	}
 
-	for _, d := range c.ops {
-		buf.WriteString(d.String())
+	if minus.Len() != 0 || plus.Len() != 0 {
+		w.Write(minus.String(), plus.String())
 	}
 }
 
+// header returns the line ranges of the header of the hunk.
+func (c *hunk) header() string {
+	return chunkStart + hunkRange(c.fromLine, c.fromCount) +
+		chunkMiddle + hunkRange(c.toLine, c.toCount) + chunkEnd
+}
+
 func (c *hunk) AddOp(t Operation, s ...string) {
 	ls := len(s)
 	switch t {
@@ -358,3 +563,57 @@ func (o *op) String() string {
 
 	return fmt.Sprintf(prefix, o.text)
 }
+
+// format returns the line of the operation in the given colors. The
+// whitespace errors of the added lines, the trailing whitespace and the
+// spaces before a tab in the indentation, are colored as git does.
+func (o *op) format(c ColorConfig) string {
+	if c == nil {
+		return o.String()
+	}
+
+	switch o.t {
+	case Add:
+		return c.wrap(New, "+") + whitespaceErrors(c, o.text) + "\n"
+	case Delete:
+		return c.wrap(Old, "-"+o.text) + "\n"
+	default:
+		return c.wrap(Context, " "+o.text) + "\n"
+	}
+}
+
+// whitespaceErrors returns the text of an added line in the new color, but
+// for its whitespace errors in the whitespace color and the tabs of its
+// indentation, not colored.
+func whitespaceErrors(c ColorConfig, text string) string {
+	trailing := len(strings.TrimRight(text, " \t\n\v\f\r"))
+	var line string
+	var written int
+	for i := 0; i < trailing; i++ {
+		if text[i] == ' ' {
+			continue
+		}
+
+		if text[i] != '\t' {
+			break
+		}
+
+		if written < i {
+			line += c.wrap(Whitespace, text[written:i]) + "\t"
+		} else {
+			line += text[written : i+1]
+		}
+
+		written = i + 1
+	}
+
+	if written < trailing {
+		line += c.wrap(New, text[written:trailing])
+	}
+
+	if trailing < len(text) {
+		line += c.wrap(Whitespace, text[trailing:])
+	}
+
+	return line
+}
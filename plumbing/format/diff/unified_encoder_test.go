@@ -65,6 +65,71 @@ func (s *UnifiedEncoderTestSuite) TestEncode(c *C) {
 	}
 }
 
+func (s *UnifiedEncoderTestSuite) TestEncodeWithOptions(c *C) {
+	for _, f := range optionsFixtures {
+		c.Log("executing: ", f.desc)
+
+		buffer := bytes.NewBuffer(nil)
+		e := NewUnifiedEncoderWithOptions(buffer, f.context, &f.opts)
+
+		err := e.Encode(f.patch)
+		c.Assert(err, IsNil)
+
+		c.Assert(buffer.String(), Equals, f.diff)
+	}
+}
+
+func (s *UnifiedEncoderTestSuite) TestEncodeWithDrivers(c *C) {
+	d, err := NewDriver("^SECTION (.*)$", "")
+	c.Assert(err, IsNil)
+
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoderWithOptions(buffer, 1, &UnifiedEncoderOptions{
+		Drivers: func(path string) *Driver {
+			c.Assert(path, Equals, "s.txt")
+			return d
+		},
+	})
+
+	err = e.Encode(testPatch{filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "s.txt", seed: "s1"},
+		to:   &testFile{mode: filemode.Regular, path: "s.txt", seed: "s2"},
+		chunks: []testChunk{
+			{content: "SECTION one\nl1\n", op: Equal},
+			{content: "l2\n", op: Delete},
+			{content: "L2\n", op: Add},
+			{content: "l3\nl4\nl5\nl6\n", op: Equal},
+			{content: "l7\n", op: Delete},
+			{content: "L7\n", op: Add},
+			{content: "l8\nSECTION two\n", op: Equal},
+			{content: "m1\n", op: Delete},
+			{content: "M1\n", op: Add},
+			{content: "m2\n", op: Equal},
+		},
+	}}})
+	c.Assert(err, IsNil)
+
+	c.Assert(buffer.String(), Equals, `diff --git a/s.txt b/s.txt
+index 54a20809d4386dd7ebae15a36868f3525ee52dae..d76173308e2b26ab3213a60324f0149941530f76 100644
+--- a/s.txt
++++ b/s.txt
+@@ -2,3 +2,3 @@ one
+ l1
+-l2
++L2
+ l3
+@@ -7,6 +7,6 @@ one
+ l6
+-l7
++L7
+ l8
+ SECTION two
+-m1
++M1
+ m2
+`)
+}
+
 var oneChunkPatch Patch = testPatch{
 	message: "",
 	filePatches: []testFilePatch{{
@@ -267,6 +332,70 @@ index 30d74d258442c7c65512eafab474568dd706c430..f079749c42ffdcc5f52ed2d3a6f15b09
 -test
 +test1
 `,
+}, {
+	patch: testPatch{
+		message: "",
+		filePatches: []testFilePatch{{
+			from: &testFile{
+				mode: filemode.Regular,
+				path: "test.txt",
+				seed: "test\n",
+			},
+			to: &testFile{
+				mode: filemode.Regular,
+				path: "test1.txt",
+				seed: "test\ntest1\n",
+			},
+			chunks: []testChunk{{
+				content: "test\n",
+				op:      Equal,
+			}, {
+				content: "test1\n",
+				op:      Add,
+			}},
+			similarity: 55,
+		}},
+	},
+	desc:    "rename file with similarity index",
+	context: 1,
+	diff: `diff --git a/test.txt b/test1.txt
+similarity index 55%
+rename from test.txt
+rename to test1.txt
+index 9daeafb9864cf43055ae93beb0afd6c7d144bfa4..259b24152b284e29e86afadf714ddc3c2aa8dfe8 100644
+--- a/test.txt
++++ b/test1.txt
+@@ -1 +1,2 @@
+ test
++test1
+`,
+}, {
+	patch: testPatch{
+		message: "",
+		filePatches: []testFilePatch{{
+			from: &testFile{
+				mode: filemode.Regular,
+				path: "test.txt",
+				seed: "test",
+			},
+			to: &testFile{
+				mode: filemode.Executable,
+				path: "test1.txt",
+				seed: "test",
+			},
+			similarity: 100,
+			copy:       true,
+		}},
+	},
+	desc:    "copy with file mode change",
+	context: 1,
+	diff: `diff --git a/test.txt b/test1.txt
+old mode 100644
+new mode 100755
+similarity index 100%
+copy from test.txt
+copy to test1.txt
+`,
 }, {
 	patch: testPatch{
 		message: "",
@@ -814,11 +943,67 @@ index 0adddcde4fd38042c354518351820eb06c417c82..553ae669c7a9303cf848fcc749a25692
 @@ -23 +22,0 @@ Y
 -Z
 `,
+}, {
+	patch: testPatch{
+		message: "",
+		filePatches: []testFilePatch{{
+			from: &testFile{
+				mode: filemode.Regular,
+				path: "blank.txt",
+				seed: "A\nB\nC\nD\nE\nF\nG\nH\nI\n",
+			},
+			to: &testFile{
+				mode: filemode.Regular,
+				path: "blank.txt",
+				seed: "A\n\nB\nC\nD\nE\nF\nG\n\nH\nX\n",
+			},
+
+			chunks: []testChunk{{
+				content: "A\n",
+				op:      Equal,
+			}, {
+				content:   "\n",
+				op:        Add,
+				ignorable: true,
+			}, {
+				content: "B\nC\nD\nE\nF\nG\n",
+				op:      Equal,
+			}, {
+				content:   "\n",
+				op:        Add,
+				ignorable: true,
+			}, {
+				content: "H\n",
+				op:      Equal,
+			}, {
+				content: "I\n",
+				op:      Delete,
+			}, {
+				content: "X\n",
+				op:      Add,
+			}},
+		}},
+	},
+	desc:    "ignorable blank lines",
+	context: 2,
+	diff: `diff --git a/blank.txt b/blank.txt
+index 00b737668745e7f594846d98f7b138185cd926e2..d741c61a12394ba21fd4d7ad85d179da835e181b 100644
+--- a/blank.txt
++++ b/blank.txt
+@@ -6,4 +7,5 @@ E
+ F
+ G
++
+ H
+-I
++X
+`,
 }}
 
 type testPatch struct {
 	message     string
 	filePatches []testFilePatch
+	binary      []testBinaryFilePatch
 }
 
 func (t testPatch) FilePatches() []FilePatch {
@@ -827,6 +1012,10 @@ func (t testPatch) FilePatches() []FilePatch {
 		result = append(result, f)
 	}
 
+	for _, f := range t.binary {
+		result = append(result, f)
+	}
+
 	return result
 }
 
@@ -835,8 +1024,10 @@ func (t testPatch) Message() string {
 }
 
 type testFilePatch struct {
-	from, to *testFile
-	chunks   []testChunk
+	from, to   *testFile
+	chunks     []testChunk
+	similarity int
+	copy       bool
 }
 
 func (t testFilePatch) IsBinary() bool {
@@ -864,6 +1055,14 @@ func (t testFilePatch) Chunks() []Chunk {
 	return result
 }
 
+func (t testFilePatch) Similarity() int {
+	return t.similarity
+}
+
+func (t testFilePatch) IsCopy() bool {
+	return t.copy
+}
+
 type testFile struct {
 	path string
 	mode filemode.FileMode
@@ -883,8 +1082,9 @@ func (t testFile) Path() string {
 }
 
 type testChunk struct {
-	content string
-	op      Operation
+	content   string
+	op        Operation
+	ignorable bool
 }
 
 func (t testChunk) Content() string {
@@ -895,9 +1095,152 @@ func (t testChunk) Type() Operation {
 	return t.op
 }
 
+func (t testChunk) Ignorable() bool {
+	return t.ignorable
+}
+
 type fixture struct {
 	desc    string
 	context int
 	diff    string
 	patch   Patch
 }
+
+type optionsFixture struct {
+	desc    string
+	context int
+	opts    UnifiedEncoderOptions
+	patch   testPatch
+	diff    string
+}
+
+var wordsPatch = testPatch{
+	filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "f.go", seed: "x y z"},
+		to:   &testFile{mode: filemode.Regular, path: "f.go", seed: "x w z"},
+		chunks: []testChunk{
+			{content: "func a() {\n1\n2\n3\n4\n5\n6\n", op: Equal},
+			{content: "x y z\n", op: Delete},
+			{content: "x w z\n", op: Add},
+		},
+	}},
+}
+
+var wordsHeader = `diff --git a/f.go b/f.go
+index d3d3cd2b064992af6ef0f3768103b24e2c8e7b4e..4b6c12edf89449defe24506f12c88e76566f1402 100644
+--- a/f.go
++++ b/f.go
+`
+
+var optionsFixtures = []optionsFixture{{
+	desc:    "colors",
+	context: 3,
+	opts:    UnifiedEncoderOptions{Color: NewColorConfig()},
+	patch:   wordsPatch,
+	diff: colorLines(wordsHeader) +
+		"\x1b[36m@@ -5,4 +5,4 @@\x1b[m \x1b[mfunc a() {\x1b[m\n" +
+		" 4\x1b[m\n 5\x1b[m\n 6\x1b[m\n" +
+		"\x1b[31m-x y z\x1b[m\n" +
+		"\x1b[32m+\x1b[m\x1b[32mx w z\x1b[m\n",
+}, {
+	desc:    "plain word diff",
+	context: 3,
+	opts:    UnifiedEncoderOptions{WordDiff: PlainWordDiff},
+	patch:   wordsPatch,
+	diff: wordsHeader + `@@ -5,4 +5,4 @@ func a() {
+4
+5
+6
+x [-y-]{+w+} z
+`,
+}, {
+	desc:    "porcelain word diff",
+	context: 3,
+	opts:    UnifiedEncoderOptions{WordDiff: PorcelainWordDiff, Color: NewColorConfig()},
+	patch:   wordsPatch,
+	diff: wordsHeader + `@@ -5,4 +5,4 @@ func a() {
+ 4
+~
+ 5
+~
+ 6
+~
+ x 
+-y
++w
+  z
+~
+`,
+}, {
+	desc:    "color word diff",
+	context: 3,
+	opts:    UnifiedEncoderOptions{WordDiff: ColorWordDiff},
+	patch:   wordsPatch,
+	diff: colorLines(wordsHeader) +
+		"\x1b[36m@@ -5,4 +5,4 @@\x1b[m \x1b[mfunc a() {\x1b[m\n" +
+		"4\x1b[m\n5\x1b[m\n6\x1b[m\n" +
+		"x \x1b[31my\x1b[m\x1b[32mw\x1b[m z\n",
+}, {
+	desc:    "word diff of several lines",
+	context: 1,
+	opts:    UnifiedEncoderOptions{WordDiff: PlainWordDiff},
+	patch: testPatch{
+		filePatches: []testFilePatch{{
+			from: &testFile{mode: filemode.Regular, path: "w", seed: "w1"},
+			to:   &testFile{mode: filemode.Regular, path: "w", seed: "w2"},
+			chunks: []testChunk{
+				{content: "a b\nc d\n", op: Delete},
+				{content: "a X\nnew line\n", op: Add},
+				{content: "e\n", op: Equal},
+				{content: "f g\nh\n", op: Delete},
+			},
+		}},
+	},
+	diff: `diff --git a/w b/w
+index 232bcd5c485f562f2cd1d742ddf59d0497f08ef1..0a3bc2ff63f806fdcb318dbbc064ba8a9baf541e 100644
+--- a/w
++++ b/w
+@@ -1,5 +1,3 @@
+a [-b-]
+[-c d-]{+X+}
+{+new line+}
+e
+[-f g-]
+[-h-]
+`,
+}, {
+	desc:    "whitespace errors",
+	context: 0,
+	opts:    UnifiedEncoderOptions{Color: NewColorConfig()},
+	patch: testPatch{
+		filePatches: []testFilePatch{{
+			from: &testFile{mode: filemode.Regular, path: "e", seed: "e1"},
+			to:   &testFile{mode: filemode.Regular, path: "e", seed: "e2"},
+			chunks: []testChunk{
+				{content: "a\n", op: Equal},
+				{content: "\t\n  \t x\nx \t\n\t \tx\n\n", op: Add},
+			},
+		}},
+	},
+	diff: colorLines(`diff --git a/e b/e
+index dcb04a773c20bc5732d514f3c9b16019bde4f27a..34610b3ef8494d7c0129a4ef144940e6ee0db186 100644
+--- a/e
++++ b/e
+`) +
+		"\x1b[36m@@ -1,0 +2,5 @@\x1b[m \x1b[ma\x1b[m\n" +
+		"\x1b[32m+\x1b[m\x1b[41m\t\x1b[m\n" +
+		"\x1b[32m+\x1b[m\x1b[41m  \x1b[m\t\x1b[32m x\x1b[m\n" +
+		"\x1b[32m+\x1b[m\x1b[32mx\x1b[m\x1b[41m \t\x1b[m\n" +
+		"\x1b[32m+\x1b[m\t\x1b[41m \x1b[m\t\x1b[32mx\x1b[m\n" +
+		"\x1b[32m+\x1b[m\n",
+}}
+
+// colorLines returns the given header lines in the default meta color.
+func colorLines(s string) string {
+	var out string
+	for _, l := range splitLines(s) {
+		out += "\x1b[1m" + l + "\x1b[m\n"
+	}
+
+	return out
+}
@@ -0,0 +1,175 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+	udiff "gopkg.in/src-d/go-git.v4/utils/diff"
+)
+
+// WordDiffMode is the format of the changed lines of the hunks.
+type WordDiffMode int
+
+const (
+	// NoWordDiff writes the removed and added lines.
+	NoWordDiff WordDiffMode = iota
+	// PlainWordDiff writes the changed lines once, with the removed words
+	// as [-words-] and the added ones as {+words+}.
+	PlainWordDiff
+	// PorcelainWordDiff writes the runs of unchanged, removed and added
+	// words on their own lines, starting with " ", "-" and "+", and the end
+	// of the changed lines as a "~" line. The colors are never used.
+	PorcelainWordDiff
+	// ColorWordDiff writes the changed lines once, with the removed and added
+	// words in color only.
+	ColorWordDiff
+)
+
+// wordStyle is the way a run of words is written.
+type wordStyle struct {
+	prefix, suffix string
+	color          ColorKey
+}
+
+// wordDiffStyle is the way the runs of words and the end of the lines are
+// written by a word diff mode.
+type wordDiffStyle struct {
+	old, new, ctx wordStyle
+	newline       string
+}
+
+var wordDiffStyles = map[WordDiffMode]wordDiffStyle{
+	PlainWordDiff: {
+		old:     wordStyle{"[-", "-]", Old},
+		new:     wordStyle{"{+", "+}", New},
+		ctx:     wordStyle{"", "", Context},
+		newline: "\n",
+	},
+	PorcelainWordDiff: {
+		old:     wordStyle{"-", "\n", ""},
+		new:     wordStyle{"+", "\n", ""},
+		ctx:     wordStyle{" ", "\n", ""},
+		newline: "~\n",
+	},
+	ColorWordDiff: {
+		old:     wordStyle{"", "", Old},
+		new:     wordStyle{"", "", New},
+		ctx:     wordStyle{"", "", Context},
+		newline: "\n",
+	},
+}
+
+// wordDiff writes the word diff of the removed and added lines of a hunk,
+// as git diff --word-diff does.
+type wordDiff struct {
+	buf    *bytes.Buffer
+	style  wordDiffStyle
+	color  ColorConfig
+	driver *Driver
+}
+
+// Write writes the word diff of the removed text minus and the added text
+// plus, made of whole lines.
+func (w *wordDiff) Write(minus, plus string) {
+	if plus == "" {
+		w.write(w.style.old, minus)
+		return
+	}
+
+	mw, pw := w.driver.words(minus), w.driver.words(plus)
+	var current, mi, pi int
+	for _, g := range wordChanges(minus, plus, mw, pw) {
+		mi, pi = mi+g.equal, pi+g.equal
+		mb, me := wordBounds(mw, mi, g.minus)
+		pb, pe := wordBounds(pw, pi, g.plus)
+		w.write(w.style.ctx, plus[current:pb])
+		w.write(w.style.old, minus[mb:me])
+		w.write(w.style.new, plus[pb:pe])
+		current = pe
+		mi, pi = mi+g.minus, pi+g.plus
+	}
+
+	w.write(w.style.ctx, plus[current:])
+}
+
+// write writes s with the given style, line by line.
+func (w *wordDiff) write(st wordStyle, s string) {
+	for s != "" {
+		text, rest := s, ""
+		i := strings.IndexByte(s, '\n')
+		if i >= 0 {
+			text, rest = s[:i], s[i+1:]
+		}
+
+		if text != "" {
+			w.buf.WriteString(w.color.Paint(st.color, st.prefix+text+st.suffix))
+		}
+
+		if i < 0 {
+			return
+		}
+
+		w.buf.WriteString(w.style.newline)
+		s = rest
+	}
+}
+
+// wordChange is a run of equal words followed by a run of removed and added
+// words.
+type wordChange struct {
+	equal, minus, plus int
+}
+
+// wordChanges returns the changes of the words of minus to the ones of plus.
+func wordChanges(minus, plus string, mw, pw [][2]int) []wordChange {
+	var changes []wordChange
+	var current wordChange
+	for _, d := range udiff.Do(joinWords(minus, mw), joinWords(plus, pw)) {
+		n := strings.Count(d.Text, "\n")
+		switch d.Type {
+		case dmp.DiffEqual:
+			if current.minus != 0 || current.plus != 0 {
+				changes = append(changes, current)
+				current = wordChange{}
+			}
+
+			current.equal += n
+		case dmp.DiffDelete:
+			current.minus += n
+		case dmp.DiffInsert:
+			current.plus += n
+		}
+	}
+
+	if current.minus != 0 || current.plus != 0 {
+		changes = append(changes, current)
+	}
+
+	return changes
+}
+
+// joinWords returns the words of s, one per line.
+func joinWords(s string, words [][2]int) string {
+	var b bytes.Buffer
+	for _, w := range words {
+		b.WriteString(s[w[0]:w[1]])
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// wordBounds returns the bounds of the n words starting at the word i, the
+// end of the previous word if n is zero.
+func wordBounds(words [][2]int, i, n int) (int, int) {
+	if n != 0 {
+		return words[i][0], words[i+n-1][1]
+	}
+
+	if i == 0 {
+		return 0, 0
+	}
+
+	return words[i-1][1], words[i-1][1]
+}
@@ -0,0 +1,142 @@
+// Package gitattributes implements parsing of gitattributes files and
+// matching of paths to the attributes they define.
+//
+// Each line of a gitattributes file is a pattern followed by a list of
+// attributes, in one of the forms:
+//
+//	name        the attribute is set
+//	-name       the attribute is unset
+//	!name       the attribute is unspecified
+//	name=value  the attribute is set to the given value
+//
+// Blank lines and lines starting with # are ignored, as well as negative
+// patterns and macro definitions, which are not supported.
+package gitattributes
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// File is the name of the files defining the attributes of the paths of
+// their directory.
+const File = ".gitattributes"
+
+const (
+	commentPrefix = "#"
+	macroPrefix   = "[attr]"
+)
+
+// ErrInvalidAttributeName is returned when an attribute name is empty or
+// starts with a dash.
+var ErrInvalidAttributeName = errors.New("invalid attribute name")
+
+// State is the state of an attribute for a path.
+type State int
+
+const (
+	// Unspecified is the state of an attribute not defined for a path, or
+	// reset with the !name form.
+	Unspecified State = iota
+	// Set is the state of an attribute given with the name form.
+	Set
+	// Unset is the state of an attribute given with the -name form.
+	Unset
+	// Value is the state of an attribute given with the name=value form.
+	Value
+)
+
+// Attribute is an attribute of a gitattributes line.
+type Attribute struct {
+	Name  string
+	State State
+	// Value is the value of an attribute in the Value state.
+	Value string
+}
+
+// IsSet returns true if the attribute is set, either with the name or the
+// name=value forms.
+func (a Attribute) IsSet() bool {
+	return a.State == Set || a.State == Value
+}
+
+// IsUnset returns true if the attribute is unset with the -name form.
+func (a Attribute) IsUnset() bool {
+	return a.State == Unset
+}
+
+// MatchAttribute is a line of a gitattributes file: a pattern and the
+// attributes of the paths it matches.
+type MatchAttribute struct {
+	Pattern    Pattern
+	Attributes []Attribute
+}
+
+// ReadAttributes reads the lines of a gitattributes file located in the
+// given domain, the path of its directory relative to the repository root.
+func ReadAttributes(r io.Reader, domain []string) ([]MatchAttribute, error) {
+	var result []MatchAttribute
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		m, ok, err := ParseAttributesLine(s.Text(), domain)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			result = append(result, m)
+		}
+	}
+
+	return result, s.Err()
+}
+
+// ParseAttributesLine parses a line of a gitattributes file located in the
+// given domain. It returns false if the line defines no attributes.
+func ParseAttributesLine(line string, domain []string) (MatchAttribute, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, commentPrefix) ||
+		strings.HasPrefix(line, macroPrefix) {
+		return MatchAttribute{}, false, nil
+	}
+
+	fields := strings.Fields(line)
+	if strings.HasPrefix(fields[0], "!") || len(fields) == 1 {
+		return MatchAttribute{}, false, nil
+	}
+
+	m := MatchAttribute{Pattern: ParsePattern(fields[0], domain)}
+	for _, f := range fields[1:] {
+		a, err := parseAttribute(f)
+		if err != nil {
+			return MatchAttribute{}, false, err
+		}
+
+		m.Attributes = append(m.Attributes, a)
+	}
+
+	return m, true, nil
+}
+
+func parseAttribute(s string) (Attribute, error) {
+	var a Attribute
+	switch {
+	case strings.HasPrefix(s, "-"):
+		a = Attribute{Name: s[1:], State: Unset}
+	case strings.HasPrefix(s, "!"):
+		a = Attribute{Name: s[1:], State: Unspecified}
+	case strings.Contains(s, "="):
+		i := strings.IndexByte(s, '=')
+		a = Attribute{Name: s[:i], State: Value, Value: s[i+1:]}
+	default:
+		a = Attribute{Name: s, State: Set}
+	}
+
+	if a.Name == "" || strings.HasPrefix(a.Name, "-") {
+		return Attribute{}, ErrInvalidAttributeName
+	}
+
+	return a, nil
+}
@@ -0,0 +1,58 @@
+package gitattributes
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type AttributesSuite struct{}
+
+var _ = Suite(&AttributesSuite{})
+
+func (s *AttributesSuite) TestReadAttributes(c *C) {
+	input := "# comment\n" +
+		"\n" +
+		"*.go text eol=lf -diff !merge\n" +
+		"[attr]binary -diff -merge -text\n" +
+		"!negated export-ignore\n" +
+		"lonely\n" +
+		"  docs/** export-ignore  \n"
+
+	ms, err := ReadAttributes(strings.NewReader(input), []string{"sub"})
+	c.Assert(err, IsNil)
+	c.Assert(ms, HasLen, 2)
+
+	c.Assert(ms[0].Attributes, DeepEquals, []Attribute{
+		{Name: "text", State: Set},
+		{Name: "eol", State: Value, Value: "lf"},
+		{Name: "diff", State: Unset},
+		{Name: "merge", State: Unspecified},
+	})
+	c.Assert(ms[0].Pattern.Match([]string{"sub", "main.go"}), Equals, true)
+	c.Assert(ms[0].Pattern.Match([]string{"main.go"}), Equals, false)
+
+	c.Assert(ms[1].Attributes, DeepEquals, []Attribute{
+		{Name: "export-ignore", State: Set},
+	})
+	c.Assert(ms[1].Pattern.Match([]string{"sub", "docs", "a", "b.md"}), Equals, true)
+}
+
+func (s *AttributesSuite) TestReadAttributesInvalidName(c *C) {
+	_, err := ReadAttributes(strings.NewReader("*.go --text\n"), nil)
+	c.Assert(err, Equals, ErrInvalidAttributeName)
+
+	_, err = ReadAttributes(strings.NewReader("*.go =lf\n"), nil)
+	c.Assert(err, Equals, ErrInvalidAttributeName)
+}
+
+func (s *AttributesSuite) TestAttributeState(c *C) {
+	c.Assert(Attribute{State: Set}.IsSet(), Equals, true)
+	c.Assert(Attribute{State: Value}.IsSet(), Equals, true)
+	c.Assert(Attribute{State: Unset}.IsSet(), Equals, false)
+	c.Assert(Attribute{State: Unset}.IsUnset(), Equals, true)
+	c.Assert(Attribute{State: Unspecified}.IsUnset(), Equals, false)
+}
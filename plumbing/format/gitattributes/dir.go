@@ -0,0 +1,53 @@
+package gitattributes
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const gitDir = ".git"
+
+// ReadPatterns reads the gitattributes files of the given directory of the
+// filesystem and of its subdirectories, recursively. The result is in the
+// order of increasing priority expected by NewMatcher.
+func ReadPatterns(fs billy.Filesystem, path []string) ([]MatchAttribute, error) {
+	ps, err := readAttributesFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	fis, err := fs.ReadDir(fs.Join(path...))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		if !fi.IsDir() || fi.Name() == gitDir {
+			continue
+		}
+
+		subps, err := ReadPatterns(fs, append(path[:len(path):len(path)], fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, subps...)
+	}
+
+	return ps, nil
+}
+
+func readAttributesFile(fs billy.Filesystem, path []string) ([]MatchAttribute, error) {
+	f, err := fs.Open(fs.Join(append(path[:len(path):len(path)], File)...))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return ReadAttributes(f, path)
+}
@@ -0,0 +1,33 @@
+package gitattributes
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+type DirSuite struct{}
+
+var _ = Suite(&DirSuite{})
+
+func (s *DirSuite) TestReadPatterns(c *C) {
+	fs := memfs.New()
+	c.Assert(util.WriteFile(fs, File, []byte("*.go diff=golang\n"), 0644), IsNil)
+	c.Assert(fs.MkdirAll("vendor/lib", os.ModePerm), IsNil)
+	c.Assert(util.WriteFile(fs, "vendor/"+File, []byte("*.go -diff\n"), 0644), IsNil)
+	c.Assert(fs.MkdirAll(".git", os.ModePerm), IsNil)
+	c.Assert(util.WriteFile(fs, ".git/"+File, []byte("* diff=none\n"), 0644), IsNil)
+
+	ps, err := ReadPatterns(fs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ps, HasLen, 2)
+
+	m := NewMatcher(ps)
+	a := m.Match([]string{"main.go"}, []string{"diff"})
+	c.Assert(a["diff"].Value, Equals, "golang")
+
+	a = m.Match([]string{"vendor", "lib", "lib.go"}, []string{"diff"})
+	c.Assert(a["diff"].IsUnset(), Equals, true)
+}
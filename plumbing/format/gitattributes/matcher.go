@@ -0,0 +1,49 @@
+package gitattributes
+
+// Matcher returns the attributes of the paths.
+type Matcher interface {
+	// Match returns the attributes of the given path, relative to the
+	// repository root, with the given names, or all of them if no name is
+	// given. Unspecified attributes are not returned.
+	Match(path []string, names []string) map[string]Attribute
+}
+
+// NewMatcher returns a matcher of the given lines, in the order of
+// increasing priority: the lines of the gitattributes file at the root of
+// the repository first, then those of the files down the tree.
+func NewMatcher(stack []MatchAttribute) Matcher {
+	return &matcher{stack}
+}
+
+type matcher struct {
+	stack []MatchAttribute
+}
+
+func (m *matcher) Match(path []string, names []string) map[string]Attribute {
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+
+	result := make(map[string]Attribute)
+	for _, ma := range m.stack {
+		if !ma.Pattern.Match(path) {
+			continue
+		}
+
+		for _, a := range ma.Attributes {
+			if len(wanted) != 0 && !wanted[a.Name] {
+				continue
+			}
+
+			if a.State == Unspecified {
+				delete(result, a.Name)
+				continue
+			}
+
+			result[a.Name] = a
+		}
+	}
+
+	return result
+}
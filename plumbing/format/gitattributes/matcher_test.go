@@ -0,0 +1,45 @@
+package gitattributes
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type MatcherSuite struct{}
+
+var _ = Suite(&MatcherSuite{})
+
+func (s *MatcherSuite) TestMatch(c *C) {
+	root, err := ReadAttributes(strings.NewReader(
+		"*.go text diff=golang\n"+
+			"*.png -text\n"), nil)
+	c.Assert(err, IsNil)
+
+	sub, err := ReadAttributes(strings.NewReader(
+		"*.go !diff export-subst\n"), []string{"sub"})
+	c.Assert(err, IsNil)
+
+	m := NewMatcher(append(root, sub...))
+
+	c.Assert(m.Match([]string{"main.go"}, nil), DeepEquals, map[string]Attribute{
+		"text": {Name: "text", State: Set},
+		"diff": {Name: "diff", State: Value, Value: "golang"},
+	})
+
+	c.Assert(m.Match([]string{"sub", "main.go"}, nil), DeepEquals, map[string]Attribute{
+		"text":         {Name: "text", State: Set},
+		"export-subst": {Name: "export-subst", State: Set},
+	})
+
+	c.Assert(m.Match([]string{"sub", "main.go"}, []string{"export-subst"}), DeepEquals,
+		map[string]Attribute{
+			"export-subst": {Name: "export-subst", State: Set},
+		})
+
+	c.Assert(m.Match([]string{"logo.png"}, nil), DeepEquals, map[string]Attribute{
+		"text": {Name: "text", State: Unset},
+	})
+
+	c.Assert(m.Match([]string{"README"}, nil), HasLen, 0)
+}
@@ -0,0 +1,91 @@
+package gitattributes
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	patternDirSep  = "/"
+	zeroToManyDirs = "**"
+)
+
+// Pattern is the pattern of a gitattributes line.
+type Pattern interface {
+	// Match returns true if the given path, relative to the repository
+	// root, matches the pattern.
+	Match(path []string) bool
+}
+
+type pattern struct {
+	domain  []string
+	pattern []string
+}
+
+// ParsePattern parses a gitattributes pattern, found in a file of the given
+// domain. A pattern without slashes matches the name of the paths at any
+// level below the domain, otherwise it matches the path relative to the
+// domain, as the gitignore patterns do. Unlike those, a pattern matching a
+// directory does not match the paths inside it.
+func ParsePattern(p string, domain []string) Pattern {
+	res := pattern{domain: domain}
+	if strings.Contains(p, patternDirSep) {
+		res.pattern = strings.Split(strings.TrimPrefix(p, patternDirSep), patternDirSep)
+	} else {
+		res.pattern = []string{p}
+	}
+
+	return &res
+}
+
+func (p *pattern) Match(path []string) bool {
+	if len(path) <= len(p.domain) {
+		return false
+	}
+
+	for i, e := range p.domain {
+		if path[i] != e {
+			return false
+		}
+	}
+
+	path = path[len(p.domain):]
+	if len(p.pattern) == 1 {
+		match, err := filepath.Match(p.pattern[0], path[len(path)-1])
+		return err == nil && match
+	}
+
+	return globMatch(p.pattern, path)
+}
+
+func globMatch(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == zeroToManyDirs {
+			// a trailing ** matches everything inside
+			if len(pattern) == 1 {
+				return len(path) != 0
+			}
+
+			for i := 0; i <= len(path); i++ {
+				if globMatch(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		match, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !match {
+			return false
+		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0
+}
@@ -0,0 +1,52 @@
+package gitattributes
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type PatternSuite struct{}
+
+var _ = Suite(&PatternSuite{})
+
+func (s *PatternSuite) TestMatchName(c *C) {
+	p := ParsePattern("*.txt", nil)
+	c.Assert(p.Match([]string{"a.txt"}), Equals, true)
+	c.Assert(p.Match([]string{"dir", "sub", "a.txt"}), Equals, true)
+	c.Assert(p.Match([]string{"a.txt", "file"}), Equals, false)
+	c.Assert(p.Match([]string{"a.go"}), Equals, false)
+}
+
+func (s *PatternSuite) TestMatchNameDoesNotMatchInsideDirectory(c *C) {
+	p := ParsePattern("vendor", nil)
+	c.Assert(p.Match([]string{"vendor"}), Equals, true)
+	c.Assert(p.Match([]string{"vendor", "lib.go"}), Equals, false)
+}
+
+func (s *PatternSuite) TestMatchPath(c *C) {
+	p := ParsePattern("/docs/*.md", nil)
+	c.Assert(p.Match([]string{"docs", "README.md"}), Equals, true)
+	c.Assert(p.Match([]string{"sub", "docs", "README.md"}), Equals, false)
+	c.Assert(p.Match([]string{"docs", "a", "README.md"}), Equals, false)
+}
+
+func (s *PatternSuite) TestMatchZeroToManyDirs(c *C) {
+	p := ParsePattern("docs/**/*.md", nil)
+	c.Assert(p.Match([]string{"docs", "README.md"}), Equals, true)
+	c.Assert(p.Match([]string{"docs", "a", "b", "README.md"}), Equals, true)
+	c.Assert(p.Match([]string{"docs", "a", "b", "main.go"}), Equals, false)
+
+	p = ParsePattern("**/testdata", nil)
+	c.Assert(p.Match([]string{"testdata"}), Equals, true)
+	c.Assert(p.Match([]string{"a", "b", "testdata"}), Equals, true)
+
+	p = ParsePattern("build/**", nil)
+	c.Assert(p.Match([]string{"build", "a", "b"}), Equals, true)
+	c.Assert(p.Match([]string{"build"}), Equals, false)
+}
+
+func (s *PatternSuite) TestMatchDomain(c *C) {
+	p := ParsePattern("*.md", []string{"docs"})
+	c.Assert(p.Match([]string{"docs", "README.md"}), Equals, true)
+	c.Assert(p.Match([]string{"README.md"}), Equals, false)
+	c.Assert(p.Match([]string{"docs"}), Equals, false)
+}
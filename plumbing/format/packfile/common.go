@@ -5,6 +5,7 @@ import (
 	"io"
 	"sync"
 
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
 )
@@ -26,6 +27,25 @@ const (
 // UpdateObjectStorage updates the storer with the objects in the given
 // packfile.
 func UpdateObjectStorage(s storer.Storer, packfile io.Reader) error {
+	return UpdateObjectStorageWithProgress(s, packfile, nil)
+}
+
+// UpdateObjectStorageWithProgress updates the storer with the objects in the
+// given packfile, sending the progress events of its parsing to h, if not nil.
+func UpdateObjectStorageWithProgress(
+	s storer.Storer,
+	packfile io.Reader,
+	h plumbing.ProgressHandler,
+) error {
+	if pw, ok := s.(storer.ProgressPackfileWriter); ok && h != nil {
+		w, err := pw.PackfileWriterWithProgress(h)
+		if err != nil {
+			return err
+		}
+
+		return writePackfile(w, packfile)
+	}
+
 	if pw, ok := s.(storer.PackfileWriter); ok {
 		return WritePackfileToObjectStorage(pw, packfile)
 	}
@@ -35,6 +55,7 @@ func UpdateObjectStorage(s storer.Storer, packfile io.Reader) error {
 		return err
 	}
 
+	p.SetProgressHandler(h)
 	_, err = p.Parse()
 	return err
 }
@@ -50,6 +71,10 @@ func WritePackfileToObjectStorage(
 		return err
 	}
 
+	return writePackfile(w, packfile)
+}
+
+func writePackfile(w io.WriteCloser, packfile io.Reader) (err error) {
 	defer ioutil.CheckClose(w, &err)
 
 	var n int64
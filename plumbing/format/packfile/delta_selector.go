@@ -21,11 +21,12 @@ var applyDelta = map[plumbing.ObjectType]bool{
 }
 
 type deltaSelector struct {
-	storer storer.EncodedObjectStorer
+	storer   storer.EncodedObjectStorer
+	progress plumbing.ProgressHandler
 }
 
 func newDeltaSelector(s storer.EncodedObjectStorer) *deltaSelector {
-	return &deltaSelector{s}
+	return &deltaSelector{storer: s}
 }
 
 // ObjectsToPack creates a list of ObjectToPack from the hashes
@@ -61,13 +62,16 @@ func (dw *deltaSelector) ObjectsToPack(
 		}
 	}
 
+	meter := plumbing.NewProgressMeter(dw.progress,
+		plumbing.CompressingObjects, int64(len(otp)))
+
 	var wg sync.WaitGroup
 	var once sync.Once
 	for _, objs := range objectGroups {
 		objs := objs
 		wg.Add(1)
 		go func() {
-			if walkErr := dw.walk(objs, packWindow); walkErr != nil {
+			if walkErr := dw.walk(objs, packWindow, meter); walkErr != nil {
 				once.Do(func() {
 					err = walkErr
 				})
@@ -81,6 +85,7 @@ func (dw *deltaSelector) ObjectsToPack(
 		return nil, err
 	}
 
+	meter.Done()
 	return otp, nil
 }
 
@@ -88,6 +93,9 @@ func (dw *deltaSelector) objectsToPack(
 	hashes []plumbing.Hash,
 	packWindow uint,
 ) ([]*ObjectToPack, error) {
+	meter := plumbing.NewProgressMeter(dw.progress,
+		plumbing.CountingObjects, int64(len(hashes)))
+
 	var objectsToPack []*ObjectToPack
 	for _, h := range hashes {
 		var o plumbing.EncodedObject
@@ -107,8 +115,10 @@ func (dw *deltaSelector) objectsToPack(
 		}
 
 		objectsToPack = append(objectsToPack, otp)
+		meter.Add(1, 0)
 	}
 
+	meter.Done()
 	if packWindow == 0 {
 		return objectsToPack, nil
 	}
@@ -220,9 +230,12 @@ func (dw *deltaSelector) sort(objectsToPack []*ObjectToPack) {
 func (dw *deltaSelector) walk(
 	objectsToPack []*ObjectToPack,
 	packWindow uint,
+	meter *plumbing.ProgressMeter,
 ) error {
 	indexMap := make(map[plumbing.Hash]*deltaIndex)
 	for i := 0; i < len(objectsToPack); i++ {
+		meter.Add(1, 0)
+
 		// Clean up the index map and reconstructed delta objects for anything
 		// outside our pack window, to save memory.
 		if i > int(packWindow) {
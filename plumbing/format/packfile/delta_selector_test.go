@@ -211,7 +211,7 @@ func (s *DeltaSelectorSuite) TestObjectsToPack(c *C) {
 	// creating a bunch of new objects.
 	otp, err = s.ds.objectsToPack(hashes, deltaWindowSize)
 	c.Assert(err, IsNil)
-	err = s.ds.walk(otp, deltaWindowSize)
+	err = s.ds.walk(otp, deltaWindowSize, nil)
 	c.Assert(err, IsNil)
 	c.Assert(len(otp), Equals, int(deltaWindowSize)+2)
 	targetIdx := len(otp) - 1
@@ -18,6 +18,7 @@ type Encoder struct {
 	w        *offsetWriter
 	zw       *zlib.Writer
 	hasher   plumbing.Hasher
+	progress plumbing.ProgressHandler
 
 	useRefDeltas bool
 }
@@ -41,6 +42,14 @@ func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool) *E
 	}
 }
 
+// SetProgressHandler sets the handler receiving the CountingObjects and
+// CompressingObjects events, while the objects to pack are selected, and the
+// WritingObjects events.
+func (e *Encoder) SetProgressHandler(h plumbing.ProgressHandler) {
+	e.progress = h
+	e.selector.progress = h
+}
+
 // Encode creates a packfile containing all the objects referenced in
 // hashes and writes it to the writer in the Encoder.  `packWindow`
 // specifies the size of the sliding window used to compare objects
@@ -62,13 +71,25 @@ func (e *Encoder) encode(objects []*ObjectToPack) (plumbing.Hash, error) {
 		return plumbing.ZeroHash, err
 	}
 
-	for _, o := range objects {
+	meter := plumbing.NewProgressMeter(e.progress,
+		plumbing.WritingObjects, int64(len(objects)))
+
+	for i, o := range objects {
 		if err := e.entry(o); err != nil {
 			return plumbing.ZeroHash, err
 		}
+
+		meter.Update(int64(i)+1, e.w.Offset())
+	}
+
+	h, err := e.footer()
+	if err != nil {
+		return h, err
 	}
 
-	return e.footer()
+	meter.Update(int64(len(objects)), e.w.Offset())
+	meter.Done()
+	return h, nil
 }
 
 func (e *Encoder) head(numEntries int) error {
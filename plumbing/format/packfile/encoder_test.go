@@ -72,6 +72,43 @@ func (s *EncoderSuite) TestCorrectPackWithOneEmptyObject(c *C) {
 	c.Assert(result, DeepEquals, expectedResult)
 }
 
+func (s *EncoderSuite) TestEncodeProgress(c *C) {
+	var hashes []plumbing.Hash
+	for i := 0; i < 3; i++ {
+		o := &plumbing.MemoryObject{}
+		o.SetType(plumbing.BlobObject)
+		_, err := o.Write(bytes.Repeat([]byte{byte('a' + i)}, 100))
+		c.Assert(err, IsNil)
+
+		h, err := s.store.SetEncodedObject(o)
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	var done []plumbing.ProgressEvent
+	s.enc.SetProgressHandler(plumbing.ProgressHandlerFunc(func(e plumbing.ProgressEvent) {
+		if e.Done {
+			done = append(done, e)
+		}
+	}))
+
+	_, err := s.enc.Encode(hashes, 10)
+	c.Assert(err, IsNil)
+
+	c.Assert(done, HasLen, 3)
+	for i, phase := range []plumbing.ProgressPhase{
+		plumbing.CountingObjects,
+		plumbing.CompressingObjects,
+		plumbing.WritingObjects,
+	} {
+		c.Assert(done[i].Phase, Equals, phase)
+		c.Assert(done[i].Current, Equals, int64(3))
+		c.Assert(done[i].Total, Equals, int64(3))
+	}
+
+	c.Assert(done[2].Bytes, Equals, int64(s.buf.Len()))
+}
+
 func (s *EncoderSuite) TestMaxObjectSize(c *C) {
 	o := s.store.NewEncodedObject()
 	o.SetSize(9223372036854775807)
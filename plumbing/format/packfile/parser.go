@@ -51,7 +51,8 @@ type Parser struct {
 	// delta content by offset, only used if source is not seekable
 	deltas map[int64][]byte
 
-	ob []Observer
+	ob       []Observer
+	progress plumbing.ProgressHandler
 }
 
 // NewParser creates a new Parser. The Scanner source must be seekable.
@@ -86,6 +87,12 @@ func NewParserWithStorage(
 	}, nil
 }
 
+// SetProgressHandler sets the handler receiving the ReceivingObjects events,
+// while the objects are read, and the ResolvingDeltas events.
+func (p *Parser) SetProgressHandler(h plumbing.ProgressHandler) {
+	p.progress = h
+}
+
 func (p *Parser) forEachObserver(f func(o Observer) error) error {
 	for _, o := range p.ob {
 		if err := f(o); err != nil {
@@ -175,6 +182,7 @@ func (p *Parser) init() error {
 
 func (p *Parser) indexObjects() error {
 	buf := new(bytes.Buffer)
+	meter := plumbing.NewProgressMeter(p.progress, plumbing.ReceivingObjects, int64(p.count))
 
 	for i := uint32(0); i < p.count; i++ {
 		buf.Reset()
@@ -257,18 +265,44 @@ func (p *Parser) indexObjects() error {
 
 		p.oiByOffset[oh.Offset] = ota
 		p.oi[i] = ota
+
+		if meter != nil {
+			read, err := p.scanner.r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			meter.Update(int64(i)+1, read)
+		}
 	}
 
+	meter.Done()
 	return nil
 }
 
 func (p *Parser) resolveDeltas() error {
+	var meter *plumbing.ProgressMeter
+	if p.progress != nil {
+		var deltas int64
+		for _, obj := range p.oi {
+			if obj.DiskType.IsDelta() {
+				deltas++
+			}
+		}
+
+		meter = plumbing.NewProgressMeter(p.progress, plumbing.ResolvingDeltas, deltas)
+	}
+
 	for _, obj := range p.oi {
 		content, err := p.get(obj)
 		if err != nil {
 			return err
 		}
 
+		if obj.DiskType.IsDelta() {
+			meter.Add(1, int64(len(content)))
+		}
+
 		if err := p.onInflatedObjectHeader(obj.Type, obj.Length, obj.Offset); err != nil {
 			return err
 		}
@@ -291,6 +325,7 @@ func (p *Parser) resolveDeltas() error {
 		}
 	}
 
+	meter.Done()
 	return nil
 }
 
@@ -77,6 +77,48 @@ func (s *ParserSuite) TestParserHashes(c *C) {
 	c.Assert(obs.objects, DeepEquals, objs)
 }
 
+func (s *ParserSuite) TestParserProgress(c *C) {
+	f := fixtures.Basic().One()
+	scanner := packfile.NewScanner(f.Packfile())
+
+	parser, err := packfile.NewParser(scanner)
+	c.Assert(err, IsNil)
+
+	var events []plumbing.ProgressEvent
+	parser.SetProgressHandler(plumbing.ProgressHandlerFunc(func(e plumbing.ProgressEvent) {
+		events = append(events, e)
+	}))
+
+	_, err = parser.Parse()
+	c.Assert(err, IsNil)
+
+	done := make(map[plumbing.ProgressPhase]plumbing.ProgressEvent)
+	var received int
+	for _, e := range events {
+		if e.Phase == plumbing.ReceivingObjects && !e.Done {
+			received++
+			c.Assert(e.Current, Equals, int64(received))
+		}
+
+		if e.Done {
+			done[e.Phase] = e
+		}
+	}
+
+	c.Assert(received, Equals, 31)
+	c.Assert(done, HasLen, 2)
+
+	receiving := done[plumbing.ReceivingObjects]
+	c.Assert(receiving.Current, Equals, int64(31))
+	c.Assert(receiving.Total, Equals, int64(31))
+	// the size of the packfile, without its checksum
+	c.Assert(receiving.Bytes, Equals, int64(84774))
+
+	resolving := done[plumbing.ResolvingDeltas]
+	c.Assert(resolving.Current, Equals, resolving.Total)
+	c.Assert(events[len(events)-1], DeepEquals, resolving)
+}
+
 func (s *ParserSuite) TestThinPack(c *C) {
 
 	// Initialize an empty repository
@@ -12,16 +12,24 @@ import (
 // Change values represent a detected change between two git trees.  For
 // modifications, From is the original status of the node and To is its
 // final status.  For insertions, From is the zero value and for
-// deletions To is the zero value.
+// deletions To is the zero value.  Renames and copies, see DetectRenames,
+// are modifications where From and To have different names.
 type Change struct {
 	From ChangeEntry
 	To   ChangeEntry
+	// Similarity is the similarity index, in percent, of the contents of
+	// From and To in a rename or a copy.
+	Similarity int
+	// Copy is true if the change is a copy of From to To, From being kept
+	// in the final tree.
+	Copy bool
 }
 
 var empty = ChangeEntry{}
 
 // Action returns the kind of action represented by the change, an
-// insertion, a deletion or a modification.
+// insertion, a deletion or a modification. Renames and copies are
+// modifications.
 func (c *Change) Action() (merkletrie.Action, error) {
 	if c.From == empty && c.To == empty {
 		return merkletrie.Action(0),
@@ -37,6 +45,20 @@ func (c *Change) Action() (merkletrie.Action, error) {
 	return merkletrie.Modify, nil
 }
 
+// IsRename returns true if the change is the rename of From to To.
+func (c *Change) IsRename() bool {
+	return c.isRenameOrCopy() && !c.Copy
+}
+
+// IsCopy returns true if the change is the copy of From to To.
+func (c *Change) IsCopy() bool {
+	return c.isRenameOrCopy() && c.Copy
+}
+
+func (c *Change) isRenameOrCopy() bool {
+	return c.From != empty && c.To != empty && c.From.Name != c.To.Name
+}
+
 // Files return the files before and after a change.
 // For insertions from will be nil. For deletions to will be nil.
 func (c *Change) Files() (from, to *File, err error) {
@@ -76,6 +98,13 @@ func (c *Change) String() string {
 		return fmt.Sprintf("malformed change")
 	}
 
+	switch {
+	case c.IsRename():
+		return fmt.Sprintf("<Action: Rename, Path: %s -> %s>", c.From.Name, c.To.Name)
+	case c.IsCopy():
+		return fmt.Sprintf("<Action: Copy, Path: %s -> %s>", c.From.Name, c.To.Name)
+	}
+
 	return fmt.Sprintf("<Action: %s, Path: %s>", action, c.name())
 }
 
@@ -90,15 +119,21 @@ func (c *Change) Patch() (*Patch, error) {
 // If context expires, an non-nil error will be returned
 // Provided context must be non-nil
 func (c *Change) PatchContext(ctx context.Context) (*Patch, error) {
-	return getPatchContext(ctx, "", c)
+	return getPatchContext(ctx, "", nil, c)
+}
+
+// PatchWithOptions returns a Patch with all the file changes in chunks,
+// computed with the given options. Provided context must be non-nil.
+func (c *Change) PatchWithOptions(ctx context.Context, opts *PatchOptions) (*Patch, error) {
+	return getPatchContext(ctx, "", opts, c)
 }
 
 func (c *Change) name() string {
-	if c.From != empty {
-		return c.From.Name
+	if c.To != empty {
+		return c.To.Name
 	}
 
-	return c.To.Name
+	return c.From.Name
 }
 
 // ChangeEntry values represent a node that has suffered a change.
@@ -153,5 +188,11 @@ func (c Changes) Patch() (*Patch, error) {
 // If context expires, an non-nil error will be returned
 // Provided context must be non-nil
 func (c Changes) PatchContext(ctx context.Context) (*Patch, error) {
-	return getPatchContext(ctx, "", c...)
+	return getPatchContext(ctx, "", nil, c...)
+}
+
+// PatchWithOptions returns a Patch with all the changes in chunks, computed
+// with the given options. Provided context must be non-nil.
+func (c Changes) PatchWithOptions(ctx context.Context, opts *PatchOptions) (*Patch, error) {
+	return getPatchContext(ctx, "", opts, c...)
 }
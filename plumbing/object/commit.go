@@ -97,6 +97,23 @@ func (c *Commit) Patch(to *Commit) (*Patch, error) {
 	return c.PatchContext(context.Background(), to)
 }
 
+// PatchWithOptions returns the Patch between the actual commit and the
+// provided one, computed with the given options. Error will be return if
+// context expires. Provided context must be non-nil
+func (c *Commit) PatchWithOptions(ctx context.Context, to *Commit, opts *PatchOptions) (*Patch, error) {
+	fromTree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return fromTree.PatchWithOptions(ctx, toTree, opts)
+}
+
 // Parents return a CommitIter to the parent Commits.
 func (c *Commit) Parents() CommitIter {
 	return NewCommitIter(c.s,
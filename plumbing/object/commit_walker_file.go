@@ -98,6 +98,10 @@ func (c *commitFileIter) getNextFileCommit() (*Commit, error) {
 func (c *commitFileIter) ForEach(cb func(*Commit) error) error {
 	for {
 		commit, nextErr := c.Next()
+		if nextErr == io.EOF {
+			break
+		}
+
 		if nextErr != nil {
 			return nextErr
 		}
@@ -108,6 +112,8 @@ func (c *commitFileIter) ForEach(cb func(*Commit) error) error {
 			return err
 		}
 	}
+
+	return nil
 }
 
 func (c *commitFileIter) Close() {
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
@@ -21,12 +24,28 @@ var (
 	ErrCanceled = errors.New("operation canceled")
 )
 
+// PatchOptions are the options of the computation of a patch.
+type PatchOptions struct {
+	// DiffTree are the options of the comparison of the trees, used by the
+	// patches of trees and commits. The renames are not detected if nil.
+	DiffTree *DiffTreeOptions
+	// Diff are the options of the line diffs of the contents of the files,
+	// the Myers algorithm is used if nil.
+	Diff *diff.Options
+}
+
 func getPatch(message string, changes ...*Change) (*Patch, error) {
 	ctx := context.Background()
-	return getPatchContext(ctx, message, changes...)
+	return getPatchContext(ctx, message, nil, changes...)
 }
 
-func getPatchContext(ctx context.Context, message string, changes ...*Change) (*Patch, error) {
+func getPatchContext(ctx context.Context, message string, opts *PatchOptions,
+	changes ...*Change) (*Patch, error) {
+	var diffOpts *diff.Options
+	if opts != nil {
+		diffOpts = opts.Diff
+	}
+
 	var filePatches []fdiff.FilePatch
 	for _, c := range changes {
 		select {
@@ -35,7 +54,7 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 		default:
 		}
 
-		fp, err := filePatchWithContext(ctx, c)
+		fp, err := filePatchWithContext(ctx, c, diffOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -46,7 +65,7 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 	return &Patch{message, filePatches}, nil
 }
 
-func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, error) {
+func filePatchWithContext(ctx context.Context, c *Change, opts *diff.Options) (fdiff.FilePatch, error) {
 	from, to, err := c.Files()
 	if err != nil {
 		return nil, err
@@ -62,10 +81,20 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 	}
 
 	if fIsBinary || tIsBinary {
-		return &textFilePatch{from: c.From, to: c.To}, nil
+		return &textFilePatch{
+			from:       c.From,
+			to:         c.To,
+			similarity: c.Similarity,
+			copy:       c.Copy,
+			binary:     true,
+			fromSize:   fileSize(from),
+			toSize:     fileSize(to),
+			fromFile:   from,
+			toFile:     to,
+		}, nil
 	}
 
-	diffs := diff.Do(fromContent, toContent)
+	diffs := diff.DoWithOptions(fromContent, toContent, opts)
 
 	var chunks []fdiff.Chunk
 	for _, d := range diffs {
@@ -85,19 +114,22 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 			op = fdiff.Add
 		}
 
-		chunks = append(chunks, &textChunk{d.Text, op})
+		ignorable := opts != nil && opts.IgnoreBlankLines && diff.IsBlank(d)
+		chunks = append(chunks, &textChunk{d.Text, op, ignorable})
 	}
 
 	return &textFilePatch{
-		chunks: chunks,
-		from:   c.From,
-		to:     c.To,
+		chunks:     chunks,
+		from:       c.From,
+		to:         c.To,
+		similarity: c.Similarity,
+		copy:       c.Copy,
 	}, nil
 
 }
 
 func filePatch(c *Change) (fdiff.FilePatch, error) {
-	return filePatchWithContext(context.Background(), c)
+	return filePatchWithContext(context.Background(), c, nil)
 }
 
 func fileContent(f *File) (content string, isBinary bool, err error) {
@@ -115,6 +147,14 @@ func fileContent(f *File) (content string, isBinary bool, err error) {
 	return
 }
 
+func fileSize(f *File) int64 {
+	if f == nil {
+		return 0
+	}
+
+	return f.Size
+}
+
 // textPatch is an implementation of fdiff.Patch interface
 type Patch struct {
 	message     string
@@ -177,10 +217,17 @@ func (f *changeEntryWrapper) Empty() bool {
 	return !f.ce.TreeEntry.Mode.IsFile()
 }
 
-// textFilePatch is an implementation of fdiff.FilePatch interface
+// textFilePatch is an implementation of fdiff.SimilarityFilePatch and
+// fdiff.BinaryFilePatch interfaces
 type textFilePatch struct {
-	chunks   []fdiff.Chunk
-	from, to ChangeEntry
+	chunks     []fdiff.Chunk
+	from, to   ChangeEntry
+	similarity int
+	copy       bool
+	// binary is set if any of the files is binary, of the given sizes.
+	binary           bool
+	fromSize, toSize int64
+	fromFile, toFile *File
 }
 
 func (tf *textFilePatch) Files() (from fdiff.File, to fdiff.File) {
@@ -206,10 +253,44 @@ func (t *textFilePatch) Chunks() []fdiff.Chunk {
 	return t.chunks
 }
 
-// textChunk is an implementation of fdiff.Chunk interface
+// BinaryContents returns the contents of the binary files, to write them in
+// a git binary patch.
+func (t *textFilePatch) BinaryContents() (from, to []byte, err error) {
+	if from, err = binaryContent(t.fromFile); err != nil {
+		return nil, nil, err
+	}
+
+	to, err = binaryContent(t.toFile)
+	return from, to, err
+}
+
+func binaryContent(f *File) ([]byte, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (t *textFilePatch) Similarity() int {
+	return t.similarity
+}
+
+func (t *textFilePatch) IsCopy() bool {
+	return t.copy
+}
+
+// textChunk is an implementation of fdiff.IgnorableChunk interface
 type textChunk struct {
-	content string
-	op      fdiff.Operation
+	content   string
+	op        fdiff.Operation
+	ignorable bool
 }
 
 func (t *textChunk) Content() string {
@@ -220,6 +301,10 @@ func (t *textChunk) Type() fdiff.Operation {
 	return t.op
 }
 
+func (t *textChunk) Ignorable() bool {
+	return t.ignorable
+}
+
 // FileStat stores the status of changes in content of a file.
 type FileStat struct {
 	Name     string
@@ -304,20 +389,7 @@ func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 			continue
 		}
 
-		cs := FileStat{}
-		from, to := fp.Files()
-		if from == nil {
-			// New File is created.
-			cs.Name = to.Path()
-		} else if to == nil {
-			// File is deleted.
-			cs.Name = from.Path()
-		} else if from.Path() != to.Path() {
-			// File is renamed. Not supported.
-			// cs.Name = fmt.Sprintf("%s => %s", from.Path(), to.Path())
-		} else {
-			cs.Name = from.Path()
-		}
+		cs := FileStat{Name: statName(fp.Files())}
 
 		for _, chunk := range fp.Chunks() {
 			switch chunk.Type() {
@@ -333,3 +405,359 @@ func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 
 	return fileStats
 }
+
+// statName returns the name of a file in a diffstat, with the changed part
+// of the paths of a renamed or copied file as {from => to}.
+func statName(from, to fdiff.File) string {
+	switch {
+	case from == nil:
+		return to.Path()
+	case to == nil || from.Path() == to.Path():
+		return from.Path()
+	}
+
+	a, b := from.Path(), to.Path()
+	var prefix int
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// The common suffix starts at a slash, which may be the last one of
+	// the common prefix.
+	var suffix int
+	minStart := prefix
+	if prefix > 0 {
+		minStart--
+	}
+
+	for i, j := len(a)-1, len(b)-1; i >= minStart && j >= minStart && a[i] == b[j]; i, j = i-1, j-1 {
+		if a[i] == '/' {
+			suffix = len(a) - i
+		}
+	}
+
+	aMid, bMid := len(a)-prefix-suffix, len(b)-prefix-suffix
+	if aMid < 0 {
+		aMid = 0
+	}
+
+	if bMid < 0 {
+		bMid = 0
+	}
+
+	name := a[prefix:prefix+aMid] + " => " + b[prefix:prefix+bMid]
+	if prefix+suffix == 0 {
+		return name
+	}
+
+	return a[:prefix] + "{" + name + "}" + a[len(a)-suffix:]
+}
+
+// StatOptions are the options of the diffstat of a patch.
+type StatOptions struct {
+	// Width is the width of the lines, 80 if zero.
+	Width int
+	// NameWidth is the maximum width of the file names, the longer ones
+	// being truncated. The width of the lines is the only limit if zero.
+	NameWidth int
+	// GraphWidth is the maximum width of the graphs of the changes. The
+	// width of the lines is the only limit if zero.
+	GraphWidth int
+	// Color is the palette of the graphs, not colored if nil.
+	Color fdiff.ColorConfig
+}
+
+// diffStat is the change of a file in a diffstat, the sizes of the files
+// if they are binary.
+type diffStat struct {
+	name           string
+	added, deleted int64
+	binary         bool
+}
+
+// diffStats returns the changes of the files of the patch, but for the
+// submodules.
+func (p *Patch) diffStats() []diffStat {
+	var stats []diffStat
+	for _, fp := range p.filePatches {
+		from, to := fp.Files()
+		if from == nil && to == nil {
+			continue
+		}
+
+		s := diffStat{name: statName(from, to)}
+		if tf, ok := fp.(*textFilePatch); ok && tf.binary {
+			s.binary = true
+			if tf.from.TreeEntry.Hash != tf.to.TreeEntry.Hash {
+				s.added, s.deleted = tf.toSize, tf.fromSize
+			}
+		} else if !ok && fp.IsBinary() {
+			s.binary = true
+		}
+
+		for _, c := range fp.Chunks() {
+			switch c.Type() {
+			case fdiff.Add:
+				s.added += int64(countLines(c.Content()))
+			case fdiff.Delete:
+				s.deleted += int64(countLines(c.Content()))
+			}
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// countLines returns the number of lines of s, the last one being counted
+// even without a newline.
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+
+	return n
+}
+
+// EncodeStat writes the diffstat of the patch, as git diff --stat does: the
+// number of changed lines of every file with a graph of the added and
+// removed ones, followed by a summary.
+func (p *Patch) EncodeStat(w io.Writer, opts *StatOptions) error {
+	if opts == nil {
+		opts = &StatOptions{}
+	}
+
+	stats := p.diffStats()
+	if len(stats) == 0 {
+		return nil
+	}
+
+	var maxChange int64
+	var maxLen, numberWidth, binWidth int
+	for _, s := range stats {
+		if n := utf8.RuneCountInString(s.name); n > maxLen {
+			maxLen = n
+		}
+
+		if s.binary {
+			// Bin XXX -> YYY bytes
+			if n := 14 + decimalWidth(s.added) + decimalWidth(s.deleted); n > binWidth {
+				binWidth = n
+			}
+
+			numberWidth = 3
+			continue
+		}
+
+		if s.added+s.deleted > maxChange {
+			maxChange = s.added + s.deleted
+		}
+	}
+
+	width := opts.Width
+	if width == 0 {
+		width = 80
+	}
+
+	if n := decimalWidth(maxChange); n > numberWidth {
+		numberWidth = n
+	}
+
+	if width < 16+6+numberWidth {
+		width = 16 + 6 + numberWidth
+	}
+
+	graphWidth := int(maxChange)
+	if maxChange+4 <= int64(binWidth) {
+		graphWidth = binWidth - 4
+	}
+
+	if opts.GraphWidth > 0 && opts.GraphWidth < graphWidth {
+		graphWidth = opts.GraphWidth
+	}
+
+	nameWidth := maxLen
+	if opts.NameWidth > 0 && opts.NameWidth < maxLen {
+		nameWidth = opts.NameWidth
+	}
+
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+
+		if opts.GraphWidth > 0 && graphWidth > opts.GraphWidth {
+			graphWidth = opts.GraphWidth
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	var adds, dels int64
+	for _, s := range stats {
+		name := statNameColumn(s.name, nameWidth)
+		if s.binary {
+			fmt.Fprintf(buf, " %s | %*s", name, numberWidth, "Bin")
+			if s.added != 0 || s.deleted != 0 {
+				fmt.Fprintf(buf, " %s -> %s bytes",
+					opts.Color.Paint(fdiff.Old, strconv.FormatInt(s.deleted, 10)),
+					opts.Color.Paint(fdiff.New, strconv.FormatInt(s.added, 10)))
+			}
+
+			buf.WriteByte('\n')
+			continue
+		}
+
+		adds, dels = adds+s.added, dels+s.deleted
+		add, del := s.added, s.deleted
+		if int64(graphWidth) <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add != 0 && del != 0 {
+				total = 2
+			}
+
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+
+		fmt.Fprintf(buf, " %s | %*d", name, numberWidth, s.added+s.deleted)
+		if s.added+s.deleted != 0 {
+			buf.WriteByte(' ')
+		}
+
+		if add != 0 {
+			buf.WriteString(opts.Color.Paint(fdiff.New, strings.Repeat("+", int(add))))
+		}
+
+		if del != 0 {
+			buf.WriteString(opts.Color.Paint(fdiff.Old, strings.Repeat("-", int(del))))
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString(statSummary(len(stats), adds, dels))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// statNameColumn returns the name padded to the given width, or truncated
+// with a leading "..." if longer, at a slash if possible.
+func statNameColumn(name string, width int) string {
+	n := utf8.RuneCountInString(name)
+	prefix := ""
+	if n > width {
+		prefix, width = "...", width-3
+		if width < 0 {
+			width = 0
+		}
+
+		rs := []rune(name)
+		name = string(rs[len(rs)-width:])
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[i:]
+		}
+
+		n = utf8.RuneCountInString(name)
+	}
+
+	if n < width {
+		name += strings.Repeat(" ", width-n)
+	}
+
+	return prefix + name
+}
+
+// scaleLinear scales the number of changes n to the width of the graph of
+// the maximum number of changes, making sure that there is at least one
+// character for any change.
+func scaleLinear(n int64, width int, max int64) int64 {
+	if n == 0 {
+		return 0
+	}
+
+	return 1 + n*int64(width-1)/max
+}
+
+func decimalWidth(n int64) int {
+	return len(strconv.FormatInt(n, 10))
+}
+
+// statSummary returns the summary line of a diffstat.
+func statSummary(files int, adds, dels int64) string {
+	if files == 0 {
+		return " 0 files changed\n"
+	}
+
+	s := fmt.Sprintf(" %d %s changed", files, plural(int64(files), "file", "files"))
+	if adds != 0 || dels == 0 {
+		s += fmt.Sprintf(", %d %s(+)", adds, plural(adds, "insertion", "insertions"))
+	}
+
+	if dels != 0 || adds == 0 {
+		s += fmt.Sprintf(", %d %s(-)", dels, plural(dels, "deletion", "deletions"))
+	}
+
+	return s + "\n"
+}
+
+func plural(n int64, one, many string) string {
+	if n == 1 {
+		return one
+	}
+
+	return many
+}
+
+// EncodeNumStat writes the number of added and removed lines of every file
+// of the patch, as git diff --numstat does. The numbers of the binary files
+// are written as "-".
+func (p *Patch) EncodeNumStat(w io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+	for _, s := range p.diffStats() {
+		if s.binary {
+			fmt.Fprintf(buf, "-\t-\t%s\n", s.name)
+		} else {
+			fmt.Fprintf(buf, "%d\t%d\t%s\n", s.added, s.deleted, s.name)
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// EncodeShortStat writes the summary of the diffstat of the patch, as git
+// diff --shortstat does.
+func (p *Patch) EncodeShortStat(w io.Writer) error {
+	stats := p.diffStats()
+	if len(stats) == 0 {
+		return nil
+	}
+
+	var adds, dels int64
+	for _, s := range stats {
+		if !s.binary {
+			adds, dels = adds+s.added, dels+s.deleted
+		}
+	}
+
+	_, err := io.WriteString(w, statSummary(len(stats), adds, dels))
+	return err
+}
@@ -1,10 +1,14 @@
 package object
 
 import (
+	"bytes"
+
 	. "gopkg.in/check.v1"
 	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
@@ -43,3 +47,100 @@ func (s *PatchSuite) TestStatsWithSubmodules(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(p, NotNil)
 }
+
+func (s *PatchSuite) TestStatName(c *C) {
+	file := func(path string) fdiff.File {
+		return &changeEntryWrapper{ChangeEntry{
+			Name:      path,
+			TreeEntry: TreeEntry{Mode: filemode.Regular},
+		}}
+	}
+
+	for _, t := range []struct {
+		from, to, name string
+	}{
+		{"foo", "foo", "foo"},
+		{"foo", "bar", "foo => bar"},
+		{"a/b/c.go", "a/d/c.go", "a/{b => d}/c.go"},
+		{"dir/a", "dir/b", "dir/{a => b}"},
+		{"x/y/z/file", "file", "x/y/z/file => file"},
+		{"top", "x/top", "top => x/top"},
+	} {
+		c.Assert(statName(file(t.from), file(t.to)), Equals, t.name)
+	}
+
+	c.Assert(statName(nil, file("new")), Equals, "new")
+	c.Assert(statName(file("old"), nil), Equals, "old")
+}
+
+func (s *PatchSuite) TestEncodeStat(c *C) {
+	p := s.patch(c, "b8e471f58bcbca63b07bda20e428190409c2db47", "1980fcf55330d9d94c34abee5ab734afecf96aba")
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(p.EncodeStat(buf, nil), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		" binary.jpg       |  Bin 0 -> 76110 bytes\n"+
+		" go/example.go    |  136 ++\n"+
+		" haskal/haskal.hs |    1 +\n"+
+		" json/long.json   | 6492 ++++++++++++++++++++++++++++++++++++++++++++++++++++++\n"+
+		" json/short.json  |   22 +\n"+
+		" php/crappy.php   |  259 +++\n"+
+		" vendor/foo.go    |    7 +\n"+
+		" 7 files changed, 6917 insertions(+)\n")
+
+	buf.Reset()
+	c.Assert(p.EncodeStat(buf, &StatOptions{Width: 60, GraphWidth: 20}), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		" binary.jpg       |  Bin 0 -> 76110 bytes\n"+
+		" go/example.go    |  136 +\n"+
+		" haskal/haskal.hs |    1 +\n"+
+		" json/long.json   | 6492 ++++++++++++++++++++\n"+
+		" json/short.json  |   22 +\n"+
+		" php/crappy.php   |  259 +\n"+
+		" vendor/foo.go    |    7 +\n"+
+		" 7 files changed, 6917 insertions(+)\n")
+
+	buf.Reset()
+	c.Assert(p.EncodeNumStat(buf), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"-\t-\tbinary.jpg\n"+
+		"136\t0\tgo/example.go\n"+
+		"1\t0\thaskal/haskal.hs\n"+
+		"6492\t0\tjson/long.json\n"+
+		"22\t0\tjson/short.json\n"+
+		"259\t0\tphp/crappy.php\n"+
+		"7\t0\tvendor/foo.go\n")
+
+	buf.Reset()
+	c.Assert(p.EncodeShortStat(buf), IsNil)
+	c.Assert(buf.String(), Equals, " 7 files changed, 6917 insertions(+)\n")
+}
+
+func (s *PatchSuite) TestEncodeStatWithDeletions(c *C) {
+	p := s.patch(c, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "1980fcf55330d9d94c34abee5ab734afecf96aba")
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(p.EncodeStat(buf, &StatOptions{Color: fdiff.NewColorConfig()}), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		" go/example.go    | 6 \x1b[31m------\x1b[m\n"+
+		" haskal/haskal.hs | 1 \x1b[32m+\x1b[m\n"+
+		" 2 files changed, 1 insertion(+), 6 deletions(-)\n")
+
+	buf.Reset()
+	c.Assert(p.EncodeShortStat(buf), IsNil)
+	c.Assert(buf.String(), Equals, " 2 files changed, 1 insertion(+), 6 deletions(-)\n")
+}
+
+func (s *PatchSuite) patch(c *C, from, to string) *Patch {
+	storer := filesystem.NewStorage(
+		fixtures.ByTag("merge-conflict").One().DotGit(), cache.NewObjectLRUDefault())
+
+	fc, err := GetCommit(storer, plumbing.NewHash(from))
+	c.Assert(err, IsNil)
+	tc, err := GetCommit(storer, plumbing.NewHash(to))
+	c.Assert(err, IsNil)
+
+	p, err := fc.Patch(tc)
+	c.Assert(err, IsNil)
+	return p
+}
@@ -0,0 +1,426 @@
+package object
+
+import (
+	"context"
+	"hash/fnv"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// maxChunkSize is the maximum length of the chunks of content compared to
+// compute the similarity of two files. Text files are split in lines, the
+// lines longer than maxChunkSize being split in several chunks.
+const maxChunkSize = 64
+
+// DiffTreeOptions are the options of a comparison of two trees.
+type DiffTreeOptions struct {
+	// DetectRenames reports a deleted file and an inserted file with the
+	// same or a similar content as a rename.
+	DetectRenames bool
+	// RenameScore is the minimum similarity index, in percent, of the
+	// contents of the files of a rename or a copy.
+	RenameScore uint
+	// RenameLimit limits the comparison of contents to the diffs where the
+	// number of sources multiplied by the number of destinations is lower
+	// than its square, only the renames of identical files are detected in
+	// the bigger ones. Zero means no limit.
+	RenameLimit uint
+	// OnlyExactRenames only detects the renames and copies of identical
+	// files.
+	OnlyExactRenames bool
+	// DetectCopies reports an inserted file with the same or a similar
+	// content as a modified or a deleted file as a copy. As git does by
+	// default, the unmodified files are not considered as sources.
+	DetectCopies bool
+}
+
+// DefaultDiffTreeOptions are the default options of git: renames are
+// detected for a similarity index of at least 50%, the contents being
+// compared for up to 1000 sources and destinations.
+var DefaultDiffTreeOptions = &DiffTreeOptions{
+	DetectRenames: true,
+	RenameScore:   50,
+	RenameLimit:   1000,
+}
+
+// DiffTreeWithOptions compares the content and mode of the blobs found via
+// two tree objects, detecting the renames and copies according to the given
+// options. Provided context must be non-nil. An error will be return if
+// context expires.
+func DiffTreeWithOptions(ctx context.Context, a, b *Tree, opts *DiffTreeOptions) (Changes, error) {
+	changes, err := DiffTreeContext(ctx, a, b)
+	if err != nil || opts == nil || !opts.DetectRenames {
+		return changes, err
+	}
+
+	s := a
+	if s == nil {
+		s = b
+	}
+
+	if s == nil {
+		return changes, nil
+	}
+
+	return detectRenames(ctx, s.s, changes, opts)
+}
+
+// DetectRenames replaces the deletions and insertions of the given changes
+// that are renames or copies, as set in the options, by a single change from
+// the source to the destination file. The contents of the files are read
+// from the given storer.
+//
+// The identical files are matched first, preferring the files with the same
+// base name, then the files with a similarity index of at least
+// RenameScore, the most similar first.
+func DetectRenames(s storer.EncodedObjectStorer, changes Changes, opts *DiffTreeOptions) (Changes, error) {
+	if opts == nil || !opts.DetectRenames {
+		return changes, nil
+	}
+
+	return detectRenames(context.Background(), s, changes, opts)
+}
+
+func detectRenames(ctx context.Context, s storer.EncodedObjectStorer,
+	changes Changes, opts *DiffTreeOptions) (Changes, error) {
+	d := &renameDetector{
+		s:        s,
+		opts:     opts,
+		used:     make(map[*Change]bool),
+		replaced: make(map[*Change]*Change),
+		blobs:    make(map[plumbing.Hash]*Blob),
+		indexes:  make(map[plumbing.Hash]*similarityIndex),
+	}
+
+	for _, c := range changes {
+		switch {
+		case c.From == empty && isRenameCandidate(c.To):
+			d.inserted = append(d.inserted, c)
+		case c.To == empty && isRenameCandidate(c.From):
+			d.deleted = append(d.deleted, c)
+		case c.From != empty && c.To != empty && isRenameCandidate(c.From):
+			d.modified = append(d.modified, c)
+		}
+	}
+
+	d.detectExact()
+	if !opts.OnlyExactRenames {
+		if err := d.detectSimilar(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result Changes
+	for _, c := range changes {
+		if r, ok := d.replaced[c]; ok {
+			result = append(result, r)
+			continue
+		}
+
+		if c.To == empty && d.used[c] {
+			continue
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+func isRenameCandidate(e ChangeEntry) bool {
+	return e.TreeEntry.Mode.IsFile()
+}
+
+// sameType returns true if the entries are both symbolic links or both
+// files, git does not detect the renames of files to links.
+func sameType(a, b ChangeEntry) bool {
+	return (a.TreeEntry.Mode == filemode.Symlink) == (b.TreeEntry.Mode == filemode.Symlink)
+}
+
+func sameBaseName(a, b ChangeEntry) bool {
+	return path.Base(a.Name) == path.Base(b.Name)
+}
+
+type renameDetector struct {
+	s    storer.EncodedObjectStorer
+	opts *DiffTreeOptions
+
+	deleted, inserted, modified []*Change
+
+	// used are the changes already used as the source of a rename or copy.
+	used map[*Change]bool
+	// replaced are the inserted changes detected as renames or copies.
+	replaced map[*Change]*Change
+
+	blobs   map[plumbing.Hash]*Blob
+	indexes map[plumbing.Hash]*similarityIndex
+}
+
+// match records the change of dst as a rename or a copy of the source of
+// src, it returns false if src cannot be its source.
+func (d *renameDetector) match(src, dst *Change, similarity int) bool {
+	isCopy := src.To != empty || d.used[src]
+	if isCopy && !d.opts.DetectCopies {
+		return false
+	}
+
+	d.used[src] = true
+	d.replaced[dst] = &Change{
+		From:       src.From,
+		To:         dst.To,
+		Similarity: similarity,
+		Copy:       isCopy,
+	}
+
+	return true
+}
+
+func (d *renameDetector) sources() []*Change {
+	if !d.opts.DetectCopies {
+		return d.deleted
+	}
+
+	sources := append([]*Change(nil), d.deleted...)
+	return append(sources, d.modified...)
+}
+
+func (d *renameDetector) detectExact() {
+	byHash := make(map[plumbing.Hash][]*Change)
+	for _, src := range d.sources() {
+		h := src.From.TreeEntry.Hash
+		byHash[h] = append(byHash[h], src)
+	}
+
+	for _, dst := range d.inserted {
+		candidates := byHash[dst.To.TreeEntry.Hash]
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return sameBaseName(candidates[i].From, dst.To) &&
+				!sameBaseName(candidates[j].From, dst.To)
+		})
+
+		for _, src := range candidates {
+			if sameType(src.From, dst.To) && d.match(src, dst, 100) {
+				break
+			}
+		}
+	}
+}
+
+type renameCandidate struct {
+	src, dst   *Change
+	similarity int
+	sameName   bool
+}
+
+func (d *renameDetector) detectSimilar(ctx context.Context) error {
+	var sources, destinations []*Change
+	for _, src := range d.sources() {
+		if !d.used[src] || d.opts.DetectCopies {
+			sources = append(sources, src)
+		}
+	}
+
+	for _, dst := range d.inserted {
+		if _, ok := d.replaced[dst]; !ok {
+			destinations = append(destinations, dst)
+		}
+	}
+
+	if len(sources) == 0 || len(destinations) == 0 {
+		return nil
+	}
+
+	limit := uint64(d.opts.RenameLimit)
+	if limit != 0 && uint64(len(sources))*uint64(len(destinations)) > limit*limit {
+		return nil
+	}
+
+	var candidates []*renameCandidate
+	for _, dst := range destinations {
+		select {
+		case <-ctx.Done():
+			return ErrCanceled
+		default:
+		}
+
+		for _, src := range sources {
+			if !sameType(src.From, dst.To) {
+				continue
+			}
+
+			similarity, err := d.similarity(src.From.TreeEntry.Hash, dst.To.TreeEntry.Hash)
+			if err != nil {
+				return err
+			}
+
+			if similarity < int(d.opts.RenameScore) {
+				continue
+			}
+
+			candidates = append(candidates, &renameCandidate{
+				src:        src,
+				dst:        dst,
+				similarity: similarity,
+				sameName:   sameBaseName(src.From, dst.To),
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].similarity != candidates[j].similarity {
+			return candidates[i].similarity > candidates[j].similarity
+		}
+
+		return candidates[i].sameName && !candidates[j].sameName
+	})
+
+	for _, c := range candidates {
+		if _, ok := d.replaced[c.dst]; ok {
+			continue
+		}
+
+		d.match(c.src, c.dst, c.similarity)
+	}
+
+	return nil
+}
+
+// similarity returns the similarity index of the blobs, zero if their sizes
+// are too different to reach the rename score.
+func (d *renameDetector) similarity(a, b plumbing.Hash) (int, error) {
+	if a == b {
+		return 100, nil
+	}
+
+	ba, err := d.blob(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bb, err := d.blob(b)
+	if err != nil {
+		return 0, err
+	}
+
+	min, max := ba.Size, bb.Size
+	if min > max {
+		min, max = max, min
+	}
+
+	if max == 0 || min*100/max < int64(d.opts.RenameScore) {
+		return 0, nil
+	}
+
+	ia, err := d.index(ba)
+	if err != nil {
+		return 0, err
+	}
+
+	ib, err := d.index(bb)
+	if err != nil {
+		return 0, err
+	}
+
+	return ia.similarity(ib), nil
+}
+
+func (d *renameDetector) blob(h plumbing.Hash) (*Blob, error) {
+	if b, ok := d.blobs[h]; ok {
+		return b, nil
+	}
+
+	b, err := GetBlob(d.s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	d.blobs[h] = b
+	return b, nil
+}
+
+func (d *renameDetector) index(b *Blob) (*similarityIndex, error) {
+	if idx, ok := d.indexes[b.Hash]; ok {
+		return idx, nil
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newSimilarityIndex(content)
+	d.indexes[b.Hash] = idx
+	return idx, nil
+}
+
+// similarityIndex records how many bytes of a content are in each distinct
+// chunk of it.
+type similarityIndex struct {
+	size   int64
+	chunks map[uint64]int64
+}
+
+func newSimilarityIndex(content []byte) *similarityIndex {
+	idx := &similarityIndex{
+		size:   int64(len(content)),
+		chunks: make(map[uint64]int64),
+	}
+
+	h := fnv.New64a()
+	for len(content) > 0 {
+		n := maxChunkSize
+		if n > len(content) {
+			n = len(content)
+		}
+
+		for i, b := range content[:n] {
+			if b == '\n' {
+				n = i + 1
+				break
+			}
+		}
+
+		h.Reset()
+		h.Write(content[:n])
+		idx.chunks[h.Sum64()] += int64(n)
+		content = content[n:]
+	}
+
+	return idx
+}
+
+// similarity returns the percentage of the bytes of the biggest content
+// found in the other one.
+func (idx *similarityIndex) similarity(other *similarityIndex) int {
+	max := idx.size
+	if other.size > max {
+		max = other.size
+	}
+
+	if max == 0 {
+		return 100
+	}
+
+	var common int64
+	for h, n := range idx.chunks {
+		m := other.chunks[h]
+		if m < n {
+			n = m
+		}
+
+		common += n
+	}
+
+	return int(common * 100 / max)
+}
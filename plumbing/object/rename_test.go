@@ -0,0 +1,259 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+
+	. "gopkg.in/check.v1"
+)
+
+type RenameSuite struct {
+	Storer *memory.Storage
+}
+
+var _ = Suite(&RenameSuite{})
+
+func (s *RenameSuite) SetUpTest(c *C) {
+	s.Storer = memory.NewStorage()
+}
+
+func (s *RenameSuite) tree(c *C, files map[string]string) *Tree {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	t := &Tree{}
+	for _, name := range names {
+		obj := s.Storer.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte(files[name]))
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(), IsNil)
+
+		h, err := s.Storer.SetEncodedObject(obj)
+		c.Assert(err, IsNil)
+
+		t.Entries = append(t.Entries, TreeEntry{Name: name, Mode: filemode.Regular, Hash: h})
+	}
+
+	obj := s.Storer.NewEncodedObject()
+	c.Assert(t.Encode(obj), IsNil)
+	h, err := s.Storer.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+
+	t, err = GetTree(s.Storer, h)
+	c.Assert(err, IsNil)
+	return t
+}
+
+func (s *RenameSuite) diff(c *C, from, to map[string]string, opts *DiffTreeOptions) Changes {
+	changes, err := DiffTreeWithOptions(context.Background(),
+		s.tree(c, from), s.tree(c, to), opts)
+	c.Assert(err, IsNil)
+	return changes
+}
+
+func lines(prefix string, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%s line %d\n", prefix, i)
+	}
+
+	return b.String()
+}
+
+func (s *RenameSuite) TestExactRename(c *C) {
+	changes := s.diff(c,
+		map[string]string{"foo": lines("foo", 10), "bar": lines("bar", 10)},
+		map[string]string{"baz": lines("foo", 10), "bar": lines("bar", 10)},
+		DefaultDiffTreeOptions,
+	)
+
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].IsRename(), Equals, true)
+	c.Assert(changes[0].From.Name, Equals, "foo")
+	c.Assert(changes[0].To.Name, Equals, "baz")
+	c.Assert(changes[0].Similarity, Equals, 100)
+	c.Assert(changes[0].String(), Equals, "<Action: Rename, Path: foo -> baz>")
+}
+
+func (s *RenameSuite) TestExactRenameSameBaseName(c *C) {
+	changes := s.diff(c,
+		map[string]string{"a": "content\n", "b": "content\n"},
+		map[string]string{"c": "content\n", "b": "content\n", "d": ""},
+		DefaultDiffTreeOptions,
+	)
+
+	c.Assert(changes, HasLen, 2)
+	c.Assert(changes[0].IsRename(), Equals, true)
+	c.Assert(changes[0].From.Name, Equals, "a")
+	c.Assert(changes[0].To.Name, Equals, "c")
+
+	action, err := changes[1].Action()
+	c.Assert(err, IsNil)
+	c.Assert(action.String(), Equals, "Insert")
+	c.Assert(changes[1].To.Name, Equals, "d")
+}
+
+func (s *RenameSuite) TestSimilarRename(c *C) {
+	changes := s.diff(c,
+		map[string]string{"foo": lines("foo", 10)},
+		map[string]string{"bar": lines("foo", 9) + "new line\n"},
+		DefaultDiffTreeOptions,
+	)
+
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].IsRename(), Equals, true)
+	c.Assert(changes[0].Similarity, Equals, 90)
+}
+
+func (s *RenameSuite) TestRenameScore(c *C) {
+	from := map[string]string{"foo": lines("foo", 10)}
+	to := map[string]string{"bar": lines("foo", 6) + lines("bar", 4)}
+
+	changes := s.diff(c, from, to, DefaultDiffTreeOptions)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].IsRename(), Equals, true)
+
+	changes = s.diff(c, from, to, &DiffTreeOptions{DetectRenames: true, RenameScore: 70})
+	c.Assert(changes, HasLen, 2)
+	c.Assert(changes[0].IsRename(), Equals, false)
+	c.Assert(changes[1].IsRename(), Equals, false)
+}
+
+func (s *RenameSuite) TestOnlyExactRenames(c *C) {
+	changes := s.diff(c,
+		map[string]string{"foo": lines("foo", 10), "bar": lines("bar", 10)},
+		map[string]string{"foo2": lines("foo", 10), "bar2": lines("bar", 9)},
+		&DiffTreeOptions{DetectRenames: true, RenameScore: 50, OnlyExactRenames: true},
+	)
+
+	c.Assert(changes, HasLen, 3)
+	sort.Sort(changes)
+	c.Assert(changes.String(), Equals, "[<Action: Delete, Path: bar>, "+
+		"<Action: Insert, Path: bar2>, <Action: Rename, Path: foo -> foo2>]")
+}
+
+func (s *RenameSuite) TestRenameLimit(c *C) {
+	from := map[string]string{"a": lines("a", 10), "b": lines("b", 10)}
+	to := map[string]string{"c": lines("a", 9), "d": lines("b", 9)}
+
+	changes := s.diff(c, from, to, &DiffTreeOptions{DetectRenames: true, RenameScore: 50, RenameLimit: 1})
+	c.Assert(changes, HasLen, 4)
+
+	changes = s.diff(c, from, to, &DiffTreeOptions{DetectRenames: true, RenameScore: 50, RenameLimit: 2})
+	c.Assert(changes, HasLen, 2)
+	sort.Sort(changes)
+	c.Assert(changes.String(), Equals,
+		"[<Action: Rename, Path: a -> c>, <Action: Rename, Path: b -> d>]")
+}
+
+func (s *RenameSuite) TestDetectCopies(c *C) {
+	from := map[string]string{"foo": lines("foo", 10), "bar": lines("bar", 10)}
+	to := map[string]string{
+		"foo":  lines("foo", 11),
+		"foo2": lines("foo", 10),
+		"bar2": lines("bar", 10),
+		"bar3": lines("bar", 9),
+	}
+
+	changes := s.diff(c, from, to, DefaultDiffTreeOptions)
+	sort.Sort(changes)
+	c.Assert(changes.String(), Equals, "[<Action: Rename, Path: bar -> bar2>, "+
+		"<Action: Insert, Path: bar3>, <Action: Modify, Path: foo>, "+
+		"<Action: Insert, Path: foo2>]")
+
+	changes = s.diff(c, from, to, &DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   50,
+		DetectCopies:  true,
+	})
+
+	sort.Sort(changes)
+	c.Assert(changes.String(), Equals, "[<Action: Rename, Path: bar -> bar2>, "+
+		"<Action: Copy, Path: bar -> bar3>, <Action: Modify, Path: foo>, "+
+		"<Action: Copy, Path: foo -> foo2>]")
+	c.Assert(changes[1].IsCopy(), Equals, true)
+	c.Assert(changes[1].Similarity, Equals, 90)
+	c.Assert(changes[3].Similarity, Equals, 100)
+}
+
+func (s *RenameSuite) TestRenamePatch(c *C) {
+	changes := s.diff(c,
+		map[string]string{"foo": lines("foo", 10)},
+		map[string]string{"bar": lines("foo", 9) + "new line\n"},
+		DefaultDiffTreeOptions,
+	)
+
+	p, err := changes.Patch()
+	c.Assert(err, IsNil)
+	c.Assert(p.String(), Equals, `diff --git a/foo b/bar
+similarity index 90%
+rename from foo
+rename to bar
+index 06e7d34881253b9122af5756e9218050e1bf15bb..1ab8fdf4e0b764ddc1387f3568f21084038ccff3 100644
+--- a/foo
++++ b/bar
+@@ -7,4 +7,4 @@ foo line 5
+ foo line 6
+ foo line 7
+ foo line 8
+-foo line 9
++new line
+`)
+	c.Assert(p.Stats().String(), Equals, " foo => bar | 2 +-\n")
+}
+
+func (s *RenameSuite) TestDiffTreeWithoutOptions(c *C) {
+	changes := s.diff(c,
+		map[string]string{"foo": lines("foo", 10)},
+		map[string]string{"bar": lines("foo", 10)},
+		nil,
+	)
+
+	c.Assert(changes, HasLen, 2)
+}
+
+func (s *RenameSuite) TestPatchWithOptions(c *C) {
+	from := s.tree(c, map[string]string{"foo": lines("foo", 10)})
+	to := s.tree(c, map[string]string{
+		"bar": strings.Replace(lines("foo", 9), "foo line 2", "foo  line 2 ", 1) + "new line\n",
+	})
+
+	p, err := from.PatchWithOptions(context.Background(), to, &PatchOptions{
+		DiffTree: DefaultDiffTreeOptions,
+		Diff:     &diff.Options{Algorithm: diff.Histogram, IgnoreSpaceChange: true},
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(p.String(), Equals, `diff --git a/foo b/bar
+similarity index 80%
+rename from foo
+rename to bar
+index 06e7d34881253b9122af5756e9218050e1bf15bb..5a4d9dc4c803155e39e92d55f5b4661de090e22f 100644
+--- a/foo
++++ b/bar
+@@ -7,4 +7,4 @@ foo line 5
+ foo line 6
+ foo line 7
+ foo line 8
+-foo line 9
++new line
+`)
+
+	p, err = from.PatchWithOptions(context.Background(), to, nil)
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 2)
+}
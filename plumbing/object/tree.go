@@ -332,6 +332,24 @@ func (from *Tree) PatchContext(ctx context.Context, to *Tree) (*Patch, error) {
 	return changes.PatchContext(ctx)
 }
 
+// PatchWithOptions returns the Patch of the changes between trees, computed
+// with the given options: the renames are detected as set in opts.DiffTree
+// and the contents are compared as set in opts.Diff. Provided context must
+// be non-nil.
+func (from *Tree) PatchWithOptions(ctx context.Context, to *Tree, opts *PatchOptions) (*Patch, error) {
+	var treeOpts *DiffTreeOptions
+	if opts != nil {
+		treeOpts = opts.DiffTree
+	}
+
+	changes, err := DiffTreeWithOptions(ctx, from, to, treeOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes.PatchWithOptions(ctx, opts)
+}
+
 // treeEntryIter facilitates iterating through the TreeEntry objects in a Tree.
 type treeEntryIter struct {
 	t   *Tree
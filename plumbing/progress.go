@@ -0,0 +1,165 @@
+package plumbing
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressPhase is the name of a step of an operation, as displayed by git.
+// The phases reported by a server are not limited to the ones defined here.
+type ProgressPhase string
+
+const (
+	// EnumeratingObjects is the phase listing the objects to send.
+	EnumeratingObjects ProgressPhase = "Enumerating objects"
+	// CountingObjects is the phase counting the objects to send.
+	CountingObjects ProgressPhase = "Counting objects"
+	// CompressingObjects is the phase computing the deltas of a packfile.
+	CompressingObjects ProgressPhase = "Compressing objects"
+	// ReceivingObjects is the phase reading the objects of a packfile.
+	ReceivingObjects ProgressPhase = "Receiving objects"
+	// ResolvingDeltas is the phase resolving the deltas of a packfile.
+	ResolvingDeltas ProgressPhase = "Resolving deltas"
+	// WritingObjects is the phase writing the objects of a packfile.
+	WritingObjects ProgressPhase = "Writing objects"
+	// UpdatingFiles is the phase writing the files of a worktree.
+	UpdatingFiles ProgressPhase = "Updating files"
+)
+
+// ProgressEvent reports the progress of a phase.
+type ProgressEvent struct {
+	// Phase is the step of the operation being reported.
+	Phase ProgressPhase
+	// Remote is true for the phases reported by the server.
+	Remote bool
+	// Current is the number of items processed.
+	Current int64
+	// Total is the number of items to process, 0 if unknown.
+	Total int64
+	// Bytes is the number of bytes processed, if the phase reports it.
+	Bytes int64
+	// Throughput is the number of bytes processed per second.
+	Throughput float64
+	// Done is true for the last event of the phase.
+	Done bool
+}
+
+// Percent returns the percentage of the items processed, or -1 if the total
+// is unknown.
+func (e ProgressEvent) Percent() int {
+	if e.Total <= 0 {
+		return -1
+	}
+
+	return int(e.Current * 100 / e.Total)
+}
+
+// ProgressHandler receives the progress events of an operation. The events
+// are sent synchronously, the handler should return quickly.
+type ProgressHandler interface {
+	OnProgress(ProgressEvent)
+}
+
+// ProgressHandlerFunc is a function implementing ProgressHandler.
+type ProgressHandlerFunc func(ProgressEvent)
+
+// OnProgress calls f(e).
+func (f ProgressHandlerFunc) OnProgress(e ProgressEvent) {
+	f(e)
+}
+
+// ProgressMeter sends the events of a phase to a handler, computing the
+// throughput. A nil *ProgressMeter, returned for a nil handler, discards the
+// updates. It is safe for concurrent use.
+type ProgressMeter struct {
+	h     ProgressHandler
+	phase ProgressPhase
+	start time.Time
+
+	m              sync.Mutex
+	current, total int64
+	bytes          int64
+	done           bool
+}
+
+// NewProgressMeter returns a ProgressMeter of the given phase, with total
+// items to process, 0 if unknown. It returns nil if h is nil.
+func NewProgressMeter(h ProgressHandler, phase ProgressPhase, total int64) *ProgressMeter {
+	if h == nil {
+		return nil
+	}
+
+	return &ProgressMeter{h: h, phase: phase, total: total, start: time.Now()}
+}
+
+// Update reports the number of items and bytes processed.
+func (m *ProgressMeter) Update(current, bytes int64) {
+	if m == nil {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.current, m.bytes = current, bytes
+	m.send()
+}
+
+// Add reports n more items and bytes processed.
+func (m *ProgressMeter) Add(n, bytes int64) {
+	if m == nil {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.current += n
+	m.bytes += bytes
+	m.send()
+}
+
+// Done reports the end of the phase, the following updates are discarded.
+func (m *ProgressMeter) Done() {
+	if m == nil {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.done {
+		return
+	}
+
+	if m.current < m.total {
+		m.current = m.total
+	}
+
+	m.done = true
+	m.h.OnProgress(m.event())
+}
+
+func (m *ProgressMeter) send() {
+	if m.done {
+		return
+	}
+
+	m.h.OnProgress(m.event())
+}
+
+func (m *ProgressMeter) event() ProgressEvent {
+	e := ProgressEvent{
+		Phase:   m.phase,
+		Current: m.current,
+		Total:   m.total,
+		Bytes:   m.bytes,
+		Done:    m.done,
+	}
+
+	if elapsed := time.Since(m.start).Seconds(); elapsed > 0 {
+		e.Throughput = float64(m.bytes) / elapsed
+	}
+
+	return e
+}
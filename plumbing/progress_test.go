@@ -0,0 +1,70 @@
+package plumbing
+
+import (
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProgressSuite struct{}
+
+var _ = Suite(&ProgressSuite{})
+
+func (s *ProgressSuite) TestProgressMeter(c *C) {
+	var events []ProgressEvent
+	m := NewProgressMeter(ProgressHandlerFunc(func(e ProgressEvent) {
+		events = append(events, e)
+	}), ReceivingObjects, 4)
+
+	m.Update(1, 10)
+	m.Add(2, 20)
+	m.Done()
+	m.Update(4, 40)
+	m.Done()
+
+	c.Assert(events, HasLen, 3)
+	c.Assert(events[0].Phase, Equals, ReceivingObjects)
+	c.Assert(events[0].Current, Equals, int64(1))
+	c.Assert(events[0].Total, Equals, int64(4))
+	c.Assert(events[0].Bytes, Equals, int64(10))
+	c.Assert(events[0].Percent(), Equals, 25)
+	c.Assert(events[1].Current, Equals, int64(3))
+	c.Assert(events[1].Bytes, Equals, int64(30))
+	c.Assert(events[1].Done, Equals, false)
+	c.Assert(events[2].Current, Equals, int64(4))
+	c.Assert(events[2].Done, Equals, true)
+	c.Assert(events[2].Throughput > 0, Equals, true)
+}
+
+func (s *ProgressSuite) TestProgressMeterConcurrent(c *C) {
+	var count int64
+	m := NewProgressMeter(ProgressHandlerFunc(func(e ProgressEvent) {
+		count = e.Current
+	}), CompressingObjects, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Add(1, 0)
+		}()
+	}
+
+	wg.Wait()
+	c.Assert(count, Equals, int64(10))
+}
+
+func (s *ProgressSuite) TestProgressMeterNil(c *C) {
+	m := NewProgressMeter(nil, ReceivingObjects, 0)
+	c.Assert(m, IsNil)
+
+	m.Update(1, 1)
+	m.Add(1, 1)
+	m.Done()
+}
+
+func (s *ProgressSuite) TestProgressEventPercent(c *C) {
+	c.Assert(ProgressEvent{Current: 5}.Percent(), Equals, -1)
+	c.Assert(ProgressEvent{Current: 5, Total: 10}.Percent(), Equals, 50)
+}
@@ -84,6 +84,9 @@ const (
 	// understood thin packs. Adding 'no-thin' later allowed receive-pack
 	// to disable the feature in a backwards-compatible manner.
 	ThinPack Capability = "thin-pack"
+	// NoThin is advertised by receive-pack servers not able to handle thin
+	// packs, see ThinPack.
+	NoThin Capability = "no-thin"
 	// Sideband means that server can send, and client understand multiplexed
 	// progress reports and error info interleaved with the packfile itself.
 	//
@@ -230,6 +233,11 @@ const (
 	PushCert Capability = "push-cert"
 	// SymRef symbolic reference support for better negotiation.
 	SymRef Capability = "symref"
+	// Filter if the upload-pack server advertises the 'filter' capability,
+	// fetch-pack may send "filter" commands to request a partial clone or
+	// partial fetch and request that the server omit various objects from
+	// the packfile.
+	Filter Capability = "filter"
 )
 
 const DefaultAgent = "go-git/4.x"
@@ -241,6 +249,7 @@ var known = map[Capability]bool{
 	NoProgress: true, IncludeTag: true, ReportStatus: true, DeleteRefs: true,
 	Quiet: true, Atomic: true, PushOptions: true, AllowTipSHA1InWant: true,
 	AllowReachableSHA1InWant: true, PushCert: true, SymRef: true,
+	Filter: true, NoThin: true,
 }
 
 var requiresArgument = map[Capability]bool{
@@ -33,6 +33,7 @@ var (
 	deepenCommits   = []byte("deepen ")
 	deepenSince     = []byte("deepen-since ")
 	deepenReference = []byte("deepen-not ")
+	filter          = []byte("filter ")
 
 	// shallow-update
 	unshallow = []byte("unshallow ")
@@ -43,6 +44,10 @@ var (
 
 	// updreq
 	shallowNoSp = []byte("shallow")
+
+	// upload-archive
+	argument = []byte("argument ")
+	nack     = []byte("NACK ")
 )
 
 func isFlush(payload []byte) bool {
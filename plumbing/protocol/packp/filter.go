@@ -0,0 +1,129 @@
+package packp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ErrUnsupportedFilter is returned by Filter.Parse when the filter
+// specification is not known.
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+// Filter values are the filter specifications requested in a partial clone or
+// fetch, they are sent to the server using the filter capability. The
+// specifications are the ones accepted by git-rev-list(1) --filter.
+type Filter string
+
+const (
+	filterBlobNone  = "blob:none"
+	filterBlobLimit = "blob:limit="
+	filterTree      = "tree:"
+	filterSparseOID = "sparse:oid="
+)
+
+// FilterBlobNone omits all the blobs.
+func FilterBlobNone() Filter {
+	return Filter(filterBlobNone)
+}
+
+// FilterBlobLimit omits the blobs of size greater or equal than the given
+// limit, in bytes.
+func FilterBlobLimit(size uint64) Filter {
+	return Filter(fmt.Sprintf("%s%d", filterBlobLimit, size))
+}
+
+// FilterTreeDepth omits all the blobs and trees whose depth from the root tree
+// is greater or equal than the given depth.
+func FilterTreeDepth(depth uint64) Filter {
+	return Filter(fmt.Sprintf("%s%d", filterTree, depth))
+}
+
+// FilterSparseOID omits the blobs not required for a sparse checkout, using
+// the sparse-checkout specification contained in the given blob.
+func FilterSparseOID(h plumbing.Hash) Filter {
+	return Filter(filterSparseOID + h.String())
+}
+
+// IsZero returns true if the filter is empty, requesting all the objects.
+func (f Filter) IsZero() bool {
+	return f == ""
+}
+
+// FilterSpec is the parsed representation of a Filter.
+type FilterSpec struct {
+	// BlobLimit, if not negative, is the size in bytes from which blobs are
+	// omitted, zero meaning all the blobs.
+	BlobLimit int64
+	// TreeDepth, if not negative, is the depth from which trees and blobs
+	// are omitted.
+	TreeDepth int64
+	// SparseOID, if not zero, is the blob containing the sparse-checkout
+	// specification.
+	SparseOID plumbing.Hash
+}
+
+// Parse parses the filter specification, ErrUnsupportedFilter is returned if
+// it is not known.
+func (f Filter) Parse() (*FilterSpec, error) {
+	spec := &FilterSpec{BlobLimit: -1, TreeDepth: -1}
+
+	s := string(f)
+	var err error
+	switch {
+	case s == filterBlobNone:
+		spec.BlobLimit = 0
+	case strings.HasPrefix(s, filterBlobLimit):
+		spec.BlobLimit, err = parseFilterSize(strings.TrimPrefix(s, filterBlobLimit))
+	case strings.HasPrefix(s, filterTree):
+		var depth uint64
+		depth, err = strconv.ParseUint(strings.TrimPrefix(s, filterTree), 10, 63)
+		spec.TreeDepth = int64(depth)
+	case strings.HasPrefix(s, filterSparseOID):
+		raw := strings.TrimPrefix(s, filterSparseOID)
+		if len(raw) != 40 {
+			return nil, fmt.Errorf("%s: %q", ErrUnsupportedFilter, s)
+		}
+
+		spec.SparseOID = plumbing.NewHash(raw)
+	default:
+		return nil, fmt.Errorf("%s: %q", ErrUnsupportedFilter, s)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q", s)
+	}
+
+	return spec, nil
+}
+
+// parseFilterSize parses a size with an optional k, m or g unit suffix.
+func parseFilterSize(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	var unit int64 = 1
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(n) * unit, nil
+}
@@ -0,0 +1,66 @@
+package packp
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+func (s *FilterSuite) TestConstructors(c *C) {
+	c.Assert(FilterBlobNone(), Equals, Filter("blob:none"))
+	c.Assert(FilterBlobLimit(42), Equals, Filter("blob:limit=42"))
+	c.Assert(FilterTreeDepth(1), Equals, Filter("tree:1"))
+	c.Assert(FilterSparseOID(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+		Equals, Filter("sparse:oid=6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+}
+
+func (s *FilterSuite) TestParse(c *C) {
+	for _, t := range []struct {
+		filter   Filter
+		expected FilterSpec
+	}{
+		{FilterBlobNone(), FilterSpec{BlobLimit: 0, TreeDepth: -1}},
+		{FilterBlobLimit(42), FilterSpec{BlobLimit: 42, TreeDepth: -1}},
+		{Filter("blob:limit=2k"), FilterSpec{BlobLimit: 2048, TreeDepth: -1}},
+		{Filter("blob:limit=1M"), FilterSpec{BlobLimit: 1 << 20, TreeDepth: -1}},
+		{Filter("blob:limit=1g"), FilterSpec{BlobLimit: 1 << 30, TreeDepth: -1}},
+		{FilterTreeDepth(0), FilterSpec{BlobLimit: -1, TreeDepth: 0}},
+		{FilterSparseOID(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")), FilterSpec{
+			BlobLimit: -1,
+			TreeDepth: -1,
+			SparseOID: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		}},
+	} {
+		spec, err := t.filter.Parse()
+		c.Assert(err, IsNil, Commentf("filter: %s", t.filter))
+		c.Assert(*spec, DeepEquals, t.expected, Commentf("filter: %s", t.filter))
+	}
+}
+
+func (s *FilterSuite) TestParseInvalid(c *C) {
+	for _, f := range []Filter{
+		"blob:limit=",
+		"blob:limit=foo",
+		"blob:limit=-1",
+		"tree:",
+		"tree:-2",
+	} {
+		_, err := f.Parse()
+		c.Assert(err, ErrorMatches, "invalid filter.*", Commentf("filter: %s", f))
+	}
+}
+
+func (s *FilterSuite) TestParseUnsupported(c *C) {
+	for _, f := range []Filter{
+		"foo",
+		"sparse:oid=foo",
+		"combine:blob:none+tree:0",
+	} {
+		_, err := f.Parse()
+		c.Assert(err, ErrorMatches, "unsupported filter.*", Commentf("filter: %s", f))
+	}
+}
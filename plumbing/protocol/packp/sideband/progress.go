@@ -0,0 +1,105 @@
+package sideband
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var (
+	progressLine = regexp.MustCompile(
+		`^([A-Za-z][A-Za-z ]*):\s+(?:(\d+)%\s+\((\d+)/(\d+)\)|(\d+))(.*)$`)
+	progressBytes = regexp.MustCompile(
+		`^,\s*([\d.]+)\s*(bytes|KiB|MiB|GiB)(?:\s*\|\s*([\d.]+)\s*(bytes|KiB|MiB|GiB)/s)?`)
+)
+
+// ProgressParser is a Progress parsing the progress messages of the server,
+// like "Counting objects:  50% (10/20)", into the events sent to a
+// plumbing.ProgressHandler, with Remote set. The messages are also written
+// to the wrapped Progress, if any. The messages not reporting progress are
+// ignored.
+type ProgressParser struct {
+	h    plumbing.ProgressHandler
+	w    Progress
+	line []byte
+}
+
+// NewProgressParser returns a ProgressParser sending the events to h and
+// writing the messages to w, if not nil.
+func NewProgressParser(h plumbing.ProgressHandler, w Progress) *ProgressParser {
+	return &ProgressParser{h: h, w: w}
+}
+
+// Write parses the messages in p, a message ends with \r when it is updated
+// by the next one, or \n.
+func (p *ProgressParser) Write(b []byte) (int, error) {
+	if p.w != nil {
+		if _, err := p.w.Write(b); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, c := range b {
+		if c != '\r' && c != '\n' {
+			p.line = append(p.line, c)
+			continue
+		}
+
+		if e, ok := ParseProgress(string(p.line)); ok {
+			p.h.OnProgress(e)
+		}
+
+		p.line = p.line[:0]
+	}
+
+	return len(b), nil
+}
+
+// ParseProgress parses a progress message of a server, returning false if it
+// does not report the progress of a phase.
+func ParseProgress(line string) (plumbing.ProgressEvent, bool) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "remote: ")
+	m := progressLine.FindStringSubmatch(line)
+	if m == nil {
+		return plumbing.ProgressEvent{}, false
+	}
+
+	e := plumbing.ProgressEvent{
+		Phase:  plumbing.ProgressPhase(m[1]),
+		Remote: true,
+	}
+
+	if m[5] != "" {
+		e.Current, _ = strconv.ParseInt(m[5], 10, 64)
+	} else {
+		e.Current, _ = strconv.ParseInt(m[3], 10, 64)
+		e.Total, _ = strconv.ParseInt(m[4], 10, 64)
+	}
+
+	rest := m[6]
+	if b := progressBytes.FindStringSubmatch(rest); b != nil {
+		e.Bytes = int64(parseSize(b[1], b[2]))
+		if b[3] != "" {
+			e.Throughput = parseSize(b[3], b[4])
+		}
+	}
+
+	e.Done = strings.Contains(rest, "done") || strings.Contains(rest, "completed")
+	return e, true
+}
+
+func parseSize(value, unit string) float64 {
+	v, _ := strconv.ParseFloat(value, 64)
+	switch unit {
+	case "KiB":
+		v *= 1 << 10
+	case "MiB":
+		v *= 1 << 20
+	case "GiB":
+		v *= 1 << 30
+	}
+
+	return v
+}
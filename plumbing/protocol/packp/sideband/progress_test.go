@@ -0,0 +1,103 @@
+package sideband
+
+import (
+	"bytes"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProgressSuite struct{}
+
+var _ = Suite(&ProgressSuite{})
+
+func (s *ProgressSuite) TestParseProgress(c *C) {
+	e, ok := ParseProgress("Counting objects:  45% (9/20)")
+	c.Assert(ok, Equals, true)
+	c.Assert(e, DeepEquals, plumbing.ProgressEvent{
+		Phase:   plumbing.CountingObjects,
+		Remote:  true,
+		Current: 9,
+		Total:   20,
+	})
+
+	e, ok = ParseProgress("remote: Compressing objects: 100% (12/12), done.")
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Phase, Equals, plumbing.CompressingObjects)
+	c.Assert(e.Current, Equals, int64(12))
+	c.Assert(e.Done, Equals, true)
+
+	e, ok = ParseProgress("Enumerating objects: 20, done.")
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Phase, Equals, plumbing.EnumeratingObjects)
+	c.Assert(e.Current, Equals, int64(20))
+	c.Assert(e.Total, Equals, int64(0))
+	c.Assert(e.Done, Equals, true)
+
+	e, ok = ParseProgress("Receiving objects:  50% (5/10), 1.50 MiB | 512.00 KiB/s")
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Bytes, Equals, int64(3<<19))
+	c.Assert(e.Throughput, Equals, float64(512<<10))
+	c.Assert(e.Done, Equals, false)
+
+	e, ok = ParseProgress("Resolving deltas: 100% (2/2), completed with 1 local object.")
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Phase, Equals, plumbing.ResolvingDeltas)
+	c.Assert(e.Done, Equals, true)
+
+	_, ok = ParseProgress("Total 20 (delta 3), reused 0 (delta 0)")
+	c.Assert(ok, Equals, false)
+
+	_, ok = ParseProgress("")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ProgressSuite) TestProgressParser(c *C) {
+	var events []plumbing.ProgressEvent
+	h := plumbing.ProgressHandlerFunc(func(e plumbing.ProgressEvent) {
+		events = append(events, e)
+	})
+
+	buf := bytes.NewBuffer(nil)
+	p := NewProgressParser(h, buf)
+
+	messages := "Counting objects:  50% (1/2)\rCounting obj" +
+		"ects: 100% (2/2), done.\nTotal 2 (delta 0)\n"
+
+	for _, m := range []string{messages[:20], messages[20:40], messages[40:]} {
+		n, err := p.Write([]byte(m))
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, len(m))
+	}
+
+	c.Assert(buf.String(), Equals, messages)
+	c.Assert(events, HasLen, 2)
+	c.Assert(events[0].Current, Equals, int64(1))
+	c.Assert(events[0].Done, Equals, false)
+	c.Assert(events[1].Current, Equals, int64(2))
+	c.Assert(events[1].Done, Equals, true)
+}
+
+func (s *ProgressSuite) TestProgressParserWithDemuxer(c *C) {
+	var events []plumbing.ProgressEvent
+	h := plumbing.ProgressHandlerFunc(func(e plumbing.ProgressEvent) {
+		events = append(events, e)
+	})
+
+	buf := bytes.NewBuffer(nil)
+	e := pktline.NewEncoder(buf)
+	e.Encode(ProgressMessage.WithPayload([]byte("Counting objects: 100% (3/3), done.\n")))
+	e.Encode(PackData.WithPayload([]byte("PACK")))
+
+	d := NewDemuxer(Sideband64k, buf)
+	d.Progress = NewProgressParser(h, nil)
+
+	content := make([]byte, 4)
+	_, err := d.Read(content)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "PACK")
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].Phase, Equals, plumbing.CountingObjects)
+}
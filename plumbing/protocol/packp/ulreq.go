@@ -17,10 +17,11 @@ type UploadRequest struct {
 	Wants        []plumbing.Hash
 	Shallows     []plumbing.Hash
 	Depth        Depth
+	Filter       Filter
 }
 
 // Depth values stores the desired depth of the requested packfile: see
-// DepthCommit, DepthSince and DepthReference.
+// DepthCommit, DepthSince, DepthReference and DepthReferences.
 type Depth interface {
 	isDepth()
 	IsZero() bool
@@ -55,6 +56,16 @@ func (d DepthReference) IsZero() bool {
 	return string(d) == ""
 }
 
+// DepthReferences requests only commits not to found in any of the specified
+// references.
+type DepthReferences []string
+
+func (d DepthReferences) isDepth() {}
+
+func (d DepthReferences) IsZero() bool {
+	return len(d) == 0
+}
+
 // NewUploadRequest returns a pointer to a new UploadRequest value, ready to be
 // used. It has no capabilities, wants or shallows and an infinite depth. Please
 // note that to encode an upload-request it has to have at least one wanted hash.
@@ -107,6 +118,8 @@ func NewUploadRequestFromCapabilities(adv *capability.List) *UploadRequest {
 //   - is a non-zero DepthCommits is given capability.Shallow MUST be present
 //   - is a DepthSince is given capability.Shallow MUST be present
 //   - is a DepthReference is given capability.DeepenNot MUST be present
+//   - is a DepthReferences is given capability.DeepenNot MUST be present
+//   - is a Filter is given capability.Filter MUST be present
 //   - MUST contain only maximum of one of capability.Sideband and capability.Sideband64k
 //   - MUST contain only maximum of one of capability.MultiACK and capability.MultiACKDetailed
 func (r *UploadRequest) Validate() error {
@@ -143,12 +156,16 @@ func (r *UploadRequest) validateRequiredCapabilities() error {
 		if !r.Capabilities.Supports(capability.DeepenSince) {
 			return fmt.Errorf(msg, capability.DeepenSince)
 		}
-	case DepthReference:
+	case DepthReference, DepthReferences:
 		if !r.Capabilities.Supports(capability.DeepenNot) {
 			return fmt.Errorf(msg, capability.DeepenNot)
 		}
 	}
 
+	if !r.Filter.IsZero() && !r.Capabilities.Supports(capability.Filter) {
+		return fmt.Errorf(msg, capability.Filter)
+	}
+
 	return nil
 }
 
@@ -136,6 +136,10 @@ func (d *ulReqDecoder) decodeOtherWants() stateFn {
 		return d.decodeDeepen
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) == 0 {
 		return nil
 	}
@@ -161,6 +165,10 @@ func (d *ulReqDecoder) decodeShallow() stateFn {
 		return d.decodeDeepen
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) == 0 {
 		return nil
 	}
@@ -219,7 +227,7 @@ func (d *ulReqDecoder) decodeDeepenCommits() stateFn {
 	}
 	d.data.Depth = DepthCommits(n)
 
-	return d.decodeFlush
+	return d.decodeNextFilterOrFlush
 }
 
 func (d *ulReqDecoder) decodeDeepenSince() stateFn {
@@ -233,17 +241,61 @@ func (d *ulReqDecoder) decodeDeepenSince() stateFn {
 	t := time.Unix(secs, 0).UTC()
 	d.data.Depth = DepthSince(t)
 
-	return d.decodeFlush
+	return d.decodeNextFilterOrFlush
 }
 
 func (d *ulReqDecoder) decodeDeepenReference() stateFn {
 	d.line = bytes.TrimPrefix(d.line, deepenReference)
 
-	d.data.Depth = DepthReference(string(d.line))
+	reference := string(d.line)
+	switch depth := d.data.Depth.(type) {
+	case DepthReference:
+		d.data.Depth = DepthReferences{string(depth), reference}
+	case DepthReferences:
+		d.data.Depth = append(depth, reference)
+	default:
+		d.data.Depth = DepthReference(reference)
+	}
+
+	if ok := d.nextLine(); !ok {
+		return nil
+	}
+
+	if bytes.HasPrefix(d.line, deepenReference) {
+		return d.decodeDeepenReference
+	}
+
+	return d.decodeFilterOrFlush
+}
+
+// Expected format: filter <filter-spec>
+func (d *ulReqDecoder) decodeFilter() stateFn {
+	d.line = bytes.TrimPrefix(d.line, filter)
+	d.data.Filter = Filter(d.line)
 
 	return d.decodeFlush
 }
 
+func (d *ulReqDecoder) decodeNextFilterOrFlush() stateFn {
+	if ok := d.nextLine(); !ok {
+		return nil
+	}
+
+	return d.decodeFilterOrFlush
+}
+
+func (d *ulReqDecoder) decodeFilterOrFlush() stateFn {
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
+	if len(d.line) != 0 {
+		d.err = fmt.Errorf("unexpected payload while expecting a flush-pkt: %q", d.line)
+	}
+
+	return nil
+}
+
 func (d *ulReqDecoder) decodeFlush() stateFn {
 	if ok := d.nextLine(); !ok {
 		return nil
@@ -477,6 +477,71 @@ func (s *UlReqDecodeSuite) TestDeepenReference(c *C) {
 	c.Assert(string(reference), Equals, expected)
 }
 
+func (s *UlReqDecodeSuite) TestDeepenReferences(c *C) {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta multi_ack",
+		"deepen-not refs/heads/master",
+		"deepen-not refs/heads/feature",
+		"deepen-not v1.0.0",
+		pktline.FlushString,
+	}
+	ur := s.testDecodeOK(c, payloads)
+
+	c.Assert(ur.Depth, DeepEquals, DepthReferences{
+		"refs/heads/master", "refs/heads/feature", "v1.0.0",
+	})
+}
+
+func (s *UlReqDecodeSuite) TestFilter(c *C) {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"filter blob:none",
+		pktline.FlushString,
+	}
+	ur := s.testDecodeOK(c, payloads)
+
+	c.Assert(ur.Filter, Equals, FilterBlobNone())
+}
+
+func (s *UlReqDecodeSuite) TestFilterAfterShallowAndDepth(c *C) {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"shallow aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"deepen 2",
+		"filter blob:limit=1k",
+		pktline.FlushString,
+	}
+	ur := s.testDecodeOK(c, payloads)
+
+	c.Assert(ur.Shallows, HasLen, 1)
+	c.Assert(ur.Depth, Equals, DepthCommits(2))
+	c.Assert(ur.Filter, Equals, Filter("blob:limit=1k"))
+}
+
+func (s *UlReqDecodeSuite) TestFilterAfterDeepenNot(c *C) {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"deepen-not v1.0.0",
+		"filter tree:0",
+		pktline.FlushString,
+	}
+	ur := s.testDecodeOK(c, payloads)
+
+	c.Assert(ur.Depth, Equals, DepthReference("v1.0.0"))
+	c.Assert(ur.Filter, Equals, FilterTreeDepth(0))
+}
+
+func (s *UlReqDecodeSuite) TestFilterFollowedByPayload(c *C) {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"filter blob:none",
+		"deepen 1",
+		pktline.FlushString,
+	}
+	r := toPktLines(c, payloads)
+	s.testDecoderErrorMatches(c, r, ".*unexpected payload while expecting a flush-pkt.*")
+}
+
 func (s *UlReqDecodeSuite) TestAll(c *C) {
 	payloads := []string{
 		"want 3333333333333333333333333333333333333333 ofs-delta multi_ack",
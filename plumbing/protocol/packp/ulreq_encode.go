@@ -127,11 +127,31 @@ func (e *ulReqEncoder) encodeDepth() stateFn {
 			e.err = fmt.Errorf("encoding depth %s: %s", reference, err)
 			return nil
 		}
+	case DepthReferences:
+		for _, reference := range depth {
+			if err := e.pe.Encodef("deepen-not %s\n", reference); err != nil {
+				e.err = fmt.Errorf("encoding depth %s: %s", reference, err)
+				return nil
+			}
+		}
 	default:
 		e.err = fmt.Errorf("unsupported depth type")
 		return nil
 	}
 
+	return e.encodeFilter
+}
+
+func (e *ulReqEncoder) encodeFilter() stateFn {
+	if e.data.Filter.IsZero() {
+		return e.encodeFlush
+	}
+
+	if err := e.pe.Encodef("filter %s\n", e.data.Filter); err != nil {
+		e.err = fmt.Errorf("encoding filter %s: %s", e.data.Filter, err)
+		return nil
+	}
+
 	return e.encodeFlush
 }
 
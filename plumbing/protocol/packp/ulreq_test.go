@@ -81,6 +81,19 @@ func (s *UlReqSuite) TestValidateDepthReference(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *UlReqSuite) TestValidateDepthReferences(c *C) {
+	r := NewUploadRequest()
+	r.Wants = append(r.Wants, plumbing.NewHash("1111111111111111111111111111111111111111"))
+	r.Depth = DepthReferences{"refs/heads/master", "v1.0.0"}
+
+	err := r.Validate()
+	c.Assert(err, NotNil)
+
+	r.Capabilities.Set(capability.DeepenNot)
+	err = r.Validate()
+	c.Assert(err, IsNil)
+}
+
 func (s *UlReqSuite) TestValidateDepthSince(c *C) {
 	r := NewUploadRequest()
 	r.Wants = append(r.Wants, plumbing.NewHash("1111111111111111111111111111111111111111"))
@@ -94,6 +107,19 @@ func (s *UlReqSuite) TestValidateDepthSince(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *UlReqSuite) TestValidateFilter(c *C) {
+	r := NewUploadRequest()
+	r.Wants = append(r.Wants, plumbing.NewHash("1111111111111111111111111111111111111111"))
+	r.Filter = FilterBlobNone()
+
+	err := r.Validate()
+	c.Assert(err, NotNil)
+
+	r.Capabilities.Set(capability.Filter)
+	err = r.Validate()
+	c.Assert(err, IsNil)
+}
+
 func (s *UlReqSuite) TestValidateConflictSideband(c *C) {
 	r := NewUploadRequest()
 	r.Wants = append(r.Wants, plumbing.NewHash("1111111111111111111111111111111111111111"))
@@ -0,0 +1,106 @@
+package packp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+)
+
+// UploadArchiveRequest is the request of a git-upload-archive session: the
+// arguments of the git-archive command run on the server, without the
+// --remote and --output options.
+type UploadArchiveRequest struct {
+	Args []string
+}
+
+// Decode reads the arguments of the request, up to the flush-pkt.
+func (r *UploadArchiveRequest) Decode(reader io.Reader) error {
+	s := pktline.NewScanner(reader)
+	for s.Scan() {
+		line := bytes.TrimSuffix(s.Bytes(), eol)
+		if len(line) == 0 {
+			return nil
+		}
+
+		if !bytes.HasPrefix(line, argument) {
+			return NewErrUnexpectedData("unexpected line in upload-archive request", line)
+		}
+
+		r.Args = append(r.Args, string(line[len(argument):]))
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+// Encode writes the arguments of the request, followed by a flush-pkt.
+func (r *UploadArchiveRequest) Encode(w io.Writer) error {
+	e := pktline.NewEncoder(w)
+	for _, a := range r.Args {
+		if err := e.Encodef("%s%s\n", argument, a); err != nil {
+			return err
+		}
+	}
+
+	return e.Flush()
+}
+
+// EncodeUploadArchiveStatus writes the status line answering an
+// upload-archive request, ACK or NACK with the reason of the rejection,
+// followed by a flush-pkt.
+func EncodeUploadArchiveStatus(w io.Writer, reason error) error {
+	e := pktline.NewEncoder(w)
+	var err error
+	if reason == nil {
+		err = e.Encode(append(ack, eol...))
+	} else {
+		err = e.EncodeString(fmt.Sprintf("%s%s\n", nack, reason))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.Flush()
+}
+
+// DecodeUploadArchiveStatus reads the status line answering an
+// upload-archive request, returning an error with the reason of a NACK.
+func DecodeUploadArchiveStatus(r io.Reader) error {
+	s := pktline.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return err
+		}
+
+		return io.ErrUnexpectedEOF
+	}
+
+	line := bytes.TrimSuffix(s.Bytes(), eol)
+	switch {
+	case bytes.Equal(line, ack):
+	case bytes.HasPrefix(line, nack):
+		return fmt.Errorf("upload-archive request rejected: %s", line[len(nack):])
+	default:
+		return NewErrUnexpectedData("unexpected upload-archive status", line)
+	}
+
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return err
+		}
+
+		return io.ErrUnexpectedEOF
+	}
+
+	if len(s.Bytes()) != 0 {
+		return NewErrUnexpectedData("unexpected line after upload-archive status", s.Bytes())
+	}
+
+	return nil
+}
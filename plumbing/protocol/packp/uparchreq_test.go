@@ -0,0 +1,57 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	. "gopkg.in/check.v1"
+)
+
+type UploadArchiveRequestSuite struct{}
+
+var _ = Suite(&UploadArchiveRequestSuite{})
+
+func (s *UploadArchiveRequestSuite) TestEncodeDecode(c *C) {
+	req := &UploadArchiveRequest{Args: []string{"--format=zip", "HEAD", "docs"}}
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(req.Encode(buf), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"001aargument --format=zip\n"+
+		"0012argument HEAD\n"+
+		"0012argument docs\n"+
+		"0000")
+
+	decoded := &UploadArchiveRequest{}
+	c.Assert(decoded.Decode(buf), IsNil)
+	c.Assert(decoded, DeepEquals, req)
+}
+
+func (s *UploadArchiveRequestSuite) TestDecodeUnexpectedLine(c *C) {
+	req := &UploadArchiveRequest{}
+	err := req.Decode(bytes.NewBufferString("0009want\n0000"))
+	c.Assert(err, ErrorMatches, "unexpected line in upload-archive request.*")
+}
+
+func (s *UploadArchiveRequestSuite) TestDecodeWithoutFlush(c *C) {
+	req := &UploadArchiveRequest{}
+	err := req.Decode(bytes.NewBufferString("0012argument HEAD\n"))
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *UploadArchiveRequestSuite) TestUploadArchiveStatus(c *C) {
+	buf := bytes.NewBuffer(nil)
+	c.Assert(EncodeUploadArchiveStatus(buf, nil), IsNil)
+	c.Assert(buf.String(), Equals, "0008ACK\n0000")
+	c.Assert(DecodeUploadArchiveStatus(buf), IsNil)
+
+	buf.Reset()
+	c.Assert(EncodeUploadArchiveStatus(buf, errors.New("no such ref")), IsNil)
+	c.Assert(buf.String(), Equals, "0015NACK no such ref\n0000")
+	c.Assert(DecodeUploadArchiveStatus(buf), ErrorMatches,
+		"upload-archive request rejected: no such ref")
+
+	err := DecodeUploadArchiveStatus(bytes.NewBufferString("0007NAK0000"))
+	c.Assert(err, ErrorMatches, "unexpected upload-archive status.*")
+}
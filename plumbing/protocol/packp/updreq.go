@@ -20,6 +20,9 @@ type ReferenceUpdateRequest struct {
 	Capabilities *capability.List
 	Commands     []*Command
 	Shallow      *plumbing.Hash
+	// Options are the push options sent to the server, they are only sent
+	// if the push-options capability is set.
+	Options []string
 	// Packfile contains an optional packfile reader.
 	Packfile io.ReadCloser
 
@@ -49,6 +52,7 @@ func NewReferenceUpdateRequest() *ReferenceUpdateRequest {
 //   - delete-refs
 // It leaves up to the user to add the following capabilities later:
 //   - atomic
+//   - push-options
 //   - ofs-delta
 //   - side-band
 //   - side-band-64k
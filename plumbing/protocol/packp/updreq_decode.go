@@ -10,6 +10,7 @@ import (
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
 )
 
 var (
@@ -22,6 +23,7 @@ var (
 	ErrEmpty                        = errors.New("empty update-request message")
 	errNoCommands                   = errors.New("unexpected EOF before any command")
 	errMissingCapabilitiesDelimiter = errors.New("capabilities delimiter not found")
+	errMissingPushOptionsFlush      = errors.New("unexpected EOF before push options flush")
 )
 
 func errMalformedRequest(reason string) error {
@@ -101,6 +103,7 @@ func (d *updReqDecoder) Decode(req *ReferenceUpdateRequest) error {
 		d.decodeShallow,
 		d.decodeCommandAndCapabilities,
 		d.decodeCommands,
+		d.decodeOptions,
 		d.setPackfile,
 		req.validate,
 	}
@@ -167,6 +170,25 @@ func (d *updReqDecoder) decodeCommands() error {
 	}
 }
 
+func (d *updReqDecoder) decodeOptions() error {
+	if !d.req.Capabilities.Supports(capability.PushOptions) {
+		return nil
+	}
+
+	for {
+		if ok := d.s.Scan(); !ok {
+			return d.scanErrorOr(errMissingPushOptionsFlush)
+		}
+
+		b := d.s.Bytes()
+		if bytes.Equal(b, pktline.Flush) {
+			return nil
+		}
+
+		d.req.Options = append(d.req.Options, string(b))
+	}
+}
+
 func (d *updReqDecoder) decodeCommandAndCapabilities() error {
 	b := d.s.Bytes()
 	i := bytes.IndexByte(b, 0)
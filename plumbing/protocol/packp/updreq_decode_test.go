@@ -261,6 +261,48 @@ func (s *UpdReqDecodeSuite) TestWithPackfile(c *C) {
 	s.testDecodeOkRaw(c, expected, buf.Bytes())
 }
 
+func (s *UpdReqDecodeSuite) TestPushOptionsWithPackfile(c *C) {
+	hash1 := plumbing.NewHash("1ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	hash2 := plumbing.NewHash("2ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	name := plumbing.ReferenceName("myref")
+
+	expected := NewReferenceUpdateRequest()
+	expected.Commands = []*Command{
+		{Name: name, Old: hash1, New: hash2},
+	}
+	expected.Capabilities.Add("push-options")
+	expected.Options = []string{"ci.skip", "reviewer=foo"}
+	packfileContent := []byte("PACKabc")
+	expected.Packfile = ioutil.NopCloser(bytes.NewReader(packfileContent))
+
+	payloads := []string{
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 myref\x00push-options",
+		pktline.FlushString,
+		"ci.skip",
+		"reviewer=foo",
+		pktline.FlushString,
+	}
+	var buf bytes.Buffer
+	e := pktline.NewEncoder(&buf)
+	c.Assert(e.EncodeString(payloads...), IsNil)
+	buf.Write(packfileContent)
+
+	s.testDecodeOkRaw(c, expected, buf.Bytes())
+}
+
+func (s *UpdReqDecodeSuite) TestPushOptionsMissingFlush(c *C) {
+	payloads := []string{
+		"1ecf0ef2c2dffb796033e5a02219af86ec6584e5 2ecf0ef2c2dffb796033e5a02219af86ec6584e5 myref\x00push-options",
+		pktline.FlushString,
+		"ci.skip",
+	}
+	var buf bytes.Buffer
+	e := pktline.NewEncoder(&buf)
+	c.Assert(e.EncodeString(payloads...), IsNil)
+
+	s.testDecoderErrorMatches(c, &buf, ".*EOF before push options flush.*")
+}
+
 func (s *UpdReqDecodeSuite) testDecoderErrorMatches(c *C, input io.Reader, pattern string) {
 	r := NewReferenceUpdateRequest()
 	c.Assert(r.Decode(input), ErrorMatches, pattern)
@@ -29,6 +29,12 @@ func (r *ReferenceUpdateRequest) Encode(w io.Writer) error {
 		return err
 	}
 
+	if r.Capabilities.Supports(capability.PushOptions) {
+		if err := r.encodeOptions(e, r.Options); err != nil {
+			return err
+		}
+	}
+
 	if r.Packfile != nil {
 		if _, err := io.Copy(w, r.Packfile); err != nil {
 			return err
@@ -68,6 +74,18 @@ func (r *ReferenceUpdateRequest) encodeCommands(e *pktline.Encoder,
 	return e.Flush()
 }
 
+func (r *ReferenceUpdateRequest) encodeOptions(e *pktline.Encoder,
+	opts []string) error {
+
+	for _, opt := range opts {
+		if err := e.EncodeString(opt); err != nil {
+			return err
+		}
+	}
+
+	return e.Flush()
+}
+
 func formatCommand(cmd *Command) string {
 	o := cmd.Old.String()
 	n := cmd.New.String()
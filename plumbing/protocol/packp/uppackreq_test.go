@@ -41,6 +41,12 @@ func (s *UploadPackRequestSuite) TestIsEmpty(c *C) {
 	r.Haves = append(r.Haves, plumbing.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c"))
 
 	c.Assert(r.IsEmpty(), Equals, true)
+
+	r.Shallows = append(r.Shallows, plumbing.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c"))
+	c.Assert(r.IsEmpty(), Equals, true)
+
+	r.Depth = DepthCommits(1)
+	c.Assert(r.IsEmpty(), Equals, false)
 }
 
 type UploadHavesSuite struct{}
@@ -21,18 +21,38 @@ func Objects(
 	objs,
 	ignore []plumbing.Hash,
 ) ([]plumbing.Hash, error) {
-	ignore, err := objects(s, ignore, nil, true)
+	ignore, err := objects(s, ignore, nil, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	return objects(s, objs, ignore, false)
+	return objects(s, objs, ignore, nil, false)
+}
+
+// ShallowObjects is like Objects, but the history is only walked down to the
+// given shallow commits: they are part of the result, their parents are not.
+// The ignored objects are walked down to ignoreShallows instead, since a
+// shallow client only holds the history down to its own shallow commits.
+func ShallowObjects(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore,
+	shallows,
+	ignoreShallows []plumbing.Hash,
+) ([]plumbing.Hash, error) {
+	ignore, err := objects(s, ignore, nil, hashListToSet(ignoreShallows), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return objects(s, objs, ignore, hashListToSet(shallows), false)
 }
 
 func objects(
 	s storer.EncodedObjectStorer,
 	objects,
 	ignore []plumbing.Hash,
+	shallows map[plumbing.Hash]bool,
 	allowMissingObjects bool,
 ) ([]plumbing.Hash, error) {
 	seen := hashListToSet(ignore)
@@ -47,7 +67,7 @@ func objects(
 	}
 
 	for _, h := range objects {
-		if err := processObject(s, h, seen, visited, ignore, walkerFunc); err != nil {
+		if err := processObject(s, h, seen, visited, ignore, shallows, walkerFunc); err != nil {
 			if allowMissingObjects && err == plumbing.ErrObjectNotFound {
 				continue
 			}
@@ -66,6 +86,7 @@ func processObject(
 	seen map[plumbing.Hash]bool,
 	visited map[plumbing.Hash]bool,
 	ignore []plumbing.Hash,
+	shallows map[plumbing.Hash]bool,
 	walkerFunc func(h plumbing.Hash),
 ) error {
 	if seen[h] {
@@ -84,12 +105,16 @@ func processObject(
 
 	switch do := do.(type) {
 	case *object.Commit:
+		if len(shallows) != 0 {
+			return shallowReachableObjects(do, seen, visited, shallows, walkerFunc)
+		}
+
 		return reachableObjects(do, seen, visited, ignore, walkerFunc)
 	case *object.Tree:
 		return iterateCommitTrees(seen, do, walkerFunc)
 	case *object.Tag:
 		walkerFunc(do.Hash)
-		return processObject(s, do.Target, seen, visited, ignore, walkerFunc)
+		return processObject(s, do.Target, seen, visited, ignore, shallows, walkerFunc)
 	case *object.Blob:
 		walkerFunc(do.Hash)
 	default:
@@ -154,6 +179,53 @@ func reachableObjects(
 	return nil
 }
 
+// shallowReachableObjects is like reachableObjects, but the parents of the
+// commits in the shallows set are not walked.
+func shallowReachableObjects(
+	commit *object.Commit,
+	seen map[plumbing.Hash]bool,
+	visited map[plumbing.Hash]bool,
+	shallows map[plumbing.Hash]bool,
+	cb func(h plumbing.Hash),
+) error {
+	stack := []*object.Commit{commit}
+	for len(stack) > 0 {
+		commit := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if visited[commit.Hash] || seen[commit.Hash] {
+			continue
+		}
+
+		visited[commit.Hash] = true
+		cb(commit.Hash)
+
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+
+		if err := iterateCommitTrees(seen, tree, cb); err != nil {
+			return err
+		}
+
+		if shallows[commit.Hash] {
+			continue
+		}
+
+		err = commit.Parents().ForEach(func(p *object.Commit) error {
+			stack = append(stack, p)
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func addPendingParents(pending, visited map[plumbing.Hash]bool, commit *object.Commit) {
 	for _, p := range commit.ParentHashes {
 		if !visited[p] {
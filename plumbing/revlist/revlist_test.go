@@ -272,3 +272,43 @@ func (s *RevListSuite) TestReachableObjectsNoRevisit(c *C) {
 		plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"),
 	})
 }
+
+// * 6ecf0ef vendor stuff
+// | * e8d3ffa some code in a branch
+// |/
+// * 918c48b some code
+// -----
+func (s *RevListSuite) TestShallowObjects(c *C) {
+	hist, err := ShallowObjects(s.Storer,
+		[]plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)}, nil,
+		[]plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)}, nil)
+	c.Assert(err, IsNil)
+
+	set := hashListToSet(hist)
+	c.Assert(set[plumbing.NewHash(someCommitOtherBranch)], Equals, true)
+	c.Assert(set[plumbing.NewHash(someCommit)], Equals, false)
+
+	tree := s.commit(c, plumbing.NewHash(someCommitOtherBranch)).TreeHash
+	c.Assert(set[tree], Equals, true)
+}
+
+func (s *RevListSuite) TestShallowObjectsIgnoreShallows(c *C) {
+	parent := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+	hist, err := ShallowObjects(s.Storer,
+		[]plumbing.Hash{parent},
+		[]plumbing.Hash{plumbing.NewHash(someCommit)},
+		nil,
+		[]plumbing.Hash{plumbing.NewHash(someCommit)})
+	c.Assert(err, IsNil)
+
+	set := hashListToSet(hist)
+	c.Assert(set[parent], Equals, true)
+	c.Assert(set[plumbing.NewHash(someCommit)], Equals, false)
+	c.Assert(set[plumbing.NewHash(initialCommit)], Equals, true)
+
+	hist, err = Objects(s.Storer,
+		[]plumbing.Hash{parent},
+		[]plumbing.Hash{plumbing.NewHash(someCommit)})
+	c.Assert(err, IsNil)
+	c.Assert(hist, HasLen, 0)
+}
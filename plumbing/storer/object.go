@@ -97,6 +97,15 @@ type PackfileWriter interface {
 	PackfileWriter() (io.WriteCloser, error)
 }
 
+// ProgressPackfileWriter is a optional method for ObjectStorer, a
+// PackfileWriter reporting the progress of the parsing of the packfile written
+// to the given handler.
+type ProgressPackfileWriter interface {
+	// PackfileWriterWithProgress returns a writer for writing a packfile to
+	// the storage, sending the progress events of its parsing to h.
+	PackfileWriterWithProgress(h plumbing.ProgressHandler) (io.WriteCloser, error)
+}
+
 // EncodedObjectIter is a generic closable interface for iterating over objects.
 type EncodedObjectIter interface {
 	Next() (plumbing.EncodedObject, error)
@@ -0,0 +1,194 @@
+// Package bundle implements a transport fetching the references and objects
+// of a git bundle file.
+package bundle
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+var (
+	// ErrPush is returned when pushing to a bundle.
+	ErrPush = errors.New("push to a bundle is not supported")
+	// ErrShallow is returned when a shallow fetch is requested from a bundle.
+	ErrShallow = errors.New("shallow fetch is not supported from a bundle")
+	// ErrMissingPrerequisites is returned when cloning a bundle depending on
+	// prerequisite commits.
+	ErrMissingPrerequisites = errors.New("the bundle requires prerequisite commits")
+)
+
+// DefaultClient is the default bundle client.
+var DefaultClient = NewClient()
+
+// NewClient returns a new bundle client. The path of the endpoints is the
+// path of the bundle file.
+func NewClient() transport.Transport {
+	return &client{}
+}
+
+// IsBundle returns true if the given path is a file starting with the
+// signature of a bundle.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	line = line[:len(line)-1]
+	return line == bundle.V2Signature || line == bundle.V3Signature
+}
+
+type client struct{}
+
+func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.UploadPackSession, error) {
+	return &upSession{path: ep.Path}, nil
+}
+
+func (c *client) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
+	transport.ReceivePackSession, error) {
+	return nil, ErrPush
+}
+
+type upSession struct {
+	path   string
+	header *bundle.Header
+}
+
+// open opens the bundle, returning the file positioned at the packfile.
+func (s *upSession) open() (*bundle.Header, io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil, transport.ErrRepositoryNotFound
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := bundle.NewDecoder(f)
+	h := bundle.NewHeader()
+	if err := d.Decode(h); err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("%s: %s", s.path, err)
+	}
+
+	return h, ioutil.NewReadCloser(d.Packfile(), f), nil
+}
+
+// AdvertisedReferences returns the references of the bundle, HEAD pointing
+// to a branch with its hash, if any.
+func (s *upSession) AdvertisedReferences() (*packp.AdvRefs, error) {
+	if s.header == nil {
+		h, r, err := s.open()
+		if err != nil {
+			return nil, err
+		}
+
+		_ = r.Close()
+		s.header = h
+	}
+
+	ar := packp.NewAdvRefs()
+	var head *plumbing.Hash
+	for _, ref := range s.header.References {
+		if ref.Name() == plumbing.HEAD {
+			h := ref.Hash()
+			head = &h
+			continue
+		}
+
+		ar.References[ref.Name().String()] = ref.Hash()
+	}
+
+	if head == nil && len(ar.References) == 0 {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	if head != nil {
+		ar.Head = head
+		if target := headTarget(ar.References, *head); target != "" {
+			if err := ar.Capabilities.Add(capability.SymRef,
+				fmt.Sprintf("%s:%s", plumbing.HEAD, target)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ar, nil
+}
+
+// headTarget returns the branch HEAD most likely points to, as the bundle
+// does not record it: master if it has the hash of HEAD, or the first one in
+// order.
+func headTarget(refs map[string]plumbing.Hash, head plumbing.Hash) string {
+	master := plumbing.Master.String()
+	if refs[master] == head {
+		return master
+	}
+
+	var names []string
+	for name, h := range refs {
+		if h == head && plumbing.ReferenceName(name).IsBranch() {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	sort.Strings(names)
+	return names[0]
+}
+
+// UploadPack returns the packfile of the bundle, with all its objects, which
+// do not depend on the wants and haves of the request. The prerequisites of
+// the bundle are expected to be in the repository.
+func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (
+	*packp.UploadPackResponse, error) {
+	if req.IsEmpty() {
+		return nil, transport.ErrEmptyUploadPackRequest
+	}
+
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return nil, ErrShallow
+	}
+
+	h, r, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.Prerequisites) != 0 && len(req.Haves) == 0 {
+		_ = r.Close()
+		return nil, ErrMissingPrerequisites
+	}
+
+	return packp.NewUploadPackResponseWithPackfile(req,
+		ioutil.NewContextReadCloser(ctx, r),
+	), nil
+}
+
+func (s *upSession) Close() error {
+	return nil
+}
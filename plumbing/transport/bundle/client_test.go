@@ -0,0 +1,167 @@
+package bundle
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ClientSuite struct {
+	fixtures.Suite
+	dir string
+}
+
+var _ = Suite(&ClientSuite{})
+
+const master = "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+
+func (s *ClientSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "bundle")
+	c.Assert(err, IsNil)
+}
+
+func (s *ClientSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+// writeBundle writes a bundle with the packfile of the basic fixture.
+func (s *ClientSuite) writeBundle(c *C, h *bundle.Header) string {
+	path := filepath.Join(s.dir, "repo.bundle")
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	c.Assert(bundle.NewEncoder(f).Encode(h), IsNil)
+
+	p := fixtures.Basic().One().Packfile()
+	defer p.Close()
+
+	_, err = io.Copy(f, p)
+	c.Assert(err, IsNil)
+	return path
+}
+
+func (s *ClientSuite) basicHeader() *bundle.Header {
+	h := bundle.NewHeader()
+	h.References = []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(master)),
+		plumbing.NewHashReference("refs/heads/branch", plumbing.NewHash(master)),
+		plumbing.NewHashReference(plumbing.Master, plumbing.NewHash(master)),
+	}
+
+	return h
+}
+
+func (s *ClientSuite) newSession(c *C, path string) transport.UploadPackSession {
+	ep, err := transport.NewEndpoint(path)
+	c.Assert(err, IsNil)
+
+	session, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	return session
+}
+
+func (s *ClientSuite) TestIsBundle(c *C) {
+	path := s.writeBundle(c, s.basicHeader())
+	c.Assert(IsBundle(path), Equals, true)
+	c.Assert(IsBundle(s.dir), Equals, false)
+	c.Assert(IsBundle(filepath.Join(s.dir, "missing")), Equals, false)
+
+	other := filepath.Join(s.dir, "other")
+	c.Assert(ioutil.WriteFile(other, []byte("# v9 git bundle\n"), 0644), IsNil)
+	c.Assert(IsBundle(other), Equals, false)
+}
+
+func (s *ClientSuite) TestAdvertisedReferences(c *C) {
+	session := s.newSession(c, s.writeBundle(c, s.basicHeader()))
+	defer session.Close()
+
+	ar, err := session.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head, NotNil)
+	c.Assert(ar.Head.String(), Equals, master)
+	c.Assert(ar.References, HasLen, 2)
+	c.Assert(ar.References["refs/heads/branch"].String(), Equals, master)
+	c.Assert(ar.Capabilities.Get(capability.SymRef), DeepEquals,
+		[]string{"HEAD:refs/heads/master"})
+}
+
+func (s *ClientSuite) TestAdvertisedReferencesNotFound(c *C) {
+	session := s.newSession(c, filepath.Join(s.dir, "missing.bundle"))
+	_, err := session.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+}
+
+func (s *ClientSuite) TestAdvertisedReferencesEmpty(c *C) {
+	session := s.newSession(c, s.writeBundle(c, bundle.NewHeader()))
+	_, err := session.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrEmptyRemoteRepository)
+}
+
+func (s *ClientSuite) TestUploadPack(c *C) {
+	session := s.newSession(c, s.writeBundle(c, s.basicHeader()))
+	defer session.Close()
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash(master))
+
+	resp, err := session.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+	defer resp.Close()
+
+	sto := memory.NewStorage()
+	c.Assert(packfile.UpdateObjectStorage(sto, resp), IsNil)
+	c.Assert(sto.Objects, HasLen, 31)
+
+	_, err = sto.EncodedObject(plumbing.CommitObject, plumbing.NewHash(master))
+	c.Assert(err, IsNil)
+}
+
+func (s *ClientSuite) TestUploadPackMissingPrerequisites(c *C) {
+	h := s.basicHeader()
+	h.Prerequisites = []bundle.Prerequisite{
+		{Hash: plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")},
+	}
+
+	session := s.newSession(c, s.writeBundle(c, h))
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash(master))
+
+	_, err := session.UploadPack(context.Background(), req)
+	c.Assert(err, Equals, ErrMissingPrerequisites)
+}
+
+func (s *ClientSuite) TestUploadPackShallow(c *C) {
+	session := s.newSession(c, s.writeBundle(c, s.basicHeader()))
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash(master))
+	req.Depth = packp.DepthCommits(1)
+
+	_, err := session.UploadPack(context.Background(), req)
+	c.Assert(err, Equals, ErrShallow)
+}
+
+func (s *ClientSuite) TestReceivePack(c *C) {
+	ep, err := transport.NewEndpoint(s.writeBundle(c, s.basicHeader()))
+	c.Assert(err, IsNil)
+
+	_, err = DefaultClient.NewReceivePackSession(ep, nil)
+	c.Assert(err, Equals, ErrPush)
+}
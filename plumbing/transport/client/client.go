@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/bundle"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/file"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/git"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
@@ -32,9 +33,14 @@ func InstallProtocol(scheme string, c transport.Transport) {
 }
 
 // NewClient returns the appropriate client among of the set of known protocols:
-// http://, https://, ssh:// and file://.
+// http://, https://, ssh:// and file://. Local paths of bundle files are
+// read with the bundle client.
 // See `InstallProtocol` to add or modify protocols.
 func NewClient(endpoint *transport.Endpoint) (transport.Transport, error) {
+	if endpoint.Protocol == "file" && bundle.IsBundle(endpoint.Path) {
+		return bundle.DefaultClient, nil
+	}
+
 	f, ok := Protocols[endpoint.Protocol]
 	if !ok {
 		return nil, fmt.Errorf("unsupported scheme %q", endpoint.Protocol)
@@ -24,8 +24,10 @@ import (
 	"strings"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 )
 
 var (
@@ -39,8 +41,9 @@ var (
 )
 
 const (
-	UploadPackServiceName  = "git-upload-pack"
-	ReceivePackServiceName = "git-receive-pack"
+	UploadPackServiceName    = "git-upload-pack"
+	ReceivePackServiceName   = "git-receive-pack"
+	UploadArchiveServiceName = "git-upload-archive"
 )
 
 // Transport can initiate git-upload-pack and git-receive-pack processes.
@@ -52,6 +55,35 @@ type Transport interface {
 	NewReceivePackSession(*Endpoint, AuthMethod) (ReceivePackSession, error)
 }
 
+// CommandTransport is a Transport running the git-upload-pack and
+// git-receive-pack commands on the remote side, whose commands can be
+// replaced, as the remote.<name>.uploadpack and receivepack options of git.
+type CommandTransport interface {
+	Transport
+	// WithCommands returns a copy of the transport running the given commands
+	// instead of git-upload-pack and git-receive-pack. An empty command keeps
+	// the default one.
+	WithCommands(uploadPack, receivePack string) Transport
+}
+
+// ConfigTransport is a Transport whose settings can be read from the git
+// config, like the http.<url> options of the HTTP transport.
+type ConfigTransport interface {
+	Transport
+	// WithConfig returns a copy of the transport using the settings of the
+	// given config.
+	WithConfig(cfg *format.Config) Transport
+}
+
+// UploadArchiveTransport is a Transport able to start git-upload-archive
+// sessions too.
+type UploadArchiveTransport interface {
+	Transport
+	// NewUploadArchiveSession starts a git-upload-archive session for an
+	// endpoint.
+	NewUploadArchiveSession(*Endpoint, AuthMethod) (UploadArchiveSession, error)
+}
+
 type Session interface {
 	// AdvertisedReferences retrieves the advertised references for a
 	// repository.
@@ -78,6 +110,17 @@ type UploadPackSession interface {
 	UploadPack(context.Context, *packp.UploadPackRequest) (*packp.UploadPackResponse, error)
 }
 
+// LocalObjectsSession is an UploadPackSession walking the objects to fetch
+// on the client side, like the dumb HTTP protocol, which can skip the objects
+// the client already has.
+type LocalObjectsSession interface {
+	UploadPackSession
+	// SetLocalObjects sets the storer of the objects of the client, the
+	// objects found in it, and the ones reachable from them, are not
+	// downloaded by UploadPack.
+	SetLocalObjects(storer.EncodedObjectStorer)
+}
+
 // ReceivePackSession represents a git-receive-pack session.
 // A git-receive-pack session has two steps: reference discovery
 // (AdvertisedReferences) and receiving pack (ReceivePack).
@@ -92,6 +135,16 @@ type ReceivePackSession interface {
 	ReceivePack(context.Context, *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error)
 }
 
+// UploadArchiveSession represents a git-upload-archive session, running
+// git-archive on the remote side.
+type UploadArchiveSession interface {
+	io.Closer
+	// UploadArchive takes the arguments of git-archive and returns the
+	// archive. The arguments are validated before returning, errors
+	// writing the archive are returned when reading it.
+	UploadArchive(context.Context, *packp.UploadArchiveRequest) (io.ReadCloser, error)
+}
+
 // Endpoint represents a Git URL in any supported protocol.
 type Endpoint struct {
 	// Protocol is the protocol of the endpoint (e.g. git, https, file).
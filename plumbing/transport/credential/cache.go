@@ -0,0 +1,126 @@
+package credential
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCacheTimeout is the time the credentials are kept by the cache
+// helper, unless configured with --timeout.
+const DefaultCacheTimeout = 900 * time.Second
+
+// DefaultCache is the cache used by the built-in cache helper. Unlike
+// git-credential-cache, which runs a daemon, the credentials are kept in the
+// memory of the process.
+var DefaultCache = NewCache()
+
+// Cache is an in-memory storage of credentials, expiring after a timeout.
+type Cache struct {
+	mu      sync.Mutex
+	entries []*cacheEntry
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	credential *Credential
+	expiration time.Time
+}
+
+// NewCache returns a new empty Cache.
+func NewCache() *Cache {
+	return &Cache{now: time.Now}
+}
+
+// Helper returns a Helper storing the credentials in the cache for the given
+// timeout.
+func (c *Cache) Helper(timeout time.Duration) Helper {
+	return &cacheHelper{c, timeout}
+}
+
+func (c *Cache) get(requested *Credential) *Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+	for _, e := range c.entries {
+		if e.credential.Matches(requested) {
+			return e.credential.clone()
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) store(cred *Credential, timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(&Credential{
+		Protocol: cred.Protocol,
+		Host:     cred.Host,
+		Path:     cred.Path,
+		Username: cred.Username,
+	})
+
+	c.entries = append(c.entries, &cacheEntry{
+		credential: cred.clone(),
+		expiration: c.now().Add(timeout),
+	})
+}
+
+func (c *Cache) erase(cred *Credential) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(cred)
+}
+
+func (c *Cache) remove(cred *Credential) {
+	var entries []*cacheEntry
+	for _, e := range c.entries {
+		if !e.credential.Matches(cred) {
+			entries = append(entries, e)
+		}
+	}
+
+	c.entries = entries
+}
+
+func (c *Cache) expire() {
+	now := c.now()
+
+	var entries []*cacheEntry
+	for _, e := range c.entries {
+		if now.Before(e.expiration) {
+			entries = append(entries, e)
+		}
+	}
+
+	c.entries = entries
+}
+
+type cacheHelper struct {
+	cache   *Cache
+	timeout time.Duration
+}
+
+func (h *cacheHelper) Get(requested *Credential) (*Credential, error) {
+	if c := h.cache.get(requested); c != nil {
+		return c, nil
+	}
+
+	return requested.clone(), nil
+}
+
+func (h *cacheHelper) Store(c *Credential) error {
+	if c.IsComplete() {
+		h.cache.store(c, h.timeout)
+	}
+
+	return nil
+}
+
+func (h *cacheHelper) Erase(c *Credential) error {
+	h.cache.erase(c)
+	return nil
+}
@@ -0,0 +1,45 @@
+package credential
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type CacheSuite struct{}
+
+var _ = Suite(&CacheSuite{})
+
+func (s *CacheSuite) TestStoreAndGet(c *C) {
+	h := NewCache().Helper(time.Minute)
+
+	cred := &Credential{Protocol: "https", Host: "example.com", Username: "foo", Password: "bar"}
+	c.Assert(h.Store(cred), IsNil)
+
+	got, err := h.Get(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, cred)
+
+	c.Assert(h.Erase(&Credential{Protocol: "https", Host: "example.com"}), IsNil)
+
+	got, err = h.Get(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(got.IsComplete(), Equals, false)
+}
+
+func (s *CacheSuite) TestExpiration(c *C) {
+	now := time.Now()
+	cache := NewCache()
+	cache.now = func() time.Time { return now }
+
+	h := cache.Helper(time.Minute)
+	c.Assert(h.Store(&Credential{
+		Protocol: "https", Host: "example.com", Username: "foo", Password: "bar",
+	}), IsNil)
+
+	now = now.Add(2 * time.Minute)
+
+	got, err := h.Get(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(got.IsComplete(), Equals, false)
+}
@@ -0,0 +1,153 @@
+// Package credential implements the git credential helpers protocol, used to
+// get the credentials of a URL from the helpers configured with the
+// credential.helper option, and to store or erase them once they are known to
+// be valid or invalid. See https://git-scm.com/docs/gitcredentials.
+package credential
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidAttribute is returned when decoding a malformed attribute line.
+var ErrInvalidAttribute = errors.New("credential: invalid attribute line")
+
+// Credential is the set of attributes exchanged with the credential helpers.
+type Credential struct {
+	// Protocol is the protocol of the URL, like https.
+	Protocol string
+	// Host is the host of the URL, including the port if any.
+	Host string
+	// Path is the path of the URL, without the leading slash. It is only
+	// given to the helpers when credential.useHttpPath is enabled.
+	Path string
+	// Username is the user name, if known.
+	Username string
+	// Password is the password, if known.
+	Password string
+	// Quit is set by a helper to stop asking the following ones.
+	Quit bool
+}
+
+// NewFromURL returns the Credential of the given URL, with the user name and
+// password of the URL if any.
+func NewFromURL(rawurl string) (*Credential, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+
+	return c, nil
+}
+
+// URL returns the URL of the credential, without the user name and password.
+func (c *Credential) URL() string {
+	u := url.URL{Scheme: c.Protocol, Host: c.Host}
+	if c.Path != "" {
+		u.Path = "/" + c.Path
+	}
+
+	return u.String()
+}
+
+// IsComplete returns true if both the user name and the password are known.
+func (c *Credential) IsComplete() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// Matches returns true if c, a stored credential, applies to the requested
+// one: the attributes set in requested must be equal in c.
+func (c *Credential) Matches(requested *Credential) bool {
+	return matchAttribute(requested.Protocol, c.Protocol) &&
+		matchAttribute(requested.Host, c.Host) &&
+		matchAttribute(requested.Path, c.Path) &&
+		matchAttribute(requested.Username, c.Username)
+}
+
+func matchAttribute(want, got string) bool {
+	return want == "" || want == got
+}
+
+// Encode writes the attributes of the credential in the format of the helpers
+// protocol, a key=value line for each attribute set.
+func (c *Credential) Encode(w io.Writer) error {
+	attrs := [][2]string{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"path", c.Path},
+		{"username", c.Username},
+		{"password", c.Password},
+	}
+
+	for _, a := range attrs {
+		if a[1] == "" {
+			continue
+		}
+
+		if strings.ContainsAny(a[1], "\n\x00") {
+			return fmt.Errorf("credential: invalid value for %s", a[0])
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", a[0], a[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the attributes written by a helper, until EOF or an empty
+// line. The attributes read override the ones of the credential, the unknown
+// ones are ignored.
+func (c *Credential) Decode(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return ErrInvalidAttribute
+		}
+
+		value := line[i+1:]
+		switch line[:i] {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		case "quit":
+			c.Quit = value == "1" || value == "true"
+		}
+	}
+
+	return s.Err()
+}
+
+func (c *Credential) clone() *Credential {
+	cp := *c
+	return &cp
+}
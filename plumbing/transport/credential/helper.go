@@ -0,0 +1,134 @@
+package credential
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Helper is a credential helper, a storage of credentials.
+type Helper interface {
+	// Get returns the credential requested completed with the attributes
+	// known by the helper, if any.
+	Get(requested *Credential) (*Credential, error)
+	// Store stores the given complete credential.
+	Store(c *Credential) error
+	// Erase removes the stored credentials matching the given one.
+	Erase(c *Credential) error
+}
+
+// NewHelper returns the Helper of the given credential.helper value, as git
+// does: the built-in helpers store and cache, a shell command if it starts
+// with !, an executable if it is an absolute path, otherwise the
+// git-credential-<name> command. The arguments of the value are given to the
+// helper.
+func NewHelper(value string) Helper {
+	fields := strings.Fields(value)
+	if len(fields) != 0 {
+		switch fields[0] {
+		case "store":
+			return newStoreFromArgs(fields[1:])
+		case "cache":
+			return newCacheFromArgs(fields[1:])
+		}
+	}
+
+	return &ExecHelper{Command: helperCommand(value)}
+}
+
+func helperCommand(value string) string {
+	if strings.HasPrefix(value, "!") {
+		return value[1:]
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 0 && filepath.IsAbs(fields[0]) {
+		return value
+	}
+
+	return "git credential-" + value
+}
+
+func newStoreFromArgs(args []string) Helper {
+	s := &Store{}
+	for _, a := range args {
+		if strings.HasPrefix(a, "--file=") {
+			s.Path = strings.TrimPrefix(a, "--file=")
+		}
+	}
+
+	return s
+}
+
+func newCacheFromArgs(args []string) Helper {
+	timeout := DefaultCacheTimeout
+	for _, a := range args {
+		if !strings.HasPrefix(a, "--timeout=") {
+			continue
+		}
+
+		if secs, err := strconv.Atoi(strings.TrimPrefix(a, "--timeout=")); err == nil {
+			timeout = time.Duration(secs) * time.Second
+		}
+	}
+
+	return &cacheHelper{DefaultCache, timeout}
+}
+
+// ExecHelper is a Helper running an external command through the shell, with
+// the operation, get, store or erase, appended as its last argument.
+type ExecHelper struct {
+	// Command is the shell command of the helper.
+	Command string
+}
+
+// Get runs the get operation of the helper.
+func (h *ExecHelper) Get(requested *Credential) (*Credential, error) {
+	out, err := h.run("get", requested)
+	if err != nil {
+		return nil, err
+	}
+
+	c := requested.clone()
+	if err := c.Decode(bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Store runs the store operation of the helper.
+func (h *ExecHelper) Store(c *Credential) error {
+	_, err := h.run("store", c)
+	return err
+}
+
+// Erase runs the erase operation of the helper.
+func (h *ExecHelper) Erase(c *Credential) error {
+	_, err := h.run("erase", c)
+	return err
+}
+
+func (h *ExecHelper) run(op string, c *Credential) ([]byte, error) {
+	in := &bytes.Buffer{}
+	if err := c.Encode(in); err != nil {
+		return nil, err
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", h.Command+" "+op)
+	cmd.Stdin = in
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %q: %s: %s",
+			h.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
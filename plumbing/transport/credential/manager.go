@@ -0,0 +1,240 @@
+package credential
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+// ErrNotFound is returned by Fill when the helpers do not know the user name
+// and password of the credential.
+var ErrNotFound = errors.New("credential: not found")
+
+const (
+	credentialSection = "credential"
+	helperKey         = "helper"
+	usernameKey       = "username"
+	useHTTPPathKey    = "useHttpPath"
+)
+
+// Manager gets, stores and erases credentials with the helpers configured for
+// their URL, as git credential fill, approve and reject do. The options are
+// read from the credential section and the credential.<url> subsections
+// matching the URL: helper, username and useHttpPath.
+type Manager struct {
+	// Config is the config holding the credential options. If nil, the
+	// system and global configs are read on each operation.
+	Config *format.Config
+	// Helpers, if not nil, are used instead of the configured helpers.
+	Helpers []Helper
+}
+
+// NewManager returns a Manager reading the options from the given config, or
+// from the system and global configs if nil.
+func NewManager(cfg *format.Config) *Manager {
+	return &Manager{Config: cfg}
+}
+
+// Fill returns the given credential completed with the user name and password
+// returned by the helpers, asking them in order until both are known. It
+// returns ErrNotFound if no helper knows them.
+func (m *Manager) Fill(c *Credential) (*Credential, error) {
+	opts, err := m.options(c)
+	if err != nil {
+		return nil, err
+	}
+
+	result := opts.normalize(c)
+	if result.IsComplete() {
+		return result, nil
+	}
+
+	var lastErr error
+	for _, h := range opts.helpers {
+		got, err := h.Get(result)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		merge(result, got)
+		if result.IsComplete() || got.Quit {
+			break
+		}
+	}
+
+	if !result.IsComplete() {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+
+		return nil, ErrNotFound
+	}
+
+	return result, nil
+}
+
+// Approve stores the given credential, known to be valid, in all the helpers.
+func (m *Manager) Approve(c *Credential) error {
+	if !c.IsComplete() {
+		return nil
+	}
+
+	return m.each(c, func(h Helper, c *Credential) error {
+		return h.Store(c)
+	})
+}
+
+// Reject erases the given credential, known to be invalid, from all the
+// helpers.
+func (m *Manager) Reject(c *Credential) error {
+	return m.each(c, func(h Helper, c *Credential) error {
+		return h.Erase(c)
+	})
+}
+
+func (m *Manager) each(c *Credential, f func(Helper, *Credential) error) error {
+	opts, err := m.options(c)
+	if err != nil {
+		return err
+	}
+
+	c = opts.normalize(c)
+
+	var firstErr error
+	for _, h := range opts.helpers {
+		if err := f(h, c); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func merge(dst, src *Credential) {
+	if src.Username != "" {
+		dst.Username = src.Username
+	}
+
+	if src.Password != "" {
+		dst.Password = src.Password
+	}
+}
+
+type options struct {
+	helpers     []Helper
+	username    string
+	useHTTPPath bool
+}
+
+// normalize returns a copy of c with the default user name, and without the
+// path of HTTP URLs unless useHttpPath is enabled.
+func (o *options) normalize(c *Credential) *Credential {
+	c = c.clone()
+	c.Quit = false
+
+	if c.Username == "" {
+		c.Username = o.username
+	}
+
+	if !o.useHTTPPath && (c.Protocol == "http" || c.Protocol == "https") {
+		c.Path = ""
+	}
+
+	return c
+}
+
+func (m *Manager) options(c *Credential) (*options, error) {
+	cfg := m.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = loadConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	var opts options
+	var helpers []string
+
+	apply := func(o format.Options) {
+		for _, opt := range o {
+			switch {
+			case opt.IsKey(helperKey):
+				// an empty value resets the list of helpers
+				if opt.Value == "" {
+					helpers = nil
+				} else {
+					helpers = append(helpers, opt.Value)
+				}
+			case opt.IsKey(usernameKey):
+				opts.username = opt.Value
+			case opt.IsKey(useHTTPPathKey):
+				opts.useHTTPPath = opt.Value == "true" || opt.Value == "yes" ||
+					opt.Value == "on" || opt.Value == "1"
+			}
+		}
+	}
+
+	for _, s := range cfg.Sections {
+		if !s.IsName(credentialSection) {
+			continue
+		}
+
+		apply(s.Options)
+		for _, ss := range s.Subsections {
+			if matchURL(ss.Name, c) {
+				apply(ss.Options)
+			}
+		}
+	}
+
+	if m.Helpers != nil {
+		opts.helpers = m.Helpers
+		return &opts, nil
+	}
+
+	for _, h := range helpers {
+		opts.helpers = append(opts.helpers, NewHelper(h))
+	}
+
+	return &opts, nil
+}
+
+func loadConfig() (*format.Config, error) {
+	raw := format.New()
+	for _, scope := range []config.Scope{config.SystemScope, config.GlobalScope} {
+		cfg, err := config.LoadRaw(scope, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Merge(raw, cfg)
+	}
+
+	return raw, nil
+}
+
+// matchURL returns true if the URL of a credential.<url> subsection applies
+// to the credential: the protocol, host and user name, if given, must be
+// equal, and the path must be a prefix of the credential path.
+func matchURL(pattern string, c *Credential) bool {
+	u, err := url.Parse(pattern)
+	if err != nil || u.Scheme == "" {
+		// a bare host name
+		return strings.EqualFold(pattern, c.Host)
+	}
+
+	if u.Scheme != c.Protocol || !strings.EqualFold(u.Host, c.Host) {
+		return false
+	}
+
+	if u.User != nil && u.User.Username() != c.Username {
+		return false
+	}
+
+	p := strings.Trim(u.Path, "/")
+	return p == "" || c.Path == p || strings.HasPrefix(c.Path, p+"/")
+}
@@ -0,0 +1,117 @@
+package credential
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+type ManagerSuite struct {
+	dir string
+}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "go-git-credential-manager")
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *ManagerSuite) TestFillWithExecHelper(c *C) {
+	cfg := format.New()
+	cfg.Section("credential").
+		AddOption("helper", "!f() { echo username=foo; echo password=bar; }; f")
+
+	cred, err := NewManager(cfg).Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(cred.Username, Equals, "foo")
+	c.Assert(cred.Password, Equals, "bar")
+}
+
+func (s *ManagerSuite) TestFillNotFound(c *C) {
+	_, err := NewManager(format.New()).Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, Equals, ErrNotFound)
+}
+
+func (s *ManagerSuite) TestFillQuit(c *C) {
+	cfg := format.New()
+	cfg.Section("credential").
+		AddOption("helper", "!f() { echo quit=1; }; f").
+		AddOption("helper", "!f() { echo username=foo; echo password=bar; }; f")
+
+	_, err := NewManager(cfg).Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, Equals, ErrNotFound)
+}
+
+func (s *ManagerSuite) TestHelpersPerURL(c *C) {
+	cfg := format.New()
+	sec := cfg.Section("credential")
+	sec.AddOption("helper", "!f() { echo username=global; echo password=global; }; f")
+	sec.Subsection("https://example.com/org").
+		AddOption("helper", "").
+		AddOption("helper", "!f() { echo username=org; echo password=org; }; f").
+		AddOption("useHttpPath", "true")
+
+	m := NewManager(cfg)
+
+	cred, err := m.Fill(&Credential{Protocol: "https", Host: "example.com", Path: "org/repo.git"})
+	c.Assert(err, IsNil)
+	c.Assert(cred.Username, Equals, "org")
+	c.Assert(cred.Path, Equals, "org/repo.git")
+
+	cred, err = m.Fill(&Credential{Protocol: "https", Host: "example.com", Path: "other/repo.git"})
+	c.Assert(err, IsNil)
+	c.Assert(cred.Username, Equals, "global")
+	c.Assert(cred.Path, Equals, "")
+}
+
+func (s *ManagerSuite) TestApproveAndReject(c *C) {
+	path := filepath.Join(s.dir, "credentials")
+
+	cfg := format.New()
+	cfg.Section("credential").AddOption("helper", "store --file="+path)
+
+	m := NewManager(cfg)
+	cred := &Credential{
+		Protocol: "https", Host: "example.com", Path: "repo.git",
+		Username: "foo", Password: "bar",
+	}
+
+	c.Assert(m.Approve(cred), IsNil)
+
+	got, err := m.Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(got.Password, Equals, "bar")
+
+	c.Assert(m.Reject(cred), IsNil)
+
+	_, err = m.Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, Equals, ErrNotFound)
+}
+
+func (s *ManagerSuite) TestDefaultUsername(c *C) {
+	cache := NewCache()
+	c.Assert(cache.Helper(time.Minute).Store(&Credential{
+		Protocol: "https", Host: "example.com", Username: "foo", Password: "bar",
+	}), IsNil)
+	c.Assert(cache.Helper(time.Minute).Store(&Credential{
+		Protocol: "https", Host: "example.com", Username: "qux", Password: "baz",
+	}), IsNil)
+
+	cfg := format.New()
+	cfg.Section("credential").AddOption("username", "qux")
+
+	m := &Manager{Config: cfg, Helpers: []Helper{cache.Helper(time.Minute)}}
+	got, err := m.Fill(&Credential{Protocol: "https", Host: "example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(got.Password, Equals, "baz")
+}
@@ -12,9 +12,10 @@ import (
 
 type CommonSuite struct {
 	fixtures.Suite
-	ReceivePackBin string
-	UploadPackBin  string
-	tmpDir         string // to be removed at teardown
+	ReceivePackBin   string
+	UploadPackBin    string
+	UploadArchiveBin string
+	tmpDir           string // to be removed at teardown
 }
 
 var _ = Suite(&CommonSuite{})
@@ -31,12 +32,14 @@ func (s *CommonSuite) SetUpSuite(c *C) {
 	c.Assert(err, IsNil)
 	s.ReceivePackBin = filepath.Join(s.tmpDir, "git-receive-pack")
 	s.UploadPackBin = filepath.Join(s.tmpDir, "git-upload-pack")
+	s.UploadArchiveBin = filepath.Join(s.tmpDir, "git-upload-archive")
 	bin := filepath.Join(s.tmpDir, "go-git")
 	cmd := exec.Command("go", "build", "-o", bin,
 		"../../../cli/go-git/...")
 	c.Assert(cmd.Run(), IsNil)
 	c.Assert(os.Symlink(bin, s.ReceivePackBin), IsNil)
 	c.Assert(os.Symlink(bin, s.UploadPackBin), IsNil)
+	c.Assert(os.Symlink(bin, s.UploadArchiveBin), IsNil)
 }
 
 func (s *CommonSuite) TearDownSuite(c *C) {
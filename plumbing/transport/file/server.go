@@ -1,8 +1,13 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
@@ -10,11 +15,39 @@ import (
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
 )
 
+// ErrTimeout is returned when a request is interrupted by the timeout of its
+// ServerOptions.
+var ErrTimeout = errors.New("timeout reached without activity")
+
+// ServerOptions are the options of ServeUploadPackWithOptions and
+// ServeReceivePackWithOptions, matching the ones of git-upload-pack and
+// git-receive-pack.
+type ServerOptions struct {
+	// Strict only serves the given path if it is a git directory, instead of
+	// trying path/.git, path.git and path.git/.git too.
+	Strict bool
+	// Timeout interrupts the request if reading from the client or writing
+	// to it blocks for the given duration. Zero means no timeout.
+	Timeout time.Duration
+	// StatelessRPC serves a single request and response exchange, without
+	// advertising the references, as the smart HTTP protocol does. It is
+	// used by git-http-backend style CGI wrappers.
+	StatelessRPC bool
+	// AdvertiseRefs only writes the advertised references and returns.
+	AdvertiseRefs bool
+}
+
 // ServeUploadPack serves a git-upload-pack request using standard output, input
 // and error. This is meant to be used when implementing a git-upload-pack
 // command.
 func ServeUploadPack(path string) error {
-	ep, err := transport.NewEndpoint(path)
+	return ServeUploadPackWithOptions(path, &ServerOptions{})
+}
+
+// ServeUploadPackWithOptions serves a git-upload-pack request using standard
+// output, input and error, like ServeUploadPack, with the given options.
+func ServeUploadPackWithOptions(path string, o *ServerOptions) error {
+	ep, err := transport.NewEndpoint(gitDir(path, o.Strict))
 	if err != nil {
 		return err
 	}
@@ -25,14 +58,36 @@ func ServeUploadPack(path string) error {
 		return fmt.Errorf("error creating session: %s", err)
 	}
 
-	return common.ServeUploadPack(srvCmd, s)
+	if o.AdvertiseRefs {
+		return common.AdvertiseReferences(srvCmd, s)
+	}
+
+	sto, err := server.DefaultLoader.Load(ep)
+	if err != nil {
+		return err
+	}
+
+	return serve(o, func(ctx context.Context, cmd common.ServerCommand) error {
+		if o.StatelessRPC {
+			return common.ServeStatelessUploadPack(ctx, cmd, s, sto)
+		}
+
+		return common.ServeStatefulUploadPack(ctx, cmd, s, sto)
+	})
 }
 
 // ServeReceivePack serves a git-receive-pack request using standard output,
 // input and error. This is meant to be used when implementing a
 // git-receive-pack command.
 func ServeReceivePack(path string) error {
-	ep, err := transport.NewEndpoint(path)
+	return ServeReceivePackWithOptions(path, &ServerOptions{})
+}
+
+// ServeReceivePackWithOptions serves a git-receive-pack request using
+// standard output, input and error, like ServeReceivePack, with the given
+// options.
+func ServeReceivePackWithOptions(path string, o *ServerOptions) error {
+	ep, err := transport.NewEndpoint(gitDir(path, o.Strict))
 	if err != nil {
 		return err
 	}
@@ -43,7 +98,36 @@ func ServeReceivePack(path string) error {
 		return fmt.Errorf("error creating session: %s", err)
 	}
 
-	return common.ServeReceivePack(srvCmd, s)
+	if o.AdvertiseRefs {
+		return common.AdvertiseReferences(srvCmd, s)
+	}
+
+	return serve(o, func(ctx context.Context, cmd common.ServerCommand) error {
+		if o.StatelessRPC {
+			return common.ServeStatelessReceivePack(ctx, cmd, s)
+		}
+
+		return common.ServeStatefulReceivePack(ctx, cmd, s)
+	})
+}
+
+// ServeUploadArchive serves a git-upload-archive request using standard
+// output, input and error. This is meant to be used when implementing a
+// git-upload-archive command.
+func ServeUploadArchive(path string) error {
+	ep, err := transport.NewEndpoint(gitDir(path, false))
+	if err != nil {
+		return err
+	}
+
+	// TODO: define and implement a server-side AuthMethod
+	s, err := server.DefaultServer.(transport.UploadArchiveTransport).
+		NewUploadArchiveSession(ep, nil)
+	if err != nil {
+		return fmt.Errorf("error creating session: %s", err)
+	}
+
+	return common.ServeUploadArchive(context.Background(), srvCmd, s)
 }
 
 var srvCmd = common.ServerCommand{
@@ -51,3 +135,80 @@ var srvCmd = common.ServerCommand{
 	Stdout: ioutil.WriteNopCloser(os.Stdout),
 	Stderr: os.Stderr,
 }
+
+// gitDir returns the git directory at the given path, trying the same
+// suffixes as git does if not strict.
+func gitDir(path string, strict bool) string {
+	if strict {
+		return path
+	}
+
+	for _, suffix := range []string{"/.git", "", ".git/.git", ".git"} {
+		if _, err := os.Stat(filepath.Join(path+suffix, "config")); err == nil {
+			return path + suffix
+		}
+	}
+
+	return path
+}
+
+// serve runs f with the standard output, input and error, returning
+// ErrTimeout if a read or a write blocks longer than the timeout of the
+// options. The context given to f is canceled on timeout.
+func serve(o *ServerOptions, f func(context.Context, common.ServerCommand) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if o.Timeout <= 0 {
+		return f(ctx, srvCmd)
+	}
+
+	t := &timeout{d: o.Timeout, cancel: cancel}
+	cmd := srvCmd
+	cmd.Stdin = &timeoutReader{r: cmd.Stdin, t: t}
+	cmd.Stdout = ioutil.WriteNopCloser(&timeoutWriter{w: cmd.Stdout, t: t})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f(ctx, cmd)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ErrTimeout
+	}
+}
+
+type timeout struct {
+	d      time.Duration
+	cancel func()
+}
+
+// do calls f, canceling the request if it does not return before the
+// timeout.
+func (t *timeout) do(f func() (int, error)) (int, error) {
+	timer := time.AfterFunc(t.d, t.cancel)
+	defer timer.Stop()
+
+	return f()
+}
+
+type timeoutReader struct {
+	r io.Reader
+	t *timeout
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	return r.t.do(func() (int, error) { return r.r.Read(p) })
+}
+
+type timeoutWriter struct {
+	w io.Writer
+	t *timeout
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	return w.t.do(func() (int, error) { return w.w.Write(p) })
+}
@@ -1,8 +1,16 @@
 package file
 
 import (
+	"archive/tar"
+	"bytes"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git-fixtures.v3"
@@ -67,9 +75,132 @@ func (s *ServerSuite) TestClone(c *C) {
 	c.Assert(err, IsNil, Commentf("combined stdout and stderr:\n%s\n", out))
 }
 
+func (s *ServerSuite) TestArchive(c *C) {
+	if !s.checkExecPerm(c) {
+		c.Skip("go-git binary has not execution permissions")
+	}
+
+	cmd := exec.Command("git", "archive",
+		"--remote", s.SrcPath, "--exec", s.UploadArchiveBin,
+		"--prefix=basic/", "master", "go",
+	)
+	cmd.Dir = s.SrcPath
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	c.Assert(err, IsNil, Commentf("stderr:\n%s\n", stderr))
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(out))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		if h.Typeflag != tar.TypeXGlobalHeader {
+			names = append(names, h.Name)
+		}
+	}
+
+	c.Assert(names, DeepEquals, []string{"basic/", "basic/go/", "basic/go/example.go"})
+}
+
+func (s *ServerSuite) TestArchiveRejected(c *C) {
+	if !s.checkExecPerm(c) {
+		c.Skip("go-git binary has not execution permissions")
+	}
+
+	cmd := exec.Command("git", "archive",
+		"--remote", s.SrcPath, "--exec", s.UploadArchiveBin, "missing",
+	)
+	cmd.Dir = s.SrcPath
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, NotNil)
+	c.Assert(string(out), Matches, "(?s).*no such ref: missing.*")
+}
+
 func (s *ServerSuite) checkExecPerm(c *C) bool {
 	const userExecPermMask = 0100
 	info, err := os.Stat(s.ReceivePackBin)
 	c.Assert(err, IsNil)
 	return (info.Mode().Perm() & userExecPermMask) == userExecPermMask
 }
+
+func (s *ServerSuite) TestAdvertiseRefs(c *C) {
+	out, err := exec.Command(s.UploadPackBin, "--advertise-refs", s.SrcPath).Output()
+	c.Assert(err, IsNil)
+	c.Assert(string(out[4:50]), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD\x00")
+	c.Assert(strings.HasSuffix(string(out), "0000"), Equals, true)
+
+	out, err = exec.Command(s.ReceivePackBin, "--advertise-refs", "--stateless-rpc", s.DstPath).Output()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(out), "report-status"), Equals, true)
+	c.Assert(strings.HasSuffix(string(out), "0000"), Equals, true)
+}
+
+func (s *ServerSuite) TestStatelessRPC(c *C) {
+	run := func(lines ...string) string {
+		in := bytes.NewBuffer(nil)
+		e := pktline.NewEncoder(in)
+		for _, l := range lines {
+			if l == "" {
+				c.Assert(e.Flush(), IsNil)
+			} else {
+				c.Assert(e.EncodeString(l+"\n"), IsNil)
+			}
+		}
+
+		cmd := exec.Command(s.UploadPackBin, "--stateless-rpc", s.SrcPath)
+		cmd.Stdin = in
+		out, err := cmd.Output()
+		c.Assert(err, IsNil)
+		return string(out)
+	}
+
+	// a negotiation round is answered with the acknowledgements.
+	out := run("want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "",
+		"have 918c48b83bd081e863dbe1b80f8998f058cd8294", "")
+	c.Assert(out, Equals, "0031ACK 918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+
+	out = run("want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "",
+		"have 918c48b83bd081e863dbe1b80f8998f058cd8294", "done")
+	c.Assert(strings.HasPrefix(out, "0031ACK 918c48b83bd081e863dbe1b80f8998f058cd8294\nPACK"), Equals, true)
+}
+
+func (s *ServerSuite) TestStrict(c *C) {
+	dir := filepath.Join(c.MkDir(), "repo")
+	c.Assert(exec.Command("git", "init", dir).Run(), IsNil)
+
+	err := exec.Command(s.UploadPackBin, "--advertise-refs", dir).Run()
+	c.Assert(err, IsNil)
+
+	err = exec.Command(s.UploadPackBin, "--advertise-refs", "--strict", dir).Run()
+	c.Assert(err, NotNil)
+
+	err = exec.Command(s.UploadPackBin, "--advertise-refs", "--strict", filepath.Join(dir, ".git")).Run()
+	c.Assert(err, IsNil)
+}
+
+func (s *ServerSuite) TestTimeout(c *C) {
+	cmd := exec.Command(s.UploadPackBin, "--timeout=1", s.SrcPath)
+	stdin, err := cmd.StdinPipe()
+	c.Assert(err, IsNil)
+	defer stdin.Close()
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, NotNil)
+	c.Assert(err.(*exec.ExitError).Sys().(interface{ ExitStatus() int }).ExitStatus(), Equals, 128)
+	c.Assert(strings.Contains(string(out), "timeout"), Equals, true)
+	c.Assert(time.Since(start) < 10*time.Second, Equals, true)
+}
+
+func (s *ServerSuite) TestInvalidArguments(c *C) {
+	for _, bin := range []string{s.UploadPackBin, s.ReceivePackBin} {
+		err := exec.Command(bin, "--foo", s.SrcPath).Run()
+		c.Assert(err, NotNil)
+		c.Assert(err.(*exec.ExitError).Sys().(interface{ ExitStatus() int }).ExitStatus(), Equals, 129)
+	}
+}
@@ -0,0 +1,457 @@
+// Package server implements a git daemon, serving git repositories through
+// the git:// protocol.
+//
+// It can be used to serve the repositories of any Loader:
+//
+//	loader := server.NewFilesystemLoader(osfs.New("/srv/git"))
+//	daemon := gitserver.NewServer(loader)
+//	daemon.ExportAll = true
+//	log.Fatal(daemon.ListenAndServe(":9418"))
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/git"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ExportOkFile is the file that must exist in a repository to be served when
+// Server.ExportAll is not set.
+const ExportOkFile = "git-daemon-export-ok"
+
+var (
+	// ErrServerClosed is returned by Serve and ListenAndServe after a call
+	// to Close.
+	ErrServerClosed = errors.New("git: server closed")
+
+	errAccessDenied = errors.New("access denied or repository not exported")
+	errNotEnabled   = errors.New("service not enabled")
+)
+
+// Server is a git daemon. The path of every request is mapped to a repository
+// through a Loader, the endpoint given to the loader uses the git protocol,
+// the host sent by the client and the requested path.
+type Server struct {
+	// Whitelist, if not empty, restricts the served repositories to the
+	// given paths and the repositories below them.
+	Whitelist []string
+	// ExportAll serves every repository returned by the loader. If false,
+	// only the repositories with a git-daemon-export-ok file are served, it
+	// requires a storer with a Filesystem method, as the storer of the
+	// filesystem package.
+	ExportAll bool
+	// ReceivePack enables git-receive-pack, allowing anonymous pushes to
+	// the served repositories.
+	ReceivePack bool
+	// MaxConnections limits the number of concurrent connections, the
+	// connections exceeding it are dropped. Zero means no limit.
+	MaxConnections int
+	// InitTimeout is the time allowed to the client to send its request,
+	// once connected. Zero means no timeout.
+	InitTimeout time.Duration
+	// Timeout is the time allowed to the client for every read or write
+	// during a request. Zero means no timeout.
+	Timeout time.Duration
+	// ExtraParameters, if set, is called with the extra parameters sent
+	// by the client after the host, such as "version=2" for clients asking
+	// for protocol version 2. If it returns an error the request is
+	// refused with the error message. The server always answers with the
+	// protocol version 0, as allowed to servers not supporting the
+	// requested version.
+	ExtraParameters func(service string, ep *transport.Endpoint, params []string) error
+	// ErrorLog, if set, logs the errors accepting connections and serving
+	// requests.
+	ErrorLog *log.Logger
+
+	loader    gitserver.Loader
+	transport transport.Transport
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	repos     common.RepositoryLocks
+}
+
+// NewServer returns a Server serving the repositories of the given loader.
+func NewServer(loader gitserver.Loader) *Server {
+	return NewServerWithHooks(loader, nil)
+}
+
+// NewServerWithHooks returns a Server serving the repositories of the given
+// loader, like NewServer, calling the given hooks on every push.
+func NewServerWithHooks(loader gitserver.Loader, hooks *gitserver.Hooks) *Server {
+	return &Server{
+		loader:    loader,
+		transport: gitserver.NewServerWithHooks(loader, hooks),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the given TCP address and serves the incoming
+// connections. If addr is empty, the git default port is used.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", git.DefaultPort)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts the incoming connections of the given listener, serving each
+// of them in a new goroutine. Serve always returns a non-nil error, after
+// Close it returns ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+
+	defer s.trackListener(l, false)
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				s.logf("accept error: %s", err)
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			return err
+		}
+
+		if !s.trackConn(c, true) {
+			s.logf("too many connections, dropping %s", c.RemoteAddr())
+			c.Close()
+			continue
+		}
+
+		go s.serveConn(c)
+	}
+}
+
+// Close closes the listeners and the active connections of the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+
+	if s.closed {
+		return false
+	}
+
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) trackConn(c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, c)
+		return true
+	}
+
+	if s.closed || (s.MaxConnections > 0 && len(s.conns) >= s.MaxConnections) {
+		return false
+	}
+
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer s.trackConn(c, false)
+	defer c.Close()
+
+	conn := &timeoutConn{Conn: c, timeout: s.InitTimeout}
+	r := bufio.NewReader(conn)
+
+	req, err := readRequest(r)
+	if err != nil {
+		s.logf("%s: %s", c.RemoteAddr(), err)
+		return
+	}
+
+	conn.timeout = s.Timeout
+	if err := s.serve(conn, r, req); err != nil {
+		s.logf("%s: %s %s: %s", c.RemoteAddr(), req.service, req.path, err)
+	}
+}
+
+func (s *Server) serve(c net.Conn, r *bufio.Reader, req *request) error {
+	switch req.service {
+	case transport.UploadPackServiceName:
+	case transport.ReceivePackServiceName:
+		if !s.ReceivePack {
+			return sendError(c, errNotEnabled, req.path)
+		}
+	default:
+		return fmt.Errorf("unknown service %q", req.service)
+	}
+
+	if !validPath(req.path) || !s.whitelisted(req.path) {
+		return sendError(c, errAccessDenied, req.path)
+	}
+
+	host := req.host
+	if host == "" {
+		host = c.LocalAddr().String()
+	}
+
+	ep, err := transport.NewEndpoint(fmt.Sprintf("git://%s%s", host, req.path))
+	if err != nil {
+		return sendError(c, errAccessDenied, req.path)
+	}
+
+	if s.ExtraParameters != nil && len(req.extra) != 0 {
+		if err := s.ExtraParameters(req.service, ep, req.extra); err != nil {
+			if serr := sendError(c, err, req.path); serr != nil {
+				return serr
+			}
+
+			return err
+		}
+	}
+
+	sto, err := s.loader.Load(ep)
+	if err != nil {
+		if serr := sendError(c, errAccessDenied, req.path); serr != nil {
+			return serr
+		}
+
+		return err
+	}
+
+	if !s.exported(sto) {
+		return sendError(c, errAccessDenied, req.path)
+	}
+
+	write := req.service == transport.ReceivePackServiceName
+	defer s.repos.Lock(ep, write)()
+
+	if !write {
+		return s.serveUploadPack(c, r, ep, sto)
+	}
+
+	return s.serveReceivePack(c, r, ep)
+}
+
+func (s *Server) whitelisted(p string) bool {
+	if len(s.Whitelist) == 0 {
+		return true
+	}
+
+	for _, w := range s.Whitelist {
+		w = path.Clean("/" + w)
+		if p == w || strings.HasPrefix(p, strings.TrimSuffix(w, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) exported(sto storer.Storer) bool {
+	if s.ExportAll {
+		return true
+	}
+
+	fs, ok := sto.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return false
+	}
+
+	_, err := fs.Filesystem().Stat(ExportOkFile)
+	return err == nil
+}
+
+func (s *Server) serveUploadPack(w io.Writer, r io.Reader,
+	ep *transport.Endpoint, sto storer.Storer) (err error) {
+
+	sess, err := s.transport.NewUploadPackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(sess, &err)
+
+	return common.ServeStatefulUploadPack(context.Background(), common.ServerCommand{
+		Stdin:  r,
+		Stdout: ioutil.WriteNopCloser(w),
+	}, sess, sto)
+}
+
+func (s *Server) serveReceivePack(w io.Writer, r io.Reader,
+	ep *transport.Endpoint) (err error) {
+
+	sess, err := s.transport.NewReceivePackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(sess, &err)
+
+	return common.ServeStatefulReceivePack(context.Background(), common.ServerCommand{
+		Stdin:  r,
+		Stdout: ioutil.WriteNopCloser(w),
+	}, sess)
+}
+
+// sendError sends an error line to the client, as git daemon does.
+func sendError(w io.Writer, err error, path string) error {
+	return pktline.NewEncoder(w).Encodef("ERR %s: %s", err, path)
+}
+
+// request is the first message sent by the client:
+//
+//	git-upload-pack /path\0host=example.com\0\0version=2\0
+type request struct {
+	service string
+	path    string
+	host    string
+	extra   []string
+}
+
+func readRequest(r io.Reader) (*request, error) {
+	s := pktline.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return parseRequest(s.Bytes())
+}
+
+func parseRequest(line []byte) (*request, error) {
+	fields := strings.Split(strings.TrimSuffix(string(line), "\n"), "\x00")
+
+	sp := strings.IndexByte(fields[0], ' ')
+	if sp == -1 {
+		return nil, fmt.Errorf("malformed request: %q", line)
+	}
+
+	req := &request{
+		service: fields[0][:sp],
+		path:    fields[0][sp+1:],
+	}
+
+	var extra bool
+	for _, f := range fields[1:] {
+		switch {
+		case f == "":
+			extra = true
+		case extra:
+			req.extra = append(req.extra, f)
+		case strings.HasPrefix(f, "host="):
+			req.host = strings.TrimPrefix(f, "host=")
+		}
+	}
+
+	return req, nil
+}
+
+// validPath returns true if the path is absolute and clean, rejecting any
+// path escaping the served directories.
+func validPath(p string) bool {
+	return strings.HasPrefix(p, "/") && path.Clean(p) == p
+}
+
+// timeoutConn is a net.Conn setting a deadline before every read and write.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	if err := c.setDeadline(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	if err := c.setDeadline(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(p)
+}
+
+func (c *timeoutConn) setDeadline() error {
+	if c.timeout == 0 {
+		return c.Conn.SetDeadline(time.Time{})
+	}
+
+	return c.Conn.SetDeadline(time.Now().Add(c.timeout))
+}
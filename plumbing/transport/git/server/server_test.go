@@ -0,0 +1,258 @@
+package server_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/git"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/git/server"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/test"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BaseSuite struct {
+	fixtures.Suite
+
+	loader gitserver.MapLoader
+	server *server.Server
+	addr   string
+}
+
+func (s *BaseSuite) SetUpTest(c *C) {
+	s.loader = gitserver.MapLoader{}
+	s.server = server.NewServer(s.loader)
+	s.server.ExportAll = true
+	s.server.ReceivePack = true
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.addr = l.Addr().String()
+
+	go s.server.Serve(l)
+}
+
+func (s *BaseSuite) TearDownTest(c *C) {
+	c.Assert(s.server.Close(), IsNil)
+}
+
+func (s *BaseSuite) newEndpoint(c *C, name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("git://%s/%s", s.addr, name))
+	c.Assert(err, IsNil)
+
+	return ep
+}
+
+func (s *BaseSuite) prepareRepository(c *C, f *fixtures.Fixture, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	return ep
+}
+
+func (s *BaseSuite) prepareEmptyRepository(c *C, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = memory.NewStorage()
+	return ep
+}
+
+type UploadPackSuite struct {
+	test.UploadPackSuite
+	BaseSuite
+}
+
+var _ = Suite(&UploadPackSuite{})
+
+func (s *UploadPackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.UploadPackSuite.Client = git.DefaultClient
+	s.UploadPackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.UploadPackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.UploadPackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type ReceivePackSuite struct {
+	test.ReceivePackSuite
+	BaseSuite
+}
+
+var _ = Suite(&ReceivePackSuite{})
+
+func (s *ReceivePackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.ReceivePackSuite.Client = git.DefaultClient
+	s.ReceivePackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.ReceivePackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.ReceivePackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type ServerSuite struct {
+	BaseSuite
+	ep *transport.Endpoint
+}
+
+var _ = Suite(&ServerSuite{})
+
+func (s *ServerSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.ep = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+}
+
+func (s *ServerSuite) advertisedReferences(c *C, service string) error {
+	var sess transport.Session
+	var err error
+	if service == transport.UploadPackServiceName {
+		sess, err = git.DefaultClient.NewUploadPackSession(s.ep, nil)
+	} else {
+		sess, err = git.DefaultClient.NewReceivePackSession(s.ep, nil)
+	}
+
+	c.Assert(err, IsNil)
+	defer sess.Close()
+
+	_, err = sess.AdvertisedReferences()
+	return err
+}
+
+func (s *ServerSuite) TestExportOk(c *C) {
+	s.server.ExportAll = false
+
+	err := s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+
+	sto := s.loader[s.ep.String()].(*filesystem.Storage)
+	err = util.WriteFile(sto.Filesystem(), server.ExportOkFile, nil, 0644)
+	c.Assert(err, IsNil)
+
+	err = s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, IsNil)
+}
+
+func (s *ServerSuite) TestWhitelist(c *C) {
+	s.server.Whitelist = []string{"/repos"}
+
+	err := s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+
+	s.server.Whitelist = []string{"/repos", "/basic.git"}
+
+	err = s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, IsNil)
+}
+
+func (s *ServerSuite) TestReceivePackNotEnabled(c *C) {
+	s.server.ReceivePack = false
+
+	err := s.advertisedReferences(c, transport.ReceivePackServiceName)
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerSuite) request(c *C, req string) string {
+	conn, err := net.Dial("tcp", s.addr)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	err = pktline.NewEncoder(conn).EncodeString(req)
+	c.Assert(err, IsNil)
+
+	sc := pktline.NewScanner(conn)
+	c.Assert(sc.Scan(), Equals, true)
+	return string(sc.Bytes())
+}
+
+func (s *ServerSuite) TestPathOutsideBase(c *C) {
+	line := s.request(c, fmt.Sprintf("git-upload-pack /repos/../basic.git\x00host=%s\x00", s.addr))
+	c.Assert(line, Equals, "ERR access denied or repository not exported: /repos/../basic.git")
+}
+
+func (s *ServerSuite) TestExtraParameters(c *C) {
+	var params []string
+	s.server.ExtraParameters = func(service string, ep *transport.Endpoint, p []string) error {
+		c.Assert(service, Equals, transport.UploadPackServiceName)
+		c.Assert(ep.String(), Equals, s.ep.String())
+		params = p
+		return nil
+	}
+
+	line := s.request(c, fmt.Sprintf("git-upload-pack /basic.git\x00host=%s\x00\x00version=2\x00", s.addr))
+	c.Assert(line[40:46], Equals, " HEAD\x00")
+	c.Assert(params, DeepEquals, []string{"version=2"})
+
+	s.server.ExtraParameters = func(string, *transport.Endpoint, []string) error {
+		return errors.New("protocol version 2 required")
+	}
+
+	line = s.request(c, fmt.Sprintf("git-upload-pack /basic.git\x00host=%s\x00\x00version=2\x00", s.addr))
+	c.Assert(line, Equals, "ERR protocol version 2 required: /basic.git")
+}
+
+func (s *ServerSuite) TestInitTimeout(c *C) {
+	s.server.InitTimeout = 50 * time.Millisecond
+
+	conn, err := net.Dial("tcp", s.addr)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	c.Assert(conn.SetDeadline(time.Now().Add(5*time.Second)), IsNil)
+	b, err := ioutil.ReadAll(conn)
+	c.Assert(err, IsNil)
+	c.Assert(b, HasLen, 0)
+}
+
+func (s *ServerSuite) TestMaxConnections(c *C) {
+	s.server.MaxConnections = 1
+
+	conn, err := net.Dial("tcp", s.addr)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	// wait for the first connection to be accepted
+	time.Sleep(50 * time.Millisecond)
+
+	err = s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, NotNil)
+
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	err = s.advertisedReferences(c, transport.UploadPackServiceName)
+	c.Assert(err, IsNil)
+}
+
+func (s *ServerSuite) TestGitClient(c *C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not found")
+	}
+
+	dir := filepath.Join(c.MkDir(), "basic")
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Env = []string{"GIT_TERMINAL_PROMPT=0", "HOME=" + dir}
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, IsNil, Commentf("%s", out))
+	}
+
+	git("clone", "--depth", "1", s.ep.String(), dir)
+	git("-C", dir, "fetch", "--unshallow")
+	git("-C", dir, "push", "origin", "master:refs/heads/new")
+
+	sto := s.loader[s.ep.String()]
+	ref, err := sto.Reference("refs/heads/new")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
@@ -2,16 +2,20 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
 )
 
@@ -38,27 +42,31 @@ func advertisedReferences(s *session, serviceName string) (ref *packp.AdvRefs, e
 		s.endpoint.String(), infoRefsPath, serviceName,
 	)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	s.ApplyAuthToRequest(req)
-	applyHeadersToRequest(req, nil, s.endpoint.Host, serviceName)
-	res, err := s.client.Do(req)
+	res, err := s.getWithCredentials(url, serviceName)
 	if err != nil {
 		return nil, err
 	}
 
-	s.ModifyEndpointIfRedirect(res)
 	defer ioutil.CheckClose(res.Body, &err)
 
-	if err = NewErr(res); err != nil {
-		return nil, err
+	body := bufio.NewReader(res.Body)
+	if !isSmartAdvertisement(body) {
+		if serviceName != transport.UploadPackServiceName {
+			return nil, ErrDumbPush
+		}
+
+		ar, err := decodeDumbAdvertisement(s, body)
+		if err != nil {
+			return nil, err
+		}
+
+		s.dumb = true
+		s.advRefs = ar
+		return ar, nil
 	}
 
 	ar := packp.NewAdvRefs()
-	if err = ar.Decode(res.Body); err != nil {
+	if err = ar.Decode(body); err != nil {
 		if err == packp.ErrEmptyAdvRefs {
 			err = transport.ErrEmptyRemoteRepository
 		}
@@ -72,12 +80,97 @@ func advertisedReferences(s *session, serviceName string) (ref *packp.AdvRefs, e
 	return ar, nil
 }
 
-type client struct {
-	c *http.Client
+// getWithCredentials requests the given URL, and if authentication is
+// required and the session has no AuthMethod, fills the credentials with the
+// credential helpers and retries. The credentials are approved or rejected
+// depending on the response.
+func (s *session) getWithCredentials(url, serviceName string) (*http.Response, error) {
+	res, err := s.get(url, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized && s.credentials != nil {
+		if cred, err := s.fillCredential(); err == nil {
+			res.Body.Close()
+			s.auth = &BasicAuth{cred.Username, cred.Password}
+			if res, err = s.get(url, serviceName); err != nil {
+				return nil, err
+			}
+
+			s.approveCredential(cred, res)
+		}
+	}
+
+	if err := NewErr(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *session) get(url, serviceName string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ApplyAuthToRequest(req)
+	applyHeadersToRequest(req, nil, s.endpoint.Host, serviceName)
+	s.applyOptionsToRequest(req, 0)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ModifyEndpointIfRedirect(res)
+	return res, nil
+}
+
+func (s *session) fillCredential() (*credential.Credential, error) {
+	c := &credential.Credential{
+		Protocol: s.endpoint.Protocol,
+		Host:     s.endpoint.Host,
+		Path:     strings.TrimPrefix(s.endpoint.Path, "/"),
+		Username: s.endpoint.User,
+		Password: s.endpoint.Password,
+	}
+
+	if p := s.endpoint.Port; p != 0 && p != defaultPort(s.endpoint.Protocol) {
+		c.Host = net.JoinHostPort(c.Host, strconv.Itoa(s.endpoint.Port))
+	}
+
+	return s.credentials.Fill(c)
+}
+
+// approveCredential stores the credential in the helpers if the response
+// succeeded, or erases it if it was refused.
+func (s *session) approveCredential(c *credential.Credential, res *http.Response) {
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		s.credentials.Reject(c)
+	case res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices:
+		s.credentials.Approve(c)
+	}
+}
+
+func defaultPort(protocol string) int {
+	if protocol == "https" {
+		return 443
+	}
+
+	return 80
 }
 
 // DefaultClient is the default HTTP client, which uses `http.DefaultClient`.
-var DefaultClient = NewClient(nil)
+// The credentials of the repositories requiring authentication, for the
+// sessions without an AuthMethod, are got from the credential helpers of the
+// system and global configs, as git does. A client created by NewClient, or
+// by NewClientWithOptions without Credentials, does not use them.
+var DefaultClient = NewClientWithOptions(nil, &ClientOptions{
+	Credentials: credential.NewManager(nil),
+})
 
 // NewClient creates a new client with a custom net/http client.
 // See `InstallProtocol` to install and override default http client.
@@ -88,52 +181,139 @@ var DefaultClient = NewClient(nil)
 // unexistent repositories on GitHub. So it returns `ErrAuthorizationRequired`
 // for both.
 func NewClient(c *http.Client) transport.Transport {
+	return NewClientWithOptions(c, nil)
+}
+
+// NewClientWithOptions creates a new client with a custom net/http client,
+// see NewClient, configured with the given options for every endpoint. The
+// client is copied when the options require a different transport, like a
+// proxy or TLS settings.
+func NewClientWithOptions(c *http.Client, opts *ClientOptions) transport.Transport {
 	if c == nil {
-		return &client{http.DefaultClient}
+		c = http.DefaultClient
 	}
 
 	return &client{
-		c: c,
+		c:       c,
+		opts:    opts,
+		clients: &clientCache{clients: make(map[string]*http.Client)},
+	}
+}
+
+type client struct {
+	c    *http.Client
+	opts *ClientOptions
+	cfg  *format.Config
+
+	clients *clientCache
+}
+
+// clientCache keeps the clients built for the options of the endpoints, to
+// reuse their connections.
+type clientCache struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}
+
+// WithConfig returns a copy of the client whose options are overridden, for
+// each endpoint, by the http and http.<url> options of the given config:
+// proxy, extraHeader, sslCAInfo, sslVerify, cookieFile and postBuffer.
+func (c *client) WithConfig(cfg *format.Config) transport.Transport {
+	return &client{
+		c:       c.c,
+		opts:    c.opts,
+		cfg:     cfg,
+		clients: c.clients,
 	}
 }
 
 func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
 	transport.UploadPackSession, error) {
 
-	return newUploadPackSession(c.c, ep, auth)
+	return newUploadPackSession(c, ep, auth)
 }
 
 func (c *client) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (
 	transport.ReceivePackSession, error) {
 
-	return newReceivePackSession(c.c, ep, auth)
+	return newReceivePackSession(c, ep, auth)
+}
+
+// httpClient returns the options applying to the endpoint, and the client
+// configured with them.
+func (c *client) httpClient(ep *transport.Endpoint) (*http.Client, *ClientOptions, error) {
+	opts, err := optionsForEndpoint(c.opts, c.cfg, ep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.clients.Lock()
+	defer c.clients.Unlock()
+
+	key := opts.key()
+	if hc, ok := c.clients.clients[key]; ok {
+		return hc, opts, nil
+	}
+
+	hc, err := opts.newHTTPClient(c.c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.clients.clients[key] = hc
+	return hc, opts, nil
 }
 
 type session struct {
 	auth     AuthMethod
 	client   *http.Client
+	options  *ClientOptions
 	endpoint *transport.Endpoint
 	advRefs  *packp.AdvRefs
+	// dumb is true if the server only supports the dumb protocol.
+	dumb bool
+	// packs are the packs of the dumb server, read once by session.
+	packs *dumbPacks
+
+	credentials *credential.Manager
 }
 
-func newSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (*session, error) {
+func newSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (*session, error) {
+	hc, opts, err := c.httpClient(ep)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &session{
 		auth:     basicAuthFromEndpoint(ep),
-		client:   c,
+		client:   hc,
+		options:  opts,
 		endpoint: ep,
 	}
-	if auth != nil {
-		a, ok := auth.(AuthMethod)
-		if !ok {
-			return nil, transport.ErrInvalidAuthMethod
-		}
 
+	switch a := auth.(type) {
+	case nil:
+		s.credentials = opts.Credentials
+	case AuthMethod:
 		s.auth = a
+	case TransportAuth:
+		s.auth = nil
+		s.client = withTransportAuth(hc, a)
+	default:
+		return nil, transport.ErrInvalidAuthMethod
 	}
 
 	return s, nil
 }
 
+// applyOptionsToRequest applies the client options to a request with a body
+// of the given size.
+func (s *session) applyOptionsToRequest(req *http.Request, size int) {
+	if s.options != nil {
+		s.options.applyToRequest(req, size)
+	}
+}
+
 func (s *session) ApplyAuthToRequest(req *http.Request) {
 	if s.auth == nil {
 		return
@@ -178,6 +358,27 @@ type AuthMethod interface {
 	setAuth(r *http.Request)
 }
 
+// TransportAuth is an AuthMethod wrapping the transport of the HTTP client,
+// to implement authentication schemes negotiated over several requests, like
+// NTLM, or computing their headers for each request, like Kerberos (SPNEGO).
+type TransportAuth interface {
+	transport.AuthMethod
+	// WrapTransport returns the round tripper used to send the requests,
+	// authenticating them with the given one.
+	WrapTransport(rt http.RoundTripper) http.RoundTripper
+}
+
+func withTransportAuth(c *http.Client, a TransportAuth) *http.Client {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	wrapped := *c
+	wrapped.Transport = a.WrapTransport(rt)
+	return &wrapped
+}
+
 func basicAuthFromEndpoint(ep *transport.Endpoint) *BasicAuth {
 	u := ep.User
 	if u == "" {
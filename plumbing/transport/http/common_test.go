@@ -8,14 +8,19 @@ import (
 	"net"
 	"net/http"
 	"net/http/cgi"
+	"net/http/httptest"
+	"net/http/httputil"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	config "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git-fixtures.v3"
@@ -216,3 +221,148 @@ func (s *BaseSuite) TearDownTest(c *C) {
 	err := os.RemoveAll(s.base)
 	c.Assert(err, IsNil)
 }
+
+type CredentialsSuite struct {
+	BaseSuite
+
+	server   *httptest.Server
+	endpoint *transport.Endpoint
+	cache    *credential.Cache
+	client   transport.Transport
+}
+
+var _ = Suite(&CredentialsSuite{})
+
+func (s *CredentialsSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("localhost:%d", s.port),
+	})
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "foo" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		proxy.ServeHTTP(w, r)
+	}))
+
+	var err error
+	s.endpoint, err = transport.NewEndpoint(s.server.URL + "/basic.git")
+	c.Assert(err, IsNil)
+
+	s.cache = credential.NewCache()
+	s.client = NewClientWithOptions(nil, &ClientOptions{
+		Credentials: &credential.Manager{
+			Config:  config.New(),
+			Helpers: []credential.Helper{s.cache.Helper(time.Minute)},
+		},
+	})
+}
+
+func (s *CredentialsSuite) TearDownTest(c *C) {
+	s.server.Close()
+	s.BaseSuite.TearDownTest(c)
+}
+
+func (s *CredentialsSuite) credential(c *C) *credential.Credential {
+	u, err := url.Parse(s.server.URL)
+	c.Assert(err, IsNil)
+
+	return &credential.Credential{Protocol: "http", Host: u.Host}
+}
+
+func (s *CredentialsSuite) TestFillCredentials(c *C) {
+	h := s.cache.Helper(time.Minute)
+	cred := s.credential(c)
+	cred.Username, cred.Password = "foo", "secret"
+	c.Assert(h.Store(cred), IsNil)
+
+	r, err := s.client.NewUploadPackSession(s.endpoint, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head, NotNil)
+}
+
+func (s *CredentialsSuite) TestDefaultClientCredentials(c *C) {
+	home := c.MkDir()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	c.Assert(os.Setenv("HOME", home), IsNil)
+	c.Assert(os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config")), IsNil)
+
+	store := filepath.Join(home, "credentials")
+	err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"),
+		[]byte("[credential]\n\thelper = store --file="+store+"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	u, err := url.Parse(s.server.URL)
+	c.Assert(err, IsNil)
+	u.User = url.UserPassword("foo", "secret")
+	c.Assert(ioutil.WriteFile(store, []byte(u.String()+"\n"), 0600), IsNil)
+
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head, NotNil)
+}
+
+func (s *CredentialsSuite) TestCredentialsDisabled(c *C) {
+	h := s.cache.Helper(time.Minute)
+	cred := s.credential(c)
+	cred.Username, cred.Password = "foo", "secret"
+	c.Assert(h.Store(cred), IsNil)
+
+	r, err := NewClient(nil).NewUploadPackSession(s.endpoint, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+}
+
+func (s *CredentialsSuite) TestNoCredentials(c *C) {
+	r, err := s.client.NewUploadPackSession(s.endpoint, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+}
+
+func (s *CredentialsSuite) TestRejectCredentials(c *C) {
+	h := s.cache.Helper(time.Minute)
+	cred := s.credential(c)
+	cred.Username, cred.Password = "foo", "wrong"
+	c.Assert(h.Store(cred), IsNil)
+
+	r, err := s.client.NewUploadPackSession(s.endpoint, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+
+	got, err := h.Get(s.credential(c))
+	c.Assert(err, IsNil)
+	c.Assert(got.IsComplete(), Equals, false)
+}
+
+func (s *CredentialsSuite) TestExplicitAuthSkipsCredentials(c *C) {
+	h := s.cache.Helper(time.Minute)
+	cred := s.credential(c)
+	cred.Username, cred.Password = "foo", "secret"
+	c.Assert(h.Store(cred), IsNil)
+
+	r, err := s.client.NewUploadPackSession(s.endpoint, &BasicAuth{"foo", "wrong"})
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+}
@@ -0,0 +1,485 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/objfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+var (
+	// ErrDumbPush is returned when pushing to a server only supporting the
+	// dumb HTTP protocol.
+	ErrDumbPush = errors.New("push is not supported by dumb HTTP servers")
+	// ErrDumbShallow is returned when a shallow fetch is requested to a
+	// server only supporting the dumb HTTP protocol.
+	ErrDumbShallow = errors.New("shallow fetch is not supported by dumb HTTP servers")
+)
+
+const serviceLinePrefix = "# service="
+
+// isSmartAdvertisement returns true if the info/refs response starts with the
+// service pkt-line of the smart protocol. Dumb servers send the plain
+// info/refs file, a line for each reference starting with its hash.
+func isSmartAdvertisement(r *bufio.Reader) bool {
+	b, err := r.Peek(4 + len(serviceLinePrefix))
+	if err != nil {
+		return false
+	}
+
+	return string(b[4:]) == serviceLinePrefix
+}
+
+// decodeDumbAdvertisement decodes the info/refs file of a dumb server, and
+// resolves HEAD requesting the HEAD file of the repository.
+func decodeDumbAdvertisement(s *session, r io.Reader) (*packp.AdvRefs, error) {
+	ar := packp.NewAdvRefs()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || len(fields[0]) != 40 {
+			return nil, fmt.Errorf("malformed info/refs line: %q", line)
+		}
+
+		h := plumbing.NewHash(fields[0])
+		if strings.HasSuffix(fields[1], "^{}") {
+			ar.Peeled[strings.TrimSuffix(fields[1], "^{}")] = h
+			continue
+		}
+
+		ar.References[fields[1]] = h
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ar.References) == 0 {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	if err := resolveDumbHead(s, ar); err != nil {
+		return nil, err
+	}
+
+	return ar, nil
+}
+
+func resolveDumbHead(s *session, ar *packp.AdvRefs) error {
+	res, err := s.getFile(context.Background(), "HEAD")
+	if err == transport.ErrRepositoryNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "ref: ") {
+		h := plumbing.NewHash(line)
+		ar.Head = &h
+		return nil
+	}
+
+	target := strings.TrimPrefix(line, "ref: ")
+	h, ok := ar.References[target]
+	if !ok {
+		return nil
+	}
+
+	ar.Head = &h
+	return ar.Capabilities.Add(capability.SymRef,
+		fmt.Sprintf("%s:%s", plumbing.HEAD, target))
+}
+
+// getFile requests the file at the given path of the repository.
+func (s *session) getFile(ctx context.Context, path string) (*http.Response, error) {
+	url := fmt.Sprintf("%s/%s", s.endpoint.String(), path)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, plumbing.NewPermanentError(err)
+	}
+
+	applyHeadersToRequest(req, nil, s.endpoint.Host, "")
+	s.ApplyAuthToRequest(req)
+	s.applyOptionsToRequest(req, 0)
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, plumbing.NewUnexpectedError(err)
+	}
+
+	if err := NewErr(res); err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// dumbUploadPack walks the objects reachable from the wants of the request,
+// and not from its haves or the local objects, downloading them from the dumb
+// server, and returns them in a packfile, as a smart server would.
+func (s *upSession) dumbUploadPack(
+	ctx context.Context, req *packp.UploadPackRequest,
+) (*packp.UploadPackResponse, error) {
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return nil, ErrDumbShallow
+	}
+
+	if s.packs == nil {
+		s.packs = &dumbPacks{indexes: make(map[string]*idxfile.MemoryIndex)}
+	}
+
+	w := &dumbWalker{
+		session: s.session,
+		ctx:     ctx,
+		local:   s.local,
+		storage: memory.NewStorage(),
+	}
+
+	objs, err := w.walk(req.Wants, req.Haves)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	e := packfile.NewEncoder(pw, w.storage, false)
+	go func() {
+		_, err := e.Encode(objs, 0)
+		pw.CloseWithError(err)
+	}()
+
+	return packp.NewUploadPackResponseWithPackfile(req,
+		ioutil.NewContextReadCloser(ctx, pr),
+	), nil
+}
+
+// dumbPacks are the packs of a dumb server and their indexes, downloaded once
+// by session.
+type dumbPacks struct {
+	// names are the names of the packs, nil until objects/info/packs is
+	// read.
+	names   []string
+	indexes map[string]*idxfile.MemoryIndex
+}
+
+// dumbWalker downloads the objects of a dumb server into a memory storage,
+// as loose objects, or downloading the packs containing them.
+type dumbWalker struct {
+	*session
+	ctx context.Context
+	// local is the storer of the objects of the client, its objects, and
+	// the ones reachable from them, are not downloaded. It may be nil.
+	local   storer.EncodedObjectStorer
+	storage *memory.Storage
+
+	// fetched are the packs already downloaded into the storage.
+	fetched map[string]bool
+}
+
+func (w *dumbWalker) walk(wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range haves {
+		seen[h] = true
+	}
+
+	var result []plumbing.Hash
+	pending := append([]plumbing.Hash(nil), wants...)
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		if w.isLocal(h) {
+			continue
+		}
+
+		obj, err := w.object(h)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, h)
+
+		children, err := w.children(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, children...)
+	}
+
+	return result, nil
+}
+
+// isLocal returns true if the client already has the object, as git does,
+// the objects reachable from it are expected to be there too.
+func (w *dumbWalker) isLocal(h plumbing.Hash) bool {
+	if w.local == nil {
+		return false
+	}
+
+	return w.local.HasEncodedObject(h) == nil
+}
+
+func (w *dumbWalker) children(obj plumbing.EncodedObject) ([]plumbing.Hash, error) {
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		c, err := object.DecodeCommit(w.storage, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]plumbing.Hash{c.TreeHash}, c.ParentHashes...), nil
+	case plumbing.TreeObject:
+		t, err := object.DecodeTree(w.storage, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		var hashes []plumbing.Hash
+		for _, e := range t.Entries {
+			if e.Mode == filemode.Submodule {
+				continue
+			}
+
+			hashes = append(hashes, e.Hash)
+		}
+
+		return hashes, nil
+	case plumbing.TagObject:
+		t, err := object.DecodeTag(w.storage, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		return []plumbing.Hash{t.Target}, nil
+	}
+
+	return nil, nil
+}
+
+// object returns the object with the given hash, downloading it as a loose
+// object, or the pack containing it, if it is not in the storage yet.
+func (w *dumbWalker) object(h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if obj, err := w.storage.EncodedObject(plumbing.AnyObject, h); err == nil {
+		return obj, nil
+	}
+
+	found, err := w.fetchLoose(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		if found, err = w.fetchPack(h); err != nil {
+			return nil, err
+		}
+	}
+
+	if !found {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return w.storage.EncodedObject(plumbing.AnyObject, h)
+}
+
+func (w *dumbWalker) fetchLoose(h plumbing.Hash) (found bool, err error) {
+	hex := h.String()
+	res, err := w.getFile(w.ctx, fmt.Sprintf("objects/%s/%s", hex[:2], hex[2:]))
+	if err == transport.ErrRepositoryNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	r, err := objfile.NewReader(res.Body)
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	t, size, err := r.Header()
+	if err != nil {
+		return false, err
+	}
+
+	obj := w.storage.NewEncodedObject()
+	obj.SetType(t)
+	obj.SetSize(size)
+
+	ow, err := obj.Writer()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = io.Copy(ow, r); err != nil {
+		return false, err
+	}
+
+	if err = ow.Close(); err != nil {
+		return false, err
+	}
+
+	if r.Hash() != h {
+		return false, fmt.Errorf("corrupted loose object %s", h)
+	}
+
+	_, err = w.storage.SetEncodedObject(obj)
+	return true, err
+}
+
+// fetchPack looks for the object in the indexes of the packs of the server,
+// downloading the ones not cached by the session yet, and downloads the pack
+// containing it into the storage.
+func (w *dumbWalker) fetchPack(h plumbing.Hash) (bool, error) {
+	if w.packs.names == nil {
+		names, err := w.listPacks()
+		if err != nil {
+			return false, err
+		}
+
+		w.packs.names = names
+	}
+
+	for _, name := range w.packs.names {
+		if w.fetched[name] {
+			continue
+		}
+
+		idx, err := w.index(name)
+		if err != nil {
+			return false, err
+		}
+
+		if ok, err := idx.Contains(h); err != nil || !ok {
+			if err != nil {
+				return false, err
+			}
+
+			continue
+		}
+
+		if err := w.fetchPackfile(name); err != nil {
+			return false, err
+		}
+
+		if w.fetched == nil {
+			w.fetched = make(map[string]bool)
+		}
+
+		w.fetched[name] = true
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (w *dumbWalker) listPacks() ([]string, error) {
+	packs := []string{}
+
+	res, err := w.getFile(w.ctx, "objects/info/packs")
+	if err == transport.ErrRepositoryNotFound {
+		return packs, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "P" {
+			packs = append(packs, fields[1])
+		}
+	}
+
+	return packs, scanner.Err()
+}
+
+// index returns the index of the given pack, downloading it the first time it
+// is requested in the session.
+func (w *dumbWalker) index(pack string) (*idxfile.MemoryIndex, error) {
+	if idx, ok := w.packs.indexes[pack]; ok {
+		return idx, nil
+	}
+
+	idx, err := w.fetchIndex(pack)
+	if err != nil {
+		return nil, err
+	}
+
+	w.packs.indexes[pack] = idx
+	return idx, nil
+}
+
+func (w *dumbWalker) fetchIndex(pack string) (*idxfile.MemoryIndex, error) {
+	name := strings.TrimSuffix(pack, ".pack") + ".idx"
+	res, err := w.getFile(w.ctx, "objects/pack/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(res.Body).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (w *dumbWalker) fetchPackfile(pack string) error {
+	res, err := w.getFile(w.ctx, "objects/pack/"+pack)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	return packfile.UpdateObjectStorage(w.storage, res.Body)
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type DumbSuite struct {
+	fixtures.Suite
+
+	base   string
+	server *httptest.Server
+}
+
+var _ = Suite(&DumbSuite{})
+
+func (s *DumbSuite) SetUpTest(c *C) {
+	var err error
+	s.base, err = ioutil.TempDir("", "go-git-http-dumb")
+	c.Assert(err, IsNil)
+
+	s.server = httptest.NewServer(http.FileServer(http.Dir(s.base)))
+}
+
+func (s *DumbSuite) TearDownTest(c *C) {
+	s.server.Close()
+	c.Assert(os.RemoveAll(s.base), IsNil)
+}
+
+func (s *DumbSuite) git(c *C, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=foo", "GIT_AUTHOR_EMAIL=foo@foo.foo",
+		"GIT_COMMITTER_NAME=foo", "GIT_COMMITTER_EMAIL=foo@foo.foo",
+	)
+
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", out))
+}
+
+func (s *DumbSuite) prepareFixture(c *C, f *fixtures.Fixture, name string) *transport.Endpoint {
+	fs := f.DotGit()
+	c.Assert(fixtures.EnsureIsBare(fs), IsNil)
+
+	path := filepath.Join(s.base, name)
+	c.Assert(os.Rename(fs.Root(), path), IsNil)
+	s.git(c, path, "update-server-info")
+
+	return s.newEndpoint(c, name)
+}
+
+func (s *DumbSuite) newEndpoint(c *C, name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(s.server.URL + "/" + name)
+	c.Assert(err, IsNil)
+
+	return ep
+}
+
+func (s *DumbSuite) fetch(c *C, ep *transport.Endpoint, want plumbing.Hash, haves ...plumbing.Hash) *memory.Storage {
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	return s.uploadPack(c, r, want, haves...)
+}
+
+func (s *DumbSuite) uploadPack(c *C, r transport.UploadPackSession, want plumbing.Hash, haves ...plumbing.Hash) *memory.Storage {
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(r.(*upSession).dumb, Equals, true)
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Wants = append(req.Wants, want)
+	req.Haves = haves
+
+	resp, err := r.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+	defer resp.Close()
+
+	sto := memory.NewStorage()
+	c.Assert(packfile.UpdateObjectStorage(sto, resp), IsNil)
+
+	return sto
+}
+
+func (s *DumbSuite) TestAdvertisedReferences(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head, NotNil)
+	c.Assert(ar.Head.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ar.References["refs/heads/master"], Equals, *ar.Head)
+	c.Assert(ar.Capabilities.Get("symref"), DeepEquals, []string{"HEAD:refs/heads/master"})
+}
+
+func (s *DumbSuite) TestUploadPackFromPack(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	sto := s.fetch(c, ep, head)
+
+	commit, err := object.GetCommit(sto, head)
+	c.Assert(err, IsNil)
+
+	count := 0
+	iter := object.NewCommitPreorderIter(commit, nil, nil)
+	c.Assert(iter.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, 8)
+
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(f *object.File) error {
+		_, err := f.Contents()
+		return err
+	}), IsNil)
+}
+
+func (s *DumbSuite) TestUploadPackWithHaves(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	parent := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	sto := s.fetch(c, ep, head, parent)
+
+	_, err := object.GetCommit(sto, head)
+	c.Assert(err, IsNil)
+
+	_, err = object.GetCommit(sto, parent)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *DumbSuite) TestUploadPackWithLocalObjects(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	parent := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	grandparent := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+
+	local := s.fetch(c, ep, parent)
+	_, err := object.GetCommit(local, grandparent)
+	c.Assert(err, IsNil)
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	r.(transport.LocalObjectsSession).SetLocalObjects(local)
+	sto := s.uploadPack(c, r, head)
+
+	_, err = object.GetCommit(sto, head)
+	c.Assert(err, IsNil)
+
+	_, err = object.GetCommit(sto, parent)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+
+	_, err = object.GetCommit(sto, grandparent)
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *DumbSuite) TestUploadPackCachesIndexes(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	var indexes int
+	handler := s.server.Config.Handler
+	s.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Ext(r.URL.Path) == ".idx" {
+			indexes++
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.uploadPack(c, r, head)
+	s.uploadPack(c, r, head)
+	c.Assert(indexes, Equals, 1)
+}
+
+func (s *DumbSuite) TestUploadPackFromLooseObjects(c *C) {
+	path := filepath.Join(s.base, "loose.git")
+	c.Assert(os.MkdirAll(path, 0755), IsNil)
+	s.git(c, path, "init")
+	c.Assert(ioutil.WriteFile(filepath.Join(path, "foo"), []byte("foo\n"), 0644), IsNil)
+	s.git(c, path, "add", "foo")
+	s.git(c, path, "commit", "-m", "foo")
+	s.git(c, path, "update-server-info")
+
+	ep := s.newEndpoint(c, "loose.git/.git")
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.Head, NotNil)
+
+	sto := s.fetch(c, ep, *ar.Head)
+	commit, err := object.GetCommit(sto, *ar.Head)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "foo\n")
+
+	f, err := commit.File("foo")
+	c.Assert(err, IsNil)
+
+	content, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo\n")
+}
+
+func (s *DumbSuite) TestUploadPackShallow(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	ar, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Wants = append(req.Wants, *ar.Head)
+	req.Depth = packp.DepthCommits(1)
+
+	_, err = r.UploadPack(context.Background(), req)
+	c.Assert(err, Equals, ErrDumbShallow)
+}
+
+func (s *DumbSuite) TestReceivePack(c *C) {
+	ep := s.prepareFixture(c, fixtures.Basic().One(), "basic.git")
+
+	r, err := DefaultClient.NewReceivePackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, ErrDumbPush)
+}
@@ -0,0 +1,444 @@
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/credential"
+)
+
+const (
+	httpSection     = "http"
+	proxyKey        = "proxy"
+	extraHeaderKey  = "extraHeader"
+	sslCAInfoKey    = "sslCAInfo"
+	sslVerifyKey    = "sslVerify"
+	cookieFileKey   = "cookieFile"
+	postBufferKey   = "postBuffer"
+	defaultPostSize = 1 << 20
+)
+
+// ClientOptions are the settings of the HTTP client used for an endpoint,
+// given to NewClientWithOptions. The options of the http section of the git
+// config, and of the http.<url> subsections matching the endpoint, override
+// them when the transport is used with a config, see WithConfig.
+type ClientOptions struct {
+	// Proxy is the URL of the proxy, http.proxy. If empty the proxy of the
+	// environment is used.
+	Proxy string
+	// ExtraHeaders are added to every request, http.extraHeader.
+	ExtraHeaders http.Header
+	// CAInfo is the path of a file of PEM certificates used to verify the
+	// server instead of the ones of the system, http.sslCAInfo.
+	CAInfo string
+	// InsecureSkipTLS disables the verification of the server certificate,
+	// http.sslVerify set to false.
+	InsecureSkipTLS bool
+	// CookieFile is the path of a file of cookies, in the Netscape format,
+	// sent with the requests, http.cookieFile.
+	CookieFile string
+	// PostBuffer is the maximum size of the requests sent with a
+	// Content-Length, the larger ones use the chunked transfer encoding,
+	// http.postBuffer. If 0, 1 MiB is used.
+	PostBuffer int
+	// Credentials, if set, gets the credentials of the repositories requiring
+	// authentication from the credential helpers, for the sessions created
+	// without an AuthMethod. If nil, the credential helpers are not used.
+	// DefaultClient uses the helpers of the system and global configs.
+	Credentials *credential.Manager
+}
+
+func (o *ClientOptions) clone() *ClientOptions {
+	c := &ClientOptions{}
+	if o != nil {
+		*c = *o
+	}
+
+	c.ExtraHeaders = http.Header{}
+	if o != nil {
+		for k, v := range o.ExtraHeaders {
+			c.ExtraHeaders[k] = append([]string(nil), v...)
+		}
+	}
+
+	return c
+}
+
+// needsTransport returns true if the options require a transport different
+// from the one of the client.
+func (o *ClientOptions) needsTransport() bool {
+	return o.Proxy != "" || o.CAInfo != "" || o.InsecureSkipTLS
+}
+
+// key identifies the options changing the http.Client.
+func (o *ClientOptions) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%t\x00%s",
+		o.Proxy, o.CAInfo, o.InsecureSkipTLS, o.CookieFile)
+}
+
+// newHTTPClient returns a copy of the given client configured with the
+// options, or the client itself if no option applies to it. The proxy and TLS
+// options are ignored if the transport of the client is not a
+// *http.Transport, the custom transports are used unchanged.
+func (o *ClientOptions) newHTTPClient(base *http.Client) (*http.Client, error) {
+	rt := base.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	t, ok := rt.(*http.Transport)
+	configure := ok && o.needsTransport()
+	if !configure && o.CookieFile == "" {
+		return base, nil
+	}
+
+	c := *base
+	if configure {
+		t = cloneTransport(t)
+		if err := o.configureTransport(t); err != nil {
+			return nil, err
+		}
+
+		c.Transport = t
+	}
+
+	if o.CookieFile != "" {
+		jar, err := loadCookieFile(o.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Jar = jar
+	}
+
+	return &c, nil
+}
+
+// cloneTransport returns a copy of the settings of the given transport, with
+// no connection.
+func cloneTransport(t *http.Transport) *http.Transport {
+	return &http.Transport{
+		Proxy:                  t.Proxy,
+		DialContext:            t.DialContext,
+		Dial:                   t.Dial,
+		DialTLS:                t.DialTLS,
+		TLSClientConfig:        t.TLSClientConfig,
+		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+		DisableKeepAlives:      t.DisableKeepAlives,
+		DisableCompression:     t.DisableCompression,
+		MaxIdleConns:           t.MaxIdleConns,
+		MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+		IdleConnTimeout:        t.IdleConnTimeout,
+		ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  t.ExpectContinueTimeout,
+		TLSNextProto:           t.TLSNextProto,
+		ProxyConnectHeader:     t.ProxyConnectHeader,
+		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+}
+
+func (o *ClientOptions) configureTransport(t *http.Transport) error {
+	if o.Proxy != "" {
+		proxy := o.Proxy
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return err
+		}
+
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if o.CAInfo == "" && !o.InsecureSkipTLS {
+		return nil
+	}
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	} else {
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+
+	t.TLSClientConfig.InsecureSkipVerify = o.InsecureSkipTLS
+	if o.CAInfo == "" {
+		return nil
+	}
+
+	pem, err := ioutil.ReadFile(o.CAInfo)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificate found in %s", o.CAInfo)
+	}
+
+	t.TLSClientConfig.RootCAs = pool
+	return nil
+}
+
+// applyToRequest adds the extra headers to the request, and removes the
+// Content-Length of the requests larger than the post buffer.
+func (o *ClientOptions) applyToRequest(req *http.Request, size int) {
+	for k, v := range o.ExtraHeaders {
+		for _, value := range v {
+			req.Header.Add(k, value)
+		}
+	}
+
+	limit := o.PostBuffer
+	if limit <= 0 {
+		limit = defaultPostSize
+	}
+
+	if size > limit {
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+	}
+}
+
+// optionsForEndpoint returns the given options overridden by the options of
+// the config applying to the endpoint, the ones of the http section and then
+// the ones of the matching http.<url> subsections, from the least to the most
+// specific.
+func optionsForEndpoint(base *ClientOptions, cfg *format.Config, ep *transport.Endpoint) (*ClientOptions, error) {
+	o := base.clone()
+	if cfg == nil {
+		return o, nil
+	}
+
+	type match struct {
+		specificity int
+		options     format.Options
+	}
+
+	var matches []match
+	for _, s := range cfg.Sections {
+		if !s.IsName(httpSection) {
+			continue
+		}
+
+		matches = append(matches, match{-1, s.Options})
+		for _, ss := range s.Subsections {
+			if n, ok := matchEndpoint(ss.Name, ep); ok {
+				matches = append(matches, match{n, ss.Options})
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].specificity < matches[j].specificity
+	})
+
+	for _, m := range matches {
+		if err := o.apply(m.options); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+func (o *ClientOptions) apply(opts format.Options) error {
+	for _, opt := range opts {
+		switch {
+		case opt.IsKey(proxyKey):
+			o.Proxy = opt.Value
+		case opt.IsKey(extraHeaderKey):
+			// an empty value resets the list of headers
+			if opt.Value == "" {
+				o.ExtraHeaders = http.Header{}
+				continue
+			}
+
+			i := strings.IndexByte(opt.Value, ':')
+			if i < 0 {
+				return fmt.Errorf("invalid http.extraHeader: %q", opt.Value)
+			}
+
+			o.ExtraHeaders.Add(
+				strings.TrimSpace(opt.Value[:i]),
+				strings.TrimSpace(opt.Value[i+1:]),
+			)
+		case opt.IsKey(sslCAInfoKey):
+			o.CAInfo = opt.Value
+		case opt.IsKey(sslVerifyKey):
+			o.InsecureSkipTLS = !parseBool(opt.Value)
+		case opt.IsKey(cookieFileKey):
+			o.CookieFile = opt.Value
+		case opt.IsKey(postBufferKey):
+			n, err := parseSize(opt.Value)
+			if err != nil {
+				return fmt.Errorf("invalid http.postBuffer: %q", opt.Value)
+			}
+
+			o.PostBuffer = n
+		}
+	}
+
+	return nil
+}
+
+func parseBool(v string) bool {
+	switch strings.ToLower(v) {
+	case "false", "no", "off", "0":
+		return false
+	}
+
+	return true
+}
+
+// parseSize parses an integer with an optional k, m or g suffix.
+func parseSize(v string) (int, error) {
+	mult := 1
+	switch {
+	case strings.HasSuffix(strings.ToLower(v), "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(strings.ToLower(v), "m"):
+		mult = 1 << 20
+	case strings.HasSuffix(strings.ToLower(v), "g"):
+		mult = 1 << 30
+	}
+
+	if mult != 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.Atoi(v)
+	return n * mult, err
+}
+
+// matchEndpoint returns true if the URL of a http.<url> subsection applies to
+// the endpoint, as git does: the scheme, host and port must be equal, with *
+// matching a host name component, the user name must be equal if given, and
+// the path must be a prefix of the endpoint path. The returned value is the
+// specificity of the match, the length of the matched path, increased if the
+// user name matched.
+func matchEndpoint(pattern string, ep *transport.Endpoint) (int, bool) {
+	u, err := url.Parse(pattern)
+	if err != nil || u.Scheme == "" || !strings.EqualFold(u.Scheme, ep.Protocol) {
+		return 0, false
+	}
+
+	if !matchHost(u.Hostname(), ep.Host) {
+		return 0, false
+	}
+
+	port := ep.Port
+	if port == 0 {
+		port = defaultPort(ep.Protocol)
+	}
+
+	if p := u.Port(); p != "" && p != strconv.Itoa(port) {
+		return 0, false
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	epPath := strings.TrimSuffix(ep.Path, "/")
+	if path != "" && epPath != path && !strings.HasPrefix(epPath, path+"/") {
+		return 0, false
+	}
+
+	specificity := len(path) * 2
+	if u.User != nil {
+		if u.User.Username() != ep.User {
+			return 0, false
+		}
+
+		specificity++
+	}
+
+	return specificity, true
+}
+
+func matchHost(pattern, host string) bool {
+	patterns := strings.Split(strings.ToLower(pattern), ".")
+	hosts := strings.Split(strings.ToLower(host), ".")
+	if len(patterns) != len(hosts) {
+		return false
+	}
+
+	for i, p := range patterns {
+		if p != "*" && p != hosts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadCookieFile returns a cookie jar with the cookies of the given file, in
+// the Netscape format used by curl and git.
+func loadCookieFile(path string) (http.CookieJar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+
+		domain := strings.TrimPrefix(fields[0], ".")
+		secure := strings.EqualFold(fields[3], "TRUE")
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		}
+
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = domain
+		}
+
+		if exp, err := strconv.ParseInt(fields[4], 10, 64); err == nil && exp != 0 {
+			cookie.Expires = time.Unix(exp, 0)
+		}
+
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: domain, Path: fields[2]},
+			[]*http.Cookie{cookie})
+	}
+
+	return jar, scanner.Err()
+}
@@ -0,0 +1,271 @@
+package http
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	. "gopkg.in/check.v1"
+)
+
+type OptionsSuite struct {
+	dir      string
+	server   *httptest.Server
+	requests []*http.Request
+}
+
+var _ = Suite(&OptionsSuite{})
+
+func (s *OptionsSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "go-git-http-options")
+	c.Assert(err, IsNil)
+
+	s.requests = nil
+	s.server = httptest.NewServer(http.HandlerFunc(s.record))
+}
+
+func (s *OptionsSuite) TearDownTest(c *C) {
+	s.server.Close()
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *OptionsSuite) record(w http.ResponseWriter, r *http.Request) {
+	s.requests = append(s.requests, r)
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *OptionsSuite) advertisedReferences(c *C, t transport.Transport, url string) error {
+	ep, err := transport.NewEndpoint(url)
+	c.Assert(err, IsNil)
+
+	r, err := t.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	return err
+}
+
+func (s *OptionsSuite) TestOptionsForEndpoint(c *C) {
+	cfg := format.New()
+	sec := cfg.Section("http")
+	sec.AddOption("proxy", "global:3128").
+		AddOption("extraHeader", "X-Global: foo").
+		AddOption("postBuffer", "2m")
+	sec.Subsection("https://example.com/org/repo.git").
+		AddOption("proxy", "repo:3128")
+	sec.Subsection("https://example.com").
+		AddOption("proxy", "host:3128").
+		AddOption("extraHeader", "").
+		AddOption("extraHeader", "X-Host: bar").
+		AddOption("sslVerify", "false")
+	sec.Subsection("https://*.example.org").
+		AddOption("sslCAInfo", "/etc/ca.pem")
+
+	ep, err := transport.NewEndpoint("https://example.com/org/repo.git")
+	c.Assert(err, IsNil)
+
+	base := &ClientOptions{CookieFile: "/tmp/cookies"}
+	o, err := optionsForEndpoint(base, cfg, ep)
+	c.Assert(err, IsNil)
+	c.Assert(o.Proxy, Equals, "repo:3128")
+	c.Assert(o.ExtraHeaders, DeepEquals, http.Header{"X-Host": {"bar"}})
+	c.Assert(o.InsecureSkipTLS, Equals, true)
+	c.Assert(o.PostBuffer, Equals, 2<<20)
+	c.Assert(o.CookieFile, Equals, "/tmp/cookies")
+	c.Assert(o.CAInfo, Equals, "")
+
+	ep, err = transport.NewEndpoint("https://git.example.org/repo.git")
+	c.Assert(err, IsNil)
+
+	o, err = optionsForEndpoint(base, cfg, ep)
+	c.Assert(err, IsNil)
+	c.Assert(o.Proxy, Equals, "global:3128")
+	c.Assert(o.ExtraHeaders, DeepEquals, http.Header{"X-Global": {"foo"}})
+	c.Assert(o.CAInfo, Equals, "/etc/ca.pem")
+	c.Assert(o.InsecureSkipTLS, Equals, false)
+}
+
+func (s *OptionsSuite) TestOptionsForEndpointInvalid(c *C) {
+	cfg := format.New()
+	cfg.Section("http").AddOption("extraHeader", "foo")
+
+	ep, err := transport.NewEndpoint("https://example.com/repo.git")
+	c.Assert(err, IsNil)
+
+	_, err = optionsForEndpoint(nil, cfg, ep)
+	c.Assert(err, NotNil)
+}
+
+func (s *OptionsSuite) TestMatchEndpoint(c *C) {
+	ep, err := transport.NewEndpoint("https://foo@example.com/org/repo.git")
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		pattern     string
+		matches     bool
+		specificity int
+	}{
+		{"https://example.com", true, 0},
+		{"https://example.com:443/", true, 0},
+		{"https://example.com/org", true, 8},
+		{"https://foo@example.com/org", true, 9},
+		{"https://bar@example.com/org", false, 0},
+		{"https://example.com/or", false, 0},
+		{"https://example.com:8443", false, 0},
+		{"http://example.com", false, 0},
+		{"https://*.com", true, 0},
+		{"https://*.example.com", false, 0},
+	} {
+		n, ok := matchEndpoint(t.pattern, ep)
+		c.Assert(ok, Equals, t.matches, Commentf("%s", t.pattern))
+		c.Assert(n, Equals, t.specificity, Commentf("%s", t.pattern))
+	}
+}
+
+func (s *OptionsSuite) TestExtraHeaders(c *C) {
+	t := NewClientWithOptions(nil, &ClientOptions{
+		ExtraHeaders: http.Header{"X-Foo": {"bar"}},
+	})
+
+	err := s.advertisedReferences(c, t, s.server.URL+"/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(s.requests, HasLen, 1)
+	c.Assert(s.requests[0].Header.Get("X-Foo"), Equals, "bar")
+}
+
+func (s *OptionsSuite) TestWithConfig(c *C) {
+	cfg := format.New()
+	cfg.Section("http").Subsection(s.server.URL+"/repo.git").
+		AddOption("extraHeader", "X-Foo: qux")
+
+	t := NewClient(nil).(transport.ConfigTransport).WithConfig(cfg)
+
+	err := s.advertisedReferences(c, t, s.server.URL+"/other.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+
+	err = s.advertisedReferences(c, t, s.server.URL+"/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+
+	c.Assert(s.requests, HasLen, 2)
+	c.Assert(s.requests[0].Header.Get("X-Foo"), Equals, "")
+	c.Assert(s.requests[1].Header.Get("X-Foo"), Equals, "qux")
+}
+
+func (s *OptionsSuite) TestPostBuffer(c *C) {
+	o := &ClientOptions{PostBuffer: 4}
+
+	req, err := http.NewRequest(http.MethodPost, s.server.URL, nil)
+	c.Assert(err, IsNil)
+	req.ContentLength = 3
+	o.applyToRequest(req, 3)
+	c.Assert(req.ContentLength, Equals, int64(3))
+
+	req.ContentLength = 5
+	req.Header.Set("Content-Length", "5")
+	o.applyToRequest(req, 5)
+	c.Assert(req.ContentLength, Equals, int64(-1))
+	c.Assert(req.Header.Get("Content-Length"), Equals, "")
+}
+
+func (s *OptionsSuite) TestCookieFile(c *C) {
+	path := filepath.Join(s.dir, "cookies")
+	content := "# Netscape HTTP Cookie File\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tfoo\n" +
+		"127.0.0.1\tFALSE\t/other\tFALSE\t0\tignored\tbar\n"
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+
+	t := NewClientWithOptions(nil, &ClientOptions{CookieFile: path})
+
+	err := s.advertisedReferences(c, t, s.server.URL+"/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(s.requests, HasLen, 1)
+	c.Assert(s.requests[0].Header.Get("Cookie"), Equals, "session=foo")
+}
+
+func (s *OptionsSuite) TestCAInfo(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(s.record))
+	defer server.Close()
+
+	err := s.advertisedReferences(c, NewClient(nil), server.URL+"/repo.git")
+	c.Assert(err, ErrorMatches, ".*certificate.*")
+
+	path := filepath.Join(s.dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+	c.Assert(ioutil.WriteFile(path, cert, 0600), IsNil)
+
+	t := NewClientWithOptions(nil, &ClientOptions{CAInfo: path})
+	err = s.advertisedReferences(c, t, server.URL+"/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+}
+
+func (s *OptionsSuite) TestSSLVerify(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(s.record))
+	defer server.Close()
+
+	cfg := format.New()
+	cfg.Section("http").AddOption("sslVerify", "false")
+
+	t := NewClient(nil).(transport.ConfigTransport).WithConfig(cfg)
+	err := s.advertisedReferences(c, t, server.URL+"/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+}
+
+func (s *OptionsSuite) TestProxy(c *C) {
+	t := NewClientWithOptions(nil, &ClientOptions{Proxy: s.server.URL})
+
+	err := s.advertisedReferences(c, t, "http://example.invalid/repo.git")
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(s.requests, HasLen, 1)
+	c.Assert(s.requests[0].Host, Equals, "example.invalid")
+}
+
+func (s *OptionsSuite) TestCustomRoundTripper(c *C) {
+	hc := &http.Client{Transport: &headerAuth{}}
+	t := NewClientWithOptions(hc, &ClientOptions{InsecureSkipTLS: true})
+
+	ep, err := transport.NewEndpoint(s.server.URL + "/repo.git")
+	c.Assert(err, IsNil)
+
+	sess, err := t.NewUploadPackSession(ep, nil)
+	c.Assert(err, IsNil)
+	c.Assert(sess.(*upSession).client, Equals, hc)
+}
+
+type headerAuth struct {
+	rt http.RoundTripper
+}
+
+func (a *headerAuth) Name() string   { return "header-auth" }
+func (a *headerAuth) String() string { return a.Name() }
+
+func (a *headerAuth) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &headerAuth{rt}
+}
+
+func (a *headerAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Negotiate token")
+	return a.rt.RoundTrip(req)
+}
+
+func (s *OptionsSuite) TestTransportAuth(c *C) {
+	ep, err := transport.NewEndpoint(s.server.URL + "/repo.git")
+	c.Assert(err, IsNil)
+
+	r, err := DefaultClient.NewUploadPackSession(ep, &headerAuth{})
+	c.Assert(err, IsNil)
+
+	_, err = r.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(s.requests, HasLen, 1)
+	c.Assert(s.requests[0].Header.Get("Authorization"), Equals, "Negotiate token")
+}
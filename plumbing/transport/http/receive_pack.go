@@ -19,7 +19,7 @@ type rpSession struct {
 	*session
 }
 
-func newReceivePackSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+func newReceivePackSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
 	s, err := newSession(c, ep, auth)
 	return &rpSession{s}, err
 }
@@ -92,6 +92,13 @@ func (s *rpSession) doRequest(
 	applyHeadersToRequest(req, content, s.endpoint.Host, transport.ReceivePackServiceName)
 	s.ApplyAuthToRequest(req)
 
+	size := 0
+	if content != nil {
+		size = content.Len()
+	}
+
+	s.applyOptionsToRequest(req, size)
+
 	res, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, plumbing.NewUnexpectedError(err)
@@ -0,0 +1,394 @@
+// Package server implements a http.Handler serving git repositories using the
+// smart HTTP protocol.
+//
+// It can be used to embed git hosting in any net/http server:
+//
+//	loader := server.NewFilesystemLoader(osfs.New("/srv/git"))
+//	http.Handle("/", httpserver.NewHandler(loader))
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+const (
+	infoRefsPath = "/info/refs"
+	defaultRealm = "git"
+)
+
+// Handler is a http.Handler serving the repositories of a Loader using the
+// smart HTTP protocol. The path of the request URL without the service suffix
+// (info/refs, git-upload-pack or git-receive-pack) is the path of the
+// repository.
+//
+// The endpoint given to the loader is built from the request, using the http
+// or https protocol, the requested host and the repository path.
+type Handler struct {
+	// Authenticate, if set, is called before serving any request. If it
+	// returns an error the request is answered with 401 Unauthorized,
+	// asking the client for basic credentials.
+	Authenticate func(r *http.Request) error
+	// Authorize, if set, is called before serving any request, with the
+	// repository endpoint and the service requested, git-upload-pack or
+	// git-receive-pack. If it returns an error the request is answered with
+	// 403 Forbidden. If nil, only git-upload-pack is allowed, as does
+	// git-http-backend for anonymous users.
+	Authorize func(r *http.Request, ep *transport.Endpoint, service string) error
+	// Realm is the realm sent to the client when authentication is required,
+	// "git" by default.
+	Realm string
+
+	loader    gitserver.Loader
+	transport transport.Transport
+}
+
+// NewHandler returns a Handler serving the repositories of the given loader.
+func NewHandler(loader gitserver.Loader) *Handler {
+	return NewHandlerWithHooks(loader, nil)
+}
+
+// NewHandlerWithHooks returns a Handler serving the repositories of the given
+// loader, like NewHandler, calling the given hooks on every push.
+func NewHandlerWithHooks(loader gitserver.Loader, hooks *gitserver.Hooks) *Handler {
+	return &Handler{
+		loader:    loader,
+		transport: gitserver.NewServerWithHooks(loader, hooks),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, service, ok := splitPath(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if h.Authenticate != nil {
+		if err := h.Authenticate(r); err != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", h.realm()))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if service != transport.UploadPackServiceName &&
+		service != transport.ReceivePackServiceName {
+		http.Error(w, "unsupported service", http.StatusForbidden)
+		return
+	}
+
+	ep, err := endpoint(r, path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorize(r, ep, service); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, infoRefsPath) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.serveInfoRefs(w, ep, service)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-request", service) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := requestBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer ioutil.CheckClose(body, &err)
+
+	if service == transport.UploadPackServiceName {
+		h.serveUploadPack(w, r, ep, body)
+	} else {
+		h.serveReceivePack(w, r, ep, body)
+	}
+}
+
+func (h *Handler) realm() string {
+	if h.Realm == "" {
+		return defaultRealm
+	}
+
+	return h.Realm
+}
+
+func (h *Handler) authorize(r *http.Request, ep *transport.Endpoint, service string) error {
+	if h.Authorize != nil {
+		return h.Authorize(r, ep, service)
+	}
+
+	if service == transport.ReceivePackServiceName {
+		return fmt.Errorf("%s is not allowed", service)
+	}
+
+	return nil
+}
+
+func (h *Handler) serveInfoRefs(w http.ResponseWriter, ep *transport.Endpoint, service string) {
+	var s transport.Session
+	var err error
+	if service == transport.UploadPackServiceName {
+		s, err = h.transport.NewUploadPackSession(ep, nil)
+	} else {
+		s, err = h.transport.NewReceivePackSession(ep, nil)
+	}
+
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	defer ioutil.CheckClose(s, &err)
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	setHeaders(w, fmt.Sprintf("application/x-%s-advertisement", service))
+
+	// as git does, upload-pack advertises an empty repository with just a
+	// flush-pkt after the prefix.
+	if service == transport.UploadPackServiceName && len(ar.References) == 0 {
+		e := pktline.NewEncoder(w)
+		err = e.Encodef("# service=%s\n", service)
+		if err == nil {
+			err = e.Flush()
+		}
+
+		if err == nil {
+			err = e.Flush()
+		}
+
+		return
+	}
+
+	ar.Prefix = [][]byte{
+		[]byte(fmt.Sprintf("# service=%s", service)),
+		pktline.Flush,
+	}
+
+	err = ar.Encode(newFlushWriter(w))
+}
+
+func (h *Handler) serveUploadPack(w http.ResponseWriter, r *http.Request,
+	ep *transport.Endpoint, body io.Reader) {
+
+	s, err := h.transport.NewUploadPackSession(ep, nil)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	defer ioutil.CheckClose(s, &err)
+
+	req := packp.NewUploadPackRequest()
+	if err := req.UploadRequest.Decode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	done, err := common.DecodeUploadHaves(body, &req.UploadHaves)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// stateless clients send the haves in several requests, only the last
+	// one, marked with done, is answered with the packfile.
+	if !done {
+		h.negotiate(w, ep, req)
+		return
+	}
+
+	resp, err := s.UploadPack(r.Context(), req)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	defer ioutil.CheckClose(resp, &err)
+
+	setHeaders(w, "application/x-git-upload-pack-result")
+	err = resp.Encode(newFlushWriter(w))
+}
+
+// negotiate answers a request without done, see common.EncodeNegotiation.
+func (h *Handler) negotiate(w http.ResponseWriter, ep *transport.Endpoint,
+	req *packp.UploadPackRequest) {
+
+	sto, err := h.loader.Load(ep)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	resp, err := gitserver.Negotiate(sto, req)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	setHeaders(w, "application/x-git-upload-pack-result")
+	_ = common.EncodeNegotiation(w, req, resp)
+}
+
+func (h *Handler) serveReceivePack(w http.ResponseWriter, r *http.Request,
+	ep *transport.Endpoint, body io.Reader) {
+
+	s, err := h.transport.NewReceivePackSession(ep, nil)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	defer ioutil.CheckClose(s, &err)
+
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rs, err := s.ReceivePack(r.Context(), req)
+	if rs == nil {
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		setHeaders(w, "application/x-git-receive-pack-result")
+		return
+	}
+
+	// the errors of the commands are sent to the client in the report.
+	setHeaders(w, "application/x-git-receive-pack-result")
+	err = rs.Encode(newFlushWriter(w))
+}
+
+// splitPath returns the repository path and the service of the request, it
+// is not ok if the repository path is not absolute and clean, rejecting any
+// path escaping the served repositories.
+func splitPath(r *http.Request) (p, service string, ok bool) {
+	p = r.URL.Path
+	switch {
+	case strings.HasSuffix(p, infoRefsPath):
+		p, service = strings.TrimSuffix(p, infoRefsPath), r.URL.Query().Get("service")
+	case strings.HasSuffix(p, "/"+transport.UploadPackServiceName):
+		p, service = strings.TrimSuffix(p, "/"+transport.UploadPackServiceName), transport.UploadPackServiceName
+	case strings.HasSuffix(p, "/"+transport.ReceivePackServiceName):
+		p, service = strings.TrimSuffix(p, "/"+transport.ReceivePackServiceName), transport.ReceivePackServiceName
+	default:
+		return "", "", false
+	}
+
+	if !strings.HasPrefix(p, "/") || path.Clean(p) != p {
+		return "", "", false
+	}
+
+	return p, service, true
+}
+
+func endpoint(r *http.Request, path string) (*transport.Endpoint, error) {
+	protocol := "http"
+	if r.TLS != nil {
+		protocol = "https"
+	}
+
+	return transport.NewEndpoint(fmt.Sprintf("%s://%s%s", protocol, r.Host, path))
+}
+
+// requestBody returns the body of the request, decompressing it if needed.
+func requestBody(r *http.Request) (io.ReadCloser, error) {
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.NewReadCloser(zr, r.Body), nil
+	case "", "identity":
+		return r.Body, nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding: %s", r.Header.Get("Content-Encoding"))
+}
+
+func setHeaders(w http.ResponseWriter, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	switch err {
+	case transport.ErrRepositoryNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case transport.ErrAuthenticationRequired:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case transport.ErrAuthorizationFailed:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// flushWriter flushes the response after every write, sending it to the
+// client in chunks as soon as it is produced.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func newFlushWriter(w http.ResponseWriter) io.Writer {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return w
+	}
+
+	return &flushWriter{w, f}
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err == nil {
+		w.f.Flush()
+	}
+
+	return n, err
+}
@@ -0,0 +1,287 @@
+package server_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http/server"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/test"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BaseSuite struct {
+	fixtures.Suite
+
+	loader  gitserver.MapLoader
+	handler *server.Handler
+	server  *httptest.Server
+}
+
+func (s *BaseSuite) SetUpTest(c *C) {
+	s.loader = gitserver.MapLoader{}
+	s.handler = server.NewHandler(s.loader)
+	s.handler.Authorize = func(*http.Request, *transport.Endpoint, string) error {
+		return nil
+	}
+
+	s.server = httptest.NewServer(s.handler)
+}
+
+func (s *BaseSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *BaseSuite) newEndpoint(c *C, name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("%s/%s", s.server.URL, name))
+	c.Assert(err, IsNil)
+
+	return ep
+}
+
+func (s *BaseSuite) prepareRepository(c *C, f *fixtures.Fixture, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	return ep
+}
+
+func (s *BaseSuite) prepareEmptyRepository(c *C, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = memory.NewStorage()
+	return ep
+}
+
+type UploadPackSuite struct {
+	test.UploadPackSuite
+	BaseSuite
+}
+
+var _ = Suite(&UploadPackSuite{})
+
+func (s *UploadPackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.UploadPackSuite.Client = githttp.DefaultClient
+	s.UploadPackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.UploadPackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.UploadPackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type ReceivePackSuite struct {
+	test.ReceivePackSuite
+	BaseSuite
+}
+
+var _ = Suite(&ReceivePackSuite{})
+
+func (s *ReceivePackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.ReceivePackSuite.Client = githttp.DefaultClient
+	s.ReceivePackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.ReceivePackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.ReceivePackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type HandlerSuite struct {
+	BaseSuite
+	ep *transport.Endpoint
+}
+
+var _ = Suite(&HandlerSuite{})
+
+func (s *HandlerSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.ep = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+}
+
+func (s *HandlerSuite) TestAuthenticate(c *C) {
+	s.handler.Authenticate = func(r *http.Request) error {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "foo" || password != "bar" {
+			return errors.New("invalid credentials")
+		}
+
+		return nil
+	}
+
+	res, err := http.Get(s.ep.String() + "/info/refs?service=git-upload-pack")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusUnauthorized)
+	c.Assert(res.Header.Get("WWW-Authenticate"), Equals, `Basic realm="git"`)
+
+	sess, err := githttp.DefaultClient.NewUploadPackSession(s.ep, nil)
+	c.Assert(err, IsNil)
+	_, err = sess.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+
+	auth := &githttp.BasicAuth{Username: "foo", Password: "bar"}
+	sess, err = githttp.DefaultClient.NewUploadPackSession(s.ep, auth)
+	c.Assert(err, IsNil)
+	ar, err := sess.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(ar.References, HasLen, 5)
+}
+
+func (s *HandlerSuite) TestAuthorize(c *C) {
+	var services []string
+	s.handler.Authorize = func(r *http.Request, ep *transport.Endpoint, service string) error {
+		c.Assert(ep.String(), Equals, s.ep.String())
+		services = append(services, service)
+		return errors.New("forbidden")
+	}
+
+	sess, err := githttp.DefaultClient.NewReceivePackSession(s.ep, nil)
+	c.Assert(err, IsNil)
+	_, err = sess.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthorizationFailed)
+	c.Assert(services, DeepEquals, []string{transport.ReceivePackServiceName})
+}
+
+func (s *HandlerSuite) TestReceivePackForbiddenByDefault(c *C) {
+	s.handler.Authorize = nil
+
+	sess, err := githttp.DefaultClient.NewUploadPackSession(s.ep, nil)
+	c.Assert(err, IsNil)
+	_, err = sess.AdvertisedReferences()
+	c.Assert(err, IsNil)
+
+	rsess, err := githttp.DefaultClient.NewReceivePackSession(s.ep, nil)
+	c.Assert(err, IsNil)
+	_, err = rsess.AdvertisedReferences()
+	c.Assert(err, Equals, transport.ErrAuthorizationFailed)
+}
+
+func (s *HandlerSuite) TestUnsupportedService(c *C) {
+	res, err := http.Get(s.ep.String() + "/info/refs?service=git-foo")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusForbidden)
+
+	res, err = http.Get(s.ep.String() + "/HEAD")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (s *HandlerSuite) TestInfoRefs(c *C) {
+	res, err := http.Get(s.ep.String() + "/info/refs?service=git-upload-pack")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), Equals, "application/x-git-upload-pack-advertisement")
+
+	b, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(b[:34]), Equals, "001e# service=git-upload-pack\n0000")
+}
+
+func (s *HandlerSuite) post(c *C, body []byte, gzipped bool) string {
+	if gzipped {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(body)
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(), IsNil)
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.ep.String()+"/git-upload-pack", bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+	b, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	return string(b)
+}
+
+func (s *HandlerSuite) TestUploadPackGzip(c *C) {
+	body := s.post(c, []byte(
+		"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000"+
+			"0009done\n"), true)
+
+	c.Assert(body[:12], Equals, "0008NAK\nPACK")
+}
+
+func (s *HandlerSuite) TestUploadPackNegotiation(c *C) {
+	body := s.post(c, []byte(
+		"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000"+
+			"0032have 1111111111111111111111111111111111111111\n"+
+			"0032have 918c48b83bd081e863dbe1b80f8998f058cd8294\n0000"), false)
+
+	c.Assert(body, Equals, "0031ACK 918c48b83bd081e863dbe1b80f8998f058cd8294\n")
+
+	body = s.post(c, []byte(
+		"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"+
+			"000ddeepen 1\n0000"), false)
+
+	c.Assert(body, Equals, "0035shallow 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000")
+}
+
+func (s *HandlerSuite) TestGitClient(c *C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not found")
+	}
+
+	dir := filepath.Join(c.MkDir(), "basic")
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Env = []string{"GIT_TERMINAL_PROMPT=0", "HOME=" + dir}
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, IsNil, Commentf("%s", out))
+	}
+
+	git("clone", "--depth", "1", s.ep.String(), dir)
+	git("-C", dir, "fetch", "--unshallow")
+	git("-C", dir, "push", "origin", "master:refs/heads/new")
+
+	sto := s.loader[s.ep.String()]
+	ref, err := sto.Reference("refs/heads/new")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *HandlerSuite) TestPathTraversal(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "srv"), 0755), IsNil)
+	c.Assert(os.Rename(fixtures.Basic().One().DotGit().Root(), filepath.Join(dir, "secret.git")), IsNil)
+
+	loader := gitserver.NewFilesystemLoader(osfs.New(filepath.Join(dir, "srv")))
+	srv := httptest.NewServer(server.NewHandler(loader))
+	defer srv.Close()
+
+	for _, p := range []string{
+		"/../secret.git",
+		"/%2e%2e/secret.git",
+		"/foo/%2E%2E/%2e%2e/secret.git",
+		"/./secret.git",
+		"//secret.git",
+		"/secret.git/",
+	} {
+		res, err := http.Get(srv.URL + p + "/info/refs?service=git-upload-pack")
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, http.StatusNotFound, Commentf("%s", p))
+		c.Assert(res.Body.Close(), IsNil)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
@@ -17,17 +18,27 @@ import (
 
 type upSession struct {
 	*session
+	// local is the storer of the objects of the client, used to skip the
+	// objects it already has fetching from dumb servers.
+	local storer.EncodedObjectStorer
 }
 
-func newUploadPackSession(c *http.Client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+func newUploadPackSession(c *client, ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
 	s, err := newSession(c, ep, auth)
-	return &upSession{s}, err
+	return &upSession{session: s}, err
 }
 
 func (s *upSession) AdvertisedReferences() (*packp.AdvRefs, error) {
 	return advertisedReferences(s.session, transport.UploadPackServiceName)
 }
 
+// SetLocalObjects sets the storer of the objects of the client. Fetching from
+// dumb servers the objects found in it are not downloaded, neither the ones
+// reachable from them.
+func (s *upSession) SetLocalObjects(local storer.EncodedObjectStorer) {
+	s.local = local
+}
+
 func (s *upSession) UploadPack(
 	ctx context.Context, req *packp.UploadPackRequest,
 ) (*packp.UploadPackResponse, error) {
@@ -36,6 +47,10 @@ func (s *upSession) UploadPack(
 		return nil, transport.ErrEmptyUploadPackRequest
 	}
 
+	if s.dumb {
+		return s.dumbUploadPack(ctx, req)
+	}
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -90,6 +105,13 @@ func (s *upSession) doRequest(
 	applyHeadersToRequest(req, content, s.endpoint.Host, transport.UploadPackServiceName)
 	s.ApplyAuthToRequest(req)
 
+	size := 0
+	if content != nil {
+		size = content.Len()
+	}
+
+	s.applyOptionsToRequest(req, size)
+
 	res, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, plumbing.NewUnexpectedError(err)
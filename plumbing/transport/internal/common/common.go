@@ -74,12 +74,29 @@ type CommandKiller interface {
 }
 
 type client struct {
-	cmdr Commander
+	cmdr        Commander
+	uploadPack  string
+	receivePack string
 }
 
 // NewClient creates a new client using the given Commander.
 func NewClient(runner Commander) transport.Transport {
-	return &client{runner}
+	return &client{cmdr: runner}
+}
+
+// WithCommands returns a copy of the client running the given commands
+// instead of git-upload-pack and git-receive-pack.
+func (c *client) WithCommands(uploadPack, receivePack string) transport.Transport {
+	n := *c
+	if uploadPack != "" {
+		n.uploadPack = uploadPack
+	}
+
+	if receivePack != "" {
+		n.receivePack = receivePack
+	}
+
+	return &n
 }
 
 // NewUploadPackSession creates a new UploadPackSession.
@@ -109,7 +126,15 @@ type session struct {
 }
 
 func (c *client) newSession(s string, ep *transport.Endpoint, auth transport.AuthMethod) (*session, error) {
-	cmd, err := c.cmdr.Command(s, ep, auth)
+	name := s
+	switch {
+	case s == transport.UploadPackServiceName && c.uploadPack != "":
+		name = c.uploadPack
+	case s == transport.ReceivePackServiceName && c.receivePack != "":
+		name = c.receivePack
+	}
+
+	cmd, err := c.cmdr.Command(name, ep, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -1,12 +1,24 @@
 package common
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	stdioutil "io/ioutil"
+	"strings"
+	"sync"
 
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
 	"gopkg.in/src-d/go-git.v4/utils/ioutil"
 )
 
@@ -71,3 +83,438 @@ func ServeReceivePack(cmd ServerCommand, s transport.ReceivePackSession) error {
 
 	return nil
 }
+
+// ServeStatefulUploadPack serves an upload-pack to a client keeping the
+// connection open during the whole negotiation, as git does through the git
+// and ssh protocols: the haves are acknowledged at every flush-pkt of the
+// client, until it sends done. The storer of the repository is used to find
+// the haves in common with the client.
+func ServeStatefulUploadPack(ctx context.Context, cmd ServerCommand,
+	s transport.UploadPackSession, sto storer.Storer) (err error) {
+
+	w := cmd.Stdout
+	r := bufio.NewReader(cmd.Stdin)
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	// as git does, an empty repository is advertised with just a flush-pkt,
+	// the client closes the connection or answers with another one.
+	if len(ar.References) == 0 {
+		if err := pktline.NewEncoder(w).Flush(); err != nil {
+			return err
+		}
+
+		_, err := r.Peek(4)
+		if err == io.EOF {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := ar.Encode(w); err != nil {
+		return err
+	}
+
+	// the client closes the connection, or sends a flush-pkt, if it does
+	// not want any reference, e.g. on ls-remote.
+	if b, err := r.Peek(4); err != nil || bytes.Equal(b, pktline.FlushPkt) {
+		return nil
+	}
+
+	req := packp.NewUploadPackRequest()
+	if err := req.UploadRequest.Decode(r); err != nil {
+		return err
+	}
+
+	for _, want := range req.Wants {
+		err := sto.HasEncodedObject(want)
+		if err == plumbing.ErrObjectNotFound {
+			err = fmt.Errorf("upload-pack: not our ref %s", want)
+			if serr := pktline.NewEncoder(w).Encodef("ERR %s", err); serr != nil {
+				return serr
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !req.Depth.IsZero() {
+		resp, err := server.Negotiate(sto, req)
+		if err != nil {
+			return err
+		}
+
+		if err := resp.ShallowUpdate.Encode(w); err != nil {
+			return err
+		}
+	}
+
+	done, err := negotiate(w, r, sto, &req.UploadHaves)
+	if err != nil || !done {
+		return err
+	}
+
+	resp, err := s.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(resp, &err)
+
+	// the ACK or NAK of the response was already sent during the
+	// negotiation, only the packfile is left.
+	_, err = io.Copy(w, resp)
+	return err
+}
+
+// negotiate reads the haves of the client, acknowledging the first one
+// present in the storer as soon as it is found, and sending a NAK at every
+// flush-pkt or done while none is found. It returns true if the client sent
+// done, false if it closed the connection.
+func negotiate(w io.Writer, r io.Reader, sto storer.EncodedObjectStorer,
+	u *packp.UploadHaves) (bool, error) {
+
+	e := pktline.NewEncoder(w)
+	var found bool
+
+	s := pktline.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSuffix(string(s.Bytes()), "\n")
+		switch {
+		case line == "" || line == "done":
+			if !found {
+				if err := e.Encodef("NAK\n"); err != nil {
+					return false, err
+				}
+			}
+
+			if line == "done" {
+				return true, nil
+			}
+		case strings.HasPrefix(line, "have "):
+			h := strings.TrimPrefix(line, "have ")
+			if len(h) != 40 {
+				return false, fmt.Errorf("malformed have line: %q", line)
+			}
+
+			hash := plumbing.NewHash(h)
+			u.Haves = append(u.Haves, hash)
+			if found {
+				continue
+			}
+
+			err := sto.HasEncodedObject(hash)
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			found = true
+			if err := e.Encodef("ACK %s\n", hash); err != nil {
+				return false, err
+			}
+		default:
+			return false, fmt.Errorf("unexpected line: %q", line)
+		}
+	}
+
+	return false, s.Err()
+}
+
+// ServeStatefulReceivePack serves a receive-pack to a client keeping the
+// connection open to read the report status, as git does through the git and
+// ssh protocols.
+func ServeStatefulReceivePack(ctx context.Context, cmd ServerCommand,
+	s transport.ReceivePackSession) error {
+
+	w := cmd.Stdout
+	r := bufio.NewReader(cmd.Stdin)
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	if err := ar.Encode(w); err != nil {
+		return err
+	}
+
+	// the client sends a flush-pkt if it has nothing to push.
+	if b, err := r.Peek(4); err != nil || bytes.Equal(b, pktline.FlushPkt) {
+		return nil
+	}
+
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(r); err != nil {
+		return err
+	}
+
+	// the client keeps the connection open to read the report status, the
+	// packfile ends at its checksum instead of at EOF, and it is not sent at
+	// all if every command is a delete.
+	req.Packfile = nil
+	for _, cmd := range req.Commands {
+		if cmd.Action() != packp.Delete {
+			req.Packfile = packfileReader(r)
+			break
+		}
+	}
+
+	rs, err := s.ReceivePack(ctx, req)
+	if rs != nil && req.Capabilities.Supports(capability.ReportStatus) {
+		if err := rs.Encode(w); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// packfileReader returns a reader of the packfile read from r, returning EOF
+// after the packfile checksum.
+func packfileReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(scanPackfile(io.TeeReader(r, pw)))
+	}()
+
+	return pr
+}
+
+func scanPackfile(r io.Reader) error {
+	s := packfile.NewScanner(r)
+	_, objects, err := s.Header()
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < objects; i++ {
+		if _, err := s.NextObjectHeader(); err != nil {
+			return err
+		}
+
+		if _, _, err := s.NextObject(stdioutil.Discard); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.Checksum()
+	return err
+}
+
+// ServeUploadArchive serves an upload-archive request. Once the request is
+// acknowledged, the archive is sent in the data channel of a side-band-64k
+// stream, and an error writing it in the error channel.
+func ServeUploadArchive(ctx context.Context, cmd ServerCommand,
+	s transport.UploadArchiveSession) error {
+
+	req := &packp.UploadArchiveRequest{}
+	if err := req.Decode(cmd.Stdin); err != nil {
+		return err
+	}
+
+	r, err := s.UploadArchive(ctx, req)
+	if err != nil {
+		if err := packp.EncodeUploadArchiveStatus(cmd.Stdout, err); err != nil {
+			return err
+		}
+
+		return err
+	}
+
+	defer r.Close()
+
+	if err := packp.EncodeUploadArchiveStatus(cmd.Stdout, nil); err != nil {
+		return err
+	}
+
+	m := sideband.NewMuxer(sideband.Sideband64k, cmd.Stdout)
+	if _, err := io.Copy(m, r); err != nil {
+		_, _ = m.WriteChannel(sideband.ErrorMessage, []byte(fmt.Sprintf("fatal: %s\n", err)))
+		return err
+	}
+
+	return pktline.NewEncoder(cmd.Stdout).Flush()
+}
+
+// AdvertiseReferences writes the references advertised by the session, as
+// git does with --advertise-refs. As git does, an empty repository is
+// advertised by upload-pack with just a flush-pkt.
+func AdvertiseReferences(cmd ServerCommand, s transport.Session) error {
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.(transport.UploadPackSession); ok && len(ar.References) == 0 {
+		return pktline.NewEncoder(cmd.Stdout).Flush()
+	}
+
+	return ar.Encode(cmd.Stdout)
+}
+
+// ServeStatelessUploadPack serves a single request of an upload-pack without
+// advertising the references, as git does with --stateless-rpc. Stateless
+// clients send their haves in several requests: a request without done is
+// answered with the acknowledgement of its haves, the one ending with done
+// with the packfile.
+func ServeStatelessUploadPack(ctx context.Context, cmd ServerCommand,
+	s transport.UploadPackSession, sto storer.Storer) (err error) {
+
+	req := packp.NewUploadPackRequest()
+	if err := req.UploadRequest.Decode(cmd.Stdin); err != nil {
+		return err
+	}
+
+	done, err := DecodeUploadHaves(cmd.Stdin, &req.UploadHaves)
+	if err != nil {
+		return err
+	}
+
+	if !done {
+		resp, err := server.Negotiate(sto, req)
+		if err != nil {
+			return err
+		}
+
+		return EncodeNegotiation(cmd.Stdout, req, resp)
+	}
+
+	resp, err := s.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(resp, &err)
+
+	return resp.Encode(cmd.Stdout)
+}
+
+// ServeStatelessReceivePack serves a single request of a receive-pack
+// without advertising the references, as git does with --stateless-rpc.
+func ServeStatelessReceivePack(ctx context.Context, cmd ServerCommand,
+	s transport.ReceivePackSession) error {
+
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(cmd.Stdin); err != nil {
+		return err
+	}
+
+	rs, err := s.ReceivePack(ctx, req)
+	if rs != nil && req.Capabilities.Supports(capability.ReportStatus) {
+		if err := rs.Encode(cmd.Stdout); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// DecodeUploadHaves reads the have lines following an upload-request, it
+// returns true if the haves end with a done line.
+func DecodeUploadHaves(r io.Reader, u *packp.UploadHaves) (bool, error) {
+	s := pktline.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSuffix(string(s.Bytes()), "\n")
+		switch {
+		case line == "":
+			// flush-pkt between rounds of haves
+		case line == "done":
+			return true, nil
+		case strings.HasPrefix(line, "have "):
+			h := strings.TrimPrefix(line, "have ")
+			if len(h) != 40 {
+				return false, fmt.Errorf("malformed have line: %q", line)
+			}
+
+			u.Haves = append(u.Haves, plumbing.NewHash(h))
+		default:
+			return false, fmt.Errorf("unexpected line: %q", line)
+		}
+	}
+
+	return false, s.Err()
+}
+
+// EncodeNegotiation answers a stateless upload-pack request without done
+// with the given response of server.Negotiate, sending the shallow update if
+// the request changes the depth of the client history, and acknowledging the
+// first have in common if the request has any.
+func EncodeNegotiation(w io.Writer, req *packp.UploadPackRequest, resp *packp.UploadPackResponse) error {
+	if !req.Depth.IsZero() {
+		if err := resp.ShallowUpdate.Encode(w); err != nil {
+			return err
+		}
+	}
+
+	if len(req.Haves) == 0 {
+		return nil
+	}
+
+	return resp.ServerResponse.Encode(w)
+}
+
+// RepositoryLocks serializes the pushes to a repository with the other
+// requests to it, so a push is seen by every request started after it, even
+// if the client did not wait for its report status. The zero value is ready
+// to use.
+type RepositoryLocks struct {
+	mu    sync.Mutex
+	repos map[string]*repositoryLock
+}
+
+type repositoryLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// Lock locks the repository of the given endpoint, exclusively if write is
+// true, and returns the function unlocking it.
+func (l *RepositoryLocks) Lock(ep *transport.Endpoint, write bool) func() {
+	key := ep.String()
+
+	l.mu.Lock()
+	if l.repos == nil {
+		l.repos = make(map[string]*repositoryLock)
+	}
+
+	rl, ok := l.repos[key]
+	if !ok {
+		rl = &repositoryLock{}
+		l.repos[key] = rl
+	}
+
+	rl.refs++
+	l.mu.Unlock()
+
+	if write {
+		rl.Lock()
+	} else {
+		rl.RLock()
+	}
+
+	return func() {
+		if write {
+			rl.Unlock()
+		} else {
+			rl.RUnlock()
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		rl.refs--
+		if rl.refs == 0 {
+			delete(l.repos, key)
+		}
+	}
+}
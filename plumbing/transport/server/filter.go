@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// filterObjects removes from the given objects the ones omitted by the given
+// filter. The objects explicitly wanted are never omitted.
+func filterObjects(
+	s storer.EncodedObjectStorer,
+	objs, wants []plumbing.Hash,
+	f packp.Filter,
+) ([]plumbing.Hash, error) {
+	if f.IsZero() {
+		return objs, nil
+	}
+
+	spec, err := f.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if !spec.SparseOID.IsZero() {
+		return nil, fmt.Errorf("%s: %q", packp.ErrUnsupportedFilter, f)
+	}
+
+	wanted := make(map[plumbing.Hash]bool, len(wants))
+	for _, h := range wants {
+		wanted[h] = true
+	}
+
+	var allowed map[plumbing.Hash]bool
+	if spec.TreeDepth >= 0 {
+		allowed, err = treesUpToDepth(s, objs, int(spec.TreeDepth))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []plumbing.Hash
+	for _, h := range objs {
+		if wanted[h] {
+			result = append(result, h)
+			continue
+		}
+
+		o, err := s.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o.Type() {
+		case plumbing.TreeObject, plumbing.BlobObject:
+			if allowed != nil && !allowed[h] {
+				continue
+			}
+
+			if o.Type() == plumbing.BlobObject &&
+				spec.BlobLimit >= 0 && o.Size() >= spec.BlobLimit {
+				continue
+			}
+		}
+
+		result = append(result, h)
+	}
+
+	return result, nil
+}
+
+// treesUpToDepth returns the trees and blobs whose depth from the root tree of
+// any of the given commits is lower than the given depth. The objects that are
+// not commits are ignored.
+func treesUpToDepth(
+	s storer.EncodedObjectStorer,
+	objs []plumbing.Hash,
+	depth int,
+) (map[plumbing.Hash]bool, error) {
+	allowed := make(map[plumbing.Hash]bool)
+
+	var trees []plumbing.Hash
+	for _, h := range objs {
+		o, err := s.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.Type() != plumbing.CommitObject {
+			continue
+		}
+
+		c, err := object.DecodeCommit(s, o)
+		if err != nil {
+			return nil, err
+		}
+
+		trees = append(trees, c.TreeHash)
+	}
+
+	for level := 0; level < depth && len(trees) > 0; level++ {
+		var next []plumbing.Hash
+		for _, h := range trees {
+			if allowed[h] {
+				continue
+			}
+
+			allowed[h] = true
+			if level+1 >= depth {
+				continue
+			}
+
+			t, err := object.GetTree(s, h)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range t.Entries {
+				switch {
+				case e.Mode == filemode.Dir:
+					next = append(next, e.Hash)
+				case e.Mode.IsFile():
+					allowed[e.Hash] = true
+				}
+			}
+		}
+
+		trees = next
+	}
+
+	return allowed, nil
+}
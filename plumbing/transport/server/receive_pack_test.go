@@ -1,9 +1,24 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 
 	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
 )
 
 type ReceivePackSuite struct {
@@ -31,3 +46,165 @@ func (s *ReceivePackSuite) TestAdvertisedReferencesNotExists(c *C) {
 	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
 	c.Assert(r, IsNil)
 }
+
+type ReceivePackHooksSuite struct {
+	fixtures.Suite
+	storer storer.Storer
+	hooks  server.Hooks
+	ep     *transport.Endpoint
+}
+
+var _ = Suite(&ReceivePackHooksSuite{})
+
+func (s *ReceivePackHooksSuite) SetUpTest(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	s.storer = filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	s.hooks = server.Hooks{}
+
+	var err error
+	s.ep, err = transport.NewEndpoint(fs.Root())
+	c.Assert(err, IsNil)
+}
+
+func (s *ReceivePackHooksSuite) receivePack(c *C, req *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error) {
+	loader := server.MapLoader{s.ep.String(): s.storer}
+	srv := server.NewServerWithHooks(loader, &s.hooks)
+
+	r, err := srv.NewReceivePackSession(s.ep, nil)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	var buf bytes.Buffer
+	_, err = packfile.NewEncoder(&buf, memory.NewStorage(), false).Encode(nil, 10)
+	c.Assert(err, IsNil)
+
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Packfile = ioutil.NopCloser(&buf)
+	return r.ReceivePack(context.Background(), req)
+}
+
+func (s *ReceivePackHooksSuite) newRequest(cmds ...*packp.Command) *packp.ReferenceUpdateRequest {
+	req := packp.NewReferenceUpdateRequest()
+	req.Commands = cmds
+	return req
+}
+
+func (s *ReceivePackHooksSuite) checkReference(c *C, name string, expected string) {
+	ref, err := s.storer.Reference(plumbing.ReferenceName(name))
+	if expected == "" {
+		c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+		return
+	}
+
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, expected)
+}
+
+func (s *ReceivePackHooksSuite) TestAtomic(c *C) {
+	req := s.newRequest(&packp.Command{
+		Name: "refs/heads/master",
+		Old:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		New:  plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	}, &packp.Command{
+		Name: "refs/heads/new",
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+	req.Capabilities.Set(capability.Atomic)
+
+	report, err := s.receivePack(c, req)
+	c.Assert(err, IsNil)
+	c.Assert(report.Error(), IsNil)
+
+	s.checkReference(c, "refs/heads/master", "918c48b83bd081e863dbe1b80f8998f058cd8294")
+	s.checkReference(c, "refs/heads/new", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
+
+func (s *ReceivePackHooksSuite) TestAtomicFailure(c *C) {
+	req := s.newRequest(&packp.Command{
+		Name: "refs/heads/new",
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, &packp.Command{
+		Name: "refs/heads/branch",
+		Old:  plumbing.NewHash("1111111111111111111111111111111111111111"),
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+	req.Capabilities.Set(capability.Atomic)
+
+	report, err := s.receivePack(c, req)
+	c.Assert(err, NotNil)
+	c.Assert(report.CommandStatuses, HasLen, 2)
+
+	statuses := map[plumbing.ReferenceName]string{}
+	for _, cs := range report.CommandStatuses {
+		statuses[cs.ReferenceName] = cs.Status
+	}
+
+	c.Assert(statuses["refs/heads/new"], Equals, server.ErrAtomicPushFailed.Error())
+	c.Assert(statuses["refs/heads/branch"], Equals, server.ErrUpdateReference.Error())
+
+	s.checkReference(c, "refs/heads/new", "")
+	s.checkReference(c, "refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+}
+
+func (s *ReceivePackHooksSuite) TestNonAtomicPartialFailure(c *C) {
+	req := s.newRequest(&packp.Command{
+		Name: "refs/heads/new",
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, &packp.Command{
+		Name: "refs/heads/branch",
+		Old:  plumbing.NewHash("1111111111111111111111111111111111111111"),
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	_, err := s.receivePack(c, req)
+	c.Assert(err, Equals, server.ErrUpdateReference)
+
+	s.checkReference(c, "refs/heads/new", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.checkReference(c, "refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+}
+
+func (s *ReceivePackHooksSuite) TestHooks(c *C) {
+	var options []string
+	var updated []*packp.Command
+	s.hooks.PreReceive = func(_ context.Context, _ storer.Storer, req *packp.ReferenceUpdateRequest) error {
+		options = req.Options
+		return nil
+	}
+
+	s.hooks.PostReceive = func(_ context.Context, _ storer.Storer, _ *packp.ReferenceUpdateRequest, cmds []*packp.Command) {
+		updated = cmds
+	}
+
+	cmd := &packp.Command{
+		Name: "refs/heads/new",
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}
+
+	req := s.newRequest(cmd)
+	req.Capabilities.Set(capability.PushOptions)
+	req.Options = []string{"ci.skip"}
+
+	_, err := s.receivePack(c, req)
+	c.Assert(err, IsNil)
+	c.Assert(options, DeepEquals, []string{"ci.skip"})
+	c.Assert(updated, DeepEquals, []*packp.Command{cmd})
+}
+
+func (s *ReceivePackHooksSuite) TestPreReceiveDeclined(c *C) {
+	s.hooks.PreReceive = func(context.Context, storer.Storer, *packp.ReferenceUpdateRequest) error {
+		return errors.New("foo")
+	}
+
+	s.hooks.PostReceive = func(context.Context, storer.Storer, *packp.ReferenceUpdateRequest, []*packp.Command) {
+		c.Fatal("post-receive hook called")
+	}
+
+	req := s.newRequest(&packp.Command{
+		Name: "refs/heads/new",
+		New:  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	_, err := s.receivePack(c, req)
+	c.Assert(err, Equals, server.ErrHookDeclined)
+	s.checkReference(c, "refs/heads/new", "")
+}
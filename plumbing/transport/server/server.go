@@ -25,12 +25,32 @@ type server struct {
 	handler *handler
 }
 
+// Hooks are functions called by the receive-pack sessions of a server, in
+// the same way as the git server-side hooks.
+type Hooks struct {
+	// PreReceive is called once the packfile has been received, before
+	// updating any reference. The push options sent by the client are
+	// available in the request. If it returns an error no reference is
+	// updated.
+	PreReceive func(ctx context.Context, s storer.Storer, req *packp.ReferenceUpdateRequest) error
+	// PostReceive is called after updating the references, with the
+	// commands successfully applied.
+	PostReceive func(ctx context.Context, s storer.Storer, req *packp.ReferenceUpdateRequest,
+		updated []*packp.Command)
+}
+
 // NewServer returns a transport.Transport implementing a git server,
 // independent of transport. Each transport must wrap this.
 func NewServer(loader Loader) transport.Transport {
+	return NewServerWithHooks(loader, nil)
+}
+
+// NewServerWithHooks returns a transport.Transport implementing a git server,
+// like NewServer, calling the given hooks on every push.
+func NewServerWithHooks(loader Loader, hooks *Hooks) transport.Transport {
 	return &server{
 		loader,
-		&handler{asClient: false},
+		&handler{asClient: false, hooks: hooks},
 	}
 }
 
@@ -63,6 +83,7 @@ func (s *server) NewReceivePackSession(ep *transport.Endpoint, auth transport.Au
 
 type handler struct {
 	asClient bool
+	hooks    *Hooks
 }
 
 func (h *handler) NewUploadPackSession(s storer.Storer) (transport.UploadPackSession, error) {
@@ -74,6 +95,7 @@ func (h *handler) NewUploadPackSession(s storer.Storer) (transport.UploadPackSes
 func (h *handler) NewReceivePackSession(s storer.Storer) (transport.ReceivePackSession, error) {
 	return &rpSession{
 		session:   session{storer: s, asClient: h.asClient},
+		hooks:     h.hooks,
 		cmdStatus: map[plumbing.ReferenceName]error{},
 	}, nil
 }
@@ -136,6 +158,14 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 		return nil, transport.ErrEmptyUploadPackRequest
 	}
 
+	// git clients do not request the shallow capability, even if they send
+	// shallow or deepen lines.
+	if len(req.Shallows) != 0 || !req.Depth.IsZero() {
+		if err := req.Capabilities.Set(capability.Shallow); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -153,11 +183,17 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 
 	s.caps = req.Capabilities
 
-	if len(req.Shallows) > 0 {
-		return nil, fmt.Errorf("shallow not supported")
+	shallows, err := computeShallows(s.storer, req)
+	if err != nil {
+		return nil, err
+	}
+
+	haves, err := commonHaves(s.storer, req.Haves)
+	if err != nil {
+		return nil, err
 	}
 
-	objs, err := s.objectsToUpload(req)
+	objs, err := s.objectsToUpload(req, haves, shallows)
 	if err != nil {
 		return nil, err
 	}
@@ -170,18 +206,87 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 		pw.CloseWithError(err)
 	}()
 
-	return packp.NewUploadPackResponseWithPackfile(req,
+	resp := packp.NewUploadPackResponseWithPackfile(req,
 		ioutil.NewContextReadCloser(ctx, pr),
-	), nil
+	)
+
+	resp.ShallowUpdate = shallows.update
+	if len(haves) != 0 {
+		resp.ACKs = haves[:1]
+	}
+
+	return resp, nil
 }
 
-func (s *upSession) objectsToUpload(req *packp.UploadPackRequest) ([]plumbing.Hash, error) {
-	haves, err := revlist.Objects(s.storer, req.Haves, nil)
+// Negotiate answers an upload-pack request of a stateless client that has not
+// finished the negotiation. The response contains the shallow update, if the
+// request changes the depth of the client history, and acknowledges the first
+// of the client haves present in the storer, but it has no packfile.
+func Negotiate(s storer.Storer, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	shallows, err := computeShallows(s, req)
+	if err != nil {
+		return nil, err
+	}
+
+	haves, err := commonHaves(s, req.Haves)
 	if err != nil {
 		return nil, err
 	}
 
-	return revlist.Objects(s.storer, req.Wants, haves)
+	resp := packp.NewUploadPackResponse(req)
+	resp.ShallowUpdate = shallows.update
+	if len(haves) != 0 {
+		resp.ACKs = haves[:1]
+	}
+
+	return resp, nil
+}
+
+// commonHaves returns the given haves present in the storer, the objects of
+// the client unknown to the server are ignored.
+func commonHaves(s storer.EncodedObjectStorer, haves []plumbing.Hash) ([]plumbing.Hash, error) {
+	var common []plumbing.Hash
+	for _, h := range haves {
+		err := s.HasEncodedObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		common = append(common, h)
+	}
+
+	return common, nil
+}
+
+func (s *upSession) objectsToUpload(req *packp.UploadPackRequest, haves []plumbing.Hash,
+	shallows *shallowState) ([]plumbing.Hash, error) {
+
+	objs, err := s.reachableObjects(req, haves, shallows)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterObjects(s.storer, objs, req.Wants, req.Filter)
+}
+
+func (s *upSession) reachableObjects(req *packp.UploadPackRequest, haves []plumbing.Hash,
+	shallows *shallowState) ([]plumbing.Hash, error) {
+
+	if len(req.Shallows) == 0 && len(shallows.boundary) == 0 {
+		haves, err := revlist.Objects(s.storer, haves, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return revlist.Objects(s.storer, req.Wants, haves)
+	}
+
+	wants := append(append([]plumbing.Hash(nil), req.Wants...), shallows.extraWants...)
+	return revlist.ShallowObjects(s.storer, wants, haves, shallows.boundary, req.Shallows)
 }
 
 func (*upSession) setSupportedCapabilities(c *capability.List) error {
@@ -193,11 +298,24 @@ func (*upSession) setSupportedCapabilities(c *capability.List) error {
 		return err
 	}
 
+	for _, name := range []capability.Capability{
+		capability.Shallow,
+		capability.DeepenSince,
+		capability.DeepenNot,
+		capability.DeepenRelative,
+		capability.Filter,
+	} {
+		if err := c.Set(name); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 type rpSession struct {
 	session
+	hooks     *Hooks
 	cmdStatus map[plumbing.ReferenceName]error
 	firstErr  error
 	unpackErr error
@@ -225,6 +343,14 @@ func (s *rpSession) AdvertisedReferences() (*packp.AdvRefs, error) {
 
 var (
 	ErrUpdateReference = errors.New("failed to update ref")
+	// ErrAtomicPushFailed is the status of the commands of an atomic push not
+	// applied because any other command of the push failed.
+	ErrAtomicPushFailed = errors.New("atomic push failed")
+	// ErrHookDeclined is the status of the commands not applied because the
+	// PreReceive hook returned an error.
+	ErrHookDeclined = errors.New("pre-receive hook declined")
+
+	errUnpacker = errors.New("unpacker error")
 )
 
 func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error) {
@@ -241,61 +367,161 @@ func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateR
 
 	s.caps = req.Capabilities
 
-	//TODO: Implement 'atomic' update of references.
+	var r io.ReadCloser
+	if req.Packfile != nil {
+		r = ioutil.NewContextReadCloser(ctx, req.Packfile)
+	}
 
-	r := ioutil.NewContextReadCloser(ctx, req.Packfile)
 	if err := s.writePackfile(r); err != nil {
 		s.unpackErr = err
 		s.firstErr = err
+		for _, cmd := range req.Commands {
+			s.cmdStatus[cmd.Name] = errUnpacker
+		}
+
 		return s.reportStatus(), err
 	}
 
-	s.updateReferences(req)
+	if s.hooks != nil && s.hooks.PreReceive != nil {
+		if err := s.hooks.PreReceive(ctx, s.storer, req); err != nil {
+			for _, cmd := range req.Commands {
+				s.setStatus(cmd.Name, ErrHookDeclined)
+			}
+
+			return s.reportStatus(), s.firstErr
+		}
+	}
+
+	var updated []*packp.Command
+	if req.Capabilities.Supports(capability.Atomic) {
+		updated = s.updateReferencesAtomic(req)
+	} else {
+		updated = s.updateReferences(req)
+	}
+
+	if s.hooks != nil && s.hooks.PostReceive != nil && len(updated) != 0 {
+		s.hooks.PostReceive(ctx, s.storer, req, updated)
+	}
+
 	return s.reportStatus(), s.firstErr
 }
 
-func (s *rpSession) updateReferences(req *packp.ReferenceUpdateRequest) {
+// updateReferences applies every command of the given request independently,
+// returning the commands successfully applied.
+func (s *rpSession) updateReferences(req *packp.ReferenceUpdateRequest) []*packp.Command {
+	var updated []*packp.Command
 	for _, cmd := range req.Commands {
-		exists, err := referenceExists(s.storer, cmd.Name)
+		err := s.checkCommand(cmd)
+		if err == nil {
+			err = s.applyCommand(cmd)
+		}
+
+		s.setStatus(cmd.Name, err)
+		if err == nil {
+			updated = append(updated, cmd)
+		}
+	}
+
+	return updated
+}
+
+// updateReferencesAtomic applies all the commands of the given request or
+// none of them. The references updated before a command fails are restored
+// to their previous values.
+func (s *rpSession) updateReferencesAtomic(req *packp.ReferenceUpdateRequest) []*packp.Command {
+	for _, cmd := range req.Commands {
+		if err := s.checkCommand(cmd); err != nil {
+			s.setAtomicStatus(req.Commands, cmd, err)
+			return nil
+		}
+	}
+
+	var previous []*plumbing.Reference
+	for i, cmd := range req.Commands {
+		old, err := s.storer.Reference(cmd.Name)
+		if err == plumbing.ErrReferenceNotFound {
+			old, err = nil, nil
+		}
+
+		if err == nil {
+			err = s.applyCommand(cmd)
+		}
+
 		if err != nil {
-			s.setStatus(cmd.Name, err)
-			continue
+			s.rollback(req.Commands[:i], previous)
+			s.setAtomicStatus(req.Commands, cmd, err)
+			return nil
 		}
 
-		switch cmd.Action() {
-		case packp.Create:
-			if exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
-			}
+		previous = append(previous, old)
+	}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := s.storer.SetReference(ref)
-			s.setStatus(cmd.Name, err)
-		case packp.Delete:
-			if !exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
-			}
+	for _, cmd := range req.Commands {
+		s.setStatus(cmd.Name, nil)
+	}
 
-			err := s.storer.RemoveReference(cmd.Name)
-			s.setStatus(cmd.Name, err)
-		case packp.Update:
-			if !exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
-			}
+	return req.Commands
+}
 
-			if err != nil {
-				s.setStatus(cmd.Name, err)
-				continue
-			}
+// rollback restores the references modified by the given commands to the
+// given previous values, a nil value meaning the reference did not exist.
+// This is done in a best-effort basis, the errors are ignored since the
+// failure is already being reported.
+func (s *rpSession) rollback(cmds []*packp.Command, previous []*plumbing.Reference) {
+	for i := len(cmds) - 1; i >= 0; i-- {
+		if previous[i] == nil {
+			_ = s.storer.RemoveReference(cmds[i].Name)
+			continue
+		}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := s.storer.SetReference(ref)
-			s.setStatus(cmd.Name, err)
+		_ = s.storer.SetReference(previous[i])
+	}
+}
+
+// setAtomicStatus sets the given error as the status of the failed command,
+// and ErrAtomicPushFailed as the status of all the other commands.
+func (s *rpSession) setAtomicStatus(cmds []*packp.Command, failed *packp.Command, err error) {
+	s.setStatus(failed.Name, err)
+	for _, cmd := range cmds {
+		if cmd != failed {
+			s.setStatus(cmd.Name, ErrAtomicPushFailed)
+		}
+	}
+}
+
+// checkCommand checks if the given command can be applied: created
+// references must not exist, and updated or deleted references must point to
+// the old value of the command.
+func (s *rpSession) checkCommand(cmd *packp.Command) error {
+	ref, err := storer.ResolveReference(s.storer, cmd.Name)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	exists := err == nil
+	switch cmd.Action() {
+	case packp.Create:
+		if exists {
+			return ErrUpdateReference
+		}
+	case packp.Update, packp.Delete:
+		if !exists || ref.Hash() != cmd.Old {
+			return ErrUpdateReference
 		}
 	}
+
+	return nil
+}
+
+func (s *rpSession) applyCommand(cmd *packp.Command) error {
+	switch cmd.Action() {
+	case packp.Create, packp.Update:
+		return s.storer.SetReference(plumbing.NewHashReference(cmd.Name, cmd.New))
+	case packp.Delete:
+		return s.storer.RemoveReference(cmd.Name)
+	}
+
+	return ErrUpdateReference
 }
 
 func (s *rpSession) writePackfile(r io.ReadCloser) error {
@@ -362,6 +588,19 @@ func (*rpSession) setSupportedCapabilities(c *capability.List) error {
 		return err
 	}
 
+	if err := c.Set(capability.Atomic); err != nil {
+		return err
+	}
+
+	if err := c.Set(capability.PushOptions); err != nil {
+		return err
+	}
+
+	// thin packs cannot be written, their base objects are not included.
+	if err := c.Set(capability.NoThin); err != nil {
+		return err
+	}
+
 	return c.Set(capability.ReportStatus)
 }
 
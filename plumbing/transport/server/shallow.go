@@ -0,0 +1,353 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// shallowState is the shallow boundary resulting from an upload-pack
+// request.
+type shallowState struct {
+	// update holds the shallow and unshallow lines to send to the client.
+	update packp.ShallowUpdate
+	// boundary are the commits whose parents must not be sent.
+	boundary []plumbing.Hash
+	// extraWants are the parents of the commits that got unshallowed, the
+	// client needs them even if they are reachable from its haves.
+	extraWants []plumbing.Hash
+}
+
+// computeShallows returns the shallow boundary of the given request, based on
+// the shallow commits of the client and the requested depth.
+func computeShallows(s storer.Storer, req *packp.UploadPackRequest) (*shallowState, error) {
+	state := &shallowState{}
+	if req.Depth.IsZero() {
+		state.boundary = req.Shallows
+		return state, nil
+	}
+
+	wants, err := wantedCommits(s, req.Wants)
+	if err != nil {
+		return nil, err
+	}
+
+	clientShallows := make(map[plumbing.Hash]bool)
+	for _, h := range req.Shallows {
+		clientShallows[h] = true
+	}
+
+	var reached, shallows map[plumbing.Hash]*object.Commit
+	switch depth := req.Depth.(type) {
+	case packp.DepthCommits:
+		if req.Capabilities.Supports(capability.DeepenRelative) {
+			reached, shallows, err = deepenRelative(wants, clientShallows, int(depth))
+		} else {
+			reached, shallows, err = deepenCommits(wants, int(depth))
+		}
+	case packp.DepthSince:
+		reached, shallows, err = deepenSince(wants, time.Time(depth))
+	case packp.DepthReference:
+		reached, shallows, err = deepenNot(s, wants, []string{string(depth)})
+	case packp.DepthReferences:
+		reached, shallows, err = deepenNot(s, wants, depth)
+	default:
+		err = fmt.Errorf("unsupported depth: %T", req.Depth)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for h := range shallows {
+		if !clientShallows[h] {
+			state.update.Shallows = append(state.update.Shallows, h)
+		}
+
+		state.boundary = append(state.boundary, h)
+	}
+
+	for h := range clientShallows {
+		c, ok := reached[h]
+		if !ok {
+			state.boundary = append(state.boundary, h)
+			continue
+		}
+
+		if _, ok := shallows[h]; ok {
+			continue
+		}
+
+		state.update.Unshallows = append(state.update.Unshallows, h)
+		state.extraWants = append(state.extraWants, c.ParentHashes...)
+	}
+
+	plumbing.HashesSort(state.update.Shallows)
+	plumbing.HashesSort(state.update.Unshallows)
+
+	return state, nil
+}
+
+// wantedCommits returns the commits pointed by the given wants, peeling the
+// tags. Wants pointing to any other kind of object are ignored.
+func wantedCommits(s storer.EncodedObjectStorer, wants []plumbing.Hash) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for _, h := range wants {
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			t, ok := o.(*object.Tag)
+			if !ok {
+				break
+			}
+
+			if o, err = t.Object(); err != nil {
+				return nil, err
+			}
+		}
+
+		if c, ok := o.(*object.Commit); ok {
+			commits = append(commits, c)
+		}
+	}
+
+	return commits, nil
+}
+
+// deepenCommits walks the history of the given commits down to the given
+// depth, the commits found at the last level become shallow.
+func deepenCommits(from []*object.Commit, depth int) (
+	reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+
+	return walkDepth(from, 1, depth, nil)
+}
+
+// deepenRelative deepens the current shallow boundary of the client by the
+// given depth. The history not behind the client shallow commits is walked
+// without any limit.
+func deepenRelative(
+	from []*object.Commit,
+	clientShallows map[plumbing.Hash]bool,
+	depth int,
+) (reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+	reached = make(map[plumbing.Hash]*object.Commit)
+	var boundary []*object.Commit
+	err = walkHistory(from, func(c *object.Commit) (bool, error) {
+		reached[c.Hash] = c
+		if clientShallows[c.Hash] {
+			boundary = append(boundary, c)
+			return false, nil
+		}
+
+		return true, nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deepened, shallows, err := walkDepth(boundary, 0, depth, reached)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for h, c := range deepened {
+		reached[h] = c
+	}
+
+	return reached, shallows, nil
+}
+
+// walkDepth walks the history of the given commits in breadth-first order,
+// starting at the given level. The commits found at the maximum level become
+// shallow, unless they are root commits.
+func walkDepth(from []*object.Commit, level, max int, seen map[plumbing.Hash]*object.Commit) (
+	reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+
+	reached = make(map[plumbing.Hash]*object.Commit)
+	shallows = make(map[plumbing.Hash]*object.Commit)
+
+	current := from
+	for ; len(current) > 0; level++ {
+		var next []*object.Commit
+		for _, c := range current {
+			if _, ok := reached[c.Hash]; ok {
+				continue
+			}
+
+			reached[c.Hash] = c
+			if level >= max {
+				if c.NumParents() > 0 {
+					shallows[c.Hash] = c
+				}
+
+				continue
+			}
+
+			err := c.Parents().ForEach(func(p *object.Commit) error {
+				if _, ok := seen[p.Hash]; !ok {
+					next = append(next, p)
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		current = next
+	}
+
+	return reached, shallows, nil
+}
+
+// deepenSince walks the history of the given commits down to the commits
+// older than the given time. The commits with any older parent become
+// shallow.
+func deepenSince(from []*object.Commit, since time.Time) (
+	reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+
+	return deepenUntil(from, func(c *object.Commit) bool {
+		return c.Committer.When.Before(since)
+	})
+}
+
+// deepenNot walks the history of the given commits down to the commits
+// reachable from any of the given references. The commits with any parent
+// reachable from them become shallow.
+func deepenNot(s storer.Storer, from []*object.Commit, names []string) (
+	reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+
+	var hashes []plumbing.Hash
+	for _, name := range names {
+		ref, err := resolveShortReference(s, name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hashes = append(hashes, ref.Hash())
+	}
+
+	exclude, err := wantedCommits(s, hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	err = walkHistory(exclude, func(c *object.Commit) (bool, error) {
+		excluded[c.Hash] = true
+		return true, nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deepenUntil(from, func(c *object.Commit) bool {
+		return excluded[c.Hash]
+	})
+}
+
+// deepenUntil walks the history of the given commits, stopping at the commits
+// for which the given function returns true. The given commits are always
+// reached, the commits with any parent not reached become shallow.
+func deepenUntil(from []*object.Commit, stop func(*object.Commit) bool) (
+	reached, shallows map[plumbing.Hash]*object.Commit, err error) {
+
+	reached = make(map[plumbing.Hash]*object.Commit)
+	shallows = make(map[plumbing.Hash]*object.Commit)
+
+	err = walkHistory(from, func(c *object.Commit) (bool, error) {
+		reached[c.Hash] = c
+
+		var parents []*object.Commit
+		err := c.Parents().ForEach(func(p *object.Commit) error {
+			parents = append(parents, p)
+			return nil
+		})
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, p := range parents {
+			if stop(p) {
+				shallows[c.Hash] = c
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reached, shallows, nil
+}
+
+// walkHistory walks the history of the given commits, visiting every commit
+// once. The parents of a commit are only walked if the given function returns
+// true.
+func walkHistory(from []*object.Commit, cb func(*object.Commit) (bool, error)) error {
+	seen := make(map[plumbing.Hash]bool)
+	stack := append([]*object.Commit(nil), from...)
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if seen[c.Hash] {
+			continue
+		}
+
+		seen[c.Hash] = true
+		walk, err := cb(c)
+		if err != nil {
+			return err
+		}
+
+		if !walk {
+			continue
+		}
+
+		err = c.Parents().ForEach(func(p *object.Commit) error {
+			stack = append(stack, p)
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveShortReference resolves a reference given by its full or short
+// name, following the same rules as git.
+func resolveShortReference(s storer.ReferenceStorer, name string) (*plumbing.Reference, error) {
+	ref, err := storer.ResolveReference(s, plumbing.ReferenceName(name))
+	if err != plumbing.ErrReferenceNotFound {
+		return ref, err
+	}
+
+	for _, rule := range plumbing.RefRevParseRules {
+		ref, err = storer.ResolveReference(s, plumbing.ReferenceName(fmt.Sprintf(rule, name)))
+		if err != plumbing.ErrReferenceNotFound {
+			return ref, err
+		}
+	}
+
+	return nil, plumbing.ErrReferenceNotFound
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/archive"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// ErrMissingTreeish is returned when an upload-archive request does not
+// name the tree to archive.
+var ErrMissingTreeish = errors.New("upload-archive: tree-ish required")
+
+// archiveFormats are the formats accepted by the --format option of
+// upload-archive requests.
+var archiveFormats = map[string]archive.Format{
+	"tar":    archive.Tar,
+	"tar.gz": archive.TarGzip,
+	"tgz":    archive.TarGzip,
+	"zip":    archive.Zip,
+}
+
+func (s *server) NewUploadArchiveSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadArchiveSession, error) {
+	sto, err := s.loader.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.handler.NewUploadArchiveSession(sto)
+}
+
+func (h *handler) NewUploadArchiveSession(s storer.Storer) (transport.UploadArchiveSession, error) {
+	return &uaSession{
+		session: session{storer: s, asClient: h.asClient},
+	}, nil
+}
+
+type uaSession struct {
+	session
+}
+
+// UploadArchive returns the archive requested by the arguments of req. As
+// git does by default, only the trees of references can be archived.
+func (s *uaSession) UploadArchive(ctx context.Context, req *packp.UploadArchiveRequest) (io.ReadCloser, error) {
+	o, treeish, err := parseArchiveArgs(req.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := s.resolveTreeish(treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, commit, err := archive.ResolveTree(s.storer, h)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Commit = commit
+	pr, pw := io.Pipe()
+	go func() {
+		w := ioutil.NewContextWriter(ctx, pw)
+		pw.CloseWithError(archive.NewEncoder(w, o).Encode(tree))
+	}()
+
+	return pr, nil
+}
+
+// parseArchiveArgs parses the arguments of git-archive: the options, the
+// tree-ish and the paths.
+func parseArchiveArgs(args []string) (*archive.Options, string, error) {
+	o := &archive.Options{Format: archive.Tar}
+	options := true
+	var treeish string
+	for _, arg := range args {
+		switch {
+		case !options || !strings.HasPrefix(arg, "-"):
+			if treeish == "" {
+				treeish = arg
+			} else {
+				o.Paths = append(o.Paths, arg)
+			}
+		case arg == "--":
+			options = false
+		case strings.HasPrefix(arg, "--format="):
+			f, ok := archiveFormats[strings.TrimPrefix(arg, "--format=")]
+			if !ok {
+				return nil, "", fmt.Errorf("unknown archive format: %s", arg[len("--format="):])
+			}
+
+			o.Format = f
+		case strings.HasPrefix(arg, "--prefix="):
+			o.Prefix = strings.TrimPrefix(arg, "--prefix=")
+		case arg == "-v", arg == "--verbose", isCompressionLevel(arg):
+		default:
+			return nil, "", fmt.Errorf("unsupported option: %s", arg)
+		}
+	}
+
+	if treeish == "" {
+		return nil, "", ErrMissingTreeish
+	}
+
+	return o, treeish, nil
+}
+
+func isCompressionLevel(arg string) bool {
+	return len(arg) == 2 && arg[1] >= '0' && arg[1] <= '9'
+}
+
+// resolveTreeish returns the hash of the reference with the given name, or
+// the given hash if it is the one of a reference.
+func (s *uaSession) resolveTreeish(name string) (plumbing.Hash, error) {
+	for _, n := range []string{name, "refs/" + name, "refs/tags/" + name,
+		"refs/heads/" + name, "refs/remotes/" + name} {
+		ref, err := storer.ResolveReference(s.storer, plumbing.ReferenceName(n))
+		if err == nil {
+			return ref.Hash(), nil
+		}
+
+		if err != plumbing.ErrReferenceNotFound {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if _, err := hex.DecodeString(name); err == nil && len(name) == 40 {
+		h := plumbing.NewHash(name)
+		if ok, err := s.isReferenced(h); ok || err != nil {
+			return h, err
+		}
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("no such ref: %s", name)
+}
+
+// isReferenced returns true if a reference points to the given object,
+// directly or through an annotated tag.
+func (s *uaSession) isReferenced(h plumbing.Hash) (bool, error) {
+	refs, err := s.storer.IterReferences()
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		if ref.Hash() == h {
+			found = true
+			return storer.ErrStop
+		}
+
+		if tag, err := object.GetTag(s.storer, ref.Hash()); err == nil && tag.Target == h {
+			found = true
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+
+	return found, err
+}
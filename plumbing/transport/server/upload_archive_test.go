@@ -0,0 +1,117 @@
+package server_test
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type UploadArchiveSuite struct {
+	fixtures.Suite
+	session transport.UploadArchiveSession
+}
+
+var _ = Suite(&UploadArchiveSuite{})
+
+func (s *UploadArchiveSuite) SetUpTest(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	ep, err := transport.NewEndpoint(fs.Root())
+	c.Assert(err, IsNil)
+
+	loader := server.MapLoader{
+		ep.String(): filesystem.NewStorage(fs, cache.NewObjectLRUDefault()),
+	}
+
+	srv, ok := server.NewServer(loader).(transport.UploadArchiveTransport)
+	c.Assert(ok, Equals, true)
+
+	s.session, err = srv.NewUploadArchiveSession(ep, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *UploadArchiveSuite) uploadArchive(c *C, args ...string) ([]string, string, error) {
+	r, err := s.session.UploadArchive(context.Background(),
+		&packp.UploadArchiveRequest{Args: args})
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer r.Close()
+
+	var names []string
+	var comment string
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return names, comment, nil
+		}
+
+		c.Assert(err, IsNil)
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			comment = h.PAXRecords["comment"]
+			continue
+		}
+
+		names = append(names, h.Name)
+	}
+}
+
+func (s *UploadArchiveSuite) TestUploadArchive(c *C) {
+	names, comment, err := s.uploadArchive(c, "--format=tar", "--prefix=basic/", "-9",
+		"master", "go", "vendor")
+	c.Assert(err, IsNil)
+	c.Assert(comment, Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(names, DeepEquals, []string{
+		"basic/",
+		"basic/go/",
+		"basic/go/example.go",
+		"basic/vendor/",
+		"basic/vendor/foo.go",
+	})
+}
+
+func (s *UploadArchiveSuite) TestUploadArchiveReferencedHash(c *C) {
+	names, _, err := s.uploadArchive(c, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(err, IsNil)
+	c.Assert(names, HasLen, 13)
+}
+
+func (s *UploadArchiveSuite) TestUploadArchiveUnreferencedHash(c *C) {
+	_, _, err := s.uploadArchive(c, "918c48b83bd081e863dbe1b80f8998f058cd8294")
+	c.Assert(err, ErrorMatches, "no such ref: 918c48b83bd081e863dbe1b80f8998f058cd8294")
+}
+
+func (s *UploadArchiveSuite) TestUploadArchiveInvalidArguments(c *C) {
+	_, _, err := s.uploadArchive(c, "--format=tar")
+	c.Assert(err, Equals, server.ErrMissingTreeish)
+
+	_, _, err = s.uploadArchive(c, "--format=rar", "HEAD")
+	c.Assert(err, ErrorMatches, "unknown archive format: rar")
+
+	_, _, err = s.uploadArchive(c, "--exec=sh", "HEAD")
+	c.Assert(err, ErrorMatches, "unsupported option: --exec=sh")
+
+	_, _, err = s.uploadArchive(c, "missing")
+	c.Assert(err, ErrorMatches, "no such ref: missing")
+}
+
+func (s *UploadArchiveSuite) TestUploadArchiveMissingPath(c *C) {
+	r, err := s.session.UploadArchive(context.Background(),
+		&packp.UploadArchiveRequest{Args: []string{"HEAD", "missing"}})
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, ErrorMatches, ".*path not found: missing")
+}
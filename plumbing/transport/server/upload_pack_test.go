@@ -1,7 +1,15 @@
 package server_test
 
 import (
+	"context"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -48,3 +56,137 @@ func (s *ClientLikeUploadPackSuite) SetUpSuite(c *C) {
 func (s *ClientLikeUploadPackSuite) TestAdvertisedReferencesEmpty(c *C) {
 	s.UploadPackSuite.TestAdvertisedReferencesEmpty(c)
 }
+
+func (s *UploadPackSuite) TestAdvertisedReferencesShallowCapabilities(c *C) {
+	r, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	info, err := r.AdvertisedReferences()
+	c.Assert(err, IsNil)
+	c.Assert(info.Capabilities.Supports(capability.Shallow), Equals, true)
+	c.Assert(info.Capabilities.Supports(capability.DeepenSince), Equals, true)
+	c.Assert(info.Capabilities.Supports(capability.DeepenNot), Equals, true)
+	c.Assert(info.Capabilities.Supports(capability.DeepenRelative), Equals, true)
+	c.Assert(info.Capabilities.Supports(capability.Filter), Equals, true)
+}
+
+func (s *UploadPackSuite) TestUploadPackDepth(c *C) {
+	req := s.newShallowRequest(capability.Shallow)
+	req.Depth = packp.DepthCommits(1)
+
+	s.testUploadPackShallow(c, req,
+		[]string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}, nil, 15)
+
+	req = s.newShallowRequest(capability.Shallow)
+	req.Depth = packp.DepthCommits(3)
+
+	s.testUploadPackShallow(c, req,
+		[]string{"af2d6a6954d532f8ffb47615169c8fdf9d383a1a"}, nil, 19)
+}
+
+func (s *UploadPackSuite) TestUploadPackDepthWholeHistory(c *C) {
+	req := s.newShallowRequest(capability.Shallow)
+	req.Depth = packp.DepthCommits(100)
+
+	s.testUploadPackShallow(c, req, nil, nil, 28)
+}
+
+func (s *UploadPackSuite) TestUploadPackDeepenSince(c *C) {
+	req := s.newShallowRequest(capability.Shallow, capability.DeepenSince)
+	req.Depth = packp.DepthSince(time.Unix(1427802711, 0))
+
+	s.testUploadPackShallow(c, req,
+		[]string{"af2d6a6954d532f8ffb47615169c8fdf9d383a1a"}, nil, 19)
+}
+
+func (s *UploadPackSuite) TestUploadPackDeepenNot(c *C) {
+	req := s.newShallowRequest(capability.Shallow, capability.DeepenNot)
+	req.Depth = packp.DepthReference("branch")
+
+	s.testUploadPackShallow(c, req,
+		[]string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}, nil, 15)
+}
+
+func (s *UploadPackSuite) TestUploadPackDeepenRelative(c *C) {
+	req := s.newShallowRequest(capability.Shallow, capability.DeepenRelative)
+	req.Shallows = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	req.Haves = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	req.Depth = packp.DepthCommits(1)
+
+	s.testUploadPackShallow(c, req,
+		[]string{"918c48b83bd081e863dbe1b80f8998f058cd8294"},
+		[]string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}, 2)
+}
+
+func (s *UploadPackSuite) TestUploadPackFilter(c *C) {
+	for _, t := range []struct {
+		filter  packp.Filter
+		objects int
+	}{
+		{packp.FilterBlobNone(), 19},
+		{packp.FilterBlobLimit(1024), 23},
+		{packp.FilterTreeDepth(0), 8},
+		{packp.FilterTreeDepth(1), 15},
+		{packp.FilterTreeDepth(2), 23},
+	} {
+		req := s.newShallowRequest(capability.Filter)
+		req.Filter = t.filter
+
+		s.testUploadPackShallow(c, req, nil, nil, t.objects)
+	}
+}
+
+func (s *UploadPackSuite) TestUploadPackFilterWantedBlob(c *C) {
+	req := s.newShallowRequest(capability.Filter)
+	req.Wants = []plumbing.Hash{plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88")}
+	req.Filter = packp.FilterBlobNone()
+
+	s.testUploadPackShallow(c, req, nil, nil, 1)
+}
+
+func (s *UploadPackSuite) TestUploadPackFilterUnsupported(c *C) {
+	r, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	req := s.newShallowRequest(capability.Filter)
+	req.Filter = packp.Filter("sparse:path=foo")
+
+	_, err = r.UploadPack(context.Background(), req)
+	c.Assert(err, ErrorMatches, "unsupported filter.*")
+}
+
+func (s *UploadPackSuite) newShallowRequest(caps ...capability.Capability) *packp.UploadPackRequest {
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	for _, cap := range caps {
+		req.Capabilities.Set(cap)
+	}
+
+	return req
+}
+
+func (s *UploadPackSuite) testUploadPackShallow(c *C, req *packp.UploadPackRequest,
+	shallows, unshallows []string, objects int) {
+
+	r, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(r.Close(), IsNil) }()
+
+	resp, err := r.UploadPack(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Shallows, HasLen, len(shallows))
+	for i, h := range shallows {
+		c.Assert(resp.Shallows[i].String(), Equals, h)
+	}
+
+	c.Assert(resp.Unshallows, HasLen, len(unshallows))
+	for i, h := range unshallows {
+		c.Assert(resp.Unshallows[i].String(), Equals, h)
+	}
+
+	storage := memory.NewStorage()
+	c.Assert(packfile.UpdateObjectStorage(storage, resp), IsNil)
+	c.Assert(storage.Objects, HasLen, objects)
+}
@@ -4,7 +4,6 @@ package ssh
 import (
 	"fmt"
 	"reflect"
-	"strconv"
 
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
@@ -26,7 +25,7 @@ type sshConfig interface {
 
 // NewClient creates a new SSH client with an optional *ssh.ClientConfig.
 func NewClient(config *ssh.ClientConfig) transport.Transport {
-	return common.NewClient(&runner{config: config})
+	return common.NewClient(&runner{config: config, pool: newClientPool()})
 }
 
 // DefaultAuthBuilder is the function used to create a default AuthMethod, when
@@ -39,10 +38,11 @@ const DefaultPort = 22
 
 type runner struct {
 	config *ssh.ClientConfig
+	pool   *clientPool
 }
 
 func (r *runner) Command(cmd string, ep *transport.Endpoint, auth transport.AuthMethod) (common.Command, error) {
-	c := &command{command: cmd, endpoint: ep, config: r.config}
+	c := &command{command: cmd, endpoint: ep, config: r.config, pool: r.pool}
 	if auth != nil {
 		c.setAuth(auth)
 	}
@@ -58,9 +58,10 @@ type command struct {
 	connected bool
 	command   string
 	endpoint  *transport.Endpoint
-	client    *ssh.Client
+	client    *pooledClient
 	auth      AuthMethod
 	config    *ssh.ClientConfig
+	pool      *clientPool
 }
 
 func (c *command) setAuth(auth transport.AuthMethod) error {
@@ -77,7 +78,8 @@ func (c *command) Start() error {
 	return c.Session.Start(endpointToCommand(c.command, c.endpoint))
 }
 
-// Close closes the SSH session and connection.
+// Close closes the SSH session, and the connection unless it is shared with
+// other sessions, see DefaultIdleTimeout.
 func (c *command) Close() error {
 	if !c.connected {
 		return nil
@@ -89,93 +91,139 @@ func (c *command) Close() error {
 	//     closed.
 	_ = c.Session.Close()
 
-	return c.client.Close()
+	return c.client.release()
 }
 
 // connect connects to the SSH server, unless a AuthMethod was set with
 // SetAuth method, by default uses an auth method based on PublicKeysCallback,
 // it connects to a SSH agent, using the address stored in the SSH_AUTH_SOCK
 // environment var.
+//
+// The ssh_config of the host is honored: Hostname, Port, User, IdentityFile
+// and IdentitiesOnly, ProxyJump, ProxyCommand, ServerAliveInterval and
+// ServerAliveCountMax. StrictHostKeyChecking and UserKnownHostsFile apply to
+// the auth methods built by the transport, when no AuthMethod is given, or to
+// the ones given without HostKeyCallback.
 func (c *command) connect() error {
 	if c.connected {
 		return transport.ErrAlreadyConnected
 	}
 
+	hc := newHostConfigFromEndpoint(c.endpoint)
+	given := c.auth
 	if c.auth == nil {
-		if err := c.setAuthFromEndpoint(); err != nil {
+		if err := c.setAuthFromEndpoint(hc); err != nil {
 			return err
 		}
 	}
 
-	var err error
-	config, err := c.auth.ClientConfig()
+	config, err := c.clientConfig(hc, given == nil)
 	if err != nil {
 		return err
 	}
 
 	overrideConfig(c.config, config)
 
-	c.client, err = ssh.Dial("tcp", c.getHostWithPort(), config)
-	if err != nil {
-		return err
+	dialer := func() (*ssh.Client, error) {
+		return dial(hc, config)
 	}
 
-	c.Session, err = c.client.NewSession()
-	if err != nil {
-		_ = c.client.Close()
-		return err
+	if c.pool == nil || !poolable(given) {
+		c.pool = newClientPool()
+	}
+
+	key := poolKey{
+		addr:  hc.address(),
+		user:  config.User,
+		proxy: hc.proxyJump + "\x00" + hc.proxyCommand,
+		auth:  given,
+	}
+
+	for retry := true; ; retry = false {
+		c.client, err = c.pool.get(key, dialer)
+		if err != nil {
+			return err
+		}
+
+		c.Session, err = c.client.NewSession()
+		if err == nil {
+			break
+		}
+
+		// the shared connection may have been closed by the server
+		c.client.discard()
+		if !retry {
+			return err
+		}
 	}
 
 	c.connected = true
 	return nil
 }
 
-func (c *command) getHostWithPort() string {
-	if addr, found := c.doGetHostWithPortFromSSHConfig(); found {
-		return addr
+// clientConfig returns the ssh.ClientConfig of the AuthMethod, with the host
+// key policy of the ssh_config if it has no HostKeyCallback. The AuthMethod
+// given by the user is left untouched.
+func (c *command) clientConfig(hc *hostConfig, built bool) (*ssh.ClientConfig, error) {
+	if built {
+		if err := setHostKeyPolicy(c.auth, hc); err != nil {
+			return nil, err
+		}
+
+		return c.auth.ClientConfig()
 	}
 
-	host := c.endpoint.Host
-	port := c.endpoint.Port
-	if port <= 0 {
-		port = DefaultPort
+	h, ok := c.auth.(hostKeyCallbackHelper)
+	if !ok || h.helper().HostKeyCallback != nil {
+		return c.auth.ClientConfig()
 	}
 
-	return fmt.Sprintf("%s:%d", host, port)
-}
+	cb, err := hostKeyCallback(hc)
+	if err != nil || cb == nil {
+		if err != nil {
+			return nil, err
+		}
 
-func (c *command) doGetHostWithPortFromSSHConfig() (addr string, found bool) {
-	if DefaultSSHConfig == nil {
-		return
+		return c.auth.ClientConfig()
 	}
 
-	host := c.endpoint.Host
-	port := c.endpoint.Port
-
-	configHost := DefaultSSHConfig.Get(c.endpoint.Host, "Hostname")
-	if configHost != "" {
-		host = configHost
-		found = true
+	// the callback is set on a copy, the AuthMethod may be shared by
+	// concurrent sessions to other hosts.
+	auth, ok := copyAuthMethod(c.auth)
+	if !ok {
+		return c.auth.ClientConfig()
 	}
 
-	if !found {
-		return
+	auth.(hostKeyCallbackHelper).helper().HostKeyCallback = cb
+	return auth.ClientConfig()
+}
+
+// copyAuthMethod returns a shallow copy of an AuthMethod that is a pointer
+// to a struct, as the ones of this package.
+func copyAuthMethod(a AuthMethod) (AuthMethod, bool) {
+	v := reflect.ValueOf(a)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, false
 	}
 
-	configPort := DefaultSSHConfig.Get(c.endpoint.Host, "Port")
-	if configPort != "" {
-		if i, err := strconv.Atoi(configPort); err == nil {
-			port = i
-		}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	auth, ok := cp.Interface().(AuthMethod)
+	if !ok {
+		return nil, false
 	}
 
-	addr = fmt.Sprintf("%s:%d", host, port)
-	return
+	_, ok = auth.(hostKeyCallbackHelper)
+	return auth, ok
+}
+
+func (c *command) getHostWithPort() string {
+	return newHostConfigFromEndpoint(c.endpoint).address()
 }
 
-func (c *command) setAuthFromEndpoint() error {
+func (c *command) setAuthFromEndpoint(hc *hostConfig) error {
 	var err error
-	c.auth, err = DefaultAuthBuilder(c.endpoint.User)
+	c.auth, err = authFromConfig(hc)
 	return err
 }
 
@@ -0,0 +1,233 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/mitchellh/go-homedir"
+)
+
+// hostConfig are the settings of the ssh_config applying to a host.
+type hostConfig struct {
+	// alias is the host name given by the user, matched against the Host
+	// patterns of the ssh_config.
+	alias    string
+	hostname string
+	port     int
+	user     string
+
+	identityFiles  []string
+	identitiesOnly bool
+
+	proxyCommand string
+	proxyJump    string
+
+	strictHostKeyChecking string
+	userKnownHostsFiles   []string
+
+	serverAliveInterval time.Duration
+	serverAliveCountMax int
+}
+
+// newHostConfig returns the settings of the given host, with the port and
+// user given, if any, overriding the ones of the ssh_config.
+func newHostConfig(alias string, port int, user string) *hostConfig {
+	c := &hostConfig{
+		alias:               alias,
+		hostname:            alias,
+		port:                port,
+		user:                user,
+		serverAliveCountMax: 3,
+	}
+
+	if DefaultSSHConfig == nil {
+		return c
+	}
+
+	// as before the other options were supported, the port of the
+	// ssh_config only applies to the hosts with a Hostname
+	if h := c.get("Hostname"); h != "" {
+		c.hostname = h
+		if p, err := strconv.Atoi(c.get("Port")); err == nil && p > 0 {
+			c.port = p
+		}
+	}
+
+	if c.user == "" {
+		c.user = c.get("User")
+	}
+
+	if f := c.get("IdentityFile"); f != "" {
+		c.identityFiles = []string{f}
+	}
+
+	c.identitiesOnly = c.get("IdentitiesOnly") == "yes"
+	c.proxyCommand = c.get("ProxyCommand")
+	c.proxyJump = c.get("ProxyJump")
+	if c.proxyCommand == "none" {
+		c.proxyCommand = ""
+	}
+
+	if c.proxyJump == "none" {
+		c.proxyJump = ""
+	}
+
+	c.strictHostKeyChecking = strings.ToLower(c.get("StrictHostKeyChecking"))
+	c.userKnownHostsFiles = strings.Fields(c.get("UserKnownHostsFile"))
+
+	if i, err := strconv.Atoi(c.get("ServerAliveInterval")); err == nil && i > 0 {
+		c.serverAliveInterval = time.Duration(i) * time.Second
+	}
+
+	if n, err := strconv.Atoi(c.get("ServerAliveCountMax")); err == nil && n > 0 {
+		c.serverAliveCountMax = n
+	}
+
+	return c
+}
+
+func newHostConfigFromEndpoint(ep *transport.Endpoint) *hostConfig {
+	return newHostConfig(ep.Host, ep.Port, ep.User)
+}
+
+// get returns the value of the given key for the host, or an empty string if
+// it is not set or set to its default value.
+func (c *hostConfig) get(key string) string {
+	v := DefaultSSHConfig.Get(c.alias, key)
+	if v == ssh_config.Default(key) {
+		return ""
+	}
+
+	return v
+}
+
+// address returns the address to connect to, host:port.
+func (c *hostConfig) address() string {
+	port := c.port
+	if port <= 0 {
+		port = DefaultPort
+	}
+
+	return net.JoinHostPort(c.hostname, strconv.Itoa(port))
+}
+
+// expand replaces the tokens of ssh_config values: ~ at the beginning, and
+// %h, %p, %r, %n, %d, %u and %%.
+func (c *hostConfig) expand(v string) string {
+	home, _ := homedir.Dir()
+	if strings.HasPrefix(v, "~/") {
+		v = home + v[1:]
+	}
+
+	local, _ := username()
+	port := c.port
+	if port <= 0 {
+		port = DefaultPort
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '%' || i == len(v)-1 {
+			buf.WriteByte(v[i])
+			continue
+		}
+
+		i++
+		switch v[i] {
+		case 'h':
+			buf.WriteString(c.hostname)
+		case 'p':
+			buf.WriteString(strconv.Itoa(port))
+		case 'r':
+			buf.WriteString(c.user)
+		case 'n':
+			buf.WriteString(c.alias)
+		case 'd':
+			buf.WriteString(home)
+		case 'u':
+			buf.WriteString(local)
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(v[i])
+		}
+	}
+
+	return buf.String()
+}
+
+// jumpHosts returns the settings of the hosts of ProxyJump, in the order they
+// are connected to. Their ProxyJump and ProxyCommand options are ignored.
+func (c *hostConfig) jumpHosts() ([]*hostConfig, error) {
+	if c.proxyJump == "" {
+		return nil, nil
+	}
+
+	var hosts []*hostConfig
+	for _, jump := range strings.Split(c.proxyJump, ",") {
+		alias, port, user, err := parseJumpHost(strings.TrimSpace(jump))
+		if err != nil {
+			return nil, err
+		}
+
+		h := newHostConfig(alias, port, user)
+		h.proxyJump, h.proxyCommand = "", ""
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// parseJumpHost parses a ProxyJump host, [user@]host[:port] or
+// ssh://[user@]host[:port].
+func parseJumpHost(s string) (host string, port int, user string, err error) {
+	s = strings.TrimPrefix(s, "ssh://")
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		user, s = s[:i], s[i+1:]
+	}
+
+	host = s
+	if h, p, splitErr := net.SplitHostPort(s); splitErr == nil {
+		host = h
+		if port, err = strconv.Atoi(p); err != nil {
+			return "", 0, "", fmt.Errorf("invalid ProxyJump port: %q", p)
+		}
+	}
+
+	if host == "" {
+		return "", 0, "", fmt.Errorf("invalid ProxyJump host: %q", s)
+	}
+
+	return host, port, user, nil
+}
+
+// knownHostsFiles returns the expanded UserKnownHostsFile paths.
+func (c *hostConfig) knownHostsFiles() []string {
+	var files []string
+	for _, f := range c.userKnownHostsFiles {
+		files = append(files, c.expand(f))
+	}
+
+	return files
+}
+
+// identityFilePaths returns the expanded IdentityFile paths which exist.
+func (c *hostConfig) identityFilePaths() []string {
+	var files []string
+	for _, f := range c.identityFiles {
+		p := c.expand(f)
+		if _, err := os.Stat(p); err == nil {
+			files = append(files, p)
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/mitchellh/go-homedir"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+type HostConfigSuite struct{}
+
+var _ = Suite(&HostConfigSuite{})
+
+func (s *HostConfigSuite) TearDownTest(c *C) {
+	DefaultSSHConfig = ssh_config.DefaultUserSettings
+}
+
+func (s *HostConfigSuite) TestNewHostConfig(c *C) {
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"prod": {
+			"Hostname":              "git.internal",
+			"Port":                  "2222",
+			"User":                  "deploy",
+			"IdentityFile":          "~/.ssh/prod",
+			"IdentitiesOnly":        "yes",
+			"ProxyJump":             "bastion",
+			"StrictHostKeyChecking": "accept-new",
+			"UserKnownHostsFile":    "/tmp/a /tmp/b",
+			"ServerAliveInterval":   "30",
+			"ServerAliveCountMax":   "5",
+		},
+	}}
+
+	ep, err := transport.NewEndpoint("ssh://prod/foo/bar.git")
+	c.Assert(err, IsNil)
+
+	hc := newHostConfigFromEndpoint(ep)
+	c.Assert(hc.address(), Equals, "git.internal:2222")
+	c.Assert(hc.user, Equals, "deploy")
+	c.Assert(hc.identityFiles, DeepEquals, []string{"~/.ssh/prod"})
+	c.Assert(hc.identitiesOnly, Equals, true)
+	c.Assert(hc.proxyJump, Equals, "bastion")
+	c.Assert(hc.strictHostKeyChecking, Equals, "accept-new")
+	c.Assert(hc.knownHostsFiles(), DeepEquals, []string{"/tmp/a", "/tmp/b"})
+	c.Assert(hc.serverAliveInterval, Equals, 30*time.Second)
+	c.Assert(hc.serverAliveCountMax, Equals, 5)
+}
+
+func (s *HostConfigSuite) TestNewHostConfigEndpointUser(c *C) {
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"github.com": {"User": "deploy"},
+	}}
+
+	ep, err := transport.NewEndpoint("git@github.com:foo/bar.git")
+	c.Assert(err, IsNil)
+
+	c.Assert(newHostConfigFromEndpoint(ep).user, Equals, "git")
+}
+
+func (s *HostConfigSuite) TestNewHostConfigDefaults(c *C) {
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"github.com": {
+			"IdentityFile":          ssh_config.Default("IdentityFile"),
+			"StrictHostKeyChecking": ssh_config.Default("StrictHostKeyChecking"),
+			"UserKnownHostsFile":    ssh_config.Default("UserKnownHostsFile"),
+			"ProxyCommand":          "none",
+		},
+	}}
+
+	hc := newHostConfig("github.com", 0, "")
+	c.Assert(hc.address(), Equals, "github.com:22")
+	c.Assert(hc.identityFiles, HasLen, 0)
+	c.Assert(hc.strictHostKeyChecking, Equals, "")
+	c.Assert(hc.userKnownHostsFiles, HasLen, 0)
+	c.Assert(hc.proxyCommand, Equals, "")
+	c.Assert(hc.serverAliveInterval, Equals, time.Duration(0))
+}
+
+func (s *HostConfigSuite) TestExpand(c *C) {
+	home, err := homedir.Dir()
+	c.Assert(err, IsNil)
+
+	hc := &hostConfig{alias: "prod", hostname: "git.internal", port: 2222, user: "deploy"}
+	c.Assert(hc.expand("~/.ssh/%n_%r"), Equals, home+"/.ssh/prod_deploy")
+	c.Assert(hc.expand("nc %h %p 100%%"), Equals, "nc git.internal 2222 100%")
+	c.Assert(hc.expand("%d/%x%"), Equals, home+"/%x%")
+}
+
+func (s *HostConfigSuite) TestParseJumpHost(c *C) {
+	for _, t := range []struct {
+		jump string
+		host string
+		port int
+		user string
+	}{
+		{"bastion", "bastion", 0, ""},
+		{"admin@bastion:2222", "bastion", 2222, "admin"},
+		{"ssh://admin@bastion:2222", "bastion", 2222, "admin"},
+		{"[::1]:22", "::1", 22, ""},
+	} {
+		host, port, user, err := parseJumpHost(t.jump)
+		c.Assert(err, IsNil)
+		c.Assert(host, Equals, t.host, Commentf("%s", t.jump))
+		c.Assert(port, Equals, t.port, Commentf("%s", t.jump))
+		c.Assert(user, Equals, t.user, Commentf("%s", t.jump))
+	}
+
+	_, _, _, err := parseJumpHost("admin@bastion:foo")
+	c.Assert(err, NotNil)
+}
+
+func (s *HostConfigSuite) TestJumpHosts(c *C) {
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"first": {
+			"Hostname":  "first.internal",
+			"Port":      "2200",
+			"ProxyJump": "ignored",
+		},
+	}}
+
+	hc := &hostConfig{proxyJump: "first, admin@second:2201"}
+	jumps, err := hc.jumpHosts()
+	c.Assert(err, IsNil)
+	c.Assert(jumps, HasLen, 2)
+	c.Assert(jumps[0].address(), Equals, "first.internal:2200")
+	c.Assert(jumps[0].proxyJump, Equals, "")
+	c.Assert(jumps[1].address(), Equals, "second:2201")
+	c.Assert(jumps[1].user, Equals, "admin")
+}
+
+func (s *HostConfigSuite) TestIdentityFilePaths(c *C) {
+	f, err := ioutil.TempFile("", "go-git-identity")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	defer os.Remove(f.Name())
+
+	hc := &hostConfig{identityFiles: []string{f.Name(), "/non-existent/key"}}
+	c.Assert(hc.identityFilePaths(), DeepEquals, []string{f.Name()})
+}
@@ -0,0 +1,580 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xanzy/ssh-agent"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultIdleTimeout is the time a connection is kept open once its last
+// session is closed, to be reused by the following sessions to the same
+// host, with the same user and AuthMethod. If 0, the connections are only
+// shared by concurrent sessions.
+var DefaultIdleTimeout time.Duration
+
+// ErrNoIdentities is returned when no key of the IdentityFile options of the
+// ssh_config can be used, and IdentitiesOnly forbids the use of the agent.
+var ErrNoIdentities = errors.New("no usable IdentityFile found")
+
+// authFromConfig returns the AuthMethod of the given host built from its
+// ssh_config: the keys of its IdentityFile options, along with the ones of
+// the agent unless IdentitiesOnly is set. If no IdentityFile is set,
+// DefaultAuthBuilder is used.
+func authFromConfig(c *hostConfig) (AuthMethod, error) {
+	files := c.identityFilePaths()
+	if len(files) == 0 {
+		if len(c.identityFiles) != 0 && c.identitiesOnly {
+			return nil, ErrNoIdentities
+		}
+
+		return DefaultAuthBuilder(c.user)
+	}
+
+	var signers []ssh.Signer
+	for _, f := range files {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		// encrypted keys can only be used through the agent
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			continue
+		}
+
+		signers = append(signers, signer)
+	}
+
+	if len(signers) == 0 && c.identitiesOnly {
+		return nil, ErrNoIdentities
+	}
+
+	user := c.user
+	if user == "" {
+		var err error
+		if user, err = username(); err != nil {
+			return nil, err
+		}
+	}
+
+	identitiesOnly := c.identitiesOnly
+	return &PublicKeysCallback{
+		User: user,
+		Callback: func() ([]ssh.Signer, error) {
+			if identitiesOnly {
+				return signers, nil
+			}
+
+			a, _, err := sshagent.New()
+			if err != nil {
+				return signers, nil
+			}
+
+			agentSigners, err := a.Signers()
+			if err != nil {
+				return signers, nil
+			}
+
+			return append(append([]ssh.Signer{}, signers...), agentSigners...), nil
+		},
+	}, nil
+}
+
+type hostKeyCallbackHelper interface {
+	helper() *HostKeyCallbackHelper
+}
+
+func (m *HostKeyCallbackHelper) helper() *HostKeyCallbackHelper {
+	return m
+}
+
+// setHostKeyPolicy sets the HostKeyCallback of an AuthMethod built by the
+// transport, if not set yet, from the StrictHostKeyChecking and
+// UserKnownHostsFile options of the ssh_config.
+func setHostKeyPolicy(auth AuthMethod, c *hostConfig) error {
+	h, ok := auth.(hostKeyCallbackHelper)
+	if !ok || h.helper().HostKeyCallback != nil {
+		return nil
+	}
+
+	cb, err := hostKeyCallback(c)
+	if err != nil || cb == nil {
+		return err
+	}
+
+	h.helper().HostKeyCallback = cb
+	return nil
+}
+
+// hostKeyCallback returns the callback verifying the host keys as configured
+// in the ssh_config, or nil if it has no options about it:
+// StrictHostKeyChecking no or off accepts any key, accept-new adds the keys
+// of the unknown hosts to the first known hosts file, and yes or ask only
+// accepts the known keys, of the UserKnownHostsFile files if set.
+func hostKeyCallback(c *hostConfig) (ssh.HostKeyCallback, error) {
+	policy := c.strictHostKeyChecking
+	files := c.knownHostsFiles()
+	if policy == "" && len(files) == 0 {
+		return nil, nil
+	}
+
+	switch policy {
+	case "no", "off":
+		return ssh.InsecureIgnoreHostKey(), nil
+	case "accept-new":
+		if len(files) == 0 {
+			var err error
+			if files, err = getDefaultKnownHostsFiles(); err != nil {
+				return nil, err
+			}
+		}
+
+		return acceptNewHostKeyCallback(files)
+	}
+
+	return NewKnownHostsCallback(files...)
+}
+
+// acceptNewHostKeyCallback returns a callback checking the host keys against
+// the given known hosts files, and adding the ones of unknown hosts to the
+// first file.
+func acceptNewHostKeyCallback(files []string) (ssh.HostKeyCallback, error) {
+	target := files[0]
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Close()
+
+	existing, err := filterKnownHostsFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		err := known(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok || len(keyErr.Want) != 0 {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+
+		if known, err = knownhosts.New(existing...); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil
+}
+
+// dial connects to the host, through its ProxyJump hosts or its
+// ProxyCommand if any, and starts the keepalives.
+func dial(c *hostConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	jumps, err := c.jumpHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	var client *ssh.Client
+	if len(jumps) != 0 {
+		client, err = dialJump(jumps, c, config)
+	} else if c.proxyCommand != "" {
+		client, err = dialProxyCommand(c, config)
+	} else {
+		client, err = ssh.Dial("tcp", c.address(), config)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	keepAlive(client, c.serverAliveInterval, c.serverAliveCountMax)
+	return client, nil
+}
+
+// dialJump connects to the first jump host, and then to each of the
+// following hosts, and finally to the target host, through the previous one.
+func dialJump(jumps []*hostConfig, target *hostConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var client *ssh.Client
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			_ = clients[i].Close()
+		}
+	}
+
+	hops := append(append([]*hostConfig{}, jumps...), target)
+	for i, hop := range hops {
+		hopConfig := config
+		if i < len(jumps) {
+			auth, err := authFromConfig(hop)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+
+			if err := setHostKeyPolicy(auth, hop); err != nil {
+				closeAll()
+				return nil, err
+			}
+
+			if hopConfig, err = auth.ClientConfig(); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+
+		var err error
+		if client == nil {
+			client, err = ssh.Dial("tcp", hop.address(), hopConfig)
+		} else {
+			client, err = dialThrough(client, hop.address(), hopConfig)
+		}
+
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("connecting to %s: %s", hop.address(), err)
+		}
+
+		clients = append(clients, client)
+	}
+
+	// the jump connections are closed along with the target one
+	go func() {
+		_ = client.Wait()
+		closeAll()
+	}()
+
+	return client, nil
+}
+
+func dialThrough(proxy *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := proxy.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialProxyCommand runs the ProxyCommand of the host, and connects through
+// its standard input and output.
+func dialProxyCommand(c *hostConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	cmd := exec.Command("sh", "-c", c.expand(c.proxyCommand))
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// the standard error is read from a pipe, not to wait for the commands
+	// started by the ProxyCommand, holding it, on Close
+	errPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	stderr := &stderrBuffer{}
+	go io.Copy(stderr, errPipe)
+
+	conn := &proxyCommandConn{cmd: cmd, r: stdout, w: stdin, addr: c.address()}
+	client, chans, reqs, err := ssh.NewClientConn(conn, c.address(), config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ProxyCommand %q: %s: %s", c.proxyCommand, err, stderr)
+	}
+
+	return ssh.NewClient(client, chans, reqs), nil
+}
+
+// proxyCommandConn is a net.Conn over the standard input and output of a
+// ProxyCommand.
+type proxyCommandConn struct {
+	cmd  *exec.Cmd
+	r    io.ReadCloser
+	w    io.WriteCloser
+	addr string
+	once sync.Once
+}
+
+func (c *proxyCommandConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *proxyCommandConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c *proxyCommandConn) Close() error {
+	c.once.Do(func() {
+		_ = c.w.Close()
+		_ = c.r.Close()
+		if c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+		}
+
+		_ = c.cmd.Wait()
+	})
+
+	return nil
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr                { return proxyAddr("proxy-command") }
+func (c *proxyCommandConn) RemoteAddr() net.Addr               { return proxyAddr(c.addr) }
+func (c *proxyCommandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *proxyCommandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *proxyCommandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type proxyAddr string
+
+// stderrBuffer holds the standard error of a ProxyCommand.
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
+
+func (a proxyAddr) Network() string { return "proxy-command" }
+func (a proxyAddr) String() string  { return string(a) }
+
+// keepAlive sends a keepalive request every interval, closing the client
+// after count requests without reply, as the ServerAliveInterval and
+// ServerAliveCountMax options do.
+func keepAlive(client *ssh.Client, interval time.Duration, count int) {
+	if interval <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+	}()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		missed := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+
+			replied := make(chan error, 1)
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				replied <- err
+			}()
+
+			select {
+			case <-done:
+				return
+			case err := <-replied:
+				if err != nil {
+					_ = client.Close()
+					return
+				}
+
+				missed = 0
+			case <-time.After(interval):
+				missed++
+				if missed >= count {
+					_ = client.Close()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// clientPool shares the connections between the sessions to the same host,
+// with the same user and AuthMethod.
+type clientPool struct {
+	sync.Mutex
+	clients map[poolKey]*pooledClient
+}
+
+type poolKey struct {
+	addr  string
+	user  string
+	proxy string
+	auth  AuthMethod
+}
+
+type pooledClient struct {
+	*ssh.Client
+	pool  *clientPool
+	key   poolKey
+	refs  int
+	timer *time.Timer
+}
+
+func newClientPool() *clientPool {
+	return &clientPool{clients: make(map[poolKey]*pooledClient)}
+}
+
+// poolable returns true if the AuthMethod can be part of a pool key: nil, for
+// the auth methods built by the transport, or a comparable value.
+func poolable(auth AuthMethod) bool {
+	return auth == nil || reflect.TypeOf(auth).Comparable()
+}
+
+// get returns a pooled client for the key, connecting with the dial function
+// if there is none.
+func (p *clientPool) get(key poolKey, dial func() (*ssh.Client, error)) (*pooledClient, error) {
+	p.Lock()
+	if c, ok := p.clients[key]; ok {
+		if c.timer != nil {
+			c.timer.Stop()
+			c.timer = nil
+		}
+
+		c.refs++
+		p.Unlock()
+		return c, nil
+	}
+
+	p.Unlock()
+
+	client, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &pooledClient{Client: client, pool: p, key: key, refs: 1}
+
+	p.Lock()
+	defer p.Unlock()
+	if existing, ok := p.clients[key]; ok {
+		// connected concurrently, keep the first one
+		_ = client.Close()
+		existing.refs++
+		return existing, nil
+	}
+
+	p.clients[key] = c
+	go func() {
+		_ = client.Wait()
+		p.remove(c)
+	}()
+
+	return c, nil
+}
+
+// remove removes the client from the pool, if it was not replaced already.
+func (p *clientPool) remove(c *pooledClient) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.clients[c.key] == c {
+		delete(p.clients, c.key)
+	}
+}
+
+// release releases a reference to the client, which is closed when unused
+// after DefaultIdleTimeout.
+func (c *pooledClient) release() error {
+	c.pool.Lock()
+	defer c.pool.Unlock()
+
+	c.refs--
+	if c.refs > 0 {
+		return nil
+	}
+
+	if DefaultIdleTimeout <= 0 {
+		if c.pool.clients[c.key] == c {
+			delete(c.pool.clients, c.key)
+		}
+
+		return c.Client.Close()
+	}
+
+	c.timer = time.AfterFunc(DefaultIdleTimeout, func() {
+		c.pool.Lock()
+		if c.refs > 0 {
+			c.pool.Unlock()
+			return
+		}
+
+		if c.pool.clients[c.key] == c {
+			delete(c.pool.clients, c.key)
+		}
+
+		c.pool.Unlock()
+		_ = c.Client.Close()
+	})
+
+	return nil
+}
+
+// discard closes the client and removes it from the pool, when it cannot be
+// used anymore.
+func (c *pooledClient) discard() {
+	c.pool.remove(c)
+	_ = c.Client.Close()
+}
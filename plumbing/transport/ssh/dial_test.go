@@ -0,0 +1,408 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/kevinburke/ssh_config"
+	stdssh "golang.org/x/crypto/ssh"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+type ConnectSuite struct {
+	dir         string
+	servers     []*ssh.Server
+	config      *mockSSHConfig
+	authBuilder func(string) (AuthMethod, error)
+
+	mu        sync.Mutex
+	users     []string
+	forwarded []string
+}
+
+var _ = Suite(&ConnectSuite{})
+
+func (s *ConnectSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "go-git-ssh-connect")
+	c.Assert(err, IsNil)
+
+	s.users, s.forwarded, s.servers = nil, nil, nil
+	s.config = &mockSSHConfig{map[string]map[string]string{}}
+	DefaultSSHConfig = s.config
+
+	s.authBuilder = DefaultAuthBuilder
+	DefaultAuthBuilder = func(user string) (AuthMethod, error) {
+		return &Password{User: user}, nil
+	}
+}
+
+func (s *ConnectSuite) TearDownTest(c *C) {
+	DefaultSSHConfig = ssh_config.DefaultUserSettings
+	DefaultAuthBuilder = s.authBuilder
+	DefaultIdleTimeout = 0
+
+	for _, srv := range s.servers {
+		srv.Close()
+	}
+
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+// startServer starts a server replying to every command with the user and
+// the command, allowing port forwarding.
+func (s *ConnectSuite) startServer(c *C, srv *ssh.Server) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	srv.Handler = func(session ssh.Session) {
+		s.mu.Lock()
+		s.users = append(s.users, session.User())
+		s.mu.Unlock()
+
+		fmt.Fprintf(session, "%s: %s", session.User(), strings.Join(session.Command(), " "))
+	}
+
+	srv.LocalPortForwardingCallback = func(ctx ssh.Context, host string, port uint32) bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.forwarded = append(s.forwarded, fmt.Sprintf("%s:%d", host, port))
+		return true
+	}
+
+	s.servers = append(s.servers, srv)
+	go srv.Serve(l)
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *ConnectSuite) setHost(alias string, values map[string]string) {
+	s.config.Values[alias] = values
+}
+
+func (s *ConnectSuite) run(c *C, r *runner, url string, auth transport.AuthMethod) (string, *command) {
+	ep, err := transport.NewEndpoint(url)
+	c.Assert(err, IsNil)
+
+	cmd, err := r.Command("git-upload-pack", ep, auth)
+	c.Assert(err, IsNil)
+
+	out, err := cmd.StdoutPipe()
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Start(), IsNil)
+
+	content, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+
+	return string(content), cmd.(*command)
+}
+
+func newRunner() *runner {
+	return &runner{pool: newClientPool()}
+}
+
+func insecureAuth(user string) *Password {
+	return &Password{
+		User:                  user,
+		HostKeyCallbackHelper: HostKeyCallbackHelper{HostKeyCallback: stdssh.InsecureIgnoreHostKey()},
+	}
+}
+
+func (s *ConnectSuite) TestUserAndHostFromConfig(c *C) {
+	port := s.startServer(c, &ssh.Server{})
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"User":                  "alice",
+		"StrictHostKeyChecking": "no",
+	})
+
+	out, cmd := s.run(c, newRunner(), "ssh://target/foo.git", nil)
+	c.Assert(out, Equals, "alice: git-upload-pack /foo.git")
+	c.Assert(cmd.Close(), IsNil)
+}
+
+func (s *ConnectSuite) TestHostKeyPolicyAuthUntouched(c *C) {
+	port := s.startServer(c, &ssh.Server{})
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"StrictHostKeyChecking": "no",
+	})
+
+	auth := &Password{User: "git"}
+	out, cmd := s.run(c, newRunner(), "ssh://git@target/foo.git", auth)
+	c.Assert(out, Equals, "git: git-upload-pack /foo.git")
+	c.Assert(cmd.Close(), IsNil)
+	c.Assert(auth.HostKeyCallback, IsNil)
+}
+
+func (s *ConnectSuite) TestProxyJump(c *C) {
+	bastion := s.startServer(c, &ssh.Server{})
+	target := s.startServer(c, &ssh.Server{})
+
+	s.setHost("bastion", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(bastion),
+		"StrictHostKeyChecking": "no",
+	})
+	s.setHost("target", map[string]string{
+		"Hostname":  "127.0.0.1",
+		"Port":      fmt.Sprint(target),
+		"ProxyJump": "jumper@bastion",
+	})
+
+	out, cmd := s.run(c, newRunner(), "ssh://git@target/foo.git", insecureAuth("git"))
+	c.Assert(out, Equals, "git: git-upload-pack /foo.git")
+	c.Assert(cmd.Close(), IsNil)
+
+	c.Assert(s.forwarded, DeepEquals, []string{fmt.Sprintf("127.0.0.1:%d", target)})
+}
+
+func (s *ConnectSuite) TestProxyCommand(c *C) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		c.Skip("bash is required")
+	}
+
+	port := s.startServer(c, &ssh.Server{})
+	s.setHost("target", map[string]string{
+		"Hostname":     "127.0.0.1",
+		"Port":         fmt.Sprint(port),
+		"ProxyCommand": `bash -c 'exec 3<>/dev/tcp/%h/%p; cat <&3 & exec cat >&3'`,
+	})
+
+	out, cmd := s.run(c, newRunner(), "ssh://git@target/foo.git", insecureAuth("git"))
+	c.Assert(out, Equals, "git: git-upload-pack /foo.git")
+	c.Assert(cmd.Close(), IsNil)
+	c.Assert(s.forwarded, HasLen, 0)
+}
+
+func (s *ConnectSuite) TestIdentityFile(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(s.dir, "id_rsa")
+	c.Assert(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600), IsNil)
+
+	signer, err := stdssh.NewSignerFromKey(key)
+	c.Assert(err, IsNil)
+
+	port := s.startServer(c, &ssh.Server{
+		PublicKeyHandler: func(ctx ssh.Context, k ssh.PublicKey) bool {
+			return ssh.KeysEqual(k, signer.PublicKey())
+		},
+	})
+
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"IdentityFile":          path,
+		"IdentitiesOnly":        "yes",
+		"StrictHostKeyChecking": "no",
+	})
+
+	out, cmd := s.run(c, newRunner(), "ssh://git@target/foo.git", nil)
+	c.Assert(out, Equals, "git: git-upload-pack /foo.git")
+	c.Assert(cmd.Close(), IsNil)
+
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"IdentityFile":          filepath.Join(s.dir, "missing"),
+		"IdentitiesOnly":        "yes",
+		"StrictHostKeyChecking": "no",
+	})
+
+	ep, err := transport.NewEndpoint("ssh://git@target/foo.git")
+	c.Assert(err, IsNil)
+
+	_, err = newRunner().Command("git-upload-pack", ep, nil)
+	c.Assert(err, Equals, ErrNoIdentities)
+}
+
+func (s *ConnectSuite) TestAcceptNewHostKey(c *C) {
+	port := s.startServer(c, &ssh.Server{})
+	knownHosts := filepath.Join(s.dir, "known_hosts")
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"StrictHostKeyChecking": "accept-new",
+		"UserKnownHostsFile":    knownHosts,
+	})
+
+	_, cmd := s.run(c, newRunner(), "ssh://git@target/foo.git", nil)
+	c.Assert(cmd.Close(), IsNil)
+
+	content, err := ioutil.ReadFile(knownHosts)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, fmt.Sprintf(`\[127.0.0.1\]:%d ssh-rsa .*\n`, port))
+
+	_, cmd = s.run(c, newRunner(), "ssh://git@target/foo.git", nil)
+	c.Assert(cmd.Close(), IsNil)
+
+	after, err := ioutil.ReadFile(knownHosts)
+	c.Assert(err, IsNil)
+	c.Assert(string(after), Equals, string(content))
+}
+
+func (s *ConnectSuite) TestStrictHostKeyChecking(c *C) {
+	port := s.startServer(c, &ssh.Server{})
+	knownHosts := filepath.Join(s.dir, "known_hosts")
+	c.Assert(ioutil.WriteFile(knownHosts, nil, 0600), IsNil)
+
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"StrictHostKeyChecking": "yes",
+		"UserKnownHostsFile":    knownHosts,
+	})
+
+	ep, err := transport.NewEndpoint("ssh://git@target/foo.git")
+	c.Assert(err, IsNil)
+
+	_, err = newRunner().Command("git-upload-pack", ep, nil)
+	c.Assert(err, ErrorMatches, ".*key is unknown.*")
+
+	// the policy applies to the given auth methods without callback, which
+	// are left untouched
+	auth := &Password{User: "git"}
+	_, err = newRunner().Command("git-upload-pack", ep, auth)
+	c.Assert(err, ErrorMatches, ".*key is unknown.*")
+	c.Assert(auth.HostKeyCallback, IsNil)
+}
+
+func (s *ConnectSuite) TestClientReuse(c *C) {
+	port := s.startServer(c, &ssh.Server{})
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"StrictHostKeyChecking": "no",
+	})
+
+	r := newRunner()
+	_, first := s.run(c, r, "ssh://git@target/foo.git", nil)
+	_, second := s.run(c, r, "ssh://git@target/bar.git", nil)
+	c.Assert(first.client == second.client, Equals, true)
+
+	c.Assert(first.Close(), IsNil)
+	c.Assert(second.Close(), IsNil)
+	c.Assert(r.pool.clients, HasLen, 0)
+
+	DefaultIdleTimeout = time.Minute
+	_, first = s.run(c, r, "ssh://git@target/foo.git", nil)
+	c.Assert(first.Close(), IsNil)
+
+	_, second = s.run(c, r, "ssh://git@target/foo.git", nil)
+	c.Assert(first.client == second.client, Equals, true)
+
+	_, other := s.run(c, r, "ssh://other@target/foo.git", nil)
+	c.Assert(other.client == second.client, Equals, false)
+
+	c.Assert(second.Close(), IsNil)
+	c.Assert(other.Close(), IsNil)
+}
+
+func (s *ConnectSuite) TestClientReuseAfterServerClose(c *C) {
+	srv := &ssh.Server{}
+	port := s.startServer(c, srv)
+	s.setHost("target", map[string]string{
+		"Hostname":              "127.0.0.1",
+		"Port":                  fmt.Sprint(port),
+		"StrictHostKeyChecking": "no",
+	})
+
+	DefaultIdleTimeout = time.Minute
+	r := newRunner()
+	_, first := s.run(c, r, "ssh://git@target/foo.git", nil)
+	c.Assert(first.Close(), IsNil)
+
+	// the pooled connection is dropped by the server, a new one is made
+	_ = first.client.Client.Conn.Close()
+
+	out, second := s.run(c, r, "ssh://git@target/foo.git", nil)
+	c.Assert(out, Equals, "git: git-upload-pack /foo.git")
+	c.Assert(second.client == first.client, Equals, false)
+	c.Assert(second.Close(), IsNil)
+}
+
+func (s *ConnectSuite) TestKeepAlive(c *C) {
+	requests := make(chan string, 10)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		signer, _ := stdssh.NewSignerFromKey(mustKey())
+		config := &stdssh.ServerConfig{NoClientAuth: true}
+		config.AddHostKey(signer)
+
+		_, _, reqs, err := stdssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+
+		for req := range reqs {
+			requests <- req.Type
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		}
+	}()
+
+	hc := &hostConfig{
+		alias:               "127.0.0.1",
+		hostname:            "127.0.0.1",
+		port:                l.Addr().(*net.TCPAddr).Port,
+		serverAliveInterval: 10 * time.Millisecond,
+		serverAliveCountMax: 3,
+	}
+
+	client, err := dial(hc, &stdssh.ClientConfig{
+		User:            "git",
+		HostKeyCallback: stdssh.InsecureIgnoreHostKey(),
+	})
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	select {
+	case req := <-requests:
+		c.Assert(req, Equals, "keepalive@openssh.com")
+	case <-time.After(5 * time.Second):
+		c.Fatal("no keepalive received")
+	}
+}
+
+func mustKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+var _ io.Closer = (*proxyCommandConn)(nil)
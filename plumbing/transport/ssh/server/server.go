@@ -0,0 +1,356 @@
+// Package server implements an SSH server serving git repositories, running
+// the git-upload-pack and git-receive-pack exec requests of the clients
+// against the repositories of a Loader.
+//
+// It can be used to host repositories with no git installation:
+//
+//	loader := server.NewFilesystemLoader(osfs.New("/srv/git"))
+//	s := sshserver.NewServer(loader)
+//	s.PublicKeyCallback = func(ctx ssh.Context, key ssh.PublicKey) bool {
+//		return isAuthorized(ctx.User(), key)
+//	}
+//	log.Fatal(s.ListenAndServe(":2222"))
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/internal/common"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+)
+
+// exitCodeError is the exit status of a request that failed, as git uses.
+const exitCodeError = 128
+
+var (
+	// ErrUnsupportedCommand is returned when the command of an exec request is
+	// not git-upload-pack or git-receive-pack with a single path argument.
+	ErrUnsupportedCommand = errors.New("unsupported command")
+	// ErrServerConfigChanged is returned by Serve when PublicKeyCallback,
+	// HostSigners or IdleTimeout were changed after the first call to Serve.
+	ErrServerConfigChanged = errors.New("server configuration changed after Serve")
+
+	errInvalidPath = errors.New("invalid repository path")
+)
+
+// Server is an SSH server serving the repositories of a Loader. The path of
+// every exec request is mapped to a repository through the loader, relative
+// paths as relative to the root of the loader, the endpoint given to the
+// loader uses the ssh protocol, the user of the client and the address of
+// the server.
+//
+// PublicKeyCallback, HostSigners and IdleTimeout are read once, by the first
+// call to Serve, and must not be changed afterwards.
+type Server struct {
+	// PublicKeyCallback, if set, authenticates the clients by their public
+	// key, the clients are accepted if it returns true. If nil, the clients
+	// are accepted without authentication.
+	PublicKeyCallback ssh.PublicKeyHandler
+	// Authorize, if set, is called before serving every request, with the
+	// session, the repository endpoint and the service requested,
+	// git-upload-pack or git-receive-pack. If it returns an error the
+	// request is refused. If nil, only git-upload-pack is allowed.
+	Authorize func(s ssh.Session, ep *transport.Endpoint, service string) error
+	// HostSigners are the private keys of the host, a new ECDSA key is
+	// generated if empty.
+	HostSigners []ssh.Signer
+	// IdleTimeout closes the connections with no activity for the given
+	// time. Zero means no timeout.
+	IdleTimeout time.Duration
+	// ErrorLog, if set, logs the errors serving requests.
+	ErrorLog *log.Logger
+
+	loader    gitserver.Loader
+	transport transport.Transport
+
+	repos   common.RepositoryLocks
+	mu      sync.Mutex
+	srv     *ssh.Server
+	signers []ssh.Signer
+}
+
+// NewServer returns a Server serving the repositories of the given loader.
+func NewServer(loader gitserver.Loader) *Server {
+	return NewServerWithHooks(loader, nil)
+}
+
+// NewServerWithHooks returns a Server serving the repositories of the given
+// loader, like NewServer, calling the given hooks on every push.
+func NewServerWithHooks(loader gitserver.Loader, hooks *gitserver.Hooks) *Server {
+	return &Server{
+		loader:    loader,
+		transport: gitserver.NewServerWithHooks(loader, hooks),
+	}
+}
+
+// ListenAndServe listens on the given TCP address and serves the incoming
+// connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts the incoming connections of the given listener. Serve always
+// returns a non-nil error, after Close it returns ssh.ErrServerClosed. It
+// returns ErrServerConfigChanged if the configuration of the server was
+// changed since a previous call.
+func (s *Server) Serve(l net.Listener) error {
+	srv, err := s.server()
+	if err != nil {
+		return err
+	}
+
+	if s.changed(srv) {
+		return ErrServerConfigChanged
+	}
+
+	return srv.Serve(l)
+}
+
+// Close closes the listeners and the active connections of the server.
+func (s *Server) Close() error {
+	srv, err := s.server()
+	if err != nil {
+		return err
+	}
+
+	return srv.Close()
+}
+
+func (s *Server) server() (*ssh.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.srv != nil {
+		return s.srv, nil
+	}
+
+	s.signers = append([]ssh.Signer(nil), s.HostSigners...)
+	signers := s.HostSigners
+	if len(signers) == 0 {
+		signer, err := generateHostSigner()
+		if err != nil {
+			return nil, err
+		}
+
+		signers = []ssh.Signer{signer}
+	}
+
+	s.srv = &ssh.Server{
+		Handler:          s.Handle,
+		HostSigners:      signers,
+		PublicKeyHandler: s.PublicKeyCallback,
+		IdleTimeout:      s.IdleTimeout,
+	}
+
+	return s.srv, nil
+}
+
+// changed returns true if the fields of the Server read to build the given
+// ssh.Server were changed since.
+func (s *Server) changed(srv *ssh.Server) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.IdleTimeout != srv.IdleTimeout ||
+		funcPointer(s.PublicKeyCallback) != funcPointer(srv.PublicKeyHandler) ||
+		len(s.HostSigners) != len(s.signers) {
+		return true
+	}
+
+	for i, signer := range s.HostSigners {
+		if signer != s.signers[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func funcPointer(fn ssh.PublicKeyHandler) uintptr {
+	if fn == nil {
+		return 0
+	}
+
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// generateHostSigner generates an ECDSA host key, the RSA keys generated by
+// ssh.Server are signed with SHA-1, refused by the recent OpenSSH clients.
+func generateHostSigner() (ssh.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return gossh.NewSignerFromKey(key)
+}
+
+// Handle serves the exec request of the given session, it is a ssh.Handler
+// that can be used with any ssh.Server. The errors are sent to the client
+// through the stderr of the session, exiting with a non-zero status.
+func (s *Server) Handle(sess ssh.Session) {
+	err := s.handle(sess)
+	if err == nil {
+		return
+	}
+
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf("%s: %q: %s", sess.RemoteAddr(), sess.Command(), err)
+	}
+
+	fmt.Fprintf(sess.Stderr(), "fatal: %s\n", err)
+	sess.Exit(exitCodeError)
+}
+
+func (s *Server) handle(sess ssh.Session) error {
+	service, p, err := parseCommand(sess.Command())
+	if err != nil {
+		return err
+	}
+
+	ep, err := endpoint(sess, p)
+	if err != nil {
+		return err
+	}
+
+	if err := s.authorize(sess, ep, service); err != nil {
+		return err
+	}
+
+	cmd := common.ServerCommand{
+		Stdin:  sess,
+		Stdout: ioutil.WriteNopCloser(sess),
+		Stderr: sess.Stderr(),
+	}
+
+	write := service == transport.ReceivePackServiceName
+	defer s.repos.Lock(ep, write)()
+
+	if !write {
+		return s.serveUploadPack(sess.Context(), cmd, ep)
+	}
+
+	// a push is completed even if the client disconnects without waiting
+	// for the report status, as git does.
+	return s.serveReceivePack(context.Background(), cmd, ep)
+}
+
+func (s *Server) authorize(sess ssh.Session, ep *transport.Endpoint, service string) error {
+	if s.Authorize != nil {
+		return s.Authorize(sess, ep, service)
+	}
+
+	if service == transport.ReceivePackServiceName {
+		return fmt.Errorf("%s is not allowed", service)
+	}
+
+	return nil
+}
+
+func (s *Server) serveUploadPack(ctx context.Context, cmd common.ServerCommand,
+	ep *transport.Endpoint) (err error) {
+
+	sto, err := s.loader.Load(ep)
+	if err != nil {
+		return repositoryError(ep, err)
+	}
+
+	sess, err := s.transport.NewUploadPackSession(ep, nil)
+	if err != nil {
+		return repositoryError(ep, err)
+	}
+
+	defer ioutil.CheckClose(sess, &err)
+
+	return common.ServeStatefulUploadPack(ctx, cmd, sess, sto)
+}
+
+func (s *Server) serveReceivePack(ctx context.Context, cmd common.ServerCommand,
+	ep *transport.Endpoint) (err error) {
+
+	sess, err := s.transport.NewReceivePackSession(ep, nil)
+	if err != nil {
+		return repositoryError(ep, err)
+	}
+
+	defer ioutil.CheckClose(sess, &err)
+
+	return common.ServeStatefulReceivePack(ctx, cmd, sess)
+}
+
+// repositoryError returns the error sent to the client when the repository
+// cannot be loaded, using the message of git for missing repositories.
+func repositoryError(ep *transport.Endpoint, err error) error {
+	if err == transport.ErrRepositoryNotFound {
+		return fmt.Errorf("'%s' does not appear to be a git repository", ep.Path)
+	}
+
+	return err
+}
+
+// parseCommand returns the service and the repository path of the command of
+// an exec request, such as git-upload-pack '/repository.git'.
+func parseCommand(args []string) (service, p string, err error) {
+	if len(args) == 3 && args[0] == "git" {
+		args = []string{"git-" + args[1], args[2]}
+	}
+
+	if len(args) != 2 {
+		return "", "", ErrUnsupportedCommand
+	}
+
+	switch args[0] {
+	case transport.UploadPackServiceName, transport.ReceivePackServiceName:
+		return args[0], args[1], nil
+	}
+
+	return "", "", ErrUnsupportedCommand
+}
+
+func endpoint(sess ssh.Session, p string) (*transport.Endpoint, error) {
+	p = "/" + strings.TrimPrefix(strings.TrimPrefix(p, "~"), "/")
+	if path.Clean(p) != p {
+		return nil, errInvalidPath
+	}
+
+	ep := &transport.Endpoint{
+		Protocol: "ssh",
+		User:     sess.User(),
+		Path:     p,
+	}
+
+	host, port, err := net.SplitHostPort(sess.LocalAddr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	ep.Host = host
+	ep.Port, err = strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep, nil
+}
@@ -0,0 +1,304 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitserver "gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh/server"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/test"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	"github.com/gliderlabs/ssh"
+	stdssh "golang.org/x/crypto/ssh"
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BaseSuite struct {
+	fixtures.Suite
+
+	loader   gitserver.MapLoader
+	server   *server.Server
+	listener net.Listener
+	addr     string
+}
+
+func (s *BaseSuite) SetUpTest(c *C) {
+	s.loader = gitserver.MapLoader{}
+	s.server = server.NewServer(s.loader)
+	s.server.Authorize = func(ssh.Session, *transport.Endpoint, string) error {
+		return nil
+	}
+
+	var err error
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.addr = s.listener.Addr().String()
+}
+
+// serve starts serving the connections, once the server is configured.
+func (s *BaseSuite) serve(c *C) {
+	go s.server.Serve(s.listener)
+}
+
+func (s *BaseSuite) TearDownTest(c *C) {
+	c.Assert(s.server.Close(), IsNil)
+}
+
+func (s *BaseSuite) newEndpoint(c *C, name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("ssh://git@%s/%s", s.addr, name))
+	c.Assert(err, IsNil)
+
+	return ep
+}
+
+func (s *BaseSuite) prepareRepository(c *C, f *fixtures.Fixture, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	return ep
+}
+
+func (s *BaseSuite) prepareEmptyRepository(c *C, name string) *transport.Endpoint {
+	ep := s.newEndpoint(c, name)
+	s.loader[ep.String()] = memory.NewStorage()
+	return ep
+}
+
+func emptyAuth() transport.AuthMethod {
+	a := &gitssh.Password{User: "git"}
+	a.HostKeyCallback = stdssh.InsecureIgnoreHostKey()
+	return a
+}
+
+type UploadPackSuite struct {
+	test.UploadPackSuite
+	BaseSuite
+}
+
+var _ = Suite(&UploadPackSuite{})
+
+func (s *UploadPackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.serve(c)
+	s.UploadPackSuite.Client = gitssh.DefaultClient
+	s.UploadPackSuite.EmptyAuth = emptyAuth()
+	s.UploadPackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.UploadPackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.UploadPackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type ReceivePackSuite struct {
+	test.ReceivePackSuite
+	BaseSuite
+}
+
+var _ = Suite(&ReceivePackSuite{})
+
+func (s *ReceivePackSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.serve(c)
+	s.ReceivePackSuite.Client = gitssh.DefaultClient
+	s.ReceivePackSuite.EmptyAuth = emptyAuth()
+	s.ReceivePackSuite.Endpoint = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+	s.ReceivePackSuite.EmptyEndpoint = s.prepareEmptyRepository(c, "empty.git")
+	s.ReceivePackSuite.NonExistentEndpoint = s.newEndpoint(c, "non-existent.git")
+}
+
+type ServerSuite struct {
+	BaseSuite
+	ep  *transport.Endpoint
+	key *ecdsa.PrivateKey
+}
+
+var _ = Suite(&ServerSuite{})
+
+func (s *ServerSuite) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+	s.ep = s.prepareRepository(c, fixtures.Basic().One(), "basic.git")
+
+	var err error
+	s.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	pub, err := stdssh.NewPublicKey(&s.key.PublicKey)
+	c.Assert(err, IsNil)
+
+	s.server.PublicKeyCallback = func(ctx ssh.Context, key ssh.PublicKey) bool {
+		return ctx.User() == "git" && ssh.KeysEqual(key, pub)
+	}
+
+	s.serve(c)
+}
+
+func (s *ServerSuite) publicKeys(c *C, key *ecdsa.PrivateKey) transport.AuthMethod {
+	signer, err := stdssh.NewSignerFromKey(key)
+	c.Assert(err, IsNil)
+
+	a := &gitssh.PublicKeys{User: "git", Signer: signer}
+	a.HostKeyCallback = stdssh.InsecureIgnoreHostKey()
+	return a
+}
+
+func (s *ServerSuite) advertisedReferences(c *C, service string, auth transport.AuthMethod) error {
+	var sess transport.Session
+	var err error
+	if service == transport.UploadPackServiceName {
+		sess, err = gitssh.DefaultClient.NewUploadPackSession(s.ep, auth)
+	} else {
+		sess, err = gitssh.DefaultClient.NewReceivePackSession(s.ep, auth)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer sess.Close()
+
+	_, err = sess.AdvertisedReferences()
+	return err
+}
+
+func (s *ServerSuite) TestPublicKey(c *C) {
+	err := s.advertisedReferences(c, transport.UploadPackServiceName, s.publicKeys(c, s.key))
+	c.Assert(err, IsNil)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	err = s.advertisedReferences(c, transport.UploadPackServiceName, s.publicKeys(c, other))
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerSuite) TestConfigChanged(c *C) {
+	err := s.advertisedReferences(c, transport.UploadPackServiceName, s.publicKeys(c, s.key))
+	c.Assert(err, IsNil)
+
+	s.server.IdleTimeout = time.Minute
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	c.Assert(s.server.Serve(l), Equals, server.ErrServerConfigChanged)
+}
+
+func (s *ServerSuite) TestAuthorize(c *C) {
+	var services []string
+	s.server.Authorize = func(sess ssh.Session, ep *transport.Endpoint, service string) error {
+		c.Assert(sess.User(), Equals, "git")
+		c.Assert(ep.String(), Equals, s.ep.String())
+		services = append(services, service)
+		return errors.New("forbidden")
+	}
+
+	err := s.advertisedReferences(c, transport.ReceivePackServiceName, s.publicKeys(c, s.key))
+	c.Assert(err, NotNil)
+	c.Assert(services, DeepEquals, []string{transport.ReceivePackServiceName})
+}
+
+func (s *ServerSuite) TestReceivePackForbiddenByDefault(c *C) {
+	s.server.Authorize = nil
+
+	auth := s.publicKeys(c, s.key)
+	err := s.advertisedReferences(c, transport.UploadPackServiceName, auth)
+	c.Assert(err, IsNil)
+
+	err = s.advertisedReferences(c, transport.ReceivePackServiceName, auth)
+	c.Assert(err, NotNil)
+}
+
+func (s *ServerSuite) exec(c *C, cmd string) (string, error) {
+	signer, err := stdssh.NewSignerFromKey(s.key)
+	c.Assert(err, IsNil)
+
+	client, err := stdssh.Dial("tcp", s.addr, &stdssh.ClientConfig{
+		User:            "git",
+		Auth:            []stdssh.AuthMethod{stdssh.PublicKeys(signer)},
+		HostKeyCallback: stdssh.InsecureIgnoreHostKey(),
+	})
+	c.Assert(err, IsNil)
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	c.Assert(err, IsNil)
+	defer sess.Close()
+
+	out, err := sess.CombinedOutput(cmd)
+	return string(out), err
+}
+
+func (s *ServerSuite) TestUnsupportedCommand(c *C) {
+	out, err := s.exec(c, "ls /")
+	c.Assert(err, NotNil)
+	c.Assert(err.(*stdssh.ExitError).ExitStatus(), Equals, 128)
+	c.Assert(out, Equals, "fatal: unsupported command\n")
+}
+
+func (s *ServerSuite) TestRepositoryNotFound(c *C) {
+	out, err := s.exec(c, "git-upload-pack '/non-existent.git'")
+	c.Assert(err, NotNil)
+	c.Assert(out, Equals, "fatal: '/non-existent.git' does not appear to be a git repository\n")
+
+	s.ep = s.newEndpoint(c, "non-existent.git")
+	err = s.advertisedReferences(c, transport.UploadPackServiceName, s.publicKeys(c, s.key))
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+}
+
+func (s *ServerSuite) TestGitClient(c *C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not found")
+	}
+
+	if _, err := exec.LookPath("ssh"); err != nil {
+		c.Skip("ssh not found")
+	}
+
+	tmp := c.MkDir()
+	der, err := x509.MarshalECPrivateKey(s.key)
+	c.Assert(err, IsNil)
+
+	key := filepath.Join(tmp, "id_ecdsa")
+	err = ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	c.Assert(err, IsNil)
+
+	dir := filepath.Join(tmp, "basic")
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Env = []string{
+			"GIT_TERMINAL_PROMPT=0",
+			"HOME=" + tmp,
+			"GIT_SSH_COMMAND=ssh -i " + key + " -o IdentitiesOnly=yes" +
+				" -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null",
+		}
+
+		out, err := cmd.CombinedOutput()
+		c.Assert(err, IsNil, Commentf("%s", out))
+	}
+
+	git("clone", "--depth", "1", s.ep.String(), dir)
+	git("-C", dir, "fetch", "--unshallow")
+	git("-C", dir, "push", "origin", "master:refs/heads/new")
+
+	sto := s.loader[s.ep.String()]
+	ref, err := sto.Reference("refs/heads/new")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
@@ -0,0 +1,272 @@
+package git
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+const (
+	coreSection                = "core"
+	extensionsSection          = "extensions"
+	repositoryFormatVersionKey = "repositoryformatversion"
+	partialCloneKey            = "partialClone"
+)
+
+// promisorStorer is the storer of a partial clone, the objects omitted by the
+// filter used to clone are fetched from the promisor remote the first time
+// they are requested.
+type promisorStorer struct {
+	storage.Storer
+	remote *Remote
+	auth   transport.AuthMethod
+}
+
+// fsPromisorStorer is the promisorStorer of a storer with a filesystem, such
+// as filesystem.Storage, whose Filesystem is exposed as well.
+type fsPromisorStorer struct {
+	*promisorStorer
+	fs billy.Filesystem
+}
+
+// Filesystem returns the filesystem of the underlying storer.
+func (s *fsPromisorStorer) Filesystem() billy.Filesystem {
+	return s.fs
+}
+
+// newPromisorStorer returns a storer that lazily fetches the missing objects
+// from the given promisor remote. If the given storer is already a promisor
+// storer only its remote is updated.
+func newPromisorStorer(s storage.Storer, c *config.RemoteConfig, auth transport.AuthMethod) storage.Storer {
+	switch ps := s.(type) {
+	case *promisorStorer:
+		s = ps.Storer
+	case *fsPromisorStorer:
+		s = ps.Storer
+	}
+
+	ps := &promisorStorer{
+		Storer: s,
+		remote: newRemote(s, c),
+		auth:   auth,
+	}
+
+	if fs, ok := s.(interface{ Filesystem() billy.Filesystem }); ok {
+		return &fsPromisorStorer{promisorStorer: ps, fs: fs.Filesystem()}
+	}
+
+	return ps
+}
+
+// SetPromisorAuth sets the credentials used to fetch the objects omitted by
+// a partial clone from its promisor remote. A repository returned by Open or
+// PlainOpen fetches them without credentials until they are set, a cloned one
+// uses the Auth of the CloneOptions. It does nothing if the repository is not
+// a partial clone.
+func (r *Repository) SetPromisorAuth(auth transport.AuthMethod) {
+	switch ps := r.Storer.(type) {
+	case *promisorStorer:
+		ps.auth = auth
+	case *fsPromisorStorer:
+		ps.auth = auth
+	}
+}
+
+// setPromisorGlobalConfig sets the system and global config scopes used to
+// fetch the missing objects, if the given storer is a promisor storer.
+func setPromisorGlobalConfig(s storage.Storer, global *format.Config) {
+	switch ps := s.(type) {
+	case *promisorStorer:
+		ps.remote.global = global
+	case *fsPromisorStorer:
+		ps.remote.global = global
+	}
+}
+
+// setPartialCloneConfig enables the partialClone extension for the given
+// promisor remote in the config of the storer, as git does cloning with a
+// filter, so git treats the omitted objects as promised by the remote.
+func setPartialCloneConfig(s storage.Storer, remote string) error {
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Raw.Section(coreSection).SetOption(repositoryFormatVersionKey, "1")
+	cfg.Raw.Section(extensionsSection).SetOption(partialCloneKey, remote)
+	return s.SetConfig(cfg)
+}
+
+// promisorRemote returns the remote of the partialClone extension, or the
+// first remote marked as promisor in the given config, nil if none.
+func promisorRemote(cfg *config.Config) *config.RemoteConfig {
+	name := cfg.Raw.Section(extensionsSection).Option(partialCloneKey)
+	if c, ok := cfg.Remotes[name]; ok {
+		return c
+	}
+
+	if c, ok := cfg.Remotes[DefaultRemoteName]; ok && c.Promisor {
+		return c
+	}
+
+	for _, c := range cfg.Remotes {
+		if c.Promisor {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// EncodedObject returns the object with the given hash, fetching it from the
+// promisor remote if it is missing.
+func (s *promisorStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.Storer.EncodedObject(t, h)
+	if err != plumbing.ErrObjectNotFound {
+		return obj, err
+	}
+
+	if err := s.fetch(h); err != nil {
+		return nil, err
+	}
+
+	return s.Storer.EncodedObject(t, h)
+}
+
+// EncodedObjectSize returns the size of the object with the given hash,
+// fetching it from the promisor remote if it is missing.
+func (s *promisorStorer) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	size, err := s.Storer.EncodedObjectSize(h)
+	if err != plumbing.ErrObjectNotFound {
+		return size, err
+	}
+
+	if err := s.fetch(h); err != nil {
+		return 0, err
+	}
+
+	return s.Storer.EncodedObjectSize(h)
+}
+
+func (s *promisorStorer) fetch(h plumbing.Hash) error {
+	err := s.remote.fetchObjects(context.Background(), []plumbing.Hash{h}, s.auth)
+	if err == transport.ErrEmptyUploadPackRequest {
+		return plumbing.ErrObjectNotFound
+	}
+
+	return err
+}
+
+// DeltaObject implements storer.DeltaObjectStorer, if the underlying storer
+// does not support delta objects the resolved object is returned.
+func (s *promisorStorer) DeltaObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if dos, ok := s.Storer.(storer.DeltaObjectStorer); ok {
+		obj, err := dos.DeltaObject(t, h)
+		if err != plumbing.ErrObjectNotFound {
+			return obj, err
+		}
+	}
+
+	return s.EncodedObject(t, h)
+}
+
+// PackfileWriter implements storer.PackfileWriter, if the underlying storer
+// does not support it the packfile is parsed into the storer.
+func (s *promisorStorer) PackfileWriter() (io.WriteCloser, error) {
+	return s.PackfileWriterWithProgress(nil)
+}
+
+// PackfileWriterWithProgress implements storer.ProgressPackfileWriter.
+func (s *promisorStorer) PackfileWriterWithProgress(h plumbing.ProgressHandler) (io.WriteCloser, error) {
+	if pw, ok := s.Storer.(storer.ProgressPackfileWriter); ok && h != nil {
+		return pw.PackfileWriterWithProgress(h)
+	}
+
+	if pw, ok := s.Storer.(storer.PackfileWriter); ok {
+		return pw.PackfileWriter()
+	}
+
+	r, w := io.Pipe()
+	pw := &parserWriter{PipeWriter: w, done: make(chan error, 1)}
+	go func() {
+		err := packfile.UpdateObjectStorageWithProgress(s.Storer, r, h)
+		r.CloseWithError(err)
+		pw.done <- err
+	}()
+
+	return pw, nil
+}
+
+// parserWriter is a PipeWriter whose Close waits for the packfile written to
+// be parsed.
+type parserWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (w *parserWriter) Close() error {
+	if err := w.PipeWriter.Close(); err != nil {
+		return err
+	}
+
+	return <-w.done
+}
+
+// ForEachObjectHash implements storer.LooseObjectStorer.
+func (s *promisorStorer) ForEachObjectHash(fn func(plumbing.Hash) error) error {
+	los, ok := s.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return ErrLooseObjectsNotSupported
+	}
+
+	return los.ForEachObjectHash(fn)
+}
+
+// LooseObjectTime implements storer.LooseObjectStorer.
+func (s *promisorStorer) LooseObjectTime(h plumbing.Hash) (time.Time, error) {
+	los, ok := s.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return time.Time{}, ErrLooseObjectsNotSupported
+	}
+
+	return los.LooseObjectTime(h)
+}
+
+// DeleteLooseObject implements storer.LooseObjectStorer.
+func (s *promisorStorer) DeleteLooseObject(h plumbing.Hash) error {
+	los, ok := s.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return ErrLooseObjectsNotSupported
+	}
+
+	return los.DeleteLooseObject(h)
+}
+
+// ObjectPacks implements storer.PackedObjectStorer.
+func (s *promisorStorer) ObjectPacks() ([]plumbing.Hash, error) {
+	pos, ok := s.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return nil, ErrPackedObjectsNotSupported
+	}
+
+	return pos.ObjectPacks()
+}
+
+// DeleteOldObjectPackAndIndex implements storer.PackedObjectStorer.
+func (s *promisorStorer) DeleteOldObjectPackAndIndex(h plumbing.Hash, t time.Time) error {
+	pos, ok := s.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	return pos.DeleteOldObjectPackAndIndex(h, t)
+}
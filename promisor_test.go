@@ -0,0 +1,167 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git-fixtures.v3"
+)
+
+type PromisorSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&PromisorSuite{})
+
+// filterRepositoryURL returns the url of a copy of the basic fixture that
+// allows partial clones.
+func (s *PromisorSuite) filterRepositoryURL(c *C) string {
+	dotgit := fixtures.Basic().One().DotGit()
+	st := filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault())
+
+	cfg, err := st.Config()
+	c.Assert(err, IsNil)
+
+	cfg.Raw.Section("uploadpack").
+		SetOption("allowFilter", "true").
+		SetOption("allowAnySHA1InWant", "true")
+
+	c.Assert(st.SetConfig(cfg), IsNil)
+	return dotgit.Root()
+}
+
+func countObjects(c *C, s storer.EncodedObjectStorer, t plumbing.ObjectType) int {
+	iter, err := s.IterEncodedObjects(t)
+	c.Assert(err, IsNil)
+
+	var n int
+	c.Assert(iter.ForEach(func(plumbing.EncodedObject) error {
+		n++
+		return nil
+	}), IsNil)
+
+	return n
+}
+
+func (s *PromisorSuite) TestCloneFilterBlobNone(c *C) {
+	st := memory.NewStorage()
+	r, err := Clone(st, nil, &CloneOptions{
+		URL:    s.filterRepositoryURL(c),
+		Filter: packp.FilterBlobNone(),
+	})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Remotes[DefaultRemoteName].Promisor, Equals, true)
+	c.Assert(cfg.Remotes[DefaultRemoteName].PartialCloneFilter, Equals, "blob:none")
+	c.Assert(cfg.Raw.Section("core").Option("repositoryformatversion"), Equals, "1")
+	c.Assert(cfg.Raw.Section("extensions").Option("partialClone"), Equals, DefaultRemoteName)
+
+	c.Assert(countObjects(c, st, plumbing.CommitObject), Equals, 9)
+	c.Assert(countObjects(c, st, plumbing.BlobObject), Equals, 0)
+
+	blob, err := r.BlobObject(plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+	c.Assert(err, IsNil)
+	c.Assert(blob.Size, Equals, int64(189))
+
+	c.Assert(countObjects(c, st, plumbing.BlobObject), Equals, 1)
+}
+
+func (s *PromisorSuite) TestCloneFilterWithCheckout(c *C) {
+	fs := memfs.New()
+	r, err := Clone(memory.NewStorage(), fs, &CloneOptions{
+		URL:    s.filterRepositoryURL(c),
+		Filter: packp.FilterTreeDepth(0),
+	})
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	fi, err := fs.Stat("CHANGELOG")
+	c.Assert(err, IsNil)
+	c.Assert(fi.Size(), Equals, int64(18))
+}
+
+func (s *PromisorSuite) TestOpenPromisor(c *C) {
+	dir := c.MkDir()
+	_, err := PlainClone(dir, true, &CloneOptions{
+		URL:    s.filterRepositoryURL(c),
+		Filter: packp.FilterBlobLimit(100),
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainOpen(dir)
+	c.Assert(err, IsNil)
+
+	fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem })
+	c.Assert(ok, Equals, true)
+	c.Assert(fs.Filesystem().Root(), Equals, dir)
+
+	blob, err := r.BlobObject(plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+	c.Assert(err, IsNil)
+	c.Assert(blob.Size, Equals, int64(189))
+}
+
+func (s *PromisorSuite) TestSetPromisorAuth(c *C) {
+	dir := c.MkDir()
+	_, err := PlainClone(dir, true, &CloneOptions{
+		URL:    s.filterRepositoryURL(c),
+		Filter: packp.FilterBlobNone(),
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainOpen(dir)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Storer.(*fsPromisorStorer).auth, IsNil)
+
+	auth := &http.BasicAuth{Username: "foo", Password: "bar"}
+	r.SetPromisorAuth(auth)
+	c.Assert(r.Storer.(*fsPromisorStorer).auth, Equals, auth)
+
+	_, err = r.BlobObject(plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+	c.Assert(err, IsNil)
+}
+
+func (s *PromisorSuite) TestCloneFilterNotSupported(c *C) {
+	_, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:    s.GetBasicLocalRepositoryURL(),
+		Filter: packp.FilterBlobNone(),
+	})
+	c.Assert(err, Equals, ErrFilterNotSupported)
+}
+
+func (s *PromisorSuite) TestPromisorStorerMissingObject(c *C) {
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:    s.filterRepositoryURL(c),
+		Filter: packp.FilterBlobNone(),
+	})
+	c.Assert(err, IsNil)
+
+	_, err = r.BlobObject(plumbing.NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, NotNil)
+}
+
+func (s *PromisorSuite) TestPromisorStorerWithoutFilesystem(c *C) {
+	st := newPromisorStorer(memory.NewStorage(), &config.RemoteConfig{Name: DefaultRemoteName}, nil)
+	_, ok := st.(interface{ Filesystem() billy.Filesystem })
+	c.Assert(ok, Equals, false)
+
+	_, err := st.EncodedObject(plumbing.AnyObject, plumbing.NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, Equals, config.ErrRemoteConfigEmptyURL)
+}
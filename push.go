@@ -0,0 +1,221 @@
+package git
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+)
+
+// PushStatus is the outcome of the update of a remote reference.
+type PushStatus int
+
+const (
+	// PushOK means the remote reference was updated.
+	PushOK PushStatus = iota
+	// PushUpToDate means the remote reference already had the pushed value.
+	PushUpToDate
+	// PushRejected means the update was not sent to the remote, e.g. because
+	// another reference of an atomic push was rejected.
+	PushRejected
+	// PushNonFastForward means the update was not sent to the remote because
+	// it is not a fast-forward and it was not forced.
+	PushNonFastForward
+	// PushStaleInfo means the update was not sent to the remote because the
+	// value of the remote reference is not the one expected by the lease.
+	PushStaleInfo
+	// PushRemoteRejected means the remote refused to update the reference.
+	PushRemoteRejected
+)
+
+func (s PushStatus) String() string {
+	switch s {
+	case PushOK:
+		return "ok"
+	case PushUpToDate:
+		return "up-to-date"
+	case PushRejected:
+		return "rejected"
+	case PushNonFastForward:
+		return "non-fast-forward"
+	case PushStaleInfo:
+		return "stale-info"
+	case PushRemoteRejected:
+		return "remote-rejected"
+	}
+
+	return fmt.Sprintf("PushStatus(%d)", int(s))
+}
+
+// PushRefResult is the result of the push of a single remote reference.
+type PushRefResult struct {
+	// Name is the name of the remote reference.
+	Name plumbing.ReferenceName
+	// Old is the value of the remote reference before the push, zero if it
+	// did not exist.
+	Old plumbing.Hash
+	// New is the pushed value, zero if the reference is being deleted.
+	New plumbing.Hash
+	// Status is the outcome of the update.
+	Status PushStatus
+	// Message explains why the update was rejected, for remote rejections
+	// it is the message sent by the server.
+	Message string
+	// URL is the URL of the remote the reference was pushed to.
+	URL string
+}
+
+// Error returns the error matching the status of the reference, nil if the
+// reference was updated or up-to-date.
+func (r *PushRefResult) Error() error {
+	switch r.Status {
+	case PushOK, PushUpToDate:
+		return nil
+	case PushNonFastForward:
+		return fmt.Errorf("non-fast-forward update: %s", r.Name)
+	case PushStaleInfo:
+		return fmt.Errorf("stale info: %s", r.Name)
+	case PushRemoteRejected:
+		return fmt.Errorf("command error on %s: %s", r.Name, r.Message)
+	}
+
+	return fmt.Errorf("rejected %s: %s", r.Name, r.Message)
+}
+
+// PushResult is the result of a push, it contains the status of every remote
+// reference matched by the pushed refspecs. When a remote has several push
+// URLs it contains the references of every URL, in the order they were
+// pushed.
+type PushResult struct {
+	Refs []*PushRefResult
+}
+
+// Ref returns the result of the given remote reference, nil if the reference
+// was not part of the push. When the push was done to several URLs, it
+// returns the result of the first one.
+func (r *PushResult) Ref(n plumbing.ReferenceName) *PushRefResult {
+	for _, ref := range r.Refs {
+		if ref.Name == n {
+			return ref
+		}
+	}
+
+	return nil
+}
+
+// Updated returns the results of the references updated in the remote.
+func (r *PushResult) Updated() []*PushRefResult {
+	var refs []*PushRefResult
+	for _, ref := range r.Refs {
+		if ref.Status == PushOK {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+// Error returns the error of the first reference that was not updated. The
+// references rejected only because the push was atomic are reported after
+// the reference that caused the rejection.
+func (r *PushResult) Error() error {
+	var rejected error
+	for _, ref := range r.Refs {
+		err := ref.Error()
+		if err == nil {
+			continue
+		}
+
+		if ref.Status != PushRejected {
+			return err
+		}
+
+		if rejected == nil {
+			rejected = err
+		}
+	}
+
+	return rejected
+}
+
+// merge appends the references of the given result, pushed to the given URL,
+// to the references of r. It returns the merged result, other if r is nil.
+func (r *PushResult) merge(other *PushResult, url string) *PushResult {
+	for _, ref := range other.Refs {
+		ref.URL = url
+	}
+
+	if r == nil {
+		return other
+	}
+
+	r.Refs = append(r.Refs, other.Refs...)
+	return r
+}
+
+func (r *PushResult) add(cmd *packp.Command, s PushStatus) *PushRefResult {
+	ref := &PushRefResult{
+		Name:   cmd.Name,
+		Old:    cmd.Old,
+		New:    cmd.New,
+		Status: s,
+	}
+
+	r.Refs = append(r.Refs, ref)
+	return ref
+}
+
+// hasRejections returns true if any reference was rejected before being sent
+// to the remote.
+func (r *PushResult) hasRejections() bool {
+	for _, ref := range r.Refs {
+		if ref.Error() != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectAll marks every reference pending to be sent to the remote as
+// rejected with the given message.
+func (r *PushResult) rejectAll(msg string) {
+	for _, ref := range r.Refs {
+		if ref.Status == PushOK {
+			ref.Status = PushRejected
+			ref.Message = msg
+		}
+	}
+}
+
+// setReportStatus updates the results of the references sent to the remote
+// with the report status returned by it. A nil report status means the
+// remote did not report any error.
+func (r *PushResult) setReportStatus(rs *packp.ReportStatus) {
+	if rs == nil {
+		return
+	}
+
+	if rs.UnpackStatus != "ok" {
+		for _, ref := range r.Refs {
+			if ref.Status == PushOK {
+				ref.Status = PushRemoteRejected
+				ref.Message = fmt.Sprintf("unpack error: %s", rs.UnpackStatus)
+			}
+		}
+	}
+
+	for _, cs := range rs.CommandStatuses {
+		if cs.Error() == nil {
+			continue
+		}
+
+		ref := r.Ref(cs.ReferenceName)
+		if ref == nil || ref.Status != PushOK {
+			continue
+		}
+
+		ref.Status = PushRemoteRejected
+		ref.Message = cs.Status
+	}
+}
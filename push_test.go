@@ -0,0 +1,55 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+
+	. "gopkg.in/check.v1"
+)
+
+type PushResultSuite struct{}
+
+var _ = Suite(&PushResultSuite{})
+
+func (s *PushResultSuite) TestSetReportStatus(c *C) {
+	r := &PushResult{}
+	r.add(&packp.Command{Name: "refs/heads/foo", New: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, PushOK)
+	r.add(&packp.Command{Name: "refs/heads/bar", New: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, PushOK)
+
+	rs := packp.NewReportStatus()
+	rs.UnpackStatus = "ok"
+	rs.CommandStatuses = []*packp.CommandStatus{
+		{ReferenceName: "refs/heads/foo", Status: "ok"},
+		{ReferenceName: "refs/heads/bar", Status: "hook declined"},
+	}
+
+	r.setReportStatus(rs)
+	c.Assert(r.Ref("refs/heads/foo").Status, Equals, PushOK)
+	c.Assert(r.Ref("refs/heads/bar").Status, Equals, PushRemoteRejected)
+	c.Assert(r.Ref("refs/heads/bar").Message, Equals, "hook declined")
+	c.Assert(r.Updated(), HasLen, 1)
+	c.Assert(r.Error(), ErrorMatches, "command error on refs/heads/bar: hook declined")
+}
+
+func (s *PushResultSuite) TestSetReportStatusUnpackError(c *C) {
+	r := &PushResult{}
+	r.add(&packp.Command{Name: "refs/heads/foo", New: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, PushOK)
+
+	rs := packp.NewReportStatus()
+	rs.UnpackStatus = "index-pack abnormal exit"
+
+	r.setReportStatus(rs)
+	c.Assert(r.Ref("refs/heads/foo").Status, Equals, PushRemoteRejected)
+	c.Assert(r.Updated(), HasLen, 0)
+}
+
+func (s *PushResultSuite) TestErrorPrefersCause(c *C) {
+	r := &PushResult{}
+	r.add(&packp.Command{Name: "refs/heads/foo"}, PushOK)
+	r.add(&packp.Command{Name: "refs/heads/bar"}, PushStaleInfo)
+	r.rejectAll("atomic push failed")
+
+	c.Assert(r.Ref("refs/heads/foo").Status, Equals, PushRejected)
+	c.Assert(r.Error(), ErrorMatches, "stale info: refs/heads/bar")
+	c.Assert(PushStaleInfo.String(), Equals, "stale-info")
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
@@ -23,11 +25,22 @@ import (
 )
 
 var (
-	NoErrAlreadyUpToDate     = errors.New("already up-to-date")
-	ErrDeleteRefNotSupported = errors.New("server does not support delete-refs")
-	ErrForceNeeded           = errors.New("some refs were not updated")
+	NoErrAlreadyUpToDate          = errors.New("already up-to-date")
+	ErrDeleteRefNotSupported      = errors.New("server does not support delete-refs")
+	ErrShallowNotSupported        = errors.New("server does not support shallow")
+	ErrDeepenSinceNotSupported    = errors.New("server does not support deepen-since")
+	ErrDeepenNotNotSupported      = errors.New("server does not support deepen-not")
+	ErrDeepenRelativeNotSupported = errors.New("server does not support deepen-relative")
+	ErrFilterNotSupported         = errors.New("server does not support filter")
+	ErrAtomicNotSupported         = errors.New("server does not support atomic push")
+	ErrPushOptionsNotSupported    = errors.New("server does not support push options")
+	ErrForceNeeded                = errors.New("some refs were not updated")
 )
 
+// infiniteDepth is the depth requested to unshallow a repository, the same
+// value used by git.
+const infiniteDepth = 0x7fffffff
+
 const (
 	// This describes the maximum number of commits to walk when
 	// computing the haves to send to a server, for each ref in the
@@ -40,6 +53,20 @@ const (
 type Remote struct {
 	c *config.RemoteConfig
 	s storage.Storer
+	// global are the system and global config scopes, nil if not loaded,
+	// see Repository.LoadGlobalConfig.
+	global *format.Config
+}
+
+// NewRemote creates a new Remote. The intended purpose is to use the Remote
+// for tasks such as listing remote references, like git ls-remote does with
+// an URL. Otherwise the Remote should be obtained from the Repository.
+//
+// The remote operations only use the config of the given storer, the system
+// and global config scopes are only used by the remotes of a Repository that
+// loaded them, see Repository.LoadGlobalConfig.
+func NewRemote(s storage.Storer, c *config.RemoteConfig) *Remote {
+	return newRemote(s, c)
 }
 
 func newRemote(s storage.Storer, c *config.RemoteConfig) *Remote {
@@ -73,30 +100,142 @@ func (r *Remote) Push(o *PushOptions) error {
 // The provided Context must be non-nil. If the context expires before the
 // operation is complete, an error is returned. The context only affects to the
 // transport operations.
-func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
+func (r *Remote) PushContext(ctx context.Context, o *PushOptions) error {
+	_, err := r.PushWithResult(ctx, o)
+	return err
+}
+
+// PushWithResult performs a push to the remote and returns the status of
+// every remote reference matched by the refspecs. The references that were
+// not updated are reported in the result, the returned error is the error of
+// the first of them. Returns NoErrAlreadyUpToDate if the remote was already
+// up-to-date.
+//
+// When the remote has several push URLs the result contains the references
+// of every URL pushed to, the push stops at the first URL that fails.
+//
+// The result is nil if the push failed before the references were checked or
+// the transport failed.
+//
+// The provided Context must be non-nil. If the context expires before the
+// operation is complete, an error is returned. The context only affects to the
+// transport operations.
+func (r *Remote) PushWithResult(ctx context.Context, o *PushOptions) (result *PushResult, err error) {
 	if err := o.Validate(); err != nil {
-		return err
+		return nil, err
 	}
 
 	if o.RemoteName != r.c.Name {
-		return fmt.Errorf("remote names don't match: %s != %s", o.RemoteName, r.c.Name)
+		return nil, fmt.Errorf("remote names don't match: %s != %s", o.RemoteName, r.c.Name)
+	}
+
+	mirror := r.c.Mirror && len(o.RefSpecs) == 0
+	if len(o.RefSpecs) == 0 {
+		opts := *o
+		opts.RefSpecs = r.pushRefSpecs()
+		o = &opts
 	}
 
-	s, err := newSendPackSession(r.c.URLs[0], o.Auth)
+	urls, err := r.pushURLs()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	upToDate := true
+	for _, url := range urls {
+		res, err := r.pushToURL(ctx, o, url, mirror)
+		if res != nil {
+			result = result.merge(res, url)
+		}
+
+		if err == NoErrAlreadyUpToDate {
+			continue
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		upToDate = false
+	}
+
+	if upToDate {
+		return result, NoErrAlreadyUpToDate
+	}
+
+	return result, nil
+}
+
+// pushRefSpecs returns the refspecs pushed by default: all the references
+// for a mirror, otherwise the push refspecs of the remote or
+// DefaultPushRefSpec.
+func (r *Remote) pushRefSpecs() []config.RefSpec {
+	switch {
+	case r.c.Mirror:
+		return []config.RefSpec{config.MirrorPushRefSpec}
+	case len(r.c.Push) != 0:
+		specs := make([]config.RefSpec, len(r.c.Push))
+		for i, rs := range r.c.Push {
+			specs[i] = r.expandPushRefSpec(rs)
+		}
+
+		return specs
+	}
+
+	return []config.RefSpec{config.DefaultPushRefSpec}
+}
+
+// expandPushRefSpec expands a push refspec without destination, as <src>, to
+// <src>:<src>, as git does. HEAD is the current branch, and the names not
+// starting with refs/ are branches.
+func (r *Remote) expandPushRefSpec(rs config.RefSpec) config.RefSpec {
+	spec := string(rs)
+	if spec == "" || strings.Contains(spec, ":") {
+		return rs
+	}
+
+	var force string
+	if rs.IsForceUpdate() {
+		force, spec = "+", spec[1:]
+	}
+
+	switch {
+	case spec == plumbing.HEAD.String():
+		if r.s == nil {
+			break
+		}
+
+		head, err := r.s.Reference(plumbing.HEAD)
+		if err == nil && head.Type() == plumbing.SymbolicReference {
+			spec = head.Target().String()
+		}
+	case !strings.HasPrefix(spec, "refs/"):
+		spec = plumbing.NewBranchReferenceName(spec).String()
+	}
+
+	return config.RefSpec(force + spec + ":" + spec)
+}
+
+// pushToURL pushes to the given URL of the remote. If mirror is true the
+// remote references missing locally are deleted.
+func (r *Remote) pushToURL(ctx context.Context, o *PushOptions, url string,
+	mirror bool) (result *PushResult, err error) {
+
+	s, err := r.newSendPackSession(url, o.Auth)
+	if err != nil {
+		return nil, err
 	}
 
 	defer ioutil.CheckClose(s, &err)
 
 	ar, err := s.AdvertisedReferences()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	remoteRefs, err := ar.AllReferences()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	isDelete := false
@@ -113,33 +252,52 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 	}
 
 	if isDelete && !ar.Capabilities.Supports(capability.DeleteRefs) {
-		return ErrDeleteRefNotSupported
+		return nil, ErrDeleteRefNotSupported
 	}
 
 	localRefs, err := r.references()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req, err := r.newReferenceUpdateRequest(o, localRefs, remoteRefs, ar)
+	req, result, err := r.newReferenceUpdateRequest(o, localRefs, remoteRefs, ar)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if mirror {
+		if err := r.addMirrorDeletes(o, localRefs, remoteRefs, req, result); err != nil {
+			return nil, err
+		}
+
+		if hasDeletes(req.Commands) && !ar.Capabilities.Supports(capability.DeleteRefs) {
+			return nil, ErrDeleteRefNotSupported
+		}
+	}
+
+	if o.Atomic && result.hasRejections() {
+		result.rejectAll("atomic push failed")
+		return result, result.Error()
 	}
 
 	if len(req.Commands) == 0 {
-		return NoErrAlreadyUpToDate
+		if err := result.Error(); err != nil {
+			return result, err
+		}
+
+		return result, NoErrAlreadyUpToDate
 	}
 
 	objects := objectsToPush(req.Commands)
 
 	haves, err := referencesToHashes(remoteRefs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	stop, err := r.s.Shallow()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// if we have shallow we should include this as part of the objects that
@@ -151,20 +309,21 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 	if !allDelete {
 		hashesToPush, err = revlist.Objects(r.s, objects, haves)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	rs, err := pushHashes(ctx, s, r.s, req, hashesToPush, r.useRefDeltas(ar))
-	if err != nil {
-		return err
+	rs, err := pushHashes(ctx, s, r.s, req, hashesToPush, r.useRefDeltas(ar), o.ProgressHandler)
+	if err != nil && (rs == nil || rs.Error() == nil) {
+		return nil, err
 	}
 
-	if err = rs.Error(); err != nil {
-		return err
+	result.setReportStatus(rs)
+	if err := r.updateRemoteReferenceStorage(result); err != nil {
+		return result, err
 	}
 
-	return r.updateRemoteReferenceStorage(req, rs)
+	return result, result.Error()
 }
 
 func (r *Remote) useRefDeltas(ar *packp.AdvRefs) bool {
@@ -176,11 +335,11 @@ func (r *Remote) newReferenceUpdateRequest(
 	localRefs []*plumbing.Reference,
 	remoteRefs storer.ReferenceStorer,
 	ar *packp.AdvRefs,
-) (*packp.ReferenceUpdateRequest, error) {
+) (*packp.ReferenceUpdateRequest, *PushResult, error) {
 	req := packp.NewReferenceUpdateRequestFromCapabilities(ar.Capabilities)
 
-	if o.Progress != nil {
-		req.Progress = o.Progress
+	if o.Progress != nil || o.ProgressHandler != nil {
+		req.Progress = progressWriter(o.Progress, o.ProgressHandler)
 		if ar.Capabilities.Supports(capability.Sideband64k) {
 			req.Capabilities.Set(capability.Sideband64k)
 		} else if ar.Capabilities.Supports(capability.Sideband) {
@@ -188,35 +347,58 @@ func (r *Remote) newReferenceUpdateRequest(
 		}
 	}
 
-	if err := r.addReferencesToUpdate(o.RefSpecs, localRefs, remoteRefs, req); err != nil {
-		return nil, err
+	if o.Atomic {
+		if !ar.Capabilities.Supports(capability.Atomic) {
+			return nil, nil, ErrAtomicNotSupported
+		}
+
+		if err := req.Capabilities.Set(capability.Atomic); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return req, nil
-}
+	if len(o.Options) != 0 {
+		if !ar.Capabilities.Supports(capability.PushOptions) {
+			return nil, nil, ErrPushOptionsNotSupported
+		}
 
-func (r *Remote) updateRemoteReferenceStorage(
-	req *packp.ReferenceUpdateRequest,
-	result *packp.ReportStatus,
-) error {
+		if err := req.Capabilities.Set(capability.PushOptions); err != nil {
+			return nil, nil, err
+		}
 
+		req.Options = o.Options
+	}
+
+	result := &PushResult{}
+	err := r.addReferencesToUpdate(o, localRefs, remoteRefs, req, result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return req, result, nil
+}
+
+// updateRemoteReferenceStorage updates the remote-tracking references of the
+// remote references updated by a push.
+func (r *Remote) updateRemoteReferenceStorage(result *PushResult) error {
 	for _, spec := range r.c.Fetch {
-		for _, c := range req.Commands {
-			if !spec.Match(c.Name) {
+		for _, u := range result.Updated() {
+			if !spec.Match(u.Name) {
 				continue
 			}
 
-			local := spec.Dst(c.Name)
-			ref := plumbing.NewHashReference(local, c.New)
-			switch c.Action() {
-			case packp.Create, packp.Update:
-				if err := r.s.SetReference(ref); err != nil {
-					return err
-				}
-			case packp.Delete:
+			local := spec.Dst(u.Name)
+			if u.New == plumbing.ZeroHash {
 				if err := r.s.RemoveReference(local); err != nil {
 					return err
 				}
+
+				continue
+			}
+
+			ref := plumbing.NewHashReference(local, u.New)
+			if err := r.s.SetReference(ref); err != nil {
+				return err
 			}
 		}
 	}
@@ -234,10 +416,24 @@ func (r *Remote) updateRemoteReferenceStorage(
 // operation is complete, an error is returned. The context only affects to the
 // transport operations.
 func (r *Remote) FetchContext(ctx context.Context, o *FetchOptions) error {
-	_, err := r.fetch(ctx, o)
+	_, _, err := r.fetch(ctx, o)
 	return err
 }
 
+// FetchWithResult fetches references along with the objects necessary to
+// complete their histories, and returns the references pruned.
+//
+// Returns NoErrAlreadyUpToDate if there are no changes to be fetched, the
+// result is nil if the fetch failed.
+//
+// The provided Context must be non-nil. If the context expires before the
+// operation is complete, an error is returned. The context only affects to the
+// transport operations.
+func (r *Remote) FetchWithResult(ctx context.Context, o *FetchOptions) (*FetchResult, error) {
+	_, result, err := r.fetch(ctx, o)
+	return result, err
+}
+
 // Fetch fetches references along with the objects necessary to complete their
 // histories.
 //
@@ -247,77 +443,249 @@ func (r *Remote) Fetch(o *FetchOptions) error {
 	return r.FetchContext(context.Background(), o)
 }
 
-func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.ReferenceStorer, err error) {
+func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (
+	sto storer.ReferenceStorer, result *FetchResult, err error) {
+
 	if o.RemoteName == "" {
 		o.RemoteName = r.c.Name
 	}
 
 	if err = o.Validate(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(o.RefSpecs) == 0 {
 		o.RefSpecs = r.c.Fetch
 	}
 
-	s, err := newUploadPackSession(r.c.URLs[0], o.Auth)
+	if o.Tags == TagFollowing {
+		o.Tags = r.tagMode()
+	}
+
+	cfg, err := r.effectiveConfig()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	specs, prune := r.fetchRefSpecs(o, cfg)
+
+	s, err := r.newUploadPackSession(cfg.RewriteURL(r.c.URLs[0]), cfg, o.Auth)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	defer ioutil.CheckClose(s, &err)
 
 	ar, err := s.AdvertisedReferences()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	req, err := r.newUploadPackRequest(o, ar)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	remoteRefs, err := ar.AllReferences()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	localRefs, err := r.references()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	refs, err := calculateRefs(o.RefSpecs, remoteRefs, o.Tags)
+	refs, err := calculateRefs(specs, remoteRefs, o.Tags)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	req.Wants, err = getWants(r.s, refs)
+	deepen := len(req.Shallows) != 0 && !req.Depth.IsZero()
+	req.Wants, err = getWants(r.s, refs, deepen)
 	if len(req.Wants) > 0 {
 		req.Haves, err = getHaves(localRefs, remoteRefs, r.s)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if err = r.fetchPack(ctx, o, s, req); err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	updated, err := r.updateLocalReferenceStorage(specs, refs, remoteRefs, o.Tags, o.Force)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result = &FetchResult{}
+	if prune {
+		result.Pruned, err = r.pruneReferences(specs, remoteRefs)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
-	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, refs, remoteRefs, o.Tags, o.Force)
+	if !updated && len(result.Pruned) == 0 && !(deepen && len(req.Wants) > 0) {
+		return remoteRefs, result, NoErrAlreadyUpToDate
+	}
+
+	return remoteRefs, result, nil
+}
+
+// pruneTagsRefSpec is the refspec fetched and pruned when pruning the tags.
+const pruneTagsRefSpec = config.RefSpec("refs/tags/*:refs/tags/*")
+
+// fetchRefSpecs returns the refspecs fetched, with pruneTagsRefSpec if the
+// tags are pruned, and whether the local references are pruned, as set by
+// the given options or else the remote or else the fetch section of the
+// config, as git does.
+func (r *Remote) fetchRefSpecs(o *FetchOptions, cfg *config.Config) ([]config.RefSpec, bool) {
+	specs := o.RefSpecs
+	if !firstSet(o.Prune, r.c.Prune, cfg.Fetch.Prune) {
+		return specs, false
+	}
+
+	if firstSet(o.PruneTags, r.c.PruneTags, cfg.Fetch.PruneTags) {
+		specs = append(specs[:len(specs):len(specs)], pruneTagsRefSpec)
+	}
+
+	return specs, true
+}
+
+// firstSet returns the value of the first of the given options that is set,
+// false if none is.
+func firstSet(opts ...config.OptBool) bool {
+	for _, o := range opts {
+		if o.IsSet() {
+			return o.IsTrue()
+		}
+	}
+
+	return false
+}
+
+// effectiveConfig returns the config used by the remote operations: the
+// config of the repository merged over the system and global scopes, if
+// loaded.
+func (r *Remote) effectiveConfig() (*config.Config, error) {
+	ctx, err := includeContext(r.s)
 	if err != nil {
 		return nil, err
 	}
 
-	if !updated {
-		return remoteRefs, NoErrAlreadyUpToDate
+	return repositoryConfig(r.global, r.s, ctx)
+}
+
+// fetchURL returns the URL used to fetch from the remote, rewritten with the
+// url.<base>.insteadOf rules of the effective config. It returns
+// config.ErrRemoteConfigEmptyURL if the remote has no URL.
+func (r *Remote) fetchURL() (string, error) {
+	if len(r.c.URLs) == 0 {
+		return "", config.ErrRemoteConfigEmptyURL
 	}
 
-	return remoteRefs, nil
+	cfg, err := r.effectiveConfig()
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.RewriteURL(r.c.URLs[0]), nil
+}
+
+// pushURLs returns the URLs used to push to the remote: the push URLs
+// rewritten with the url.<base>.insteadOf rules of the effective config or, if
+// there is none, the URLs rewritten with the pushInsteadOf and insteadOf ones.
+func (r *Remote) pushURLs() ([]string, error) {
+	cfg, err := r.effectiveConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, url := range r.c.PushURLs {
+		urls = append(urls, cfg.RewriteURL(url))
+	}
+
+	if len(urls) != 0 {
+		return urls, nil
+	}
+
+	for _, url := range r.c.URLs {
+		urls = append(urls, cfg.RewritePushURL(url))
+	}
+
+	return urls, nil
+}
+
+// tagMode returns the tag mode of the fetch operation set by the tagOpt of
+// the remote, TagFollowing if none.
+func (r *Remote) tagMode() TagMode {
+	switch r.c.TagOpt {
+	case config.TagOptAllTags:
+		return AllTags
+	case config.TagOptNoTags:
+		return NoTags
+	}
+
+	return TagFollowing
 }
 
-func newUploadPackSession(url string, auth transport.AuthMethod) (transport.UploadPackSession, error) {
-	c, ep, err := newClient(url)
+// pruneReferences removes the local references matching the destinations of
+// the given refspecs whose remote reference no longer exists, and returns
+// their names.
+func (r *Remote) pruneReferences(specs []config.RefSpec,
+	remoteRefs storer.ReferenceStorer) ([]plumbing.ReferenceName, error) {
+
+	localRefs, err := r.references()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []plumbing.ReferenceName
+	for _, ref := range localRefs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		for _, spec := range specs {
+			if spec.IsDelete() {
+				continue
+			}
+
+			rev := spec.Reverse()
+			if !rev.Match(ref.Name()) {
+				continue
+			}
+
+			_, err := remoteRefs.Reference(rev.Dst(ref.Name()))
+			if err == nil {
+				break
+			}
+
+			if err != plumbing.ErrReferenceNotFound {
+				return nil, err
+			}
+
+			if err := r.s.RemoveReference(ref.Name()); err != nil {
+				return nil, err
+			}
+
+			pruned = append(pruned, ref.Name())
+			break
+		}
+	}
+
+	return pruned, nil
+}
+
+// newUploadPackSession returns a session fetching from the given URL, with
+// the transport configured by the given merged config, loaded if nil.
+func (r *Remote) newUploadPackSession(url string, cfg *config.Config,
+	auth transport.AuthMethod) (transport.UploadPackSession, error) {
+
+	c, ep, err := r.newClient(url, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -325,8 +693,10 @@ func newUploadPackSession(url string, auth transport.AuthMethod) (transport.Uplo
 	return c.NewUploadPackSession(ep, auth)
 }
 
-func newSendPackSession(url string, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
-	c, ep, err := newClient(url)
+func (r *Remote) newSendPackSession(url string, auth transport.AuthMethod) (
+	transport.ReceivePackSession, error) {
+
+	c, ep, err := r.newClient(url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -334,7 +704,12 @@ func newSendPackSession(url string, auth transport.AuthMethod) (transport.Receiv
 	return c.NewReceivePackSession(ep, auth)
 }
 
-func newClient(url string) (transport.Transport, *transport.Endpoint, error) {
+// newClient returns the client of the given URL, running the upload-pack and
+// receive-pack commands of the remote. As git, the commands are only replaced
+// with the transports executing them, ssh and file. The transports reading
+// their settings from the config are given the effective config of the
+// remote, loaded if cfg is nil.
+func (r *Remote) newClient(url string, cfg *config.Config) (transport.Transport, *transport.Endpoint, error) {
 	ep, err := transport.NewEndpoint(url)
 	if err != nil {
 		return nil, nil, err
@@ -345,12 +720,31 @@ func newClient(url string) (transport.Transport, *transport.Endpoint, error) {
 		return nil, nil, err
 	}
 
-	return c, ep, err
+	ct, ok := c.(transport.CommandTransport)
+	if ok && (ep.Protocol == "ssh" || ep.Protocol == "file") {
+		c = ct.WithCommands(r.c.UploadPack, r.c.ReceivePack)
+	}
+
+	if ct, ok := c.(transport.ConfigTransport); ok {
+		if cfg == nil {
+			if cfg, err = r.effectiveConfig(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		c = ct.WithConfig(cfg.Raw)
+	}
+
+	return c, ep, nil
 }
 
 func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.UploadPackSession,
 	req *packp.UploadPackRequest) (err error) {
 
+	if ls, ok := s.(transport.LocalObjectsSession); ok {
+		ls.SetLocalObjects(r.s)
+	}
+
 	reader, err := s.UploadPack(ctx, req)
 	if err != nil {
 		return err
@@ -358,12 +752,14 @@ func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.Upl
 
 	defer ioutil.CheckClose(reader, &err)
 
-	if err = r.updateShallow(o, reader); err != nil {
+	if err = r.updateShallow(reader); err != nil {
 		return err
 	}
 
-	if err = packfile.UpdateObjectStorage(r.s,
-		buildSidebandIfSupported(req.Capabilities, reader, o.Progress),
+	if err = packfile.UpdateObjectStorageWithProgress(r.s,
+		buildSidebandIfSupported(req.Capabilities, reader,
+			progressWriter(o.Progress, o.ProgressHandler)),
+		o.ProgressHandler,
 	); err != nil {
 		return err
 	}
@@ -372,10 +768,11 @@ func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.Upl
 }
 
 func (r *Remote) addReferencesToUpdate(
-	refspecs []config.RefSpec,
+	o *PushOptions,
 	localRefs []*plumbing.Reference,
 	remoteRefs storer.ReferenceStorer,
 	req *packp.ReferenceUpdateRequest,
+	result *PushResult,
 ) error {
 	// This references dictionary will be used to search references by name.
 	refsDict := make(map[string]*plumbing.Reference)
@@ -383,13 +780,15 @@ func (r *Remote) addReferencesToUpdate(
 		refsDict[ref.Name().String()] = ref
 	}
 
-	for _, rs := range refspecs {
+	for _, rs := range o.RefSpecs {
 		if rs.IsDelete() {
-			if err := r.deleteReferences(rs, remoteRefs, req); err != nil {
+			err := r.deleteReferences(rs, o.ForceWithLease, remoteRefs, req, result)
+			if err != nil {
 				return err
 			}
 		} else {
-			err := r.addOrUpdateReferences(rs, localRefs, refsDict, remoteRefs, req)
+			err := r.addOrUpdateReferences(rs, o.ForceWithLease, localRefs,
+				refsDict, remoteRefs, req, result)
 			if err != nil {
 				return err
 			}
@@ -401,10 +800,12 @@ func (r *Remote) addReferencesToUpdate(
 
 func (r *Remote) addOrUpdateReferences(
 	rs config.RefSpec,
+	lease *ForceWithLease,
 	localRefs []*plumbing.Reference,
 	refsDict map[string]*plumbing.Reference,
 	remoteRefs storer.ReferenceStorer,
 	req *packp.ReferenceUpdateRequest,
+	result *PushResult,
 ) error {
 	// If it is not a wilcard refspec we can directly search for the reference
 	// in the references dictionary.
@@ -414,11 +815,11 @@ func (r *Remote) addOrUpdateReferences(
 			return nil
 		}
 
-		return r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req)
+		return r.addReferenceIfRefSpecMatches(rs, lease, remoteRefs, ref, req, result)
 	}
 
 	for _, ref := range localRefs {
-		err := r.addReferenceIfRefSpecMatches(rs, remoteRefs, ref, req)
+		err := r.addReferenceIfRefSpecMatches(rs, lease, remoteRefs, ref, req, result)
 		if err != nil {
 			return err
 		}
@@ -427,8 +828,52 @@ func (r *Remote) addOrUpdateReferences(
 	return nil
 }
 
-func (r *Remote) deleteReferences(rs config.RefSpec,
-	remoteRefs storer.ReferenceStorer, req *packp.ReferenceUpdateRequest) error {
+// addMirrorDeletes adds the commands deleting the remote references missing
+// locally, to mirror the local repository.
+func (r *Remote) addMirrorDeletes(o *PushOptions, localRefs []*plumbing.Reference,
+	remoteRefs storer.ReferenceStorer, req *packp.ReferenceUpdateRequest,
+	result *PushResult) error {
+
+	local := make(map[plumbing.ReferenceName]bool)
+	for _, ref := range localRefs {
+		local[ref.Name()] = true
+	}
+
+	iter, err := remoteRefs.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	rs := config.RefSpec(config.MirrorPushRefSpec)
+	return iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !rs.Match(ref.Name()) ||
+			local[ref.Name()] {
+			return nil
+		}
+
+		cmd := &packp.Command{
+			Name: ref.Name(),
+			Old:  ref.Hash(),
+			New:  plumbing.ZeroHash,
+		}
+
+		return r.addCommand(rs, o.ForceWithLease, remoteRefs, cmd, req, result)
+	})
+}
+
+func hasDeletes(commands []*packp.Command) bool {
+	for _, cmd := range commands {
+		if cmd.Action() == packp.Delete {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Remote) deleteReferences(rs config.RefSpec, lease *ForceWithLease,
+	remoteRefs storer.ReferenceStorer, req *packp.ReferenceUpdateRequest,
+	result *PushResult) error {
 	iter, err := remoteRefs.IterReferences()
 	if err != nil {
 		return err
@@ -448,14 +893,15 @@ func (r *Remote) deleteReferences(rs config.RefSpec,
 			Old:  ref.Hash(),
 			New:  plumbing.ZeroHash,
 		}
-		req.Commands = append(req.Commands, cmd)
-		return nil
+
+		return r.addCommand(rs, lease, remoteRefs, cmd, req, result)
 	})
 }
 
 func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
-	remoteRefs storer.ReferenceStorer, localRef *plumbing.Reference,
-	req *packp.ReferenceUpdateRequest) error {
+	lease *ForceWithLease, remoteRefs storer.ReferenceStorer,
+	localRef *plumbing.Reference, req *packp.ReferenceUpdateRequest,
+	result *PushResult) error {
 
 	if localRef.Type() != plumbing.HashReference {
 		return nil
@@ -484,19 +930,78 @@ func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
 	}
 
 	if cmd.Old == cmd.New {
+		result.add(cmd, PushUpToDate)
 		return nil
 	}
 
-	if !rs.IsForceUpdate() {
-		if err := checkFastForwardUpdate(r.s, remoteRefs, cmd); err != nil {
+	return r.addCommand(rs, lease, remoteRefs, cmd, req, result)
+}
+
+// addCommand adds the given command to the request, unless it is rejected by
+// the lease or it is not a fast-forward update and the refspec does not force
+// it. The command is added to the result in any case.
+func (r *Remote) addCommand(rs config.RefSpec, lease *ForceWithLease,
+	remoteRefs storer.ReferenceStorer, cmd *packp.Command,
+	req *packp.ReferenceUpdateRequest, result *PushResult) error {
+
+	status := PushOK
+	switch {
+	case lease != nil:
+		expected, err := r.leaseExpectedHash(lease, cmd.Name)
+		if err != nil {
 			return err
 		}
+
+		if expected != cmd.Old {
+			status = PushStaleInfo
+		}
+	case !rs.IsForceUpdate() && cmd.Action() != packp.Delete:
+		ff, err := isFastForwardUpdate(r.s, remoteRefs, cmd)
+		if err != nil {
+			return err
+		}
+
+		if !ff {
+			status = PushNonFastForward
+		}
+	}
+
+	result.add(cmd, status)
+	if status == PushOK {
+		req.Commands = append(req.Commands, cmd)
 	}
 
-	req.Commands = append(req.Commands, cmd)
 	return nil
 }
 
+// leaseExpectedHash returns the value the given remote reference is expected
+// to have, it is the value of the remote-tracking reference if the lease does
+// not set one. A zero hash means the reference must not exist.
+func (r *Remote) leaseExpectedHash(lease *ForceWithLease, n plumbing.ReferenceName) (plumbing.Hash, error) {
+	if h, ok := lease.Expected[n]; ok {
+		return h, nil
+	}
+
+	for _, spec := range r.c.Fetch {
+		if !spec.Match(n) {
+			continue
+		}
+
+		ref, err := r.s.Reference(spec.Dst(n))
+		if err == plumbing.ErrReferenceNotFound {
+			return plumbing.ZeroHash, nil
+		}
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return ref.Hash(), nil
+	}
+
+	return plumbing.ZeroHash, nil
+}
+
 func (r *Remote) references() ([]*plumbing.Reference, error) {
 	var localRefs []*plumbing.Reference
 	iter, err := r.s.IterReferences()
@@ -692,10 +1197,18 @@ func doCalculateRefs(
 	return err
 }
 
-func getWants(localStorer storage.Storer, refs memory.ReferenceStorage) ([]plumbing.Hash, error) {
+// getWants returns the hashes of the given references missing in the local
+// storer. If deepen is true, all of them are returned, since their history may
+// be incomplete.
+func getWants(localStorer storage.Storer, refs memory.ReferenceStorage, deepen bool) ([]plumbing.Hash, error) {
 	wants := map[plumbing.Hash]bool{}
 	for _, ref := range refs {
 		hash := ref.Hash()
+		if deepen {
+			wants[hash] = true
+			continue
+		}
+
 		exists, err := objectExists(localStorer, ref.Hash())
 		if err != nil {
 			return nil, err
@@ -715,7 +1228,7 @@ func getWants(localStorer storage.Storer, refs memory.ReferenceStorage) ([]plumb
 }
 
 func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
-	_, err := s.EncodedObject(plumbing.AnyObject, h)
+	err := s.HasEncodedObject(h)
 	if err == plumbing.ErrObjectNotFound {
 		return false, nil
 	}
@@ -723,30 +1236,17 @@ func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
 	return true, err
 }
 
-func checkFastForwardUpdate(s storer.EncodedObjectStorer, remoteRefs storer.ReferenceStorer, cmd *packp.Command) error {
+func isFastForwardUpdate(s storer.EncodedObjectStorer, remoteRefs storer.ReferenceStorer, cmd *packp.Command) (bool, error) {
 	if cmd.Old == plumbing.ZeroHash {
 		_, err := remoteRefs.Reference(cmd.Name)
 		if err == plumbing.ErrReferenceNotFound {
-			return nil
+			return true, nil
 		}
 
-		if err != nil {
-			return err
-		}
-
-		return fmt.Errorf("non-fast-forward update: %s", cmd.Name.String())
-	}
-
-	ff, err := isFastForward(s, cmd.Old, cmd.New)
-	if err != nil {
-		return err
-	}
-
-	if !ff {
-		return fmt.Errorf("non-fast-forward update: %s", cmd.Name.String())
+		return false, err
 	}
 
-	return nil
+	return isFastForward(s, cmd.Old, cmd.New)
 }
 
 func isFastForward(s storer.EncodedObjectStorer, old, new plumbing.Hash) (bool, error) {
@@ -773,14 +1273,16 @@ func (r *Remote) newUploadPackRequest(o *FetchOptions,
 
 	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
 
-	if o.Depth != 0 {
-		req.Depth = packp.DepthCommits(o.Depth)
-		if err := req.Capabilities.Set(capability.Shallow); err != nil {
-			return nil, err
-		}
+	if err := r.setShallowOptions(o, ar, req); err != nil {
+		return nil, err
+	}
+
+	if err := r.setFilterOptions(o, ar, req); err != nil {
+		return nil, err
 	}
 
-	if o.Progress == nil && ar.Capabilities.Supports(capability.NoProgress) {
+	if o.Progress == nil && o.ProgressHandler == nil &&
+		ar.Capabilities.Supports(capability.NoProgress) {
 		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
 			return nil, err
 		}
@@ -803,6 +1305,118 @@ func (r *Remote) newUploadPackRequest(o *FetchOptions,
 	return req, nil
 }
 
+// setShallowOptions sets the depth requested by the options, and the current
+// shallow commits of the repository, to the given request.
+func (r *Remote) setShallowOptions(o *FetchOptions, ar *packp.AdvRefs,
+	req *packp.UploadPackRequest) error {
+
+	shallows, err := r.s.Shallow()
+	if err != nil {
+		return err
+	}
+
+	if !o.isShallow() && len(shallows) == 0 {
+		return nil
+	}
+
+	if !ar.Capabilities.Supports(capability.Shallow) {
+		return ErrShallowNotSupported
+	}
+
+	if err := req.Capabilities.Set(capability.Shallow); err != nil {
+		return err
+	}
+
+	req.Shallows = shallows
+
+	var required capability.Capability
+	var unsupported error
+	switch {
+	case o.Depth != 0:
+		req.Depth = packp.DepthCommits(o.Depth)
+	case o.Unshallow:
+		req.Depth = packp.DepthCommits(infiniteDepth)
+	case o.Deepen != 0:
+		req.Depth = packp.DepthCommits(o.Deepen)
+		required, unsupported = capability.DeepenRelative, ErrDeepenRelativeNotSupported
+	case !o.ShallowSince.IsZero():
+		req.Depth = packp.DepthSince(o.ShallowSince)
+		required, unsupported = capability.DeepenSince, ErrDeepenSinceNotSupported
+	case len(o.ShallowExclude) == 1:
+		req.Depth = packp.DepthReference(o.ShallowExclude[0])
+		required, unsupported = capability.DeepenNot, ErrDeepenNotNotSupported
+	case len(o.ShallowExclude) > 1:
+		req.Depth = packp.DepthReferences(o.ShallowExclude)
+		required, unsupported = capability.DeepenNot, ErrDeepenNotNotSupported
+	}
+
+	if required == "" {
+		return nil
+	}
+
+	if !ar.Capabilities.Supports(required) {
+		return unsupported
+	}
+
+	return req.Capabilities.Set(required)
+}
+
+// setFilterOptions sets the object filter requested by the options to the
+// given request. If the options have no filter, the partial clone filter of
+// the remote is used, if the server supports it.
+func (r *Remote) setFilterOptions(o *FetchOptions, ar *packp.AdvRefs,
+	req *packp.UploadPackRequest) error {
+
+	filter := o.Filter
+	if filter.IsZero() {
+		if r.c.PartialCloneFilter == "" || !ar.Capabilities.Supports(capability.Filter) {
+			return nil
+		}
+
+		filter = packp.Filter(r.c.PartialCloneFilter)
+	}
+
+	if !ar.Capabilities.Supports(capability.Filter) {
+		return ErrFilterNotSupported
+	}
+
+	req.Filter = filter
+	return req.Capabilities.Set(capability.Filter)
+}
+
+// fetchObjects fetches the given objects from the remote, using the partial
+// clone filter of the remote. It is used to fetch lazily the objects missing
+// from a partial clone.
+func (r *Remote) fetchObjects(ctx context.Context, hashes []plumbing.Hash,
+	auth transport.AuthMethod) (err error) {
+
+	url, err := r.fetchURL()
+	if err != nil {
+		return err
+	}
+
+	s, err := r.newUploadPackSession(url, nil, auth)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(s, &err)
+
+	ar, err := s.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	o := &FetchOptions{RemoteName: r.c.Name}
+	req, err := r.newUploadPackRequest(o, ar)
+	if err != nil {
+		return err
+	}
+
+	req.Wants = hashes
+	return r.fetchPack(ctx, o, s, req)
+}
+
 func buildSidebandIfSupported(l *capability.List, reader io.Reader, p sideband.Progress) io.Reader {
 	var t sideband.Type
 
@@ -821,6 +1435,16 @@ func buildSidebandIfSupported(l *capability.List, reader io.Reader, p sideband.P
 	return d
 }
 
+// progressWriter returns the sideband.Progress receiving the messages of the
+// server, parsing them into events sent to h, if not nil.
+func progressWriter(p sideband.Progress, h plumbing.ProgressHandler) sideband.Progress {
+	if h == nil {
+		return p
+	}
+
+	return sideband.NewProgressParser(h, p)
+}
+
 func (r *Remote) updateLocalReferenceStorage(
 	specs []config.RefSpec,
 	fetchedRefs, remoteRefs memory.ReferenceStorage,
@@ -927,7 +1551,12 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 
 // List the references on the remote repository.
 func (r *Remote) List(o *ListOptions) (rfs []*plumbing.Reference, err error) {
-	s, err := newUploadPackSession(r.c.URLs[0], o.Auth)
+	url, err := r.fetchURL()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := r.newUploadPackSession(url, nil, o.Auth)
 	if err != nil {
 		return nil, err
 	}
@@ -999,6 +1628,7 @@ func pushHashes(
 	req *packp.ReferenceUpdateRequest,
 	hs []plumbing.Hash,
 	useRefDeltas bool,
+	progress plumbing.ProgressHandler,
 ) (*packp.ReportStatus, error) {
 
 	rd, wr := io.Pipe()
@@ -1007,9 +1637,10 @@ func pushHashes(
 	if err != nil {
 		return nil, err
 	}
-	done := make(chan error)
+	done := make(chan error, 1)
 	go func() {
 		e := packfile.NewEncoder(wr, s, useRefDeltas)
+		e.SetProgressHandler(progress)
 		if _, err := e.Encode(hs, config.Pack.Window); err != nil {
 			done <- wr.CloseWithError(err)
 			return
@@ -1020,7 +1651,8 @@ func pushHashes(
 
 	rs, err := sess.ReceivePack(ctx, req)
 	if err != nil {
-		return nil, err
+		// the report status, if any, tells which references were rejected.
+		return rs, err
 	}
 
 	if err := <-done; err != nil {
@@ -1030,24 +1662,32 @@ func pushHashes(
 	return rs, nil
 }
 
-func (r *Remote) updateShallow(o *FetchOptions, resp *packp.UploadPackResponse) error {
-	if o.Depth == 0 || len(resp.Shallows) == 0 {
+// updateShallow adds the shallow commits sent by the server to the shallow
+// file of the repository, and removes the unshallowed ones.
+func (r *Remote) updateShallow(resp *packp.UploadPackResponse) error {
+	if len(resp.Shallows) == 0 && len(resp.Unshallows) == 0 {
 		return nil
 	}
 
-	shallows, err := r.s.Shallow()
+	current, err := r.s.Shallow()
 	if err != nil {
 		return err
 	}
 
-outer:
-	for _, s := range resp.Shallows {
-		for _, oldS := range shallows {
-			if s == oldS {
-				continue outer
-			}
+	unshallows := make(map[plumbing.Hash]bool)
+	for _, h := range resp.Unshallows {
+		unshallows[h] = true
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	var shallows []plumbing.Hash
+	for _, h := range append(current, resp.Shallows...) {
+		if seen[h] || unshallows[h] {
+			continue
 		}
-		shallows = append(shallows, s)
+
+		seen[h] = true
+		shallows = append(shallows, h)
 	}
 
 	return r.s.SetShallow(shallows)
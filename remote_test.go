@@ -5,14 +5,20 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -132,6 +138,55 @@ func (s *RemoteSuite) TestFetchContext(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *RemoteSuite) TestFetchInsteadOf(c *C) {
+	url := s.GetLocalRepositoryURL(fixtures.ByTag("tags").One())
+
+	sto := memory.NewStorage()
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.URLs[filepath.Dir(url)+"/"] = &config.URL{
+		Name:      filepath.Dir(url) + "/",
+		InsteadOf: []string{"foo:"},
+	}
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := newRemote(sto, &config.RemoteConfig{
+		URLs: []string{"foo:" + filepath.Base(url)},
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "f7b877701fbf855b44c0a9e86f3fdce2c298b07f"),
+	})
+}
+
+func (s *RemoteSuite) TestFetchWithHTTPConfig(c *C) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Foo")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sto := memory.NewStorage()
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("http").Subsection(server.URL).AddOption("extraHeader", "X-Foo: bar")
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{server.URL + "/repo.git"},
+	})
+
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, Equals, transport.ErrRepositoryNotFound)
+	c.Assert(header, Equals, "bar")
+}
+
 func (s *RemoteSuite) TestFetchWithAllTags(c *C) {
 	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
 		URLs: []string{s.GetLocalRepositoryURL(fixtures.ByTag("tags").One())},
@@ -168,6 +223,164 @@ func (s *RemoteSuite) TestFetchWithNoTags(c *C) {
 
 }
 
+func (s *RemoteSuite) TestFetchWithTagOpt(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs:   []string{s.GetLocalRepositoryURL(fixtures.ByTag("tags").One())},
+		TagOpt: config.TagOptNoTags,
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/*:refs/remotes/origin/*"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "f7b877701fbf855b44c0a9e86f3fdce2c298b07f"),
+	})
+}
+
+func (s *RemoteSuite) TestFetchPrune(c *C) {
+	sto := memory.NewStorage()
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{s.GetBasicLocalRepositoryURL()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Prune: config.OptBoolTrue,
+	})
+
+	err := r.Fetch(&FetchOptions{})
+	c.Assert(err, IsNil)
+
+	c.Assert(sto.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/foo", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)), IsNil)
+	c.Assert(sto.SetReference(plumbing.NewSymbolicReference(
+		"refs/remotes/origin/HEAD", "refs/remotes/origin/master",
+	)), IsNil)
+
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, IsNil)
+
+	_, err = sto.Reference("refs/remotes/origin/foo")
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	for _, name := range []plumbing.ReferenceName{
+		"refs/remotes/origin/HEAD",
+		"refs/remotes/origin/master",
+		"refs/remotes/origin/branch",
+	} {
+		_, err = sto.Reference(name)
+		c.Assert(err, IsNil)
+	}
+
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *RemoteSuite) TestFetchWithResultPrune(c *C) {
+	sto := memory.NewStorage()
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{s.GetBasicLocalRepositoryURL()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+
+	res, err := r.FetchWithResult(context.Background(), &FetchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(res.Pruned, HasLen, 0)
+
+	c.Assert(sto.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/foo", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)), IsNil)
+
+	res, err = r.FetchWithResult(context.Background(), &FetchOptions{})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+	c.Assert(res.Pruned, HasLen, 0)
+
+	res, err = r.FetchWithResult(context.Background(), &FetchOptions{Prune: config.OptBoolTrue})
+	c.Assert(err, IsNil)
+	c.Assert(res.Pruned, DeepEquals, []plumbing.ReferenceName{"refs/remotes/origin/foo"})
+
+	_, err = sto.Reference("refs/remotes/origin/foo")
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	res, err = r.FetchWithResult(context.Background(), &FetchOptions{Prune: config.OptBoolTrue})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+	c.Assert(res.Pruned, HasLen, 0)
+}
+
+func (s *RemoteSuite) TestFetchPrunePrecedence(c *C) {
+	sto := memory.NewStorage()
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.Fetch.Prune = config.OptBoolTrue
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{s.GetBasicLocalRepositoryURL()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Prune: config.OptBoolFalse,
+	})
+
+	err = r.Fetch(&FetchOptions{})
+	c.Assert(err, IsNil)
+
+	c.Assert(sto.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/foo", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)), IsNil)
+
+	res, err := r.FetchWithResult(context.Background(), &FetchOptions{})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+	c.Assert(res.Pruned, HasLen, 0)
+
+	r.c.Prune = config.OptBoolTrue
+	res, err = r.FetchWithResult(context.Background(), &FetchOptions{Prune: config.OptBoolFalse})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+	c.Assert(res.Pruned, HasLen, 0)
+
+	res, err = r.FetchWithResult(context.Background(), &FetchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(res.Pruned, DeepEquals, []plumbing.ReferenceName{"refs/remotes/origin/foo"})
+}
+
+func (s *RemoteSuite) TestFetchPruneTagsFromConfig(c *C) {
+	sto := memory.NewStorage()
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.Fetch.Prune = config.OptBoolTrue
+	cfg.Fetch.PruneTags = config.OptBoolTrue
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{s.GetLocalRepositoryURL(fixtures.ByTag("tags").One())},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+
+	c.Assert(sto.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/tags/stale", "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+	)), IsNil)
+
+	res, err := r.FetchWithResult(context.Background(), &FetchOptions{Tags: NoTags})
+	c.Assert(err, IsNil)
+	c.Assert(res.Pruned, DeepEquals, []plumbing.ReferenceName{"refs/tags/stale"})
+
+	ref, err := sto.Reference("refs/tags/lightweight-tag")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "f7b877701fbf855b44c0a9e86f3fdce2c298b07f")
+}
+
+func (s *RemoteSuite) TestFetchWithUploadPack(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name:       DefaultRemoteName,
+		URLs:       []string{s.GetBasicLocalRepositoryURL()},
+		UploadPack: "non-existent-upload-pack",
+	})
+
+	err := r.Fetch(&FetchOptions{})
+	c.Assert(err, NotNil)
+}
+
 func (s *RemoteSuite) TestFetchWithDepth(c *C) {
 	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
 		URLs: []string{s.GetBasicLocalRepositoryURL()},
@@ -432,6 +645,198 @@ func (s *RemoteSuite) TestPushToEmptyRepository(c *C) {
 
 }
 
+func (s *RemoteSuite) TestPushWithProgressHandler(c *C) {
+	url := c.MkDir()
+	_, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	progress := &progressRecorder{}
+	err = r.Push(&PushOptions{
+		RefSpecs:        []config.RefSpec{"refs/heads/master:refs/heads/master"},
+		ProgressHandler: progress,
+	})
+	c.Assert(err, IsNil)
+
+	e, ok := progress.done(plumbing.WritingObjects, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Current, Equals, int64(28))
+	c.Assert(e.Bytes > 0, Equals, true)
+}
+
+func (s *RemoteSuite) TestPushPushInsteadOf(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	cfg, err := sto.Config()
+	c.Assert(err, IsNil)
+	cfg.URLs["bar:"] = &config.URL{Name: "bar:", InsteadOf: []string{"foo:"}}
+	cfg.URLs[url] = &config.URL{Name: url, PushInsteadOf: []string{"foo:"}}
+	c.Assert(sto.SetConfig(cfg), IsNil)
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"foo:"},
+	})
+
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"},
+	})
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+}
+
+func (s *RemoteSuite) TestPushWithPushRefSpecs(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+		Push: []config.RefSpec{"refs/heads/master:refs/heads/foo"},
+	})
+
+	err = r.Push(&PushOptions{})
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/foo": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+
+	_, err = server.Reference("refs/heads/master", false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RemoteSuite) TestPushWithPushRefSpecsWithoutDst(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{url},
+		Push: []config.RefSpec{"HEAD", "+branch"},
+	})
+
+	err = r.Push(&PushOptions{})
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"refs/heads/branch": "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	})
+}
+
+func (s *RemoteSuite) TestPushToPushURLs(c *C) {
+	var servers []*Repository
+	var urls []string
+	for i := 0; i < 2; i++ {
+		url := c.MkDir()
+		server, err := PlainInit(url, true)
+		c.Assert(err, IsNil)
+
+		servers = append(servers, server)
+		urls = append(urls, url)
+	}
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:     DefaultRemoteName,
+		URLs:     []string{"http://non-existent/foo.git"},
+		PushURLs: urls,
+	})
+
+	result, err := r.PushWithResult(context.Background(), &PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.Refs, HasLen, 2)
+	for i, ref := range result.Refs {
+		c.Assert(ref.Name, Equals, plumbing.ReferenceName("refs/heads/master"))
+		c.Assert(ref.Status, Equals, PushOK)
+		c.Assert(ref.URL, Equals, urls[i])
+	}
+
+	for _, server := range servers {
+		AssertReferences(c, server, map[string]string{
+			"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		})
+	}
+
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"},
+	})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *RemoteSuite) TestPushMirror(c *C) {
+	url := c.MkDir()
+	server, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	srcFs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r := newRemote(sto, &config.RemoteConfig{
+		Name:   DefaultRemoteName,
+		URLs:   []string{url},
+		Mirror: true,
+	})
+
+	o := &PushOptions{}
+	err = r.Push(o)
+	c.Assert(err, IsNil)
+	c.Assert(o.RefSpecs, HasLen, 0)
+
+	c.Assert(server.Storer.SetReference(plumbing.NewReferenceFromStrings(
+		"refs/heads/foo", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	)), IsNil)
+
+	err = r.Push(&PushOptions{})
+	c.Assert(err, IsNil)
+
+	expected := make(map[string]string)
+	iter, err := sto.IterReferences()
+	c.Assert(err, IsNil)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			expected[ref.Name().String()] = ref.Hash().String()
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(expected, Not(HasLen), 0)
+
+	AssertReferences(c, server, expected)
+
+	_, err = server.Reference("refs/heads/foo", false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
 func (s *RemoteSuite) TestPushContext(c *C) {
 	url := c.MkDir()
 	_, err := PlainInit(url, true)
@@ -644,6 +1049,212 @@ func (s *RemoteSuite) TestPushNewReferenceAndDeleteInBatch(c *C) {
 	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
 }
 
+func (s *RemoteSuite) TestPushAtomic(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	url := c.MkDir()
+	server, err := PlainClone(url, true, &CloneOptions{
+		URL: fs.Root(),
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainClone(c.MkDir(), true, &CloneOptions{
+		URL: url,
+	})
+	c.Assert(err, IsNil)
+
+	remote, err := r.Remote(DefaultRemoteName)
+	c.Assert(err, IsNil)
+
+	ref, err := r.Reference(plumbing.ReferenceName("refs/heads/master"), true)
+	c.Assert(err, IsNil)
+
+	err = remote.Push(&PushOptions{
+		Atomic: true,
+		RefSpecs: []config.RefSpec{
+			"refs/heads/master:refs/heads/branch2",
+			":refs/heads/branch",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/branch2": ref.Hash().String(),
+	})
+
+	_, err = server.Storer.Reference(plumbing.ReferenceName("refs/heads/branch"))
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RemoteSuite) TestPushOptions(c *C) {
+	fs := fixtures.Basic().One().DotGit()
+	url := c.MkDir()
+	server, err := PlainClone(url, true, &CloneOptions{
+		URL: fs.Root(),
+	})
+	c.Assert(err, IsNil)
+
+	r, err := PlainClone(c.MkDir(), true, &CloneOptions{
+		URL: url,
+	})
+	c.Assert(err, IsNil)
+
+	remote, err := r.Remote(DefaultRemoteName)
+	c.Assert(err, IsNil)
+
+	o := &PushOptions{
+		Options: []string{"ci.skip"},
+		RefSpecs: []config.RefSpec{
+			"refs/heads/master:refs/heads/branch2",
+		},
+	}
+
+	err = remote.Push(o)
+	c.Assert(err, Equals, ErrPushOptionsNotSupported)
+
+	cfg, err := server.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("receive").SetOption("advertisePushOptions", "true")
+	c.Assert(server.Storer.SetConfig(cfg), IsNil)
+
+	err = remote.Push(o)
+	c.Assert(err, IsNil)
+
+	ref, err := r.Reference(plumbing.ReferenceName("refs/heads/master"), true)
+	c.Assert(err, IsNil)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/branch2": ref.Hash().String(),
+	})
+}
+
+func (s *RemoteSuite) TestPushWithResult(c *C) {
+	server, r := s.cloneServerAndClient(c)
+
+	remote, err := r.Remote(DefaultRemoteName)
+	c.Assert(err, IsNil)
+
+	master := "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+	branch := "e8d3ffab552895c19b9fcf7aa264d277cde33881"
+
+	result, err := remote.PushWithResult(context.Background(), &PushOptions{
+		RefSpecs: []config.RefSpec{
+			"refs/heads/master:refs/heads/branch2",
+			"refs/heads/master:refs/heads/branch",
+			"refs/remotes/origin/branch:refs/heads/branch",
+		},
+	})
+	c.Assert(err, ErrorMatches, "non-fast-forward update: refs/heads/branch")
+	c.Assert(result.Refs, HasLen, 3)
+
+	c.Assert(result.Refs[0].Name, Equals, plumbing.ReferenceName("refs/heads/branch2"))
+	c.Assert(result.Refs[0].Status, Equals, PushOK)
+	c.Assert(result.Refs[1].Name, Equals, plumbing.ReferenceName("refs/heads/branch"))
+	c.Assert(result.Refs[1].Status, Equals, PushNonFastForward)
+	c.Assert(result.Refs[2].Status, Equals, PushUpToDate)
+	c.Assert(result.Updated(), DeepEquals, result.Refs[:1])
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/branch2": master,
+		"refs/heads/branch":  branch,
+	})
+
+	AssertReferences(c, r, map[string]string{
+		"refs/remotes/origin/branch2": master,
+	})
+}
+
+func (s *RemoteSuite) TestPushAtomicRejected(c *C) {
+	server, r := s.cloneServerAndClient(c)
+
+	result, err := r.PushWithResult(context.Background(), &PushOptions{
+		Atomic: true,
+		RefSpecs: []config.RefSpec{
+			"refs/heads/master:refs/heads/branch2",
+			"refs/heads/master:refs/heads/branch",
+		},
+	})
+	c.Assert(err, ErrorMatches, "non-fast-forward update: refs/heads/branch")
+	c.Assert(result.Refs, HasLen, 2)
+	c.Assert(result.Refs[0].Status, Equals, PushRejected)
+	c.Assert(result.Refs[0].Message, Equals, "atomic push failed")
+	c.Assert(result.Refs[1].Status, Equals, PushNonFastForward)
+
+	_, err = server.Storer.Reference(plumbing.ReferenceName("refs/heads/branch2"))
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RemoteSuite) TestPushForceWithLease(c *C) {
+	server, r := s.cloneServerAndClient(c)
+
+	master := "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+	result, err := r.PushWithResult(context.Background(), &PushOptions{
+		RefSpecs:       []config.RefSpec{"refs/heads/master:refs/heads/branch"},
+		ForceWithLease: &ForceWithLease{},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.Refs, HasLen, 1)
+	c.Assert(result.Refs[0].Status, Equals, PushOK)
+	c.Assert(result.Refs[0].Old.String(), Equals, "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/branch": master,
+	})
+
+	AssertReferences(c, r, map[string]string{
+		"refs/remotes/origin/branch": master,
+	})
+}
+
+func (s *RemoteSuite) TestPushForceWithLeaseStale(c *C) {
+	server, r := s.cloneServerAndClient(c)
+
+	branch := "e8d3ffab552895c19b9fcf7aa264d277cde33881"
+	o := &PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/branch"},
+		ForceWithLease: &ForceWithLease{
+			Expected: map[plumbing.ReferenceName]plumbing.Hash{
+				"refs/heads/branch": plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+			},
+		},
+	}
+
+	result, err := r.PushWithResult(context.Background(), o)
+	c.Assert(err, ErrorMatches, "stale info: refs/heads/branch")
+	c.Assert(result.Refs, HasLen, 1)
+	c.Assert(result.Refs[0].Status, Equals, PushStaleInfo)
+
+	// the remote-tracking reference is used when there is no expected value
+	err = r.Storer.SetReference(plumbing.NewHashReference(
+		"refs/remotes/origin/branch",
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	))
+	c.Assert(err, IsNil)
+
+	o.ForceWithLease.Expected = nil
+	result, err = r.PushWithResult(context.Background(), o)
+	c.Assert(err, ErrorMatches, "stale info: refs/heads/branch")
+	c.Assert(result.Refs[0].Status, Equals, PushStaleInfo)
+
+	AssertReferences(c, server, map[string]string{
+		"refs/heads/branch": branch,
+	})
+}
+
+// cloneServerAndClient opens a copy of the basic fixture as server repository
+// and returns it along with a clone of it.
+func (s *RemoteSuite) cloneServerAndClient(c *C) (server, client *Repository) {
+	url := fixtures.Basic().One().DotGit().Root()
+	server, err := PlainOpen(url)
+	c.Assert(err, IsNil)
+
+	client, err = PlainClone(c.MkDir(), true, &CloneOptions{
+		URL: url,
+	})
+	c.Assert(err, IsNil)
+
+	return server, client
+}
+
 func (s *RemoteSuite) TestPushInvalidEndpoint(c *C) {
 	r := newRemote(nil, &config.RemoteConfig{Name: "foo", URLs: []string{"http://\\"}})
 	err := r.Push(&PushOptions{RemoteName: "foo"})
@@ -784,13 +1395,10 @@ func (s *RemoteSuite) TestUpdateShallows(c *C) {
 	c.Assert(len(shallows), Equals, 0)
 
 	resp := new(packp.UploadPackResponse)
-	o := &FetchOptions{
-		Depth: 1,
-	}
 
 	for _, t := range tests {
 		resp.Shallows = t.hashes
-		err = remote.updateShallow(o, resp)
+		err = remote.updateShallow(resp)
 		c.Assert(err, IsNil)
 
 		shallow, err := remote.s.Shallow()
@@ -800,6 +1408,116 @@ func (s *RemoteSuite) TestUpdateShallows(c *C) {
 	}
 }
 
+func (s *RemoteSuite) TestUpdateShallowsWithUnshallows(c *C) {
+	hashes := []plumbing.Hash{
+		plumbing.NewHash("0000000000000000000000000000000000000001"),
+		plumbing.NewHash("0000000000000000000000000000000000000002"),
+		plumbing.NewHash("0000000000000000000000000000000000000003"),
+	}
+
+	remote := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+	})
+
+	c.Assert(remote.s.SetShallow(hashes[0:2]), IsNil)
+
+	resp := new(packp.UploadPackResponse)
+	resp.Shallows = hashes[2:3]
+	resp.Unshallows = hashes[0:1]
+	c.Assert(remote.updateShallow(resp), IsNil)
+
+	shallow, err := remote.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallow, DeepEquals, hashes[1:3])
+}
+
+func (s *RemoteSuite) TestFetchWithShallowSince(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		ShallowSince: time.Unix(1427802711, 0),
+		Tags:         NoTags,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	shallows, err := r.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a"),
+	})
+}
+
+func (s *RemoteSuite) TestFetchWithShallowExclude(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	s.testFetch(c, r, &FetchOptions{
+		ShallowExclude: []string{"branch"},
+		Tags:           NoTags,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	shallows, err := r.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+}
+
+func (s *RemoteSuite) TestFetchWithDeepenAndUnshallow(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	refspecs := []config.RefSpec{
+		config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+	}
+
+	err := r.Fetch(&FetchOptions{Depth: 1, Tags: NoTags, RefSpecs: refspecs})
+	c.Assert(err, IsNil)
+
+	err = r.Fetch(&FetchOptions{Deepen: 2, Tags: NoTags, RefSpecs: refspecs})
+	c.Assert(err, IsNil)
+
+	shallows, err := r.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []plumbing.Hash{
+		plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a"),
+	})
+
+	err = r.Fetch(&FetchOptions{Unshallow: true, Tags: NoTags, RefSpecs: refspecs})
+	c.Assert(err, IsNil)
+
+	shallows, err = r.s.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, HasLen, 0)
+
+	_, err = object.GetCommit(r.s, plumbing.NewHash(
+		"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+	))
+	c.Assert(err, IsNil)
+}
+
+func (s *RemoteSuite) TestFetchShallowOptionsConflict(c *C) {
+	r := newRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	err := r.Fetch(&FetchOptions{Depth: 1, Unshallow: true})
+	c.Assert(err, Equals, ErrShallowOptionsConflict)
+}
+
 func (s *RemoteSuite) TestUseRefDeltas(c *C) {
 	url := c.MkDir()
 	_, err := PlainInit(url, true)
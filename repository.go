@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -18,8 +19,11 @@ import (
 	"gopkg.in/src-d/go-git.v4/internal/revision"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
@@ -27,6 +31,7 @@ import (
 
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-billy.v4/util"
 )
 
 // GitDirName this is a special folder where all the git stuff is.
@@ -53,6 +58,8 @@ var (
 	ErrIsBareRepository          = errors.New("worktree not available in a bare repository")
 	ErrUnableToResolveCommit     = errors.New("unable to resolve commit")
 	ErrPackedObjectsNotSupported = errors.New("Packed objects not supported")
+	ErrEmptyBundle               = errors.New("refusing to create an empty bundle")
+	ErrWorktreeConfigNotEnabled  = errors.New("worktree config requires extensions.worktreeConfig")
 )
 
 // Repository represents a git repository
@@ -61,6 +68,9 @@ type Repository struct {
 
 	r  map[string]*Remote
 	wt billy.Filesystem
+	// global are the system and global config scopes used by the remote
+	// operations, nil unless loaded with LoadGlobalConfig.
+	global *format.Config
 }
 
 // Init creates an empty git repository, based on the given Storer and worktree.
@@ -178,6 +188,15 @@ func Open(s storage.Storer, worktree billy.Filesystem) (*Repository, error) {
 		return nil, err
 	}
 
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if c := promisorRemote(cfg); c != nil {
+		s = newPromisorStorer(s, c, nil)
+	}
+
 	return newRepository(s, worktree), nil
 }
 
@@ -438,6 +457,249 @@ func (r *Repository) Config() (*config.Config, error) {
 	return r.Storer.Config()
 }
 
+// worktreeConfigFile is the file of the worktree scope, in the git directory.
+const worktreeConfigFile = "config.worktree"
+
+// ConfigScoped returns the config of the given scope alone, as stored, to be
+// edited and saved with SetConfigScoped. The include directives are not
+// expanded. Use MergedConfig to read the effective config. The worktree scope
+// returns ErrWorktreeConfigNotEnabled unless extensions.worktreeConfig is
+// enabled in a repository stored in a filesystem.
+func (r *Repository) ConfigScoped(scope config.Scope) (*config.Config, error) {
+	switch scope {
+	case config.LocalScope:
+		return r.Storer.Config()
+	case config.WorktreeScope:
+		fs, err := worktreeConfigFilesystem(r.Storer)
+		if err != nil {
+			return nil, err
+		}
+
+		if fs == nil {
+			return nil, ErrWorktreeConfigNotEnabled
+		}
+
+		raw, err := readRawConfig(fs, worktreeConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return config.FromRaw(raw)
+	}
+
+	return config.LoadConfig(scope)
+}
+
+// SetConfigScoped writes the given config to the given scope. The worktree
+// scope returns ErrWorktreeConfigNotEnabled unless extensions.worktreeConfig
+// is enabled in a repository stored in a filesystem.
+func (r *Repository) SetConfigScoped(scope config.Scope, cfg *config.Config) error {
+	switch scope {
+	case config.LocalScope:
+		return r.Storer.SetConfig(cfg)
+	case config.WorktreeScope:
+		fs, err := worktreeConfigFilesystem(r.Storer)
+		if err != nil {
+			return err
+		}
+
+		if fs == nil {
+			return ErrWorktreeConfigNotEnabled
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		b, err := cfg.Marshal()
+		if err != nil {
+			return err
+		}
+
+		return util.WriteFile(fs, worktreeConfigFile, b, 0644)
+	}
+
+	return config.SaveConfig(scope, cfg)
+}
+
+// MergedConfig returns the effective config of the repository: the system,
+// global, local and worktree scopes merged in increasing order of precedence,
+// with their include and includeIf directives expanded, as git reads it.
+func (r *Repository) MergedConfig() (*config.Config, error) {
+	return mergedConfig(r.Storer)
+}
+
+// LoadGlobalConfig reads the system and global config scopes, to be used by
+// the remote operations of the repository along with its local config: the
+// url.<base>.insteadOf rules and the http settings. The scopes are read once,
+// when it is called. By default the remote operations only use the config of
+// the repository, so they do not depend on the configuration of the host.
+func (r *Repository) LoadGlobalConfig() error {
+	ctx, err := includeContext(r.Storer)
+	if err != nil {
+		return err
+	}
+
+	global, err := loadGlobalConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.global = global
+	setPromisorGlobalConfig(r.Storer, global)
+	return nil
+}
+
+// mergedConfig returns the merged config of the repository of the given
+// storage, only the system and global scopes if s is nil.
+func mergedConfig(s storage.Storer) (*config.Config, error) {
+	ctx, err := includeContext(s)
+	if err != nil {
+		return nil, err
+	}
+
+	global, err := loadGlobalConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return repositoryConfig(global, s, ctx)
+}
+
+// loadGlobalConfig returns the system and global scopes merged.
+func loadGlobalConfig(ctx *config.IncludeContext) (*format.Config, error) {
+	raw := format.New()
+	for _, scope := range []config.Scope{config.SystemScope, config.GlobalScope} {
+		scoped, err := config.LoadRaw(scope, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Merge(raw, scoped)
+	}
+
+	return raw, nil
+}
+
+// repositoryConfig returns the config of the repository of the given storage
+// merged over the given system and global scopes. Both the storage and the
+// scopes may be nil.
+func repositoryConfig(global *format.Config, s storage.Storer, ctx *config.IncludeContext) (*config.Config, error) {
+	raw := format.New()
+	if global != nil {
+		config.Merge(raw, global)
+	}
+
+	if s != nil {
+		if err := mergeRepositoryConfig(raw, s, ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return config.FromRaw(raw)
+}
+
+// mergeRepositoryConfig merges the local and worktree scopes of the
+// repository of the given storage into raw.
+func mergeRepositoryConfig(raw *format.Config, s storage.Storer, ctx *config.IncludeContext) error {
+	local, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	if _, err := local.Marshal(); err != nil {
+		return err
+	}
+
+	dir := ctx.GitDir
+	scoped, err := config.ExpandIncludes(local.Raw, dir, ctx)
+	if err != nil {
+		return err
+	}
+
+	config.Merge(raw, scoped)
+
+	fs, err := worktreeConfigFilesystem(s)
+	if err != nil || fs == nil {
+		return err
+	}
+
+	wt, err := readRawConfig(fs, worktreeConfigFile)
+	if err != nil {
+		return err
+	}
+
+	wt, err = config.ExpandIncludes(wt, dir, ctx)
+	if err != nil {
+		return err
+	}
+
+	config.Merge(raw, wt)
+	return nil
+}
+
+// includeContext returns the context of the includeIf conditions of the
+// repository of the given storage, an empty one if s is nil.
+func includeContext(s storage.Storer) (*config.IncludeContext, error) {
+	ctx := &config.IncludeContext{}
+	if s == nil {
+		return ctx, nil
+	}
+
+	if fs, ok := s.(interface{ Filesystem() billy.Filesystem }); ok {
+		ctx.GitDir = fs.Filesystem().Root()
+	}
+
+	head, err := s.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	if head != nil && head.Type() == plumbing.SymbolicReference && head.Target().IsBranch() {
+		ctx.Branch = head.Target().Short()
+	}
+
+	return ctx, nil
+}
+
+// worktreeConfigFilesystem returns the filesystem containing the config of
+// the worktree scope, nil if extensions.worktreeConfig is not enabled or the
+// storage is not a filesystem.
+func worktreeConfigFilesystem(s storage.Storer) (billy.Filesystem, error) {
+	fs, ok := s.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return nil, nil
+	}
+
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Raw.Section("extensions").Option("worktreeConfig") != "true" {
+		return nil, nil
+	}
+
+	return fs.Filesystem(), nil
+}
+
+func readRawConfig(fs billy.Filesystem, filename string) (raw *format.Config, err error) {
+	raw = format.New()
+
+	f, err := fs.Open(filename)
+	if os.IsNotExist(err) {
+		return raw, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	err = format.NewDecoder(f).Decode(raw)
+	return raw, err
+}
+
 // Remote return a remote if exists
 func (r *Repository) Remote(name string) (*Remote, error) {
 	cfg, err := r.Storer.Config()
@@ -450,7 +712,15 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, ErrRemoteNotFound
 	}
 
-	return newRemote(r.Storer, c), nil
+	return r.newRemote(c), nil
+}
+
+// newRemote returns the Remote of the given config, using the global config
+// of the repository if loaded.
+func (r *Repository) newRemote(c *config.RemoteConfig) *Remote {
+	remote := newRemote(r.Storer, c)
+	remote.global = r.global
+	return remote
 }
 
 // Remotes returns a list with all the remotes
@@ -464,7 +734,7 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 
 	var i int
 	for _, c := range cfg.Remotes {
-		remotes[i] = newRemote(r.Storer, c)
+		remotes[i] = r.newRemote(c)
 		i++
 	}
 
@@ -477,7 +747,7 @@ func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 		return nil, err
 	}
 
-	remote := newRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	cfg, err := r.Storer.Config()
 	if err != nil {
@@ -714,28 +984,54 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		return err
 	}
 
+	if o.LoadGlobalConfig {
+		if err := r.LoadGlobalConfig(); err != nil {
+			return err
+		}
+	}
+
 	c := &config.RemoteConfig{
 		Name:  o.RemoteName,
 		URLs:  []string{o.URL},
 		Fetch: r.cloneRefSpec(o),
 	}
 
+	if !o.Filter.IsZero() {
+		c.Promisor = true
+		c.PartialCloneFilter = string(o.Filter)
+	}
+
 	if _, err := r.CreateRemote(c); err != nil {
 		return err
 	}
 
+	if c.Promisor {
+		if err := setPartialCloneConfig(r.Storer, c.Name); err != nil {
+			return err
+		}
+	}
+
 	ref, err := r.fetchAndUpdateReferences(ctx, &FetchOptions{
-		RefSpecs:   c.Fetch,
-		Depth:      o.Depth,
-		Auth:       o.Auth,
-		Progress:   o.Progress,
-		Tags:       o.Tags,
-		RemoteName: o.RemoteName,
+		RefSpecs:        c.Fetch,
+		Depth:           o.Depth,
+		ShallowSince:    o.ShallowSince,
+		ShallowExclude:  o.ShallowExclude,
+		Filter:          o.Filter,
+		Auth:            o.Auth,
+		Progress:        o.Progress,
+		ProgressHandler: o.ProgressHandler,
+		Tags:            o.Tags,
+		RemoteName:      o.RemoteName,
 	}, o.ReferenceName)
 	if err != nil {
 		return err
 	}
 
+	if c.Promisor {
+		r.Storer = newPromisorStorer(r.Storer, c, o.Auth)
+		setPromisorGlobalConfig(r.Storer, r.global)
+	}
+
 	if r.wt != nil && !o.NoCheckout {
 		w, err := r.Worktree()
 		if err != nil {
@@ -747,10 +1043,10 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 			return err
 		}
 
-		if err := w.Reset(&ResetOptions{
+		if err := w.reset(&ResetOptions{
 			Mode:   MergeReset,
 			Commit: head.Hash(),
-		}); err != nil {
+		}, o.ProgressHandler); err != nil {
 			return err
 		}
 
@@ -857,7 +1153,7 @@ func (r *Repository) fetchAndUpdateReferences(
 	}
 
 	objsUpdated := true
-	remoteRefs, err := remote.fetch(ctx, o)
+	remoteRefs, _, err := remote.fetch(ctx, o)
 	if err == NoErrAlreadyUpToDate {
 		objsUpdated = false
 	} else if err == packfile.ErrEmptyPackfile {
@@ -998,6 +1294,21 @@ func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
 	return remote.FetchContext(ctx, o)
 }
 
+// FetchWithResult fetches from the remote named as FetchOptions.RemoteName
+// and returns the references pruned. See Remote.FetchWithResult.
+func (r *Repository) FetchWithResult(ctx context.Context, o *FetchOptions) (*FetchResult, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	remote, err := r.Remote(o.RemoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.FetchWithResult(ctx, o)
+}
+
 // Push performs a push to the remote. Returns NoErrAlreadyUpToDate if
 // the remote was already up-to-date, from the remote named as
 // FetchOptions.RemoteName.
@@ -1025,6 +1336,22 @@ func (r *Repository) PushContext(ctx context.Context, o *PushOptions) error {
 	return remote.PushContext(ctx, o)
 }
 
+// PushWithResult performs a push to the remote named as
+// PushOptions.RemoteName and returns the status of every pushed reference.
+// See Remote.PushWithResult.
+func (r *Repository) PushWithResult(ctx context.Context, o *PushOptions) (*PushResult, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	remote, err := r.Remote(o.RemoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.PushWithResult(ctx, o)
+}
+
 // Log returns the commit history from the given LogOptions.
 func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 	h := o.From
@@ -1406,6 +1733,9 @@ type RepackConfig struct {
 	// OnlyDeletePacksOlderThan if set to non-zero value
 	// selects only objects older than the time provided.
 	OnlyDeletePacksOlderThan time.Time
+	// ProgressHandler receives the progress events of the objects
+	// enumerated, compressed and written to the new pack.
+	ProgressHandler plumbing.ProgressHandler
 }
 
 func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
@@ -1454,6 +1784,11 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 	for h := range ow.seen {
 		objs = append(objs, h)
 	}
+
+	meter := plumbing.NewProgressMeter(cfg.ProgressHandler,
+		plumbing.EnumeratingObjects, int64(len(objs)))
+	meter.Done()
+
 	pfw, ok := r.Storer.(storer.PackfileWriter)
 	if !ok {
 		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
@@ -1468,6 +1803,7 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 		return h, err
 	}
 	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas)
+	enc.SetProgressHandler(cfg.ProgressHandler)
 	h, err = enc.Encode(objs, scfg.Pack.Window)
 	if err != nil {
 		return h, err
@@ -1491,3 +1827,98 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 
 	return h, err
 }
+
+// CreateBundle writes to w a bundle with the given references and the objects
+// reachable from them, excluding the objects reachable from excludes. The
+// parents of the bundled commits that are excluded are recorded as the
+// prerequisites of the bundle.
+func (r *Repository) CreateBundle(refs []plumbing.ReferenceName,
+	excludes []plumbing.Hash, w io.Writer) error {
+	h := bundle.NewHeader()
+	tips := make([]plumbing.Hash, 0, len(refs))
+	for _, name := range refs {
+		ref, err := r.Reference(name, true)
+		if err != nil {
+			return err
+		}
+
+		h.References = append(h.References,
+			plumbing.NewHashReference(name, ref.Hash()))
+		tips = append(tips, ref.Hash())
+	}
+
+	objs, err := revlist.Objects(r.Storer, tips, excludes)
+	if err != nil {
+		return err
+	}
+
+	if len(objs) == 0 {
+		return ErrEmptyBundle
+	}
+
+	h.Prerequisites, err = r.bundlePrerequisites(objs)
+	if err != nil {
+		return err
+	}
+
+	if err := bundle.NewEncoder(w).Encode(h); err != nil {
+		return err
+	}
+
+	cfg, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, r.Storer, false).Encode(objs, cfg.Pack.Window)
+	return err
+}
+
+// bundlePrerequisites returns the parents of the given commits not included
+// in objs, with their subject as comment.
+func (r *Repository) bundlePrerequisites(objs []plumbing.Hash) ([]bundle.Prerequisite, error) {
+	included := make(map[plumbing.Hash]bool, len(objs))
+	for _, h := range objs {
+		included[h] = true
+	}
+
+	var prerequisites []bundle.Prerequisite
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range objs {
+		c, err := object.GetCommit(r.Storer, h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range c.ParentHashes {
+			if included[p] || seen[p] {
+				continue
+			}
+
+			seen[p] = true
+			prerequisites = append(prerequisites, bundle.Prerequisite{
+				Hash:    p,
+				Comment: r.commitSubject(p),
+			})
+		}
+	}
+
+	sort.Slice(prerequisites, func(i, j int) bool {
+		return prerequisites[i].Hash.String() < prerequisites[j].Hash.String()
+	})
+
+	return prerequisites, nil
+}
+
+func (r *Repository) commitSubject(h plumbing.Hash) string {
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return ""
+	}
+
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
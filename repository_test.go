@@ -1,6 +1,8 @@
 package git
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
 	"fmt"
@@ -19,9 +21,11 @@ import (
 	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/bundle"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	transportbundle "gopkg.in/src-d/go-git.v4/plumbing/transport/bundle"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -223,6 +227,132 @@ func (s *RepositorySuite) TestCreateRemoteAndRemote(c *C) {
 	c.Assert(alt.Config().Name, Equals, "foo")
 }
 
+func (s *RepositorySuite) TestMergedConfig(c *C) {
+	defer IsolateConfig(c)()
+
+	home := os.Getenv("HOME")
+	err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte(""+
+		"[user]\n\tname = foo\n\temail = foo@foo.com\n"+
+		"[includeIf \"onbranch:master\"]\n\tpath = ~/master.inc\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(home, "master.inc"), []byte("[core]\n\tcommentChar = %\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := PlainInit(c.MkDir(), false)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.MergedConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.User.Name, Equals, "foo")
+	c.Assert(cfg.User.Email, Equals, "foo@foo.com")
+	c.Assert(cfg.Core.CommentChar, Equals, "%")
+
+	local, err := r.ConfigScoped(config.LocalScope)
+	c.Assert(err, IsNil)
+	local.User.Email = "bar@bar.com"
+	c.Assert(r.SetConfigScoped(config.LocalScope, local), IsNil)
+
+	cfg, err = r.MergedConfig()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.User.Name, Equals, "foo")
+	c.Assert(cfg.User.Email, Equals, "bar@bar.com")
+
+	global, err := r.ConfigScoped(config.GlobalScope)
+	c.Assert(err, IsNil)
+	c.Assert(global.User.Email, Equals, "foo@foo.com")
+	c.Assert(global.User.Name, Equals, "foo")
+}
+
+func (s *RepositorySuite) TestLoadGlobalConfig(c *C) {
+	defer IsolateConfig(c)()
+
+	url := s.GetBasicLocalRepositoryURL()
+	err := ioutil.WriteFile(filepath.Join(os.Getenv("HOME"), ".gitconfig"), []byte(""+
+		"[url \""+url+"\"]\n\tinsteadOf = fixtures:basic\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := Init(memory.NewStorage(), nil)
+	c.Assert(err, IsNil)
+
+	remote, err := r.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"fixtures:basic"},
+	})
+	c.Assert(err, IsNil)
+
+	_, err = remote.List(&ListOptions{})
+	c.Assert(err, NotNil)
+
+	c.Assert(r.LoadGlobalConfig(), IsNil)
+	remote, err = r.Remote(DefaultRemoteName)
+	c.Assert(err, IsNil)
+
+	refs, err := remote.List(&ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(refs, Not(HasLen), 0)
+}
+
+func (s *RepositorySuite) TestLoadGlobalConfigPush(c *C) {
+	defer IsolateConfig(c)()
+
+	url := c.MkDir()
+	_, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	err = ioutil.WriteFile(filepath.Join(os.Getenv("HOME"), ".gitconfig"), []byte(""+
+		"[url \""+url+"\"]\n\tpushInsteadOf = fixtures:push\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "push",
+		URLs: []string{"fixtures:push"},
+	})
+	c.Assert(err, IsNil)
+
+	o := &PushOptions{RemoteName: "push", RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"}}
+	c.Assert(r.Push(o), NotNil)
+
+	c.Assert(r.LoadGlobalConfig(), IsNil)
+	c.Assert(r.Push(o), IsNil)
+}
+
+func (s *RepositorySuite) TestSetConfigScopedWorktree(c *C) {
+	defer IsolateConfig(c)()
+
+	r, err := PlainInit(c.MkDir(), false)
+	c.Assert(err, IsNil)
+
+	_, err = r.ConfigScoped(config.WorktreeScope)
+	c.Assert(err, Equals, ErrWorktreeConfigNotEnabled)
+
+	local, err := r.ConfigScoped(config.LocalScope)
+	c.Assert(err, IsNil)
+	c.Assert(r.SetConfigScoped(config.WorktreeScope, local), Equals, ErrWorktreeConfigNotEnabled)
+
+	local.User.Name = "foo"
+
+	local.Raw.Section("extensions").SetOption("worktreeConfig", "true")
+	c.Assert(r.SetConfigScoped(config.LocalScope, local), IsNil)
+
+	cfg, err := r.ConfigScoped(config.WorktreeScope)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.User.Name, Equals, "")
+	cfg.User.Name = "bar"
+	c.Assert(r.SetConfigScoped(config.WorktreeScope, cfg), IsNil)
+
+	local, err = r.ConfigScoped(config.LocalScope)
+	c.Assert(err, IsNil)
+	c.Assert(local.User.Name, Equals, "foo")
+
+	merged, err := r.MergedConfig()
+	c.Assert(err, IsNil)
+	c.Assert(merged.User.Name, Equals, "bar")
+}
+
 func (s *RepositorySuite) TestCreateRemoteInvalid(c *C) {
 	r, _ := Init(memory.NewStorage(), nil)
 	remote, err := r.CreateRemote(&config.RemoteConfig{})
@@ -570,6 +700,29 @@ func (s *RepositorySuite) TestPlainClone(c *C) {
 	c.Assert(cfg.Branches["master"].Name, Equals, "master")
 }
 
+func (s *RepositorySuite) TestPlainCloneWithProgressHandler(c *C) {
+	progress := &progressRecorder{}
+	_, err := PlainClone(c.MkDir(), false, &CloneOptions{
+		URL:             s.GetBasicLocalRepositoryURL(),
+		ProgressHandler: progress,
+	})
+	c.Assert(err, IsNil)
+
+	e, ok := progress.done(plumbing.ReceivingObjects, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Current, Equals, int64(31))
+	c.Assert(e.Current, Equals, e.Total)
+	c.Assert(e.Bytes > 0, Equals, true)
+
+	e, ok = progress.done(plumbing.ResolvingDeltas, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Current, Equals, e.Total)
+
+	e, ok = progress.done(plumbing.UpdatingFiles, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Current, Equals, int64(9))
+}
+
 func (s *RepositorySuite) TestPlainCloneWithRemoteName(c *C) {
 	r, err := PlainClone(c.MkDir(), false, &CloneOptions{
 		URL:        s.GetBasicLocalRepositoryURL(),
@@ -1341,12 +1494,13 @@ func (s *RepositorySuite) TestLogFileForEach(c *C) {
 	}
 
 	expectedIndex := 0
-	cIter.ForEach(func(commit *object.Commit) error {
+	err = cIter.ForEach(func(commit *object.Commit) error {
 		expectedCommitHash := commitOrder[expectedIndex]
 		c.Assert(commit.Hash.String(), Equals, expectedCommitHash.String())
 		expectedIndex += 1
 		return nil
 	})
+	c.Assert(err, IsNil)
 	c.Assert(expectedIndex, Equals, 1)
 }
 
@@ -2316,6 +2470,237 @@ func (s *RepositorySuite) TestRepackObjects(c *C) {
 	s.testRepackObjects(c, time.Time{}, 1)
 }
 
+func (s *RepositorySuite) TestRepackObjectsWithProgressHandler(c *C) {
+	if testing.Short() {
+		c.Skip("skipping test in short mode.")
+	}
+
+	srcFs := fixtures.ByTag("unpacked").One().DotGit()
+	sto := filesystem.NewStorage(srcFs, cache.NewObjectLRUDefault())
+
+	r, err := Open(sto, srcFs)
+	c.Assert(err, IsNil)
+
+	progress := &progressRecorder{}
+	err = r.RepackObjects(&RepackConfig{ProgressHandler: progress})
+	c.Assert(err, IsNil)
+
+	enumerated, ok := progress.done(plumbing.EnumeratingObjects, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(enumerated.Current > 0, Equals, true)
+
+	for _, phase := range []plumbing.ProgressPhase{
+		plumbing.CountingObjects,
+		plumbing.CompressingObjects,
+		plumbing.WritingObjects,
+	} {
+		e, ok := progress.done(phase, false)
+		c.Assert(ok, Equals, true)
+		c.Assert(e.Current, Equals, enumerated.Current)
+	}
+}
+
+func (s *RepositorySuite) createBundle(c *C, r *Repository,
+	refs []plumbing.ReferenceName, excludes []plumbing.Hash) string {
+	path := filepath.Join(c.MkDir(), "repo.bundle")
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	c.Assert(r.CreateBundle(refs, excludes, f), IsNil)
+	return path
+}
+
+func (s *RepositorySuite) TestCreateBundle(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	path := s.createBundle(c, r, []plumbing.ReferenceName{
+		plumbing.HEAD, plumbing.Master,
+	}, nil)
+
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	h := bundle.NewHeader()
+	c.Assert(bundle.NewDecoder(f).Decode(h), IsNil)
+	c.Assert(h.Version, Equals, 2)
+	c.Assert(h.Prerequisites, HasLen, 0)
+	c.Assert(h.References, DeepEquals, []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.HEAD,
+			plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+		plumbing.NewHashReference(plumbing.Master,
+			plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+	})
+
+	clone, err := PlainClone(c.MkDir(), false, &CloneOptions{URL: path})
+	c.Assert(err, IsNil)
+
+	head, err := clone.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	count := 0
+	objects, err := clone.Objects()
+	c.Assert(err, IsNil)
+	objects.ForEach(func(object.Object) error { count++; return nil })
+	c.Assert(count, Equals, 28)
+}
+
+func (s *RepositorySuite) TestCreateBundleIncremental(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	base := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/heads/base", base))
+	c.Assert(err, IsNil)
+
+	full := s.createBundle(c, r, []plumbing.ReferenceName{"refs/heads/base"}, nil)
+	incremental := s.createBundle(c, r, []plumbing.ReferenceName{plumbing.Master},
+		[]plumbing.Hash{base})
+
+	f, err := os.Open(incremental)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	h := bundle.NewHeader()
+	c.Assert(bundle.NewDecoder(f).Decode(h), IsNil)
+	c.Assert(h.Prerequisites, DeepEquals, []bundle.Prerequisite{
+		{Hash: base, Comment: "some code"},
+	})
+
+	_, err = Clone(memory.NewStorage(), nil, &CloneOptions{URL: incremental})
+	c.Assert(err, Equals, transportbundle.ErrMissingPrerequisites)
+
+	clone, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:           full,
+		ReferenceName: "refs/heads/base",
+		SingleBranch:  true,
+	})
+	c.Assert(err, IsNil)
+
+	_, err = clone.CreateRemote(&config.RemoteConfig{
+		Name: "incremental",
+		URLs: []string{incremental},
+	})
+	c.Assert(err, IsNil)
+
+	err = clone.Fetch(&FetchOptions{RemoteName: "incremental"})
+	c.Assert(err, IsNil)
+
+	ref, err := clone.Reference("refs/remotes/incremental/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash().String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	_, err = clone.CommitObject(ref.Hash())
+	c.Assert(err, IsNil)
+}
+
+func (s *RepositorySuite) TestCreateBundleEmpty(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	err = r.CreateBundle([]plumbing.ReferenceName{plumbing.Master},
+		[]plumbing.Hash{head.Hash()}, ioutil.Discard)
+	c.Assert(err, Equals, ErrEmptyBundle)
+}
+
+func (s *RepositorySuite) TestArchive(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = r.Archive(buf, &ArchiveOptions{
+		Prefix: "basic/",
+		Paths:  []string{"go", "CHANGELOG"},
+	})
+	c.Assert(err, IsNil)
+
+	var names []string
+	var comment string
+	tr := tar.NewReader(buf)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			comment = h.PAXRecords["comment"]
+			continue
+		}
+
+		names = append(names, h.Name)
+	}
+
+	c.Assert(comment, Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(names, DeepEquals, []string{
+		"basic/",
+		"basic/CHANGELOG",
+		"basic/go/",
+		"basic/go/example.go",
+	})
+}
+
+func (s *RepositorySuite) TestArchiveAnnotatedTag(c *C) {
+	dotgit := fixtures.ByTag("tags").One().DotGit()
+	r, err := Open(filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault()), nil)
+	c.Assert(err, IsNil)
+
+	tag, err := r.Tag("annotated-tag")
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = r.Archive(buf, &ArchiveOptions{Tree: tag.Hash(), Format: "zip"})
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, "f7b877701fbf855b44c0a9e86f3fdce2c298b07f")
+	c.Assert(len(zr.File) > 0, Equals, true)
+}
+
+func (s *RepositorySuite) TestArchiveTree(c *C) {
+	r, _ := Init(memory.NewStorage(), nil)
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = r.Archive(buf, &ArchiveOptions{Tree: commit.TreeHash, Format: "zip"})
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, "")
+	c.Assert(zr.File, HasLen, 13)
+
+	err = r.Archive(ioutil.Discard, &ArchiveOptions{Submodules: true})
+	c.Assert(err, Equals, ErrIsBareRepository)
+}
+
 func (s *RepositorySuite) TestRepackObjectsWithNoDelete(c *C) {
 	if testing.Short() {
 		c.Skip("skipping test in short mode.")
@@ -2390,7 +2775,7 @@ func (s *RepositorySuite) TestBrokenMultipleShallowFetch(c *C) {
 
 	shallows, err = r.Storer.Shallow()
 	c.Assert(err, IsNil)
-	c.Assert(len(shallows), Equals, 3)
+	c.Assert(len(shallows), Equals, 2)
 
 	ref, err = r.Reference("refs/heads/master", true)
 	c.Assert(err, IsNil)
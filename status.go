@@ -44,8 +44,8 @@ func (s Status) String() string {
 			continue
 		}
 
-		if status.Staging == Renamed {
-			path = fmt.Sprintf("%s -> %s", path, status.Extra)
+		if status.Staging == Renamed || status.Staging == Copied {
+			path = fmt.Sprintf("%s -> %s", status.Extra, path)
 		}
 
 		fmt.Fprintf(buf, "%c%c %s\n", status.Staging, status.Worktree, path)
@@ -61,6 +61,7 @@ type FileStatus struct {
 	// Worktree is the status of a file in the worktree
 	Worktree StatusCode
 	// Extra contains extra information, such as the previous name in a rename
+	// or the name of the source of a copy
 	Extra string
 }
 
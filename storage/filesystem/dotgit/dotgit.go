@@ -192,8 +192,14 @@ func (d *DotGit) Shallow() (billy.File, error) {
 // NewObjectPack return a writer for a new packfile, it saves the packfile to
 // disk and also generates and save the index for the given packfile.
 func (d *DotGit) NewObjectPack() (*PackWriter, error) {
+	return d.NewObjectPackWithProgress(nil)
+}
+
+// NewObjectPackWithProgress is NewObjectPack, sending the progress events of
+// the indexing of the packfile to h, if not nil.
+func (d *DotGit) NewObjectPackWithProgress(h plumbing.ProgressHandler) (*PackWriter, error) {
 	d.cleanPackList()
-	return newPackWrite(d.fs)
+	return newPackWrite(d.fs, h)
 }
 
 // ObjectPacks returns the list of availables packfiles
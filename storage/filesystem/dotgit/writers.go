@@ -29,9 +29,10 @@ type PackWriter struct {
 	parser   *packfile.Parser
 	writer   *idxfile.Writer
 	result   chan error
+	progress plumbing.ProgressHandler
 }
 
-func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
+func newPackWrite(fs billy.Filesystem, progress plumbing.ProgressHandler) (*PackWriter, error) {
 	fw, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_pack_")
 	if err != nil {
 		return nil, err
@@ -46,8 +47,9 @@ func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
 		fs:     fs,
 		fw:     fw,
 		fr:     fr,
-		synced: newSyncedReader(fw, fr),
-		result: make(chan error),
+		synced:   newSyncedReader(fw, fr),
+		result:   make(chan error),
+		progress: progress,
 	}
 
 	go writer.buildIndex()
@@ -64,6 +66,8 @@ func (w *PackWriter) buildIndex() {
 		return
 	}
 
+	w.parser.SetProgressHandler(w.progress)
+
 	checksum, err := w.parser.Parse()
 	if err != nil {
 		w.result <- err
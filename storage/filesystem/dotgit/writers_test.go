@@ -64,6 +64,35 @@ func (s *SuiteDotGit) TestNewObjectPack(c *C) {
 	c.Assert(pfs.Close(), IsNil)
 }
 
+func (s *SuiteDotGit) TestNewObjectPackWithProgress(c *C) {
+	f := fixtures.Basic().One()
+
+	dir, err := ioutil.TempDir("", "example")
+	c.Assert(err, IsNil)
+
+	defer os.RemoveAll(dir)
+
+	var last plumbing.ProgressEvent
+	phases := make(map[plumbing.ProgressPhase]bool)
+	h := plumbing.ProgressHandlerFunc(func(e plumbing.ProgressEvent) {
+		phases[e.Phase] = true
+		last = e
+	})
+
+	dot := New(osfs.New(dir))
+	w, err := dot.NewObjectPackWithProgress(h)
+	c.Assert(err, IsNil)
+
+	_, err = io.Copy(w, f.Packfile())
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	c.Assert(phases[plumbing.ReceivingObjects], Equals, true)
+	c.Assert(phases[plumbing.ResolvingDeltas], Equals, true)
+	c.Assert(last.Phase, Equals, plumbing.ResolvingDeltas)
+	c.Assert(last.Done, Equals, true)
+}
+
 func (s *SuiteDotGit) TestNewObjectPackUnused(c *C) {
 	dir, err := ioutil.TempDir("", "example")
 	if err != nil {
@@ -146,7 +175,7 @@ func (s *SuiteDotGit) TestPackWriterUnusedNotify(c *C) {
 
 	fs := osfs.New(dir)
 
-	w, err := newPackWrite(fs)
+	w, err := newPackWrite(fs, nil)
 	c.Assert(err, IsNil)
 
 	w.Notify = func(h plumbing.Hash, idx *idxfile.Writer) {
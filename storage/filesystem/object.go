@@ -90,11 +90,16 @@ func (s *ObjectStorage) NewEncodedObject() plumbing.EncodedObject {
 }
 
 func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
+	return s.PackfileWriterWithProgress(nil)
+}
+
+// PackfileWriterWithProgress implements storer.ProgressPackfileWriter.
+func (s *ObjectStorage) PackfileWriterWithProgress(h plumbing.ProgressHandler) (io.WriteCloser, error) {
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
 
-	w, err := s.dir.NewObjectPack()
+	w, err := s.dir.NewObjectPackWithProgress(h)
 	if err != nil {
 		return nil, err
 	}
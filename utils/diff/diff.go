@@ -1,25 +1,94 @@
 // Package diff implements line oriented diffs, similar to the ancient
 // Unix diff command.
 //
-// The current implementation is just a wrapper around Sergi's
-// go-diff/diffmatchpatch library, which is a go port of Neil
-// Fraser's google-diff-match-patch code
+// The lines of the texts are compared with the Myers, patience or histogram
+// algorithms, the same ones as the git diff command, optionally ignoring
+// their whitespace. The diffs are returned as sergi's go-diff/diffmatchpatch
+// diffs, one per run of equal, deleted or inserted lines.
 package diff
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
+// Algorithm is a diff algorithm.
+type Algorithm int
+
+const (
+	// Myers is the default algorithm of git. As git without --minimal, it
+	// discards the lines with many occurrences first, so the diff is not
+	// always minimal, matching the output of git diff.
+	Myers Algorithm = iota
+	// Patience matches first the lines that are unique in both texts,
+	// usually giving more readable diffs of reordered code.
+	Patience
+	// Histogram extends the patience algorithm to the lines with few
+	// occurrences, being usually faster than Myers for big texts.
+	Histogram
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Myers:
+		return "myers"
+	case Patience:
+		return "patience"
+	case Histogram:
+		return "histogram"
+	default:
+		return "unknown"
+	}
+}
+
+// Options are the options of a diff.
+type Options struct {
+	// Algorithm is the algorithm used to compare the lines, Myers if empty.
+	Algorithm Algorithm
+	// IgnoreAllSpace ignores the whitespace when comparing the lines, as
+	// the -w option of git diff.
+	IgnoreAllSpace bool
+	// IgnoreSpaceChange ignores the changes in the amount of whitespace and
+	// the whitespace at the end of the lines, as the -b option of git diff.
+	IgnoreSpaceChange bool
+	// IgnoreBlankLines ignores the changes whose lines are all blank, as the
+	// --ignore-blank-lines option of git diff. The diffs keep them, see
+	// IsBlank, the patches leave them out when they are not close to other
+	// changes.
+	IgnoreBlankLines bool
+}
+
 // Do computes the (line oriented) modifications needed to turn the src
-// string into the dst string.
+// string into the dst string, with the Myers algorithm.
 func Do(src, dst string) (diffs []diffmatchpatch.Diff) {
-	dmp := diffmatchpatch.New()
-	wSrc, wDst, warray := dmp.DiffLinesToRunes(src, dst)
-	diffs = dmp.DiffMainRunes(wSrc, wDst, false)
-	diffs = dmp.DiffCharsToLines(diffs, warray)
-	return diffs
+	return DoWithOptions(src, dst, nil)
+}
+
+// DoWithOptions computes the (line oriented) modifications needed to turn
+// the src string into the dst string, with the given options. When the
+// whitespace is ignored, the text of the equal lines is the one of dst,
+// as in the patches of git.
+func DoWithOptions(src, dst string, o *Options) []diffmatchpatch.Diff {
+	if o == nil {
+		o = &Options{}
+	}
+
+	a, b := splitLines(src), splitLines(dst)
+	ka, kb := o.keys(a, b)
+
+	var matches []match
+	switch o.Algorithm {
+	case Patience:
+		matches = patience(ka, kb, 0, len(ka), 0, len(kb), nil)
+	case Histogram:
+		matches = histogram(ka, kb, 0, len(ka), 0, len(kb), nil)
+	default:
+		matches = myers(ka, kb, 0, len(ka), 0, len(kb), nil)
+	}
+
+	return toDiffs(a, b, compact(ka, kb, matches))
 }
 
 // Dst computes and returns the destination text.
@@ -43,3 +112,333 @@ func Src(diffs []diffmatchpatch.Diff) string {
 	}
 	return text.String()
 }
+
+// IsBlank returns true if the diff is a deletion or an insertion of blank
+// lines only, the changes ignored by the IgnoreBlankLines option.
+func IsBlank(d diffmatchpatch.Diff) bool {
+	return d.Type != diffmatchpatch.DiffEqual && strings.TrimSpace(d.Text) == ""
+}
+
+// match is a pair of equal lines of the two texts.
+type match struct {
+	a, b int
+}
+
+// splitLines splits s in lines, keeping their line feed.
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+
+	return lines
+}
+
+// keys returns an integer for every line of a and b, equal for the lines
+// equal with the options.
+func (o *Options) keys(a, b []string) ([]int, []int) {
+	ids := make(map[string]int)
+	keys := func(lines []string) []int {
+		k := make([]int, len(lines))
+		for i, l := range lines {
+			l = o.normalize(l)
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+
+			k[i] = id
+		}
+
+		return k
+	}
+
+	return keys(a), keys(b)
+}
+
+// normalize returns the line with its whitespace removed, or its runs of
+// whitespace replaced by a single space and its trailing whitespace removed,
+// as set in the options.
+func (o *Options) normalize(line string) string {
+	if !o.IgnoreAllSpace && !o.IgnoreSpaceChange {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			b.WriteByte(line[i])
+			continue
+		}
+
+		for i+1 < len(line) && isSpace(line[i+1]) {
+			i++
+		}
+
+		if !o.IgnoreAllSpace && i+1 < len(line) {
+			b.WriteByte(' ')
+		}
+	}
+
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+// compact moves the groups of changed lines of both texts as git does: a
+// group is slid up, then down, as far as the lines around it are equal to
+// its ends, merging it with the groups it reaches, then moved back up to end
+// in front of a change of the other text if possible. The diff is as short,
+// but the groups are placed in the same way for any algorithm.
+func compact(a, b []int, matches []match) []match {
+	ca := newChanges(a)
+	cb := newChanges(b)
+	for _, m := range matches {
+		ca.changed[m.a] = false
+		cb.changed[m.b] = false
+	}
+
+	ca.compact(cb)
+	cb.compact(ca)
+
+	var compacted []match
+	var j int
+	for i := range a {
+		if ca.changed[i] {
+			continue
+		}
+
+		for cb.changed[j] {
+			j++
+		}
+
+		compacted = append(compacted, match{i, j})
+		j++
+	}
+
+	return compacted
+}
+
+// changes are the changed lines of a text. They are split in groups by the
+// unchanged lines, the groups of both texts being between the same matched
+// lines, so every group of a text has a counterpart, maybe empty, in the
+// other one.
+type changes struct {
+	keys    []int
+	changed []bool
+}
+
+func newChanges(keys []int) *changes {
+	c := &changes{keys: keys, changed: make([]bool, len(keys))}
+	for i := range c.changed {
+		c.changed[i] = true
+	}
+
+	return c
+}
+
+// group is the range [start, end) of a group of changed lines.
+type group struct {
+	start, end int
+}
+
+func (c *changes) first() group {
+	g := group{}
+	for g.end < len(c.keys) && c.changed[g.end] {
+		g.end++
+	}
+
+	return g
+}
+
+// next moves g to the next group, it returns false if g is the last one.
+func (c *changes) next(g *group) bool {
+	if g.end == len(c.keys) {
+		return false
+	}
+
+	g.start = g.end + 1
+	g.end = g.start
+	for g.end < len(c.keys) && c.changed[g.end] {
+		g.end++
+	}
+
+	return true
+}
+
+// previous moves g to the previous group, it returns false if g is the
+// first one.
+func (c *changes) previous(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	g.start = g.end
+	for g.start > 0 && c.changed[g.start-1] {
+		g.start--
+	}
+
+	return true
+}
+
+// slideDown moves g one line down, merging it with the next group if they
+// become adjacent, it returns false if the line following g is not equal to
+// its first line.
+func (c *changes) slideDown(g *group) bool {
+	if g.end == len(c.keys) || c.keys[g.start] != c.keys[g.end] {
+		return false
+	}
+
+	c.changed[g.start], c.changed[g.end] = false, true
+	g.start++
+	g.end++
+	for g.end < len(c.keys) && c.changed[g.end] {
+		g.end++
+	}
+
+	return true
+}
+
+// slideUp moves g one line up, merging it with the previous group if they
+// become adjacent, it returns false if the line preceding g is not equal to
+// its last line.
+func (c *changes) slideUp(g *group) bool {
+	if g.start == 0 || c.keys[g.start-1] != c.keys[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+	c.changed[g.start], c.changed[g.end] = true, false
+	for g.start > 0 && c.changed[g.start-1] {
+		g.start--
+	}
+
+	return true
+}
+
+// compact moves the groups of c, keeping the groups of other in sync.
+func (c *changes) compact(other *changes) {
+	g, og := c.first(), other.first()
+	for {
+		if g.end != g.start {
+			c.compactGroup(&g, other, &og)
+		}
+
+		if !c.next(&g) {
+			return
+		}
+
+		other.next(&og)
+	}
+}
+
+func (c *changes) compactGroup(g *group, other *changes, og *group) {
+	var earliestEnd int
+	endMatchingOther := -1
+	for {
+		size := g.end - g.start
+		endMatchingOther = -1
+
+		for c.slideUp(g) {
+			other.previous(og)
+		}
+
+		earliestEnd = g.end
+		if og.end > og.start {
+			endMatchingOther = g.end
+		}
+
+		for c.slideDown(g) {
+			other.next(og)
+			if og.end > og.start {
+				endMatchingOther = g.end
+			}
+		}
+
+		if size == g.end-g.start {
+			break
+		}
+	}
+
+	if g.end != earliestEnd && endMatchingOther != -1 {
+		for og.end == og.start {
+			c.slideUp(g)
+			other.previous(og)
+		}
+	}
+}
+
+// toDiffs returns the diffs of the lines of a and b with the given matches.
+func toDiffs(a, b []string, matches []match) []diffmatchpatch.Diff {
+	diffs := []diffmatchpatch.Diff{}
+	add := func(t diffmatchpatch.Operation, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+
+		text := strings.Join(lines, "")
+		if n := len(diffs); n > 0 && diffs[n-1].Type == t {
+			diffs[n-1].Text += text
+			return
+		}
+
+		diffs = append(diffs, diffmatchpatch.Diff{Type: t, Text: text})
+	}
+
+	var i, j int
+	for _, m := range matches {
+		add(diffmatchpatch.DiffDelete, a[i:m.a])
+		add(diffmatchpatch.DiffInsert, b[j:m.b])
+		add(diffmatchpatch.DiffEqual, b[m.b:m.b+1])
+		i, j = m.a+1, m.b+1
+	}
+
+	add(diffmatchpatch.DiffDelete, a[i:])
+	add(diffmatchpatch.DiffInsert, b[j:])
+	return diffs
+}
+
+// trim appends to m the matches of the common prefix of a[aLo:aHi] and
+// b[bLo:bHi], and returns the bounds of the lines left without the common
+// prefix and suffix, along with the length of the suffix.
+func trim(a, b []int, aLo, aHi, bLo, bHi int, m []match) (int, int, int, int, int, []match) {
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		m = append(m, match{aLo, bLo})
+		aLo++
+		bLo++
+	}
+
+	var suffix int
+	for aLo < aHi && bLo < bHi && a[aHi-1] == b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	return aLo, aHi, bLo, bHi, suffix, m
+}
+
+// appendSuffix appends to m the n matches following a[aHi] and b[bHi].
+func appendSuffix(aHi, bHi, n int, m []match) []match {
+	for i := 0; i < n; i++ {
+		m = append(m, match{aHi + i, bHi + i})
+	}
+
+	return m
+}
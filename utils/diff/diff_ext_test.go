@@ -107,3 +107,117 @@ func (s *suiteCommon) TestDo(c *C) {
 		c.Assert(diffs, DeepEquals, t.exp, Commentf("subtest %d", i))
 	}
 }
+
+var algorithmTests = [...]struct {
+	algorithm diff.Algorithm
+	exp       []diffmatchpatch.Diff
+}{
+	{
+		algorithm: diff.Myers,
+		exp: []diffmatchpatch.Diff{
+			{Type: -1, Text: "b\n"},
+			{Type: 1, Text: "d\na\n"},
+			{Type: 0, Text: "a\n"},
+			{Type: 1, Text: "b\n"},
+		},
+	},
+	{
+		algorithm: diff.Patience,
+		exp: []diffmatchpatch.Diff{
+			{Type: 1, Text: "d\na\na\n"},
+			{Type: 0, Text: "b\n"},
+			{Type: -1, Text: "a\n"},
+		},
+	},
+	{
+		algorithm: diff.Histogram,
+		exp: []diffmatchpatch.Diff{
+			{Type: -1, Text: "b\n"},
+			{Type: 1, Text: "d\n"},
+			{Type: 0, Text: "a\n"},
+			{Type: 1, Text: "a\nb\n"},
+		},
+	},
+}
+
+func (s *suiteCommon) TestAlgorithms(c *C) {
+	src, dst := "b\na\n", "d\na\na\nb\n"
+	for _, t := range algorithmTests {
+		diffs := diff.DoWithOptions(src, dst, &diff.Options{Algorithm: t.algorithm})
+		c.Assert(diffs, DeepEquals, t.exp, Commentf("algorithm %s", t.algorithm))
+	}
+
+	c.Assert(diff.Do(src, dst), DeepEquals, algorithmTests[0].exp)
+}
+
+func (s *suiteCommon) TestAlgorithmsRoundTrip(c *C) {
+	for _, algorithm := range []diff.Algorithm{diff.Myers, diff.Patience, diff.Histogram} {
+		for i, t := range diffTests {
+			diffs := diff.DoWithOptions(t.src, t.dst, &diff.Options{Algorithm: algorithm})
+			c.Assert(diff.Src(diffs), Equals, t.src, Commentf("%s subtest %d", algorithm, i))
+			c.Assert(diff.Dst(diffs), Equals, t.dst, Commentf("%s subtest %d", algorithm, i))
+		}
+	}
+}
+
+func (s *suiteCommon) TestIgnoreAllSpace(c *C) {
+	diffs := diff.DoWithOptions("a b\n\tc\nd\n", "ab \nc\ne\n", &diff.Options{
+		IgnoreAllSpace: true,
+	})
+
+	c.Assert(diffs, DeepEquals, []diffmatchpatch.Diff{
+		{Type: 0, Text: "ab \nc\n"},
+		{Type: -1, Text: "d\n"},
+		{Type: 1, Text: "e\n"},
+	})
+}
+
+func (s *suiteCommon) TestIgnoreSpaceChange(c *C) {
+	diffs := diff.DoWithOptions("a  b\nc\n d\n", "a\tb \nc\nd\n", &diff.Options{
+		IgnoreSpaceChange: true,
+	})
+
+	c.Assert(diffs, DeepEquals, []diffmatchpatch.Diff{
+		{Type: 0, Text: "a\tb \nc\n"},
+		{Type: -1, Text: " d\n"},
+		{Type: 1, Text: "d\n"},
+	})
+}
+
+func (s *suiteCommon) TestIsBlank(c *C) {
+	c.Assert(diff.IsBlank(diffmatchpatch.Diff{Type: 1, Text: "\n \t\n"}), Equals, true)
+	c.Assert(diff.IsBlank(diffmatchpatch.Diff{Type: -1, Text: "\na\n"}), Equals, false)
+	c.Assert(diff.IsBlank(diffmatchpatch.Diff{Type: 0, Text: "\n"}), Equals, false)
+}
+
+var mergeTests = [...]struct {
+	base, ours, theirs string
+	merged             string
+	clean              bool
+}{
+	// one side only
+	{"a\nb\nc\n", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", true},
+	{"a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", true},
+	// both sides, apart
+	{"a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", true},
+	// same change on both sides
+	{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", true},
+	// conflicts
+	{"a\nb\nc\n", "a\nB\nc\n", "a\nX\nc\n",
+		"a\n<<<<<<< ours\nB\n=======\nX\n>>>>>>> theirs\nc\n", false},
+	{"a\nb\n", "a\nb\nc\n", "a\nb\nd\n",
+		"a\nb\n<<<<<<< ours\nc\n=======\nd\n>>>>>>> theirs\n", false},
+	{"a\n", "a\nb", "a\nc",
+		"a\n<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n", false},
+	// common lines out of the conflict
+	{"a\nb\nc\n", "a\nx\nB\ny\nc\n", "a\nx\nX\ny\nc\n",
+		"a\nx\n<<<<<<< ours\nB\n=======\nX\n>>>>>>> theirs\ny\nc\n", false},
+}
+
+func (s *suiteCommon) TestMerge(c *C) {
+	for i, t := range mergeTests {
+		merged, clean := diff.Merge(t.base, t.ours, t.theirs, "ours", "theirs")
+		c.Assert(merged, Equals, t.merged, Commentf("subtest %d", i))
+		c.Assert(clean, Equals, t.clean, Commentf("subtest %d", i))
+	}
+}
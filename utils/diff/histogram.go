@@ -0,0 +1,100 @@
+package diff
+
+// maxChainLength is the maximum number of occurrences of a line in the
+// first text for it to be used as the anchor of a histogram diff.
+const maxChainLength = 64
+
+// histogram appends to m the matches of a diff of a[aLo:aHi] and b[bLo:bHi]
+// computed with the histogram algorithm: the longest common region around
+// the lines with the fewest occurrences in a is matched, and the lines
+// around it are diffed recursively. The lines whose common lines have too
+// many occurrences are diffed with the Myers algorithm.
+func histogram(a, b []int, aLo, aHi, bLo, bHi int, m []match) []match {
+	for aLo < aHi && bLo < bHi {
+		r, ok, fallback := longestRegion(a, b, aLo, aHi, bLo, bHi)
+		switch {
+		case fallback:
+			return myers(a, b, aLo, aHi, bLo, bHi, m)
+		case !ok:
+			return m
+		}
+
+		m = histogram(a, b, aLo, r.aStart, bLo, r.bStart, m)
+		for i := 0; i < r.aEnd-r.aStart; i++ {
+			m = append(m, match{r.aStart + i, r.bStart + i})
+		}
+
+		aLo, bLo = r.aEnd, r.bEnd
+	}
+
+	return m
+}
+
+// region is a range of equal lines of both texts.
+type region struct {
+	aStart, aEnd int
+	bStart, bEnd int
+}
+
+// longestRegion returns the longest region of equal lines of a[aLo:aHi] and
+// b[bLo:bHi] with the lowest number of occurrences in a of its lines. It
+// returns false if the texts have no common lines, and fallback if all of
+// them have more than maxChainLength occurrences.
+func longestRegion(a, b []int, aLo, aHi, bLo, bHi int) (r region, ok, fallback bool) {
+	positions := make(map[int][]int)
+	for i := aLo; i < aHi; i++ {
+		positions[a[i]] = append(positions[a[i]], i)
+	}
+
+	count := func(i int) int { return len(positions[a[i]]) }
+
+	var common bool
+	lowest := maxChainLength + 1
+	for j := bLo; j < bHi; {
+		next := j + 1
+		ps := positions[b[j]]
+		common = common || len(ps) > 0
+		if len(ps) > lowest {
+			j = next
+			continue
+		}
+
+		for k := 0; k < len(ps); {
+			c := region{ps[k], ps[k] + 1, j, j + 1}
+			rc := len(ps)
+			for c.aStart > aLo && c.bStart > bLo && a[c.aStart-1] == b[c.bStart-1] {
+				c.aStart--
+				c.bStart--
+				if rc > 1 && count(c.aStart) < rc {
+					rc = count(c.aStart)
+				}
+			}
+
+			for c.aEnd < aHi && c.bEnd < bHi && a[c.aEnd] == b[c.bEnd] {
+				if rc > 1 && count(c.aEnd) < rc {
+					rc = count(c.aEnd)
+				}
+
+				c.aEnd++
+				c.bEnd++
+			}
+
+			if next < c.bEnd {
+				next = c.bEnd
+			}
+
+			if r.aEnd-r.aStart < c.aEnd-c.aStart || rc < lowest {
+				r, ok, lowest = c, true, rc
+			}
+
+			k++
+			for k < len(ps) && ps[k] < c.aEnd {
+				k++
+			}
+		}
+
+		j = next
+	}
+
+	return r, ok, common && !ok
+}
@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	conflictStart     = "<<<<<<<"
+	conflictSeparator = "======="
+	conflictEnd       = ">>>>>>>"
+)
+
+// edit is the replacement of the lines from start to end of a text with
+// other lines.
+type edit struct {
+	start, end int
+	lines      []string
+}
+
+// Merge returns the three-way merge of the changes from base to ours and
+// from base to theirs, and false if they conflict. The changes of both
+// sides that overlap or touch each other conflict unless they are the
+// same, their lines are written between conflict markers labeled with the
+// given names, as git does, without the lines common to both sides at their
+// start and end.
+func Merge(base, ours, theirs string, oursName, theirsName string) (string, bool) {
+	b := splitLines(base)
+	a, c := lineEdits(b, splitLines(ours)), lineEdits(b, splitLines(theirs))
+
+	var buf bytes.Buffer
+	clean := true
+	var pos, i, j int
+	for i < len(a) || j < len(c) {
+		start, end := len(b), 0
+		if i < len(a) {
+			start = a[i].start
+		}
+
+		if j < len(c) && c[j].start < start {
+			start = c[j].start
+		}
+
+		end = start
+		fi, fj := i, j
+		for {
+			switch {
+			case i < len(a) && a[i].start <= end:
+				if a[i].end > end {
+					end = a[i].end
+				}
+
+				i++
+				continue
+			case j < len(c) && c[j].start <= end:
+				if c[j].end > end {
+					end = c[j].end
+				}
+
+				j++
+				continue
+			}
+
+			break
+		}
+
+		writeLines(&buf, b[pos:start])
+		pos = end
+
+		x, y := applyEdits(b, start, end, a[fi:i]), applyEdits(b, start, end, c[fj:j])
+		switch {
+		case fj == j:
+			writeLines(&buf, x)
+		case fi == i:
+			writeLines(&buf, y)
+		case strings.Join(x, "") == strings.Join(y, ""):
+			writeLines(&buf, x)
+		default:
+			clean = false
+			writeConflict(&buf, x, y, oursName, theirsName)
+		}
+	}
+
+	writeLines(&buf, b[pos:])
+	return buf.String(), clean
+}
+
+// lineEdits returns the edits transforming the lines a to the lines b.
+func lineEdits(a, b []string) []edit {
+	ka, kb := (&Options{}).keys(a, b)
+	matches := compact(ka, kb, myers(ka, kb, 0, len(ka), 0, len(kb), nil))
+	matches = append(matches, match{len(a), len(b)})
+
+	var edits []edit
+	var i, j int
+	for _, m := range matches {
+		if i < m.a || j < m.b {
+			edits = append(edits, edit{i, m.a, b[j:m.b]})
+		}
+
+		i, j = m.a+1, m.b+1
+	}
+
+	return edits
+}
+
+// applyEdits returns the lines from start to end of base with the given
+// edits.
+func applyEdits(base []string, start, end int, edits []edit) []string {
+	var lines []string
+	pos := start
+	for _, e := range edits {
+		lines = append(lines, base[pos:e.start]...)
+		lines = append(lines, e.lines...)
+		pos = e.end
+	}
+
+	return append(lines, base[pos:end]...)
+}
+
+// writeConflict writes the conflicting lines of both sides, the common
+// ones at their start and end being written out of the conflict markers.
+func writeConflict(buf *bytes.Buffer, ours, theirs []string, oursName, theirsName string) {
+	var prefix, suffix int
+	for prefix < len(ours) && prefix < len(theirs) && ours[prefix] == theirs[prefix] {
+		prefix++
+	}
+
+	for suffix < len(ours)-prefix && suffix < len(theirs)-prefix &&
+		ours[len(ours)-1-suffix] == theirs[len(theirs)-1-suffix] {
+		suffix++
+	}
+
+	writeLines(buf, ours[:prefix])
+	buf.WriteString(conflictStart + " " + oursName + "\n")
+	writeLines(buf, ours[prefix:len(ours)-suffix])
+	terminateLine(buf)
+	buf.WriteString(conflictSeparator + "\n")
+	writeLines(buf, theirs[prefix:len(theirs)-suffix])
+	terminateLine(buf)
+	buf.WriteString(conflictEnd + " " + theirsName + "\n")
+	writeLines(buf, ours[len(ours)-suffix:])
+}
+
+func writeLines(buf *bytes.Buffer, lines []string) {
+	for _, l := range lines {
+		buf.WriteString(l)
+	}
+}
+
+// terminateLine ends the last line written, for the conflict markers to be
+// on their own lines.
+func terminateLine(buf *bytes.Buffer) {
+	if buf.Len() != 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
@@ -0,0 +1,245 @@
+package diff
+
+const (
+	// maxEqualLimit bounds the number of occurrences in the other text from
+	// which a line is a candidate to be discarded before the diff.
+	maxEqualLimit = 1024
+	// simScanWindow bounds the number of lines scanned around a line with
+	// many occurrences to decide whether it is discarded.
+	simScanWindow = 100
+	// keptDiscardRun is the ratio of discarded lines to lines with many
+	// occurrences required to discard the latter.
+	keptDiscardRun = 4
+)
+
+// myers appends to m the matches of the diff of a[aLo:aHi] and b[bLo:bHi]
+// computed by git diff without --minimal, with the linear space variation of
+// the Myers algorithm: the lines of a text that are not in the other one,
+// along with the lines with many occurrences surrounded by them, are
+// discarded first, then the texts are split by the middle snake of their
+// diff, and each half is diffed recursively. The diff of the lines kept is
+// minimal, but discarding lines may miss some matches, so the whole diff is
+// not always minimal.
+func myers(a, b []int, aLo, aHi, bLo, bHi int, m []match) []match {
+	ta, tb := a[aLo:aHi], b[bLo:bHi]
+	aLo, aHi, bLo, bHi, suffix, m := trim(a, b, aLo, aHi, bLo, bHi, m)
+	if aLo < aHi && bLo < bHi {
+		ia := keptLines(a, aLo, aHi, ta, tb)
+		ib := keptLines(b, bLo, bHi, tb, ta)
+
+		ka, kb := make([]int, len(ia)), make([]int, len(ib))
+		for i, l := range ia {
+			ka[i] = a[l]
+		}
+
+		for i, l := range ib {
+			kb[i] = b[l]
+		}
+
+		e := newMyersEnv(len(ka), len(kb))
+		for _, km := range e.compare(ka, kb, 0, len(ka), 0, len(kb), nil) {
+			m = append(m, match{ia[km.a], ib[km.b]})
+		}
+	}
+
+	return appendSuffix(aHi, bHi, suffix, m)
+}
+
+// keptLines returns the lines of a[lo:hi] compared by the Myers algorithm,
+// the other ones are changed. The lines are part of the text, compared to
+// the other one.
+func keptLines(a []int, lo, hi int, text, other []int) []int {
+	count := make(map[int]int)
+	for _, k := range other {
+		count[k]++
+	}
+
+	limit := bogoSqrt(len(text))
+	if limit > maxEqualLimit {
+		limit = maxEqualLimit
+	}
+
+	// discard is 0 for the lines not found in other, 2 for the ones with many
+	// occurrences and 1 for the other ones.
+	discard := make([]int, hi-lo)
+	for i, k := range a[lo:hi] {
+		switch n := count[k]; {
+		case n == 0:
+			discard[i] = 0
+		case n >= limit:
+			discard[i] = 2
+		default:
+			discard[i] = 1
+		}
+	}
+
+	var kept []int
+	for i, d := range discard {
+		if d == 1 || (d == 2 && !discardMultiple(discard, i)) {
+			kept = append(kept, lo+i)
+		}
+	}
+
+	return kept
+}
+
+// discardMultiple returns true if the line i, with many occurrences, is in
+// the middle of a run of discarded lines made mostly of lines not found in
+// the other text.
+func discardMultiple(discard []int, i int) bool {
+	start, end := 0, len(discard)-1
+	if i-start > simScanWindow {
+		start = i - simScanWindow
+	}
+
+	if end-i > simScanWindow {
+		end = i + simScanWindow
+	}
+
+	run := func(step, limit int) (missing, multiple int) {
+		multiple = 1
+		for j := i + step; (step < 0 && j >= limit) || (step > 0 && j <= limit); j += step {
+			switch discard[j] {
+			case 0:
+				missing++
+			case 2:
+				multiple++
+			default:
+				return
+			}
+		}
+
+		return
+	}
+
+	missingBefore, multipleBefore := run(-1, start)
+	if missingBefore == 0 {
+		return false
+	}
+
+	missingAfter, multipleAfter := run(1, end)
+	if missingAfter == 0 {
+		return false
+	}
+
+	multiple := multipleBefore + multipleAfter
+	return multiple*keptDiscardRun < multiple+missingBefore+missingAfter
+}
+
+// bogoSqrt returns a rough approximation of the square root of n.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+// myersEnv holds the furthest points reached on each diagonal d = x - y of
+// the forward and backward searches of the middle snake.
+type myersEnv struct {
+	forward, backward []int
+	off               int
+}
+
+func newMyersEnv(n, m int) *myersEnv {
+	return &myersEnv{
+		forward:  make([]int, n+m+3),
+		backward: make([]int, n+m+3),
+		off:      m + 1,
+	}
+}
+
+// compare appends to m the matches of a minimal diff of a[aLo:aHi] and
+// b[bLo:bHi].
+func (e *myersEnv) compare(a, b []int, aLo, aHi, bLo, bHi int, m []match) []match {
+	aLo, aHi, bLo, bHi, suffix, m := trim(a, b, aLo, aHi, bLo, bHi, m)
+	if aLo < aHi && bLo < bHi {
+		x, y := e.split(a, b, aLo, aHi, bLo, bHi)
+		m = e.compare(a, b, aLo, x, bLo, y, m)
+		m = e.compare(a, b, x, aHi, y, bHi, m)
+	}
+
+	return appendSuffix(aHi, bHi, suffix, m)
+}
+
+// split returns the point where the forward and backward searches of a
+// shortest edit script of a[aLo:aHi] into b[bLo:bHi] meet, the diffs of the
+// texts before and after it make a minimal diff.
+func (e *myersEnv) split(a, b []int, aLo, aHi, bLo, bHi int) (int, int) {
+	fwd, bwd, off := e.forward, e.backward, e.off
+	dmin, dmax := aLo-bHi, aHi-bLo
+	fmid, bmid := aLo-bLo, aHi-bHi
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	fwd[off+fmid] = aLo
+	bwd[off+bmid] = aHi
+	for {
+		if fmin > dmin {
+			fmin--
+			fwd[off+fmin-1] = -1
+		} else {
+			fmin++
+		}
+
+		if fmax < dmax {
+			fmax++
+			fwd[off+fmax+1] = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			x := fwd[off+d+1]
+			if fwd[off+d-1] >= fwd[off+d+1] {
+				x = fwd[off+d-1] + 1
+			}
+
+			y := x - d
+			for x < aHi && y < bHi && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			fwd[off+d] = x
+			if odd && bmin <= d && d <= bmax && bwd[off+d] <= x {
+				return x, y
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			bwd[off+bmin-1] = aHi + 1
+		} else {
+			bmin++
+		}
+
+		if bmax < dmax {
+			bmax++
+			bwd[off+bmax+1] = aHi + 1
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			x := bwd[off+d+1] - 1
+			if bwd[off+d-1] < bwd[off+d+1] {
+				x = bwd[off+d-1]
+			}
+
+			y := x - d
+			for x > aLo && y > bLo && a[x-1] == b[y-1] {
+				x--
+				y--
+			}
+
+			bwd[off+d] = x
+			if !odd && fmin <= d && d <= fmax && x <= fwd[off+d] {
+				return x, y
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package diff
+
+import "sort"
+
+// patience appends to m the matches of a diff of a[aLo:aHi] and b[bLo:bHi]
+// computed with the patience algorithm: the longest sequence of lines unique
+// in both texts, in the same order in them, is matched along with the equal
+// lines around them, and the lines between them are diffed recursively. The
+// lines without unique common lines are diffed with the Myers algorithm.
+func patience(a, b []int, aLo, aHi, bLo, bHi int, m []match) []match {
+	if aLo == aHi || bLo == bHi {
+		return m
+	}
+
+	anchors := uniqueCommonSequence(a, b, aLo, aHi, bLo, bHi)
+	if len(anchors) == 0 {
+		return myers(a, b, aLo, aHi, bLo, bHi, m)
+	}
+
+	i, j := aLo, bLo
+	for k := 0; ; k++ {
+		nextA, nextB := aHi, bHi
+		if k < len(anchors) {
+			nextA, nextB = anchors[k].a, anchors[k].b
+			for nextA > i && nextB > j && a[nextA-1] == b[nextB-1] {
+				nextA--
+				nextB--
+			}
+		}
+
+		for i < nextA && j < nextB && a[i] == b[j] {
+			m = append(m, match{i, j})
+			i++
+			j++
+		}
+
+		m = patience(a, b, i, nextA, j, nextB, m)
+		if k == len(anchors) {
+			return m
+		}
+
+		for ; nextA <= anchors[k].a; nextA, nextB = nextA+1, nextB+1 {
+			m = append(m, match{nextA, nextB})
+		}
+
+		i, j = nextA, nextB
+	}
+}
+
+// uniqueCommonSequence returns the longest increasing sequence of the
+// matches of the lines appearing once in a[aLo:aHi] and once in b[bLo:bHi].
+func uniqueCommonSequence(a, b []int, aLo, aHi, bLo, bHi int) []match {
+	type occurrences struct {
+		a, b       int
+		posA, posB int
+	}
+
+	lines := make(map[int]*occurrences)
+	for i := aLo; i < aHi; i++ {
+		o, ok := lines[a[i]]
+		if !ok {
+			o = &occurrences{}
+			lines[a[i]] = o
+		}
+
+		o.a++
+		o.posA = i
+	}
+
+	for j := bLo; j < bHi; j++ {
+		if o, ok := lines[b[j]]; ok {
+			o.b++
+			o.posB = j
+		}
+	}
+
+	var unique []match
+	for _, o := range lines {
+		if o.a == 1 && o.b == 1 {
+			unique = append(unique, match{o.posA, o.posB})
+		}
+	}
+
+	sort.Slice(unique, func(i, j int) bool { return unique[i].a < unique[j].a })
+	return longestIncreasingSequence(unique)
+}
+
+// longestIncreasingSequence returns the longest subsequence of the matches,
+// sorted by their line of a, with increasing lines of b, found with patience
+// sorting.
+func longestIncreasingSequence(matches []match) []match {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// tops are the indexes of the matches at the top of every pile, prev
+	// the index of the top of the previous pile when a match was placed.
+	var tops []int
+	prev := make([]int, len(matches))
+	for i, mt := range matches {
+		p := sort.Search(len(tops), func(j int) bool {
+			return matches[tops[j]].b > mt.b
+		})
+
+		prev[i] = -1
+		if p > 0 {
+			prev[i] = tops[p-1]
+		}
+
+		if p == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[p] = i
+		}
+	}
+
+	seq := make([]match, len(tops))
+	for i, k := len(tops)-1, tops[len(tops)-1]; i >= 0; i, k = i-1, prev[k] {
+		seq[i] = matches[k]
+	}
+
+	return seq
+}
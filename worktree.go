@@ -69,12 +69,13 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
-	fetchHead, err := remote.fetch(ctx, &FetchOptions{
-		RemoteName: o.RemoteName,
-		Depth:      o.Depth,
-		Auth:       o.Auth,
-		Progress:   o.Progress,
-		Force:      o.Force,
+	fetchHead, _, err := remote.fetch(ctx, &FetchOptions{
+		RemoteName:      o.RemoteName,
+		Depth:           o.Depth,
+		Auth:            o.Auth,
+		Progress:        o.Progress,
+		ProgressHandler: o.ProgressHandler,
+		Force:           o.Force,
 	})
 
 	updated := true
@@ -113,10 +114,10 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
-	if err := w.Reset(&ResetOptions{
+	if err := w.reset(&ResetOptions{
 		Mode:   MergeReset,
 		Commit: ref.Hash(),
-	}); err != nil {
+	}, o.ProgressHandler); err != nil {
 		return err
 	}
 
@@ -182,7 +183,7 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 		return err
 	}
 
-	return w.Reset(ro)
+	return w.reset(ro, opts.ProgressHandler)
 }
 func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 	_, err := w.r.Storer.Reference(opts.Branch)
@@ -264,6 +265,12 @@ func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbin
 
 // Reset the worktree to a specified state.
 func (w *Worktree) Reset(opts *ResetOptions) error {
+	return w.reset(opts, nil)
+}
+
+// reset is Reset, sending the UpdatingFiles events of the worktree update to
+// progress, if not nil.
+func (w *Worktree) reset(opts *ResetOptions, progress plumbing.ProgressHandler) error {
 	if err := opts.Validate(w.r); err != nil {
 		return err
 	}
@@ -299,7 +306,7 @@ func (w *Worktree) Reset(opts *ResetOptions) error {
 	}
 
 	if opts.Mode == MergeReset || opts.Mode == HardReset {
-		if err := w.resetWorktree(t); err != nil {
+		if err := w.resetWorktree(t, progress); err != nil {
 			return err
 		}
 	}
@@ -354,7 +361,7 @@ func (w *Worktree) resetIndex(t *object.Tree) error {
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) resetWorktree(t *object.Tree) error {
+func (w *Worktree) resetWorktree(t *object.Tree, progress plumbing.ProgressHandler) error {
 	changes, err := w.diffStagingWithWorktree(true)
 	if err != nil {
 		return err
@@ -365,12 +372,18 @@ func (w *Worktree) resetWorktree(t *object.Tree) error {
 		return err
 	}
 
-	for _, ch := range changes {
+	meter := plumbing.NewProgressMeter(progress,
+		plumbing.UpdatingFiles, int64(len(changes)))
+
+	for i, ch := range changes {
 		if err := w.checkoutChange(ch, t, idx); err != nil {
 			return err
 		}
+
+		meter.Update(int64(i)+1, 0)
 	}
 
+	meter.Done()
 	return w.r.Storer.SetIndex(idx)
 }
 
@@ -715,7 +728,7 @@ func (w *Worktree) readGitmodulesFile() (*config.Modules, error) {
 // Clean the worktree by removing untracked files.
 // An empty dir could be removed - this is what  `git clean -f -d .` does.
 func (w *Worktree) Clean(opts *CleanOptions) error {
-	s, err := w.Status()
+	s, err := w.statusWithoutRenames()
 	if err != nil {
 		return err
 	}
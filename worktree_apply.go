@@ -0,0 +1,852 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	stdioutil "io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+	"gopkg.in/src-d/go-git.v4/utils/ioutil"
+
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const (
+	rejectSuffix = ".rej"
+	rejectHeader = "diff a/%s b/%s\t(rejected hunks)\n"
+	oursName     = "ours"
+	theirsName   = "theirs"
+
+	invalidPath   = "invalid path"
+	beyondSymlink = "beyond a symbolic link"
+)
+
+// ApplyStatus is the outcome of the application of the patch of a file.
+type ApplyStatus int
+
+const (
+	// ApplyOK means the patch was applied, maybe at other lines than the
+	// ones of its hunks or ignoring some context lines.
+	ApplyOK ApplyStatus = iota
+	// ApplyMerged means the changes of the patch were merged with the ones
+	// of the file without conflicts.
+	ApplyMerged
+	// ApplyConflict means the changes of the patch were merged with the
+	// ones of the file with conflicts.
+	ApplyConflict
+	// ApplyRejected means some hunks of the patch did not apply.
+	ApplyRejected
+	// ApplyFailed means the patch could not be applied to the file, e.g.
+	// because it does not exist or it does not match its binary patch.
+	ApplyFailed
+)
+
+func (s ApplyStatus) String() string {
+	switch s {
+	case ApplyOK:
+		return "ok"
+	case ApplyMerged:
+		return "merged"
+	case ApplyConflict:
+		return "conflict"
+	case ApplyRejected:
+		return "rejected"
+	case ApplyFailed:
+		return "failed"
+	}
+
+	return fmt.Sprintf("ApplyStatus(%d)", int(s))
+}
+
+// ApplyFileResult is the result of the application of the patch of a file.
+type ApplyFileResult struct {
+	// Path is the path of the patched file, the new one of a rename or a
+	// copy.
+	Path string
+	// Status is the outcome of the application.
+	Status ApplyStatus
+	// Hunks are the results of the hunks of a text file patch applied to
+	// the file, nil if it was merged.
+	Hunks []fdiff.HunkResult
+	// Message explains why the patch could not be applied.
+	Message string
+}
+
+// Error returns the error matching the status of the file, nil if the patch
+// was applied or merged without conflicts.
+func (r *ApplyFileResult) Error() error {
+	switch r.Status {
+	case ApplyOK, ApplyMerged:
+		return nil
+	case ApplyConflict:
+		return fmt.Errorf("applied patch to %s with conflicts", r.Path)
+	case ApplyRejected:
+		return fmt.Errorf("%s: %s", r.Path, fdiff.ErrPatchRejected)
+	}
+
+	return fmt.Errorf("%s: %s", r.Path, r.Message)
+}
+
+// ApplyResult is the result of the application of a patch, it contains the
+// result of every file patch.
+type ApplyResult struct {
+	Files []*ApplyFileResult
+}
+
+// Error returns the error of the first file whose patch was not applied
+// cleanly.
+func (r *ApplyResult) Error() error {
+	for _, f := range r.Files {
+		if err := f.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applied returns true if the changes of the patch must be written, none of
+// the files failing or having rejected hunks unless they are allowed.
+func (r *ApplyResult) applied(o *ApplyOptions) bool {
+	for _, f := range r.Files {
+		if (f.Status == ApplyRejected || f.Status == ApplyFailed) && !o.Reject {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply applies a patch to the worktree, to the index or to both, as git
+// apply does. The patch is usually decoded with a diff.Decoder, the other
+// ones are encoded and decoded to be applied. The files patched several
+// times by the patch have their patches applied in order.
+//
+// The result contains the outcome of every file patch, the returned error
+// is the one of the result if a file patch was not applied cleanly. Nothing
+// is written if a file patch is rejected, unless the Reject option is set,
+// or if a path of the patch is not a valid path inside the worktree, as an
+// absolute one, one with a .git component or beyond a symbolic link.
+func (w *Worktree) Apply(p fdiff.Patch, o *ApplyOptions) (*ApplyResult, error) {
+	if o == nil {
+		o = &ApplyOptions{}
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	up, err := unifiedPatch(p)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &patchApplier{w: w, o: o, files: make(map[string]*patchedFile)}
+	if o.Index || o.Cached {
+		if a.idx, err = w.r.Storer.Index(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ApplyResult{}
+	for _, fp := range up.UnifiedFilePatches() {
+		r, err := a.checkPaths(fp)
+		if err != nil {
+			return nil, err
+		}
+
+		if r != nil {
+			result.Files = append(result.Files, r)
+			return result, result.Error()
+		}
+
+		r, err = a.apply(fp)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Files = append(result.Files, r)
+	}
+
+	if !o.Check && result.applied(o) {
+		if err := a.write(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, result.Error()
+}
+
+// unifiedPatch returns p as a decoded patch, with its hunks.
+func unifiedPatch(p fdiff.Patch) (*fdiff.UnifiedPatch, error) {
+	if up, ok := p.(*fdiff.UnifiedPatch); ok {
+		return up, nil
+	}
+
+	var buf bytes.Buffer
+	e := fdiff.NewUnifiedEncoderWithOptions(&buf, fdiff.DefaultContextLines,
+		&fdiff.UnifiedEncoderOptions{Binary: true})
+	if err := e.Encode(p); err != nil {
+		return nil, err
+	}
+
+	up := &fdiff.UnifiedPatch{}
+	return up, fdiff.NewDecoder(&buf).Decode(up)
+}
+
+// patchedFile is the state of a file being patched.
+type patchedFile struct {
+	content []byte
+	mode    filemode.FileMode
+	exists  bool
+	// stages are the contents of the base, ours and theirs versions of a
+	// file merged with conflicts.
+	stages map[index.Stage][]byte
+	// rejects are the hunks of its patch that did not apply.
+	rejects []*fdiff.UnifiedHunk
+	// from is the path of the file before the patch.
+	from string
+}
+
+// patchApplier applies the patches of the files, keeping the state of the
+// patched files until they are written.
+type patchApplier struct {
+	w     *Worktree
+	o     *ApplyOptions
+	idx   *index.Index
+	files map[string]*patchedFile
+	paths []string
+}
+
+func (a *patchApplier) apply(fp *fdiff.UnifiedFilePatch) (*ApplyFileResult, error) {
+	path := fp.ToPath
+	if path == "" {
+		path = fp.FromPath
+	}
+
+	r := &ApplyFileResult{Path: path}
+	fail := func(msg string) (*ApplyFileResult, error) {
+		r.Status, r.Message = ApplyFailed, msg
+		return r, nil
+	}
+
+	src := &patchedFile{}
+	if fp.FromPath != "" {
+		var err error
+		if src, err = a.read(fp.FromPath); err != nil {
+			return nil, err
+		}
+
+		if !src.exists {
+			return fail(a.missing())
+		}
+
+		msg, err := a.checkIndex(fp.FromPath, src)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg != "" {
+			return fail(msg)
+		}
+	}
+
+	if fp.ToPath != "" && fp.ToPath != fp.FromPath {
+		msg, err := a.checkNew(fp.ToPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg != "" {
+			return fail(msg)
+		}
+	}
+
+	content, stages, err := a.content(fp, src, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Status == ApplyFailed {
+		return r, nil
+	}
+
+	if r.Status == ApplyRejected && !a.o.Reject {
+		return r, nil
+	}
+
+	if fp.ToPath == "" {
+		if len(content) != 0 {
+			return fail("removal patch leaves file contents")
+		}
+
+		a.set(fp.FromPath, &patchedFile{from: fp.FromPath})
+		return r, nil
+	}
+
+	if fp.FromPath != fp.ToPath && !fp.Copy && fp.FromPath != "" {
+		a.set(fp.FromPath, &patchedFile{from: fp.FromPath})
+	}
+
+	f := &patchedFile{content: content, mode: fp.ToMode, exists: true, from: fp.FromPath}
+	if f.mode == filemode.Empty {
+		f.mode = src.mode
+	}
+
+	if f.mode == filemode.Empty {
+		f.mode = filemode.Regular
+	}
+
+	f.stages = stages
+	for i, h := range r.Hunks {
+		if h.Rejected {
+			f.rejects = append(f.rejects, fp.Hunks[i])
+		}
+	}
+
+	a.set(fp.ToPath, f)
+	return r, nil
+}
+
+// checkPaths checks the paths of a file patch, as git apply does, before
+// anything is written, and returns a failed result if one is not valid.
+func (a *patchApplier) checkPaths(fp *fdiff.UnifiedFilePatch) (*ApplyFileResult, error) {
+	for _, path := range []string{fp.FromPath, fp.ToPath} {
+		if path == "" {
+			continue
+		}
+
+		msg := invalidPath
+		ok := isValidPatchPath(path)
+		if ok {
+			msg = beyondSymlink
+			var err error
+			if ok, err = a.checkLeadingDirs(path); err != nil {
+				return nil, err
+			}
+		}
+
+		if !ok {
+			return &ApplyFileResult{Path: path, Status: ApplyFailed, Message: msg}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isValidPatchPath returns true if the path is relative and clean, without
+// . or .. components, and none of its components is .git, ignoring case.
+func isValidPatchPath(path string) bool {
+	for _, c := range strings.Split(path, "/") {
+		if c == "" || c == "." || c == ".." || strings.EqualFold(c, GitDirName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLeadingDirs returns false if a leading directory of the path is a
+// symbolic link, in the files already patched, or in the index or the
+// worktree the patch is applied to.
+func (a *patchApplier) checkLeadingDirs(path string) (bool, error) {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if f, ok := a.files[dir]; ok {
+			if f.exists && f.mode == filemode.Symlink {
+				return false, nil
+			}
+
+			continue
+		}
+
+		if a.o.Cached {
+			e, err := a.idx.Entry(dir)
+			if err == index.ErrEntryNotFound {
+				continue
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			if e.Mode == filemode.Symlink {
+				return false, nil
+			}
+
+			continue
+		}
+
+		fi, err := a.w.Filesystem.Lstat(dir)
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// content returns the content of the file once patched, and the contents of
+// its stages if it was merged with conflicts. It sets the status and the
+// results of the hunks of r.
+func (a *patchApplier) content(fp *fdiff.UnifiedFilePatch, src *patchedFile, r *ApplyFileResult) ([]byte, map[index.Stage][]byte, error) {
+	if a.o.ThreeWay && fp.FromPath != "" && !fp.Binary {
+		content, stages, ok, err := a.merge(fp, src, r)
+		if err != nil || ok {
+			return content, stages, err
+		}
+	}
+
+	content, hunks, err := fp.Apply(src.content, a.o.Fuzz)
+	r.Hunks = hunks
+	switch err {
+	case nil:
+		return content, nil, nil
+	case fdiff.ErrPatchRejected:
+		r.Status = ApplyRejected
+		return content, nil, nil
+	case fdiff.ErrBinaryPatchData:
+		content, err = a.binaryContent(fp, src, r)
+		return content, nil, err
+	}
+
+	r.Status, r.Message = ApplyFailed, err.Error()
+	return nil, nil, nil
+}
+
+// merge merges the changes of the patch with the ones of the file, if the
+// blob of the file before the patch is in the repository and the patch
+// applies to it. It returns false if the changes can not be merged.
+func (a *patchApplier) merge(fp *fdiff.UnifiedFilePatch, src *patchedFile, r *ApplyFileResult) (
+	[]byte, map[index.Stage][]byte, bool, error) {
+	h, ok, err := a.resolveBlob(fp.FromIndex)
+	if err != nil || !ok {
+		return nil, nil, false, err
+	}
+
+	base, err := a.blobContent(h)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	theirs, _, err := fp.Apply(base, 0)
+	if err != nil {
+		return nil, nil, false, nil
+	}
+
+	if bytes.Equal(base, src.content) {
+		return theirs, nil, true, nil
+	}
+
+	merged, clean := diff.Merge(string(base), string(src.content), string(theirs), oursName, theirsName)
+	if clean {
+		r.Status = ApplyMerged
+		return []byte(merged), nil, true, nil
+	}
+
+	r.Status = ApplyConflict
+	return []byte(merged), map[index.Stage][]byte{
+		index.AncestorMode: base,
+		index.OurMode:      src.content,
+		index.TheirMode:    theirs,
+	}, true, nil
+}
+
+// binaryContent returns the content of a binary file patched by a patch
+// without data, if the blob of its index line is in the repository and the
+// file is the one it was generated from.
+func (a *patchApplier) binaryContent(fp *fdiff.UnifiedFilePatch, src *patchedFile, r *ApplyFileResult) ([]byte, error) {
+	from, to, ok := fp.FullIndex()
+	switch {
+	case !ok:
+		r.Message = fdiff.ErrBinaryPatchFullIndex.Error()
+	case from.IsZero() && len(src.content) != 0,
+		!from.IsZero() && plumbing.ComputeHash(plumbing.BlobObject, src.content) != from:
+		r.Message = fdiff.ErrBinaryPatchMismatch.Error()
+	case to.IsZero():
+		return nil, nil
+	default:
+		content, err := a.blobContent(to)
+		if err == plumbing.ErrObjectNotFound {
+			r.Message = fdiff.ErrBinaryPatchData.Error()
+			break
+		}
+
+		return content, err
+	}
+
+	r.Status = ApplyFailed
+	return nil, nil
+}
+
+// read returns the current state of a file, in the index if the patch is
+// applied to the index only, in the worktree otherwise.
+func (a *patchApplier) read(path string) (*patchedFile, error) {
+	if f, ok := a.files[path]; ok {
+		return f, nil
+	}
+
+	if a.o.Cached {
+		e, err := a.idx.Entry(path)
+		if err == index.ErrEntryNotFound {
+			return &patchedFile{}, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := a.blobContent(e.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		return &patchedFile{content: content, mode: e.Mode, exists: true}, nil
+	}
+
+	fs := a.w.Filesystem
+	fi, err := fs.Lstat(path)
+	if os.IsNotExist(err) {
+		return &patchedFile{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &patchedFile{exists: true}
+	if f.mode, err = filemode.NewFromOSFileMode(fi.Mode()); err != nil {
+		return nil, err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := fs.Readlink(path)
+		f.content = []byte(target)
+		return f, err
+	}
+
+	f.content, err = readFile(fs, path)
+	return f, err
+}
+
+func readFile(fs billy.Filesystem, path string) (content []byte, err error) {
+	r, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return stdioutil.ReadAll(r)
+}
+
+// checkIndex checks that a file patched in the worktree and in the index
+// is the same in both, and returns the reason if it is not.
+func (a *patchApplier) checkIndex(path string, f *patchedFile) (string, error) {
+	if !a.o.Index || a.o.Cached {
+		return "", nil
+	}
+
+	if _, ok := a.files[path]; ok {
+		return "", nil
+	}
+
+	e, err := a.idx.Entry(path)
+	if err == index.ErrEntryNotFound {
+		return "does not exist in index", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if e.Hash != plumbing.ComputeHash(plumbing.BlobObject, f.content) {
+		return "does not match index", nil
+	}
+
+	return "", nil
+}
+
+// checkNew checks that a file created by a patch does not exist yet, and
+// returns the reason if it does.
+func (a *patchApplier) checkNew(path string) (string, error) {
+	dst, err := a.read(path)
+	if err != nil || dst.exists {
+		return a.exists(), err
+	}
+
+	if !a.o.Index || a.o.Cached {
+		return "", nil
+	}
+
+	if _, ok := a.files[path]; ok {
+		return "", nil
+	}
+
+	_, err = a.idx.Entry(path)
+	switch err {
+	case nil:
+		return "already exists in index", nil
+	case index.ErrEntryNotFound:
+		return "", nil
+	}
+
+	return "", err
+}
+
+func (a *patchApplier) missing() string {
+	if a.o.Cached {
+		return "does not exist in index"
+	}
+
+	return "does not exist in working directory"
+}
+
+func (a *patchApplier) exists() string {
+	if a.o.Cached {
+		return "already exists in index"
+	}
+
+	return "already exists in working directory"
+}
+
+func (a *patchApplier) set(path string, f *patchedFile) {
+	if _, ok := a.files[path]; !ok {
+		a.paths = append(a.paths, path)
+	}
+
+	a.files[path] = f
+}
+
+// resolveBlob returns the blob with the given hash, maybe abbreviated, and
+// false if it is not in the repository or the abbreviation is ambiguous.
+func (a *patchApplier) resolveBlob(prefix string) (plumbing.Hash, bool, error) {
+	if len(prefix) == 2*len(plumbing.ZeroHash) {
+		h := plumbing.NewHash(prefix)
+		err := a.w.r.Storer.HasEncodedObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			return h, false, nil
+		}
+
+		return h, err == nil && !h.IsZero(), err
+	}
+
+	if prefix == "" || strings.Trim(prefix, "0") == "" {
+		return plumbing.ZeroHash, false, nil
+	}
+
+	iter, err := a.w.r.Storer.IterEncodedObjects(plumbing.BlobObject)
+	if err != nil {
+		return plumbing.ZeroHash, false, err
+	}
+
+	var found []plumbing.Hash
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if strings.HasPrefix(obj.Hash().String(), prefix) {
+			found = append(found, obj.Hash())
+		}
+
+		if len(found) > 1 {
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+
+	if err != nil || len(found) != 1 {
+		return plumbing.ZeroHash, false, err
+	}
+
+	return found[0], true, nil
+}
+
+func (a *patchApplier) blobContent(h plumbing.Hash) (content []byte, err error) {
+	b, err := object.GetBlob(a.w.r.Storer, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return stdioutil.ReadAll(r)
+}
+
+func (a *patchApplier) storeBlob(content []byte) (h plumbing.Hash, err error) {
+	obj := a.w.r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return a.w.r.Storer.SetEncodedObject(obj)
+}
+
+// write writes the patched files to the worktree, the index or both.
+func (a *patchApplier) write() error {
+	for _, path := range a.paths {
+		f := a.files[path]
+		if !a.o.Cached {
+			if err := a.writeFile(path, f); err != nil {
+				return err
+			}
+		}
+
+		if a.idx != nil {
+			if err := a.writeEntry(path, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	if a.idx != nil {
+		return a.w.r.Storer.SetIndex(a.idx)
+	}
+
+	return nil
+}
+
+func (a *patchApplier) writeFile(path string, f *patchedFile) (err error) {
+	fs := a.w.Filesystem
+	if len(f.rejects) != 0 {
+		if err := a.writeRejects(path, f); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fs.Lstat(path); err == nil {
+		if !f.exists {
+			return rmFileAndDirIfEmpty(fs, path)
+		}
+
+		// to apply perm changes the file is deleted, billy doesn't implement
+		// chmod
+		if err := fs.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if !f.exists {
+		return nil
+	}
+
+	if f.mode == filemode.Symlink {
+		return fs.Symlink(string(f.content), path)
+	}
+
+	mode, err := f.mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	to, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(to, &err)
+
+	_, err = to.Write(f.content)
+	return err
+}
+
+// writeRejects writes the rejected hunks of a file to <file>.rej, as git
+// apply --reject does.
+func (a *patchApplier) writeRejects(path string, f *patchedFile) (err error) {
+	from := f.from
+	if from == "" {
+		from = path
+	}
+
+	rej, err := a.w.Filesystem.Create(path + rejectSuffix)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(rej, &err)
+
+	if _, err := fmt.Fprintf(rej, rejectHeader, from, path); err != nil {
+		return err
+	}
+
+	for _, h := range f.rejects {
+		if _, err := rej.Write([]byte(h.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *patchApplier) writeEntry(path string, f *patchedFile) error {
+	for {
+		if _, err := a.idx.Remove(path); err != nil {
+			break
+		}
+	}
+
+	if !f.exists {
+		return nil
+	}
+
+	if f.stages != nil {
+		for _, s := range []index.Stage{index.AncestorMode, index.OurMode, index.TheirMode} {
+			h, err := a.storeBlob(f.stages[s])
+			if err != nil {
+				return err
+			}
+
+			e := a.idx.Add(path)
+			e.Hash, e.Mode, e.Stage = h, f.mode, s
+		}
+
+		return nil
+	}
+
+	h, err := a.storeBlob(f.content)
+	if err != nil {
+		return err
+	}
+
+	if !a.o.Cached {
+		return a.w.addIndexFromFile(path, h, a.idx)
+	}
+
+	e := a.idx.Add(path)
+	e.Hash, e.Mode = h, f.mode
+	if f.mode.IsRegular() {
+		e.Size = uint32(len(f.content))
+	}
+
+	return nil
+}
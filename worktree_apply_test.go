@@ -0,0 +1,459 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+const applyFoo = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+
+// applyWorktree returns a worktree with the files foo and bin committed.
+func (s *WorktreeSuite) applyWorktree(c *C) *Worktree {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	s.applyCommit(c, w, map[string]string{"foo": applyFoo, "bin": "bin\x00ary"})
+	return w
+}
+
+func (s *WorktreeSuite) applyCommit(c *C, w *Worktree, files map[string]string) plumbing.Hash {
+	for path, content := range files {
+		err := util.WriteFile(w.Filesystem, path, []byte(content), 0644)
+		c.Assert(err, IsNil)
+		_, err = w.Add(path)
+		c.Assert(err, IsNil)
+	}
+
+	h, err := w.Commit("files\n", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	return h
+}
+
+func (s *WorktreeSuite) applyPatch(c *C, patch string) *fdiff.UnifiedPatch {
+	p := &fdiff.UnifiedPatch{}
+	err := fdiff.NewDecoder(strings.NewReader(patch)).Decode(p)
+	c.Assert(err, IsNil)
+	return p
+}
+
+func (s *WorktreeSuite) assertFile(c *C, w *Worktree, path, content string) {
+	f, err := readFile(w.Filesystem, path)
+	c.Assert(err, IsNil)
+	c.Assert(string(f), Equals, content)
+}
+
+func (s *WorktreeSuite) assertEntry(c *C, w *Worktree, path, content string) {
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	e, err := idx.Entry(path)
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash, Equals, plumbing.ComputeHash(plumbing.BlobObject, []byte(content)))
+}
+
+const applyFooPatch = `diff --git a/foo b/foo
+index e17e7c6..0e1b4ea 100644
+--- a/foo
++++ b/foo
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -7,4 +7,4 @@
+ 7
+ 8
+ 9
+-10
++ten
+diff --git a/bar b/bar
+new file mode 100644
+index 0000000..5716ca5
+--- /dev/null
++++ b/bar
+@@ -0,0 +1 @@
++bar
+`
+
+const applyFooPatched = "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"
+
+func (s *WorktreeSuite) TestApply(c *C) {
+	w := s.applyWorktree(c)
+
+	r, err := w.Apply(s.applyPatch(c, applyFooPatch), nil)
+	c.Assert(err, IsNil)
+	c.Assert(r.Files, HasLen, 2)
+	c.Assert(r.Files[0].Path, Equals, "foo")
+	c.Assert(r.Files[0].Status, Equals, ApplyOK)
+	c.Assert(r.Files[0].Hunks, DeepEquals, []fdiff.HunkResult{{Line: 1}, {Line: 7}})
+	c.Assert(r.Files[1].Path, Equals, "bar")
+
+	s.assertFile(c, w, "foo", applyFooPatched)
+	s.assertFile(c, w, "bar", "bar\n")
+	s.assertEntry(c, w, "foo", applyFoo)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+	c.Assert(status.File("bar").Worktree, Equals, Untracked)
+}
+
+func (s *WorktreeSuite) TestApplyIndex(c *C) {
+	w := s.applyWorktree(c)
+
+	_, err := w.Apply(s.applyPatch(c, applyFooPatch), &ApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+
+	s.assertFile(c, w, "foo", applyFooPatched)
+	s.assertEntry(c, w, "foo", applyFooPatched)
+	s.assertEntry(c, w, "bar", "bar\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	c.Assert(status.File("bar").Staging, Equals, Added)
+}
+
+func (s *WorktreeSuite) TestApplyIndexMismatch(c *C) {
+	w := s.applyWorktree(c)
+	err := util.WriteFile(w.Filesystem, "foo", []byte(applyFoo+"11\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := w.Apply(s.applyPatch(c, applyFooPatch), &ApplyOptions{Index: true})
+	c.Assert(err, NotNil)
+	c.Assert(r.Files[0].Status, Equals, ApplyFailed)
+	c.Assert(r.Files[0].Message, Equals, "does not match index")
+
+	s.assertFile(c, w, "foo", applyFoo+"11\n")
+	_, err = w.Filesystem.Stat("bar")
+	c.Assert(err, NotNil)
+}
+
+func (s *WorktreeSuite) TestApplyCached(c *C) {
+	w := s.applyWorktree(c)
+
+	_, err := w.Apply(s.applyPatch(c, applyFooPatch), &ApplyOptions{Cached: true})
+	c.Assert(err, IsNil)
+
+	s.assertFile(c, w, "foo", applyFoo)
+	s.assertEntry(c, w, "foo", applyFooPatched)
+	s.assertEntry(c, w, "bar", "bar\n")
+	_, err = w.Filesystem.Stat("bar")
+	c.Assert(err, NotNil)
+}
+
+func (s *WorktreeSuite) TestApplyCheck(c *C) {
+	w := s.applyWorktree(c)
+
+	r, err := w.Apply(s.applyPatch(c, applyFooPatch), &ApplyOptions{Check: true, Index: true})
+	c.Assert(err, IsNil)
+	c.Assert(r.Files, HasLen, 2)
+
+	s.assertFile(c, w, "foo", applyFoo)
+	s.assertEntry(c, w, "foo", applyFoo)
+	_, err = w.Filesystem.Stat("bar")
+	c.Assert(err, NotNil)
+}
+
+func (s *WorktreeSuite) TestApplyExisting(c *C) {
+	w := s.applyWorktree(c)
+	err := util.WriteFile(w.Filesystem, "bar", []byte("bar\n"), 0644)
+	c.Assert(err, IsNil)
+
+	r, err := w.Apply(s.applyPatch(c, applyFooPatch), nil)
+	c.Assert(err, ErrorMatches, "bar: already exists in working directory")
+	c.Assert(r.Files[1].Status, Equals, ApplyFailed)
+	s.assertFile(c, w, "foo", applyFoo)
+}
+
+const applyRejectPatch = `diff --git a/foo b/foo
+--- a/foo
++++ b/foo
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+@@ -5,3 +5,3 @@
+ 5
+-x
++y
+ 7
+`
+
+func (s *WorktreeSuite) TestApplyReject(c *C) {
+	w := s.applyWorktree(c)
+
+	r, err := w.Apply(s.applyPatch(c, applyRejectPatch), nil)
+	c.Assert(err, ErrorMatches, "foo: patch does not apply")
+	c.Assert(r.Files[0].Status, Equals, ApplyRejected)
+	c.Assert(r.Files[0].Hunks, DeepEquals, []fdiff.HunkResult{{Line: 1}, {Rejected: true}})
+	s.assertFile(c, w, "foo", applyFoo)
+
+	r, err = w.Apply(s.applyPatch(c, applyRejectPatch), &ApplyOptions{Reject: true})
+	c.Assert(err, ErrorMatches, "foo: patch does not apply")
+	c.Assert(r.Files[0].Status, Equals, ApplyRejected)
+	s.assertFile(c, w, "foo", strings.Replace(applyFoo, "1\n", "one\n", 1))
+	s.assertFile(c, w, "foo.rej", `diff a/foo b/foo	(rejected hunks)
+@@ -5,3 +5,3 @@
+ 5
+-x
++y
+ 7
+`)
+}
+
+func (s *WorktreeSuite) TestApplyFuzz(c *C) {
+	w := s.applyWorktree(c)
+	p := s.applyPatch(c, `--- a/foo
++++ b/foo
+@@ -4,5 +4,5 @@
+ four
+ 5
+-6
++six
+ 7
+ 8
+`)
+
+	_, err := w.Apply(p, nil)
+	c.Assert(err, NotNil)
+
+	r, err := w.Apply(p, &ApplyOptions{Fuzz: 1})
+	c.Assert(err, IsNil)
+	c.Assert(r.Files[0].Hunks, DeepEquals, []fdiff.HunkResult{{Line: 5, Fuzz: 1}})
+	s.assertFile(c, w, "foo", strings.Replace(applyFoo, "6\n", "six\n", 1))
+}
+
+func (s *WorktreeSuite) TestApplyRenameDelete(c *C) {
+	w := s.applyWorktree(c)
+	p := s.applyPatch(c, `diff --git a/foo b/baz
+similarity index 90%
+rename from foo
+rename to baz
+--- a/foo
++++ b/baz
+@@ -8,3 +8,3 @@
+ 8
+ 9
+-10
++ten
+diff --git a/bin b/bin
+deleted file mode 100644
+index 87ae6b695deceaf160611414f7dcd5c7366b2e79..0000000000000000000000000000000000000000
+Binary files a/bin and /dev/null differ
+`)
+
+	_, err := w.Apply(p, &ApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+
+	s.assertFile(c, w, "baz", strings.Replace(applyFoo, "10\n", "ten\n", 1))
+	s.assertEntry(c, w, "baz", strings.Replace(applyFoo, "10\n", "ten\n", 1))
+	for _, path := range []string{"foo", "bin"} {
+		_, err = w.Filesystem.Stat(path)
+		c.Assert(err, NotNil)
+
+		idx, err := w.r.Storer.Index()
+		c.Assert(err, IsNil)
+		_, err = idx.Entry(path)
+		c.Assert(err, Equals, index.ErrEntryNotFound)
+	}
+}
+
+func (s *WorktreeSuite) TestApplyThreeWay(c *C) {
+	w := s.applyWorktree(c)
+	from, err := w.r.CommitObject(s.applyCommit(c, w, map[string]string{"foo": applyFoo}))
+	c.Assert(err, IsNil)
+	to, err := w.r.CommitObject(s.applyCommit(c, w, map[string]string{
+		"foo": strings.Replace(applyFoo, "2\n", "two\n", 1),
+	}))
+	c.Assert(err, IsNil)
+
+	patch, err := from.Patch(to)
+	c.Assert(err, IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Hash: from.Hash, Force: true})
+	c.Assert(err, IsNil)
+
+	// the change can not be applied directly but merged
+	ours := strings.Replace(applyFoo, "4\n", "four\n", 1)
+	err = util.WriteFile(w.Filesystem, "foo", []byte(ours), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	_, err = w.Apply(patch, nil)
+	c.Assert(err, NotNil)
+
+	r, err := w.Apply(patch, &ApplyOptions{ThreeWay: true})
+	c.Assert(err, IsNil)
+	c.Assert(r.Files[0].Status, Equals, ApplyMerged)
+	merged := strings.Replace(ours, "2\n", "two\n", 1)
+	s.assertFile(c, w, "foo", merged)
+	s.assertEntry(c, w, "foo", merged)
+
+	// the conflicting changes are left between conflict markers
+	ours = strings.Replace(applyFoo, "2\n", "deux\n", 1)
+	err = util.WriteFile(w.Filesystem, "foo", []byte(ours), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	r, err = w.Apply(patch, &ApplyOptions{ThreeWay: true})
+	c.Assert(err, ErrorMatches, "applied patch to foo with conflicts")
+	c.Assert(r.Files[0].Status, Equals, ApplyConflict)
+	s.assertFile(c, w, "foo", "1\n<<<<<<< ours\ndeux\n=======\ntwo\n>>>>>>> theirs\n3\n4\n5\n6\n7\n8\n9\n10\n")
+
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	var stages []index.Stage
+	for _, e := range idx.Entries {
+		if e.Name == "foo" {
+			stages = append(stages, e.Stage)
+		}
+	}
+
+	c.Assert(stages, DeepEquals, []index.Stage{index.AncestorMode, index.OurMode, index.TheirMode})
+}
+
+func (s *WorktreeSuite) TestApplyBinary(c *C) {
+	w := s.applyWorktree(c)
+	from, err := w.r.Head()
+	c.Assert(err, IsNil)
+	content := bytes.Repeat([]byte("binary\x00content\n"), 100)
+	h := s.applyCommit(c, w, map[string]string{"bin": string(content)})
+
+	fromCommit, err := w.r.CommitObject(from.Hash())
+	c.Assert(err, IsNil)
+	toCommit, err := w.r.CommitObject(h)
+	c.Assert(err, IsNil)
+	patch, err := fromCommit.Patch(toCommit)
+	c.Assert(err, IsNil)
+
+	// applied to a repository without the blobs
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+	other, err := r.Worktree()
+	c.Assert(err, IsNil)
+	s.applyCommit(c, other, map[string]string{"foo": applyFoo, "bin": "bin\x00ary"})
+
+	_, err = other.Apply(patch, &ApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+	s.assertFile(c, other, "bin", string(content))
+	s.assertEntry(c, other, "bin", string(content))
+
+	res, err := other.Apply(patch, nil)
+	c.Assert(err, NotNil)
+	c.Assert(res.Files[0].Status, Equals, ApplyFailed)
+	c.Assert(res.Files[0].Message, Equals, fdiff.ErrBinaryPatchMismatch.Error())
+}
+
+func (s *WorktreeSuite) TestApplyInvalidOptions(c *C) {
+	w := s.applyWorktree(c)
+	p := s.applyPatch(c, applyFooPatch)
+
+	_, err := w.Apply(p, &ApplyOptions{ThreeWay: true, Reject: true})
+	c.Assert(err, Equals, ErrApplyThreeWayReject)
+
+	_, err = w.Apply(p, &ApplyOptions{Fuzz: -1})
+	c.Assert(err, Equals, ErrApplyNegativeFuzz)
+}
+
+const applyNewFilePatch = `diff --git a/%[1]s b/%[1]s
+new file mode 100755
+index 0000000..257cc56
+--- /dev/null
++++ b/%[1]s
+@@ -0,0 +1 @@
++foo
+`
+
+func (s *WorktreeSuite) TestApplyInvalidPath(c *C) {
+	for _, path := range []string{
+		".git/hooks/pre-commit",
+		".GIT/x",
+		"sub/.Git/config",
+		"sub/../.git/config2",
+		"../escape.txt",
+		"./foo",
+		"sub//foo",
+		"/tmp/foo",
+	} {
+		w := s.applyWorktree(c)
+		p := s.applyPatch(c, fmt.Sprintf(applyNewFilePatch, path))
+
+		res, err := w.Apply(p, &ApplyOptions{Index: true})
+		c.Assert(err, NotNil, Commentf("%s", path))
+		c.Assert(res.Files, HasLen, 1)
+		c.Assert(res.Files[0].Status, Equals, ApplyFailed)
+		c.Assert(res.Files[0].Message, Equals, "invalid path")
+
+		status, err := w.Status()
+		c.Assert(err, IsNil)
+		c.Assert(status.IsClean(), Equals, true, Commentf("%s", path))
+	}
+}
+
+func (s *WorktreeSuite) TestApplyBeyondSymlink(c *C) {
+	dir, err := ioutil.TempDir("", "apply-symlink")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside")
+	c.Assert(os.Mkdir(outside, 0755), IsNil)
+
+	r, err := PlainInit(filepath.Join(dir, "worktree"), false)
+	c.Assert(err, IsNil)
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	s.applyCommit(c, w, map[string]string{"foo": applyFoo})
+	c.Assert(w.Filesystem.Symlink(outside, "link"), IsNil)
+
+	res, err := w.Apply(s.applyPatch(c, fmt.Sprintf(applyNewFilePatch, "link/evil")), nil)
+	c.Assert(err, NotNil)
+	c.Assert(res.Files[0].Status, Equals, ApplyFailed)
+	c.Assert(res.Files[0].Message, Equals, "beyond a symbolic link")
+
+	_, err = os.Lstat(filepath.Join(outside, "evil"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *WorktreeSuite) TestApplyBeyondPatchedSymlink(c *C) {
+	w := s.applyWorktree(c)
+	patch := `diff --git a/link b/link
+new file mode 120000
+index 0000000..fa2f8e2
+--- /dev/null
++++ b/link
+@@ -0,0 +1 @@
++/tmp
+\ No newline at end of file
+` + fmt.Sprintf(applyNewFilePatch, "link/evil")
+
+	res, err := w.Apply(s.applyPatch(c, patch), &ApplyOptions{Cached: true})
+	c.Assert(err, NotNil)
+	c.Assert(res.Files, HasLen, 2)
+	c.Assert(res.Files[1].Message, Equals, "beyond a symbolic link")
+
+	idx, err := w.r.Storer.Index()
+	c.Assert(err, IsNil)
+	_, err = idx.Entry("link")
+	c.Assert(err, Equals, index.ErrEntryNotFound)
+}
@@ -53,7 +53,7 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 }
 
 func (w *Worktree) autoAddModifiedAndDeleted() error {
-	s, err := w.Status()
+	s, err := w.statusWithoutRenames()
 	if err != nil {
 		return err
 	}
@@ -25,6 +25,8 @@ import (
 )
 
 func (s *WorktreeSuite) TestCommitInvalidOptions(c *C) {
+	defer IsolateConfig(c)()
+
 	r, err := Init(memory.NewStorage(), memfs.New())
 	c.Assert(err, IsNil)
 
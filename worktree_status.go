@@ -30,8 +30,19 @@ var (
 	ErrGlobNoMatches = errors.New("glob pattern did not match any files")
 )
 
-// Status returns the working tree status.
+// Status returns the working tree status, the staged renames being detected
+// with the default options of git.
 func (w *Worktree) Status() (Status, error) {
+	return w.StatusWithOptions(&StatusOptions{})
+}
+
+// StatusWithOptions returns the working tree status computed with the given
+// options.
+func (w *Worktree) StatusWithOptions(o *StatusOptions) (Status, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
 	var hash plumbing.Hash
 
 	ref, err := w.r.Head()
@@ -43,10 +54,16 @@ func (w *Worktree) Status() (Status, error) {
 		hash = ref.Hash()
 	}
 
-	return w.status(hash)
+	return w.status(hash, o)
+}
+
+// statusWithoutRenames returns the working tree status without detecting the
+// staged renames, for the operations only looking at the status of files.
+func (w *Worktree) statusWithoutRenames() (Status, error) {
+	return w.StatusWithOptions(&StatusOptions{DiffTree: &object.DiffTreeOptions{}})
 }
 
-func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
+func (w *Worktree) status(commit plumbing.Hash, o *StatusOptions) (Status, error) {
 	s := make(Status)
 
 	left, err := w.diffCommitWithStaging(commit, false)
@@ -73,6 +90,10 @@ func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
 		}
 	}
 
+	if err := w.detectStagedRenames(s, commit, left, o.DiffTree); err != nil {
+		return nil, err
+	}
+
 	right, err := w.diffStagingWithWorktree(false)
 	if err != nil {
 		return nil, err
@@ -103,6 +124,81 @@ func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
 	return s, nil
 }
 
+// detectStagedRenames sets the status of the staged files detected as
+// renames or copies of a file of the given commit.
+func (w *Worktree) detectStagedRenames(s Status, commit plumbing.Hash,
+	changes merkletrie.Changes, opts *object.DiffTreeOptions) error {
+	if !opts.DetectRenames || commit.IsZero() {
+		return nil
+	}
+
+	c, err := w.r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	t, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var candidates object.Changes
+	for _, ch := range changes {
+		var from, to object.ChangeEntry
+		if len(ch.From) != 0 && !ch.From.IsDir() {
+			name := ch.From.String()
+			e, err := t.FindEntry(name)
+			if err != nil {
+				return err
+			}
+
+			from = object.ChangeEntry{Name: name, TreeEntry: *e}
+		}
+
+		if len(ch.To) != 0 && !ch.To.IsDir() {
+			name := ch.To.String()
+			e, err := idx.Entry(name)
+			if err != nil {
+				return err
+			}
+
+			to = object.ChangeEntry{Name: name, TreeEntry: object.TreeEntry{
+				Name: path.Base(name),
+				Mode: e.Mode,
+				Hash: e.Hash,
+			}}
+		}
+
+		candidates = append(candidates, &object.Change{From: from, To: to})
+	}
+
+	detected, err := object.DetectRenames(w.r.Storer, candidates, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range detected {
+		switch {
+		case ch.IsRename():
+			delete(s, ch.From.Name)
+			fs := s.File(ch.To.Name)
+			fs.Staging = Renamed
+			fs.Extra = ch.From.Name
+		case ch.IsCopy():
+			fs := s.File(ch.To.Name)
+			fs.Staging = Copied
+			fs.Extra = ch.From.Name
+		}
+	}
+
+	return nil
+}
+
 func nameFromAction(ch *merkletrie.Change) string {
 	name := ch.To.String()
 	if name == "" {
@@ -261,7 +357,7 @@ func diffTreeIsEquals(a, b noder.Hasher) bool {
 // no error is returned. When path is a file, the blob.Hash is returned.
 func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	// TODO(mcuadros): remove plumbing.Hash from signature at v5.
-	s, err := w.Status()
+	s, err := w.statusWithoutRenames()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
@@ -337,7 +433,7 @@ func (w *Worktree) AddGlob(pattern string) error {
 		return ErrGlobNoMatches
 	}
 
-	s, err := w.Status()
+	s, err := w.statusWithoutRenames()
 	if err != nil {
 		return err
 	}
@@ -349,6 +445,11 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 	var saveIndex bool
 	for _, file := range files {
+		if file == GitDirName {
+			// ignore special git directory
+			continue
+		}
+
 		fi, err := w.Filesystem.Lstat(file)
 		if err != nil {
 			return err
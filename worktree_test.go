@@ -293,6 +293,26 @@ func (s *WorktreeSuite) TestCheckout(c *C) {
 	c.Assert(idx.Entries, HasLen, 9)
 }
 
+func (s *WorktreeSuite) TestCheckoutWithProgressHandler(c *C) {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	progress := &progressRecorder{}
+	err := w.Checkout(&CheckoutOptions{
+		Force:           true,
+		ProgressHandler: progress,
+	})
+	c.Assert(err, IsNil)
+
+	e, ok := progress.done(plumbing.UpdatingFiles, false)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Current, Equals, int64(9))
+	c.Assert(e.Total, Equals, int64(9))
+	c.Assert(progress.events, HasLen, 10)
+}
+
 func (s *WorktreeSuite) TestCheckoutForce(c *C) {
 	w := &Worktree{
 		r:          s.Repository,
@@ -1328,6 +1348,29 @@ func (s *WorktreeSuite) TestAddGlob(c *C) {
 	c.Assert(file.Worktree, Equals, Unmodified)
 }
 
+func (s *WorktreeSuite) TestAddGlobIgnoresGitDir(c *C) {
+	dir, err := ioutil.TempDir("", "add-glob")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("FOO"), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.AddGlob("*")
+	c.Assert(err, IsNil)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 1)
+	c.Assert(idx.Entries[0].Name, Equals, "foo")
+}
+
 func (s *WorktreeSuite) TestAddGlobErrorNoMatches(c *C) {
 	r, _ := Init(memory.NewStorage(), memfs.New())
 	w, _ := r.Worktree()
@@ -1530,10 +1573,77 @@ func (s *WorktreeSuite) TestMove(c *C) {
 
 	status, err := w.Status()
 	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("foo").Staging, Equals, Renamed)
+	c.Assert(status.File("foo").Extra, Equals, "LICENSE")
+	c.Assert(status.String(), Equals, "R  LICENSE -> foo\n")
+
+	status, err = w.StatusWithOptions(&StatusOptions{DiffTree: &object.DiffTreeOptions{}})
+	c.Assert(err, IsNil)
 	c.Assert(status, HasLen, 2)
 	c.Assert(status.File("LICENSE").Staging, Equals, Deleted)
 	c.Assert(status.File("foo").Staging, Equals, Added)
+}
+
+func (s *WorktreeSuite) TestStatusRenamedAndModified(c *C) {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	c.Assert(err, IsNil)
+
+	_, err = w.Move("LICENSE", "foo")
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(fs, "foo", []byte("foo"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("foo").Staging, Equals, Renamed)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+}
+
+func (s *WorktreeSuite) TestStatusCopied(c *C) {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	c.Assert(err, IsNil)
+
+	f, err := fs.Open("LICENSE")
+	c.Assert(err, IsNil)
+	license, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
 
+	err = util.WriteFile(fs, "LICENSE", append(license, "foo\n"...), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(fs, "foo", license, 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Add("LICENSE")
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	status, err := w.StatusWithOptions(&StatusOptions{DiffTree: &object.DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   50,
+		DetectCopies:  true,
+	}})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 2)
+	c.Assert(status.File("LICENSE").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Staging, Equals, Copied)
+	c.Assert(status.File("foo").Extra, Equals, "LICENSE")
 }
 
 func (s *WorktreeSuite) TestMoveNotExistentEntry(c *C) {